@@ -1,6 +1,5 @@
-// Package main implements the UPM binary. It is the only
-// public-facing entry point to UPM, since UPM's Go packages are all
-// internal.
+// Package main implements the UPM binary. Go programs that want to
+// embed UPM should use the pkg/upm package instead.
 package main
 
 import "github.com/replit/upm/internal/cli"
@@ -2,10 +2,17 @@ package api
 
 import (
 	"fmt"
+	"io"
 	"net/http"
+
+	"github.com/replit/upm/internal/util"
 )
 
-var HttpClient = &UpmHttpClient{}
+// HttpClient is the client used for all registry requests. It honors
+// HTTP_PROXY, HTTPS_PROXY and NO_PROXY, as well as --proxy.
+var HttpClient = &UpmHttpClient{
+	Client: http.Client{Transport: util.HTTPTransport},
+}
 
 type UpmHttpClient struct {
 	http.Client
@@ -28,3 +35,32 @@ func (c *UpmHttpClient) Get(url string) (*http.Response, error) {
 	}
 	return c.Do(req)
 }
+
+// MaxResponseSize bounds the size of a registry response that UPM
+// reads, so that a broken or malicious registry cannot make it exhaust
+// memory. The largest legitimate responses, such as the npm document
+// of a package with thousands of versions, are a few tens of MiB.
+var MaxResponseSize int64 = 64 << 20
+
+// Endpoint returns the URL that resp answers, for error messages,
+// without any password in it.
+func Endpoint(resp *http.Response) string {
+	if resp.Request == nil || resp.Request.URL == nil {
+		return "registry"
+	}
+	return resp.Request.URL.Redacted()
+}
+
+// ReadResponse reads the body of a registry response, dying with an
+// error naming the endpoint if it cannot be read or is larger than
+// MaxResponseSize.
+func ReadResponse(resp *http.Response) []byte {
+	body, err := io.ReadAll(io.LimitReader(resp.Body, MaxResponseSize+1))
+	if err != nil {
+		util.DieNetwork("%s: could not read response: %s", Endpoint(resp), err)
+	}
+	if int64(len(body)) > MaxResponseSize {
+		util.DieProtocol("%s: response is larger than %d bytes", Endpoint(resp), MaxResponseSize)
+	}
+	return body
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/replit/upm/internal/util"
+)
+
+func TestHttpClientUsesLateProxy(t *testing.T) {
+	for _, name := range []string{"HTTP_PROXY", "HTTPS_PROXY", "http_proxy", "https_proxy", "NO_PROXY", "no_proxy", "REQUEST_METHOD"} {
+		// SetProxy uses os.Setenv; t.Setenv restores these afterwards.
+		t.Setenv(name, "")
+	}
+
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer proxy.Close()
+
+	// Make a request before the proxy is configured, which is what
+	// would make http.ProxyFromEnvironment cache the empty
+	// environment.
+	client := &UpmHttpClient{Client: http.Client{Transport: util.HTTPTransport}}
+	if resp, err := client.Get(proxy.URL); err == nil {
+		resp.Body.Close()
+	}
+
+	util.SetProxy(proxy.URL)
+
+	resp, err := client.Get("http://registry.example.com/express")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if proxied != "http://registry.example.com/express" {
+		t.Errorf("expected request to go through the proxy, got %q", proxied)
+	}
+}
+
+func TestReadResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(strings.Repeat("x", 2048)))
+	}))
+	defer server.Close()
+
+	defer func(max int64) { MaxResponseSize = max }(MaxResponseSize)
+	MaxResponseSize = 2048
+	resp, err := HttpClient.Get(server.URL + "/big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if body := ReadResponse(resp); len(body) != 2048 {
+		t.Errorf("expected the whole body, got %d bytes", len(body))
+	}
+
+	MaxResponseSize = 1024
+	resp, err = HttpClient.Get(server.URL + "/big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	err = util.Catch(func() { ReadResponse(resp) })
+	if err == nil || !strings.Contains(err.Error(), server.URL+"/big: response is larger than") {
+		t.Errorf("expected an error naming the endpoint, got %v", err)
+	}
+}
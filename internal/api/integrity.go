@@ -0,0 +1,33 @@
+package api
+
+// Values for IntegrityIssue.Kind.
+const (
+	// A locked package is not installed.
+	IntegrityNotInstalled = "not-installed"
+
+	// The installed version of a package is not the locked one.
+	IntegrityWrongVersion = "wrong-version"
+
+	// The hash that was recorded for a package when it was
+	// installed differs from the one in the lockfile.
+	IntegrityHashMismatch = "hash-mismatch"
+
+	// An installed file does not match the hash that was
+	// recorded for it when it was installed.
+	IntegrityModified = "modified"
+
+	// An installed file that was recorded when the package was
+	// installed is gone.
+	IntegrityMissingFile = "missing-file"
+)
+
+// IntegrityIssue is one discrepancy between the installed packages and
+// the lockfile, as returned by VerifyInstalled. The JSON form is the
+// machine-readable report of 'upm verify'.
+type IntegrityIssue struct {
+	Kind     string `json:"kind" pretty:"Kind"`
+	Name     string `json:"name" pretty:"Name"`
+	Path     string `json:"path,omitempty" pretty:"Path"`
+	Expected string `json:"expected,omitempty" pretty:"Expected"`
+	Actual   string `json:"actual,omitempty" pretty:"Actual"`
+}
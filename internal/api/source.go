@@ -0,0 +1,135 @@
+package api
+
+import (
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// SourceKind is the kind of a PkgSource.
+type SourceKind string
+
+// Constants of type SourceKind.
+const (
+	// A git repository, optionally at a branch, tag or commit.
+	SourceGit SourceKind = "git"
+	// An archive to download.
+	SourceURL SourceKind = "url"
+	// A directory or archive on the local filesystem.
+	SourcePath SourceKind = "path"
+)
+
+// PkgSource is where a package comes from if it is not installed from
+// the registry. It is what 'upm add' is given for git, URL and path
+// dependencies.
+type PkgSource struct {
+	Kind SourceKind
+
+	// The URL of the repository or archive, without a "git+"
+	// prefix or a ref, or the path as it was given.
+	Location string
+
+	// The branch, tag or commit of a git repository, or "" for
+	// the default branch.
+	Ref string
+}
+
+// String returns the source in the form that ParseSource understands:
+// "git+URL#ref", the URL, or the path.
+func (s PkgSource) String() string {
+	switch s.Kind {
+	case SourceGit:
+		str := s.Location
+		if !strings.HasPrefix(str, "git@") {
+			str = "git+" + str
+		}
+		if s.Ref != "" {
+			str += "#" + s.Ref
+		}
+		return str
+	default:
+		return s.Location
+	}
+}
+
+// archiveSuffixes are the extensions removed from the last element of
+// a URL or path to guess a package name.
+var archiveSuffixes = []string{".git", ".tar.gz", ".tgz", ".tar.bz2", ".zip", ".whl"}
+
+// Name guesses the name of the package from the last element of the
+// location, as in "repo" for "https://github.com/user/repo.git". It
+// returns "" if there is nothing to guess from.
+func (s PkgSource) Name() PkgName {
+	location := s.Location
+	if s.Kind == SourcePath {
+		location = filepath.ToSlash(filepath.Clean(strings.TrimPrefix(location, "file:")))
+	} else if u, err := url.Parse(location); err == nil && u.Path != "" {
+		location = u.Path
+	} else if _, p, ok := strings.Cut(location, ":"); ok {
+		// scp-like git locations, as in git@host:user/repo.git
+		location = p
+	}
+	name := path.Base(strings.TrimSuffix(location, "/"))
+	for _, suffix := range archiveSuffixes {
+		name = strings.TrimSuffix(name, suffix)
+	}
+	if name == "." || name == ".." || name == "/" {
+		return ""
+	}
+	// Wheels and sdists are named name-version.
+	if s.Kind != SourceGit {
+		if i := strings.Index(name, "-"); i > 0 && i+1 < len(name) && name[i+1] >= '0' && name[i+1] <= '9' {
+			name = name[:i]
+		}
+	}
+	return PkgName(name)
+}
+
+// ParseSource parses a git URL, archive URL or local path, as given to
+// 'upm add' in place of a package name or spec. Git URLs are those
+// starting with "git+" or "git@", and any URL ending in ".git"; a ref
+// may follow a "#". Paths must start with ".", "/", "~" or "file:" so
+// that they cannot be mistaken for package names. It returns false if
+// s is none of these.
+func ParseSource(s string) (PkgSource, bool) {
+	s = strings.TrimSpace(s)
+	switch {
+	case strings.HasPrefix(s, "git+"), strings.HasPrefix(s, "git@"), strings.HasPrefix(s, "git://"):
+		location, ref, _ := strings.Cut(strings.TrimPrefix(s, "git+"), "#")
+		return PkgSource{Kind: SourceGit, Location: location, Ref: ref}, location != ""
+	case strings.HasPrefix(s, "https://"), strings.HasPrefix(s, "http://"):
+		location, ref, _ := strings.Cut(s, "#")
+		if strings.HasSuffix(location, ".git") {
+			return PkgSource{Kind: SourceGit, Location: location, Ref: ref}, true
+		}
+		return PkgSource{Kind: SourceURL, Location: s}, true
+	case strings.HasPrefix(s, "file:"), strings.HasPrefix(s, "."), strings.HasPrefix(s, "/"), strings.HasPrefix(s, "~"):
+		return PkgSource{Kind: SourcePath, Location: s}, true
+	}
+	return PkgSource{}, false
+}
+
+// DefaultSpecSource is the SpecSource used for backends that do not
+// provide their own. It understands the specs that ParseSource does,
+// also in the form of a PEP 508 direct reference, as in
+// "@ git+https://github.com/user/repo".
+func DefaultSpecSource(spec PkgSpec) (PkgSource, bool) {
+	str := strings.TrimSpace(string(spec))
+	if rest, ok := strings.CutPrefix(str, "@"); ok {
+		str = strings.TrimSpace(rest)
+		// Direct references put a git ref after an @ in the
+		// path rather than after a #.
+		if strings.HasPrefix(str, "git+") && !strings.Contains(str, "#") {
+			if _, rest, ok := strings.Cut(str, "://"); ok {
+				if slash := strings.Index(rest, "/"); slash >= 0 {
+					p := rest[slash:]
+					if i := strings.LastIndex(p, "@"); i >= 0 {
+						str = str[:len(str)-len(p)] + p[:i] + "#" + p[i+1:]
+					}
+				}
+			}
+		}
+	}
+	return ParseSource(str)
+}
@@ -0,0 +1,69 @@
+package api
+
+import "testing"
+
+func TestParseSource(t *testing.T) {
+	for arg, expected := range map[string]PkgSource{
+		"git+https://github.com/user/repo#main": {Kind: SourceGit, Location: "https://github.com/user/repo", Ref: "main"},
+		"git+ssh://git@github.com/user/repo":    {Kind: SourceGit, Location: "ssh://git@github.com/user/repo"},
+		"git@github.com:user/repo.git#v1.0":     {Kind: SourceGit, Location: "git@github.com:user/repo.git", Ref: "v1.0"},
+		"https://github.com/user/repo.git":      {Kind: SourceGit, Location: "https://github.com/user/repo.git"},
+		"https://example.com/pkg-1.0.tar.gz":    {Kind: SourceURL, Location: "https://example.com/pkg-1.0.tar.gz"},
+		"../lib":                                {Kind: SourcePath, Location: "../lib"},
+		"file:vendor/lib":                       {Kind: SourcePath, Location: "file:vendor/lib"},
+	} {
+		source, ok := ParseSource(arg)
+		if !ok || source != expected {
+			t.Errorf("ParseSource(%q) = %+v, %v, expected %+v", arg, source, ok, expected)
+		}
+		if reparsed, ok := ParseSource(source.String()); !ok || reparsed != source {
+			t.Errorf("ParseSource(%q) = %+v, %v, expected it to round-trip", source.String(), reparsed, ok)
+		}
+	}
+
+	for _, arg := range []string{"flask", "@types/node", ">=1.0", "git+", ""} {
+		if source, ok := ParseSource(arg); ok {
+			t.Errorf("ParseSource(%q) = %+v, expected no source", arg, source)
+		}
+	}
+}
+
+func TestPkgSourceName(t *testing.T) {
+	for arg, expected := range map[string]PkgName{
+		"git+https://github.com/user/repo#main":    "repo",
+		"git@github.com:user/repo.git":             "repo",
+		"https://example.com/pkg-1.0.tar.gz":       "pkg",
+		"https://example.com/my_pkg-2.1-py3.whl":   "my_pkg",
+		"https://example.com/tools/my-tool.tar.gz": "my-tool",
+		"../lib/":             "lib",
+		"file:./vendor/thing": "thing",
+		"..":                  "",
+	} {
+		source, _ := ParseSource(arg)
+		if name := source.Name(); name != expected {
+			t.Errorf("Name() of %q = %q, expected %q", arg, name, expected)
+		}
+	}
+}
+
+func TestDefaultSpecSource(t *testing.T) {
+	for spec, expected := range map[PkgSpec]PkgSource{
+		"git+https://github.com/user/repo#main":        {Kind: SourceGit, Location: "https://github.com/user/repo", Ref: "main"},
+		"@ git+https://github.com/user/repo@main":      {Kind: SourceGit, Location: "https://github.com/user/repo", Ref: "main"},
+		"@ git+ssh://git@github.com/user/repo":         {Kind: SourceGit, Location: "ssh://git@github.com/user/repo"},
+		"@ https://example.com/pkg-1.0.tar.gz":         {Kind: SourceURL, Location: "https://example.com/pkg-1.0.tar.gz"},
+		"@ file:///home/user/lib":                      {Kind: SourcePath, Location: "file:///home/user/lib"},
+		"git+ssh://git@github.com/user/repo.git#v1.2.": {Kind: SourceGit, Location: "ssh://git@github.com/user/repo.git", Ref: "v1.2."},
+	} {
+		source, ok := DefaultSpecSource(spec)
+		if !ok || source != expected {
+			t.Errorf("DefaultSpecSource(%q) = %+v, %v, expected %+v", spec, source, ok, expected)
+		}
+	}
+
+	for _, spec := range []PkgSpec{"", "^1.2.3", ">= 3.0", "latest"} {
+		if source, ok := DefaultSpecSource(spec); ok {
+			t.Errorf("DefaultSpecSource(%q) = %+v, expected no source", spec, source)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/go-version"
+)
+
+// DefaultMatchesSpec is the MatchesSpec used for backends that do not
+// provide their own. It understands comma-separated comparisons such
+// as ">= 1.1, < 2.0" and treats an empty spec or "*" as matching any
+// version.
+func DefaultMatchesSpec(spec PkgSpec, ver PkgVersion) (bool, error) {
+	specStr := strings.TrimSpace(string(spec))
+	if specStr == "" || specStr == "*" {
+		return true, nil
+	}
+	constraints, err := version.NewConstraint(specStr)
+	if err != nil {
+		return false, err
+	}
+	v, err := version.NewVersion(string(ver))
+	if err != nil {
+		return false, err
+	}
+	return constraints.Check(v), nil
+}
+
+// specOperators are the characters that can start a spec written
+// directly after a package name, as in "flask==3.0" or "express^4".
+const specOperators = "=<>^~!"
+
+// ParsePackageArg splits a package argument to 'upm add' into a name
+// and a spec. It understands "name spec", "name@spec" (where the name
+// may be scoped, as in "@types/node@20") and a spec operator directly
+// after the name, as in "name==1.2.3" or "name^1.0". The spec is
+// empty if there is none.
+func ParsePackageArg(arg string) (PkgName, PkgSpec, error) {
+	arg = strings.TrimSpace(arg)
+	if arg == "" {
+		return "", "", errors.New("empty package name")
+	}
+
+	// The first @ is the start of a scope rather than a separator.
+	at := strings.Index(arg[1:], "@") + 1
+	space := strings.IndexAny(arg, " \t")
+	var name, spec string
+	if at > 0 && (space < 0 || at < space) {
+		name, spec = arg[:at], strings.TrimSpace(arg[at+1:])
+		if spec == "" {
+			return "", "", fmt.Errorf("%s: missing spec after \"@\"", arg)
+		}
+	} else if space >= 0 {
+		name, spec = arg[:space], strings.TrimSpace(arg[space:])
+	} else if i := strings.IndexAny(arg, specOperators); i >= 0 {
+		name, spec = arg[:i], arg[i:]
+	} else {
+		name = arg
+	}
+
+	if name == "" {
+		return "", "", fmt.Errorf("%s: missing package name before the spec", arg)
+	}
+	return PkgName(name), PkgSpec(spec), nil
+}
@@ -0,0 +1,36 @@
+package api
+
+import "testing"
+
+func TestParsePackageArg(t *testing.T) {
+	for arg, expected := range map[string][2]string{
+		"flask":             {"flask", ""},
+		"flask 3.0":         {"flask", "3.0"},
+		"flask  >=3.0, <4":  {"flask", ">=3.0, <4"},
+		"flask==1.2.3":      {"flask", "==1.2.3"},
+		"flask[async]>=2":   {"flask[async]", ">=2"},
+		"express@^4.18":     {"express", "^4.18"},
+		"express^1.0":       {"express", "^1.0"},
+		"express~1.0":       {"express", "~1.0"},
+		"react@latest":      {"react", "latest"},
+		"@types/node":       {"@types/node", ""},
+		"@types/node@20":    {"@types/node", "20"},
+		"@scope/pkg@>=1 <2": {"@scope/pkg", ">=1 <2"},
+		"flask @ file:///x": {"flask", "@ file:///x"},
+	} {
+		name, spec, err := ParsePackageArg(arg)
+		if err != nil {
+			t.Errorf("ParsePackageArg(%q) failed: %s", arg, err)
+			continue
+		}
+		if string(name) != expected[0] || string(spec) != expected[1] {
+			t.Errorf("ParsePackageArg(%q) = (%q, %q), expected (%q, %q)", arg, name, spec, expected[0], expected[1])
+		}
+	}
+
+	for _, arg := range []string{"", "  ", "flask@", "==1.0"} {
+		if name, spec, err := ParsePackageArg(arg); err == nil {
+			t.Errorf("ParsePackageArg(%q) = (%q, %q), expected an error", arg, name, spec)
+		}
+	}
+}
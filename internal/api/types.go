@@ -4,6 +4,7 @@ import (
 	"context"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/replit/upm/internal/util"
 )
@@ -32,6 +33,77 @@ type PkgSpec string
 // "1.0b2.post345.dev456" for Python.
 type PkgVersion string
 
+// SpecPolicy is how loosely a spec written for a version of a package
+// constrains its versions, as PinSpec writes it.
+type SpecPolicy string
+
+// Constants of type SpecPolicy, which are the values of config.SpecPolicies.
+const (
+	// Only that version, as in "1.2.3" for npm.
+	SpecExact SpecPolicy = "exact"
+
+	// The versions compatible with it, as in "^1.2.3" for npm.
+	SpecCaret SpecPolicy = "caret"
+
+	// The patch releases of it, as in "~1.2.3" for npm.
+	SpecTilde SpecPolicy = "tilde"
+
+	// Any version, as in "*" for npm.
+	SpecNone SpecPolicy = "none"
+)
+
+// PkgDep is a single entry of the specfile, as returned by
+// ListSpecfile.
+type PkgDep struct {
+	Spec PkgSpec
+
+	// Dev is true if the package is only needed during
+	// development, e.g. it is listed in devDependencies of
+	// package.json.
+	Dev bool
+
+	// Group is the named dependency group the package belongs to,
+	// e.g. "docs" for a Poetry group or "optional" and "peer" for
+	// npm. It is empty for the main dependencies.
+	Group string
+
+	// Reason is the comment recorded next to the package in the
+	// specfile by 'upm add --reason', if any.
+	Reason string
+}
+
+// ProjectMetadata describes the project that 'upm init' creates a
+// specfile for. Empty fields are left to the package manager's
+// defaults.
+type ProjectMetadata struct {
+	Name    string
+	Version string
+	License string
+}
+
+// PkgDeps maps package names to their specfile entries.
+type PkgDeps map[PkgName]PkgDep
+
+// Specs returns the specs of d, without distinguishing development
+// from runtime dependencies.
+func (d PkgDeps) Specs() map[PkgName]PkgSpec {
+	specs := map[PkgName]PkgSpec{}
+	for name, dep := range d {
+		specs[name] = dep.Spec
+	}
+	return specs
+}
+
+// RuntimeDeps converts specs read from a specfile with no notion of
+// development dependencies into PkgDeps.
+func RuntimeDeps(specs map[PkgName]PkgSpec) PkgDeps {
+	deps := PkgDeps{}
+	for name, spec := range specs {
+		deps[name] = PkgDep{Spec: spec}
+	}
+	return deps
+}
+
 // PkgInfo is a general-purpose struct for representing package
 // metadata. Any of the fields may be zeroed except for Name. Which
 // fields are nonzero depends on the context and language backend.
@@ -69,11 +141,19 @@ type PkgInfo struct {
 	// "https://github.com/pallets/flask/issues".
 	BugTrackerURL string `json:"bugTrackerURL,omitempty" pretty:"Bug tracker"`
 
+	// URL for the package's changelog or release notes, e.g.
+	// "https://flask.palletsprojects.com/changes/".
+	ChangelogURL string `json:"changelogURL,omitempty" pretty:"Changelog"`
+
 	// Author of the package. Only one author is supported; if
 	// there are multiple, we either pick one or simply
 	// concatenate them into a single Author.
 	Author string `json:"author,omitempty" pretty:"Author"`
 
+	// Names of the people who maintain the package in the index,
+	// as opposed to who wrote it. Empty if unknown.
+	Maintainers []string `json:"maintainers,omitempty" pretty:"Maintainers"`
+
 	// License of the package. No particular format is enforced.
 	// If the package has multiple licenses, we just concatenate
 	// them into one string.
@@ -84,14 +164,118 @@ type PkgInfo struct {
 	// no dependencies and a package whose language backend did
 	// not provide dependency information.
 	Dependencies []string `json:"dependencies,omitempty" pretty:"Dependencies"`
+
+	// Number of recent downloads of the package, over whatever
+	// period the index reports (usually the last month). Zero if
+	// unknown. Used to rank search results and guesses.
+	Downloads int64 `json:"downloads,omitempty" pretty:"Downloads"`
+
+	// Number of stars of the package's GitHub repository. Zero if
+	// unknown. Filled in by the command-line interface rather
+	// than by backends.
+	Stars int64 `json:"stars,omitempty" pretty:"GitHub stars"`
+
+	// Why Version is deprecated or yanked, as in "yanked: broken
+	// wheel", or empty if it is neither. Filled in by the
+	// command-line interface from ListDeprecated.
+	Deprecated string `json:"deprecated,omitempty" pretty:"Deprecated"`
+
+	// Date of the latest release, e.g. "2024-05-01", which for
+	// Info is the release of Version. Empty if unknown. Used to
+	// rank search results, and shown by 'upm info' with its age.
+	Updated string `json:"updated,omitempty" pretty:"Released"`
+}
+
+// Release is a version of a package in an online index, with when it
+// was published, as used to enforce min_release_age.
+type Release struct {
+	Version   PkgVersion
+	Published time.Time
+}
+
+// Deprecation is why a version of a package should no longer be used,
+// as ListDeprecated reports it.
+type Deprecation struct {
+	// Whether the version was yanked from the index, which only
+	// keeps it for the lockfiles that already have it, rather than
+	// deprecated by its maintainers.
+	Yanked bool
+
+	// The reason given for it, if any, such as "Use
+	// String.prototype.padStart()".
+	Reason string
 }
 
+// ReadmeFormat is the markup language of a Readme.
+type ReadmeFormat string
+
+const (
+	ReadmeMarkdown ReadmeFormat = "markdown"
+	ReadmeRST      ReadmeFormat = "rst"
+	ReadmeText     ReadmeFormat = "text"
+)
+
+// Readme is the long description of a package, as the index shows it
+// on the package's page.
+type Readme struct {
+	Text   string       `json:"text"`
+	Format ReadmeFormat `json:"format"`
+}
+
+// InstalledPackage is an installed package as 'upm patch' finds it.
+type InstalledPackage struct {
+	Version PkgVersion
+
+	// The directory that holds Files, such as
+	// node_modules/left-pad or a site-packages directory.
+	Dir string
+
+	// The slash-separated paths of the files of the package,
+	// relative to Dir.
+	Files []string
+}
+
+// Artifact is a file that a locked package is downloaded from, such as
+// an npm tarball or a Python wheel, as 'upm vendor' downloads it.
+type Artifact struct {
+	Name    PkgName
+	Version PkgVersion
+	URL     string
+
+	// The name to save the file as, unique among the artifacts of
+	// the lockfile.
+	Filename string
+
+	// The hashes that the lockfile records for the file, in the
+	// form of ListLockfileHashes. There may be none.
+	Hashes []string
+}
+
+// SearchSort is an order for search results, as given to 'upm search
+// --sort'.
+type SearchSort string
+
+// Constants of type SearchSort.
+const (
+	// The order of the index, refined by SortPackages.
+	SortRelevance SearchSort = "relevance"
+
+	// Most downloaded first.
+	SortDownloads SearchSort = "downloads"
+
+	// Most recently released first.
+	SortUpdated SearchSort = "updated"
+
+	// Most starred GitHub repository first.
+	SortStars SearchSort = "stars"
+)
+
 // Quirks is a bitmask enum used to indicate how specific language
 // backends behave differently from the core abstractions of UPM, and
 // therefore require some different treatment by the command-line
 // interface layer. See the constants of this type for more
 // information.
-type Quirks uint8
+type Quirks uint16
 
 // Constants of type Quirks, used to denote whether a language backend
 // follows the expected abstractions of UPM or if it needs special
@@ -130,6 +314,17 @@ const (
 	// This constant indicates that remove cannot be performed
 	// without a lockfile.
 	QuirkRemoveNeedsLockfile
+
+	// This constant indicates that add cannot create the
+	// specfile, so Init is run first when it does not exist. If
+	// specified, then Init must be implemented.
+	QuirksAddRequiresInit
+
+	// This constant indicates that add/remove edit the specfile
+	// themselves rather than through the package manager, so
+	// nothing checks the edit before it is locked; the packages
+	// are looked for in the specfile afterwards instead.
+	QuirksSpecfileEditedDirectly
 )
 
 // LanguageBackend is the core abstraction of UPM. It represents an
@@ -141,11 +336,18 @@ const (
 //
 // Most of the fields of this struct are mandatory, and the Check
 // method will panic at UPM startup if they are not provided. Not all
-// language backends necessarily need to implement all operations; in
-// this case, the relevant functions should call util.NotImplemented,
-// which will cause UPM to exit with an appropriate error message.
-// (The limitation should be noted in the backend feature matrix in
-// the README.)
+// language backends necessarily need to implement all operations; the
+// optional ones (Search, Info, Guess and so on) should then be left
+// nil. The command-line interface reports a nil operation as
+// unsupported, suggesting other backends for the same language, and
+// 'upm show-capabilities' lists them. (The limitation should also be
+// noted in the backend feature matrix in the README.)
+//
+// Hooks report failure by calling one of the util.Die functions with
+// the most specific class of error (network, protocol, missing tool,
+// and so on). These unwind with a *util.Error rather than exiting, so
+// that the command-line interface can map them to exit codes and
+// library callers can turn them into ordinary errors with util.Catch.
 //
 // Make sure to update the Check method when adding/removing fields
 // from this struct.
@@ -186,6 +388,12 @@ type LanguageBackend struct {
 	// can be used to query
 	IsActive func() bool
 
+	// The external programs the backend runs or needs, e.g.
+	// "poetry" and the "python3" it runs on. They are reported,
+	// along with their versions, by 'upm show-capabilities', and
+	// checked by 'upm doctor'.
+	Tools []string
+
 	// List of filename globs that match against files written in
 	// this programming language, e.g. "*.py" for Python. These
 	// should not include any slashes, because they may be matched
@@ -209,7 +417,7 @@ type LanguageBackend struct {
 
 	// Function that normalizes packages as they come in as CLI args
 	//
-	// This function is optional, defaulting to split(" ", 2)
+	// This function is optional, defaulting to ParsePackageArg
 	NormalizePackageArgs func(args []string) map[PkgName]PkgCoordinates
 
 	// Function that normalizes a package name. This is used to
@@ -225,6 +433,13 @@ type LanguageBackend struct {
 	// which packages are installed. The path need not exist.
 	GetPackageDir func() string
 
+	// Return the directories of the package manager's caches,
+	// outside the project, which 'upm clean --cache' removes. A
+	// cache that cannot be found is left out.
+	//
+	// This field is optional.
+	CacheDirs func() []string
+
 	// Apply a sensible heuristic for sorting search results
 	// if we know we want to surface some packages over others.
 	SortPackages func(query string, packages []PkgInfo) []PkgInfo
@@ -234,17 +449,76 @@ type LanguageBackend struct {
 	// of search results, which can be of any length. (It will be
 	// truncated by the command-line interface.) If the search
 	// fails, terminate the process. If it successfully returns no
-	// results, return an empty slice.
+	// results, return an empty slice. Read the response with
+	// ReadResponse and pass the results through CheckSearchResults.
 	//
-	// This field is mandatory.
+	// This field is optional; if it is omitted, the backend does
+	// not support searching.
 	Search func(query string) []PkgInfo
 
+	// Fill in the fields of search results that are needed to
+	// rank them by the given order (Downloads for SortDownloads,
+	// Updated for SortUpdated, and SourceCodeURL or HomepageURL,
+	// which name the GitHub repository, for SortStars), where
+	// Search left them empty, typically by querying the index once
+	// per result. Results that cannot be looked up are left alone.
+	//
+	// This field is optional; if it is omitted, results are
+	// ranked by whatever Search returned.
+	AnnotateSearch func(results []PkgInfo, by SearchSort)
+
 	// Retrieve information about a package from an online index.
-	// If the package doesn't exist, return a zero struct.
+	// If the package doesn't exist, return a zero struct. Read the
+	// response with ReadResponse and pass the result through
+	// CheckInfo.
 	//
-	// This field is mandatory.
+	// This field is optional; if it is omitted, the backend does
+	// not support looking up packages.
 	Info func(PkgName) PkgInfo
 
+	// Return the versions of a package in an online index, with
+	// when they were published, in any order. Withdrawn versions,
+	// such as yanked ones, are left out. If the package doesn't
+	// exist, return nil. If the lookup fails, terminate the
+	// process.
+	//
+	// 'upm add' uses it to keep to min_release_age, pinning a
+	// package to a release by passing "NAME VERSION" to
+	// NormalizePackageArgs, which must then make a spec for
+	// exactly that version.
+	//
+	// This field is optional; without it, min_release_age is not
+	// enforced.
+	ListReleases func(PkgName) []Release
+
+	// Return the versions of a package in an online index that are
+	// deprecated or yanked, with why. Other versions are left out.
+	// If the package doesn't exist, return nil. If the lookup
+	// fails, terminate the process.
+	//
+	// This field is optional; if it is omitted, 'upm info', 'upm
+	// add' and 'upm check --deprecations' cannot warn about such
+	// versions.
+	ListDeprecated func(PkgName) map[PkgVersion]Deprecation
+
+	// Return the readme of a package in an online index, for 'upm
+	// info --readme'. If the package doesn't exist or has no
+	// readme, return a Readme with empty Text. If the lookup
+	// fails, terminate the process.
+	//
+	// This field is optional.
+	FetchReadme func(PkgName) Readme
+
+	// Return the packages that declare the types of pkgs, for the
+	// project to add as dev dependencies alongside them, keyed by
+	// the package they are for, as in @types/lodash for lodash in
+	// a TypeScript project. Packages that need none are left out.
+	// If a lookup fails, terminate the process.
+	//
+	// This field is optional; if it is omitted, 'upm add' does not
+	// suggest such packages.
+	TypeCompanions func(pkgs []PkgName) map[PkgName]PkgName
+
 	// Add packages to the specfile. The map is guaranteed to have
 	// at least one package, and all of the packages are
 	// guaranteed to not already be in the specfile (according to
@@ -252,11 +526,18 @@ type LanguageBackend struct {
 	// already. The specs may be empty, in which case default
 	// specs should be generated (for example, specifying the
 	// latest version or newer). This method must create the
-	// specfile if it does not exist already. Additional
-	// information needed to create the specfile can be passed
-	// as well. If a significant amount of additional info is
-	// required for initalizing specfiles, we can break that out
-	// to a seperate step.
+	// specfile if it does not exist already, unless
+	// QuirksAddRequiresInit in which case Init has created it.
+	// Additional information needed to create the specfile can
+	// be passed as well.
+	//
+	// If config.Dev is set, the packages should be added as
+	// development dependencies, and if config.Group is set, to
+	// that dependency group. This is only done by backends that
+	// set SupportsDev and SupportsGroups respectively. If
+	// config.Reason is set, it should be recorded as a comment
+	// next to each package, by backends that set
+	// SupportsReasons.
 	//
 	// If QuirksAddRemoveAlsoInstalls, then also lock and install.
 	// In this case this method must also create the lockfile if
@@ -265,6 +546,16 @@ type LanguageBackend struct {
 	// This field is mandatory.
 	Add func(context.Context, map[PkgName]PkgSpec, string)
 
+	// Create a minimal specfile for the project described by the
+	// metadata, without asking anything. The specfile is
+	// guaranteed not to exist already. Metadata that the specfile
+	// has no place for, such as the license in a Gemfile, is
+	// ignored. If QuirksAddRequiresInit, this is also run before
+	// Add when the specfile does not exist.
+	//
+	// This field is optional, unless QuirksAddRequiresInit.
+	Init func(context.Context, ProjectMetadata)
+
 	// Remove packages from the specfile. The map is guaranteed to
 	// have at least one package, and all of the packages are
 	// guaranteed to already be in the specfile (according to
@@ -288,26 +579,251 @@ type LanguageBackend struct {
 	// which case this field *may* not be specified.
 	Lock func(context.Context)
 
+	// Lock again, like Lock but without installing anything, for
+	// 'upm verify --reproducible'. It runs in a temporary
+	// directory that holds copies of the specfile, the lockfile
+	// and those of LockInputs that exist, and the lockfile it
+	// leaves there is compared with the project's.
+	//
+	// This field is optional.
+	Relock func(context.Context)
+
+	// The files and directories besides the specfile and lockfile
+	// that the package manager reads when locking, such as its
+	// configuration, relative to the project directory.
+	LockInputs []string
+
 	// Install packages from the lockfile. The specfile and
 	// lockfile are guaranteed to already exist, unless
 	// QuirksNotReproducible in which case only the specfile is
 	// guaranteed to exist.
 	//
+	// If config.Prod is set and the backend SupportsDev, then
+	// development dependencies should be skipped.
+	// If config.Frozen is set, the lockfile must not be modified,
+	// and the install should fail if it is out of date.
+	//
 	// This field is mandatory.
 	Install func(context.Context)
 
+	// Download the packages in the lockfile to the package
+	// manager's cache, for 'upm fetch', without installing them in
+	// the project, so that a later Install needs no network. The
+	// specfile and lockfile are guaranteed to already exist.
+	//
+	// If config.Prod is set and the backend SupportsDev, then
+	// development dependencies may be skipped.
+	//
+	// This field is optional.
+	Fetch func(context.Context)
+
+	// True if the Add method honors config.Dev, i.e. the package
+	// manager distinguishes development dependencies.
+	SupportsDev bool
+
+	// True if the Add method honors config.Group.
+	SupportsGroups bool
+
+	// True if the Add method honors config.Reason and
+	// ListSpecfile returns the reasons it recorded, which
+	// requires a specfile format with comments.
+	SupportsReasons bool
+
 	// List the packages in the specfile. Names and specs should
-	// be returned in a format suitable for the Add method. The
-	// specfile is guaranteed to exist already.
+	// be returned in a format suitable for the Add method, and
+	// development dependencies should be marked as such. Backends
+	// whose specfile has no such distinction can use
+	// RuntimeDeps. The specfile is guaranteed to exist already.
 	//
 	// This field is mandatory.
-	ListSpecfile func(mergeAllGroups bool) map[PkgName]PkgSpec
+	ListSpecfile func(mergeAllGroups bool) PkgDeps
 
 	// List the packages in the lockfile. Names should be returned
 	// in a format suitable for the Add method. The lockfile is
 	// guaranteed to exist already.
 	ListLockfile func() map[PkgName]PkgVersion
 
+	// Return the dependency graph of the lockfile, mapping each
+	// locked package to the packages it depends on. This is used
+	// by 'upm check' to find packages that nothing depends on.
+	// The lockfile is guaranteed to exist already.
+	//
+	// This field is optional.
+	ListLockfileGraph func() map[PkgName][]PkgName
+
+	// Return every version of each package in the lockfile, once
+	// for each copy of it that the lockfile records, so that 'upm
+	// dedupe' can report packages that are installed several
+	// times. The lockfile is guaranteed to exist already.
+	//
+	// This field is optional.
+	ListLockfileCopies func() map[PkgName][]PkgVersion
+
+	// Rewrite the lockfile so that packages are locked at as few
+	// versions as their dependents allow, and install the result.
+	// The lockfile is guaranteed to exist already.
+	//
+	// This field is optional.
+	Dedupe func(context.Context)
+
+	// Return the integrity hashes that the lockfile records for
+	// each locked package, keyed like ListLockfile, in the form
+	// the lockfile writes them: "sha512-..." for npm and Yarn,
+	// "sha256:..." for Poetry and uv. A package may have several,
+	// e.g. one per wheel. Packages without hashes are left out.
+	// The lockfile is guaranteed to exist already.
+	//
+	// This field is optional.
+	ListLockfileHashes func() map[PkgName][]string
+
+	// Return the files that the locked packages are downloaded
+	// from, for 'upm vendor': the tarball of each package for
+	// Node.js, or every sdist and wheel for Python. Packages that
+	// do not come from a registry, such as git dependencies, are
+	// left out. The lockfile is guaranteed to exist already.
+	//
+	// This field is optional.
+	ListLockfileArtifacts func() []Artifact
+
+	// Check the packages installed in pkgdir, as returned by
+	// GetPackageDir, against the lockfile, and return the
+	// discrepancies. What can be checked depends on what the
+	// package manager records at install time. The lockfile is
+	// guaranteed to exist already.
+	//
+	// This field is optional.
+	VerifyInstalled func(pkgdir string) []IntegrityIssue
+
+	// Return the packages that are actually installed in pkgdir,
+	// as returned by GetPackageDir, with their versions. This is
+	// used by 'upm list --installed' to find drift between the
+	// environment and the lockfile. pkgdir need not exist.
+	//
+	// This field is optional.
+	ListInstalled func(pkgdir string) map[PkgName]PkgVersion
+
+	// Return the disk space in bytes taken by each package
+	// installed in pkgdir, as returned by GetPackageDir, by the
+	// names ListInstalled returns. This is used by 'upm size'.
+	// pkgdir need not exist.
+	//
+	// This field is optional.
+	InstalledSizes func(pkgdir string) map[PkgName]int64
+
+	// Return the scripts defined in the specfile, such as the
+	// scripts of package.json, mapped to what each one runs. The
+	// specfile is guaranteed to exist already.
+	//
+	// This field is optional.
+	ListScripts func() map[string]string
+
+	// Return the command that runs script with args through the
+	// package manager, e.g. "yarn run build --watch" or "bundle
+	// exec rake test". script may be one returned by ListScripts
+	// or, for package managers that allow it, an executable
+	// installed by a package.
+	//
+	// This field is optional.
+	RunScript func(script string, args []string) []string
+
+	// Return true if the exact version satisfies the spec, as
+	// written in the specfile. An error means that the spec or
+	// version could not be understood.
+	//
+	// This field is optional, and defaults to DefaultMatchesSpec.
+	MatchesSpec func(spec PkgSpec, version PkgVersion) (bool, error)
+
+	// Return an error if the spec, as passed to 'upm add', is not
+	// valid for this package manager. This lets UPM reject a bad
+	// spec before running anything.
+	//
+	// This field is optional.
+	ValidateSpec func(spec PkgSpec) error
+
+	// A short description of the syntax of specs, with examples,
+	// that completes the sentence "expected ...". It is shown when
+	// ValidateSpec rejects a spec.
+	//
+	// This field is optional.
+	SpecSyntax string
+
+	// Return the spec that makes 'upm add' install the named
+	// package from a git repository, URL or local path, as the
+	// Add function expects it. An error means that this package
+	// manager cannot install from such a source.
+	//
+	// This field is optional; without it, 'upm add' only installs
+	// packages from the registry.
+	SpecForSource func(name PkgName, source PkgSource) (PkgSpec, error)
+
+	// Return where a package comes from, if its spec, as written
+	// in the specfile, names a git repository, URL or local path
+	// rather than versions from the registry.
+	//
+	// This field is optional, and defaults to DefaultSpecSource.
+	SourceOfSpec func(spec PkgSpec) (PkgSource, bool)
+
+	// Return the spec that allows the versions that policy allows
+	// given version: only that version for 'upm pin', the versions
+	// compatible with it for 'upm unpin', and for 'upm add
+	// --guess-spec', any of the policies. An error means that the
+	// version could not be understood.
+	//
+	// This field is optional; 'upm pin' and 'upm unpin' are only
+	// supported by backends that have it and SetSpecs.
+	PinSpec func(version PkgVersion, policy SpecPolicy) (PkgSpec, error)
+
+	// Change the specs of packages that the specfile lists, named
+	// as they are spelled there, by editing the specfile in place,
+	// so that the rest of its contents and formatting are kept. The
+	// lockfile is left for Lock to update.
+	//
+	// This field is optional.
+	SetSpecs func(specs map[PkgName]PkgSpec)
+
+	// Force every package named name in the dependency graph,
+	// however deep, to a version that satisfies spec, for 'upm
+	// override add', by recording an override in the package
+	// manager's own syntax, such as "overrides" in npm's
+	// package.json. The lockfile is left for Lock to update.
+	//
+	// This field is optional.
+	SetOverride func(name PkgName, spec PkgSpec)
+
+	// Return the files of the installed package name, in pkgdir as
+	// returned by GetPackageDir, for 'upm patch' to copy them to be
+	// edited, or false if the package is not installed.
+	//
+	// This field is optional; 'upm patch' is only supported by
+	// backends that have it.
+	InstalledFiles func(pkgdir string, name PkgName) (InstalledPackage, bool)
+
+	// Arrange for the package manager to apply the patches in dir,
+	// written by 'upm patch', whenever it installs packages, such
+	// as with patch-package run from npm's postinstall script, by
+	// editing the specfile. It is called whenever a patch is
+	// written.
+	//
+	// This field is optional. Without it, upm applies the patches
+	// itself after installing packages.
+	SetupPatches func(dir string)
+
+	// Return an error if the name, as passed to 'upm add', cannot
+	// be the name of a package in this package manager's index,
+	// e.g. because it contains characters that the index does not
+	// allow.
+	//
+	// This field is optional.
+	ValidatePackageName func(name PkgName) error
+
+	// Return the recent download counts of the most popular
+	// packages in the index, by normalized name, so that 'upm add'
+	// can warn about names that are near misses of them, as in
+	// "reqeusts" for "requests".
+	//
+	// This field is optional.
+	PopularPackages func() map[PkgName]int64
+
 	// Regexps used to determine if the Guess method really needs
 	// to be invoked, or if its previous return value can be
 	// re-used.
@@ -344,9 +860,18 @@ type LanguageBackend struct {
 	// causing UPM to re-use the existing Guess return value
 	// (which is now wrong).
 	//
-	// This field is mandatory.
+	// This field is optional; if it is omitted, the backend does
+	// not support guessing.
 	Guess func(ctx context.Context) (map[string][]PkgName, bool)
 
+	// Map from the commands that projects run in shell scripts and
+	// Procfiles, such as "gunicorn", to the packages that provide
+	// them, for 'upm guess --include-commands'.
+	//
+	// This field is optional; if it is omitted, the backend does
+	// not guess from commands.
+	CommandPackages map[string]PkgName
+
 	// Installs system dependencies into replit.nix for supported
 	// languages.
 	InstallReplitNixSystemDependencies func(context.Context, []PkgName)
@@ -366,8 +891,6 @@ func (b *LanguageBackend) Setup() {
 		"missing lockfile":                 b.QuirksIsReproducible() && b.Lockfile == "",
 		"need at least 1 filename pattern": len(b.FilenamePatterns) == 0,
 		"missing package dir":              b.GetPackageDir == nil,
-		"missing Search":                   b.Search == nil,
-		"missing Info":                     b.Info == nil,
 		"missing Add":                      b.Add == nil,
 		"missing Remove":                   b.Remove == nil,
 		"missing IsAvailable":              b.IsAvailable == nil,
@@ -383,6 +906,8 @@ func (b *LanguageBackend) Setup() {
 		"Lock installs, but is not implemented": b.QuirksDoesLockAlsoInstall() && b.QuirksIsNotReproducible(),
 		// If you install, then you have to lock.
 		"Add and Remove install, so they must also Lock": b.QuirksIsReproducible() && b.QuirksDoesAddRemoveAlsoInstall() && b.QuirksDoesAddRemoveNotAlsoLock(),
+		// Add relies on Init to create the specfile.
+		"Add requires Init, but it is not implemented": b.QuirksDoesAddRequireInit() && b.Init == nil,
 	}
 
 	reasons := []string{}
@@ -400,15 +925,13 @@ func (b *LanguageBackend) Setup() {
 		b.NormalizePackageArgs = func(args []string) map[PkgName]PkgCoordinates {
 			normPkgs := map[PkgName]PkgCoordinates{}
 			for _, arg := range args {
-				fields := strings.SplitN(arg, " ", 2)
-				name := fields[0]
-				var spec PkgSpec
-				if len(fields) >= 2 {
-					spec = PkgSpec(fields[1])
+				name, spec, err := ParsePackageArg(arg)
+				if err != nil {
+					util.DieConsistency("%s", err)
 				}
 
-				normPkgs[b.NormalizePackageName(PkgName(name))] = PkgCoordinates{
-					Name: name,
+				normPkgs[b.NormalizePackageName(name)] = PkgCoordinates{
+					Name: string(name),
 					Spec: spec,
 				}
 			}
@@ -416,6 +939,14 @@ func (b *LanguageBackend) Setup() {
 		}
 	}
 
+	if b.MatchesSpec == nil {
+		b.MatchesSpec = DefaultMatchesSpec
+	}
+
+	if b.SourceOfSpec == nil {
+		b.SourceOfSpec = DefaultSpecSource
+	}
+
 	if b.NormalizePackageName == nil {
 		b.NormalizePackageName = func(name PkgName) PkgName {
 			return name
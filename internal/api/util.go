@@ -62,3 +62,17 @@ func (b *LanguageBackend) QuirksDoesLockNotAlsoInstall() bool {
 func (b *LanguageBackend) QuirkRemoveNeedsLockfile() bool {
 	return (b.Quirks & QuirkRemoveNeedsLockfile) != 0
 }
+
+// QuirksDoesAddRequireInit returns true if the language backend
+// specifies QuirksAddRequiresInit, i.e. Init must create the specfile
+// before add is run.
+func (b *LanguageBackend) QuirksDoesAddRequireInit() bool {
+	return (b.Quirks & QuirksAddRequiresInit) != 0
+}
+
+// QuirksIsSpecfileEditedDirectly returns true if the language backend
+// specifies QuirksSpecfileEditedDirectly, i.e. add and remove write
+// the specfile themselves rather than through the package manager.
+func (b *LanguageBackend) QuirksIsSpecfileEditedDirectly() bool {
+	return (b.Quirks & QuirksSpecfileEditedDirectly) != 0
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"github.com/replit/upm/internal/util"
+)
+
+// Limits on the fields of a PkgInfo from a registry. They are far
+// beyond what any registry allows, and only exist to reject garbage.
+const (
+	maxNameLength    = 256
+	maxVersionLength = 128
+	maxTextLength    = 64 << 10
+)
+
+// checkName checks a package name, or the version of a package: it
+// must not be too long, and must not contain whitespace or control
+// characters.
+func checkName(field, value string, max int) error {
+	if len(value) > max {
+		return fmt.Errorf("%s is longer than %d bytes", field, max)
+	}
+	for _, r := range value {
+		if unicode.IsSpace(r) || unicode.IsControl(r) || r == unicode.ReplacementChar {
+			return fmt.Errorf("%s %q contains whitespace or control characters", field, value)
+		}
+	}
+	return nil
+}
+
+// checkText checks a free-form field, such as a description. Line
+// breaks and tabs are fine, but other control characters, such as the
+// escape sequences that would take over the terminal, are not.
+func checkText(field, value string) error {
+	if len(value) > maxTextLength {
+		return fmt.Errorf("%s is longer than %d bytes", field, maxTextLength)
+	}
+	for _, r := range value {
+		if unicode.IsControl(r) && !strings.ContainsRune("\t\n\r", r) {
+			return fmt.Errorf("%s contains control characters", field)
+		}
+	}
+	return nil
+}
+
+// urlSchemes are the schemes that links in a PkgInfo may have: web
+// pages, and the git repositories that npm and others point to, as in
+// git+https://github.com/expressjs/express.git.
+var urlSchemes = map[string]bool{
+	"http": true, "https": true, "git": true, "ssh": true,
+	"git+http": true, "git+https": true, "git+ssh": true,
+}
+
+// checkURL checks that a link is a web or git URL, so that it is safe
+// to show and open, unlike, say, a javascript: or file: URL.
+func checkURL(field, value string) error {
+	if value == "" {
+		return nil
+	}
+	u, err := url.Parse(value)
+	if err != nil || !urlSchemes[strings.ToLower(u.Scheme)] || u.Host == "" {
+		return fmt.Errorf("%s %q is not a web or git URL", field, value)
+	}
+	return checkText(field, value)
+}
+
+// Validate checks that info, as returned by a registry, is sane enough
+// to be shown and acted on: it has a name, its name, version and
+// dependencies are plausible, and its text has no control characters.
+// The zero PkgInfo, which means that there is no such package, is
+// valid. Links are not checked, since registries are full of
+// placeholders such as "UNKNOWN"; see withValidLinks.
+func (info PkgInfo) Validate() error {
+	if info.Name == "" {
+		deps := info.Dependencies
+		info.Dependencies = nil
+		if len(deps) > 0 || !reflect.DeepEqual(info, PkgInfo{}) {
+			return fmt.Errorf("package has no name")
+		}
+		return nil
+	}
+	checks := []error{
+		checkName("name", info.Name, maxNameLength),
+		checkName("version", info.Version, maxVersionLength),
+		checkText("description", info.Description),
+		checkText("author", info.Author),
+		checkText("license", info.License),
+		checkText("updated", info.Updated),
+	}
+	if info.Downloads < 0 {
+		checks = append(checks, fmt.Errorf("negative downloads %d", info.Downloads))
+	}
+	for _, maintainer := range info.Maintainers {
+		checks = append(checks, checkText("maintainer", maintainer))
+	}
+	for _, dep := range info.Dependencies {
+		checks = append(checks, checkName("dependency", dep, maxNameLength))
+	}
+	for _, err := range checks {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// withValidLinks returns info without the links that are not web or
+// git URLs.
+func (info PkgInfo) withValidLinks(endpoint string) PkgInfo {
+	for _, link := range []struct {
+		field string
+		url   *string
+	}{
+		{"homepage", &info.HomepageURL},
+		{"documentation", &info.DocumentationURL},
+		{"source code", &info.SourceCodeURL},
+		{"bug tracker", &info.BugTrackerURL},
+	} {
+		if err := checkURL(link.field, *link.url); err != nil {
+			util.Debugf("%s: dropping the %s of %s: %s", endpoint, link.field, info.Name, err)
+			*link.url = ""
+		}
+	}
+	return info
+}
+
+// CheckInfo returns info, the answer of endpoint to an info request,
+// after dying with an error naming endpoint if it is not valid. Links
+// that are not web or git URLs are left out.
+func CheckInfo(endpoint string, info PkgInfo) PkgInfo {
+	if err := info.Validate(); err != nil {
+		util.DieProtocol("%s: invalid package info: %s", endpoint, err)
+	}
+	return info.withValidLinks(endpoint)
+}
+
+// CheckSearchResults returns the valid results of a search, as
+// answered by endpoint. The invalid ones are left out with a warning,
+// rather than failing the whole search because of one bad package.
+func CheckSearchResults(endpoint string, results []PkgInfo) []PkgInfo {
+	valid := []PkgInfo{}
+	for _, result := range results {
+		if result.Name == "" {
+			util.LogError(fmt.Sprintf("%s: skipping a search result without a name", endpoint))
+		} else if err := result.Validate(); err != nil {
+			util.LogError(fmt.Sprintf("%s: skipping invalid search result: %s", endpoint, err))
+		} else {
+			valid = append(valid, result.withValidLinks(endpoint))
+		}
+	}
+	return valid
+}
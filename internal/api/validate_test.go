@@ -0,0 +1,52 @@
+package api
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	valid := PkgInfo{
+		Name:         "express",
+		Version:      "4.19.2",
+		Description:  "Fast, unopinionated,\nminimalist web framework",
+		HomepageURL:  "UNKNOWN",
+		Dependencies: []string{"accepts", "body-parser"},
+	}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("expected %+v to be valid, got %s", valid, err)
+	}
+	if err := (PkgInfo{}).Validate(); err != nil {
+		t.Errorf("expected no package to be valid, got %s", err)
+	}
+
+	for expected, info := range map[string]PkgInfo{
+		"no name":            {Version: "1.0.0"},
+		"whitespace":         {Name: "express", Version: "1.0 rc"},
+		"longer than":        {Name: strings.Repeat("a", 300)},
+		"control characters": {Name: "express", Description: "\x1b]8;;https://evil.example\x07click\x1b]8;;\x07"},
+		`dependency "a\nb"`:  {Name: "express", Dependencies: []string{"a\nb"}},
+		"negative downloads": {Name: "express", Downloads: -1},
+	} {
+		if err := info.Validate(); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected an error about %s for %+v, got %v", expected, info, err)
+		}
+	}
+}
+
+func TestCheckSearchResults(t *testing.T) {
+	results := CheckSearchResults("https://registry.example.com/search", []PkgInfo{
+		{Name: "left-pad", HomepageURL: "https://github.com/left-pad/left-pad", SourceCodeURL: "git+https://github.com/left-pad/left-pad.git"},
+		{Name: "bad name"},
+		{Name: "evil", HomepageURL: "javascript:alert(1)", BugTrackerURL: "file:///etc/passwd"},
+	})
+	if len(results) != 2 {
+		t.Fatalf("expected the invalid result to be left out, got %+v", results)
+	}
+	if results[0].HomepageURL == "" || results[0].SourceCodeURL == "" {
+		t.Errorf("expected web and git links to be kept, got %+v", results[0])
+	}
+	if results[1].HomepageURL != "" || results[1].BugTrackerURL != "" {
+		t.Errorf("expected other links to be dropped, got %+v", results[1])
+	}
+}
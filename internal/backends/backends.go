@@ -4,12 +4,14 @@ package backends
 
 import (
 	"context"
+	"sort"
 	"strings"
 
 	"github.com/replit/upm/internal/api"
 	"github.com/replit/upm/internal/backends/dart"
 	"github.com/replit/upm/internal/backends/dotnet"
 	"github.com/replit/upm/internal/backends/elisp"
+	"github.com/replit/upm/internal/backends/external"
 	"github.com/replit/upm/internal/backends/java"
 	"github.com/replit/upm/internal/backends/nodejs"
 	"github.com/replit/upm/internal/backends/php"
@@ -91,6 +93,9 @@ func GetBackend(ctx context.Context, language string) api.LanguageBackend {
 		}
 		switch len(filteredBackends) {
 		case 0:
+			if language == AllLanguages {
+				util.DieUsage("--lang %s is only supported by upm list, upm lock and upm install", AllLanguages)
+			}
 			util.DieConsistency("no such language: %s", language)
 		case 1:
 			return filteredBackends[0]
@@ -145,6 +150,171 @@ func GetBackend(ctx context.Context, language string) api.LanguageBackend {
 	return backends[0]
 }
 
+// Detection is a backend that matches the project in the current
+// directory, together with the reasons it matches.
+type Detection struct {
+	Backend  string   `json:"backend"`
+	Evidence []string `json:"evidence"`
+}
+
+// evidenceFor returns the reasons for which GetBackend could pick b
+// for the project in the current directory, or nil if there are none.
+func evidenceFor(b api.LanguageBackend) []string {
+	evidence := []string{}
+	if util.Exists(b.Specfile) {
+		compatible := true
+		if b.IsSpecfileCompatible != nil {
+			var err error
+			compatible, err = b.IsSpecfileCompatible(b.Specfile)
+			if err != nil {
+				panic(err)
+			}
+		}
+		if compatible {
+			evidence = append(evidence, "specfile "+b.Specfile)
+		} else {
+			util.Debugf("%s: %s is not compatible", b.Name, b.Specfile)
+		}
+	}
+	if util.Exists(b.Lockfile) {
+		evidence = append(evidence, "lockfile "+b.Lockfile)
+	}
+	for _, p := range b.FilenamePatterns {
+		if util.PatternExists(p) {
+			evidence = append(evidence, "files matching "+p)
+		}
+	}
+	if len(evidence) == 0 {
+		return nil
+	}
+	return evidence
+}
+
+// DetectAll returns every backend that matches the given --lang
+// argument value (every backend if it is empty) and for which the
+// project in the current directory provides some evidence, in the
+// order of languageBackends. Backends whose tools are not installed
+// are included, since GetBackend may still pick them.
+func DetectAll(language string) []Detection {
+	detections := []Detection{}
+	for _, b := range GetBackends(language) {
+		if evidence := evidenceFor(b); evidence != nil {
+			detections = append(detections, Detection{
+				Backend:  b.Name,
+				Evidence: evidence,
+			})
+		}
+	}
+	return detections
+}
+
+// AllLanguages is the --lang argument value that selects every
+// language that the project uses, for the commands that support it.
+const AllLanguages = "all"
+
+// DetectLanguages returns one backend for each language whose
+// specfile or lockfile is in the current directory, for projects that
+// use several languages at once. Within a language, the backend is
+// chosen the way GetBackend chooses it, and backends that share a
+// specfile with a chosen one, such as bun and nodejs-npm, are left
+// out. The result is in the order of languageBackends.
+func DetectLanguages() []api.LanguageBackend {
+	compatible := func(b api.LanguageBackend) bool {
+		if !util.Exists(b.Specfile) {
+			return false
+		}
+		if b.IsSpecfileCompatible == nil {
+			return true
+		}
+		isValid, err := b.IsSpecfileCompatible(b.Specfile)
+		if err != nil {
+			panic(err)
+		}
+		return isValid
+	}
+	tiers := []func(api.LanguageBackend) bool{
+		func(b api.LanguageBackend) bool { return compatible(b) && util.Exists(b.Lockfile) },
+		compatible,
+		func(b api.LanguageBackend) bool { return util.Exists(b.Lockfile) },
+	}
+
+	family := func(b api.LanguageBackend) string {
+		language, _, _ := strings.Cut(b.Name, "-")
+		return language
+	}
+	chosen := map[string]bool{}
+	taken := func(b api.LanguageBackend) bool {
+		for _, other := range languageBackends {
+			if chosen[other.Name] && (family(other) == family(b) || other.Specfile == b.Specfile) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, tier := range tiers {
+		for _, b := range languageBackends {
+			if !taken(b) && tier(b) {
+				chosen[b.Name] = true
+			}
+		}
+	}
+
+	detected := []api.LanguageBackend{}
+	for _, b := range languageBackends {
+		if chosen[b.Name] {
+			detected = append(detected, b)
+		}
+	}
+	return detected
+}
+
+// RegisterExternal adds the external backends found by
+// external.Discover, after the built-in ones. It must be called after
+// config.Load. A backend that fails to describe itself, or that has
+// the same name as an existing backend, is skipped with a warning.
+func RegisterExternal() {
+	found := external.Discover()
+	names := make([]string, 0, len(found))
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		b, err := external.New(name, found[name])
+		if err != nil {
+			util.Log("skipping external backend:", err)
+			continue
+		}
+		duplicate := false
+		for _, existing := range languageBackends {
+			if existing.Name == b.Name {
+				duplicate = true
+				break
+			}
+		}
+		if duplicate {
+			util.Log("skipping external backend", found[name]+": name", b.Name, "is already taken")
+			continue
+		}
+		b.Setup()
+		languageBackends = append(languageBackends, b)
+	}
+}
+
+// GetBackends returns every backend that matches the given --lang
+// argument value, or every backend if it is empty. Unlike GetBackend,
+// it does not look at the project.
+func GetBackends(language string) []api.LanguageBackend {
+	matching := []api.LanguageBackend{}
+	for _, b := range languageBackends {
+		if language == "" || matchesLanguage(b, language) {
+			matching = append(matching, b)
+		}
+	}
+	return matching
+}
+
 type BackendInfo struct {
 	Name      string
 	Available bool
@@ -4,6 +4,7 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
 )
 
@@ -42,3 +43,54 @@ func TestGetBackends(t *testing.T) {
 		os.Remove(tmpfile)
 	}
 }
+
+func TestDetectAll(t *testing.T) {
+	dir := t.TempDir()
+	for _, file := range []string{"package.json", "package-lock.json", "main.py"} {
+		if err := os.WriteFile(filepath.Join(dir, file), []byte("{}"), 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	evidence := map[string][]string{}
+	for _, d := range DetectAll("") {
+		evidence[d.Backend] = d.Evidence
+	}
+	expected := []string{"specfile package.json", "lockfile package-lock.json"}
+	if !reflect.DeepEqual(evidence["nodejs-npm"], expected) {
+		t.Errorf("expected nodejs-npm evidence %v, got %v", expected, evidence["nodejs-npm"])
+	}
+	expected = []string{"files matching *.py"}
+	if !reflect.DeepEqual(evidence["python3-pip"], expected) {
+		t.Errorf("expected python3-pip evidence %v, got %v", expected, evidence["python3-pip"])
+	}
+	if _, ok := evidence["rust"]; ok {
+		t.Errorf("unexpected rust detection: %v", evidence["rust"])
+	}
+}
+
+func TestDetectLanguages(t *testing.T) {
+	dir := t.TempDir()
+	for _, file := range []string{"package.json", "package-lock.json", "requirements.txt", "main.rb"} {
+		if err := os.WriteFile(filepath.Join(dir, file), []byte("{}"), 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	// bun also reads package.json, but the lockfile is npm's, and
+	// Ruby is only detected by its source files.
+	names := []string{}
+	for _, b := range DetectLanguages() {
+		names = append(names, b.Name)
+	}
+	expected := []string{"python3-pip", "nodejs-npm"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %v, got %v", expected, names)
+	}
+}
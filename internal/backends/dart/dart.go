@@ -6,7 +6,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
 	"os"
@@ -140,14 +139,11 @@ func dartSearch(query string) []api.PkgInfo {
 	}
 	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		util.DieProtocol("Pub.dev: %s", err)
-	}
+	body := api.ReadResponse(resp)
 
 	var pubDevResults pubDevSearchResults
 	if err := json.Unmarshal(body, &pubDevResults); err != nil {
-		util.DieProtocol("Pub.dev: %s", err)
+		util.DieProtocol("%s: %s", endpoint, err)
 	}
 
 	results := make([]api.PkgInfo, len(pubDevResults.Packages))
@@ -157,7 +153,7 @@ func dartSearch(query string) []api.PkgInfo {
 			Name: p.Name,
 		}
 	}
-	return results
+	return api.CheckSearchResults(endpoint, results)
 }
 
 // pubDevInfoResults represents the data we get from Pub.dev when
@@ -193,17 +189,14 @@ func dartInfo(name api.PkgName) api.PkgInfo {
 	}
 	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		util.DieProtocol("Pub.dev: %s", err)
-	}
+	body := api.ReadResponse(resp)
 
 	var pubDevResults pubDevInfoResults
 	if err := json.Unmarshal(body, &pubDevResults); err != nil {
-		util.DieProtocol("Pub.dev: %s", err)
+		util.DieProtocol("%s: %s", endpoint, err)
 	}
 
-	return api.PkgInfo{
+	return api.CheckInfo(endpoint, api.PkgInfo{
 		Name:          pubDevResults.Name,
 		Description:   pubDevResults.Latest.Pubspec.Description,
 		Version:       pubDevResults.Version,
@@ -215,7 +208,7 @@ func dartInfo(name api.PkgName) api.PkgInfo {
 			Email: "",
 			URL:   "",
 		}.String(),
-		License: ""}
+		License: ""})
 }
 
 func createSpecFile() {
@@ -237,10 +230,7 @@ func writeSpecFile(specs dartPubspecYaml) {
 		fmt.Println("Marshal Error")
 	}
 
-	err = os.WriteFile("pubspec.yaml", data, 0o666)
-	if err != nil {
-		panic(err)
-	}
+	util.TryWriteAtomic("pubspec.yaml", data)
 }
 
 func readSpecFile() dartPubspecYaml {
@@ -292,21 +282,15 @@ func dartRemove(ctx context.Context, pkgs map[api.PkgName]bool) {
 	writeSpecFile(specs)
 }
 
-// dartGuess stub.
-func dartGuess(context.Context) (map[string][]api.PkgName, bool) {
-	util.DieUnimplemented("Guess not implemented!")
-
-	return nil, false
-}
-
 // DartPubBackend is a UPM backend for Dart that uses Pub.dev.
 var DartPubBackend = api.LanguageBackend{
 	Name:             "dart-pub",
 	Specfile:         "pubspec.yaml",
 	Lockfile:         "pubspec.lock",
 	IsAvailable:      dartIsAvailable,
+	Tools:            []string{"dart"},
 	FilenamePatterns: []string{"*.dart"},
-	Quirks:           api.QuirksLockAlsoInstalls,
+	Quirks:           api.QuirksLockAlsoInstalls | api.QuirksSpecfileEditedDirectly,
 	GetPackageDir:    dartGetPackageDir,
 	Search:           dartSearch,
 	Info:             dartInfo,
@@ -324,9 +308,10 @@ var DartPubBackend = api.LanguageBackend{
 		defer span.Finish()
 		util.RunCmd([]string{"dart", "pub", "get"})
 	},
-	ListSpecfile:                       dartListPubspecYaml,
+	ListSpecfile: func(mergeAllGroups bool) api.PkgDeps {
+		return api.RuntimeDeps(dartListPubspecYaml(mergeAllGroups))
+	},
 	ListLockfile:                       dartListPubspecLock,
 	GuessRegexps:                       nil,
-	Guess:                              dartGuess,
 	InstallReplitNixSystemDependencies: nix.DefaultInstallReplitNixSystemDependencies,
 }
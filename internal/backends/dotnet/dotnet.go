@@ -21,6 +21,7 @@ var DotNetBackend = api.LanguageBackend{
 	Specfile:         findSpecFile(),
 	Lockfile:         lockFileName,
 	IsAvailable:      dotnetIsAvailable,
+	Tools:            []string{"dotnet"},
 	FilenamePatterns: []string{"*.cs", "*.csproj", "*.fs", "*.fsproj"},
 	Remove: func(ctx context.Context, pkgs map[api.PkgName]bool) {
 		removePackages(ctx, pkgs, findSpecFile(), util.RunCmd)
@@ -28,11 +29,13 @@ var DotNetBackend = api.LanguageBackend{
 	Add: func(ctx context.Context, pkgs map[api.PkgName]api.PkgSpec, projectName string) {
 		addPackages(ctx, pkgs, projectName, util.RunCmd)
 	},
-	Search:       search,
-	Info:         info,
-	Install:      func(ctx context.Context) { install(ctx, util.RunCmd) },
-	Lock:         func(ctx context.Context) { lock(ctx, util.RunCmd) },
-	ListSpecfile: listSpecfile,
+	Search:  search,
+	Info:    info,
+	Install: func(ctx context.Context) { install(ctx, util.RunCmd) },
+	Lock:    func(ctx context.Context) { lock(ctx, util.RunCmd) },
+	ListSpecfile: func(mergeAllGroups bool) api.PkgDeps {
+		return api.RuntimeDeps(listSpecfile(mergeAllGroups))
+	},
 	ListLockfile: listLockfile,
 	GetPackageDir: func() string {
 		return "bin/"
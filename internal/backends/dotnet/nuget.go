@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"encoding/xml"
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
 	"strings"
@@ -78,15 +77,12 @@ func search(query string) []api.PkgInfo {
 		return pkgs
 	}
 
-	body, err := io.ReadAll(res.Body)
-	if err != nil {
-		util.DieProtocol("Could not read response: %s", err)
-	}
+	body := api.ReadResponse(res)
 
 	var searchResult searchResult
 	err = json.Unmarshal(body, &searchResult)
 	if err != nil {
-		util.DieProtocol("Could not unmarshal response data: %s", err)
+		util.DieProtocol("%s: could not unmarshal response data: %s", api.Endpoint(res), err)
 	}
 
 	for _, data := range searchResult.Data {
@@ -98,7 +94,7 @@ func search(query string) []api.PkgInfo {
 		})
 	}
 
-	return pkgs
+	return api.CheckSearchResults(api.Endpoint(res), pkgs)
 }
 
 // looks up all the versions of the package and gets retails for the latest version from nuget.org
@@ -111,14 +107,14 @@ func info(pkgName api.PkgName) api.PkgInfo {
 		util.DieNetwork("failed to get the versions: %s", err)
 	}
 	defer res.Body.Close()
-	body, err := io.ReadAll(res.Body)
-	if err != nil {
-		util.DieProtocol("could not read response: %s", err)
-	}
+	body := api.ReadResponse(res)
 	var infoResult infoResult
 	err = json.Unmarshal(body, &infoResult)
 	if err != nil {
-		util.DieProtocol("could not read json body: %s", err)
+		util.DieProtocol("%s: could not read json body: %s", api.Endpoint(res), err)
+	}
+	if len(infoResult.Versions) == 0 {
+		util.DieProtocol("%s: no versions", api.Endpoint(res))
 	}
 	latestVersion := infoResult.Versions[len(infoResult.Versions)-1]
 	util.ProgressMsg(fmt.Sprintf("latest version of %s is %s", pkgName, latestVersion))
@@ -129,14 +125,11 @@ func info(pkgName api.PkgName) api.PkgInfo {
 		util.DieNetwork("failed to get the spec: %s", err)
 	}
 	defer res.Body.Close()
-	body, err = io.ReadAll(res.Body)
-	if err != nil {
-		util.DieProtocol("could not read response: %s", err)
-	}
+	body = api.ReadResponse(res)
 	var nugetPackage nugetPackage
 	err = xml.Unmarshal(body, &nugetPackage)
 	if err != nil {
-		util.DieProtocol(fmt.Sprintf("failed to read spec %s", err))
+		util.DieProtocol("%s: failed to read spec: %s", api.Endpoint(res), err)
 	}
 
 	pkgInfo := api.PkgInfo{
@@ -148,5 +141,5 @@ func info(pkgName api.PkgName) api.PkgInfo {
 		SourceCodeURL: nugetPackage.Metadata.Repository.URL,
 		HomepageURL:   nugetPackage.Metadata.ProjectURL,
 	}
-	return pkgInfo
+	return api.CheckInfo(api.Endpoint(res), pkgInfo)
 }
@@ -0,0 +1,286 @@
+package elisp
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/specedit"
+)
+
+// caskSymbol is a symbol, keyword or number read from a Cask file.
+// String literals are read as Go strings, and lists as []interface{}.
+type caskSymbol string
+
+// caskReader reads the s-expressions of a Cask file. It understands
+// just enough Emacs Lisp syntax to skip over anything a Cask file may
+// contain besides the directives that UPM needs.
+type caskReader struct {
+	contents string
+	pos      int
+}
+
+// skipSpace skips whitespace and comments.
+func (r *caskReader) skipSpace() {
+	for r.pos < len(r.contents) {
+		switch c := r.contents[r.pos]; {
+		case c == ';':
+			for r.pos < len(r.contents) && r.contents[r.pos] != '\n' {
+				r.pos++
+			}
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			r.pos++
+		default:
+			return
+		}
+	}
+}
+
+// read reads the next s-expression. It must not be called at the end
+// of the input.
+func (r *caskReader) read() (interface{}, error) {
+	start := r.pos
+	switch c := r.contents[r.pos]; c {
+	case '(', '[':
+		closing := byte(')')
+		if c == '[' {
+			closing = ']'
+		}
+		r.pos++
+		list := []interface{}{}
+		for {
+			r.skipSpace()
+			if r.pos >= len(r.contents) {
+				return nil, fmt.Errorf("unterminated list at offset %d", start)
+			}
+			if r.contents[r.pos] == closing {
+				r.pos++
+				return list, nil
+			}
+			item, err := r.read()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, item)
+		}
+
+	case ')', ']':
+		return nil, fmt.Errorf("unexpected %q at offset %d", c, start)
+
+	case '"':
+		r.pos++
+		var sb strings.Builder
+		for r.pos < len(r.contents) {
+			c := r.contents[r.pos]
+			r.pos++
+			switch c {
+			case '"':
+				return sb.String(), nil
+			case '\\':
+				if r.pos >= len(r.contents) {
+					break
+				}
+				escaped := r.contents[r.pos]
+				r.pos++
+				switch escaped {
+				case 'n':
+					sb.WriteByte('\n')
+				case 't':
+					sb.WriteByte('\t')
+				case '\n':
+					// An escaped newline continues the
+					// string on the next line.
+				default:
+					sb.WriteByte(escaped)
+				}
+			default:
+				sb.WriteByte(c)
+			}
+		}
+		return nil, fmt.Errorf("unterminated string at offset %d", start)
+
+	case '\'', '`', ',', '#':
+		// Quoting and reader syntax such as #'function do not
+		// matter to UPM, so they are read as what they quote.
+		r.pos++
+		if r.pos < len(r.contents) && r.contents[r.pos] == '@' {
+			r.pos++
+		}
+		r.skipSpace()
+		if r.pos >= len(r.contents) {
+			return nil, fmt.Errorf("nothing to quote at offset %d", start)
+		}
+		return r.read()
+
+	default:
+		for r.pos < len(r.contents) {
+			c := r.contents[r.pos]
+			if c == '\\' && r.pos+1 < len(r.contents) {
+				r.pos += 2
+				continue
+			}
+			if strings.IndexByte(" \t\n\r\f()[]\";'`,", c) >= 0 {
+				break
+			}
+			r.pos++
+		}
+		return caskSymbol(r.contents[start:r.pos]), nil
+	}
+}
+
+// readCask reads every top-level s-expression of the Cask file
+// contents.
+func readCask(contents string) ([]interface{}, error) {
+	r := &caskReader{contents: contents}
+	forms := []interface{}{}
+	for {
+		r.skipSpace()
+		if r.pos >= len(r.contents) {
+			return forms, nil
+		}
+		form, err := r.read()
+		if err != nil {
+			return nil, err
+		}
+		forms = append(forms, form)
+	}
+}
+
+// formatSexp writes an s-expression the way Emacs prints it with %S,
+// which is how the specs of Cask dependencies are written.
+func formatSexp(form interface{}) string {
+	switch form := form.(type) {
+	case string:
+		return strconv.Quote(form)
+	case caskSymbol:
+		return string(form)
+	case []interface{}:
+		items := []string{}
+		for _, item := range form {
+			items = append(items, formatSexp(item))
+		}
+		return "(" + strings.Join(items, " ") + ")"
+	}
+	panic(fmt.Sprintf("unexpected s-expression %#v", form))
+}
+
+// isForm returns the arguments of form if it is a list headed by the
+// symbol head.
+func isForm(form interface{}, head string) ([]interface{}, bool) {
+	list, ok := form.([]interface{})
+	if !ok || len(list) == 0 || list[0] != caskSymbol(head) {
+		return nil, false
+	}
+	return list[1:], true
+}
+
+// caskDependency converts the arguments of a depends-on directive,
+// as in ("name" "1.0" :git "URL" :branch "main"), into the package
+// name and its spec. The spec is the minimum version, quoted, followed
+// by the fetcher, :files, :ref and :branch, in that order.
+func caskDependency(args []interface{}) (api.PkgName, api.PkgSpec, error) {
+	if len(args) == 0 {
+		return "", "", fmt.Errorf("depends-on without a package name")
+	}
+	var name string
+	switch arg := args[0].(type) {
+	case string:
+		name = arg
+	case caskSymbol:
+		name = string(arg)
+	default:
+		return "", "", fmt.Errorf("depends-on with a list as the package name")
+	}
+	args = args[1:]
+
+	parts := []string{}
+	if len(args) > 0 {
+		if version, ok := args[0].(string); ok {
+			parts = append(parts, strconv.Quote(version))
+			args = args[1:]
+		}
+	}
+
+	var fetcher string
+	options := map[string]string{}
+	for len(args) > 0 {
+		keyword, ok := args[0].(caskSymbol)
+		if !ok || !strings.HasPrefix(string(keyword), ":") || len(args) < 2 {
+			return "", "", fmt.Errorf("depends-on %q: expected a keyword and a value, got %s", name, formatSexp(args[0]))
+		}
+		value := fmt.Sprintf("%s %s", keyword, formatSexp(args[1]))
+		switch keyword {
+		case ":files", ":ref", ":branch":
+			options[string(keyword)] = value
+		default:
+			fetcher = value
+		}
+		args = args[2:]
+	}
+	if fetcher != "" {
+		parts = append(parts, fetcher)
+	}
+	for _, keyword := range []string{":files", ":ref", ":branch"} {
+		if value, ok := options[keyword]; ok {
+			parts = append(parts, value)
+		}
+	}
+	return api.PkgName(name), api.PkgSpec(strings.Join(parts, " ")), nil
+}
+
+// caskDependsOn matches the start of a depends-on directive, for
+// finding the comments on the lines of dependencies.
+var caskDependsOn = regexp.MustCompile(`\(depends-on\s+'?"?([^"\s()]+)`)
+
+// parseCask returns the dependencies declared in the Cask file
+// contents, with those inside a development directive marked as
+// development dependencies. A comment on the line where a dependency
+// starts is its reason. Other directives are ignored.
+func parseCask(contents string) (api.PkgDeps, error) {
+	forms, err := readCask(contents)
+	if err != nil {
+		return nil, err
+	}
+	pkgs := api.PkgDeps{}
+	add := func(args []interface{}, dev bool) error {
+		name, spec, err := caskDependency(args)
+		if err != nil {
+			return err
+		}
+		pkgs[name] = api.PkgDep{Spec: spec, Dev: dev}
+		return nil
+	}
+	for _, form := range forms {
+		if args, ok := isForm(form, "depends-on"); ok {
+			if err := add(args, false); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if body, ok := isForm(form, "development"); ok {
+			for _, inner := range body {
+				if args, ok := isForm(inner, "depends-on"); ok {
+					if err := add(args, true); err != nil {
+						return nil, err
+					}
+				}
+			}
+		}
+	}
+
+	for _, line := range strings.Split(contents, "\n") {
+		code, comment := specedit.SplitComment(line, ";")
+		if comment == "" {
+			continue
+		}
+		for _, match := range caskDependsOn.FindAllStringSubmatch(code, -1) {
+			if dep, ok := pkgs[api.PkgName(match[1])]; ok {
+				dep.Reason = comment
+				pkgs[api.PkgName(match[1])] = dep
+			}
+		}
+	}
+	return pkgs, nil
+}
@@ -0,0 +1,58 @@
+package elisp
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+)
+
+func TestParseCask(t *testing.T) {
+	contents := `;; -*- mode: emacs-lisp -*-
+(package "example" "0.1.0" "An example; with a semicolon")
+
+(source gnu)
+(source melpa)
+
+(package-file "example.el")
+(files "*.el" (:exclude "example-test.el"))
+
+(depends-on "dash")
+(depends-on "s" "1.12.0")
+(depends-on 'f)
+(depends-on "magit-popup"
+            :git "https://github.com/magit/magit-popup.git"
+            :branch "master"
+            :files ("*.el" "lib/*.el"))
+
+(development
+ (depends-on "ert-runner") ; runs the tests
+ (depends-on "undercover" :git "https://github.com/undercover-el/undercover.el" :ref "v0.8.1"))
+`
+	expected := api.PkgDeps{
+		"dash":        {},
+		"s":           {Spec: `"1.12.0"`},
+		"f":           {},
+		"magit-popup": {Spec: `:git "https://github.com/magit/magit-popup.git" :files ("*.el" "lib/*.el") :branch "master"`},
+		"ert-runner":  {Dev: true, Reason: "runs the tests"},
+		"undercover":  {Spec: `:git "https://github.com/undercover-el/undercover.el" :ref "v0.8.1"`, Dev: true},
+	}
+	pkgs, err := parseCask(contents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(pkgs, expected) {
+		t.Errorf("expected %v, got %v", expected, pkgs)
+	}
+
+	for _, invalid := range []string{
+		`(depends-on "dash"`,
+		`(depends-on "dash" :git)`,
+		`(depends-on "unterminated)`,
+		`)`,
+	} {
+		if _, err := parseCask(invalid); err == nil {
+			t.Errorf("expected %q to be rejected", invalid)
+		}
+	}
+}
@@ -4,15 +4,19 @@ package elisp
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/config"
 	"github.com/replit/upm/internal/nix"
+	"github.com/replit/upm/internal/specedit"
 	"github.com/replit/upm/internal/util"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 )
@@ -28,64 +32,125 @@ func elispCaskIsAvailable() bool {
 	return err == nil
 }
 
+// caskCommit matches git refs that are commits rather than branches
+// or tags.
+var caskCommit = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
+
+// caskSpecForSource implements SpecForSource for Cask, which can
+// fetch packages from git repositories, as in
+// (depends-on "name" :git "URL" :branch "main").
+func caskSpecForSource(name api.PkgName, source api.PkgSource) (api.PkgSpec, error) {
+	if source.Kind != api.SourceGit {
+		return "", errors.New("Cask can only fetch packages from git repositories")
+	}
+	spec := fmt.Sprintf(":git %q", source.Location)
+	if caskCommit.MatchString(source.Ref) {
+		spec += fmt.Sprintf(" :ref %q", source.Ref)
+	} else if source.Ref != "" {
+		spec += fmt.Sprintf(" :branch %q", source.Ref)
+	}
+	return api.PkgSpec(spec), nil
+}
+
+// caskSourceKeyword matches a keyword argument to depends-on in a
+// Cask spec, as in :git "URL".
+var caskSourceKeyword = regexp.MustCompile(`:(git|ref|branch) +"((?:[^"\\]|\\.)*)"`)
+
+// caskSourceOfSpec implements SourceOfSpec for Cask.
+func caskSourceOfSpec(spec api.PkgSpec) (api.PkgSource, bool) {
+	source := api.PkgSource{Kind: api.SourceGit}
+	for _, match := range caskSourceKeyword.FindAllStringSubmatch(string(spec), -1) {
+		switch match[1] {
+		case "git":
+			source.Location = match[2]
+		default:
+			source.Ref = match[2]
+		}
+	}
+	return source, source.Location != ""
+}
+
+// caskContents returns a new Cask with the default package sources,
+// and a package directive if the name or version is known. A Cask has
+// no place for a license.
+func caskContents(meta api.ProjectMetadata) string {
+	contents := ""
+	if meta.Name != "" || meta.Version != "" {
+		if meta.Name == "" {
+			wd, err := os.Getwd()
+			if err != nil {
+				util.DieIO("%s", err)
+			}
+			meta.Name = filepath.Base(wd)
+		}
+		if meta.Version == "" {
+			meta.Version = "0.1.0"
+		}
+		contents += fmt.Sprintf("(package %s %s \"\")\n\n", strconv.Quote(meta.Name), strconv.Quote(meta.Version))
+	}
+	return contents + `(source melpa)
+(source gnu)
+(source org)
+`
+}
+
+// elpaSearch runs elpa-search.el with action and arg in a sandbox,
+// where the package archives it downloads go in the sandbox directory,
+// and returns its output.
+func elpaSearch(action, arg string) []byte {
+	// Run script with lexical binding (any header comment in the
+	// script would not be respected, so we have to do it this
+	// way).
+	code := fmt.Sprintf(
+		"(eval '(progn %s) t)", util.GetResource("/elisp/elpa-search.el"),
+	)
+	code = strings.Replace(code, "~", "`", -1)
+	return util.GetSandboxedCmdOutput([]string{
+		"emacs", "-Q", "--batch", "--eval", code,
+		".", action, arg,
+	}, true)
+}
+
 // ElispBackend is the UPM language backend for Emacs Lisp using Cask.
 var ElispBackend = api.LanguageBackend{
 	Name:             "elisp-cask",
 	Specfile:         "Cask",
 	Lockfile:         "packages.txt",
 	IsAvailable:      elispCaskIsAvailable,
+	Tools:            []string{"emacs", "cask"},
 	FilenamePatterns: elispPatterns,
-	Quirks:           api.QuirksNotReproducible,
+	Quirks:           api.QuirksNotReproducible | api.QuirksSpecfileEditedDirectly,
 	GetPackageDir: func() string {
 		return ".cask"
 	},
+	ListInstalled:  elpaListInstalled,
+	InstalledSizes: elpaInstalledSizes,
 	Search: func(query string) []api.PkgInfo {
-		tmpdir, err := os.MkdirTemp("", "elpa")
-		if err != nil {
-			util.DieIO("%s", err)
+		if util.ScriptsDisabled() {
+			return melpaSearch(query)
 		}
-		defer os.RemoveAll(tmpdir)
-
-		// Run script with lexical binding (any header comment
-		// in the script would not be respected, so we have to
-		// do it this way).
-		code := fmt.Sprintf(
-			"(eval '(progn %s) t)", util.GetResource("/elisp/elpa-search.el"),
-		)
-		code = strings.Replace(code, "~", "`", -1)
-		outputB := util.GetCmdOutput([]string{
-			"emacs", "-Q", "--batch", "--eval", code,
-			tmpdir, "search", query,
-		})
 		var results []api.PkgInfo
-		if err := json.Unmarshal(outputB, &results); err != nil {
-			util.DieProtocol("%s", err)
+		if err := json.Unmarshal(elpaSearch("search", query), &results); err != nil {
+			util.DieProtocol("elpa-search.el: %s", err)
 		}
-		return results
+		return api.CheckSearchResults("elpa-search.el", results)
 	},
 	Info: func(name api.PkgName) api.PkgInfo {
-		tmpdir, err := os.MkdirTemp("", "elpa")
-		if err != nil {
-			util.DieIO("%s", err)
+		if util.ScriptsDisabled() {
+			return melpaInfo(name)
 		}
-		defer os.RemoveAll(tmpdir)
-
-		// Run script with lexical binding (any header comment
-		// in the script would not be respected, so we have to
-		// do it this way).
-		code := fmt.Sprintf(
-			"(eval '(progn %s) t)", util.GetResource("/elisp/elpa-search.el"),
-		)
-		code = strings.Replace(code, "~", "`", -1)
-		outputB := util.GetCmdOutput([]string{
-			"emacs", "-Q", "--batch", "--eval", code,
-			tmpdir, "info", string(name),
-		})
 		var info api.PkgInfo
-		if err := json.Unmarshal(outputB, &info); err != nil {
-			util.DieProtocol("%s", err)
+		if err := json.Unmarshal(elpaSearch("info", string(name)), &info); err != nil {
+			util.DieProtocol("elpa-search.el: %s", err)
 		}
-		return info
+		return api.CheckInfo("elpa-search.el", info)
+	},
+	SupportsDev:     true,
+	SupportsReasons: true,
+	SpecForSource:   caskSpecForSource,
+	SourceOfSpec:    caskSourceOfSpec,
+	Init: func(ctx context.Context, meta api.ProjectMetadata) {
+		util.TryWriteAtomic("Cask", []byte(caskContents(meta)))
 	},
 	Add: func(ctx context.Context, pkgs map[api.PkgName]api.PkgSpec, projectName string) {
 		//nolint:ineffassign,wastedassign,staticcheck
@@ -94,10 +159,7 @@ var ElispBackend = api.LanguageBackend{
 		contentsB, err := os.ReadFile("Cask")
 		var contents string
 		if os.IsNotExist(err) {
-			contents = `(source melpa)
-(source gnu)
-(source org)
-`
+			contents = caskContents(api.ProjectMetadata{Name: projectName})
 		} else if err != nil {
 			util.DieIO("Cask: %s", err)
 		} else {
@@ -110,12 +172,34 @@ var ElispBackend = api.LanguageBackend{
 			contents += "\n"
 		}
 
+		indent := ""
+		if config.Dev {
+			contents += "(development"
+			indent = " "
+		}
+		lines := []string{}
 		for name, spec := range pkgs {
-			contents += fmt.Sprintf(`(depends-on "%s"`, name)
+			line := fmt.Sprintf(`%s(depends-on "%s"`, indent, name)
 			if spec != "" {
-				contents += fmt.Sprintf(" %s", spec)
+				line += fmt.Sprintf(" %s", spec)
+			}
+			lines = append(lines, line+")")
+		}
+		if config.Dev {
+			// The development directive is closed on the
+			// last line, before any comment.
+			if len(lines) == 0 {
+				contents += ")\n"
+			} else {
+				contents += "\n"
+				lines[len(lines)-1] += ")"
+			}
+		}
+		for _, line := range lines {
+			if config.Reason != "" {
+				line = specedit.SetComment(line, ";", config.Reason)
 			}
-			contents += ")\n"
+			contents += line + "\n"
 		}
 
 		contentsB = []byte(contents)
@@ -135,7 +219,7 @@ var ElispBackend = api.LanguageBackend{
 		for name := range pkgs {
 			contents = regexp.MustCompile(
 				fmt.Sprintf(
-					`(?m)^ *\(depends-on +"%s".*\)\n?$`,
+					`(?m)^ *\(depends-on +"%s".*\)[ \t]*(?:;.*)?\n?$`,
 					regexp.QuoteMeta(string(name)),
 				),
 			).ReplaceAllLiteralString(contents, "")
@@ -158,24 +242,14 @@ var ElispBackend = api.LanguageBackend{
 		util.ProgressMsg("write packages.txt")
 		util.TryWriteAtomic("packages.txt", outputB)
 	},
-	ListSpecfile: func(mergeAllGroups bool) map[api.PkgName]api.PkgSpec {
-		outputB := util.GetCmdOutput(
-			[]string{"cask", "eval", util.GetResource(
-				"/elisp/cask-list-specfile.el",
-			)},
-		)
-		pkgs := map[api.PkgName]api.PkgSpec{}
-		for _, line := range strings.Split(string(outputB), "\n") {
-			if line == "" {
-				continue
-			}
-			fields := strings.SplitN(line, "=", 2)
-			if len(fields) != 2 {
-				util.DieProtocol("unexpected output, expected name=spec: %s", line)
-			}
-			name := api.PkgName(fields[0])
-			spec := api.PkgSpec(fields[1])
-			pkgs[name] = spec
+	ListSpecfile: func(mergeAllGroups bool) api.PkgDeps {
+		contentsB, err := os.ReadFile("Cask")
+		if err != nil {
+			util.DieIO("Cask: %s", err)
+		}
+		pkgs, err := parseCask(string(contentsB))
+		if err != nil {
+			util.DieProtocol("Cask: %s", err)
 		}
 		return pkgs
 	},
@@ -264,3 +338,49 @@ var ElispBackend = api.LanguageBackend{
 	},
 	InstallReplitNixSystemDependencies: nix.DefaultInstallReplitNixSystemDependencies,
 }
+
+// elpaPackageDir matches the name of a package directory in an ELPA
+// directory, as in "dash-2.19.1", like cask-list-installed.el does.
+var elpaPackageDir = regexp.MustCompile(`^(.+)-([^-]+)$`)
+
+// elpaListInstalled implements ListInstalled by scanning the ELPA
+// directories that Cask creates for each Emacs version under .cask,
+// so that it does not need to start Emacs.
+func elpaListInstalled(pkgdir string) map[api.PkgName]api.PkgVersion {
+	pkgs := map[api.PkgName]api.PkgVersion{}
+	dirs, err := filepath.Glob(filepath.Join(pkgdir, "*", "elpa", "*"))
+	if err != nil {
+		util.DieIO("%s", err)
+	}
+	for _, dir := range dirs {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			continue
+		}
+		if match := elpaPackageDir.FindStringSubmatch(filepath.Base(dir)); match != nil {
+			pkgs[api.PkgName(match[1])] = api.PkgVersion(match[2])
+		}
+	}
+	return pkgs
+}
+
+// elpaInstalledSizes implements InstalledSizes for Cask, from the
+// package directories that elpaListInstalled finds.
+func elpaInstalledSizes(pkgdir string) map[api.PkgName]int64 {
+	sizes := map[api.PkgName]int64{}
+	dirs, err := filepath.Glob(filepath.Join(pkgdir, "*", "elpa", "*"))
+	if err != nil {
+		util.DieIO("%s", err)
+	}
+	for _, dir := range dirs {
+		match := elpaPackageDir.FindStringSubmatch(filepath.Base(dir))
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() || match == nil {
+			continue
+		}
+		size, err := util.DirSize(dir)
+		if err != nil {
+			util.DieIO("%s", err)
+		}
+		sizes[api.PkgName(match[1])] += size
+	}
+	return sizes
+}
@@ -0,0 +1,139 @@
+package elisp
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/util"
+)
+
+// melpaPackage is an entry of the archive.json of MELPA, which lists
+// the same packages as its archive-contents, as JSON.
+type melpaPackage struct {
+	Version []int            `json:"ver"`
+	Deps    map[string][]int `json:"deps"`
+	Desc    string           `json:"desc"`
+	Props   struct {
+		URL         string            `json:"url"`
+		Maintainer  json.RawMessage   `json:"maintainer"`
+		Maintainers []json.RawMessage `json:"maintainers"`
+		Authors     []json.RawMessage `json:"authors"`
+	} `json:"props"`
+}
+
+// melpaRegistry returns the base URL of MELPA.
+func melpaRegistry() string {
+	return strings.TrimSuffix(config.Registry("melpa", "https://melpa.org"), "/")
+}
+
+// melpaArchive downloads the archive.json of MELPA.
+func melpaArchive() map[string]melpaPackage {
+	url := melpaRegistry() + "/archive.json"
+	res, err := api.HttpClient.Get(url)
+	if err != nil {
+		util.DieNetwork("%s: %s", url, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		util.DieNetwork("%s: received status code %d", url, res.StatusCode)
+	}
+	body := api.ReadResponse(res)
+	var archive map[string]melpaPackage
+	if err := json.Unmarshal(body, &archive); err != nil {
+		util.DieProtocol("%s: %s", url, err)
+	}
+	return archive
+}
+
+// melpaPerson formats a maintainer or author of a package, which MELPA
+// gives either as "Name <email>" or as ["Name", "email"].
+func melpaPerson(raw json.RawMessage) string {
+	var person string
+	if err := json.Unmarshal(raw, &person); err == nil {
+		return person
+	}
+	var parts []string
+	if err := json.Unmarshal(raw, &parts); err != nil || len(parts) == 0 {
+		return ""
+	}
+	if len(parts) > 1 && parts[1] != "" {
+		return fmt.Sprintf("%s <%s>", parts[0], parts[1])
+	}
+	return parts[0]
+}
+
+// info converts the entry of the named package into a PkgInfo, like
+// upm-convert-package-desc in elpa-search.el.
+func (p melpaPackage) info(name string) api.PkgInfo {
+	version := []string{}
+	for _, part := range p.Version {
+		version = append(version, strconv.Itoa(part))
+	}
+	deps := []string{}
+	for dep := range p.Deps {
+		if dep != "emacs" {
+			deps = append(deps, dep)
+		}
+	}
+	sort.Strings(deps)
+
+	author := melpaPerson(p.Props.Maintainer)
+	for _, people := range [][]json.RawMessage{p.Props.Maintainers, p.Props.Authors} {
+		if author == "" && len(people) > 0 {
+			author = melpaPerson(people[0])
+		}
+	}
+	return api.PkgInfo{
+		Name:         name,
+		Description:  p.Desc,
+		Version:      strings.Join(version, "."),
+		HomepageURL:  p.Props.URL,
+		Author:       author,
+		Dependencies: deps,
+	}
+}
+
+// melpaSearch implements Search with the HTTP API of MELPA, for when
+// scripts are disabled. Like elpa-search.el, it returns the packages
+// whose names contain every word of the query, shortest first. Unlike
+// it, it does not search GNU ELPA, whose index is only published as
+// Lisp.
+func melpaSearch(query string) []api.PkgInfo {
+	words := strings.Fields(strings.ToLower(query))
+	archive := melpaArchive()
+	names := []string{}
+	for name := range archive {
+		matches := true
+		for _, word := range words {
+			matches = matches && strings.Contains(strings.ToLower(name), word)
+		}
+		if matches {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if len(names[i]) != len(names[j]) {
+			return len(names[i]) < len(names[j])
+		}
+		return names[i] < names[j]
+	})
+	results := []api.PkgInfo{}
+	for _, name := range names {
+		results = append(results, archive[name].info(name))
+	}
+	return api.CheckSearchResults(melpaRegistry()+"/archive.json", results)
+}
+
+// melpaInfo implements Info with the HTTP API of MELPA, for when
+// scripts are disabled.
+func melpaInfo(name api.PkgName) api.PkgInfo {
+	if p, ok := melpaArchive()[string(name)]; ok {
+		return api.CheckInfo(melpaRegistry()+"/archive.json", p.info(string(name)))
+	}
+	return api.PkgInfo{}
+}
@@ -0,0 +1,55 @@
+package elisp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/config"
+)
+
+func TestMelpa(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/archive.json" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(`{
+  "dash": {"ver": [20240510, 1327], "deps": {"emacs": [24]}, "desc": "A modern list library", "type": "single",
+           "props": {"url": "https://github.com/magnars/dash.el", "maintainers": [["Basil L. Contovounesios", "basil@contovou.net"]]}},
+  "dash-functional": {"ver": [20210210, 1449], "deps": {"dash": [2, 18]}, "desc": "Collection of useful combinators", "type": "single",
+                      "props": {"maintainer": "Magnar Sveen <magnars@gmail.com>"}},
+  "s": {"ver": [20220902, 1511], "desc": "The long lost string manipulation library", "type": "single", "props": {}}
+}`))
+	}))
+	defer server.Close()
+	defer func(registries map[string]string) { config.Loaded.Registries = registries }(config.Loaded.Registries)
+	config.Loaded.Registries = map[string]string{"melpa": server.URL + "/"}
+
+	results := melpaSearch("DASH")
+	if len(results) != 2 || results[0].Name != "dash" || results[1].Name != "dash-functional" {
+		t.Fatalf("expected dash and dash-functional, got %+v", results)
+	}
+	if len(melpaSearch("dash func")) != 1 {
+		t.Errorf("expected every word of the query to match")
+	}
+
+	expected := api.PkgInfo{
+		Name:         "dash-functional",
+		Description:  "Collection of useful combinators",
+		Version:      "20210210.1449",
+		Author:       "Magnar Sveen <magnars@gmail.com>",
+		Dependencies: []string{"dash"},
+	}
+	if info := melpaInfo("dash-functional"); !reflect.DeepEqual(info, expected) {
+		t.Errorf("expected %+v, got %+v", expected, info)
+	}
+	if info := melpaInfo("dash"); info.Author != "Basil L. Contovounesios <basil@contovou.net>" || len(info.Dependencies) != 0 {
+		t.Errorf("unexpected info %+v", info)
+	}
+	if info := melpaInfo("missing"); info.Name != "" {
+		t.Errorf("expected no info, got %+v", info)
+	}
+}
@@ -0,0 +1,261 @@
+// Package external provides language backends implemented outside of
+// UPM, as executables that speak a JSON protocol over stdio.
+//
+// A backend executable is run once per operation, as
+//
+//	<executable> <command>
+//
+// with a JSON request object on stdin. It writes a JSON response
+// object to stdout and exits zero on success. On failure it exits
+// nonzero, and may write {"error": "<message>"} to stdout to explain
+// why. Stderr is passed through to the user. The commands are:
+//
+//	detect          {} -> {"name", "specfile", "lockfile",
+//	                "filenamePatterns", "packageDir", "notReproducible",
+//	                "supportsDev", "supportsGroups", "supportsReasons",
+//	                "unsupported"}
+//	add             {"packages": {name: spec}, "projectName", "dev",
+//	                "group", "reason"} -> {}
+//	remove          {"packages": [name]} -> {}
+//	lock            {} -> {}
+//	install         {"prod", "frozen"} -> {}
+//	list-specfile   {"mergeAllGroups"} -> {"packages": {name:
+//	                {"spec", "dev", "group", "reason"}}}
+//	list-lockfile   {} -> {"packages": {name: version}}
+//	search          {"query"} -> {"results": [info]}
+//	info            {"name"} -> {"info": info}
+//	guess           {} -> {"guesses": {import: [name]}, "success"}
+//
+// where info has the same fields as the JSON output of 'upm info'.
+// The search, info and guess commands may be listed in unsupported,
+// in which case UPM never runs them.
+// Despite its name, detect describes the backend rather than the
+// project; UPM detects projects from the specfile, lockfile and
+// filename patterns, as for its built-in backends.
+package external
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/util"
+)
+
+// ExecutablePrefix is the prefix of the names of backend executables
+// that are discovered on PATH. The rest of the name is used as the
+// backend name if detect does not give one.
+const ExecutablePrefix = "upm-backend-"
+
+// description is the response to detect.
+type description struct {
+	Name             string   `json:"name"`
+	Specfile         string   `json:"specfile"`
+	Lockfile         string   `json:"lockfile"`
+	FilenamePatterns []string `json:"filenamePatterns"`
+	PackageDir       string   `json:"packageDir"`
+	NotReproducible  bool     `json:"notReproducible"`
+	SupportsDev      bool     `json:"supportsDev"`
+	SupportsGroups   bool     `json:"supportsGroups"`
+	SupportsReasons  bool     `json:"supportsReasons"`
+	Unsupported      []string `json:"unsupported"`
+}
+
+type specfileDep struct {
+	Spec   api.PkgSpec `json:"spec"`
+	Dev    bool        `json:"dev"`
+	Group  string      `json:"group"`
+	Reason string      `json:"reason"`
+}
+
+// errorResponse is what a backend may print when it fails.
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// call runs command against the backend executable and decodes its
+// response into resp, terminating the process if anything fails.
+func call(executable, command string, req interface{}, resp interface{}) {
+	input, err := json.Marshal(req)
+	if err != nil {
+		panic(err)
+	}
+	output, err := util.GetCmdOutputWithInput([]string{executable, command}, input)
+	if err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			util.DieMissingTool("%s: not found; is it installed?", executable)
+		}
+		var errResp errorResponse
+		if json.Unmarshal(output, &errResp) == nil && errResp.Error != "" {
+			util.DieSubprocess("%s %s: %s", executable, command, errResp.Error)
+		}
+		util.DieSubprocess("%s %s: %s", executable, command, err)
+	}
+	if resp == nil {
+		return
+	}
+	if err := json.Unmarshal(output, resp); err != nil {
+		util.DieProtocol("%s %s: invalid response: %s", executable, command, err)
+	}
+}
+
+// Discover returns the backend executables on PATH and in the
+// [backends] table of the configuration files, keyed by the name they
+// were found under. Configured backends take precedence, then earlier
+// PATH entries.
+func Discover() map[string]string {
+	found := map[string]string{}
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name, ok := strings.CutPrefix(entry.Name(), ExecutablePrefix)
+			if !ok || name == "" || found[name] != "" {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil || info.IsDir() || info.Mode()&0o111 == 0 {
+				continue
+			}
+			found[name] = filepath.Join(dir, entry.Name())
+		}
+	}
+	for name, path := range config.Loaded.Backends {
+		found[name] = path
+	}
+	return found
+}
+
+// New asks the backend executable to describe itself, and returns a
+// language backend that delegates to it. The name is used if the
+// executable does not report one.
+func New(name, executable string) (b api.LanguageBackend, err error) {
+	var desc description
+	err = util.Catch(func() {
+		call(executable, "detect", struct{}{}, &desc)
+	})
+	if err != nil {
+		return b, err
+	}
+	if desc.Name == "" {
+		desc.Name = name
+	}
+	switch {
+	case desc.Specfile == "":
+		return b, fmt.Errorf("%s: detect did not give a specfile", executable)
+	case desc.Lockfile == "" && !desc.NotReproducible:
+		return b, fmt.Errorf("%s: detect did not give a lockfile", executable)
+	case len(desc.FilenamePatterns) == 0:
+		return b, fmt.Errorf("%s: detect did not give any filename patterns", executable)
+	}
+
+	b = api.LanguageBackend{
+		Name:             desc.Name,
+		Specfile:         desc.Specfile,
+		Lockfile:         desc.Lockfile,
+		FilenamePatterns: desc.FilenamePatterns,
+		SupportsDev:      desc.SupportsDev,
+		SupportsGroups:   desc.SupportsGroups,
+		SupportsReasons:  desc.SupportsReasons,
+		GetPackageDir: func() string {
+			return desc.PackageDir
+		},
+		IsAvailable: func() bool {
+			return true
+		},
+		Add: func(ctx context.Context, pkgs map[api.PkgName]api.PkgSpec, projectName string) {
+			call(executable, "add", map[string]interface{}{
+				"packages":    pkgs,
+				"projectName": projectName,
+				"dev":         config.Dev,
+				"group":       config.Group,
+				"reason":      config.Reason,
+			}, nil)
+		},
+		Remove: func(ctx context.Context, pkgs map[api.PkgName]bool) {
+			names := []api.PkgName{}
+			for name := range pkgs {
+				names = append(names, name)
+			}
+			sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+			call(executable, "remove", map[string]interface{}{"packages": names}, nil)
+		},
+		Install: func(ctx context.Context) {
+			call(executable, "install", map[string]bool{
+				"prod":   config.Prod,
+				"frozen": config.Frozen,
+			}, nil)
+		},
+		ListSpecfile: func(mergeAllGroups bool) api.PkgDeps {
+			var resp struct {
+				Packages map[api.PkgName]specfileDep `json:"packages"`
+			}
+			call(executable, "list-specfile", map[string]bool{"mergeAllGroups": mergeAllGroups}, &resp)
+			deps := api.PkgDeps{}
+			for name, dep := range resp.Packages {
+				deps[name] = api.PkgDep{Spec: dep.Spec, Dev: dep.Dev, Group: dep.Group, Reason: dep.Reason}
+			}
+			return deps
+		},
+	}
+
+	unsupported := map[string]bool{}
+	for _, command := range desc.Unsupported {
+		unsupported[command] = true
+	}
+	if !unsupported["search"] {
+		b.Search = func(query string) []api.PkgInfo {
+			var resp struct {
+				Results []api.PkgInfo `json:"results"`
+			}
+			call(executable, "search", map[string]string{"query": query}, &resp)
+			return resp.Results
+		}
+	}
+	if !unsupported["info"] {
+		b.Info = func(name api.PkgName) api.PkgInfo {
+			var resp struct {
+				Info api.PkgInfo `json:"info"`
+			}
+			call(executable, "info", map[string]api.PkgName{"name": name}, &resp)
+			return resp.Info
+		}
+	}
+	if !unsupported["guess"] {
+		b.Guess = func(ctx context.Context) (map[string][]api.PkgName, bool) {
+			var resp struct {
+				Guesses map[string][]api.PkgName `json:"guesses"`
+				Success bool                     `json:"success"`
+			}
+			call(executable, "guess", struct{}{}, &resp)
+			return resp.Guesses, resp.Success
+		}
+	}
+
+	if desc.NotReproducible {
+		b.Quirks = api.QuirksNotReproducible
+	} else {
+		b.Lock = func(ctx context.Context) {
+			call(executable, "lock", struct{}{}, nil)
+		}
+		b.ListLockfile = func() map[api.PkgName]api.PkgVersion {
+			var resp struct {
+				Packages map[api.PkgName]api.PkgVersion `json:"packages"`
+			}
+			call(executable, "list-lockfile", struct{}{}, &resp)
+			return resp.Packages
+		}
+	}
+
+	return b, nil
+}
@@ -0,0 +1,88 @@
+package external
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/util"
+)
+
+// fakeBackend is a backend executable that answers detect and
+// list-specfile, and fails every other command.
+const fakeBackend = `#!/bin/sh
+case "$1" in
+  detect)
+    echo '{"specfile": "deps.txt", "lockfile": "deps.lock", "filenamePatterns": ["*.fake"], "supportsDev": true, "unsupported": ["guess"]}'
+    ;;
+  list-specfile)
+    echo '{"packages": {"left-pad": {"spec": "1.3.0"}, "mocha": {"spec": "*", "dev": true}}}'
+    ;;
+  *)
+    echo '{"error": "'"$1"' is not supported"}'
+    exit 1
+    ;;
+esac
+`
+
+func writeFakeBackend(t *testing.T) string {
+	dir := t.TempDir()
+	path := filepath.Join(dir, ExecutablePrefix+"fake")
+	if err := os.WriteFile(path, []byte(fakeBackend), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestDiscover(t *testing.T) {
+	dir := writeFakeBackend(t)
+	// Not executable, so it should be ignored.
+	if err := os.WriteFile(filepath.Join(dir, ExecutablePrefix+"data"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir)
+	defer func(loaded config.File) { config.Loaded = loaded }(config.Loaded)
+	config.Loaded = config.File{Backends: map[string]string{"other": "/opt/upm-other"}}
+
+	expected := map[string]string{
+		"fake":  filepath.Join(dir, ExecutablePrefix+"fake"),
+		"other": "/opt/upm-other",
+	}
+	if actual := Discover(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestNew(t *testing.T) {
+	executable := filepath.Join(writeFakeBackend(t), ExecutablePrefix+"fake")
+	defer func(quiet bool) { config.Quiet = quiet }(config.Quiet)
+	config.Quiet = true
+
+	b, err := New("fake", executable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Name != "fake" || b.Specfile != "deps.txt" || b.Lockfile != "deps.lock" || !b.SupportsDev {
+		t.Errorf("unexpected backend %+v", b)
+	}
+	if b.Guess != nil {
+		t.Error("expected guess to be unsupported")
+	}
+
+	expected := api.PkgDeps{
+		"left-pad": {Spec: "1.3.0"},
+		"mocha":    {Spec: "*", Dev: true},
+	}
+	if actual := b.ListSpecfile(true); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	err = util.Catch(func() { b.Search("pad") })
+	if err == nil || !strings.HasSuffix(err.Error(), "search: search is not supported") {
+		t.Errorf("expected the backend's error message, got %v", err)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"regexp"
 
 	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/config"
 	"github.com/replit/upm/internal/nix"
 	"github.com/replit/upm/internal/util"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
@@ -240,7 +241,9 @@ func removePackages(ctx context.Context, pkgs map[api.PkgName]bool) {
 	util.ProgressMsg("write pom.xml")
 	util.TryWriteAtomic("pom.xml", contentsB)
 
-	os.RemoveAll("target/dependency")
+	if !config.DryRun {
+		os.RemoveAll("target/dependency")
+	}
 }
 
 func listSpecfile(mergeAllGroups bool) map[api.PkgName]api.PkgSpec {
@@ -282,7 +285,7 @@ func search(query string) []api.PkgInfo {
 		}
 		pkgInfos = append(pkgInfos, pkgInfo)
 	}
-	return pkgInfos
+	return api.CheckSearchResults(mavenEndpoint, pkgInfos)
 }
 
 func info(pkgName api.PkgName) api.PkgInfo {
@@ -300,7 +303,7 @@ func info(pkgName api.PkgName) api.PkgInfo {
 		Name:    fmt.Sprintf("%s:%s", searchDoc.Group, searchDoc.Artifact),
 		Version: searchDoc.CurrentVersion,
 	}
-	return pkgInfo
+	return api.CheckInfo(mavenEndpoint, pkgInfo)
 }
 
 // JavaBackend is the UPM language backend for Java using Maven.
@@ -309,8 +312,9 @@ var JavaBackend = api.LanguageBackend{
 	Specfile:         pomdotxml,
 	Lockfile:         pomdotxml,
 	IsAvailable:      isAvailable,
+	Tools:            []string{"mvn"},
 	FilenamePatterns: javaPatterns,
-	Quirks:           api.QuirksAddRemoveAlsoLocks,
+	Quirks:           api.QuirksAddRemoveAlsoLocks | api.QuirksSpecfileEditedDirectly,
 	GetPackageDir: func() string {
 		return "target/dependency"
 	},
@@ -328,7 +332,9 @@ var JavaBackend = api.LanguageBackend{
 			"dependency:copy-dependencies",
 		})
 	},
-	ListSpecfile:                       listSpecfile,
+	ListSpecfile: func(mergeAllGroups bool) api.PkgDeps {
+		return api.RuntimeDeps(listSpecfile(mergeAllGroups))
+	},
 	ListLockfile:                       listLockfile,
 	Lock:                               func(ctx context.Context) {},
 	InstallReplitNixSystemDependencies: nix.DefaultInstallReplitNixSystemDependencies,
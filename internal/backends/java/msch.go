@@ -26,7 +26,6 @@ package java
 import (
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/url"
 	"strings"
 
@@ -51,6 +50,10 @@ type SearchResult struct {
 	} `json:"response"`
 }
 
+// mavenEndpoint is the search API of Maven Central, for error
+// messages.
+var mavenEndpoint = strings.TrimSuffix(mavenURL, "?q=")
+
 func mavenSearch(searchURL string) ([]SearchDoc, error) {
 	res, err := api.HttpClient.Get(searchURL)
 	if err != nil {
@@ -58,11 +61,7 @@ func mavenSearch(searchURL string) ([]SearchDoc, error) {
 	}
 	defer res.Body.Close()
 
-	body, err := io.ReadAll(res.Body)
-	if err != nil {
-		fmt.Printf("Could not read response\n")
-		return []SearchDoc{}, err
-	}
+	body := api.ReadResponse(res)
 
 	var searchResult SearchResult
 	if err := json.Unmarshal(body, &searchResult); err != nil {
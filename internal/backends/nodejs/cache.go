@@ -0,0 +1,28 @@
+package nodejs
+
+import (
+	"path/filepath"
+
+	"github.com/replit/upm/internal/util"
+)
+
+// cacheDirsFrom returns a CacheDirs function that asks a package
+// manager for its cache with cmd.
+func cacheDirsFrom(cmd ...string) func() []string {
+	return func() []string {
+		if dir := util.GetCmdOutputDir(cmd); dir != "" {
+			return []string{dir}
+		}
+		return nil
+	}
+}
+
+// npmCacheDirs implements CacheDirs for npm. Besides the cache of
+// packages, its directory holds logs and the packages of npx, which
+// are left alone.
+func npmCacheDirs() []string {
+	if dir := util.GetCmdOutputDir([]string{"npm", "config", "get", "cache"}); dir != "" {
+		return []string{filepath.Join(dir, "_cacache")}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package nodejs
+
+import "github.com/replit/upm/internal/api"
+
+// nodejsCommandPackages implements CommandPackages for Node.js: the
+// commands that JavaScript projects commonly run, and the npm packages
+// that provide them. It is kept by hand, for the commands that guess
+// and 'upm which-provides' should know about.
+var nodejsCommandPackages = map[string]api.PkgName{
+	"astro":           "astro",
+	"babel":           "@babel/cli",
+	"concurrently":    "concurrently",
+	"cross-env":       "cross-env",
+	"cypress":         "cypress",
+	"esbuild":         "esbuild",
+	"eslint":          "eslint",
+	"firebase":        "firebase-tools",
+	"gulp":            "gulp-cli",
+	"grunt":           "grunt-cli",
+	"http-server":     "http-server",
+	"jest":            "jest",
+	"knex":            "knex",
+	"lerna":           "lerna",
+	"mocha":           "mocha",
+	"nest":            "@nestjs/cli",
+	"netlify":         "netlify-cli",
+	"next":            "next",
+	"ng":              "@angular/cli",
+	"nodemon":         "nodemon",
+	"nuxt":            "nuxt",
+	"nx":              "nx",
+	"parcel":          "parcel",
+	"playwright":      "@playwright/test",
+	"pm2":             "pm2",
+	"prettier":        "prettier",
+	"prisma":          "prisma",
+	"react-scripts":   "react-scripts",
+	"rimraf":          "rimraf",
+	"rollup":          "rollup",
+	"sass":            "sass",
+	"sequelize":       "sequelize-cli", // the sequelize package has no command
+	"serve":           "serve",
+	"storybook":       "storybook",
+	"stylelint":       "stylelint",
+	"svelte-kit":      "@sveltejs/kit",
+	"tailwindcss":     "tailwindcss",
+	"ts-node":         "ts-node",
+	"ts-node-dev":     "ts-node-dev",
+	"tsc":             "typescript",
+	"tsx":             "tsx",
+	"turbo":           "turbo",
+	"typeorm":         "typeorm",
+	"vercel":          "vercel",
+	"vite":            "vite",
+	"vitest":          "vitest",
+	"vue-cli-service": "@vue/cli-service",
+	"webpack":         "webpack-cli", // webpack itself asks for webpack-cli to run
+	"wrangler":        "wrangler",
+}
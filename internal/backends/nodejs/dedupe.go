@@ -0,0 +1,66 @@
+package nodejs
+
+import (
+	"context"
+	"strings"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/util"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+// npmListLockfileCopies implements ListLockfileCopies for npm, from
+// the paths in node_modules that package-lock.json records. A version
+// may be installed at several paths.
+func npmListLockfileCopies() map[api.PkgName][]api.PkgVersion {
+	cfg := mustReadPackageLock()
+	copies := map[api.PkgName][]api.PkgVersion{}
+	if cfg.LockfileVersion <= 1 {
+		for name, data := range cfg.Dependencies {
+			copies[api.PkgName(name)] = append(copies[api.PkgName(name)], api.PkgVersion(data.Version))
+		}
+		return copies
+	}
+	for pathStr, data := range cfg.Packages {
+		idx := strings.LastIndex(pathStr, "node_modules/")
+		if idx < 0 || data.Link {
+			continue
+		}
+		name := api.PkgName(pathStr[idx+len("node_modules/"):])
+		copies[name] = append(copies[name], api.PkgVersion(data.Version))
+	}
+	return copies
+}
+
+// yarnListLockfileCopies implements ListLockfileCopies for Yarn, whose
+// lockfile records each version once, however many copies of it the
+// hoisting leaves.
+func yarnListLockfileCopies() map[api.PkgName][]api.PkgVersion {
+	copies := map[api.PkgName][]api.PkgVersion{}
+	for _, pkg := range readYarnLock().Packages {
+		if !pkg.Workspace {
+			copies[api.PkgName(pkg.Name)] = append(copies[api.PkgName(pkg.Name)], api.PkgVersion(pkg.Version))
+		}
+	}
+	return copies
+}
+
+// npmDedupe implements Dedupe for npm.
+func npmDedupe(ctx context.Context) {
+	//nolint:ineffassign,wastedassign,staticcheck
+	span, ctx := tracer.StartSpanFromContext(ctx, "npm dedupe")
+	defer span.Finish()
+	util.RunCmd([]string{"npm", "dedupe"})
+}
+
+// yarnDedupe implements Dedupe for Yarn Berry. Yarn 1 has no such
+// command.
+func yarnDedupe(ctx context.Context) {
+	//nolint:ineffassign,wastedassign,staticcheck
+	span, ctx := tracer.StartSpanFromContext(ctx, "yarn dedupe")
+	defer span.Finish()
+	if readYarnLock().Version == 1 {
+		util.DieUnimplemented("Yarn 1 cannot deduplicate packages; try 'npx yarn-deduplicate' and 'upm install'")
+	}
+	util.RunCmd([]string{"yarn", "dedupe"})
+}
@@ -0,0 +1,54 @@
+package nodejs
+
+import (
+	"context"
+	"os"
+
+	"github.com/replit/upm/internal/util"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+// npmFetch implements Fetch for npm, by adding the tarball of every
+// locked package to npm's cache, from which 'npm ci' takes them.
+func npmFetch(ctx context.Context) {
+	//nolint:ineffassign,wastedassign,staticcheck
+	span, ctx := tracer.StartSpanFromContext(ctx, "npm cache add")
+	defer span.Finish()
+	cmd := []string{"npm", "cache", "add"}
+	for _, artifact := range npmListLockfileArtifacts() {
+		cmd = append(cmd, artifact.URL)
+	}
+	if len(cmd) > 3 {
+		util.RunCmd(cmd)
+	}
+}
+
+// yarnFetch implements Fetch for Yarn 1, which has no command to fill
+// its cache: the packages are installed to a temporary directory
+// instead of node_modules, and the directory is removed. Yarn Berry
+// keeps its cache in the project, so there is nothing to separate.
+func yarnFetch(ctx context.Context) {
+	//nolint:ineffassign,wastedassign,staticcheck
+	span, ctx := tracer.StartSpanFromContext(ctx, "yarn install")
+	defer span.Finish()
+	if readYarnLock().Version != 1 {
+		util.DieUnimplemented("Yarn Berry keeps its cache in the project, so 'yarn install' fetches and installs at once")
+	}
+	dir, err := os.MkdirTemp("", "upm-fetch-")
+	if err != nil {
+		util.DieIO("%s", err)
+	}
+	defer os.RemoveAll(dir)
+	util.RunCmd(withProd([]string{
+		"yarn", "install", "--frozen-lockfile", "--ignore-scripts", "--modules-folder", dir,
+	}, "--production"))
+}
+
+// pnpmFetch implements Fetch for pnpm, whose 'pnpm fetch' is made for
+// this.
+func pnpmFetch(ctx context.Context) {
+	//nolint:ineffassign,wastedassign,staticcheck
+	span, ctx := tracer.StartSpanFromContext(ctx, "pnpm fetch")
+	defer span.Finish()
+	util.RunCmd(withProd([]string{"pnpm", "fetch"}, "--prod"))
+}
@@ -6,10 +6,9 @@ import (
 	"strings"
 
 	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/imports"
 	"github.com/replit/upm/internal/util"
-	"github.com/smacker/go-tree-sitter/javascript"
-	"github.com/smacker/go-tree-sitter/typescript/tsx"
-	"github.com/smacker/go-tree-sitter/typescript/typescript"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 )
 
@@ -76,47 +75,16 @@ func nodejsGuess(ctx context.Context) (map[string][]api.PkgName, bool) {
 func findImports(ctx context.Context, dir string) (map[string]bool, error) {
 	span, ctx := tracer.StartSpanFromContext(ctx, "nodejs.grab.findImports")
 	defer span.Finish()
-	importsQuery := `
-(import_statement
-  source: (string) @import)
-
-((call_expression
-     function: [(identifier) @function
-		            (import)]
-     arguments: (arguments . [(string) @import (template_string) @import] .))
- (#eq? @function "require"))
-`
 
 	foundImportPaths := map[string]bool{}
-
-	js := javascript.GetLanguage()
-	jsPkgs, err := util.GuessWithTreeSitter(ctx, dir, js, importsQuery, jsPathGlobs, nodeIgnorePathSegments)
-	if err != nil {
-		return nil, err
-	}
-	for _, pkg := range jsPkgs {
-		pkg = strings.Trim(pkg, "\"'`")
-		foundImportPaths[pkg] = true
-	}
-
-	ts := typescript.GetLanguage()
-	tsPkgs, err := util.GuessWithTreeSitter(ctx, dir, ts, importsQuery, tsPathGlobs, nodeIgnorePathSegments)
-	if err != nil {
-		return nil, err
-	}
-	for _, pkg := range tsPkgs {
-		pkg = strings.Trim(pkg, "\"'`")
-		foundImportPaths[pkg] = true
-	}
-
-	tsx := tsx.GetLanguage()
-	tsxPkgs, err := util.GuessWithTreeSitter(ctx, dir, tsx, importsQuery, tsxPathGlobs, nodeIgnorePathSegments)
-	if err != nil {
-		return nil, err
-	}
-	for _, pkg := range tsxPkgs {
-		pkg = strings.Trim(pkg, "\"'`")
-		foundImportPaths[pkg] = true
+	for _, lang := range []imports.Language{imports.JavaScript, imports.TypeScript, imports.TSX} {
+		found, err := imports.Find(ctx, dir, lang, nodeIgnorePathSegments)
+		if err != nil {
+			return nil, err
+		}
+		for pkg := range found {
+			foundImportPaths[pkg] = true
+		}
 	}
 
 	return foundImportPaths, nil
@@ -129,7 +97,7 @@ func filterImports(ctx context.Context, foundPaths map[string]bool) map[string][
 	pkgs := map[string][]api.PkgName{}
 
 	for mod := range foundPaths {
-		if mod == "" {
+		if mod == "" || config.IgnoresModule(mod) {
 			continue
 		}
 
@@ -148,7 +116,7 @@ func filterImports(ctx context.Context, foundPaths map[string]bool) map[string][
 		}
 
 		// Skip empty imports
-		if mod == "" {
+		if mod == "" || config.IgnoresModule(mod) {
 			continue
 		}
 
@@ -0,0 +1,54 @@
+package nodejs
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/util"
+)
+
+// invalidNameChars matches what npm does not allow in a package name.
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9._~-]+`)
+
+// defaultPackageName returns a package name based on the name of the
+// current directory, as 'npm init -y' does.
+func defaultPackageName() string {
+	wd, err := os.Getwd()
+	if err != nil {
+		util.DieIO("%s", err)
+	}
+	name := invalidNameChars.ReplaceAllString(strings.ToLower(filepath.Base(wd)), "-")
+	name = strings.TrimLeft(name, "._-")
+	if name == "" {
+		return "project"
+	}
+	return name
+}
+
+// nodejsInit implements Init for every Node.js backend by writing a
+// package.json with just the project's metadata, which all of them
+// accept. The package managers' own init commands cannot be told the
+// name, and some of them also create source files.
+func nodejsInit(ctx context.Context, meta api.ProjectMetadata) {
+	cfg := struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+		License string `json:"license,omitempty"`
+	}{meta.Name, meta.Version, meta.License}
+	if cfg.Name == "" {
+		cfg.Name = defaultPackageName()
+	}
+	if cfg.Version == "" {
+		cfg.Version = "1.0.0"
+	}
+	contentsB, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		panic("couldn't marshal json")
+	}
+	util.TryWriteAtomic("package.json", append(contentsB, '\n'))
+}
@@ -0,0 +1,79 @@
+package nodejs
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/util"
+)
+
+// nodejsListInstalled implements ListInstalled for every Node.js
+// backend by reading the package.json of each package at the top of
+// node_modules, which holds the direct dependencies and those hoisted
+// next to them (or, for pnpm, links to them).
+func nodejsListInstalled(pkgdir string) map[api.PkgName]api.PkgVersion {
+	pkgs := map[api.PkgName]api.PkgVersion{}
+	entries, err := os.ReadDir(pkgdir)
+	if os.IsNotExist(err) {
+		return pkgs
+	} else if err != nil {
+		util.DieIO("%s", err)
+	}
+
+	dirs := []string{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		if !strings.HasPrefix(name, "@") {
+			dirs = append(dirs, name)
+			continue
+		}
+		scoped, err := os.ReadDir(filepath.Join(pkgdir, name))
+		if err != nil {
+			continue
+		}
+		for _, entry := range scoped {
+			dirs = append(dirs, name+"/"+entry.Name())
+		}
+	}
+
+	for _, name := range dirs {
+		contentsB, err := os.ReadFile(filepath.Join(pkgdir, filepath.FromSlash(name), "package.json"))
+		if err != nil {
+			continue
+		}
+		var cfg struct {
+			Version string `json:"version"`
+		}
+		if err := json.Unmarshal(contentsB, &cfg); err != nil {
+			continue
+		}
+		pkgs[api.PkgName(name)] = api.PkgVersion(cfg.Version)
+	}
+	return pkgs
+}
+
+// nodejsInstalledSizes implements InstalledSizes for every Node.js
+// backend. The size of a package includes the packages nested in its
+// own node_modules, which only it uses. For pnpm, whose node_modules
+// links to its store, the linked directory is measured.
+func nodejsInstalledSizes(pkgdir string) map[api.PkgName]int64 {
+	sizes := map[api.PkgName]int64{}
+	for name := range nodejsListInstalled(pkgdir) {
+		dir, err := filepath.EvalSymlinks(filepath.Join(pkgdir, filepath.FromSlash(string(name))))
+		if err != nil {
+			util.DieIO("%s", err)
+		}
+		size, err := util.DirSize(dir)
+		if err != nil {
+			util.DieIO("%s", err)
+		}
+		sizes[name] = size
+	}
+	return sizes
+}
@@ -6,17 +6,20 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"net/url"
 	"os"
 	"os/exec"
+	"path"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/hashicorp/go-version"
 	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/config"
 	"github.com/replit/upm/internal/nix"
 	"github.com/replit/upm/internal/util"
+	"github.com/replit/upm/internal/versions"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 	"gopkg.in/yaml.v2"
 )
@@ -41,7 +44,11 @@ type npmSearchResults struct {
 				Username string `json:"username"`
 				Email    string `json:"email"`
 			} `json:"author"`
+			Date string `json:"date"`
 		} `json:"package"`
+		Downloads struct {
+			Monthly int64 `json:"monthly"`
+		} `json:"downloads"`
 	} `json:"objects"`
 }
 
@@ -67,6 +74,7 @@ type npmInfoResult struct {
 	Description string                 `json:"description"`
 	Homepage    string                 `json:"homepage"`
 	License     string                 `json:"license"`
+	Maintainers []packageJsonPerson    `json:"maintainers"`
 	Repository  packageJsonRepository  `json:"repository"`
 }
 
@@ -176,8 +184,11 @@ func (bugs *packageJsonBugs) UnmarshalJSON(data []byte) error {
 
 // packageJSON represents the relevant data in a package.json file.
 type packageJSON struct {
-	Dependencies    map[string]string `json:"dependencies"`
-	DevDependencies map[string]string `json:"devDependencies"`
+	Dependencies         map[string]string `json:"dependencies"`
+	DevDependencies      map[string]string `json:"devDependencies"`
+	OptionalDependencies map[string]string `json:"optionalDependencies"`
+	PeerDependencies     map[string]string `json:"peerDependencies"`
+	Scripts              map[string]string `json:"scripts"`
 }
 
 // packageLockJSON represents the relevant data in a package-lock.json
@@ -185,10 +196,20 @@ type packageJSON struct {
 type packageLockJSON struct {
 	LockfileVersion int `json:"lockfileVersion"`
 	Dependencies    map[string]struct {
-		Version string `json:"version"`
+		Version   string `json:"version"`
+		Resolved  string `json:"resolved"`
+		Integrity string `json:"integrity"`
 	} `json:"dependencies"`
 	Packages map[string]struct {
-		Version string `json:"version"`
+		Version              string            `json:"version"`
+		Resolved             string            `json:"resolved"`
+		Integrity            string            `json:"integrity"`
+		Dev                  bool              `json:"dev"`
+		Optional             bool              `json:"optional"`
+		Link                 bool              `json:"link"`
+		Dependencies         map[string]string `json:"dependencies"`
+		OptionalDependencies map[string]string `json:"optionalDependencies"`
+		PeerDependencies     map[string]string `json:"peerDependencies"`
 	} `json:"packages"`
 }
 
@@ -231,7 +252,7 @@ func nodejsSearch(query string) []api.PkgInfo {
 		}
 	}
 
-	endpoint := "https://registry.npmjs.org/-/v1/search"
+	endpoint := npmRegistry() + "/-/v1/search"
 	queryParams := "?text=" + url.QueryEscape(query)
 
 	resp, err := api.HttpClient.Get(endpoint + queryParams)
@@ -240,19 +261,20 @@ func nodejsSearch(query string) []api.PkgInfo {
 	}
 	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		util.DieProtocol("NPM registry: %s", err)
-	}
+	body := api.ReadResponse(resp)
 
 	var npmResults npmSearchResults
 	if err := json.Unmarshal(body, &npmResults); err != nil {
-		util.DieProtocol("NPM registry: %s", err)
+		util.DieProtocol("%s: %s", api.Endpoint(resp), err)
 	}
 
 	results := make([]api.PkgInfo, len(npmResults.Objects))
 	for i := range npmResults.Objects {
 		p := npmResults.Objects[i].Package
+		updated := p.Date
+		if t, err := time.Parse(time.RFC3339, p.Date); err == nil {
+			updated = t.Format("2006-01-02")
+		}
 		results[i] = api.PkgInfo{
 			Name:          p.Name,
 			Description:   p.Description,
@@ -264,14 +286,202 @@ func nodejsSearch(query string) []api.PkgInfo {
 				Name:  p.Author.Username,
 				Email: p.Author.Email,
 			}.String(),
+			Downloads: npmResults.Objects[i].Downloads.Monthly,
+			Updated:   updated,
+		}
+	}
+	return api.CheckSearchResults(api.Endpoint(resp), results)
+}
+
+// npmRegistry returns the base URL of the npm registry, which can be
+// overridden by the "npm" entry of [registries] in the config.
+func npmRegistry() string {
+	return strings.TrimSuffix(config.Registry("npm", "https://registry.npmjs.org"), "/")
+}
+
+// npmReleasesResult is the part of a package document from the NPM
+// registry that says when each version was published. The time of an
+// unpublished package is an object rather than a string.
+type npmReleasesResult struct {
+	Versions map[string]json.RawMessage `json:"versions"`
+	Time     map[string]json.RawMessage `json:"time"`
+}
+
+// fetchNpmDocument decodes the document of a package in the NPM
+// registry into result, and returns false if there is no such package.
+func fetchNpmDocument(name api.PkgName, result interface{}) bool {
+	return fetchNpm("/"+url.QueryEscape(string(name)), result)
+}
+
+// fetchNpmLatest decodes the manifest of the latest version of a
+// package in the NPM registry into result, and returns false if there
+// is no such package.
+func fetchNpmLatest(name api.PkgName, result interface{}) bool {
+	// The registry only serves the versions of scoped packages
+	// with the slash of the name unescaped.
+	segments := strings.SplitN(string(name), "/", 2)
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return fetchNpm("/"+strings.Join(segments, "/")+"/latest", result)
+}
+
+// fetchNpm decodes the response of the NPM registry to a GET of
+// resource into result, and returns false if there is no such resource.
+func fetchNpm(resource string, result interface{}) bool {
+	resp, err := api.HttpClient.Get(npmRegistry() + resource)
+	if err != nil {
+		util.DieNetwork("NPM registry: %s", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case 200:
+		break
+	case 404:
+		return false
+	default:
+		util.DieNetwork("NPM registry: HTTP status %d", resp.StatusCode)
+	}
+
+	body := api.ReadResponse(resp)
+	if err := json.Unmarshal(body, result); err != nil {
+		util.DieProtocol("%s: %s", api.Endpoint(resp), err)
+	}
+	return true
+}
+
+// fetchNpmReleases returns the versions of a package in the NPM
+// registry, and false if there is no such package.
+func fetchNpmReleases(name api.PkgName) (npmReleasesResult, bool) {
+	var result npmReleasesResult
+	ok := fetchNpmDocument(name, &result)
+	return result, ok
+}
+
+// nodejsReleases implements ListReleases for the Node.js backends.
+func nodejsReleases(name api.PkgName) []api.Release {
+	result, ok := fetchNpmReleases(name)
+	if !ok {
+		return nil
+	}
+
+	releases := []api.Release{}
+	for version := range result.Versions {
+		var published time.Time
+		if err := json.Unmarshal(result.Time[version], &published); err != nil {
+			continue
+		}
+		releases = append(releases, api.Release{Version: api.PkgVersion(version), Published: published})
+	}
+	return releases
+}
+
+// typesPackageName returns the package on DefinitelyTyped that would
+// declare the types of a package, as in "@types/babel__core" for
+// "@babel/core".
+func typesPackageName(name api.PkgName) api.PkgName {
+	return api.PkgName("@types/" + strings.Replace(strings.TrimPrefix(string(name), "@"), "/", "__", 1))
+}
+
+// nodejsTypeCompanions implements TypeCompanions for the Node.js
+// backends. It only suggests packages in projects with a
+// tsconfig.json, for packages that do not declare their own types,
+// and leaves out the packages on DefinitelyTyped that are deprecated,
+// which is how it retires them once the package brings its own.
+func nodejsTypeCompanions(pkgs []api.PkgName) map[api.PkgName]api.PkgName {
+	companions := map[api.PkgName]api.PkgName{}
+	if !util.Exists("tsconfig.json") {
+		return companions
+	}
+	for _, pkg := range pkgs {
+		if strings.HasPrefix(string(pkg), "@types/") {
+			continue
+		}
+		var manifest struct {
+			Types   string          `json:"types"`
+			Typings string          `json:"typings"`
+			Exports json.RawMessage `json:"exports"`
+		}
+		if !fetchNpmLatest(pkg, &manifest) {
+			continue
+		}
+		if manifest.Types != "" || manifest.Typings != "" || strings.Contains(string(manifest.Exports), `"types"`) {
+			continue
+		}
+		types := typesPackageName(pkg)
+		var typesManifest struct {
+			Deprecated interface{} `json:"deprecated"`
+		}
+		if !fetchNpmLatest(types, &typesManifest) {
+			continue
+		}
+		if deprecated, ok := typesManifest.Deprecated.(string); ok && deprecated != "" {
+			continue
+		}
+		companions[pkg] = types
+	}
+	return companions
+}
+
+// nodejsReadme implements FetchReadme for the Node.js backends. The
+// registry keeps the readme of the latest version, from the file named
+// by readmeFilename, and a placeholder if there was none.
+func nodejsReadme(name api.PkgName) api.Readme {
+	var result struct {
+		Readme         string `json:"readme"`
+		ReadmeFilename string `json:"readmeFilename"`
+	}
+	if !fetchNpmDocument(name, &result) || strings.HasPrefix(result.Readme, "ERROR: No README data found") {
+		return api.Readme{}
+	}
+	format := api.ReadmeMarkdown
+	switch strings.ToLower(path.Ext(result.ReadmeFilename)) {
+	case "", ".md", ".markdown":
+	case ".rst":
+		format = api.ReadmeRST
+	default:
+		format = api.ReadmeText
+	}
+	return api.Readme{Text: result.Readme, Format: format}
+}
+
+// nodejsDeprecated implements ListDeprecated for the Node.js backends.
+// npm has no yanking: versions are deprecated with a message, which
+// 'npm deprecate' sets for every version to deprecate a package.
+func nodejsDeprecated(name api.PkgName) map[api.PkgVersion]api.Deprecation {
+	result, ok := fetchNpmReleases(name)
+	if !ok {
+		return nil
+	}
+
+	deprecated := map[api.PkgVersion]api.Deprecation{}
+	for version, manifest := range result.Versions {
+		// A version is undeprecated by setting the message to
+		// the empty string, and some old ones have false.
+		var fields struct {
+			Deprecated interface{} `json:"deprecated"`
+		}
+		if err := json.Unmarshal(manifest, &fields); err != nil {
+			continue
+		}
+		switch message := fields.Deprecated.(type) {
+		case string:
+			if message != "" {
+				deprecated[api.PkgVersion(version)] = api.Deprecation{Reason: message}
+			}
+		case bool:
+			if message {
+				deprecated[api.PkgVersion(version)] = api.Deprecation{}
+			}
 		}
 	}
-	return results
+	return deprecated
 }
 
 // nodejsInfo implements Info for nodejs-yarn, nodejs-pnpm and nodejs-npm.
 func nodejsInfo(name api.PkgName) api.PkgInfo {
-	endpoint := "https://registry.npmjs.org"
+	endpoint := npmRegistry()
 	path := "/" + url.QueryEscape(string(name))
 
 	resp, err := api.HttpClient.Get(endpoint + path)
@@ -289,14 +499,11 @@ func nodejsInfo(name api.PkgName) api.PkgInfo {
 		util.DieNetwork("NPM registry: HTTP status %d", resp.StatusCode)
 	}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		util.DieProtocol("NPM registry: could not read response: %s", err)
-	}
+	body := api.ReadResponse(resp)
 
 	var npmInfo npmInfoResult
 	if err := json.Unmarshal(body, &npmInfo); err != nil {
-		util.DieProtocol("NPM registry: %s", err)
+		util.DieProtocol("%s: %s", api.Endpoint(resp), err)
 	}
 
 	lastVersionStr := ""
@@ -321,7 +528,22 @@ func nodejsInfo(name api.PkgName) api.PkgInfo {
 		}
 	}
 
-	return api.PkgInfo{
+	maintainers := []string{}
+	for _, maintainer := range npmInfo.Maintainers {
+		if name := strings.TrimSpace(maintainer.Name); name != "" {
+			maintainers = append(maintainers, name)
+		}
+	}
+
+	// The time of the release is in the same document.
+	var npmReleases npmReleasesResult
+	updated := ""
+	var published time.Time
+	if json.Unmarshal(body, &npmReleases) == nil && json.Unmarshal(npmReleases.Time[lastVersionStr], &published) == nil {
+		updated = published.UTC().Format("2006-01-02")
+	}
+
+	return api.CheckInfo(api.Endpoint(resp), api.PkgInfo{
 		Name:          npmInfo.Name,
 		Description:   npmInfo.Description,
 		Version:       lastVersionStr,
@@ -333,13 +555,64 @@ func nodejsInfo(name api.PkgName) api.PkgInfo {
 			Email: npmInfo.Author.Email,
 			URL:   npmInfo.Author.URL,
 		}.String(),
-		License: npmInfo.License,
+		Maintainers: maintainers,
+		License:     npmInfo.License,
+		Updated:     updated,
+	})
+}
+
+// npmStatsRegistry returns the base URL of the npm download counts
+// API, which can be overridden by the "npmstats" entry of [registries]
+// in the config.
+func npmStatsRegistry() string {
+	return strings.TrimSuffix(config.Registry("npmstats", "https://api.npmjs.org"), "/")
+}
+
+// npmRecentDownloads returns the number of downloads of a package in
+// the last month.
+func npmRecentDownloads(name string) (int64, error) {
+	endpoint := fmt.Sprintf("%s/downloads/point/last-month/%s", npmStatsRegistry(), name)
+	resp, err := api.HttpClient.Get(endpoint)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return 0, fmt.Errorf("Request to %s failed with %s", endpoint, resp.Status)
+	}
+	var stats struct {
+		Downloads int64 `json:"downloads"`
+	}
+	if err := json.Unmarshal(api.ReadResponse(resp), &stats); err != nil {
+		return 0, err
+	}
+	return stats.Downloads, nil
+}
+
+// nodejsAnnotateSearch implements AnnotateSearch for nodejs-yarn,
+// nodejs-pnpm and nodejs-npm. Search results have everything needed to
+// rank them, but those found by Info, as for one-character queries,
+// have no download count.
+func nodejsAnnotateSearch(results []api.PkgInfo, by api.SearchSort) {
+	if by != api.SortDownloads {
+		return
+	}
+	for i := range results {
+		if results[i].Downloads != 0 {
+			continue
+		}
+		downloads, err := npmRecentDownloads(results[i].Name)
+		if err != nil {
+			util.Verbosef("no download count for %s: %s", results[i].Name, err)
+			continue
+		}
+		results[i].Downloads = downloads
 	}
 }
 
 // nodejsListSpecfile implements ListSpecfile for nodejs-yarn, nodejs-pnpm and
 // nodejs-npm.
-func nodejsListSpecfile(mergeAllGroups bool) map[api.PkgName]api.PkgSpec {
+func nodejsListSpecfile(mergeAllGroups bool) api.PkgDeps {
 	contentsB, err := os.ReadFile("package.json")
 	if err != nil {
 		util.DieIO("package.json: %s", err)
@@ -348,16 +621,184 @@ func nodejsListSpecfile(mergeAllGroups bool) map[api.PkgName]api.PkgSpec {
 	if err := json.Unmarshal(contentsB, &cfg); err != nil {
 		util.DieProtocol("package.json: %s", err)
 	}
-	pkgs := map[api.PkgName]api.PkgSpec{}
+	pkgs := api.PkgDeps{}
 	for nameStr, specStr := range cfg.Dependencies {
-		pkgs[api.PkgName(nameStr)] = api.PkgSpec(specStr)
+		pkgs[api.PkgName(nameStr)] = api.PkgDep{Spec: api.PkgSpec(specStr)}
 	}
 	for nameStr, specStr := range cfg.DevDependencies {
-		pkgs[api.PkgName(nameStr)] = api.PkgSpec(specStr)
+		pkgs[api.PkgName(nameStr)] = api.PkgDep{Spec: api.PkgSpec(specStr), Dev: true}
+	}
+	if mergeAllGroups {
+		for nameStr, specStr := range cfg.OptionalDependencies {
+			pkgs[api.PkgName(nameStr)] = api.PkgDep{Spec: api.PkgSpec(specStr), Group: "optional"}
+		}
+		for nameStr, specStr := range cfg.PeerDependencies {
+			pkgs[api.PkgName(nameStr)] = api.PkgDep{Spec: api.PkgSpec(specStr), Group: "peer"}
+		}
 	}
 	return pkgs
 }
 
+// yarnAddFlags are the section flags of 'yarn add' and 'bun add'.
+var yarnAddFlags = map[string]string{
+	"dev":      "--dev",
+	"optional": "--optional",
+	"peer":     "--peer",
+}
+
+// npmAddFlags are the section flags of 'npm install' and 'pnpm add'.
+var npmAddFlags = map[string]string{
+	"dev":      "--save-dev",
+	"optional": "--save-optional",
+	"peer":     "--save-peer",
+}
+
+// nodejsAddFlags returns the flags that make a package manager add
+// packages to the section of package.json selected by --dev or
+// --group. flags maps "dev", "optional" and "peer" to the package
+// manager's flag for each section.
+func nodejsAddFlags(flags map[string]string) []string {
+	section := config.Group
+	if config.Dev {
+		section = "dev"
+	}
+	if section == "" {
+		return nil
+	}
+	flag, ok := flags[section]
+	if !ok {
+		util.DieConsistency(`unsupported group %#v (must be "optional" or "peer")`, section)
+	}
+	return []string{flag}
+}
+
+// nodejsMatchesSpec implements MatchesSpec for the Node.js backends.
+func nodejsMatchesSpec(spec api.PkgSpec, version api.PkgVersion) (bool, error) {
+	return versions.MatchesSemverRange(string(spec), string(version))
+}
+
+// looksLikeRange matches specs that start like a semver range rather
+// than a dist-tag, URL, path or alias.
+var looksLikeRange = regexp.MustCompile(`^\s*(?:[<>=~^*]|[0-9])`)
+
+// nodejsSpecSyntax is SpecSyntax for the Node.js backends.
+const nodejsSpecSyntax = `a semver range, e.g. "^1.2.3" or ">=1.0 <2"`
+
+// nodejsValidateSpec implements ValidateSpec for the Node.js
+// backends. Dist-tags, URLs, paths and npm: aliases are left for the
+// package manager to judge.
+func nodejsValidateSpec(spec api.PkgSpec) error {
+	if !looksLikeRange.MatchString(string(spec)) {
+		return nil
+	}
+	_, err := versions.ParseSemverRange(string(spec))
+	return err
+}
+
+// npmNameChars matches the characters that npm allows in package
+// names and scopes: those that need no escaping in a URL.
+var npmNameChars = regexp.MustCompile(`^[A-Za-z0-9._~!'()*-]+$`)
+
+// nodejsValidatePackageName implements ValidatePackageName for the
+// Node.js backends, following the rules of npm's
+// validate-npm-package-name for existing packages. Uppercase letters
+// are allowed, since some old packages have them.
+func nodejsValidatePackageName(name api.PkgName) error {
+	nameStr := string(name)
+	if len(nameStr) > 214 {
+		return errors.New("package names can be no longer than 214 characters")
+	}
+	bare := nameStr
+	if strings.HasPrefix(nameStr, "@") {
+		scope, rest, ok := strings.Cut(nameStr[1:], "/")
+		if !ok || scope == "" || rest == "" || !npmNameChars.MatchString(scope) {
+			return errors.New(`scoped package names must look like "@scope/name"`)
+		}
+		bare = rest
+	}
+	switch {
+	case bare == "":
+		return errors.New("package names cannot be empty")
+	case strings.HasPrefix(bare, ".") || strings.HasPrefix(bare, "_"):
+		return errors.New(`package names cannot start with "." or "_"`)
+	case !npmNameChars.MatchString(bare):
+		return errors.New("package names can only contain URL-friendly characters")
+	case strings.EqualFold(bare, "node_modules") || strings.EqualFold(bare, "favicon.ico"):
+		return fmt.Errorf("%s is a reserved name", bare)
+	}
+	return nil
+}
+
+// nodejsSpecForSource implements SpecForSource for the Node.js
+// backends, using the git URLs, tarball URLs and file: paths that
+// package.json understands.
+func nodejsSpecForSource(name api.PkgName, source api.PkgSource) (api.PkgSpec, error) {
+	switch source.Kind {
+	case api.SourceGit:
+		spec := source.Location
+		if strings.HasPrefix(spec, "git@") {
+			spec = "ssh://" + spec
+		}
+		if !strings.HasPrefix(spec, "git://") {
+			spec = "git+" + spec
+		}
+		if source.Ref != "" {
+			spec += "#" + source.Ref
+		}
+		return api.PkgSpec(spec), nil
+	case api.SourcePath:
+		return api.PkgSpec("file:" + strings.TrimPrefix(source.Location, "file:")), nil
+	default:
+		return api.PkgSpec(source.Location), nil
+	}
+}
+
+// hostedGitPrefixes maps the shorthands for hosted git repositories in
+// package.json to the URLs they stand for.
+var hostedGitPrefixes = map[string]string{
+	"github:":    "https://github.com/",
+	"gitlab:":    "https://gitlab.com/",
+	"bitbucket:": "https://bitbucket.org/",
+}
+
+// nodejsSourceOfSpec implements SourceOfSpec for the Node.js backends.
+// Besides URLs and file: paths, it understands hosted git shorthands
+// such as "github:user/repo#main" and the link: and portal: protocols
+// of Yarn.
+func nodejsSourceOfSpec(spec api.PkgSpec) (api.PkgSource, bool) {
+	str := strings.TrimSpace(string(spec))
+	for prefix, base := range hostedGitPrefixes {
+		if rest, ok := strings.CutPrefix(str, prefix); ok {
+			repo, ref, _ := strings.Cut(rest, "#")
+			return api.PkgSource{Kind: api.SourceGit, Location: base + repo, Ref: ref}, true
+		}
+	}
+	for _, prefix := range []string{"link:", "portal:"} {
+		if path, ok := strings.CutPrefix(str, prefix); ok {
+			return api.PkgSource{Kind: api.SourcePath, Location: path}, true
+		}
+	}
+	return api.DefaultSpecSource(spec)
+}
+
+// withProd appends flag to the install command cmd if only runtime
+// dependencies should be installed.
+func withProd(cmd []string, flag string) []string {
+	if config.Prod {
+		cmd = append(cmd, flag)
+	}
+	return cmd
+}
+
+// withFrozen appends flag to the install command cmd if the lockfile
+// must not be modified.
+func withFrozen(cmd []string, flag string) []string {
+	if config.Frozen {
+		cmd = append(cmd, flag)
+	}
+	return cmd
+}
+
 // nodejsGuessRegexps is the value of GuessRegexps for nodejs-yarn, nodejs-pnpm and
 // nodejs-npm.
 var nodejsGuessRegexps = util.Regexps([]string{
@@ -376,21 +817,6 @@ var nodeIgnorePathSegments = map[string]bool{
 	"node_modules": true,
 }
 
-var jsPathGlobs = []string{
-	"*.js",
-	"*.jsx",
-	"*.mjs",
-	"*.cjs",
-}
-
-var tsPathGlobs = []string{
-	"*.ts",
-}
-
-var tsxPathGlobs = []string{
-	"*.tsx",
-}
-
 func commonIsActive(lockfile string) bool {
 	_, err := os.Stat(lockfile)
 	return !os.IsNotExist(err)
@@ -402,6 +828,7 @@ var NodejsYarnBackend = api.LanguageBackend{
 	Specfile:         "package.json",
 	Lockfile:         "yarn.lock",
 	IsAvailable:      yarnIsAvailable,
+	Tools:            []string{"yarn", "node"},
 	IsActive: func() bool {
 		return commonIsActive("yarn.lock")
 	},
@@ -409,20 +836,42 @@ var NodejsYarnBackend = api.LanguageBackend{
 	Quirks: api.QuirksAddRemoveAlsoLocks |
 		api.QuirksAddRemoveAlsoInstalls |
 		api.QuirksLockAlsoInstalls |
-		api.QuirkRemoveNeedsLockfile,
+		api.QuirkRemoveNeedsLockfile |
+		api.QuirksAddRequiresInit,
 	GetPackageDir: func() string {
 		return "node_modules"
 	},
+	CacheDirs: cacheDirsFrom("yarn", "cache", "dir"),
+	ListInstalled: nodejsListInstalled,
+	InstalledSizes: nodejsInstalledSizes,
+	InstalledFiles: nodejsInstalledFiles,
+	ListScripts:   nodejsListScripts,
+	Init:          nodejsInit,
+	RunScript:     runScriptWith("yarn"),
 	Search: nodejsSearch,
+	AnnotateSearch: nodejsAnnotateSearch,
 	Info:   nodejsInfo,
+	ListReleases: nodejsReleases,
+	ListDeprecated: nodejsDeprecated,
+	FetchReadme:    nodejsReadme,
+	TypeCompanions: nodejsTypeCompanions,
+	CommandPackages: nodejsCommandPackages,
+	MatchesSpec:    nodejsMatchesSpec,
+	ValidateSpec:   nodejsValidateSpec,
+	SpecSyntax:     nodejsSpecSyntax,
+	SpecForSource:  nodejsSpecForSource,
+	SourceOfSpec:   nodejsSourceOfSpec,
+	PinSpec:        nodejsPinSpec,
+	SetSpecs:       nodejsSetSpecs,
+	SetOverride:    nodejsSetOverride("resolutions"),
+	ValidatePackageName: nodejsValidatePackageName,
+	SupportsDev:    true,
+	SupportsGroups: true,
 	Add: func(ctx context.Context, pkgs map[api.PkgName]api.PkgSpec, projectName string) {
 		//nolint:ineffassign,wastedassign,staticcheck
 		span, ctx := tracer.StartSpanFromContext(ctx, "yarn (init) add")
 		defer span.Finish()
-		if !util.Exists("package.json") {
-			util.RunCmd([]string{"yarn", "init", "-y"})
-		}
-		cmd := []string{"yarn", "add"}
+		cmd := append([]string{"yarn", "add"}, nodejsAddFlags(yarnAddFlags)...)
 		for name, spec := range pkgs {
 			name := string(name)
 			if found, ok := moduleToYarnpkgPackageAliases[name]; ok {
@@ -455,28 +904,22 @@ var NodejsYarnBackend = api.LanguageBackend{
 		defer span.Finish()
 		util.RunCmd([]string{"yarn", "install"})
 	},
+	Relock: yarnRelock,
+	LockInputs: []string{".npmrc", ".yarnrc", ".yarnrc.yml", ".yarn/releases", ".yarn/plugins", ".yarn/patches"},
 	Install: func(ctx context.Context) {
 		//nolint:ineffassign,wastedassign,staticcheck
 		span, ctx := tracer.StartSpanFromContext(ctx, "yarn install")
 		defer span.Finish()
-		util.RunCmd([]string{"yarn", "install"})
+		util.RunCmd(withFrozen(withProd([]string{"yarn", "install"}, "--production"), "--frozen-lockfile"))
 	},
+	Fetch: yarnFetch,
 	ListSpecfile: nodejsListSpecfile,
-	ListLockfile: func() map[api.PkgName]api.PkgVersion {
-		contentsB, err := os.ReadFile("yarn.lock")
-		if err != nil {
-			util.DieIO("yarn.lock: %s", err)
-		}
-		contents := string(contentsB)
-		r := regexp.MustCompile(`(?m)^"?((?:@[^@ \n]+\/)?[^@ \n]+).+:\n  version "(.+)"$`)
-		pkgs := map[api.PkgName]api.PkgVersion{}
-		for _, match := range r.FindAllStringSubmatch(contents, -1) {
-			name := api.PkgName(match[1])
-			version := api.PkgVersion(match[2])
-			pkgs[name] = version
-		}
-		return pkgs
-	},
+	ListLockfile: yarnListLockfile,
+	ListLockfileGraph: yarnListLockfileGraph,
+	ListLockfileCopies: yarnListLockfileCopies,
+	Dedupe: yarnDedupe,
+	ListLockfileHashes: yarnListLockfileHashes,
+	ListLockfileArtifacts: yarnListLockfileArtifacts,
 	// https://developer.mozilla.org/en-US/docs/Web/JavaScript/Reference/Statements/import
 	GuessRegexps:                       nodejsGuessRegexps,
 	Guess:                              nodejsGuess,
@@ -489,26 +932,49 @@ var NodejsPNPMBackend = api.LanguageBackend{
 	Specfile:         "package.json",
 	Lockfile:         "pnpm-lock.yaml",
 	IsAvailable:      pnpmIsAvailable,
+	Tools:            []string{"pnpm", "node"},
 	IsActive: func() bool {
 		return commonIsActive("pnpm-lock.yaml")
 	},
 	FilenamePatterns: nodejsPatterns,
 	Quirks: api.QuirksAddRemoveAlsoLocks |
 		api.QuirksAddRemoveAlsoInstalls |
-		api.QuirksLockAlsoInstalls,
+		api.QuirksLockAlsoInstalls |
+		api.QuirksAddRequiresInit,
 	GetPackageDir: func() string {
 		return "node_modules"
 	},
+	CacheDirs: cacheDirsFrom("pnpm", "store", "path"),
+	ListInstalled: nodejsListInstalled,
+	InstalledSizes: nodejsInstalledSizes,
+	InstalledFiles: nodejsInstalledFiles,
+	ListScripts:   nodejsListScripts,
+	Init:          nodejsInit,
+	RunScript:     runScriptWith("pnpm"),
 	Search: nodejsSearch,
+	AnnotateSearch: nodejsAnnotateSearch,
 	Info:   nodejsInfo,
+	ListReleases: nodejsReleases,
+	ListDeprecated: nodejsDeprecated,
+	FetchReadme:    nodejsReadme,
+	TypeCompanions: nodejsTypeCompanions,
+	CommandPackages: nodejsCommandPackages,
+	MatchesSpec:    nodejsMatchesSpec,
+	ValidateSpec:   nodejsValidateSpec,
+	SpecSyntax:     nodejsSpecSyntax,
+	SpecForSource:  nodejsSpecForSource,
+	SourceOfSpec:   nodejsSourceOfSpec,
+	PinSpec:        nodejsPinSpec,
+	SetSpecs:       nodejsSetSpecs,
+	SetOverride:    nodejsSetOverride("pnpm", "overrides"),
+	ValidatePackageName: nodejsValidatePackageName,
+	SupportsDev:    true,
+	SupportsGroups: true,
 	Add: func(ctx context.Context, pkgs map[api.PkgName]api.PkgSpec, projectName string) {
 		//nolint:ineffassign,wastedassign,staticcheck
 		span, ctx := tracer.StartSpanFromContext(ctx, "pnpm (init) add")
 		defer span.Finish()
-		if !util.Exists("package.json") {
-			util.RunCmd([]string{"pnpm", "init"})
-		}
-		cmd := []string{"pnpm", "add"}
+		cmd := append([]string{"pnpm", "add"}, nodejsAddFlags(npmAddFlags)...)
 		for name, spec := range pkgs {
 			name := string(name)
 			if found, ok := moduleToNpmjsPackageAliases[name]; ok {
@@ -540,12 +1006,15 @@ var NodejsPNPMBackend = api.LanguageBackend{
 		defer span.Finish()
 		util.RunCmd([]string{"pnpm", "install"})
 	},
+	Relock: pnpmRelock,
+	LockInputs: []string{".npmrc", ".pnpmfile.cjs"},
 	Install: func(ctx context.Context) {
 		//nolint:ineffassign,wastedassign,staticcheck
 		span, ctx := tracer.StartSpanFromContext(ctx, "pnpm install")
 		defer span.Finish()
-		util.RunCmd([]string{"pnpm", "install"})
+		util.RunCmd(withFrozen(withProd([]string{"pnpm", "install"}, "--prod"), "--frozen-lockfile"))
 	},
+	Fetch: pnpmFetch,
 	ListSpecfile: nodejsListSpecfile,
 	ListLockfile: func() map[api.PkgName]api.PkgVersion {
 		lockfileBytes, err := os.ReadFile("pnpm-lock.yaml")
@@ -592,26 +1061,50 @@ var NodejsNPMBackend = api.LanguageBackend{
 	Specfile:         "package.json",
 	Lockfile:         "package-lock.json",
 	IsAvailable:      npmIsAvailable,
+	Tools:            []string{"npm", "node"},
 	IsActive: func() bool {
 		return commonIsActive("package-lock.json")
 	},
 	FilenamePatterns: nodejsPatterns,
 	Quirks: api.QuirksAddRemoveAlsoLocks |
 		api.QuirksAddRemoveAlsoInstalls |
-		api.QuirksLockAlsoInstalls,
+		api.QuirksLockAlsoInstalls |
+		api.QuirksAddRequiresInit,
 	GetPackageDir: func() string {
 		return "node_modules"
 	},
+	CacheDirs: npmCacheDirs,
+	ListInstalled: nodejsListInstalled,
+	InstalledSizes: nodejsInstalledSizes,
+	InstalledFiles: nodejsInstalledFiles,
+	SetupPatches: npmSetupPatches,
+	ListScripts:   nodejsListScripts,
+	Init:          nodejsInit,
+	RunScript:     runScriptWith("npm"),
 	Search: nodejsSearch,
+	AnnotateSearch: nodejsAnnotateSearch,
 	Info:   nodejsInfo,
+	ListReleases: nodejsReleases,
+	ListDeprecated: nodejsDeprecated,
+	FetchReadme:    nodejsReadme,
+	TypeCompanions: nodejsTypeCompanions,
+	CommandPackages: nodejsCommandPackages,
+	MatchesSpec:    nodejsMatchesSpec,
+	ValidateSpec:   nodejsValidateSpec,
+	SpecSyntax:     nodejsSpecSyntax,
+	SpecForSource:  nodejsSpecForSource,
+	SourceOfSpec:   nodejsSourceOfSpec,
+	PinSpec:        nodejsPinSpec,
+	SetSpecs:       nodejsSetSpecs,
+	SetOverride:    nodejsSetOverride("overrides"),
+	ValidatePackageName: nodejsValidatePackageName,
+	SupportsDev:    true,
+	SupportsGroups: true,
 	Add: func(ctx context.Context, pkgs map[api.PkgName]api.PkgSpec, projectName string) {
 		//nolint:ineffassign,wastedassign,staticcheck
 		span, ctx := tracer.StartSpanFromContext(ctx, "npm (init) install")
 		defer span.Finish()
-		if !util.Exists("package.json") {
-			util.RunCmd([]string{"npm", "init", "-y"})
-		}
-		cmd := []string{"npm", "install"}
+		cmd := append([]string{"npm", "install"}, nodejsAddFlags(npmAddFlags)...)
 		for name, spec := range pkgs {
 			name := string(name)
 			if found, ok := moduleToNpmjsPackageAliases[name]; ok {
@@ -643,12 +1136,15 @@ var NodejsNPMBackend = api.LanguageBackend{
 		defer span.Finish()
 		util.RunCmd([]string{"npm", "install"})
 	},
+	Relock: npmRelock,
+	LockInputs: []string{".npmrc"},
 	Install: func(ctx context.Context) {
 		//nolint:ineffassign,wastedassign,staticcheck
 		span, ctx := tracer.StartSpanFromContext(ctx, "npm ci")
 		defer span.Finish()
-		util.RunCmd([]string{"npm", "ci"})
+		util.RunCmd(withProd([]string{"npm", "ci"}, "--omit=dev"))
 	},
+	Fetch: npmFetch,
 	ListSpecfile: nodejsListSpecfile,
 	ListLockfile: func() map[api.PkgName]api.PkgVersion {
 		contentsB, err := os.ReadFile("package-lock.json")
@@ -666,12 +1162,49 @@ var NodejsNPMBackend = api.LanguageBackend{
 			}
 		} else {
 			for pathStr, data := range cfg.Packages {
+				// The "" entry is the project itself.
+				if pathStr == "" {
+					continue
+				}
 				nameStr := strings.TrimPrefix(pathStr, "node_modules/")
 				pkgs[api.PkgName(nameStr)] = api.PkgVersion(data.Version)
 			}
 		}
 		return pkgs
 	},
+	ListLockfileGraph: func() map[api.PkgName][]api.PkgName {
+		contentsB, err := os.ReadFile("package-lock.json")
+		if err != nil {
+			util.DieIO("package-lock.json: %s", err)
+		}
+		var cfg packageLockJSON
+		if err := json.Unmarshal(contentsB, &cfg); err != nil {
+			util.DieProtocol("package-lock.json: %s", err)
+		}
+		graph := map[api.PkgName][]api.PkgName{}
+		for pathStr, data := range cfg.Packages {
+			// The root project and workspaces are not keyed
+			// by a node_modules path.
+			idx := strings.LastIndex(pathStr, "node_modules/")
+			if idx < 0 {
+				continue
+			}
+			name := api.PkgName(pathStr[idx+len("node_modules/"):])
+			deps := graph[name]
+			for _, section := range []map[string]string{data.Dependencies, data.OptionalDependencies, data.PeerDependencies} {
+				for dep := range section {
+					deps = append(deps, api.PkgName(dep))
+				}
+			}
+			graph[name] = deps
+		}
+		return graph
+	},
+	ListLockfileCopies: npmListLockfileCopies,
+	Dedupe: npmDedupe,
+	ListLockfileHashes: npmListLockfileHashes,
+	ListLockfileArtifacts: npmListLockfileArtifacts,
+	VerifyInstalled:    npmVerifyInstalled,
 	// https://developer.mozilla.org/en-US/docs/Web/JavaScript/Reference/Statements/import
 	GuessRegexps:                       nodejsGuessRegexps,
 	Guess:                              nodejsGuess,
@@ -684,27 +1217,49 @@ var BunBackend = api.LanguageBackend{
 	Specfile:         "package.json",
 	Lockfile:         "bun.lockb",
 	IsAvailable:      bunIsAvailable,
+	Tools:            []string{"bun"},
 	IsActive: func() bool {
 		return commonIsActive("bun.lockb")
 	},
 	FilenamePatterns: nodejsPatterns,
 	Quirks: api.QuirksAddRemoveAlsoLocks |
 		api.QuirksAddRemoveAlsoInstalls |
-		api.QuirksLockAlsoInstalls,
+		api.QuirksLockAlsoInstalls |
+		api.QuirksAddRequiresInit,
 	GetPackageDir: func() string {
 		return "node_modules"
 	},
+	CacheDirs: cacheDirsFrom("bun", "pm", "cache"),
+	ListInstalled: nodejsListInstalled,
+	InstalledSizes: nodejsInstalledSizes,
+	InstalledFiles: nodejsInstalledFiles,
+	ListScripts:   nodejsListScripts,
+	Init:          nodejsInit,
+	RunScript:     runScriptWith("bun"),
 	Search: nodejsSearch,
+	AnnotateSearch: nodejsAnnotateSearch,
 	Info:   nodejsInfo,
+	ListReleases: nodejsReleases,
+	ListDeprecated: nodejsDeprecated,
+	FetchReadme:    nodejsReadme,
+	TypeCompanions: nodejsTypeCompanions,
+	CommandPackages: nodejsCommandPackages,
+	MatchesSpec:    nodejsMatchesSpec,
+	ValidateSpec:   nodejsValidateSpec,
+	SpecSyntax:     nodejsSpecSyntax,
+	SpecForSource:  nodejsSpecForSource,
+	SourceOfSpec:   nodejsSourceOfSpec,
+	PinSpec:        nodejsPinSpec,
+	SetSpecs:       nodejsSetSpecs,
+	SetOverride:    nodejsSetOverride("overrides"),
+	ValidatePackageName: nodejsValidatePackageName,
+	SupportsDev:    true,
+	SupportsGroups: true,
 	Add: func(ctx context.Context, pkgs map[api.PkgName]api.PkgSpec, projectName string) {
 		//nolint:ineffassign,wastedassign,staticcheck
 		span, ctx := tracer.StartSpanFromContext(ctx, "bun (init) add")
 		defer span.Finish()
-
-		if !util.Exists("package.json") {
-			util.RunCmd([]string{"bun", "init", "-y"})
-		}
-		cmd := []string{"bun", "add"}
+		cmd := append([]string{"bun", "add"}, nodejsAddFlags(yarnAddFlags)...)
 		for name, spec := range pkgs {
 			name := string(name)
 			if found, ok := moduleToNpmjsPackageAliases[name]; ok {
@@ -741,7 +1296,7 @@ var BunBackend = api.LanguageBackend{
 		//nolint:ineffassign,wastedassign,staticcheck
 		span, ctx := tracer.StartSpanFromContext(ctx, "bun install")
 		defer span.Finish()
-		util.RunCmd([]string{"bun", "install"})
+		util.RunCmd(withFrozen(withProd([]string{"bun", "install"}, "--production"), "--frozen-lockfile"))
 	},
 	ListSpecfile: nodejsListSpecfile,
 	ListLockfile: func() map[api.PkgName]api.PkgVersion {
@@ -2,10 +2,17 @@ package nodejs
 
 import (
 	"context"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/util"
 )
 
 type TestCase struct {
@@ -202,3 +209,335 @@ func verify(t *testing.T, tc TestCase, extension string) {
 		}
 	}
 }
+
+func TestNodejsAddFlags(t *testing.T) {
+	defer func() { config.Dev = false; config.Group = "" }()
+
+	for _, tc := range []struct {
+		dev      bool
+		group    string
+		expected []string
+	}{
+		{expected: nil},
+		{dev: true, expected: []string{"--save-dev"}},
+		{group: "optional", expected: []string{"--save-optional"}},
+		{group: "peer", expected: []string{"--save-peer"}},
+	} {
+		config.Dev = tc.dev
+		config.Group = tc.group
+		if got := nodejsAddFlags(npmAddFlags); !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("dev=%v group=%q: expected %v, got %v", tc.dev, tc.group, tc.expected, got)
+		}
+	}
+}
+
+func TestWithProd(t *testing.T) {
+	defer func() { config.Prod = false }()
+
+	if got := withProd([]string{"npm", "ci"}, "--omit=dev"); !reflect.DeepEqual(got, []string{"npm", "ci"}) {
+		t.Errorf("expected no flag without --prod, got %v", got)
+	}
+	config.Prod = true
+	if got := withProd([]string{"npm", "ci"}, "--omit=dev"); !reflect.DeepEqual(got, []string{"npm", "ci", "--omit=dev"}) {
+		t.Errorf("expected --omit=dev with --prod, got %v", got)
+	}
+}
+
+func TestNodejsValidatePackageName(t *testing.T) {
+	for name, valid := range map[api.PkgName]bool{
+		"express":                             true,
+		"@types/node":                         true,
+		"JSONStream":                          true,
+		"lodash.debounce":                     true,
+		"@types":                              false,
+		"@/node":                              false,
+		".hidden":                             false,
+		"_private":                            false,
+		"my package":                          false,
+		"node_modules":                        false,
+		"@scope/wh@t":                         false,
+		api.PkgName(strings.Repeat("a", 215)): false,
+	} {
+		if err := nodejsValidatePackageName(name); (err == nil) != valid {
+			t.Errorf("nodejsValidatePackageName(%q) = %v, expected valid=%v", name, err, valid)
+		}
+	}
+}
+
+func TestNodejsSources(t *testing.T) {
+	for arg, expected := range map[string]api.PkgSpec{
+		"git+https://github.com/user/repo#main": "git+https://github.com/user/repo#main",
+		"git@github.com:user/repo.git":          "git+ssh://git@github.com:user/repo.git",
+		"https://example.com/pkg-1.0.0.tgz":     "https://example.com/pkg-1.0.0.tgz",
+		"../lib":                                "file:../lib",
+		"file:../lib":                           "file:../lib",
+	} {
+		source, _ := api.ParseSource(arg)
+		if spec, err := nodejsSpecForSource(source.Name(), source); err != nil || spec != expected {
+			t.Errorf("nodejsSpecForSource(%q) = %q, %v, expected %q", arg, spec, err, expected)
+		}
+	}
+
+	for spec, expected := range map[api.PkgSpec]api.PkgSource{
+		"github:user/repo#main":                 {Kind: api.SourceGit, Location: "https://github.com/user/repo", Ref: "main"},
+		"git+https://github.com/user/repo#main": {Kind: api.SourceGit, Location: "https://github.com/user/repo", Ref: "main"},
+		"file:../lib":                           {Kind: api.SourcePath, Location: "file:../lib"},
+		"link:../lib":                           {Kind: api.SourcePath, Location: "../lib"},
+	} {
+		if source, ok := nodejsSourceOfSpec(spec); !ok || source != expected {
+			t.Errorf("nodejsSourceOfSpec(%q) = %+v, %v, expected %+v", spec, source, ok, expected)
+		}
+	}
+	if source, ok := nodejsSourceOfSpec("^4.18.2"); ok {
+		t.Errorf("nodejsSourceOfSpec(%q) = %+v, expected no source", "^4.18.2", source)
+	}
+}
+
+func TestNpmVerifyInstalled(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	for name, contents := range map[string]string{
+		"package-lock.json": `{"lockfileVersion": 3, "packages": {
+			"": {},
+			"node_modules/a": {"version": "1.0.0", "integrity": "sha512-AAA"},
+			"node_modules/b": {"version": "2.0.0", "integrity": "sha512-BBB"},
+			"node_modules/c": {"version": "1.0.0", "integrity": "sha512-CCC"},
+			"node_modules/a/node_modules/d": {"version": "3.0.0", "integrity": "sha512-DDD"},
+			"node_modules/t": {"version": "2.0.0", "dev": true},
+			"node_modules/w": {"resolved": "packages/w", "link": true}
+		}}`,
+		"node_modules/.package-lock.json": `{"lockfileVersion": 3, "packages": {
+			"node_modules/a": {"version": "1.0.0", "integrity": "sha512-XXX"},
+			"node_modules/a/node_modules/d": {"version": "3.0.0", "integrity": "sha512-DDD"}
+		}}`,
+		"node_modules/a/package.json":                `{"version": "1.0.0"}`,
+		"node_modules/b/package.json":                `{"version": "2.1.0"}`,
+		"node_modules/a/node_modules/d/package.json": `{"version": "3.0.0"}`,
+	} {
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := []api.IntegrityIssue{
+		{Kind: api.IntegrityHashMismatch, Name: "a", Path: filepath.Join("node_modules", "a"), Expected: "sha512-AAA", Actual: "sha512-XXX"},
+		{Kind: api.IntegrityWrongVersion, Name: "b", Path: filepath.Join("node_modules", "b"), Expected: "2.0.0", Actual: "2.1.0"},
+		{Kind: api.IntegrityNotInstalled, Name: "c", Path: filepath.Join("node_modules", "c"), Expected: "1.0.0"},
+	}
+	if issues := npmVerifyInstalled("node_modules"); !reflect.DeepEqual(issues, expected) {
+		t.Errorf("expected %+v, got %+v", expected, issues)
+	}
+
+	hashes := npmListLockfileHashes()
+	if !reflect.DeepEqual(hashes["a/node_modules/d"], []string{"sha512-DDD"}) || hashes["t"] != nil {
+		t.Errorf("unexpected hashes %+v", hashes)
+	}
+}
+
+func TestYarnListLockfileHashes(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	yarnLock := `# yarn lockfile v1
+
+
+"@babel/code-frame@^7.0.0", "@babel/code-frame@^7.22.13":
+  version "7.22.13"
+  resolved "https://registry.yarnpkg.com/@babel/code-frame/-/code-frame-7.22.13.tgz#e3c1c099402598483b7a8c46a721d1038803755e"
+  integrity sha512-XktuhWlJ5g+3TJXc5upd9Ks1HutSArik6jf2eAjYFyIOf4ej3RN+184cZbzDvbPnuTJIUhPKKJE3cIsYTiAT3w==
+
+left-pad@^1.3.0:
+  version "1.3.0"
+  resolved "https://registry.yarnpkg.com/left-pad/-/left-pad-1.3.0.tgz"
+
+react@18.2.0:
+  version "18.2.0"
+  integrity sha1-abc sha512-def
+`
+	if err := os.WriteFile("yarn.lock", []byte(yarnLock), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[api.PkgName][]string{
+		"@babel/code-frame": {"sha512-XktuhWlJ5g+3TJXc5upd9Ks1HutSArik6jf2eAjYFyIOf4ej3RN+184cZbzDvbPnuTJIUhPKKJE3cIsYTiAT3w=="},
+		"react":             {"sha1-abc", "sha512-def"},
+	}
+	if hashes := yarnListLockfileHashes(); !reflect.DeepEqual(hashes, expected) {
+		t.Errorf("expected %+v, got %+v", expected, hashes)
+	}
+}
+
+func TestNodejsInit(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "My Project")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	nodejsInit(context.Background(), api.ProjectMetadata{License: "MIT"})
+	contentsB, err := os.ReadFile("package.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "{\n  \"name\": \"my-project\",\n  \"version\": \"1.0.0\",\n  \"license\": \"MIT\"\n}\n"
+	if string(contentsB) != expected {
+		t.Errorf("expected %q, got %q", expected, contentsB)
+	}
+}
+
+func TestNodejsSetOverride(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	contents := "{\n  \"name\": \"x\",\n  \"pnpm\": {\n    \"overrides\": {\n      \"minimist\": \"1.2.6\"\n    }\n  }\n}\n"
+	if err := os.WriteFile("package.json", []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	setOverride := nodejsSetOverride("pnpm", "overrides")
+	setOverride("minimist", "^1.2.8")
+	setOverride("semver", "7.5.4")
+	contentsB, err := os.ReadFile("package.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "{\n  \"name\": \"x\",\n  \"pnpm\": {\n    \"overrides\": {\n      \"minimist\": \"^1.2.8\",\n      \"semver\": \"7.5.4\"\n    }\n  }\n}\n"
+	if string(contentsB) != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, contentsB)
+	}
+}
+
+func TestNpmSetupPatches(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	contents := "{\n  \"name\": \"x\",\n  \"scripts\": {\n    \"postinstall\": \"node setup.js\"\n  }\n}\n"
+	if err := os.WriteFile("package.json", []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Setting up twice changes nothing more.
+	npmSetupPatches(".upm/patches")
+	npmSetupPatches(".upm/patches")
+	contentsB, err := os.ReadFile("package.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "{\n  \"name\": \"x\",\n  \"scripts\": {\n    \"postinstall\": \"node setup.js && patch-package --patch-dir .upm/patches\"\n  },\n  \"devDependencies\": {\n    \"patch-package\": \"^8.0.0\"\n  }\n}\n"
+	if string(contentsB) != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, contentsB)
+	}
+}
+
+func TestNpmFetch(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	contents := `{
+  "lockfileVersion": 3,
+  "packages": {
+    "": {"name": "x"},
+    "node_modules/@types/node": {"version": "20.1.0", "resolved": "https://registry.npmjs.org/@types/node/-/node-20.1.0.tgz"},
+    "node_modules/a/node_modules/@types/node": {"version": "20.1.0", "resolved": "https://registry.npmjs.org/@types/node/-/node-20.1.0.tgz"},
+    "node_modules/b": {"version": "1.0.0", "resolved": "git+ssh://git@github.com/x/b.git#abc"},
+    "node_modules/c": {"resolved": "packages/c", "link": true}
+  }
+}
+`
+	if err := os.WriteFile("package-lock.json", []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmds := util.CaptureCmds(func() { npmFetch(context.Background()) })
+	expected := [][]string{{"npm", "cache", "add", "https://registry.npmjs.org/@types/node/-/node-20.1.0.tgz"}}
+	if !reflect.DeepEqual(cmds, expected) {
+		t.Errorf("expected %q, got %q", expected, cmds)
+	}
+}
+
+func TestNodejsTypeCompanions(t *testing.T) {
+	manifests := map[string]string{
+		"/lodash/latest":             `{"name": "lodash"}`,
+		"/@types/lodash/latest":      `{"name": "@types/lodash"}`,
+		"/axios/latest":              `{"name": "axios", "types": "index.d.ts"}`,
+		"/@babel/core/latest":        `{"name": "@babel/core"}`,
+		"/@types/babel__core/latest": `{"name": "@types/babel__core"}`,
+		"/chalk/latest":              `{"name": "chalk", "exports": {".": {"types": "./index.d.ts"}}}`,
+		"/moment/latest":             `{"name": "moment"}`,
+		"/@types/moment/latest":      `{"name": "@types/moment", "deprecated": "moment provides its own types"}`,
+		"/left-pad/latest":           `{"name": "left-pad"}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		manifest, ok := manifests[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(manifest))
+	}))
+	defer server.Close()
+	registries := config.Loaded.Registries
+	config.Loaded.Registries = map[string]string{"npm": server.URL}
+	defer func() { config.Loaded.Registries = registries }()
+
+	dir := t.TempDir()
+	cwd, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Chdir(cwd) }()
+
+	pkgs := []api.PkgName{"lodash", "axios", "@babel/core", "chalk", "moment", "left-pad", "@types/node"}
+	if companions := nodejsTypeCompanions(pkgs); len(companions) != 0 {
+		t.Errorf("expected no companions without a tsconfig.json, got %v", companions)
+	}
+	if err := os.WriteFile("tsconfig.json", []byte("{}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[api.PkgName]api.PkgName{
+		"lodash":      "@types/lodash",
+		"@babel/core": "@types/babel__core",
+	}
+	if companions := nodejsTypeCompanions(pkgs); !reflect.DeepEqual(companions, expected) {
+		t.Errorf("expected %v, got %v", expected, companions)
+	}
+}
@@ -0,0 +1,27 @@
+package nodejs
+
+import (
+	"os"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/specedit"
+	"github.com/replit/upm/internal/util"
+)
+
+// nodejsSetOverride returns an implementation of SetOverride that
+// records overrides in the object at path in package.json: "overrides"
+// for npm and Bun, "resolutions" for Yarn, and "pnpm.overrides" for
+// pnpm.
+func nodejsSetOverride(path ...string) func(name api.PkgName, spec api.PkgSpec) {
+	return func(name api.PkgName, spec api.PkgSpec) {
+		contentsB, err := os.ReadFile("package.json")
+		if err != nil {
+			util.DieIO("package.json: %s", err)
+		}
+		member := append(append([]string{}, path...), string(name))
+		if contentsB, err = specedit.SetJSON(contentsB, member, string(spec)); err != nil {
+			util.DieProtocol("package.json: %s", err)
+		}
+		util.TryWriteAtomic("package.json", contentsB)
+	}
+}
@@ -0,0 +1,99 @@
+package nodejs
+
+import (
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/specedit"
+	"github.com/replit/upm/internal/util"
+)
+
+// nodejsInstalledFiles implements InstalledFiles for every Node.js
+// backend, from the package's directory at the top of node_modules.
+// The packages nested in its own node_modules are left out.
+func nodejsInstalledFiles(pkgdir string, name api.PkgName) (api.InstalledPackage, bool) {
+	dir := filepath.Join(pkgdir, filepath.FromSlash(string(name)))
+	contentsB, err := os.ReadFile(filepath.Join(dir, "package.json"))
+	if err != nil {
+		return api.InstalledPackage{}, false
+	}
+	var cfg struct {
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal(contentsB, &cfg); err != nil {
+		util.DieProtocol("%s: %s", filepath.Join(dir, "package.json"), err)
+	}
+
+	// pnpm links packages into node_modules.
+	resolved, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		util.DieIO("%s", err)
+	}
+	files := []string{}
+	err = filepath.WalkDir(resolved, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == "node_modules" {
+			return filepath.SkipDir
+		}
+		if d.Type().IsRegular() {
+			rel, err := filepath.Rel(resolved, path)
+			if err != nil {
+				return err
+			}
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		util.DieIO("%s", err)
+	}
+	return api.InstalledPackage{Version: api.PkgVersion(cfg.Version), Dir: dir, Files: files}, true
+}
+
+// patchPackageSpec is the spec of patch-package that npmSetupPatches
+// adds to the development dependencies.
+const patchPackageSpec = "^8.0.0"
+
+// npmSetupPatches implements SetupPatches for npm with patch-package,
+// which the postinstall script runs after every npm install.
+func npmSetupPatches(dir string) {
+	contentsB, err := os.ReadFile("package.json")
+	if err != nil {
+		util.DieIO("package.json: %s", err)
+	}
+	var cfg struct {
+		Scripts         map[string]string `json:"scripts"`
+		Dependencies    map[string]string `json:"dependencies"`
+		DevDependencies map[string]string `json:"devDependencies"`
+	}
+	if err := json.Unmarshal(contentsB, &cfg); err != nil {
+		util.DieProtocol("package.json: %s", err)
+	}
+
+	command := "patch-package --patch-dir " + dir
+	postinstall := cfg.Scripts["postinstall"]
+	switch {
+	case postinstall == "":
+		contentsB, err = specedit.SetJSON(contentsB, []string{"scripts", "postinstall"}, command)
+	case !strings.Contains(postinstall, "patch-package"):
+		contentsB, err = specedit.SetJSON(contentsB, []string{"scripts", "postinstall"}, postinstall+" && "+command)
+	}
+	if err != nil {
+		util.DieProtocol("package.json: %s", err)
+	}
+	_, isDep := cfg.Dependencies["patch-package"]
+	_, isDevDep := cfg.DevDependencies["patch-package"]
+	if !isDep && !isDevDep {
+		contentsB, err = specedit.SetJSON(contentsB, []string{"devDependencies", "patch-package"}, patchPackageSpec)
+		if err != nil {
+			util.DieProtocol("package.json: %s", err)
+		}
+	}
+	util.TryWriteAtomic("package.json", contentsB)
+}
@@ -0,0 +1,59 @@
+package nodejs
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/specedit"
+	"github.com/replit/upm/internal/util"
+	"github.com/replit/upm/internal/versions"
+)
+
+// nodejsPinSpec implements PinSpec for the Node.js backends.
+func nodejsPinSpec(version api.PkgVersion, policy api.SpecPolicy) (api.PkgSpec, error) {
+	if _, err := versions.ParseSemver(string(version)); err != nil {
+		return "", err
+	}
+	switch policy {
+	case api.SpecExact:
+		return api.PkgSpec(version), nil
+	case api.SpecTilde:
+		return api.PkgSpec("~" + string(version)), nil
+	case api.SpecNone:
+		return "*", nil
+	}
+	return api.PkgSpec("^" + string(version)), nil
+}
+
+// packageJSONSections are the members of package.json that list
+// packages.
+var packageJSONSections = []string{"dependencies", "devDependencies", "optionalDependencies", "peerDependencies"}
+
+// nodejsSetSpecs implements SetSpecs for the Node.js backends, in every
+// section of package.json that lists each package.
+func nodejsSetSpecs(specs map[api.PkgName]api.PkgSpec) {
+	contentsB, err := os.ReadFile("package.json")
+	if err != nil {
+		util.DieIO("package.json: %s", err)
+	}
+	var sections map[string]json.RawMessage
+	if err := json.Unmarshal(contentsB, &sections); err != nil {
+		util.DieProtocol("package.json: %s", err)
+	}
+	for _, section := range packageJSONSections {
+		var deps map[string]string
+		if raw, ok := sections[section]; !ok || json.Unmarshal(raw, &deps) != nil {
+			continue
+		}
+		for name, spec := range specs {
+			if _, ok := deps[string(name)]; !ok {
+				continue
+			}
+			if contentsB, err = specedit.SetJSON(contentsB, []string{section, string(name)}, string(spec)); err != nil {
+				util.DieProtocol("package.json: %s", err)
+			}
+		}
+	}
+	util.TryWriteAtomic("package.json", contentsB)
+}
@@ -0,0 +1,38 @@
+package nodejs
+
+import (
+	"context"
+
+	"github.com/replit/upm/internal/util"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+// npmRelock implements Relock for npm.
+func npmRelock(ctx context.Context) {
+	//nolint:ineffassign,wastedassign,staticcheck
+	span, ctx := tracer.StartSpanFromContext(ctx, "npm install")
+	defer span.Finish()
+	util.RunCmd([]string{"npm", "install", "--package-lock-only", "--ignore-scripts"})
+}
+
+// yarnRelock implements Relock for Yarn. Yarn 1 cannot lock without
+// installing, which is harmless in the temporary directory that
+// Relock runs in.
+func yarnRelock(ctx context.Context) {
+	//nolint:ineffassign,wastedassign,staticcheck
+	span, ctx := tracer.StartSpanFromContext(ctx, "yarn install")
+	defer span.Finish()
+	if readYarnLock().Version == 1 {
+		util.RunCmd([]string{"yarn", "install", "--ignore-scripts"})
+		return
+	}
+	util.RunCmd([]string{"yarn", "install", "--mode=update-lockfile"})
+}
+
+// pnpmRelock implements Relock for pnpm.
+func pnpmRelock(ctx context.Context) {
+	//nolint:ineffassign,wastedassign,staticcheck
+	span, ctx := tracer.StartSpanFromContext(ctx, "pnpm install")
+	defer span.Finish()
+	util.RunCmd([]string{"pnpm", "install", "--lockfile-only", "--ignore-scripts"})
+}
@@ -0,0 +1,40 @@
+package nodejs
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/replit/upm/internal/util"
+)
+
+// nodejsListScripts implements ListScripts for every Node.js backend
+// by reading the scripts of package.json.
+func nodejsListScripts() map[string]string {
+	contentsB, err := os.ReadFile("package.json")
+	if err != nil {
+		util.DieIO("package.json: %s", err)
+	}
+	var cfg packageJSON
+	if err := json.Unmarshal(contentsB, &cfg); err != nil {
+		util.DieProtocol("package.json: %s", err)
+	}
+	scripts := map[string]string{}
+	for name, command := range cfg.Scripts {
+		scripts[name] = command
+	}
+	return scripts
+}
+
+// runScriptWith returns a RunScript implementation that runs scripts
+// with 'tool run'. npm needs "--" to pass options to the script
+// rather than take them itself; the other package managers pass on
+// everything after the script name.
+func runScriptWith(tool string) func(script string, args []string) []string {
+	return func(script string, args []string) []string {
+		cmd := []string{tool, "run", script}
+		if tool == "npm" && len(args) > 0 {
+			cmd = append(cmd, "--")
+		}
+		return append(cmd, args...)
+	}
+}
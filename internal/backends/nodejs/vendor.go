@@ -0,0 +1,101 @@
+package nodejs
+
+import (
+	"strings"
+
+	"github.com/replit/upm/internal/api"
+)
+
+// npmTarballName returns the name that npm pack gives the tarball of
+// the given version of the package name, as in "types-node-20.1.0.tgz"
+// for @types/node.
+func npmTarballName(name string, version string) string {
+	return strings.ReplaceAll(strings.TrimPrefix(name, "@"), "/", "-") + "-" + version + ".tgz"
+}
+
+// npmTarballURL returns the URL of the tarball of the given version of
+// the package name in the npm registry.
+func npmTarballURL(name string, version string) string {
+	base := name[strings.LastIndex(name, "/")+1:]
+	return npmRegistry() + "/" + name + "/-/" + base + "-" + version + ".tgz"
+}
+
+// isRegistryURL returns whether resolved, as recorded in a lockfile,
+// is the URL of a tarball rather than a git repository or a path.
+func isRegistryURL(resolved string) bool {
+	return strings.HasPrefix(resolved, "https://") || strings.HasPrefix(resolved, "http://")
+}
+
+// npmListLockfileArtifacts implements ListLockfileArtifacts for npm,
+// from the resolved URLs of package-lock.json.
+func npmListLockfileArtifacts() []api.Artifact {
+	cfg := mustReadPackageLock()
+	artifacts := []api.Artifact{}
+	seen := map[string]bool{}
+	add := func(name, version, resolved, integrity string) {
+		filename := npmTarballName(name, version)
+		if !isRegistryURL(resolved) || seen[filename] {
+			return
+		}
+		seen[filename] = true
+		artifacts = append(artifacts, api.Artifact{
+			Name:     api.PkgName(name),
+			Version:  api.PkgVersion(version),
+			URL:      resolved,
+			Filename: filename,
+			Hashes:   strings.Fields(integrity),
+		})
+	}
+	if cfg.LockfileVersion <= 1 {
+		for name, data := range cfg.Dependencies {
+			add(name, data.Version, data.Resolved, data.Integrity)
+		}
+		return artifacts
+	}
+	for pathStr, data := range cfg.Packages {
+		idx := strings.LastIndex(pathStr, "node_modules/")
+		if idx < 0 || data.Link {
+			continue
+		}
+		add(pathStr[idx+len("node_modules/"):], data.Version, data.Resolved, data.Integrity)
+	}
+	return artifacts
+}
+
+// yarnListLockfileArtifacts implements ListLockfileArtifacts for Yarn.
+// Yarn 1 records the URL of each tarball; for Yarn Berry, it is found
+// in the registry from the resolution, as in "lodash@npm:4.17.21".
+// Berry's checksums are of its own cache archives, not of tarballs,
+// so they cannot be checked.
+func yarnListLockfileArtifacts() []api.Artifact {
+	lock := readYarnLock()
+	artifacts := []api.Artifact{}
+	seen := map[string]bool{}
+	for _, pkg := range lock.Packages {
+		if pkg.Workspace {
+			continue
+		}
+		artifact := api.Artifact{Name: api.PkgName(pkg.Name), Version: api.PkgVersion(pkg.Version)}
+		if lock.Version == 1 {
+			resolved, _, _ := strings.Cut(pkg.Resolution, "#")
+			if !isRegistryURL(resolved) {
+				continue
+			}
+			artifact.URL = resolved
+			artifact.Hashes = pkg.Integrity
+		} else {
+			name := yarnDescriptorName(pkg.Resolution)
+			version, ok := strings.CutPrefix(pkg.Resolution[len(name):], "@npm:")
+			if !ok {
+				continue
+			}
+			artifact.URL = npmTarballURL(name, version)
+		}
+		artifact.Filename = npmTarballName(pkg.Name, pkg.Version)
+		if !seen[artifact.Filename] {
+			seen[artifact.Filename] = true
+			artifacts = append(artifacts, artifact)
+		}
+	}
+	return artifacts
+}
@@ -0,0 +1,163 @@
+package nodejs
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/util"
+)
+
+// readPackageLock parses package-lock.json, or a file of the same
+// format such as node_modules/.package-lock.json.
+func readPackageLock(path string) (packageLockJSON, error) {
+	var cfg packageLockJSON
+	contentsB, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	err = json.Unmarshal(contentsB, &cfg)
+	return cfg, err
+}
+
+// mustReadPackageLock parses package-lock.json, terminating the
+// process if it cannot be read.
+func mustReadPackageLock() packageLockJSON {
+	contentsB, err := os.ReadFile("package-lock.json")
+	if err != nil {
+		util.DieIO("package-lock.json: %s", err)
+	}
+	var cfg packageLockJSON
+	if err := json.Unmarshal(contentsB, &cfg); err != nil {
+		util.DieProtocol("package-lock.json: %s", err)
+	}
+	return cfg
+}
+
+// npmListLockfileHashes implements ListLockfileHashes for npm. An
+// integrity field may hold several space-separated hashes.
+func npmListLockfileHashes() map[api.PkgName][]string {
+	cfg := mustReadPackageLock()
+	hashes := map[api.PkgName][]string{}
+	if cfg.LockfileVersion <= 2 {
+		for nameStr, data := range cfg.Dependencies {
+			if data.Integrity != "" {
+				hashes[api.PkgName(nameStr)] = strings.Fields(data.Integrity)
+			}
+		}
+		return hashes
+	}
+	for pathStr, data := range cfg.Packages {
+		if pathStr == "" || data.Integrity == "" {
+			continue
+		}
+		nameStr := strings.TrimPrefix(pathStr, "node_modules/")
+		hashes[api.PkgName(nameStr)] = strings.Fields(data.Integrity)
+	}
+	return hashes
+}
+
+// npmVerifyInstalled implements VerifyInstalled for npm. npm does not
+// keep the tarballs it installs, but it writes the integrity hash of
+// each one to node_modules/.package-lock.json (or, before npm 7, to
+// the _integrity field of the installed package.json), which is
+// compared with the one in package-lock.json. Development and
+// optional packages may legitimately be missing, after 'upm install
+// --prod' or on another platform, so they are only checked if they
+// are installed.
+func npmVerifyInstalled(pkgdir string) []api.IntegrityIssue {
+	type lockedPackage struct {
+		version   string
+		integrity string
+		optional  bool
+	}
+	cfg := mustReadPackageLock()
+	locked := map[string]lockedPackage{}
+	if cfg.LockfileVersion < 2 {
+		for nameStr, data := range cfg.Dependencies {
+			locked["node_modules/"+nameStr] = lockedPackage{version: data.Version, integrity: data.Integrity}
+		}
+	} else {
+		for pathStr, data := range cfg.Packages {
+			// The root project and workspaces are not keyed
+			// by a node_modules path, and links point at
+			// them.
+			if !strings.HasPrefix(pathStr, "node_modules/") || data.Link {
+				continue
+			}
+			locked[pathStr] = lockedPackage{
+				version:   data.Version,
+				integrity: data.Integrity,
+				optional:  data.Dev || data.Optional,
+			}
+		}
+	}
+
+	hidden, err := readPackageLock(filepath.Join(pkgdir, ".package-lock.json"))
+	if err != nil && !os.IsNotExist(err) {
+		util.DieProtocol("%s: %s", filepath.Join(pkgdir, ".package-lock.json"), err)
+	}
+
+	paths := []string{}
+	for pathStr := range locked {
+		paths = append(paths, pathStr)
+	}
+	sort.Strings(paths)
+
+	issues := []api.IntegrityIssue{}
+	for _, pathStr := range paths {
+		pkg := locked[pathStr]
+		name := strings.TrimPrefix(pathStr, "node_modules/")
+		dir := filepath.Join(pkgdir, filepath.FromSlash(name))
+		var installed struct {
+			Version   string `json:"version"`
+			Integrity string `json:"_integrity"`
+		}
+		contentsB, err := os.ReadFile(filepath.Join(dir, "package.json"))
+		if os.IsNotExist(err) {
+			if !pkg.optional {
+				issues = append(issues, api.IntegrityIssue{
+					Kind:     api.IntegrityNotInstalled,
+					Name:     name,
+					Path:     dir,
+					Expected: pkg.version,
+				})
+			}
+			continue
+		} else if err != nil {
+			util.DieIO("%s", err)
+		}
+		if err := json.Unmarshal(contentsB, &installed); err != nil {
+			util.DieProtocol("%s: %s", filepath.Join(dir, "package.json"), err)
+		}
+
+		if pkg.version != "" && installed.Version != pkg.version {
+			issues = append(issues, api.IntegrityIssue{
+				Kind:     api.IntegrityWrongVersion,
+				Name:     name,
+				Path:     dir,
+				Expected: pkg.version,
+				Actual:   installed.Version,
+			})
+			continue
+		}
+
+		integrity := installed.Integrity
+		if data, ok := hidden.Packages[pathStr]; ok {
+			integrity = data.Integrity
+		}
+		if pkg.integrity != "" && integrity != "" && integrity != pkg.integrity {
+			issues = append(issues, api.IntegrityIssue{
+				Kind:     api.IntegrityHashMismatch,
+				Name:     name,
+				Path:     dir,
+				Expected: pkg.integrity,
+				Actual:   integrity,
+			})
+		}
+	}
+	return issues
+}
@@ -0,0 +1,303 @@
+package nodejs
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/util"
+)
+
+// yarnLockPackage is one entry of a yarn.lock, which may resolve
+// several descriptors of the same package.
+type yarnLockPackage struct {
+	// Descriptors are the specs that resolve to this entry, as in
+	// "lodash@^4.17.0" or, for Yarn Berry, "lodash@npm:^4.17.0".
+	Descriptors []string
+
+	// Name is the package name of the first descriptor. For an
+	// alias such as "lodash4@npm:lodash@^4" it is the alias,
+	// which is the name the project depends on.
+	Name string
+
+	Version string
+
+	// Resolution is where the package was resolved to: the
+	// resolved URL for Yarn 1, or the resolution locator, as in
+	// "lodash@npm:4.17.21", for Yarn Berry.
+	Resolution string
+
+	// Integrity holds the integrity hashes for Yarn 1, as in
+	// "sha512-...", or the checksum for Yarn Berry.
+	Integrity []string
+
+	// Dependencies maps the names of the dependencies of the
+	// package, including optional and peer dependencies, to their
+	// specs.
+	Dependencies map[string]string
+
+	// Workspace is true for the project itself and its workspaces
+	// in a Yarn Berry lockfile.
+	Workspace bool
+}
+
+// yarnLock is a parsed yarn.lock.
+type yarnLock struct {
+	// Version is 1 for a Yarn 1 lockfile, or the __metadata
+	// version of a Yarn Berry lockfile.
+	Version int
+
+	Packages []yarnLockPackage
+}
+
+// yarnLockLine is a line of a yarn.lock, split into its key and
+// value. Both formats nest by indentation: Yarn 1 writes "key value"
+// and Yarn Berry writes YAML "key: value". A key without a value
+// begins a nested block.
+type yarnLockLine struct {
+	number int
+	indent int
+	key    string
+	value  string
+}
+
+// readYarnLockString reads a double-quoted string at the start of s,
+// returning it and the rest of s.
+func readYarnLockString(s string) (string, string, error) {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			str, err := strconv.Unquote(s[:i+1])
+			return str, s[i+1:], err
+		}
+	}
+	return "", "", fmt.Errorf("unterminated string")
+}
+
+// parseYarnLockLine splits a line that is neither blank nor a comment.
+func parseYarnLockLine(number int, line string) (yarnLockLine, error) {
+	trimmed := strings.TrimLeft(line, " ")
+	l := yarnLockLine{number: number, indent: len(line) - len(trimmed)}
+
+	// A top-level line lists descriptors, which may contain
+	// spaces and colons, and ends with a colon.
+	if l.indent == 0 {
+		key, ok := strings.CutSuffix(trimmed, ":")
+		if !ok {
+			return l, fmt.Errorf("line %d: expected an entry ending with a colon", number)
+		}
+		l.key = key
+		return l, nil
+	}
+
+	rest := trimmed
+	if strings.HasPrefix(rest, `"`) {
+		var err error
+		l.key, rest, err = readYarnLockString(rest)
+		if err != nil {
+			return l, fmt.Errorf("line %d: %w", number, err)
+		}
+	} else {
+		end := strings.IndexAny(rest, ": ")
+		if end < 0 {
+			end = len(rest)
+		}
+		l.key, rest = rest[:end], rest[end:]
+	}
+	rest = strings.TrimPrefix(rest, ":")
+	rest = strings.TrimSpace(rest)
+	if strings.HasPrefix(rest, `"`) {
+		value, after, err := readYarnLockString(rest)
+		if err != nil {
+			return l, fmt.Errorf("line %d: %w", number, err)
+		}
+		if strings.TrimSpace(after) == "" {
+			rest = value
+		}
+	}
+	l.value = rest
+	return l, nil
+}
+
+// splitYarnLockDescriptors splits the key of a top-level entry, as in
+// `"@babel/core@^7.0.0", "@babel/core@^7.1.0"` for Yarn 1 or
+// `"@babel/core@npm:^7.0.0, @babel/core@npm:^7.1.0"` for Yarn Berry.
+func splitYarnLockDescriptors(key string) ([]string, error) {
+	descriptors := []string{}
+	rest := key
+	for rest != "" {
+		var part string
+		if strings.HasPrefix(rest, `"`) {
+			var err error
+			part, rest, err = readYarnLockString(rest)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			end := strings.Index(rest, ",")
+			if end < 0 {
+				end = len(rest)
+			}
+			part, rest = rest[:end], rest[end:]
+		}
+		for _, descriptor := range strings.Split(part, ",") {
+			if descriptor = strings.TrimSpace(descriptor); descriptor != "" {
+				descriptors = append(descriptors, descriptor)
+			}
+		}
+		rest = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(rest), ","))
+	}
+	if len(descriptors) == 0 {
+		return nil, fmt.Errorf("entry without descriptors")
+	}
+	return descriptors, nil
+}
+
+// yarnDescriptorName returns the package name of a descriptor, which
+// is everything before the "@" that follows the name, allowing for
+// the "@" of a scope.
+func yarnDescriptorName(descriptor string) string {
+	if idx := strings.Index(descriptor[1:], "@"); idx >= 0 {
+		return descriptor[:idx+1]
+	}
+	return descriptor
+}
+
+// parseYarnLock parses a yarn.lock in either the Yarn 1 or the Yarn
+// Berry format.
+func parseYarnLock(contents string) (*yarnLock, error) {
+	lines := []yarnLockLine{}
+	for i, line := range strings.Split(strings.ReplaceAll(contents, "\r\n", "\n"), "\n") {
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		l, err := parseYarnLockLine(i+1, line)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, l)
+	}
+
+	lock := &yarnLock{Version: 1}
+	for i := 0; i < len(lines); {
+		entry := lines[i]
+		if entry.indent != 0 {
+			return nil, fmt.Errorf("line %d: unexpected indentation", entry.number)
+		}
+		i++
+		fields := []yarnLockLine{}
+		for ; i < len(lines) && lines[i].indent > 0; i++ {
+			fields = append(fields, lines[i])
+		}
+
+		if entry.key == "__metadata" {
+			for _, field := range fields {
+				if field.key == "version" {
+					version, err := strconv.Atoi(field.value)
+					if err != nil {
+						return nil, fmt.Errorf("line %d: invalid lockfile version %q", field.number, field.value)
+					}
+					lock.Version = version
+				}
+			}
+			continue
+		}
+
+		descriptors, err := splitYarnLockDescriptors(entry.key)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", entry.number, err)
+		}
+		pkg := yarnLockPackage{
+			Descriptors:  descriptors,
+			Name:         yarnDescriptorName(descriptors[0]),
+			Dependencies: map[string]string{},
+		}
+		block := ""
+		for _, field := range fields {
+			if field.indent <= 2 {
+				block = ""
+				if field.value == "" {
+					block = field.key
+					continue
+				}
+			}
+			switch block {
+			case "":
+				switch field.key {
+				case "version":
+					pkg.Version = field.value
+				case "resolved", "resolution":
+					pkg.Resolution = field.value
+				case "integrity", "checksum":
+					pkg.Integrity = strings.Fields(field.value)
+				}
+			case "dependencies", "optionalDependencies", "peerDependencies":
+				pkg.Dependencies[field.key] = field.value
+			}
+		}
+		pkg.Workspace = strings.Contains(pkg.Resolution, "@workspace:")
+		lock.Packages = append(lock.Packages, pkg)
+	}
+	return lock, nil
+}
+
+// readYarnLock reads and parses yarn.lock, terminating the process on
+// error.
+func readYarnLock() *yarnLock {
+	contentsB, err := os.ReadFile("yarn.lock")
+	if err != nil {
+		util.DieIO("yarn.lock: %s", err)
+	}
+	lock, err := parseYarnLock(string(contentsB))
+	if err != nil {
+		util.DieProtocol("yarn.lock: %s", err)
+	}
+	return lock
+}
+
+// yarnListLockfile implements ListLockfile for Yarn. If a package is
+// locked at several versions, the last one is listed.
+func yarnListLockfile() map[api.PkgName]api.PkgVersion {
+	pkgs := map[api.PkgName]api.PkgVersion{}
+	for _, pkg := range readYarnLock().Packages {
+		if !pkg.Workspace {
+			pkgs[api.PkgName(pkg.Name)] = api.PkgVersion(pkg.Version)
+		}
+	}
+	return pkgs
+}
+
+// yarnListLockfileHashes implements ListLockfileHashes for Yarn. If a
+// package is locked at several versions, the hashes of all of them
+// are listed.
+func yarnListLockfileHashes() map[api.PkgName][]string {
+	hashes := map[api.PkgName][]string{}
+	for _, pkg := range readYarnLock().Packages {
+		if len(pkg.Integrity) > 0 {
+			name := api.PkgName(pkg.Name)
+			hashes[name] = append(hashes[name], pkg.Integrity...)
+		}
+	}
+	return hashes
+}
+
+// yarnListLockfileGraph implements ListLockfileGraph for Yarn.
+func yarnListLockfileGraph() map[api.PkgName][]api.PkgName {
+	graph := map[api.PkgName][]api.PkgName{}
+	for _, pkg := range readYarnLock().Packages {
+		if pkg.Workspace {
+			continue
+		}
+		name := api.PkgName(pkg.Name)
+		deps := graph[name]
+		for dep := range pkg.Dependencies {
+			deps = append(deps, api.PkgName(dep))
+		}
+		graph[name] = deps
+	}
+	return graph
+}
@@ -0,0 +1,140 @@
+package nodejs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseYarnLockClassic(t *testing.T) {
+	lock, err := parseYarnLock(`# THIS IS AN AUTOGENERATED FILE. DO NOT EDIT THIS FILE DIRECTLY.
+# yarn lockfile v1
+
+
+"@babel/code-frame@^7.0.0", "@babel/code-frame@^7.22.13":
+  version "7.22.13"
+  resolved "https://registry.yarnpkg.com/@babel/code-frame/-/code-frame-7.22.13.tgz#e3c1c099"
+  integrity sha512-Xktuh==
+  dependencies:
+    "@babel/highlight" "^7.22.13"
+    chalk "^2.4.2"
+
+lodash4@npm:lodash@^4.17.21, lodash@^4.17.21:
+  version "4.17.21"
+  resolved "https://registry.yarnpkg.com/lodash/-/lodash-4.17.21.tgz"
+  integrity sha1-abc sha512-def
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &yarnLock{
+		Version: 1,
+		Packages: []yarnLockPackage{
+			{
+				Descriptors:  []string{"@babel/code-frame@^7.0.0", "@babel/code-frame@^7.22.13"},
+				Name:         "@babel/code-frame",
+				Version:      "7.22.13",
+				Resolution:   "https://registry.yarnpkg.com/@babel/code-frame/-/code-frame-7.22.13.tgz#e3c1c099",
+				Integrity:    []string{"sha512-Xktuh=="},
+				Dependencies: map[string]string{"@babel/highlight": "^7.22.13", "chalk": "^2.4.2"},
+			},
+			{
+				Descriptors:  []string{"lodash4@npm:lodash@^4.17.21", "lodash@^4.17.21"},
+				Name:         "lodash4",
+				Version:      "4.17.21",
+				Resolution:   "https://registry.yarnpkg.com/lodash/-/lodash-4.17.21.tgz",
+				Integrity:    []string{"sha1-abc", "sha512-def"},
+				Dependencies: map[string]string{},
+			},
+		},
+	}
+	if !reflect.DeepEqual(lock, expected) {
+		t.Errorf("expected %+v, got %+v", expected, lock)
+	}
+}
+
+func TestParseYarnLockBerry(t *testing.T) {
+	lock, err := parseYarnLock(`# This file is generated by running "yarn install" inside your project.
+# Manual changes might be lost - proceed with caution!
+
+__metadata:
+  version: 8
+  cacheKey: 10c0
+
+"@babel/code-frame@npm:^7.0.0, @babel/code-frame@npm:^7.22.13":
+  version: 7.22.13
+  resolution: "@babel/code-frame@npm:7.22.13"
+  dependencies:
+    "@babel/highlight": "npm:^7.22.13"
+    chalk: "npm:^2.4.2"
+  peerDependenciesMeta:
+    chalk:
+      optional: true
+  checksum: 10c0/f4cc8ae1
+  languageName: node
+  linkType: hard
+
+"lodash@patch:lodash@npm%3A4.17.21#~/.yarn/patches/lodash.patch":
+  version: 4.17.21
+  resolution: "lodash@patch:lodash@npm%3A4.17.21#~/.yarn/patches/lodash.patch::version=4.17.21&hash=1a2b3c"
+  checksum: 10c0/abcd
+  languageName: node
+  linkType: hard
+
+"my-app@workspace:.":
+  version: 0.0.0-use.local
+  resolution: "my-app@workspace:."
+  dependencies:
+    lodash: "patch:lodash@npm%3A4.17.21#~/.yarn/patches/lodash.patch"
+  languageName: unknown
+  linkType: soft
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &yarnLock{
+		Version: 8,
+		Packages: []yarnLockPackage{
+			{
+				Descriptors:  []string{"@babel/code-frame@npm:^7.0.0", "@babel/code-frame@npm:^7.22.13"},
+				Name:         "@babel/code-frame",
+				Version:      "7.22.13",
+				Resolution:   "@babel/code-frame@npm:7.22.13",
+				Integrity:    []string{"10c0/f4cc8ae1"},
+				Dependencies: map[string]string{"@babel/highlight": "npm:^7.22.13", "chalk": "npm:^2.4.2"},
+			},
+			{
+				Descriptors:  []string{"lodash@patch:lodash@npm%3A4.17.21#~/.yarn/patches/lodash.patch"},
+				Name:         "lodash",
+				Version:      "4.17.21",
+				Resolution:   "lodash@patch:lodash@npm%3A4.17.21#~/.yarn/patches/lodash.patch::version=4.17.21&hash=1a2b3c",
+				Integrity:    []string{"10c0/abcd"},
+				Dependencies: map[string]string{},
+			},
+			{
+				Descriptors: []string{"my-app@workspace:."},
+				Name:        "my-app",
+				Version:     "0.0.0-use.local",
+				Resolution:  "my-app@workspace:.",
+				Dependencies: map[string]string{
+					"lodash": "patch:lodash@npm%3A4.17.21#~/.yarn/patches/lodash.patch",
+				},
+				Workspace: true,
+			},
+		},
+	}
+	if !reflect.DeepEqual(lock, expected) {
+		t.Errorf("expected %+v, got %+v", expected, lock)
+	}
+}
+
+func TestParseYarnLockInvalid(t *testing.T) {
+	for _, invalid := range []string{
+		"  version \"1.0.0\"\n",
+		"lodash@^4.17.21\n  version \"4.17.21\"\n",
+		"\"lodash@^4.17.21:\n  version \"4.17.21\"\n",
+	} {
+		if _, err := parseYarnLock(invalid); err == nil {
+			t.Errorf("expected %q to be rejected", invalid)
+		}
+	}
+}
@@ -5,10 +5,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"net/url"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 
 	"github.com/replit/upm/internal/api"
@@ -79,18 +79,15 @@ func search(query string) []api.PkgInfo {
 
 	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		util.DieProtocol("packagist err: %s", err)
-	}
+	body := api.ReadResponse(resp)
 
 	pkgInfo, err := parseSearch(body)
 
 	if err != nil {
-		util.DieProtocol("Error: %s", err)
+		util.DieProtocol("%s: %s", endpoint, err)
 	}
 
-	return pkgInfo
+	return api.CheckSearchResults(endpoint, pkgInfo)
 }
 
 func parseSearch(arr []byte) ([]api.PkgInfo, error) {
@@ -123,18 +120,15 @@ func info(name api.PkgName) api.PkgInfo {
 
 	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		util.DieProtocol("packagist err: %s", err)
-	}
+	body := api.ReadResponse(resp)
 
 	pkgInfo, err := parseInfo(body, name)
 
 	if err != nil {
-		util.DieProtocol("Error: %s", err)
+		util.DieProtocol("%s: %s", endpoint, err)
 	}
 
-	return pkgInfo
+	return api.CheckInfo(endpoint, pkgInfo)
 
 }
 
@@ -229,11 +223,36 @@ func listLockfileWithContents(contents []byte) map[api.PkgName]api.PkgVersion {
 	return packages
 }
 
+// listInstalled implements ListInstalled by reading
+// vendor/composer/installed.json, which Composer 2 writes as an object
+// with a packages list and Composer 1 as the list alone.
+func listInstalled(pkgdir string) map[api.PkgName]api.PkgVersion {
+	packages := make(map[api.PkgName]api.PkgVersion)
+	contents, err := os.ReadFile(filepath.Join(pkgdir, "composer", "installed.json"))
+	if os.IsNotExist(err) {
+		return packages
+	} else if err != nil {
+		util.DieIO("installed.json failure: %s", err)
+	}
+
+	var installed composerLock
+	if err := json.Unmarshal(contents, &installed); err != nil {
+		if err := json.Unmarshal(contents, &installed.Packages); err != nil {
+			util.DieProtocol("installed.json err: %s", err)
+		}
+	}
+	for _, pkg := range installed.Packages {
+		packages[api.PkgName(pkg.Name)] = api.PkgVersion(pkg.Version)
+	}
+	return packages
+}
+
 var PhpComposerBackend = api.LanguageBackend{
 	Name:             "php-composer",
 	Specfile:         "composer.json",
 	Lockfile:         "composer.lock",
 	IsAvailable:      composerIsAvailable,
+	Tools:            []string{"composer"},
 	FilenamePatterns: []string{"*.php"},
 	Quirks:           api.QuirksAddRemoveAlsoLocks | api.QuirksAddRemoveAlsoInstalls,
 	GetPackageDir: func() string {
@@ -278,11 +297,10 @@ var PhpComposerBackend = api.LanguageBackend{
 		defer span.Finish()
 		util.RunCmd([]string{"composer", "install"})
 	},
-	ListSpecfile: listSpecfile,
-	ListLockfile: listLockfile,
-	Guess: func(context.Context) (map[string][]api.PkgName, bool) {
-		util.NotImplemented()
-		return nil, false
+	ListSpecfile: func(mergeAllGroups bool) api.PkgDeps {
+		return api.RuntimeDeps(listSpecfile(mergeAllGroups))
 	},
+	ListLockfile:                       listLockfile,
+	ListInstalled:                      listInstalled,
 	InstallReplitNixSystemDependencies: nix.DefaultInstallReplitNixSystemDependencies,
 }
@@ -157,3 +157,17 @@ func TestInfoParsing(t *testing.T) {
 		}
 	}
 }
+
+func TestListInstalled(t *testing.T) {
+	for _, contents := range []string{
+		`{"packages": [{"name": "psr/log", "version": "3.0.0"}], "dev": true}`,
+		`[{"name": "psr/log", "version": "3.0.0"}]`,
+	} {
+		vendor := t.TempDir()
+		require.NoError(t, os.MkdirAll(vendor+"/composer", 0o755))
+		require.NoError(t, os.WriteFile(vendor+"/composer/installed.json", []byte(contents), 0o644))
+		require.Equal(t, map[api.PkgName]api.PkgVersion{"psr/log": "3.0.0"}, listInstalled(vendor))
+	}
+
+	require.Empty(t, listInstalled(t.TempDir()))
+}
@@ -1,8 +1,11 @@
 package python
 
 import (
+	"os"
+	"reflect"
 	"testing"
 
+	"github.com/BurntSushi/toml"
 	"github.com/replit/upm/internal/api"
 )
 
@@ -28,3 +31,189 @@ func TestNormalizePackageName(t *testing.T) {
 		}
 	}
 }
+
+func TestPoetryListSpecfileMarksDev(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	pyproject := `
+[tool.poetry.dependencies]
+python = "^3.10"
+flask = "^3.0"
+
+[tool.poetry.dev-dependencies]
+black = "^24.1"
+
+[tool.poetry.group.dev.dependencies]
+pytest = "^8.0"
+
+[tool.poetry.group.docs.dependencies]
+sphinx = "^7.2"
+`
+	if err := os.WriteFile("pyproject.toml", []byte(pyproject), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	deps := PythonPoetryBackend.ListSpecfile(false)
+	expected := api.PkgDeps{
+		"flask":  {Spec: "^3.0"},
+		"black":  {Spec: "^24.1", Dev: true},
+		"pytest": {Spec: "^8.0", Dev: true, Group: "dev"},
+	}
+	if !reflect.DeepEqual(deps, expected) {
+		t.Errorf("expected %v, got %v", expected, deps)
+	}
+
+	if dep := PythonPoetryBackend.ListSpecfile(true)["sphinx"]; dep.Group != "docs" {
+		t.Errorf("expected sphinx in the docs group when merging all groups, got %+v", dep)
+	}
+}
+
+func TestPythonSpecs(t *testing.T) {
+	matches, err := pythonMatchesSpec(`[security]>=2.0,<3.0; python_version >= "3.8"`, "2.31.0")
+	if err != nil || !matches {
+		t.Errorf("expected extras and markers to be ignored, got %v, %v", matches, err)
+	}
+
+	for spec, valid := range map[api.PkgSpec]bool{
+		"^1.2":                      true,
+		">=1.0,<2":                  true,
+		"1.2.3":                     true,
+		"git+https://example.com/x": true,
+		"~=1":                       false,
+		">=banana":                  false,
+	} {
+		if err := pythonValidateSpec(spec); (err == nil) != valid {
+			t.Errorf("pythonValidateSpec(%q) = %v, expected valid=%v", spec, err, valid)
+		}
+	}
+
+	for name, valid := range map[api.PkgName]bool{
+		"Django":         true,
+		"zope.interface": true,
+		"flask[async]":   true,
+		"a":              true,
+		"-flask":         false,
+		"flask_":         false,
+		"my package":     false,
+		"flask[async":    false,
+	} {
+		if err := pythonValidatePackageName(name); (err == nil) != valid {
+			t.Errorf("pythonValidatePackageName(%q) = %v, expected valid=%v", name, err, valid)
+		}
+	}
+}
+
+func TestPopularPackages(t *testing.T) {
+	popular := pythonPopularPackages()
+	if popular["requests"] == 0 {
+		t.Errorf("requests is not among the popular packages")
+	}
+	if popular["typing-extensions"] == 0 {
+		t.Errorf("typing-extensions is not among the popular packages")
+	}
+	if _, ok := popular["reqeusts"]; ok {
+		t.Errorf("reqeusts is among the popular packages")
+	}
+}
+
+func TestNormalizePackageArgs(t *testing.T) {
+	for arg, expected := range map[string]api.PkgCoordinates{
+		"flask":          {Name: "flask"},
+		"flask==3.0":     {Name: "flask", Spec: "==3.0"},
+		"flask >=3,<4":   {Name: "flask", Spec: ">=3,<4"},
+		"flask 3.0":      {Name: "flask", Spec: "==3.0"},
+		"flask@3.0":      {Name: "flask", Spec: "==3.0"},
+		"Flask@~=3.0":    {Name: "Flask", Spec: "~=3.0"},
+		"flask[async]@2": {Name: "flask[async]", Spec: "==2"},
+	} {
+		pkgs := normalizePackageArgs([]string{arg})
+		if len(pkgs) != 1 {
+			t.Errorf("normalizePackageArgs(%q) = %v, expected one package", arg, pkgs)
+			continue
+		}
+		for _, coords := range pkgs {
+			if coords != expected {
+				t.Errorf("normalizePackageArgs(%q) = %+v, expected %+v", arg, coords, expected)
+			}
+		}
+	}
+}
+
+func TestPythonSources(t *testing.T) {
+	git := api.PkgSource{Kind: api.SourceGit, Location: "https://github.com/user/mylib", Ref: "main"}
+
+	spec, err := pep508SpecForSource("mylib", git)
+	if err != nil || spec != "@ git+https://github.com/user/mylib@main" {
+		t.Errorf("pep508SpecForSource = %q, %v", spec, err)
+	}
+	if joined := pep440Join("mylib", spec); joined != "mylib @ git+https://github.com/user/mylib@main" {
+		t.Errorf("pep440Join = %q", joined)
+	}
+	if source, ok := pythonSourceOfSpec(spec); !ok || source != git {
+		t.Errorf("pythonSourceOfSpec(%q) = %+v, %v, expected %+v", spec, source, ok, git)
+	}
+
+	spec, err = poetrySpecForSource("mylib", git)
+	if err != nil || spec != "git+https://github.com/user/mylib#main" {
+		t.Errorf("poetrySpecForSource = %q, %v", spec, err)
+	}
+	if joined := pep440Join("mylib", spec); joined != "git+https://github.com/user/mylib#main" {
+		t.Errorf("pep440Join = %q", joined)
+	}
+	spec, err = poetrySpecForSource("lib", api.PkgSource{Kind: api.SourcePath, Location: "file:vendor/lib"})
+	if err != nil || spec != "./vendor/lib" {
+		t.Errorf("poetrySpecForSource = %q, %v", spec, err)
+	}
+
+	name, found, ok := findPackage("mylib[cli] @ git+https://github.com/user/mylib@main")
+	if !ok || *name != "mylib" || *found != "[cli] @ git+https://github.com/user/mylib@main" {
+		t.Errorf("findPackage found %v, %v, %v", name, found, ok)
+	}
+	if source, ok := pythonSourceOfSpec(*found); !ok || source != git {
+		t.Errorf("pythonSourceOfSpec(%q) = %+v, %v, expected %+v", *found, source, ok, git)
+	}
+
+	for table, expected := range map[string]string{
+		`{ git = "https://github.com/user/mylib", branch = "main" }`: "git+https://github.com/user/mylib#main",
+		`{ path = "vendor/lib", develop = true }`:                    "./vendor/lib",
+		`{ version = "^1.0" }`:                                       "^1.0",
+	} {
+		var dep struct{ Dep interface{} }
+		if _, err := toml.Decode("dep = "+table, &dep); err != nil {
+			t.Fatal(err)
+		}
+		if spec := normalizeSpec(dep.Dep); spec != expected {
+			t.Errorf("normalizeSpec(%s) = %q, expected %q", table, spec, expected)
+		}
+	}
+}
+
+func TestProjectURL(t *testing.T) {
+	info := pypiEntryInfo{ProjectURLs: map[string]string{
+		"Source Code":   "https://github.com/pallets/flask/",
+		"Release-Notes": "https://flask.palletsprojects.com/changes/",
+	}}
+	if url := info.projectURL("source", "sourcecode"); url != "https://github.com/pallets/flask/" {
+		t.Errorf("expected the source code link, got %q", url)
+	}
+	if url := info.projectURL("changelog", "releasenotes"); url != "https://flask.palletsprojects.com/changes/" {
+		t.Errorf("expected the release notes link, got %q", url)
+	}
+	if url := info.projectURL("homepage"); url != "" {
+		t.Errorf("expected no link, got %q", url)
+	}
+	if url := info.orProjectURL("https://flask.palletsprojects.com/", "changelog"); url != "https://flask.palletsprojects.com/" {
+		t.Errorf("expected the given URL, got %q", url)
+	}
+	if url := info.orProjectURL("", "changelog", "releasenotes"); url != "https://flask.palletsprojects.com/changes/" {
+		t.Errorf("expected the release notes link, got %q", url)
+	}
+}
@@ -0,0 +1,29 @@
+package python
+
+import (
+	"path/filepath"
+
+	"github.com/replit/upm/internal/util"
+)
+
+// cacheDirsFrom returns a CacheDirs function that asks a package
+// manager for its cache with cmd.
+func cacheDirsFrom(cmd ...string) func() []string {
+	return func() []string {
+		if dir := util.GetCmdOutputDir(cmd); dir != "" {
+			return []string{dir}
+		}
+		return nil
+	}
+}
+
+// poetryCacheDirs implements CacheDirs for Poetry, whose cache
+// directory also holds the virtualenvs it creates outside projects,
+// which are left alone.
+func poetryCacheDirs() []string {
+	dir := util.GetCmdOutputDir([]string{"poetry", "config", "cache-dir"})
+	if dir == "" {
+		return nil
+	}
+	return []string{filepath.Join(dir, "cache"), filepath.Join(dir, "artifacts")}
+}
@@ -0,0 +1,55 @@
+package python
+
+import "github.com/replit/upm/internal/api"
+
+// pythonCommandPackages implements CommandPackages for Python: the
+// commands that Python projects commonly run, and the packages on PyPI
+// that provide them. Like moduleToPypiPackageOverride, it is kept by
+// hand, for the commands that guess and 'upm which-provides' should
+// know about.
+var pythonCommandPackages = map[string]api.PkgName{
+	"alembic":           "alembic",
+	"autopep8":          "autopep8",
+	"bandit":            "bandit",
+	"black":             "black",
+	"celery":            "celery",
+	"coverage":          "coverage",
+	"cython":            "cython",
+	"daphne":            "daphne",
+	"dbt":               "dbt-core",
+	"django-admin":      "django",
+	"fastapi":           "fastapi",
+	"flake8":            "flake8",
+	"flask":             "flask",
+	"gunicorn":          "gunicorn",
+	"http":              "httpie", // the httpie client, not a module
+	"huggingface-cli":   "huggingface-hub",
+	"hypercorn":         "hypercorn",
+	"ipython":           "ipython",
+	"isort":             "isort",
+	"jupyter":           "jupyter",
+	"jupyter-lab":       "jupyterlab",
+	"jupyter-notebook":  "notebook",
+	"locust":            "locust",
+	"mkdocs":            "mkdocs",
+	"mypy":              "mypy",
+	"nox":               "nox",
+	"pip-compile":       "pip-tools",
+	"pip-sync":          "pip-tools",
+	"pre-commit":        "pre-commit",
+	"py.test":           "pytest",
+	"pyinstaller":       "pyinstaller",
+	"pylint":            "pylint",
+	"pyright":           "pyright",
+	"pytest":            "pytest",
+	"ruff":              "ruff",
+	"scrapy":            "scrapy",
+	"sphinx-build":      "sphinx",
+	"sphinx-quickstart": "sphinx",
+	"streamlit":         "streamlit",
+	"tox":               "tox",
+	"twine":             "twine",
+	"uvicorn":           "uvicorn",
+	"waitress-serve":    "waitress",
+	"yapf":              "yapf",
+}
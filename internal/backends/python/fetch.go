@@ -0,0 +1,78 @@
+package python
+
+import (
+	"context"
+	"os"
+
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/util"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+// withThrowawayEnv runs fn with the variables that env returns for a
+// temporary directory set, or unset where they are empty, and removes
+// the directory afterwards. This is how the package managers are made
+// to create environments there instead of in the project.
+func withThrowawayEnv(env func(dir string) map[string]string, fn func()) {
+	dir, err := os.MkdirTemp("", "upm-fetch-")
+	if err != nil {
+		util.DieIO("%s", err)
+	}
+	defer os.RemoveAll(dir)
+	for name, value := range env(dir) {
+		old, wasSet := os.LookupEnv(name)
+		if value == "" {
+			err = os.Unsetenv(name)
+		} else {
+			err = os.Setenv(name, value)
+		}
+		if err != nil {
+			util.DieInitializationError("%s", err)
+		}
+		if wasSet {
+			defer os.Setenv(name, old)
+		} else {
+			defer os.Unsetenv(name)
+		}
+	}
+	fn()
+}
+
+// poetryFetch implements Fetch for Poetry, in a virtualenv of its own.
+func poetryFetch(ctx context.Context) {
+	//nolint:ineffassign,wastedassign,staticcheck
+	span, ctx := tracer.StartSpanFromContext(ctx, "poetry install")
+	defer span.Finish()
+	env := func(dir string) map[string]string {
+		return map[string]string{
+			"POETRY_VIRTUALENVS_CREATE":     "true",
+			"POETRY_VIRTUALENVS_IN_PROJECT": "false",
+			"POETRY_VIRTUALENVS_PATH":       dir,
+			"VIRTUAL_ENV":                   "",
+		}
+	}
+	withThrowawayEnv(env, func() {
+		cmd := []string{"poetry", "install", "--no-root"}
+		if config.Prod {
+			cmd = append(cmd, "--without", "dev")
+		}
+		util.RunCmd(cmd)
+	})
+}
+
+// uvFetch implements Fetch for uv, in an environment of its own.
+func uvFetch(ctx context.Context) {
+	//nolint:ineffassign,wastedassign,staticcheck
+	span, ctx := tracer.StartSpanFromContext(ctx, "uv sync")
+	defer span.Finish()
+	env := func(dir string) map[string]string {
+		return map[string]string{"UV_PROJECT_ENVIRONMENT": dir}
+	}
+	withThrowawayEnv(env, func() {
+		cmd := []string{"uv", "sync", "--frozen", "--no-install-project"}
+		if config.Prod {
+			cmd = append(cmd, "--no-dev")
+		}
+		util.RunCmd(cmd)
+	})
+}
@@ -2,9 +2,10 @@ package main
 
 import (
 	"fmt"
-	"net/http"
 	"path"
 	"sort"
+
+	"github.com/replit/upm/internal/api"
 )
 
 // These modules are always ignored
@@ -39,7 +40,7 @@ func GetModules(metadata PackageData) ([]string, error) {
 	pkg := latest[0]
 
 	// Download the distribution
-	resp, err := http.Get(pkg.URL)
+	resp, err := api.HttpClient.Get(pkg.URL)
 	if err != nil {
 		return nil, err
 	}
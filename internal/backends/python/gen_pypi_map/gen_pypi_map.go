@@ -19,6 +19,7 @@ This CLI program provides the following commands, intended to be executed in ord
 * test       - test modules on pypi and save the results (1 file per package) in the cache directory
 * updatepkgs - read from the cache directory and update the pkgs.json file
 * gen        - read pkgs.json and generate pypi_map.sqlite file, containing mappings for package guessing
+* popular    - read the download stats and generate popular_packages.txt, for typosquatting warnings
 
 Additionally,
 * test-one - run `test` for a single package
@@ -221,6 +222,25 @@ func cmd_updatepkgs(args []string) {
 	}
 }
 
+func cmd_popular(args []string) {
+	/*
+		Generate the list of the most downloaded packages
+		Parameters: bq, out, count
+	*/
+	popularCommandSet := flag.NewFlagSet("popular-flags", flag.ExitOnError)
+	popularBQ := popularCommandSet.String("bq", "download_stats.json", "The result of a BigQuery against the pypi downloads dataset.")
+	popularOut := popularCommandSet.String("out", "popular_packages.txt", "the destination file for the generated list")
+	popularCount := popularCommandSet.Int("count", 5000, "The number of packages to list")
+	if err := popularCommandSet.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to parse popular flags: %s\n", err)
+		return
+	}
+	err := GeneratePopular(*popularBQ, *popularOut, *popularCount)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to generate %s: %s\n", *popularOut, err.Error())
+	}
+}
+
 func main() {
 	command := ""
 	if len(os.Args) > 1 {
@@ -232,6 +252,7 @@ func main() {
 		"test-one":   cmd_test_one,
 		"updatepkgs": cmd_updatepkgs,
 		"gen":        cmd_gen,
+		"popular":    cmd_popular,
 	}
 	if cmd, ok := validCmds[command]; ok {
 		cmd(os.Args[2:])
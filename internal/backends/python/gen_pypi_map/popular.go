@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// normalizationPattern is that of PEP 503, which the popular packages
+// are normalized with, like the names UPM looks them up with.
+var normalizationPattern = regexp.MustCompile(`[-_.]+`)
+
+// GeneratePopular writes the count most downloaded packages in the
+// download stats at bqFile to outFile, as "name count" lines, most
+// downloaded first, for 'upm add' to warn about near misses of them.
+func GeneratePopular(bqFile string, outFile string, count int) error {
+	stats, err := LoadDownloadStats(bqFile)
+	if err != nil {
+		return err
+	}
+	downloads := map[string]int{}
+	for name, n := range stats {
+		downloads[normalizationPattern.ReplaceAllString(strings.ToLower(name), "-")] += n
+	}
+	names := make([]string, 0, len(downloads))
+	for name := range downloads {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if downloads[names[i]] != downloads[names[j]] {
+			return downloads[names[i]] > downloads[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	if len(names) > count {
+		names = names[:count]
+	}
+
+	file, err := os.Create(outFile)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	for _, name := range names {
+		fmt.Fprintf(writer, "%s %d\n", name, downloads[name])
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
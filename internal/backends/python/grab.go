@@ -4,11 +4,13 @@ import (
 	"context"
 	_ "embed"
 	"os"
+	"regexp"
 	"strings"
 
 	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/imports"
 	"github.com/replit/upm/internal/util"
-	"github.com/smacker/go-tree-sitter/python"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 )
 
@@ -17,38 +19,20 @@ var (
 	common_words_bytes []byte
 )
 
-var importsQuery = `
-(module
-  [(import_statement
-     name: [(dotted_name) @import
-            (aliased_import
-              name: (dotted_name) @import)])
-   (import_from_statement
-     module_name: (dotted_name) @import)
-   (if_statement
-     [(block
-        [(import_statement
-           name:
-            [(dotted_name) @import
-             (aliased_import
-               name: (dotted_name) @import)])
-         (import_from_statement
-           module_name: (dotted_name) @import)])
-      (_ (block
-           [(import_statement
-              name:
-               [(dotted_name) @import
-                (aliased_import
-                  name: (dotted_name) @import)])
-            (import_from_statement
-              module_name: (dotted_name) @import)]))])]
-
-  .
-
-  (comment)? @pragma)
-`
-
-var pyPathSegmentPatterns = []string{"*.py"}
+// matchRequiresPragma matches a comment that names packages the code
+// requires but does not import by name, as in "# upm: requires
+// psycopg2-binary, gunicorn".
+var matchRequiresPragma = regexp.MustCompile(`#\s*upm:\s*requires\s+([^#\n]+)`)
+
+// requiredPackages returns the packages that the requires pragmas in
+// source name.
+func requiredPackages(source string) []string {
+	pkgs := []string{}
+	for _, match := range matchRequiresPragma.FindAllStringSubmatch(source, -1) {
+		pkgs = append(pkgs, pipInstallPackages(strings.ReplaceAll(match[1], ",", " "))...)
+	}
+	return pkgs
+}
 
 var pyIgnorePathSegments = map[string]bool{
 	"__pycache__": true,
@@ -289,26 +273,58 @@ func doGuess(ctx context.Context, testPypiMap func(string) (string, bool)) (map[
 	if err != nil {
 		util.DieConsistency("couldn't guess imports: %s", err)
 	}
+	notebookImports, required, notebooksOk := findNotebookImports(ctx, cwd)
+	for mod := range notebookImports {
+		foundImportPaths[mod] = true
+	}
+	required = append(required, findRequiredPackages(cwd)...)
+
+	pkgs, ok := filterImports(ctx, foundImportPaths, testPypiMap)
+	addRequired(pkgs, required)
+	return pkgs, ok && notebooksOk
+}
 
-	return filterImports(ctx, foundImportPaths, testPypiMap)
+// addRequired adds the packages that the project names itself, which
+// notebooks install with pip or requires pragmas name, to the guessed
+// packages, unless they are guessed already.
+func addRequired(pkgs map[string][]api.PkgName, installed []string) {
+	guessed := map[api.PkgName]bool{}
+	for _, group := range pkgs {
+		for _, name := range group {
+			guessed[normalizePackageName(name)] = true
+		}
+	}
+	for _, pkg := range installed {
+		name := normalizePackageName(api.PkgName(pkg))
+		if !guessed[name] {
+			pkgs[pkg] = []api.PkgName{name}
+			guessed[name] = true
+		}
+	}
 }
 
 func findImports(ctx context.Context, dir string) (map[string]bool, error) {
 	span, ctx := tracer.StartSpanFromContext(ctx, "python.grab.findImports")
 	defer span.Finish()
-	py := python.GetLanguage()
-	pkgs, err := util.GuessWithTreeSitter(ctx, dir, py, importsQuery, pyPathSegmentPatterns, pyIgnorePathSegments)
+	return imports.Find(ctx, dir, imports.Python, pyIgnorePathSegments)
+}
 
+// findRequiredPackages returns the packages that the requires pragmas
+// in the Python files in dir name.
+func findRequiredPackages(dir string) []string {
+	paths, err := util.FindSourceFiles(dir, imports.Python.Patterns, pyIgnorePathSegments)
 	if err != nil {
-		return nil, err
+		util.DieIO("%s: %s", dir, err)
 	}
-
-	foundImportPaths := map[string]bool{}
-	for _, pkg := range pkgs {
-		foundImportPaths[pkg] = true
+	pkgs := []string{}
+	for _, path := range paths {
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			util.DieIO("%s: %s", path, err)
+		}
+		pkgs = append(pkgs, requiredPackages(string(contents))...)
 	}
-
-	return foundImportPaths, nil
+	return pkgs
 }
 
 func filterImports(ctx context.Context, foundPkgs map[string]bool, testPypiMap func(string) (string, bool)) (map[string][]api.PkgName, bool) {
@@ -329,6 +345,9 @@ func filterImports(ctx context.Context, foundPkgs map[string]bool, testPypiMap f
 		if common_words[mod] {
 			delete(foundPkgs, pkg)
 		}
+		if config.IgnoresModule(pkg) {
+			delete(foundPkgs, pkg)
+		}
 	}
 
 	pkgs := map[string][]api.PkgName{}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"os/exec"
 	"path"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -74,6 +75,41 @@ else:
 	}
 }
 
+func TestDynamicImports(t *testing.T) {
+	content := `
+import importlib
+from importlib import import_module
+
+# upm: requires psycopg2-binary, gunicorn>=21
+
+def load(name):
+    yaml = importlib.import_module("yaml")
+    adapters = __import__('requests.adapters')
+    plugin = import_module(f"plugins.{name}")
+    local = import_module(".local", package="app")
+    return import_module(name)  # upm: requires uvicorn[standard]
+`
+
+	testDir := t.TempDir()
+	if err := os.WriteFile(path.Join(testDir, "main.py"), []byte(content), 0o644); err != nil {
+		t.Fatal("failed to write test file", err)
+	}
+
+	found, err := findImports(context.Background(), testDir)
+	if err != nil {
+		t.Fatal("Parse failed", err)
+	}
+	expected := map[string]bool{"importlib": true, "yaml": true, "requests.adapters": true}
+	if !reflect.DeepEqual(found, expected) {
+		t.Errorf("expected imports %v, got %v", expected, found)
+	}
+
+	required := findRequiredPackages(testDir)
+	if expected := []string{"psycopg2-binary", "gunicorn", "uvicorn"}; !reflect.DeepEqual(required, expected) {
+		t.Errorf("expected required packages %v, got %v", expected, required)
+	}
+}
+
 /* TestLocalModules
  *
  * Create a real poetry project in testDir,
@@ -0,0 +1,73 @@
+package python
+
+import (
+	"context"
+	"os"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/specedit"
+	"github.com/replit/upm/internal/util"
+)
+
+// poetryInit implements Init for Poetry with 'poetry init', which
+// cannot be given a version, so 'poetry version' sets it afterwards.
+func poetryInit(ctx context.Context, meta api.ProjectMetadata) {
+	cmd := []string{"poetry", "init", "--no-interaction"}
+	if meta.Name != "" {
+		cmd = append(cmd, "--name", meta.Name)
+	}
+	if meta.License != "" {
+		cmd = append(cmd, "--license", meta.License)
+	}
+	util.RunCmd(cmd)
+	if meta.Version != "" {
+		util.RunCmd([]string{"poetry", "version", meta.Version})
+	}
+}
+
+// uvInit implements Init for uv with 'uv init', which cannot be given
+// a version or license, so they are written into the [project] table
+// afterwards.
+func uvInit(ctx context.Context, meta api.ProjectMetadata) {
+	// uv (currently?) creates a "hello.py" on uv init. Ensure it gets deleted before control returns to the user.
+	sampleFileName := "hello.py"
+	// If the user already _has_ a file called hello.py, do not delete it for them.
+	if util.Exists(sampleFileName) {
+		sampleFileName = ""
+	}
+
+	cmd := []string{"uv", "init", "--no-progress", "--no-readme", "--no-pin-python"}
+	if meta.Name != "" {
+		cmd = append(cmd, "--name", meta.Name)
+	}
+	util.RunCmd(cmd)
+	if sampleFileName != "" && util.Exists(sampleFileName) {
+		os.Remove(sampleFileName)
+	}
+
+	if meta.Version == "" && meta.License == "" {
+		return
+	}
+	contentsB, err := os.ReadFile("pyproject.toml")
+	if err != nil {
+		if os.IsNotExist(err) {
+			// Not created with --dry-run.
+			return
+		}
+		util.DieIO("pyproject.toml: %s", err)
+	}
+	contents := contentsB
+	for _, field := range []struct{ key, value string }{
+		{"version", meta.Version},
+		{"license", meta.License},
+	} {
+		if field.value == "" {
+			continue
+		}
+		contents, err = specedit.SetTOML(contents, "project", field.key, field.value)
+		if err != nil {
+			util.DieProtocol("pyproject.toml: %s", err)
+		}
+	}
+	util.TryWriteAtomic("pyproject.toml", contents)
+}
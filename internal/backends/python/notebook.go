@@ -0,0 +1,195 @@
+package python
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/replit/upm/internal/imports"
+	"github.com/replit/upm/internal/util"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+var notebookPathSegmentPatterns = []string{"*.ipynb"}
+
+// notebook is the part of a Jupyter notebook (nbformat 4) that guessing
+// reads.
+type notebook struct {
+	Cells []struct {
+		CellType string         `json:"cell_type"`
+		Source   notebookSource `json:"source"`
+	} `json:"cells"`
+}
+
+// notebookSource is the source of a notebook cell, which is either a
+// string or a list of lines that keep their newlines.
+type notebookSource string
+
+func (source *notebookSource) UnmarshalJSON(data []byte) error {
+	var lines []string
+	if err := json.Unmarshal(data, &lines); err == nil {
+		*source = notebookSource(strings.Join(lines, ""))
+		return nil
+	}
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return err
+	}
+	*source = notebookSource(str)
+	return nil
+}
+
+// pythonCellMagics are the IPython cell magics whose cells are still
+// Python; the cells of other cell magics, such as %%bash, are not.
+var pythonCellMagics = map[string]bool{
+	"capture": true,
+	"prun":    true,
+	"time":    true,
+	"timeit":  true,
+}
+
+// matchPipInstall matches a line magic or shell command that installs
+// packages with pip, as in "%pip install pandas" or "!python -m pip
+// install -q numpy".
+var matchPipInstall = regexp.MustCompile(`^[%!]\s*(?:python3?\s+-m\s+)?pip3?\s+install\s+(.*)$`)
+
+// pipOptionsWithValue are the options of 'pip install' that take the
+// next argument as their value, rather than a package.
+var pipOptionsWithValue = map[string]bool{
+	"-r":                true,
+	"--requirement":     true,
+	"-c":                true,
+	"--constraint":      true,
+	"-e":                true,
+	"--editable":        true,
+	"-t":                true,
+	"--target":          true,
+	"-i":                true,
+	"--index-url":       true,
+	"--extra-index-url": true,
+	"-f":                true,
+	"--find-links":      true,
+	"--platform":        true,
+	"--python-version":  true,
+	"--prefix":          true,
+	"--root":            true,
+}
+
+// matchPipPackageName matches the name of a package on PyPI.
+var matchPipPackageName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// pipInstallPackages returns the names of the packages that the
+// arguments of 'pip install' install from the index, leaving out
+// paths, URLs, variables and the values of options.
+func pipInstallPackages(args string) []string {
+	pkgs := []string{}
+	skip := false
+	for _, arg := range strings.Fields(args) {
+		arg = strings.Trim(arg, `'"`)
+		if skip {
+			skip = false
+			continue
+		}
+		if strings.HasPrefix(arg, "-") {
+			skip = pipOptionsWithValue[arg]
+			continue
+		}
+		if strings.ContainsAny(arg, "/\\$") || strings.HasPrefix(arg, ".") {
+			continue
+		}
+		name := arg
+		if i := strings.IndexAny(name, "[<>=!~;@"); i >= 0 {
+			name = name[:i]
+		}
+		if matchPipPackageName.MatchString(name) && !strings.HasSuffix(name, ".whl") {
+			pkgs = append(pkgs, name)
+		}
+	}
+	return pkgs
+}
+
+// notebookCode returns the Python code of the code cells of nb, with
+// IPython magics and shell commands blanked out so that it parses,
+// and the packages that the notebook installs with pip.
+func notebookCode(nb notebook) (string, []string) {
+	var code strings.Builder
+	installed := []string{}
+	for _, cell := range nb.Cells {
+		if cell.CellType != "code" {
+			continue
+		}
+		lines := strings.Split(string(cell.Source), "\n")
+		if first := strings.TrimSpace(lines[0]); strings.HasPrefix(first, "%%") {
+			magic := strings.Fields(strings.TrimPrefix(first, "%%"))
+			if len(magic) == 0 || !pythonCellMagics[magic[0]] {
+				continue
+			}
+			lines[0] = ""
+		}
+		for i, line := range lines {
+			trimmed := strings.TrimSpace(line)
+			if !strings.HasPrefix(trimmed, "%") && !strings.HasPrefix(trimmed, "!") {
+				continue
+			}
+			if match := matchPipInstall.FindStringSubmatch(trimmed); match != nil {
+				installed = append(installed, pipInstallPackages(match[1])...)
+			}
+			// Keep the line, so that the line numbers of pragmas
+			// still match those of their imports.
+			lines[i] = ""
+		}
+		code.WriteString(strings.Join(lines, "\n"))
+		code.WriteString("\n\n")
+	}
+	return code.String(), installed
+}
+
+// findNotebookImports returns the modules that the Jupyter notebooks in
+// dir import and the packages that they install with pip or name in
+// requires pragmas. Notebooks that cannot be read are logged, and make
+// ok false.
+func findNotebookImports(ctx context.Context, dir string) (modules map[string]bool, installed []string, ok bool) {
+	//nolint:ineffassign,wastedassign,staticcheck
+	span, ctx := tracer.StartSpanFromContext(ctx, "python.grab.findNotebookImports")
+	defer span.Finish()
+	ignore := map[string]bool{".ipynb_checkpoints": true}
+	for segment := range pyIgnorePathSegments {
+		ignore[segment] = true
+	}
+	paths, err := util.FindSourceFiles(dir, notebookPathSegmentPatterns, ignore)
+	if err != nil {
+		util.DieIO("%s: %s", dir, err)
+	}
+
+	modules = map[string]bool{}
+	installed = []string{}
+	ok = true
+	for _, path := range paths {
+		err := func() error {
+			contents, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			var nb notebook
+			if err := json.Unmarshal(contents, &nb); err != nil {
+				return fmt.Errorf("not a Jupyter notebook: %w", err)
+			}
+			code, pkgs := notebookCode(nb)
+			installed = append(installed, pkgs...)
+			installed = append(installed, requiredPackages(code)...)
+			found, err := imports.FindSource(imports.Python, path, []byte(code))
+			for name := range found {
+				modules[name] = true
+			}
+			return err
+		}()
+		if err != nil {
+			util.LogError(fmt.Sprintf("error parsing file %s: %s", path, err))
+			ok = false
+		}
+	}
+	return modules, installed, ok
+}
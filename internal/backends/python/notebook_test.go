@@ -0,0 +1,68 @@
+package python
+
+import (
+	"context"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+)
+
+func TestPipInstallPackages(t *testing.T) {
+	for args, expected := range map[string][]string{
+		"pandas numpy":                                             {"pandas", "numpy"},
+		"-q 'requests>=2.0' scikit-learn==1.4":                     {"requests", "scikit-learn"},
+		"-r requirements.txt flask[async]":                         {"flask"},
+		"--index-url https://example.com/simple torch":             {"torch"},
+		"./local git+https://github.com/psf/black dist/x.whl $PKG": {},
+		"-U pip": {"pip"},
+	} {
+		if actual := pipInstallPackages(args); !reflect.DeepEqual(actual, expected) {
+			t.Errorf("%q: expected %v, got %v", args, expected, actual)
+		}
+	}
+}
+
+func TestFindNotebookImports(t *testing.T) {
+	content := `{
+ "cells": [
+  {"cell_type": "markdown", "source": ["import notacode\n"]},
+  {"cell_type": "code", "source": ["%pip install -q seaborn\n", "!pip install plotly\n", "import pandas as pd\n", "%matplotlib inline\n", "from sklearn import svm\n", "import foo #upm package(bar)"]},
+  {"cell_type": "code", "source": "%%bash\npip install notinstalled\nimport notpython"},
+  {"cell_type": "code", "source": "%%time\nimport numpy"}
+ ],
+ "metadata": {},
+ "nbformat": 4,
+ "nbformat_minor": 5
+}`
+	testDir := t.TempDir()
+	if err := os.WriteFile(path.Join(testDir, "analysis.ipynb"), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	imports, installed, ok := findNotebookImports(context.Background(), testDir)
+	if !ok {
+		t.Fatal("expected the notebook to parse")
+	}
+	expectedImports := map[string]bool{"pandas": true, "sklearn": true, "bar": true, "numpy": true}
+	if !reflect.DeepEqual(imports, expectedImports) {
+		t.Errorf("expected imports %v, got %v", expectedImports, imports)
+	}
+	if expected := []string{"seaborn", "plotly"}; !reflect.DeepEqual(installed, expected) {
+		t.Errorf("expected installed packages %v, got %v", expected, installed)
+	}
+}
+
+func TestAddRequired(t *testing.T) {
+	pkgs := map[string][]api.PkgName{"scikit-learn": {"scikit-learn"}}
+	addRequired(pkgs, []string{"Scikit_Learn", "seaborn", "seaborn"})
+	expected := map[string][]api.PkgName{
+		"scikit-learn": {"scikit-learn"},
+		"seaborn":      {"seaborn"},
+	}
+	if !reflect.DeepEqual(pkgs, expected) {
+		t.Errorf("expected %v, got %v", expected, pkgs)
+	}
+}
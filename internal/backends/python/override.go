@@ -0,0 +1,67 @@
+package python
+
+import (
+	"os"
+	"strings"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/specedit"
+	"github.com/replit/upm/internal/util"
+)
+
+// poetryOverrideGroup is the dependency group that holds the
+// constraints that 'upm override add' writes for Poetry, which has no
+// overrides of its own: a package listed in a group is resolved to a
+// version that satisfies its constraint there, however deep the rest
+// of the graph depends on it.
+const poetryOverrideGroup = "overrides"
+
+// setPoetryOverride implements SetOverride for Poetry.
+func setPoetryOverride(name api.PkgName, spec api.PkgSpec) {
+	contentsB, err := os.ReadFile("pyproject.toml")
+	if err != nil {
+		util.DieIO("pyproject.toml: %s", err)
+	}
+	table := "tool.poetry.group." + poetryOverrideGroup + ".dependencies"
+	if contentsB, err = specedit.SetTOML(contentsB, table, string(name), string(spec)); err != nil {
+		util.DieProtocol("pyproject.toml: %s", err)
+	}
+	util.TryWriteAtomic("pyproject.toml", contentsB)
+}
+
+// setUvOverride implements SetOverride for uv, in the
+// override-dependencies of [tool.uv]. An existing override of the
+// package is replaced.
+func setUvOverride(name api.PkgName, spec api.PkgSpec) {
+	cfg, err := readPyproject()
+	if err != nil {
+		util.DieIO("%s", err)
+	}
+	contentsB, err := os.ReadFile("pyproject.toml")
+	if err != nil {
+		util.DieIO("pyproject.toml: %s", err)
+	}
+	requirement := string(name) + string(spec)
+	overrides := []string{}
+	replaced := false
+	if cfg.Tool.Uv != nil {
+		for _, override := range cfg.Tool.Uv.OverrideDependencies {
+			other, _, found := findPackage(strings.SplitN(override, ";", 2)[0])
+			if found && normalizePackageName(*other) == normalizePackageName(name) {
+				if !replaced {
+					overrides = append(overrides, requirement)
+					replaced = true
+				}
+				continue
+			}
+			overrides = append(overrides, override)
+		}
+	}
+	if !replaced {
+		overrides = append(overrides, requirement)
+	}
+	if contentsB, err = specedit.SetTOML(contentsB, "tool.uv", "override-dependencies", overrides); err != nil {
+		util.DieProtocol("pyproject.toml: %s", err)
+	}
+	util.TryWriteAtomic("pyproject.toml", contentsB)
+}
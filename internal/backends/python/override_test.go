@@ -0,0 +1,32 @@
+package python
+
+import (
+	"os"
+	"testing"
+
+	assert "github.com/stretchr/testify/assert"
+)
+
+func TestSetUvOverride(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	contents := "[project]\nname = \"x\"\ndependencies = [\"flask\"]\n\n[tool.uv]\noverride-dependencies = [\"Werkzeug<3\", \"idna\"]\n"
+	if err := os.WriteFile("pyproject.toml", []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	setUvOverride("werkzeug", "==3.0.1")
+	setUvOverride("urllib3", ">=2")
+	contentsB, err := os.ReadFile("pyproject.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "[project]\nname = \"x\"\ndependencies = [\"flask\"]\n\n[tool.uv]\noverride-dependencies = [\"werkzeug==3.0.1\", \"idna\", \"urllib3>=2\"]\n"
+	assert.Equal(t, expected, string(contentsB))
+}
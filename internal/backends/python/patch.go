@@ -0,0 +1,47 @@
+package python
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/util"
+)
+
+// sitePackageFiles implements InstalledFiles for the backends that
+// install into a virtualenv, from the RECORD of the package's
+// .dist-info directory. Its metadata, bytecode and the scripts
+// installed outside site-packages are left out.
+func sitePackageFiles(pkgdir string, name api.PkgName) (api.InstalledPackage, bool) {
+	dist, ok := findInstalledDists(sitePackagesDirs(pkgdir))[normalizePackageName(name)]
+	if !ok || dist.distInfo == "" {
+		return api.InstalledPackage{}, false
+	}
+	record := filepath.Join(dist.distInfo, "RECORD")
+	f, err := os.Open(record)
+	if err != nil {
+		util.DieIO("%s", err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		util.DieProtocol("%s: %s", record, err)
+	}
+
+	distInfo := filepath.Base(dist.distInfo) + "/"
+	files := []string{}
+	for _, row := range rows {
+		if len(row) == 0 {
+			continue
+		}
+		path := row[0]
+		if !filepath.IsLocal(filepath.FromSlash(path)) || strings.HasPrefix(path, distInfo) ||
+			strings.HasSuffix(path, ".pyc") {
+			continue
+		}
+		files = append(files, path)
+	}
+	return api.InstalledPackage{Version: api.PkgVersion(dist.version), Dir: dist.siteDir, Files: files}, true
+}
@@ -0,0 +1,186 @@
+package python
+
+import (
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/specedit"
+	"github.com/replit/upm/internal/util"
+	"github.com/replit/upm/internal/versions"
+)
+
+// pep508PinSpec implements PinSpec for the backends whose specfiles
+// hold PEP 508 requirements, which have no caret operator. Its tilde
+// is "~=", which allows the patch releases of a version with at least
+// two components; for one, that is the same as a caret.
+func pep508PinSpec(version api.PkgVersion, policy api.SpecPolicy) (api.PkgSpec, error) {
+	v, err := versions.ParsePEP440(string(version))
+	if err != nil {
+		return "", err
+	}
+	switch policy {
+	case api.SpecExact:
+		return api.PkgSpec("==" + string(version)), nil
+	case api.SpecTilde:
+		if len(v.Release) >= 2 {
+			return api.PkgSpec("~=" + string(version)), nil
+		}
+	case api.SpecNone:
+		return "", nil
+	}
+	spec, err := versions.CaretRange(string(version))
+	return api.PkgSpec(spec), err
+}
+
+// poetryPinSpec implements PinSpec for Poetry, which writes exact
+// versions bare.
+func poetryPinSpec(version api.PkgVersion, policy api.SpecPolicy) (api.PkgSpec, error) {
+	if _, err := versions.ParsePEP440(string(version)); err != nil {
+		return "", err
+	}
+	switch policy {
+	case api.SpecExact:
+		return api.PkgSpec(version), nil
+	case api.SpecTilde:
+		return api.PkgSpec("~" + string(version)), nil
+	case api.SpecNone:
+		return "*", nil
+	}
+	return api.PkgSpec("^" + string(version)), nil
+}
+
+// matchRequirement splits a PEP 508 requirement into its name and
+// extras, its version constraint, and its environment markers with the
+// space before them. Unlike pep345Name, the name here cannot stop
+// short at its first character.
+var matchRequirement = regexp.MustCompile(`(?i)^(\s*[A-Z0-9](?:[A-Z0-9._-]*[A-Z0-9])?(?:\s*\[[^\]]*\])?)\s*([^;@]*?)(\s*;.*)?$`)
+
+// setRequirementConstraint replaces the version constraint of the PEP
+// 508 requirement, as in "flask[async]>=2; python_version>'3.8'",
+// keeping its extras and markers. Direct references are returned as
+// they are.
+func setRequirementConstraint(requirement string, constraint api.PkgSpec) string {
+	match := matchRequirement.FindStringSubmatch(requirement)
+	if match == nil {
+		return requirement
+	}
+	return match[1] + string(constraint) + match[3]
+}
+
+// normalizedSpecs returns specs by normalized name.
+func normalizedSpecs(specs map[api.PkgName]api.PkgSpec) map[api.PkgName]api.PkgSpec {
+	normalized := map[api.PkgName]api.PkgSpec{}
+	for name, spec := range specs {
+		normalized[normalizePackageName(name)] = spec
+	}
+	return normalized
+}
+
+// setRequirementsTxtSpecs implements SetSpecs for pip. Only the
+// requirements in requirements.txt itself are changed, not those of
+// the files it includes.
+func setRequirementsTxtSpecs(specs map[api.PkgName]api.PkgSpec) {
+	contentsB, err := os.ReadFile("requirements.txt")
+	if err != nil {
+		util.DieIO("requirements.txt: %s", err)
+	}
+	normalized := normalizedSpecs(specs)
+	lines := strings.Split(string(contentsB), "\n")
+	for i, line := range lines {
+		code, comment := specedit.SplitComment(line, "#")
+		name, _, found := findPackage(strings.SplitN(code, ";", 2)[0])
+		if !found {
+			continue
+		}
+		if spec, ok := normalized[normalizePackageName(*name)]; ok {
+			lines[i] = setRequirementConstraint(strings.TrimRight(code, " \t"), spec)
+			if comment != "" {
+				lines[i] = specedit.SetComment(lines[i], "#", comment)
+			}
+		}
+	}
+	util.TryWriteAtomic("requirements.txt", []byte(strings.Join(lines, "\n")))
+}
+
+// setUvSpecs implements SetSpecs for uv, whose pyproject.toml lists
+// requirements in [project], [dependency-groups] and [tool.uv].
+func setUvSpecs(specs map[api.PkgName]api.PkgSpec) {
+	cfg, err := readPyproject()
+	if err != nil {
+		util.DieIO("%s", err)
+	}
+	contentsB, err := os.ReadFile("pyproject.toml")
+	if err != nil {
+		util.DieIO("pyproject.toml: %s", err)
+	}
+	normalized := normalizedSpecs(specs)
+	replace := func(requirement string) string {
+		name, _, found := findPackage(strings.SplitN(requirement, ";", 2)[0])
+		if !found {
+			return requirement
+		}
+		if spec, ok := normalized[normalizePackageName(*name)]; ok {
+			return setRequirementConstraint(requirement, spec)
+		}
+		return requirement
+	}
+	arrays := [][2]string{{"project", "dependencies"}, {"tool.uv", "dev-dependencies"}}
+	for group := range cfg.DependencyGroups {
+		arrays = append(arrays, [2]string{"dependency-groups", group})
+	}
+	for _, array := range arrays {
+		if contentsB, err = specedit.MapTOMLStrings(contentsB, array[0], array[1], replace); err != nil {
+			util.DieProtocol("pyproject.toml: %s", err)
+		}
+	}
+	util.TryWriteAtomic("pyproject.toml", contentsB)
+}
+
+// setPoetrySpecs implements SetSpecs for Poetry. Packages whose specs
+// are tables keep their other keys, such as extras.
+func setPoetrySpecs(specs map[api.PkgName]api.PkgSpec) {
+	cfg, err := readPyproject()
+	if err != nil {
+		util.DieIO("%s", err)
+	}
+	if cfg.Tool.Poetry == nil {
+		return
+	}
+	contentsB, err := os.ReadFile("pyproject.toml")
+	if err != nil {
+		util.DieIO("pyproject.toml: %s", err)
+	}
+	tables := map[string]map[string]interface{}{
+		"tool.poetry.dependencies":     cfg.Tool.Poetry.Dependencies,
+		"tool.poetry.dev-dependencies": cfg.Tool.Poetry.DevDependencies,
+	}
+	for name, group := range cfg.Tool.Poetry.Group {
+		tables["tool.poetry.group."+name+".dependencies"] = group.Dependencies
+	}
+	for table, deps := range tables {
+		for name, spec := range specs {
+			current, ok := deps[string(name)]
+			if !ok {
+				continue
+			}
+			switch current := current.(type) {
+			case string:
+				contentsB, err = specedit.SetTOML(contentsB, table, string(name), string(spec))
+			case map[string]interface{}:
+				if strings.Contains(string(contentsB), "["+table+"."+string(name)+"]") {
+					// The package has a table of its own.
+					contentsB, err = specedit.SetTOML(contentsB, table+"."+string(name), "version", string(spec))
+				} else {
+					current["version"] = string(spec)
+					contentsB, err = specedit.SetTOML(contentsB, table, string(name), current)
+				}
+			}
+			if err != nil {
+				util.DieProtocol("pyproject.toml: %s", err)
+			}
+		}
+	}
+	util.TryWriteAtomic("pyproject.toml", contentsB)
+}
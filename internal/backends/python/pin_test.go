@@ -0,0 +1,66 @@
+package python
+
+import (
+	"os"
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+	assert "github.com/stretchr/testify/assert"
+)
+
+func TestSetRequirementConstraint(t *testing.T) {
+	for requirement, expected := range map[string]string{
+		"flask":                                 "flask==3.0.2",
+		"flask >= 2":                            "flask==3.0.2",
+		"flask[async]>=2; python_version>'3.8'": "flask[async]==3.0.2; python_version>'3.8'",
+		"flask @ https://example.com/flask.whl": "flask @ https://example.com/flask.whl",
+	} {
+		assert.Equal(t, expected, setRequirementConstraint(requirement, "==3.0.2"), requirement)
+	}
+}
+
+func TestSetRequirementsTxtSpecs(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	if err := os.WriteFile("requirements.txt", []byte("-r base.txt\nFlask>=2  # web\nrequests\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	setRequirementsTxtSpecs(map[api.PkgName]api.PkgSpec{"flask": "==3.0.2"})
+	contents, err := os.ReadFile("requirements.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "-r base.txt\nFlask==3.0.2  # web\nrequests\n", string(contents))
+}
+
+func TestPinSpec(t *testing.T) {
+	for _, test := range []struct {
+		version api.PkgVersion
+		policy  api.SpecPolicy
+		pep508  api.PkgSpec
+		poetry  api.PkgSpec
+	}{
+		{"1.2.3", api.SpecExact, "==1.2.3", "1.2.3"},
+		{"1.2.3", api.SpecCaret, ">=1.2.3,<2", "^1.2.3"},
+		{"1.2.3", api.SpecTilde, "~=1.2.3", "~1.2.3"},
+		{"5", api.SpecTilde, ">=5,<6", "~5"},
+		{"1.2.3", api.SpecNone, "", "*"},
+	} {
+		spec, err := pep508PinSpec(test.version, test.policy)
+		assert.NoError(t, err)
+		assert.Equal(t, test.pep508, spec, "%s %s", test.policy, test.version)
+		spec, err = poetryPinSpec(test.version, test.policy)
+		assert.NoError(t, err)
+		assert.Equal(t, test.poetry, spec, "%s %s", test.policy, test.version)
+	}
+	assert.Equal(t, "flask@^1.2.3", pep440Join("flask", "^1.2.3"))
+	assert.Equal(t, "flask@*", pep440Join("flask", "*"))
+	assert.Equal(t, "flask~=1.2.3", pep440Join("flask", "~=1.2.3"))
+}
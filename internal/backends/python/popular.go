@@ -0,0 +1,34 @@
+package python
+
+import (
+	_ "embed"
+	"strconv"
+	"strings"
+
+	"github.com/replit/upm/internal/api"
+)
+
+var (
+	//go:embed popular_packages.txt
+	popular_packages_bytes []byte
+)
+
+// pythonPopularPackages implements PopularPackages for the Python
+// backends, with the download counts of the most downloaded packages
+// on PyPI, as "name count" lines generated by 'gen_pypi_map popular'
+// from download_stats.json.
+func pythonPopularPackages() map[api.PkgName]int64 {
+	popular := map[api.PkgName]int64{}
+	for _, line := range strings.Split(string(popular_packages_bytes), "\n") {
+		name, count, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		downloads, err := strconv.ParseInt(count, 10, 64)
+		if err != nil {
+			continue
+		}
+		popular[normalizePackageName(api.PkgName(name))] = downloads
+	}
+	return popular
+}
@@ -4,18 +4,23 @@ package python
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/config"
 	"github.com/replit/upm/internal/nix"
 	"github.com/replit/upm/internal/pkg"
+	"github.com/replit/upm/internal/specedit"
 	"github.com/replit/upm/internal/util"
+	"github.com/replit/upm/internal/versions"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 )
 
@@ -27,6 +32,22 @@ var normalizationPattern = regexp.MustCompile(`[-_.]+`)
 // that matches the format of the REST API
 type pypiEntryInfoResponse struct {
 	Info pypiEntryInfo `json:"info"`
+
+	// The files of the latest release, which it was published
+	// with.
+	URLs []struct {
+		UploadTime time.Time `json:"upload_time_iso_8601"`
+	} `json:"urls"`
+}
+
+// pypiReleasesResponse is the part of the response of the PyPI API
+// that lists the files of every release.
+type pypiReleasesResponse struct {
+	Releases map[string][]struct {
+		UploadTime   time.Time `json:"upload_time_iso_8601"`
+		Yanked       bool      `json:"yanked"`
+		YankedReason string    `json:"yanked_reason"`
+	} `json:"releases"`
 }
 
 // pypiEntryInfo represents the response we get from the
@@ -36,6 +57,7 @@ type pypiEntryInfo struct {
 	AuthorEmail   string   `json:"author_email"`
 	HomePage      string   `json:"home_page"`
 	License       string   `json:"license"`
+	Maintainer    string   `json:"maintainer"`
 	Name          string   `json:"name"`
 	ProjectURL    string   `json:"project_url"`
 	PackageURL    string   `json:"package_url"`
@@ -44,6 +66,49 @@ type pypiEntryInfo struct {
 	RequiresDist  []string `json:"requires_dist"`
 	Summary       string   `json:"summary"`
 	Version       string   `json:"version"`
+
+	// The labelled links of the project, as in {"Source":
+	// "https://github.com/pallets/flask/"}.
+	ProjectURLs map[string]string `json:"project_urls"`
+}
+
+// sourceCodeLabels are the labels of the project links that point to
+// the source code, as given to projectURL.
+var sourceCodeLabels = []string{"source", "sourcecode", "repository", "code", "github"}
+
+// Labels of the project links that point to the home page,
+// documentation and issue tracker, for packages that do not give
+// them in the fields of the same name, as modern ones do not.
+var (
+	homepageLabels      = []string{"homepage", "home"}
+	documentationLabels = []string{"documentation", "docs", "doc"}
+	issueTrackerLabels  = []string{"issues", "issuetracker", "bugtracker", "bugreports", "bugs", "tracker"}
+)
+
+// orProjectURL returns url if it is set, or else the first of the
+// project's links labelled with one of labels.
+func (info pypiEntryInfo) orProjectURL(url string, labels ...string) string {
+	if url != "" {
+		return url
+	}
+	return info.projectURL(labels...)
+}
+
+// projectURL returns the first of the project's links labelled with
+// one of labels, compared without case, spaces, hyphens or
+// underscores, as pip compares them.
+func (info pypiEntryInfo) projectURL(labels ...string) string {
+	normalize := strings.NewReplacer(" ", "", "-", "", "_", "")
+	urls := map[string]string{}
+	for label, url := range info.ProjectURLs {
+		urls[normalize.Replace(strings.ToLower(label))] = url
+	}
+	for _, label := range labels {
+		if url, ok := urls[label]; ok {
+			return url
+		}
+	}
+	return ""
 }
 
 type pyprojectPackageCfg struct {
@@ -63,7 +128,8 @@ type pyprojectTOML struct {
 		BuildBackend string   `toml:"build-backend"`
 	} `toml:"build-system"`
 	Project *struct {
-		Dependencies []string `toml:"dependencies"`
+		Dependencies []string          `toml:"dependencies"`
+		Scripts      map[string]string `toml:"scripts"`
 	} `toml:"project"`
 	Tool struct {
 		Poetry *struct {
@@ -74,11 +140,19 @@ type pyprojectTOML struct {
 			DevDependencies map[string]interface{}        `toml:"dev-dependencies"`
 			Packages        []pyprojectPackageCfg         `toml:"packages"`
 			Group           map[string]pyprojectTOMLGroup `toml:"group"`
+			// Values are either "module:function" or tables
+			// with a reference or callable key.
+			Scripts map[string]interface{} `toml:"scripts"`
 		} `toml:"poetry"`
 		Uv *struct {
-			Sources map[string]interface{} `toml:"sources"`
+			Sources              map[string]interface{} `toml:"sources"`
+			DevDependencies      []string               `toml:"dev-dependencies"`
+			OverrideDependencies []string               `toml:"override-dependencies"`
 		} `toml:"uv"`
 	} `toml:"tool"`
+	// Entries are usually strings, but may also be tables
+	// including another group.
+	DependencyGroups map[string][]interface{} `toml:"dependency-groups"`
 }
 
 // poetryLock represents the relevant parts of a poetry.lock file, in
@@ -87,7 +161,22 @@ type poetryLock struct {
 	Package []struct {
 		Name    string `json:"name"`
 		Version string `json:"version"`
+		// Values are either specs or tables with a version
+		// key, like in pyproject.toml.
+		Dependencies map[string]interface{} `toml:"dependencies"`
+		Files        []poetryLockFile       `toml:"files"`
 	} `json:"package"`
+	// Lockfiles written before Poetry 1.2 list the files of each
+	// package here rather than in the package.
+	Metadata struct {
+		Files map[string][]poetryLockFile `toml:"files"`
+	} `toml:"metadata"`
+}
+
+// poetryLockFile is a distribution of a package in poetry.lock.
+type poetryLockFile struct {
+	File string `toml:"file"`
+	Hash string `toml:"hash"`
 }
 
 type uvLock struct {
@@ -98,6 +187,8 @@ type uvLock struct {
 		Version string `toml:"version"`
 		Source  struct {
 			Registry string `toml:"registry"`
+			Editable string `toml:"editable"`
+			Virtual  string `toml:"virtual"`
 		} `toml:"source"`
 		Sdist struct {
 			URL  string `toml:"url"`
@@ -109,6 +200,9 @@ type uvLock struct {
 			Hash string `toml:"hash"`
 			Size int    `toml:"size"`
 		} `toml:"wheels"`
+		Dependencies []struct {
+			Name string `toml:"name"`
+		} `toml:"dependencies"`
 	} `toml:"package"`
 }
 
@@ -117,21 +211,90 @@ func pep440Join(name api.PkgName, spec api.PkgSpec) string {
 		return string(name)
 	} else if matchSpecOnly.Match([]byte(spec)) {
 		return string(name) + string(spec)
+	} else if matchPoetryConstraint.Match([]byte(spec)) {
+		// Poetry's own operators, which its add command
+		// takes after an "@".
+		return string(name) + "@" + string(spec)
+	} else if strings.HasPrefix(pythonSpecConstraint(spec), "@") {
+		// A PEP 508 direct reference, as in
+		// "name @ git+https://github.com/user/name"
+		return string(name) + " " + string(spec)
+	} else if _, ok := api.ParseSource(string(spec)); ok {
+		// Poetry names packages from git, URLs and
+		// paths by the source alone.
+		return string(spec)
 	}
 	// We did not match the version range separator in the spec, so we got
 	// something like "foo 1.2.3", we need to return "foo==1.2.3"
 	return string(name) + "==" + string(spec)
 }
 
+// pythonSpecConstraint strips extras and environment markers from a
+// spec, leaving only the version constraint.
+func pythonSpecConstraint(spec api.PkgSpec) string {
+	constraint := string(spec)
+	if i := strings.Index(constraint, ";"); i >= 0 {
+		constraint = constraint[:i]
+	}
+	constraint = strings.TrimSpace(constraint)
+	if strings.HasPrefix(constraint, "[") {
+		if i := strings.Index(constraint, "]"); i >= 0 {
+			constraint = constraint[i+1:]
+		}
+	}
+	return strings.TrimSpace(constraint)
+}
+
+// pythonMatchesSpec implements MatchesSpec for the Python backends.
+func pythonMatchesSpec(spec api.PkgSpec, version api.PkgVersion) (bool, error) {
+	return versions.MatchesPEP440(pythonSpecConstraint(spec), string(version))
+}
+
+// pythonSpecSyntax is SpecSyntax for the Python backends.
+const pythonSpecSyntax = `a PEP 440 version specifier, e.g. ">=1.2,<2" or "==1.2.3"`
+
+// pythonValidateSpec implements ValidateSpec for the Python backends.
+// Specs that are not version constraints, such as URLs, are left for
+// the package manager to judge.
+func pythonValidateSpec(spec api.PkgSpec) error {
+	constraint := pythonSpecConstraint(spec)
+	if !looksLikeConstraint.MatchString(constraint) {
+		return nil
+	}
+	_, err := versions.ParsePEP440Specifier(constraint)
+	return err
+}
+
+// validPackageName matches the names allowed by PEP 508, optionally
+// followed by extras, as in "flask[async]".
+var validPackageName = regexp.MustCompile(`^(?i:[a-z0-9]|[a-z0-9][a-z0-9._-]*[a-z0-9])(?:\[[^\]]*\])?$`)
+
+// pythonValidatePackageName implements ValidatePackageName for the
+// Python backends.
+func pythonValidatePackageName(name api.PkgName) error {
+	if !validPackageName.MatchString(string(name)) {
+		return errors.New("package names may only contain letters, digits, \".\", \"-\" and \"_\", and must start and end with a letter or digit")
+	}
+	return nil
+}
+
+// looksLikeConstraint matches specs that start like a version
+// constraint rather than a URL, path or tag.
+var looksLikeConstraint = regexp.MustCompile(`^(?:[<>=!~^*]|[0-9])`)
+
 // normalizeSpec returns the version string from a Poetry spec, or the
 // empty string. The Poetry spec may be either a string or a
-// map[string]interface{} with a "version" key that is a string. If
-// neither, then the empty string is returned.
+// map[string]interface{} with a "version" key that is a string, or
+// with a "git", "url" or "path" key, in which case the source is
+// returned instead. If neither, then the empty string is returned.
 func normalizeSpec(spec interface{}) string {
 	switch spec := spec.(type) {
 	case string:
 		return spec
 	case map[string]interface{}:
+		if source := sourceTableSpec(spec); source != "" {
+			return source
+		}
 		switch spec := spec["version"].(type) {
 		case string:
 			return spec
@@ -140,9 +303,94 @@ func normalizeSpec(spec interface{}) string {
 	return ""
 }
 
+// sourceTableSpec returns the source of a Poetry dependency or uv
+// source given as a table with a "git", "url" or "path" key, in the
+// form that api.ParseSource understands, or the empty string.
+func sourceTableSpec(table map[string]interface{}) string {
+	str := func(key string) string {
+		value, _ := table[key].(string)
+		return value
+	}
+	switch {
+	case str("git") != "":
+		ref := str("branch")
+		if ref == "" {
+			ref = str("tag")
+		}
+		if ref == "" {
+			ref = str("rev")
+		}
+		return api.PkgSource{Kind: api.SourceGit, Location: str("git"), Ref: ref}.String()
+	case str("url") != "":
+		return str("url")
+	case str("path") != "":
+		path := str("path")
+		if _, ok := api.ParseSource(path); !ok {
+			path = "./" + path
+		}
+		return path
+	}
+	return ""
+}
+
+// pythonSourceOfSpec implements SourceOfSpec for the Python backends.
+// Extras and environment markers around a direct reference are
+// ignored.
+func pythonSourceOfSpec(spec api.PkgSpec) (api.PkgSource, bool) {
+	return api.DefaultSpecSource(api.PkgSpec(pythonSpecConstraint(spec)))
+}
+
+// pep508SpecForSource implements SpecForSource for pip and uv, which
+// take a PEP 508 direct reference, as in "name @ git+URL@ref".
+func pep508SpecForSource(name api.PkgName, source api.PkgSource) (api.PkgSpec, error) {
+	switch source.Kind {
+	case api.SourceGit:
+		location := source.Location
+		if strings.HasPrefix(location, "git@") {
+			// pip only understands scp-like locations as
+			// ssh URLs.
+			location = "ssh://" + strings.Replace(location, ":", "/", 1)
+		}
+		spec := "@ git+" + location
+		if source.Ref != "" {
+			spec += "@" + source.Ref
+		}
+		return api.PkgSpec(spec), nil
+	case api.SourcePath:
+		path := strings.TrimPrefix(source.Location, "file:")
+		if rest, ok := strings.CutPrefix(path, "~"); ok {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return "", err
+			}
+			path = home + rest
+		}
+		path, err := filepath.Abs(path)
+		if err != nil {
+			return "", err
+		}
+		return api.PkgSpec("@ file://" + filepath.ToSlash(path)), nil
+	default:
+		return api.PkgSpec("@ " + source.Location), nil
+	}
+}
+
+// poetrySpecForSource implements SpecForSource for Poetry, which
+// takes git URLs with a "#ref", archive URLs and relative paths as
+// they are.
+func poetrySpecForSource(name api.PkgName, source api.PkgSource) (api.PkgSpec, error) {
+	if source.Kind == api.SourcePath {
+		path := strings.TrimPrefix(source.Location, "file:")
+		if !strings.HasPrefix(path, ".") && !strings.HasPrefix(path, "/") && !strings.HasPrefix(path, "~") {
+			path = "./" + path
+		}
+		return api.PkgSpec(path), nil
+	}
+	return api.PkgSpec(source.String()), nil
+}
+
 func normalizePackageArgs(args []string) map[api.PkgName]api.PkgCoordinates {
 	pkgs := make(map[api.PkgName]api.PkgCoordinates)
-	versionComponent := regexp.MustCompile(pep440VersionComponent)
 	for _, arg := range args {
 		var rawName string
 		var name api.PkgName
@@ -152,21 +400,16 @@ func normalizePackageArgs(args []string) map[api.PkgName]api.PkgCoordinates {
 			name = api.PkgName(rawName)
 			spec = api.PkgSpec(string(found[2]))
 		} else {
-			split := strings.SplitN(arg, " ", 2)
-			rawName = split[0]
-			name = api.PkgName(rawName)
-			if len(split) > 1 {
-				specStr := strings.TrimSpace(split[1])
-
-				if specStr != "" {
-					if offset := versionComponent.FindIndex([]byte(spec)); len(offset) == 0 {
-						spec = api.PkgSpec("==" + specStr)
-					} else {
-						spec = api.PkgSpec(specStr)
-					}
-				} else {
-					spec = api.PkgSpec(specStr)
-				}
+			var err error
+			name, spec, err = api.ParsePackageArg(arg)
+			if err != nil {
+				util.DieConsistency("%s", err)
+			}
+			rawName = string(name)
+			// A bare version, as in "flask@3.0" or "flask 3.0",
+			// means exactly that version.
+			if bareVersion.MatchString(string(spec)) {
+				spec = "==" + spec
 			}
 		}
 		pkgs[normalizePackageName(name)] = api.PkgCoordinates{
@@ -177,6 +420,9 @@ func normalizePackageArgs(args []string) map[api.PkgName]api.PkgCoordinates {
 	return pkgs
 }
 
+// bareVersion matches a spec that is a version without an operator.
+var bareVersion = regexp.MustCompile(`^[0-9]`)
+
 // normalizePackageName implements NormalizePackageName for the Python
 // backends.
 // See https://packaging.python.org/en/latest/specifications/name-normalization/
@@ -187,8 +433,14 @@ func normalizePackageName(name api.PkgName) api.PkgName {
 	return api.PkgName(nameStr)
 }
 
+// pypiRegistry returns the base URL of the package index, which can
+// be overridden by the "pypi" entry of [registries] in the config.
+func pypiRegistry() string {
+	return strings.TrimSuffix(config.Registry("pypi", "https://pypi.org"), "/")
+}
+
 func info(name api.PkgName) api.PkgInfo {
-	res, err := api.HttpClient.Get(fmt.Sprintf("https://pypi.org/pypi/%s/json", string(name)))
+	res, err := api.HttpClient.Get(fmt.Sprintf("%s/pypi/%s/json", pypiRegistry(), string(name)))
 
 	if err != nil {
 		util.DieNetwork("HTTP Request failed with error: %s", err)
@@ -204,29 +456,44 @@ func info(name api.PkgName) api.PkgInfo {
 		util.DieNetwork("Received status code: %d", res.StatusCode)
 	}
 
-	body, err := io.ReadAll(res.Body)
-	if err != nil {
-		util.DieProtocol("Res body read failed with error: %s", err)
-	}
+	body := api.ReadResponse(res)
 
 	var output pypiEntryInfoResponse
 	if err := json.Unmarshal(body, &output); err != nil {
-		util.DieProtocol("PyPI response: %s", err)
+		util.DieProtocol("%s: %s", api.Endpoint(res), err)
 	}
 
 	info := api.PkgInfo{
 		Name:             output.Info.Name,
 		Description:      output.Info.Summary,
 		Version:          output.Info.Version,
-		HomepageURL:      output.Info.HomePage,
-		DocumentationURL: output.Info.DocsURL,
-		BugTrackerURL:    output.Info.BugTrackerURL,
+		HomepageURL:      output.Info.orProjectURL(output.Info.HomePage, homepageLabels...),
+		DocumentationURL: output.Info.orProjectURL(output.Info.DocsURL, documentationLabels...),
+		SourceCodeURL:    output.Info.projectURL(sourceCodeLabels...),
+		BugTrackerURL:    output.Info.orProjectURL(output.Info.BugTrackerURL, issueTrackerLabels...),
+		ChangelogURL:     output.Info.projectURL("changelog", "changes", "releasenotes", "history", "whatsnew"),
 		Author: util.AuthorInfo{
 			Name:  output.Info.Author,
 			Email: output.Info.AuthorEmail,
 		}.String(),
 		License: output.Info.License,
 	}
+	// PyPI does not say who can upload releases, only the
+	// maintainers the package names, if any.
+	for _, maintainer := range strings.Split(output.Info.Maintainer, ",") {
+		if maintainer := strings.TrimSpace(maintainer); maintainer != "" {
+			info.Maintainers = append(info.Maintainers, maintainer)
+		}
+	}
+	var published time.Time
+	for _, file := range output.URLs {
+		if published.IsZero() || file.UploadTime.Before(published) {
+			published = file.UploadTime
+		}
+	}
+	if !published.IsZero() {
+		info.Updated = published.UTC().Format("2006-01-02")
+	}
 
 	deps := []string{}
 	for _, line := range output.Info.RequiresDist {
@@ -238,7 +505,121 @@ func info(name api.PkgName) api.PkgInfo {
 	}
 	info.Dependencies = deps
 
-	return info
+	return api.CheckInfo(api.Endpoint(res), info)
+}
+
+// fetchPypiProject decodes the JSON document of a package on PyPI into
+// output, and returns false if there is no such package.
+func fetchPypiProject(name api.PkgName, output interface{}) bool {
+	res, err := api.HttpClient.Get(fmt.Sprintf("%s/pypi/%s/json", pypiRegistry(), string(name)))
+	if err != nil {
+		util.DieNetwork("HTTP Request failed with error: %s", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == 404 {
+		return false
+	}
+	if res.StatusCode != 200 {
+		util.DieNetwork("Received status code: %d", res.StatusCode)
+	}
+
+	body := api.ReadResponse(res)
+	if err := json.Unmarshal(body, output); err != nil {
+		util.DieProtocol("%s: %s", api.Endpoint(res), err)
+	}
+	return true
+}
+
+// fetchPypiReleases returns the files of every release of a package on
+// PyPI, and false if there is no such package.
+func fetchPypiReleases(name api.PkgName) (pypiReleasesResponse, bool) {
+	var output pypiReleasesResponse
+	ok := fetchPypiProject(name, &output)
+	return output, ok
+}
+
+// pypiReadme implements FetchReadme for the Python backends. PyPI
+// renders a description whose content type is not given as
+// reStructuredText.
+func pypiReadme(name api.PkgName) api.Readme {
+	var output struct {
+		Info struct {
+			Description            string `json:"description"`
+			DescriptionContentType string `json:"description_content_type"`
+		} `json:"info"`
+	}
+	if !fetchPypiProject(name, &output) {
+		return api.Readme{}
+	}
+	format := api.ReadmeRST
+	// The content type may have parameters, as in "text/markdown;
+	// charset=UTF-8; variant=GFM".
+	contentType := strings.TrimSpace(strings.SplitN(output.Info.DescriptionContentType, ";", 2)[0])
+	switch strings.ToLower(contentType) {
+	case "text/markdown":
+		format = api.ReadmeMarkdown
+	case "text/plain":
+		format = api.ReadmeText
+	}
+	text := output.Info.Description
+	// Packages without a description have "UNKNOWN".
+	if strings.TrimSpace(text) == "UNKNOWN" {
+		text = ""
+	}
+	return api.Readme{Text: text, Format: format}
+}
+
+// pypiReleases implements ListReleases for the Python backends. A
+// release is published when its first file is uploaded.
+func pypiReleases(name api.PkgName) []api.Release {
+	output, ok := fetchPypiReleases(name)
+	if !ok {
+		return nil
+	}
+
+	releases := []api.Release{}
+	for version, files := range output.Releases {
+		var published time.Time
+		yanked := len(files) > 0
+		for _, file := range files {
+			if published.IsZero() || file.UploadTime.Before(published) {
+				published = file.UploadTime
+			}
+			yanked = yanked && file.Yanked
+		}
+		if len(files) == 0 || yanked {
+			continue
+		}
+		releases = append(releases, api.Release{Version: api.PkgVersion(version), Published: published})
+	}
+	return releases
+}
+
+// pypiDeprecated implements ListDeprecated for the Python backends. PyPI
+// has no deprecation of its own, so these are the releases whose files
+// were all yanked.
+func pypiDeprecated(name api.PkgName) map[api.PkgVersion]api.Deprecation {
+	output, ok := fetchPypiReleases(name)
+	if !ok {
+		return nil
+	}
+
+	deprecated := map[api.PkgVersion]api.Deprecation{}
+	for version, files := range output.Releases {
+		yanked := len(files) > 0
+		reason := ""
+		for _, file := range files {
+			yanked = yanked && file.Yanked
+			if reason == "" {
+				reason = file.YankedReason
+			}
+		}
+		if yanked {
+			deprecated[api.PkgVersion(version)] = api.Deprecation{Yanked: true, Reason: reason}
+		}
+	}
+	return deprecated
 }
 
 func searchPypi(query string) []api.PkgInfo {
@@ -306,6 +687,11 @@ func commonIsActive(lockfile string) bool {
 	return !os.IsNotExist(err)
 }
 
+// pythonPatterns is the FilenamePatterns value for the Python
+// backends: modules, and Jupyter notebooks, whose imports are guessed
+// too.
+var pythonPatterns = []string{"*.py", "*.ipynb"}
+
 var pythonGuessRegexps = util.Regexps([]string{
 	// The (?:.|\\\n) subexpression allows us to
 	// match match multiple lines if
@@ -313,6 +699,10 @@ var pythonGuessRegexps = util.Regexps([]string{
 	`from (?:.|\\\n) import`,
 	`import ((?:.|\\\n)*) as`,
 	`import ((?:.|\\\n)*)`,
+	// Notebooks install packages with %pip or !pip.
+	`pip3? install (.*)`,
+	`(?:import_module|__import__)\((.*)\)`,
+	`upm:\s*requires (.*)`,
 })
 
 func readPyproject() (*pyprojectTOML, error) {
@@ -325,12 +715,12 @@ func readPyproject() (*pyprojectTOML, error) {
 
 // makePythonPoetryBackend returns a backend for invoking poetry
 func makePythonPoetryBackend() api.LanguageBackend {
-	listPoetrySpecfile := func(mergeAllGroups bool) (map[api.PkgName]api.PkgSpec, error) {
+	listPoetrySpecfile := func(mergeAllGroups bool) (api.PkgDeps, error) {
 		cfg, err := readPyproject()
 		if err != nil {
 			return nil, err
 		}
-		pkgs := map[api.PkgName]api.PkgSpec{}
+		pkgs := api.PkgDeps{}
 		if cfg.Tool.Poetry == nil {
 			return pkgs, nil
 		}
@@ -343,7 +733,7 @@ func makePythonPoetryBackend() api.LanguageBackend {
 			if specStr == "" {
 				continue
 			}
-			pkgs[api.PkgName(nameStr)] = api.PkgSpec(specStr)
+			pkgs[api.PkgName(nameStr)] = api.PkgDep{Spec: api.PkgSpec(specStr)}
 		}
 		for nameStr, spec := range cfg.Tool.Poetry.DevDependencies {
 			if nameStr == "python" {
@@ -354,16 +744,23 @@ func makePythonPoetryBackend() api.LanguageBackend {
 			if specStr == "" {
 				continue
 			}
-			pkgs[api.PkgName(nameStr)] = api.PkgSpec(specStr)
+			pkgs[api.PkgName(nameStr)] = api.PkgDep{Spec: api.PkgSpec(specStr), Dev: true}
 		}
-		if mergeAllGroups && cfg.Tool.Poetry.Group != nil {
-			for _, group := range cfg.Tool.Poetry.Group {
-				for nameStr, spec := range group.Dependencies {
-					specStr := normalizeSpec(spec)
-					if specStr == "" {
-						continue
-					}
-					pkgs[api.PkgName(nameStr)] = api.PkgSpec(specStr)
+		for groupName, group := range cfg.Tool.Poetry.Group {
+			// The dev group replaces dev-dependencies in
+			// Poetry 1.2, so it is always listed.
+			if !mergeAllGroups && groupName != "dev" {
+				continue
+			}
+			for nameStr, spec := range group.Dependencies {
+				specStr := normalizeSpec(spec)
+				if specStr == "" {
+					continue
+				}
+				pkgs[api.PkgName(nameStr)] = api.PkgDep{
+					Spec:  api.PkgSpec(specStr),
+					Dev:   groupName == "dev",
+					Group: groupName,
 				}
 			}
 		}
@@ -388,20 +785,41 @@ func makePythonPoetryBackend() api.LanguageBackend {
 			_, err := exec.LookPath("poetry")
 			return err == nil
 		},
+		Tools: []string{"poetry", "python3"},
 		IsActive: func() bool {
 			return commonIsActive("poetry.lock")
 		},
-		FilenamePatterns: []string{"*.py"},
+		FilenamePatterns: pythonPatterns,
 		Quirks: api.QuirksAddRemoveAlsoLocks |
-			api.QuirksAddRemoveAlsoInstalls,
+			api.QuirksAddRemoveAlsoInstalls |
+			api.QuirksAddRequiresInit,
 		NormalizePackageArgs: normalizePackageArgs,
 		NormalizePackageName: normalizePackageName,
+		MatchesSpec:          pythonMatchesSpec,
+		SpecSyntax:           pythonSpecSyntax,
+		SpecForSource:        poetrySpecForSource,
+		SourceOfSpec:         pythonSourceOfSpec,
+		PinSpec:              poetryPinSpec,
+		SetSpecs:             setPoetrySpecs,
+		SetOverride:          setPoetryOverride,
+		ValidateSpec:         pythonValidateSpec,
+		ValidatePackageName:  pythonValidatePackageName,
+		PopularPackages:      pythonPopularPackages,
+		ListReleases:         pypiReleases,
+		ListDeprecated:       pypiDeprecated,
+		FetchReadme:          pypiReadme,
 		GetPackageDir: func() string {
 			pkgdir := commonGuessPackageDir()
 			if pkgdir != "" {
 				return pkgdir
 			}
 
+			// An in-project virtualenv is always called .venv,
+			// whether or not it has been created yet.
+			if os.Getenv("POETRY_VIRTUALENVS_IN_PROJECT") == "true" {
+				return ".venv"
+			}
+
 			// Terminate early if we're running inside a repl.
 			// This will suppress the following poetry commands
 			// from showing up in the Packager pane.
@@ -428,26 +846,25 @@ func makePythonPoetryBackend() api.LanguageBackend {
 
 			return path
 		},
+		CacheDirs:    poetryCacheDirs,
 		SortPackages: pkg.SortPrefixSuffix(normalizePackageName),
 
-		Search: searchPypi,
-		Info:   info,
+		Search:          searchPypi,
+		AnnotateSearch:  annotateSearch,
+		Info:            info,
+		SupportsDev:     true,
+		SupportsGroups:  true,
+		SupportsReasons: true,
 		Add: func(ctx context.Context, pkgs map[api.PkgName]api.PkgSpec, projectName string) {
 			//nolint:ineffassign,wastedassign,staticcheck
 			span, ctx := tracer.StartSpanFromContext(ctx, "poetry (init) add")
 			defer span.Finish()
-			// Initalize the specfile if it doesnt exist
-			if !util.Exists("pyproject.toml") {
-				cmd := []string{"poetry", "init", "--no-interaction"}
-
-				if projectName != "" {
-					cmd = append(cmd, "--name", projectName)
-				}
-
-				util.RunCmd(cmd)
-			}
-
 			cmd := []string{"poetry", "add"}
+			if config.Dev {
+				cmd = append(cmd, "--group", "dev")
+			} else if config.Group != "" {
+				cmd = append(cmd, "--group", config.Group)
+			}
 			for name, spec := range pkgs {
 				if found, ok := moduleToPypiPackageAliases[string(name)]; ok {
 					delete(pkgs, api.PkgName(name))
@@ -463,6 +880,7 @@ func makePythonPoetryBackend() api.LanguageBackend {
 				cmd = append(cmd, pep440Join(name, spec))
 			}
 			util.RunCmd(cmd)
+			annotatePyproject(pkgs)
 		},
 		Remove: func(ctx context.Context, pkgs map[api.PkgName]bool) {
 			//nolint:ineffassign,wastedassign,staticcheck
@@ -480,6 +898,8 @@ func makePythonPoetryBackend() api.LanguageBackend {
 			defer span.Finish()
 			util.RunCmd([]string{"poetry", "lock", "--no-update"})
 		},
+		Relock:     poetryRelock,
+		LockInputs: []string{"poetry.toml"},
 		Install: func(ctx context.Context) {
 			//nolint:ineffassign,wastedassign,staticcheck
 			span, ctx := tracer.StartSpanFromContext(ctx, "poetry install")
@@ -489,36 +909,57 @@ func makePythonPoetryBackend() api.LanguageBackend {
 			// which happens for example if 'poetry remove' is
 			// interrupted. See
 			// <https://github.com/sdispater/poetry/issues/648>.
-			util.RunCmd([]string{"poetry", "install"})
+			cmd := []string{"poetry", "install"}
+			if config.Prod {
+				cmd = append(cmd, "--without", "dev")
+			}
+			util.RunCmd(cmd)
 		},
-		ListSpecfile: func(mergeAllGroups bool) map[api.PkgName]api.PkgSpec {
+		Fetch: poetryFetch,
+		ListSpecfile: func(mergeAllGroups bool) api.PkgDeps {
 			pkgs, err := listPoetrySpecfile(mergeAllGroups)
 			if err != nil {
 				util.DieIO("%s", err.Error())
 			}
+			addPyprojectReasons(pkgs)
 
 			return pkgs
 		},
-		ListLockfile: func() map[api.PkgName]api.PkgVersion {
+		ListLockfile: listPoetryLockfile,
+		ListLockfileGraph: func() map[api.PkgName][]api.PkgName {
 			var cfg poetryLock
 			if _, err := toml.DecodeFile("poetry.lock", &cfg); err != nil {
 				util.DieProtocol("%s", err.Error())
 			}
-			pkgs := map[api.PkgName]api.PkgVersion{}
+			graph := map[api.PkgName][]api.PkgName{}
 			for _, pkgObj := range cfg.Package {
-				name := api.PkgName(pkgObj.Name)
-				version := api.PkgVersion(pkgObj.Version)
-				pkgs[name] = version
+				deps := []api.PkgName{}
+				for name := range pkgObj.Dependencies {
+					deps = append(deps, api.PkgName(name))
+				}
+				graph[api.PkgName(pkgObj.Name)] = deps
 			}
-			return pkgs
+			return graph
+		},
+		ListLockfileHashes:    poetryListLockfileHashes,
+		ListLockfileArtifacts: poetryListLockfileArtifacts,
+		VerifyInstalled: func(pkgdir string) []api.IntegrityIssue {
+			return verifySitePackages(pkgdir, listPoetryLockfile())
 		},
-		GuessRegexps: pythonGuessRegexps,
-		Guess:        guess,
+		ListInstalled:   listSitePackages,
+		InstalledSizes:  sitePackageSizes,
+		InstalledFiles:  sitePackageFiles,
+		ListScripts:     listPyprojectScripts,
+		RunScript:       runScriptWith("poetry"),
+		Init:            poetryInit,
+		GuessRegexps:    pythonGuessRegexps,
+		Guess:           guess,
+		CommandPackages: pythonCommandPackages,
 		InstallReplitNixSystemDependencies: func(ctx context.Context, pkgs []api.PkgName) {
 			// Ignore the error here, because if we can't read the specfile,
 			// we still want to add the deps from above at least.
 			specfilePkgs, _ := listPoetrySpecfile(true)
-			commonInstallNixDeps(ctx, pkgs, specfilePkgs)
+			commonInstallNixDeps(ctx, pkgs, specfilePkgs.Specs())
 		},
 	}
 }
@@ -542,30 +983,52 @@ func makePythonPipBackend() api.LanguageBackend {
 			_, err := exec.LookPath("pip")
 			return err == nil
 		},
+		Tools:                []string{"pip", "python3"},
 		Alias:                "python-python3-pip",
-		FilenamePatterns:     []string{"*.py"},
+		FilenamePatterns:     pythonPatterns,
 		Quirks:               api.QuirksAddRemoveAlsoInstalls | api.QuirksNotReproducible,
 		NormalizePackageArgs: normalizePackageArgs,
 		NormalizePackageName: normalizePackageName,
+		MatchesSpec:          pythonMatchesSpec,
+		SpecSyntax:           pythonSpecSyntax,
+		SpecForSource:        pep508SpecForSource,
+		SourceOfSpec:         pythonSourceOfSpec,
+		PinSpec:              pep508PinSpec,
+		SetSpecs:             setRequirementsTxtSpecs,
+		ValidateSpec:         pythonValidateSpec,
+		ValidatePackageName:  pythonValidatePackageName,
+		PopularPackages:      pythonPopularPackages,
+		ListReleases:         pypiReleases,
+		ListDeprecated:       pypiDeprecated,
+		FetchReadme:          pypiReadme,
 		GetPackageDir: func() string {
 			pkgdir := commonGuessPackageDir()
 			if pkgdir != "" {
 				return pkgdir
 			}
 
-			if outputB, err := util.GetCmdOutputFallible([]string{
+			if util.ScriptsDisabled() {
+				return ""
+			}
+			// The user base depends on where the user's home
+			// is, and can be overridden.
+			if outputB, err := util.GetSandboxedCmdOutputFallible([]string{
 				"python",
 				"-c", "import site; print(site.USER_BASE)",
-			}); err == nil {
+			}, false, "HOME", "APPDATA", "PYTHONUSERBASE"); err == nil {
 				return string(outputB)
 			}
 
 			return ""
 		},
-		SortPackages: pkg.SortPrefixSuffix(normalizePackageName),
-
-		Search: searchPypi,
-		Info:   info,
+		CacheDirs:     cacheDirsFrom("pip", "cache", "dir"),
+		ListInstalled: pipListInstalled,
+		SortPackages:  pkg.SortPrefixSuffix(normalizePackageName),
+
+		Search:          searchPypi,
+		AnnotateSearch:  annotateSearch,
+		Info:            info,
+		SupportsReasons: true,
 		Add: func(ctx context.Context, pkgs map[api.PkgName]api.PkgSpec, projectName string) {
 			//nolint:ineffassign,wastedassign,staticcheck
 			span, ctx := tracer.StartSpanFromContext(ctx, "pip install")
@@ -605,14 +1068,16 @@ func makePythonPipBackend() api.LanguageBackend {
 
 			var toAppend []string
 			for _, canonicalSpec := range strings.Split(string(outputB), "\n") {
-				var name api.PkgName
-				matches := matchPackageAndSpec.FindSubmatch(([]byte)(canonicalSpec))
-				if len(matches) > 0 {
-					name = normalizePackageName(api.PkgName(string(matches[1])))
+				if found, _, ok := findPackage(canonicalSpec); ok {
+					name := normalizePackageName(*found)
 					if rawName, ok := normalizedPkgs[name]; ok {
 						// We've meticulously maintained the pkgspec from the CLI args, if specified,
 						// so we don't clobber it with pip freeze's output of "==="
-						toAppend = append(toAppend, pep440Join(name, pkgs[rawName]))
+						line := pep440Join(name, pkgs[rawName])
+						if config.Reason != "" {
+							line = specedit.SetComment(line, "#", config.Reason)
+						}
+						toAppend = append(toAppend, line)
 					}
 				}
 			}
@@ -676,7 +1141,7 @@ func makePythonPipBackend() api.LanguageBackend {
 
 			util.RunCmd([]string{"pip", "install", "-r", "requirements.txt"})
 		},
-		ListSpecfile: func(mergeAllGroups bool) map[api.PkgName]api.PkgSpec {
+		ListSpecfile: func(mergeAllGroups bool) api.PkgDeps {
 			flags, pkgs, err := ListRequirementsTxt("requirements.txt")
 			if err != nil {
 				util.DieIO("%s", err.Error())
@@ -690,10 +1155,19 @@ func makePythonPipBackend() api.LanguageBackend {
 			// NB: We rely on requirements.txt being populated with the
 			// Python package _metadata_ name, not the PEP-503/PEP-508
 			// normalized version.
-			return pkgs
+			deps := api.RuntimeDeps(pkgs)
+			reasons, _ := RequirementsTxtReasons("requirements.txt")
+			for name, reason := range reasons {
+				if dep, ok := deps[name]; ok {
+					dep.Reason = reason
+					deps[name] = dep
+				}
+			}
+			return deps
 		},
-		GuessRegexps: pythonGuessRegexps,
-		Guess:        guess,
+		GuessRegexps:    pythonGuessRegexps,
+		Guess:           guess,
+		CommandPackages: pythonCommandPackages,
 		InstallReplitNixSystemDependencies: func(ctx context.Context, pkgs []api.PkgName) {
 			// Ignore the error here, because if we can't read the specfile,
 			// we still want to add the deps from above at least.
@@ -707,7 +1181,7 @@ func makePythonPipBackend() api.LanguageBackend {
 
 // makePythonUvBackend returns a backend for invoking uv.
 func makePythonUvBackend() api.LanguageBackend {
-	listUvSpecfile := func() map[api.PkgName]api.PkgSpec {
+	listUvSpecfile := func(mergeAllGroups bool) api.PkgDeps {
 		cfg, err := readPyproject()
 		if err != nil {
 			return nil
@@ -717,26 +1191,50 @@ func makePythonUvBackend() api.LanguageBackend {
 			return nil
 		}
 
-		pkgs := map[api.PkgName]api.PkgSpec{}
-
-		for _, dep := range cfg.Project.Dependencies {
-			var name *api.PkgName
-			var spec *api.PkgSpec
-
-			matches := matchPackageAndSpec.FindSubmatch([]byte(dep))
-			if len(matches) > 1 {
-				_name := api.PkgName(string(matches[1]))
-				name = &_name
+		pkgs := api.PkgDeps{}
+		addDep := func(dep string, group string) {
+			name, spec, found := findPackage(dep)
+			if !found {
+				return
 			}
-			if len(matches) > 2 {
-				_spec := api.PkgSpec(string(matches[2]))
-				spec = &_spec
-			} else {
+			if spec == nil {
 				_spec := api.PkgSpec("")
 				spec = &_spec
 			}
-			pkgs[*name] = *spec
+			// uv records where packages from git, URLs
+			// and paths come from separately.
+			if cfg.Tool.Uv != nil {
+				if table, ok := cfg.Tool.Uv.Sources[string(*name)].(map[string]interface{}); ok {
+					if source := sourceTableSpec(table); source != "" {
+						_spec := api.PkgSpec(source)
+						spec = &_spec
+					}
+				}
+			}
+			pkgs[*name] = api.PkgDep{Spec: *spec, Dev: group == "dev", Group: group}
+		}
+
+		for _, dep := range cfg.Project.Dependencies {
+			addDep(dep, "")
+		}
+		// uv writes development dependencies to the PEP 735 "dev"
+		// group, or to tool.uv.dev-dependencies in older versions.
+		for groupName, group := range cfg.DependencyGroups {
+			if !mergeAllGroups && groupName != "dev" {
+				continue
+			}
+			for _, dep := range group {
+				if dep, ok := dep.(string); ok {
+					addDep(dep, groupName)
+				}
+			}
+		}
+		if cfg.Tool.Uv != nil {
+			for _, dep := range cfg.Tool.Uv.DevDependencies {
+				addDep(dep, "dev")
+			}
 		}
+		addPyprojectReasons(pkgs)
 
 		return pkgs
 	}
@@ -762,14 +1260,28 @@ func makePythonUvBackend() api.LanguageBackend {
 			_, err := exec.LookPath("uv")
 			return err == nil
 		},
+		Tools: []string{"uv"},
 		IsActive: func() bool {
 			return commonIsActive("uv.lock")
 		},
 		Alias:                "python-python3-uv",
-		FilenamePatterns:     []string{"*.py"},
-		Quirks:               api.QuirksAddRemoveAlsoInstalls | api.QuirksAddRemoveAlsoLocks,
+		FilenamePatterns:     pythonPatterns,
+		Quirks:               api.QuirksAddRemoveAlsoInstalls | api.QuirksAddRemoveAlsoLocks | api.QuirksAddRequiresInit,
 		NormalizePackageArgs: normalizePackageArgs,
 		NormalizePackageName: normalizePackageName,
+		MatchesSpec:          pythonMatchesSpec,
+		SpecSyntax:           pythonSpecSyntax,
+		SpecForSource:        pep508SpecForSource,
+		SourceOfSpec:         pythonSourceOfSpec,
+		PinSpec:              pep508PinSpec,
+		SetSpecs:             setUvSpecs,
+		SetOverride:          setUvOverride,
+		ValidateSpec:         pythonValidateSpec,
+		ValidatePackageName:  pythonValidatePackageName,
+		PopularPackages:      pythonPopularPackages,
+		ListReleases:         pypiReleases,
+		ListDeprecated:       pypiDeprecated,
+		FetchReadme:          pypiReadme,
 		GetPackageDir: func() string {
 			pkgdir := commonGuessPackageDir()
 			if pkgdir != "" {
@@ -783,36 +1295,25 @@ func makePythonUvBackend() api.LanguageBackend {
 
 			return ".venv"
 		},
+		CacheDirs:    cacheDirsFrom("uv", "cache", "dir"),
 		SortPackages: pkg.SortPrefixSuffix(normalizePackageName),
 
-		Search: searchPypi,
-		Info:   info,
+		Search:          searchPypi,
+		AnnotateSearch:  annotateSearch,
+		Info:            info,
+		SupportsDev:     true,
+		SupportsGroups:  true,
+		SupportsReasons: true,
 		Add: func(ctx context.Context, pkgs map[api.PkgName]api.PkgSpec, projectName string) {
 			//nolint:ineffassign,wastedassign,staticcheck
 			span, ctx := tracer.StartSpanFromContext(ctx, "uv (init) add")
 			defer span.Finish()
-			// Initalize the specfile if it doesnt exist
-			if !util.Exists("pyproject.toml") {
-				// uv (currently?) creates a "hello.py" on uv init. Ensure it gets deleted before control returns to the user.
-				sampleFileName := "hello.py"
-				// If the user already _has_ a file called hello.py, do not delete it for them.
-				if util.Exists(sampleFileName) {
-					sampleFileName = ""
-				}
-
-				cmd := []string{"uv", "init", "--no-progress", "--no-readme", "--no-pin-python"}
-
-				if projectName != "" {
-					cmd = append(cmd, "--name", projectName)
-				}
-
-				util.RunCmd(cmd)
-				if sampleFileName != "" && util.Exists(sampleFileName) {
-					os.Remove(sampleFileName)
-				}
-			}
-
 			cmd := []string{"uv", "add"}
+			if config.Dev {
+				cmd = append(cmd, "--dev")
+			} else if config.Group != "" {
+				cmd = append(cmd, "--group", config.Group)
+			}
 			for name, spec := range pkgs {
 				if found, ok := moduleToPypiPackageAliases[string(name)]; ok {
 					delete(pkgs, name)
@@ -823,6 +1324,7 @@ func makePythonUvBackend() api.LanguageBackend {
 				cmd = append(cmd, pep440Join(name, spec))
 			}
 			util.RunCmd(cmd)
+			annotatePyproject(pkgs)
 		},
 		Lock: func(ctx context.Context) {
 			//nolint:ineffassign,wastedassign,staticcheck
@@ -830,6 +1332,8 @@ func makePythonUvBackend() api.LanguageBackend {
 			defer span.Finish()
 			util.RunCmd([]string{"uv", "lock"})
 		},
+		Relock:     uvRelock,
+		LockInputs: []string{"uv.toml", ".python-version"},
 		Remove: func(ctx context.Context, pkgs map[api.PkgName]bool) {
 			//nolint:ineffassign,wastedassign,staticcheck
 			span, ctx := tracer.StartSpanFromContext(ctx, "uv uninstall")
@@ -846,10 +1350,18 @@ func makePythonUvBackend() api.LanguageBackend {
 			span, ctx := tracer.StartSpanFromContext(ctx, "uv install")
 			defer span.Finish()
 
-			util.RunCmd([]string{"uv", "sync"})
+			cmd := []string{"uv", "sync"}
+			if config.Prod {
+				cmd = append(cmd, "--no-dev")
+			}
+			if config.Frozen {
+				cmd = append(cmd, "--locked")
+			}
+			util.RunCmd(cmd)
 		},
-		ListSpecfile: func(mergeAllGroups bool) map[api.PkgName]api.PkgSpec {
-			pkgs := listUvSpecfile()
+		Fetch: uvFetch,
+		ListSpecfile: func(mergeAllGroups bool) api.PkgDeps {
+			pkgs := listUvSpecfile(mergeAllGroups)
 			return pkgs
 		},
 		ListLockfile: func() map[api.PkgName]api.PkgVersion {
@@ -864,13 +1376,40 @@ func makePythonUvBackend() api.LanguageBackend {
 			}
 			return pkgs
 		},
-		GuessRegexps: pythonGuessRegexps,
-		Guess:        guess,
+		ListLockfileGraph: func() map[api.PkgName][]api.PkgName {
+			var cfg uvLock
+			if _, err := toml.DecodeFile("uv.lock", &cfg); err != nil {
+				util.DieProtocol("%s", err.Error())
+			}
+			graph := map[api.PkgName][]api.PkgName{}
+			for _, pkgObj := range cfg.Packages {
+				deps := []api.PkgName{}
+				for _, dep := range pkgObj.Dependencies {
+					deps = append(deps, api.PkgName(dep.Name))
+				}
+				graph[api.PkgName(pkgObj.Name)] = deps
+			}
+			return graph
+		},
+		ListLockfileHashes:    uvListLockfileHashes,
+		ListLockfileArtifacts: uvListLockfileArtifacts,
+		VerifyInstalled: func(pkgdir string) []api.IntegrityIssue {
+			return verifySitePackages(pkgdir, uvInstalledPackages())
+		},
+		ListInstalled:   listSitePackages,
+		InstalledSizes:  sitePackageSizes,
+		InstalledFiles:  sitePackageFiles,
+		ListScripts:     listPyprojectScripts,
+		RunScript:       runScriptWith("uv"),
+		Init:            uvInit,
+		GuessRegexps:    pythonGuessRegexps,
+		Guess:           guess,
+		CommandPackages: pythonCommandPackages,
 		InstallReplitNixSystemDependencies: func(ctx context.Context, pkgs []api.PkgName) {
 			// Ignore the error here, because if we can't read the specfile,
 			// we still want to add the deps from above at least.
-			specfilePkgs := listUvSpecfile()
-			commonInstallNixDeps(ctx, pkgs, specfilePkgs)
+			specfilePkgs := listUvSpecfile(true)
+			commonInstallNixDeps(ctx, pkgs, specfilePkgs.Specs())
 		},
 	}
 
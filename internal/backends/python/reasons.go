@@ -0,0 +1,143 @@
+package python
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/specedit"
+	"github.com/replit/upm/internal/util"
+)
+
+// isDependencyTable returns whether the keys of the pyproject.toml
+// table are Poetry dependencies, as in [tool.poetry.dependencies].
+func isDependencyTable(table string) bool {
+	return table == "tool.poetry.dependencies" ||
+		table == "tool.poetry.dev-dependencies" ||
+		(strings.HasPrefix(table, "tool.poetry.group.") && strings.HasSuffix(table, ".dependencies"))
+}
+
+// isDependencyArray returns whether the array at key of the
+// pyproject.toml table lists PEP 508 dependencies, as
+// project.dependencies does.
+func isDependencyArray(table, key string) bool {
+	switch table {
+	case "project":
+		return key == "dependencies"
+	case "project.optional-dependencies", "dependency-groups":
+		return true
+	case "tool.uv":
+		return key == "dev-dependencies"
+	}
+	return false
+}
+
+// pyprojectDependencyLines returns the normalized names of the
+// packages declared on the lines of a pyproject.toml, by line index.
+// Only dependencies that have a line to themselves are found: the
+// keys of Poetry's dependency tables, and the elements of the PEP 508
+// arrays that are written one per line, as uv writes them.
+func pyprojectDependencyLines(lines []string) map[int]api.PkgName {
+	deps := map[int]api.PkgName{}
+	table := ""
+	array := ""
+	for i, line := range lines {
+		code, _ := specedit.SplitComment(line, "#")
+		switch {
+		case code == "":
+			continue
+
+		case array != "":
+			if strings.HasPrefix(code, "]") {
+				array = ""
+				continue
+			}
+			dep, err := strconv.Unquote(strings.TrimSuffix(code, ","))
+			if err != nil {
+				continue
+			}
+			if name, _, found := findPackage(dep); found {
+				deps[i] = normalizePackageName(*name)
+			}
+
+		case strings.HasPrefix(code, "["):
+			table = strings.TrimSpace(strings.Trim(code, "[]"))
+
+		default:
+			key, value, ok := strings.Cut(code, "=")
+			if !ok {
+				continue
+			}
+			key = strings.TrimSpace(key)
+			if unquoted, err := strconv.Unquote(key); err == nil {
+				key = unquoted
+			}
+			value = strings.TrimSpace(value)
+			if value == "[" && isDependencyArray(table, key) {
+				array = key
+			} else if isDependencyTable(table) && key != "python" {
+				deps[i] = normalizePackageName(api.PkgName(key))
+			}
+		}
+	}
+	return deps
+}
+
+// pyprojectReasons returns the comments on the lines of the packages
+// in pyproject.toml, by normalized name.
+func pyprojectReasons() map[api.PkgName]string {
+	contentsB, err := os.ReadFile("pyproject.toml")
+	if err != nil {
+		return nil
+	}
+	lines := strings.Split(string(contentsB), "\n")
+	reasons := map[api.PkgName]string{}
+	for i, name := range pyprojectDependencyLines(lines) {
+		if _, comment := specedit.SplitComment(lines[i], "#"); comment != "" {
+			reasons[name] = comment
+		}
+	}
+	return reasons
+}
+
+// addPyprojectReasons sets the Reason of the packages in deps from the
+// comments in pyproject.toml.
+func addPyprojectReasons(deps api.PkgDeps) {
+	reasons := pyprojectReasons()
+	for name, dep := range deps {
+		if reason, ok := reasons[normalizePackageName(name)]; ok {
+			dep.Reason = reason
+			deps[name] = dep
+		}
+	}
+}
+
+// annotatePyproject records config.Reason as the comment on the lines
+// of pkgs in pyproject.toml, after the package manager has added
+// them.
+func annotatePyproject(pkgs map[api.PkgName]api.PkgSpec) {
+	if config.Reason == "" {
+		return
+	}
+	contentsB, err := os.ReadFile("pyproject.toml")
+	if err != nil {
+		if os.IsNotExist(err) {
+			// Not created with --dry-run.
+			return
+		}
+		util.DieIO("pyproject.toml: %s", err)
+	}
+	added := map[api.PkgName]bool{}
+	for name := range pkgs {
+		added[normalizePackageName(name)] = true
+	}
+	lines := strings.Split(string(contentsB), "\n")
+	for i, name := range pyprojectDependencyLines(lines) {
+		if added[name] {
+			lines[i] = specedit.SetComment(lines[i], "#", config.Reason)
+		}
+	}
+	util.TryWriteAtomic("pyproject.toml", []byte(strings.Join(lines, "\n")))
+}
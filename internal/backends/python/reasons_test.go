@@ -0,0 +1,39 @@
+package python
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+)
+
+func TestPyprojectDependencyLines(t *testing.T) {
+	contents := `[project]
+name = "app"
+dependencies = [
+    "Requests>=2.32",  # HTTP client
+    "flask",
+]
+
+[dependency-groups]
+dev = [
+    "pytest>=8",
+]
+
+[tool.poetry.dependencies]
+python = "^3.10"
+"zope.interface" = "*"  # plugins
+django = { version = "^5", optional = true }
+`
+	expected := map[int]api.PkgName{
+		3:  "requests",
+		4:  "flask",
+		9:  "pytest",
+		14: "zope-interface",
+		15: "django",
+	}
+	if got := pyprojectDependencyLines(strings.Split(contents, "\n")); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
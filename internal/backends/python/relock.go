@@ -0,0 +1,35 @@
+package python
+
+import (
+	"context"
+
+	"github.com/replit/upm/internal/util"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+// poetryRelock implements Relock for Poetry. Any virtualenv that
+// Poetry makes to find the Python version goes in a throwaway
+// directory, rather than next to those of real projects.
+func poetryRelock(ctx context.Context) {
+	//nolint:ineffassign,wastedassign,staticcheck
+	span, ctx := tracer.StartSpanFromContext(ctx, "poetry lock")
+	defer span.Finish()
+	env := func(dir string) map[string]string {
+		return map[string]string{
+			"POETRY_VIRTUALENVS_IN_PROJECT": "false",
+			"POETRY_VIRTUALENVS_PATH":       dir,
+			"VIRTUAL_ENV":                   "",
+		}
+	}
+	withThrowawayEnv(env, func() {
+		util.RunCmd([]string{"poetry", "lock", "--no-update"})
+	})
+}
+
+// uvRelock implements Relock for uv.
+func uvRelock(ctx context.Context) {
+	//nolint:ineffassign,wastedassign,staticcheck
+	span, ctx := tracer.StartSpanFromContext(ctx, "uv lock")
+	defer span.Finish()
+	util.RunCmd([]string{"uv", "lock"})
+}
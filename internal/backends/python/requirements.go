@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/specedit"
 	"github.com/replit/upm/internal/util"
 )
 
@@ -21,8 +22,10 @@ var pep345Name = `(?:[A-Z0-9]|[A-Z0-9][A-Z0-9._-]*[A-Z0-9])`
 var pep440VersionComponent = `(?:(?:~=|!=|===|==|>=|<=|>|<)\s*[^, ]+)`
 var pep440VersionSpec = pep440VersionComponent + `(?:\s*,\s*` + pep440VersionComponent + `)*`
 var matchSpecOnly = regexp.MustCompile(`^` + pep440VersionSpec + `$`)
+var matchPoetryConstraint = regexp.MustCompile(`^(?:\*|[\^~][^=,\s]+)$`)
 var extrasSpec = `\[(` + pep345Name + `(?:\s*,\s*` + pep345Name + `)*)\]`
 var matchPackageAndSpec = regexp.MustCompile(`(?i)^\s*(` + pep345Name + `)\s*` + `((?:` + extrasSpec + `)?\s*(?:` + pep440VersionSpec + `)?)?\s*$`)
+var matchDirectReference = regexp.MustCompile(`(?i)^\s*(` + pep345Name + `)\s*((?:` + extrasSpec + `)?\s*@\s*\S.*?)\s*$`)
 var matchEggComponent = regexp.MustCompile(`(?i)\begg=(` + pep345Name + `)(?:$|[^A-Z0-9])`)
 
 // Global options:
@@ -58,6 +61,11 @@ func findPackage(line string) (*api.PkgName, *api.PkgSpec, bool) {
 	var found bool
 
 	matches := matchPackageAndSpec.FindSubmatch([]byte(line))
+	if len(matches) == 0 {
+		// A PEP 508 direct reference, as in
+		// "name @ git+https://github.com/user/name"
+		matches = matchDirectReference.FindSubmatch([]byte(line))
+	}
 	if len(matches) > 1 {
 		_name := api.PkgName(string(matches[1]))
 		name = &_name
@@ -85,14 +93,8 @@ func recurseRequirementsTxt(depth int, path string, sofar map[api.PkgName]api.Pk
 	defer handle.Close()
 
 	for scanner := bufio.NewScanner(handle); scanner.Scan(); {
-		line := strings.TrimSpace(scanner.Text())
-
 		// Separate out comments
-		segments := strings.SplitN(line, "#", 1)
-		if len(segments) == 2 {
-			line = strings.TrimSpace(segments[0])
-			// comment = strings.TrimSpace(segments[1])
-		}
+		line, _ := specedit.SplitComment(scanner.Text(), "#")
 
 		if line == "" {
 			// Skip blank lines
@@ -137,6 +139,27 @@ func ListRequirementsTxt(path string) ([]PipFlag, map[api.PkgName]api.PkgSpec, e
 	return flags, result, err
 }
 
+// RequirementsTxtReasons returns the comments on the lines of the
+// packages in the requirements file at path, which is where 'upm add
+// --reason' records them. Included files are not read.
+func RequirementsTxtReasons(path string) (map[api.PkgName]string, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	reasons := map[api.PkgName]string{}
+	for _, line := range strings.Split(string(contents), "\n") {
+		code, comment := specedit.SplitComment(line, "#")
+		if comment == "" {
+			continue
+		}
+		if name, _, found := findPackage(code); found {
+			reasons[*name] = comment
+		}
+	}
+	return reasons, nil
+}
+
 func recurseRemoveFromRequirementsTxt(depth int, path string, pkgs map[api.PkgName]bool) error {
 	if depth > 10 {
 		util.DieConsistency("Too many -r redirects in %s", path)
@@ -152,8 +175,9 @@ func recurseRemoveFromRequirementsTxt(depth int, path string, pkgs map[api.PkgNa
 
 	for scanner := bufio.NewScanner(handle); scanner.Scan(); {
 		line := strings.TrimSpace(scanner.Text())
+		code, _ := specedit.SplitComment(line, "#")
 
-		if name, _, found := findPackage(line); found && pkgs[normalizePackageName(*name)] {
+		if name, _, found := findPackage(code); found && pkgs[normalizePackageName(*name)] {
 			continue
 		} else if nextfile, found := util.CutPrefixes(line, "-r ", "--requirement "); found {
 			err := recurseRemoveFromRequirementsTxt(depth+1, nextfile, pkgs)
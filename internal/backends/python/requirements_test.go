@@ -49,3 +49,17 @@ func TestRequirementsNotFound(t *testing.T) {
 
 	assert.NotEmpty(t, err)
 }
+
+func TestRequirementsComments(t *testing.T) {
+	flags, deps, err := ListRequirementsTxt("test_resources/requirements/comment-requirements.txt")
+
+	assert.Equal(t, []PipFlag{"-e git+https://github.com/user/tool#egg=tool"}, flags)
+	assert.Empty(t, err)
+
+	assert.Equal(t, map[api.PkgName]api.PkgSpec{"flask": ">=2", "requests": "", "tool": ""}, deps)
+
+	reasons, err := RequirementsTxtReasons("test_resources/requirements/comment-requirements.txt")
+
+	assert.Empty(t, err)
+	assert.Equal(t, map[api.PkgName]string{"flask": "serves the API"}, reasons)
+}
@@ -0,0 +1,48 @@
+package python
+
+import (
+	"fmt"
+
+	"github.com/replit/upm/internal/util"
+)
+
+// listPyprojectScripts implements ListScripts for Poetry and uv by
+// reading the [project.scripts] and [tool.poetry.scripts] tables of
+// pyproject.toml.
+func listPyprojectScripts() map[string]string {
+	cfg, err := readPyproject()
+	if err != nil {
+		util.DieProtocol("pyproject.toml: %s", err)
+	}
+	scripts := map[string]string{}
+	if cfg.Project != nil {
+		for name, entry := range cfg.Project.Scripts {
+			scripts[name] = entry
+		}
+	}
+	if cfg.Tool.Poetry != nil {
+		for name, entry := range cfg.Tool.Poetry.Scripts {
+			switch entry := entry.(type) {
+			case string:
+				scripts[name] = entry
+			case map[string]interface{}:
+				if reference, ok := entry["reference"].(string); ok {
+					scripts[name] = reference
+				} else if callable, ok := entry["callable"].(string); ok {
+					scripts[name] = callable
+				} else {
+					scripts[name] = fmt.Sprint(entry)
+				}
+			}
+		}
+	}
+	return scripts
+}
+
+// runScriptWith returns a RunScript implementation that runs scripts,
+// or any executable in the virtualenv, with 'tool run'.
+func runScriptWith(tool string) func(script string, args []string) []string {
+	return func(script string, args []string) []string {
+		return append([]string{tool, "run", script}, args...)
+	}
+}
@@ -0,0 +1,41 @@
+package python
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestListPyprojectScripts(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	pyproject := `
+[project]
+name = "app"
+scripts = { serve = "app.server:main" }
+
+[tool.poetry.scripts]
+migrate = "app.db:migrate"
+seed = { reference = "app.db:seed", type = "console" }
+`
+	if err := os.WriteFile("pyproject.toml", []byte(pyproject), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"serve":   "app.server:main",
+		"migrate": "app.db:migrate",
+		"seed":    "app.db:seed",
+	}
+	if got := listPyprojectScripts(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
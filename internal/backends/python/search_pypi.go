@@ -1,12 +1,19 @@
 package python
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/util"
 	"golang.org/x/net/html"
 )
 
@@ -14,7 +21,7 @@ var WhiteSpaceChars = " \n\t"
 
 // Port of https://github.com/asadmoosvi/pypi-search/blob/main/pypi_search/search.py
 func SearchPypi(query string) ([]api.PkgInfo, error) {
-	endpoint := fmt.Sprintf("https://pypi.org/search/?q=%s", url.QueryEscape(query))
+	endpoint := fmt.Sprintf("%s/search/?q=%s", pypiRegistry(), url.QueryEscape(query))
 	req, err := http.NewRequest("GET", endpoint, nil)
 	if err != nil {
 		return nil, err
@@ -23,15 +30,16 @@ func SearchPypi(query string) ([]api.PkgInfo, error) {
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != 200 {
 		return nil, fmt.Errorf("Request to %s failed with %s", endpoint, resp.Status)
 	}
-	tree, err := html.Parse(resp.Body)
+	tree, err := html.Parse(bytes.NewReader(api.ReadResponse(resp)))
 	if err != nil {
 		return nil, err
 	}
 	results := findSearchResults(tree)
-	return results, nil
+	return api.CheckSearchResults(endpoint, results), nil
 }
 
 func findSearchResults(doc *html.Node) []api.PkgInfo {
@@ -98,3 +106,126 @@ func findNodes(node *html.Node, want func(*html.Node) bool) []*html.Node {
 	}
 	return results
 }
+
+// annotateConcurrency is the number of search results annotateSearch
+// looks up at the same time.
+const annotateConcurrency = 8
+
+// pypiStatsRegistry returns the base URL of the download statistics
+// service, which can be overridden by the "pypistats" entry of
+// [registries] in the config.
+func pypiStatsRegistry() string {
+	return strings.TrimSuffix(config.Registry("pypistats", "https://pypistats.org"), "/")
+}
+
+// getJSON fetches endpoint and decodes the JSON response into v.
+func getJSON(endpoint string, v interface{}) error {
+	resp, err := api.HttpClient.Get(endpoint)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("Request to %s failed with %s", endpoint, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, api.MaxResponseSize)).Decode(v)
+}
+
+// pypiRecentDownloads returns the number of downloads of a package
+// in the last month, according to pypistats.org.
+func pypiRecentDownloads(name string) (int64, error) {
+	var stats struct {
+		Data struct {
+			LastMonth int64 `json:"last_month"`
+		} `json:"data"`
+	}
+	endpoint := fmt.Sprintf("%s/api/packages/%s/recent", pypiStatsRegistry(), url.PathEscape(strings.ToLower(name)))
+	if err := getJSON(endpoint, &stats); err != nil {
+		return 0, err
+	}
+	return stats.Data.LastMonth, nil
+}
+
+// pypiLastRelease returns the date on which the latest release of a
+// package was uploaded, e.g. "2024-05-01".
+func pypiLastRelease(name string) (string, error) {
+	var release struct {
+		URLs []struct {
+			UploadTime string `json:"upload_time_iso_8601"`
+		} `json:"urls"`
+	}
+	endpoint := fmt.Sprintf("%s/pypi/%s/json", pypiRegistry(), url.PathEscape(name))
+	if err := getJSON(endpoint, &release); err != nil {
+		return "", err
+	}
+	latest := time.Time{}
+	for _, file := range release.URLs {
+		if t, err := time.Parse(time.RFC3339, file.UploadTime); err == nil && t.After(latest) {
+			latest = t
+		}
+	}
+	if latest.IsZero() {
+		return "", nil
+	}
+	return latest.Format("2006-01-02"), nil
+}
+
+// pypiProjectURLs returns the source code and home page URLs of a
+// package on PyPI.
+func pypiProjectURLs(name string) (string, string, error) {
+	var output pypiEntryInfoResponse
+	endpoint := fmt.Sprintf("%s/pypi/%s/json", pypiRegistry(), url.PathEscape(name))
+	if err := getJSON(endpoint, &output); err != nil {
+		return "", "", err
+	}
+	return output.Info.projectURL(sourceCodeLabels...), output.Info.HomePage, nil
+}
+
+// annotateSearch implements AnnotateSearch for the Python backends.
+// The PyPI search page has neither download counts, release dates nor
+// project URLs, so each result is looked up separately.
+func annotateSearch(results []api.PkgInfo, by api.SearchSort) {
+	sem := make(chan struct{}, annotateConcurrency)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(info *api.PkgInfo) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			switch by {
+			case api.SortDownloads:
+				if info.Downloads != 0 {
+					return
+				}
+				downloads, err := pypiRecentDownloads(info.Name)
+				if err != nil {
+					util.Verbosef("no download count for %s: %s", info.Name, err)
+					return
+				}
+				info.Downloads = downloads
+			case api.SortUpdated:
+				if info.Updated != "" {
+					return
+				}
+				updated, err := pypiLastRelease(info.Name)
+				if err != nil {
+					util.Verbosef("no release date for %s: %s", info.Name, err)
+					return
+				}
+				info.Updated = updated
+			case api.SortStars:
+				if info.SourceCodeURL != "" || info.HomepageURL != "" {
+					return
+				}
+				source, homepage, err := pypiProjectURLs(info.Name)
+				if err != nil {
+					util.Verbosef("no project URLs for %s: %s", info.Name, err)
+					return
+				}
+				info.SourceCodeURL, info.HomepageURL = source, homepage
+			}
+		}(&results[i])
+	}
+	wg.Wait()
+}
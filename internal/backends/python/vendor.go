@@ -0,0 +1,114 @@
+package python
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+
+	"github.com/BurntSushi/toml"
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/util"
+)
+
+// uvListLockfileArtifacts implements ListLockfileArtifacts for uv,
+// whose lockfile records the URL of every sdist and wheel.
+func uvListLockfileArtifacts() []api.Artifact {
+	artifacts := []api.Artifact{}
+	for _, pkgObj := range readUvLock().Packages {
+		if pkgObj.Source.Registry == "" {
+			continue
+		}
+		add := func(url, hash string) {
+			if url == "" {
+				return
+			}
+			artifact := api.Artifact{
+				Name:     api.PkgName(pkgObj.Name),
+				Version:  api.PkgVersion(pkgObj.Version),
+				URL:      url,
+				Filename: path.Base(url),
+			}
+			if hash != "" {
+				artifact.Hashes = []string{hash}
+			}
+			artifacts = append(artifacts, artifact)
+		}
+		add(pkgObj.Sdist.URL, pkgObj.Sdist.Hash)
+		for _, wheel := range pkgObj.Wheels {
+			add(wheel.URL, wheel.Hash)
+		}
+	}
+	return artifacts
+}
+
+// pypiFilesResponse is the part of the response of the PyPI API for
+// one version of a package that lists its files.
+type pypiFilesResponse struct {
+	URLs []struct {
+		Filename string `json:"filename"`
+		URL      string `json:"url"`
+	} `json:"urls"`
+}
+
+// pypiFileURLs returns the URLs of the files of the given version of
+// the package name in the package index, by filename.
+func pypiFileURLs(name, version string) map[string]string {
+	res, err := api.HttpClient.Get(fmt.Sprintf("%s/pypi/%s/%s/json", pypiRegistry(), name, version))
+	if err != nil {
+		util.DieNetwork("HTTP Request failed with error: %s", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		util.DieNetwork("%s %s: received status code: %d", name, version, res.StatusCode)
+	}
+
+	body := api.ReadResponse(res)
+	var output pypiFilesResponse
+	if err := json.Unmarshal(body, &output); err != nil {
+		util.DieProtocol("%s: %s", api.Endpoint(res), err)
+	}
+	urls := map[string]string{}
+	for _, file := range output.URLs {
+		urls[file.Filename] = file.URL
+	}
+	return urls
+}
+
+// poetryListLockfileArtifacts implements ListLockfileArtifacts for
+// Poetry. poetry.lock names the files of each package, but not where
+// they are, so their URLs are looked up in the package index.
+func poetryListLockfileArtifacts() []api.Artifact {
+	var cfg poetryLock
+	if _, err := toml.DecodeFile("poetry.lock", &cfg); err != nil {
+		util.DieProtocol("%s", err.Error())
+	}
+	artifacts := []api.Artifact{}
+	for _, pkgObj := range cfg.Package {
+		files := pkgObj.Files
+		if len(files) == 0 {
+			files = cfg.Metadata.Files[pkgObj.Name]
+		}
+		// Packages from git and paths have no files.
+		if len(files) == 0 {
+			continue
+		}
+		urls := pypiFileURLs(pkgObj.Name, pkgObj.Version)
+		for _, file := range files {
+			url, ok := urls[file.File]
+			if !ok {
+				util.DieConsistency("%s %s: %s is not in the package index", pkgObj.Name, pkgObj.Version, file.File)
+			}
+			artifact := api.Artifact{
+				Name:     api.PkgName(pkgObj.Name),
+				Version:  api.PkgVersion(pkgObj.Version),
+				URL:      url,
+				Filename: file.File,
+			}
+			if file.Hash != "" {
+				artifact.Hashes = []string{file.Hash}
+			}
+			artifacts = append(artifacts, artifact)
+		}
+	}
+	return artifacts
+}
@@ -0,0 +1,372 @@
+package python
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/util"
+	"github.com/replit/upm/internal/versions"
+)
+
+// listPoetryLockfile implements ListLockfile for Poetry.
+func listPoetryLockfile() map[api.PkgName]api.PkgVersion {
+	var cfg poetryLock
+	if _, err := toml.DecodeFile("poetry.lock", &cfg); err != nil {
+		util.DieProtocol("%s", err.Error())
+	}
+	pkgs := map[api.PkgName]api.PkgVersion{}
+	for _, pkgObj := range cfg.Package {
+		name := api.PkgName(pkgObj.Name)
+		version := api.PkgVersion(pkgObj.Version)
+		pkgs[name] = version
+	}
+	return pkgs
+}
+
+// poetryListLockfileHashes implements ListLockfileHashes for Poetry,
+// returning the hash of every wheel and sdist of each package.
+func poetryListLockfileHashes() map[api.PkgName][]string {
+	var cfg poetryLock
+	if _, err := toml.DecodeFile("poetry.lock", &cfg); err != nil {
+		util.DieProtocol("%s", err.Error())
+	}
+	hashes := map[api.PkgName][]string{}
+	for _, pkgObj := range cfg.Package {
+		files := pkgObj.Files
+		if len(files) == 0 {
+			files = cfg.Metadata.Files[pkgObj.Name]
+		}
+		for _, file := range files {
+			if file.Hash != "" {
+				hashes[api.PkgName(pkgObj.Name)] = append(hashes[api.PkgName(pkgObj.Name)], file.Hash)
+			}
+		}
+	}
+	return hashes
+}
+
+// readUvLock parses uv.lock, terminating the process if it cannot be
+// read.
+func readUvLock() uvLock {
+	var cfg uvLock
+	if _, err := toml.DecodeFile("uv.lock", &cfg); err != nil {
+		util.DieProtocol("%s", err.Error())
+	}
+	return cfg
+}
+
+// uvListLockfileHashes implements ListLockfileHashes for uv.
+func uvListLockfileHashes() map[api.PkgName][]string {
+	hashes := map[api.PkgName][]string{}
+	for _, pkgObj := range readUvLock().Packages {
+		name := api.PkgName(pkgObj.Name)
+		if pkgObj.Sdist.Hash != "" {
+			hashes[name] = append(hashes[name], pkgObj.Sdist.Hash)
+		}
+		for _, wheel := range pkgObj.Wheels {
+			if wheel.Hash != "" {
+				hashes[name] = append(hashes[name], wheel.Hash)
+			}
+		}
+	}
+	return hashes
+}
+
+// uvInstalledPackages returns the packages of uv.lock that uv installs
+// into the virtualenv, which leaves out virtual packages such as the
+// root of a workspace.
+func uvInstalledPackages() map[api.PkgName]api.PkgVersion {
+	pkgs := map[api.PkgName]api.PkgVersion{}
+	for _, pkgObj := range readUvLock().Packages {
+		if pkgObj.Source.Virtual == "" {
+			pkgs[api.PkgName(pkgObj.Name)] = api.PkgVersion(pkgObj.Version)
+		}
+	}
+	return pkgs
+}
+
+// sitePackagesDirs returns the site-packages directories of the
+// virtualenv or prefix pkgdir.
+func sitePackagesDirs(pkgdir string) []string {
+	dirs := []string{}
+	for _, pattern := range []string{
+		filepath.Join(pkgdir, "lib", "python*", "site-packages"),
+		filepath.Join(pkgdir, "lib64", "python*", "site-packages"),
+		filepath.Join(pkgdir, "Lib", "site-packages"),
+	} {
+		matches, _ := filepath.Glob(pattern)
+		for _, match := range matches {
+			// lib64 is often a symlink to lib.
+			if resolved, err := filepath.EvalSymlinks(match); err == nil && !contains(dirs, resolved) {
+				dirs = append(dirs, resolved)
+			}
+		}
+	}
+	return dirs
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// installedDist is a distribution found in site-packages.
+type installedDist struct {
+	version string
+
+	// The site-packages directory, and the .dist-info directory
+	// within it, or "" for a legacy .egg-info installation, which
+	// records no hashes.
+	siteDir  string
+	distInfo string
+}
+
+// findInstalledDists returns the distributions installed in dirs,
+// keyed by normalized name.
+func findInstalledDists(dirs []string) map[api.PkgName]installedDist {
+	dists := map[api.PkgName]installedDist{}
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			util.DieIO("%s", err)
+		}
+		for _, entry := range entries {
+			base, isDistInfo := strings.CutSuffix(entry.Name(), ".dist-info")
+			if !isDistInfo {
+				var isEggInfo bool
+				if base, isEggInfo = strings.CutSuffix(entry.Name(), ".egg-info"); !isEggInfo {
+					continue
+				}
+			}
+			// The name and version are escaped so that they
+			// contain no hyphens; egg-info directories may
+			// have a Python version after another one.
+			parts := strings.Split(base, "-")
+			if len(parts) < 2 {
+				continue
+			}
+			dist := installedDist{version: parts[1], siteDir: dir}
+			if isDistInfo {
+				dist.distInfo = filepath.Join(dir, entry.Name())
+			}
+			dists[normalizePackageName(api.PkgName(parts[0]))] = dist
+		}
+	}
+	return dists
+}
+
+// sameVersion reports whether two versions are equal according to PEP
+// 440, so that "1.0" equals "1.0.0".
+func sameVersion(a, b string) bool {
+	va, errA := versions.ParsePEP440(a)
+	vb, errB := versions.ParsePEP440(b)
+	if errA != nil || errB != nil {
+		return a == b
+	}
+	return va.Compare(vb) == 0
+}
+
+// recordHashes are the hash algorithms allowed in RECORD files.
+var recordHashes = map[string]func() hash.Hash{
+	"sha256": sha256.New,
+	"sha384": sha512.New384,
+	"sha512": sha512.New,
+}
+
+// hashFile returns the hash of the file at path, in the URL-safe
+// unpadded base64 encoding that RECORD files use.
+func hashFile(path string, newHash func() hash.Hash) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := newHash()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil)), nil
+}
+
+// verifyRecord checks the files of the installed distribution of name
+// against the hashes in its RECORD file, which the installer wrote
+// when it installed the wheel. Files without a hash, such as RECORD
+// itself and compiled bytecode, are skipped.
+func verifyRecord(name string, dist installedDist) []api.IntegrityIssue {
+	f, err := os.Open(filepath.Join(dist.distInfo, "RECORD"))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		util.DieIO("%s", err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		util.DieProtocol("%s: %s", filepath.Join(dist.distInfo, "RECORD"), err)
+	}
+
+	issues := []api.IntegrityIssue{}
+	for _, row := range rows {
+		if len(row) < 2 || row[1] == "" {
+			continue
+		}
+		algorithm, expected, _ := strings.Cut(row[1], "=")
+		newHash, ok := recordHashes[algorithm]
+		if !ok {
+			continue
+		}
+		path := filepath.FromSlash(row[0])
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dist.siteDir, path)
+		}
+		actual, err := hashFile(path, newHash)
+		if os.IsNotExist(err) {
+			issues = append(issues, api.IntegrityIssue{
+				Kind: api.IntegrityMissingFile,
+				Name: name,
+				Path: path,
+			})
+			continue
+		} else if err != nil {
+			util.DieIO("%s", err)
+		}
+		if actual != expected {
+			issues = append(issues, api.IntegrityIssue{
+				Kind:     api.IntegrityModified,
+				Name:     name,
+				Path:     path,
+				Expected: row[1],
+				Actual:   algorithm + "=" + actual,
+			})
+		}
+	}
+	return issues
+}
+
+// verifySitePackages implements VerifyInstalled for the backends that
+// install into a virtualenv. Installers do not keep the wheels whose
+// hashes the lockfile records, but they record the hash of every file
+// they install in the RECORD file of the distribution, and it is
+// against those that the installed files are checked, after checking
+// that the locked version is the one installed.
+func verifySitePackages(pkgdir string, locked map[api.PkgName]api.PkgVersion) []api.IntegrityIssue {
+	dists := findInstalledDists(sitePackagesDirs(pkgdir))
+
+	names := []string{}
+	for name := range locked {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+
+	issues := []api.IntegrityIssue{}
+	for _, name := range names {
+		version := string(locked[api.PkgName(name)])
+		dist, ok := dists[normalizePackageName(api.PkgName(name))]
+		switch {
+		case !ok:
+			issues = append(issues, api.IntegrityIssue{
+				Kind:     api.IntegrityNotInstalled,
+				Name:     name,
+				Expected: version,
+			})
+		case !sameVersion(dist.version, version):
+			issues = append(issues, api.IntegrityIssue{
+				Kind:     api.IntegrityWrongVersion,
+				Name:     name,
+				Path:     dist.distInfo,
+				Expected: version,
+				Actual:   dist.version,
+			})
+		case dist.distInfo != "":
+			issues = append(issues, verifyRecord(name, dist)...)
+		}
+	}
+	return issues
+}
+
+// listSitePackages implements ListInstalled for the backends that
+// install into a virtualenv, by reading the names of the .dist-info
+// directories rather than running pip in it.
+func listSitePackages(pkgdir string) map[api.PkgName]api.PkgVersion {
+	pkgs := map[api.PkgName]api.PkgVersion{}
+	for name, dist := range findInstalledDists(sitePackagesDirs(pkgdir)) {
+		pkgs[name] = api.PkgVersion(dist.version)
+	}
+	return pkgs
+}
+
+// sitePackageSizes implements InstalledSizes for the backends that
+// install into a virtualenv, from the files that the RECORD of each
+// package lists, including its scripts. Legacy .egg-info
+// installations, which list no files, are left out.
+func sitePackageSizes(pkgdir string) map[api.PkgName]int64 {
+	sizes := map[api.PkgName]int64{}
+	for name, dist := range findInstalledDists(sitePackagesDirs(pkgdir)) {
+		if dist.distInfo == "" {
+			continue
+		}
+		f, err := os.Open(filepath.Join(dist.distInfo, "RECORD"))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			util.DieIO("%s", err)
+		}
+		rows, err := csv.NewReader(f).ReadAll()
+		f.Close()
+		if err != nil {
+			util.DieProtocol("%s: %s", filepath.Join(dist.distInfo, "RECORD"), err)
+		}
+		var size int64
+		for _, row := range rows {
+			if len(row) == 0 {
+				continue
+			}
+			path := filepath.FromSlash(row[0])
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(dist.siteDir, path)
+			}
+			// Files that were deleted since count for
+			// nothing.
+			if info, err := os.Lstat(path); err == nil && info.Mode().IsRegular() {
+				size += info.Size()
+			}
+		}
+		sizes[name] = size
+	}
+	return sizes
+}
+
+// pipListInstalled implements ListInstalled for pip, which installs
+// into whatever environment pip belongs to.
+func pipListInstalled(pkgdir string) map[api.PkgName]api.PkgVersion {
+	outputB := util.GetCmdOutput([]string{
+		"pip", "list", "--format", "json", "--disable-pip-version-check",
+	})
+	var installed []struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal(outputB, &installed); err != nil {
+		util.DieProtocol("pip list: %s", err)
+	}
+	pkgs := map[api.PkgName]api.PkgVersion{}
+	for _, pkg := range installed {
+		pkgs[api.PkgName(pkg.Name)] = api.PkgVersion(pkg.Version)
+	}
+	return pkgs
+}
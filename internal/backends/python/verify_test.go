@@ -0,0 +1,62 @@
+package python
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+)
+
+func TestVerifySitePackages(t *testing.T) {
+	// The site-packages directory is found with its symlinks
+	// resolved.
+	venv, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	site := filepath.Join(venv, "lib", "python3.12", "site-packages")
+	sum := sha256.Sum256([]byte("print(1)\n"))
+	hash := "sha256=" + base64.RawURLEncoding.EncodeToString(sum[:])
+	modified := sha256.Sum256([]byte("print(2)\n"))
+	for name, contents := range map[string]string{
+		"six.py":                      "print(1)\n",
+		"six-1.16.0.dist-info/RECORD": "six.py," + hash + ",9\nsix-1.16.0.dist-info/RECORD,,\n",
+		"typing_extensions.py":        "print(2)\n",
+		"typing_extensions-4.12.0.dist-info/RECORD": "typing_extensions.py," + hash + ",9\ngone.py," + hash + ",9\n",
+		"attrs-23.2.0.dist-info/RECORD":             "",
+	} {
+		path := filepath.Join(site, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	issues := verifySitePackages(venv, map[api.PkgName]api.PkgVersion{
+		"six":               "1.16",
+		"typing.extensions": "4.12.0",
+		"attrs":             "23.1.0",
+		"flask":             "3.0.3",
+	})
+	expected := []api.IntegrityIssue{
+		{Kind: api.IntegrityWrongVersion, Name: "attrs", Path: filepath.Join(site, "attrs-23.2.0.dist-info"), Expected: "23.1.0", Actual: "23.2.0"},
+		{Kind: api.IntegrityNotInstalled, Name: "flask", Expected: "3.0.3"},
+		{
+			Kind:     api.IntegrityModified,
+			Name:     "typing.extensions",
+			Path:     filepath.Join(site, "typing_extensions.py"),
+			Expected: hash,
+			Actual:   "sha256=" + base64.RawURLEncoding.EncodeToString(modified[:]),
+		},
+		{Kind: api.IntegrityMissingFile, Name: "typing.extensions", Path: filepath.Join(site, "gone.py")},
+	}
+	if !reflect.DeepEqual(issues, expected) {
+		t.Errorf("expected %+v, got %+v", expected, issues)
+	}
+}
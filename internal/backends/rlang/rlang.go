@@ -88,8 +88,9 @@ var RlangBackend = api.LanguageBackend{
 	Specfile:         "Rconfig.json",
 	Lockfile:         "Rconfig.lock.json",
 	IsAvailable:      rIsAvailable,
+	Tools:            []string{"R"},
 	FilenamePatterns: []string{"*.r", "*.R"},
-	Quirks:           api.QuirksNone,
+	Quirks:           api.QuirksSpecfileEditedDirectly,
 	GetPackageDir:    getRPkgDir,
 	Search: func(query string) []api.PkgInfo {
 		pkgs := []api.PkgInfo{}
@@ -109,12 +110,12 @@ var RlangBackend = api.LanguageBackend{
 
 			pkgs = append(pkgs, pkg)
 		}
-		return pkgs
+		return api.CheckSearchResults(cranSearchEndpoint, pkgs)
 	},
 	Info: func(name api.PkgName) api.PkgInfo {
 		if pkg := SearchPackage(string(name)); pkg != nil {
 			hit := *pkg
-			return api.PkgInfo{
+			return api.CheckInfo(cranSearchEndpoint, api.PkgInfo{
 				Name:             hit.Source.Package,
 				Description:      hit.Source.Title,
 				Version:          hit.Source.Version,
@@ -125,7 +126,7 @@ var RlangBackend = api.LanguageBackend{
 				Author:           hit.Source.Author,
 				License:          hit.Source.License,
 				Dependencies:     getImports(hit.Source.Imports),
-			}
+			})
 		}
 
 		return api.PkgInfo{}
@@ -161,10 +162,10 @@ var RlangBackend = api.LanguageBackend{
 			}
 		}
 	},
-	ListSpecfile: func(mergeAllGroups bool) map[api.PkgName]api.PkgSpec {
-		pkgs := map[api.PkgName]api.PkgSpec{}
+	ListSpecfile: func(mergeAllGroups bool) api.PkgDeps {
+		pkgs := api.PkgDeps{}
 		for _, pkg := range RGetSpecFile().Packages {
-			pkgs[api.PkgName(pkg.Name)] = api.PkgSpec(pkg.Version)
+			pkgs[api.PkgName(pkg.Name)] = api.PkgDep{Spec: api.PkgSpec(pkg.Version)}
 		}
 		return pkgs
 	},
@@ -176,10 +177,5 @@ var RlangBackend = api.LanguageBackend{
 		return pkgs
 	},
 	//GuessRegexps: []*regexp.Regexp {regexp.MustCompile(`\brequire[ \t]*\(\s*([a-zA-Z_]\w*)\s*`)},
-	Guess: func(ctx context.Context) (map[string][]api.PkgName, bool) {
-		util.NotImplemented()
-
-		return nil, false
-	},
 	InstallReplitNixSystemDependencies: nix.DefaultInstallReplitNixSystemDependencies,
 }
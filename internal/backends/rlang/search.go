@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/util"
 )
 
 // CranHitSource represents the JSON we get about the information for a single package from a package search
@@ -72,23 +73,25 @@ type CranResponse struct {
 	Hits     CranHits   `json:"hits"`
 }
 
-func searchPackages(name string, size int) CranResponse {
-	// TODO: figure out how to deal with other mirrors
-	searchURL := "https://search.r-pkg.org/package/_search?q=" + url.QueryEscape(name) + "&size=" + strconv.Itoa(size)
-
-	if req, err := api.HttpClient.Get(searchURL); err == nil {
-		var res CranResponse
+// cranSearchEndpoint is the package search of the R-hub search
+// service.
+// TODO: figure out how to deal with other mirrors
+const cranSearchEndpoint = "https://search.r-pkg.org/package/_search"
 
-		decoder := json.NewDecoder(req.Body)
+func searchPackages(name string, size int) CranResponse {
+	searchURL := cranSearchEndpoint + "?q=" + url.QueryEscape(name) + "&size=" + strconv.Itoa(size)
 
-		if err = decoder.Decode(&res); err == nil {
-			return res
-		}
+	resp, err := api.HttpClient.Get(searchURL)
+	if err != nil {
+		util.DieNetwork("%s: %s", cranSearchEndpoint, err)
+	}
+	defer resp.Body.Close()
 
-		panic(err)
-	} else {
-		panic(err)
+	var res CranResponse
+	if err := json.Unmarshal(api.ReadResponse(resp), &res); err != nil {
+		util.DieProtocol("%s: %s", api.Endpoint(resp), err)
 	}
+	return res
 }
 
 // SearchPackages searches for the top (<= 50) package results
@@ -3,9 +3,10 @@ package rlang
 import (
 	"context"
 	"encoding/json"
-	"io"
 	"os"
 
+	"github.com/replit/upm/internal/specedit"
+	"github.com/replit/upm/internal/util"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 )
 
@@ -30,107 +31,68 @@ func (config RConfig) hasPackage(pkg RPackage) bool {
 	return false
 }
 
-// RAdd adds an external package dependency
-func RAdd(ctx context.Context, pkg RPackage) {
-	span, ctx := tracer.StartSpanFromContext(ctx, "RAdd")
-	defer span.Finish()
-	if file, err := os.Open("./Rconfig.json"); err == nil {
-		var config RConfig
-
-		decoder := json.NewDecoder(file)
-
-		if err = decoder.Decode(&config); err != nil {
-			panic(err)
-		}
-
-		if config.hasPackage(pkg) {
-			return
-		}
-
-		file.Close()
-
-		file, err = os.Create("./Rconfig.json")
-		if err != nil {
-			panic(err)
-		}
-
-		encoder := json.NewEncoder(file)
-		encoder.SetIndent("", "\t")
-
-		config.Packages = append(config.Packages, pkg)
-
-		err = encoder.Encode(&config)
-		if err != nil {
-			panic(err)
-		}
-
-		file.Close()
-	} else if os.IsNotExist(err) {
-		file, err := os.Create("./Rconfig.json")
-		if err != nil {
-			panic(err)
-		}
-
-		_, err = file.WriteString("{\n\t\"packages\": []\n}")
-		if err != nil {
-			panic(err)
-		}
-
-		file.Close()
-
-		RAdd(ctx, pkg)
-	} else {
+// writeRConfig writes config to filename, in the same format as the
+// encoder that used to write it directly.
+func writeRConfig(filename string, config RConfig) {
+	contents, err := json.MarshalIndent(&config, "", "\t")
+	if err != nil {
 		panic(err)
 	}
+	util.TryWriteAtomic(filename, append(contents, '\n'))
 }
 
-// RRemove removes an extenal package dependency
-func RRemove(ctx context.Context, pkg RPackage) {
+// RAdd adds an external package dependency. An existing spec file is
+// edited in place, so that its formatting is kept.
+func RAdd(ctx context.Context, pkg RPackage) {
 	//nolint:ineffassign,wastedassign,staticcheck
-	span, ctx := tracer.StartSpanFromContext(ctx, "RRemove")
+	span, ctx := tracer.StartSpanFromContext(ctx, "RAdd")
 	defer span.Finish()
-	file, err := os.Open("./Rconfig.json")
-	if err != nil {
+	contents, err := os.ReadFile("./Rconfig.json")
+	if os.IsNotExist(err) {
+		writeRConfig("./Rconfig.json", RConfig{Packages: []RPackage{pkg}})
+		return
+	} else if err != nil {
 		panic(err)
 	}
 
 	var config RConfig
-
-	decoder := json.NewDecoder(file)
-
-	if err = decoder.Decode(&config); err != nil {
-		file.Close()
+	if err := json.Unmarshal(contents, &config); err != nil {
 		panic(err)
 	}
-
-	if !config.hasPackage(pkg) {
-		file.Close()
+	if config.hasPackage(pkg) {
 		return
 	}
 
-	file.Close()
-
-	file, err = os.Create("./Rconfig.json")
+	contents, err = specedit.AppendJSON(contents, []string{"packages"}, pkg)
 	if err != nil {
-		panic(err)
+		util.DieProtocol("Rconfig.json: %s", err)
 	}
+	util.TryWriteAtomic("./Rconfig.json", contents)
+}
 
-	encoder := json.NewEncoder(file)
-	encoder.SetIndent("", "\t")
+// RRemove removes an extenal package dependency
+func RRemove(ctx context.Context, pkg RPackage) {
+	//nolint:ineffassign,wastedassign,staticcheck
+	span, ctx := tracer.StartSpanFromContext(ctx, "RRemove")
+	defer span.Finish()
+	config := RGetSpecFile()
 
-	for index, installed := range config.Packages {
-		if installed.Name == pkg.Name {
-			config.Packages = append(config.Packages[:index], config.Packages[index+1:]...)
-			break
-		}
+	if !config.hasPackage(pkg) {
+		return
 	}
 
-	err = encoder.Encode(&config)
+	contents, err := os.ReadFile("./Rconfig.json")
 	if err != nil {
 		panic(err)
 	}
-
-	file.Close()
+	contents, err = specedit.FilterJSON(contents, []string{"packages"}, func(elem []byte) bool {
+		var installed RPackage
+		return json.Unmarshal(elem, &installed) != nil || installed.Name != pkg.Name
+	})
+	if err != nil {
+		util.DieProtocol("Rconfig.json: %s", err)
+	}
+	util.TryWriteAtomic("./Rconfig.json", contents)
 }
 
 // RLock backs up the contents of the spec file to the lock file
@@ -138,28 +100,12 @@ func RLock(ctx context.Context) {
 	//nolint:ineffassign,wastedassign,staticcheck
 	span, ctx := tracer.StartSpanFromContext(ctx, "RLock")
 	defer span.Finish()
-	lock, err := os.Create("./Rconfig.lock.json")
-	if err != nil {
-		panic(err)
-	}
-
-	defer lock.Close()
-
-	config, err := os.Open("./Rconfig.json")
+	contents, err := os.ReadFile("./Rconfig.json")
 	if err != nil {
 		panic(err)
 	}
 
-	defer config.Close()
-
-	contents, err := io.ReadAll(config)
-	if err != nil {
-		panic(err)
-	}
-
-	if _, err := lock.Write(contents); err != nil {
-		panic(err)
-	}
+	util.TryWriteAtomic("./Rconfig.lock.json", contents)
 }
 
 // RGetSpecFile gets the contents of the spec file
@@ -0,0 +1,28 @@
+package ruby
+
+import "github.com/replit/upm/internal/api"
+
+// rubyCommandPackages implements CommandPackages for Ruby: the
+// commands that Ruby projects commonly run, and the gems that provide
+// them. It is kept by hand, for the commands that guess and 'upm
+// which-provides' should know about.
+var rubyCommandPackages = map[string]api.PkgName{
+	"cap":        "capistrano",
+	"foreman":    "foreman",
+	"guard":      "guard",
+	"jekyll":     "jekyll",
+	"middleman":  "middleman",
+	"pry":        "pry",
+	"puma":       "puma",
+	"rackup":     "rackup",
+	"rails":      "rails",
+	"rake":       "rake",
+	"rerun":      "rerun",
+	"rspec":      "rspec",
+	"rubocop":    "rubocop",
+	"sidekiq":    "sidekiq",
+	"standardrb": "standard",
+	"thin":       "thin",
+	"unicorn":    "unicorn",
+	"yard":       "yard",
+}
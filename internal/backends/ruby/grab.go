@@ -0,0 +1,56 @@
+package ruby
+
+import (
+	"context"
+	"os"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/imports"
+	"github.com/replit/upm/internal/util"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+// requiredGems maps the paths that code requires to the gems that
+// provide them. Since the two are not always the same, only the gems
+// listed here are guessed, as there is no mapping like PyPI's for
+// Python.
+var requiredGems = map[string]api.PkgName{
+	"sinatra":      "sinatra",
+	"sinatra/base": "sinatra",
+	"stripe":       "stripe",
+}
+
+// rubyIgnorePathSegments are the directories that Bundler installs
+// gems in, whose requires are not the project's.
+var rubyIgnorePathSegments = map[string]bool{
+	".bundle": true,
+	"vendor":  true,
+}
+
+// rubyGuess implements Guess for bundler.
+func rubyGuess(ctx context.Context) (map[string][]api.PkgName, bool) {
+	span, ctx := tracer.StartSpanFromContext(ctx, "rubyGuess")
+	defer span.Finish()
+	cwd, err := os.Getwd()
+	if err != nil {
+		util.DieIO("couldn't get working directory: %s", err)
+	}
+
+	required, err := imports.Find(ctx, cwd, imports.Ruby, rubyIgnorePathSegments)
+	if err != nil {
+		util.DieConsistency("couldn't guess imports: %s", err)
+	}
+	return guessGems(required), true
+}
+
+// guessGems returns the gems that provide the paths in required, keyed
+// by their names.
+func guessGems(required map[string]bool) map[string][]api.PkgName {
+	guessed := map[string][]api.PkgName{}
+	for path := range required {
+		if gem, ok := requiredGems[path]; ok {
+			guessed[string(gem)] = []api.PkgName{gem}
+		}
+	}
+	return guessed
+}
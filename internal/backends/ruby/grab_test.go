@@ -0,0 +1,33 @@
+package ruby
+
+import (
+	"context"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/imports"
+)
+
+func TestGuessGems(t *testing.T) {
+	content := `
+require 'sinatra/base'
+require 'json'
+require_relative 'stripe'
+`
+	testDir := t.TempDir()
+	if err := os.WriteFile(path.Join(testDir, "app.rb"), []byte(content), 0o644); err != nil {
+		t.Fatal("failed to write test file", err)
+	}
+
+	required, err := imports.Find(context.Background(), testDir, imports.Ruby, rubyIgnorePathSegments)
+	if err != nil {
+		t.Fatal("Parse failed", err)
+	}
+	expected := map[string][]api.PkgName{"sinatra": {"sinatra"}}
+	if guessed := guessGems(required); !reflect.DeepEqual(guessed, expected) {
+		t.Errorf("expected %v, got %v", expected, guessed)
+	}
+}
@@ -4,7 +4,6 @@ package ruby
 import (
 	"context"
 	"encoding/json"
-	"io"
 	"net/url"
 	"os"
 	"os/exec"
@@ -68,14 +67,21 @@ func getPath() string {
 	}
 }
 
+// bundlerInit implements Init for Bundler with 'bundle init'. A
+// Gemfile has no place for the project's metadata.
+func bundlerInit(ctx context.Context, meta api.ProjectMetadata) {
+	util.RunCmd([]string{"bundle", "init"})
+}
+
 // RubyBackend is a UPM language backend for Ruby using Bundler.
 var RubyBackend = api.LanguageBackend{
 	Name:             "ruby-bundler",
 	Specfile:         "Gemfile",
 	Lockfile:         "Gemfile.lock",
 	IsAvailable:      bundlerIsAvailable,
+	Tools:            []string{"bundle"},
 	FilenamePatterns: []string{"*.rb"},
-	Quirks:           api.QuirksAddRemoveAlsoLocks,
+	Quirks:           api.QuirksAddRemoveAlsoLocks | api.QuirksAddRequiresInit,
 	GetPackageDir: func() string {
 		path := string(util.GetCmdOutput([]string{
 			"bundle", "config", "--parseable", "path"}))
@@ -87,6 +93,10 @@ var RubyBackend = api.LanguageBackend{
 			return path
 		}
 	},
+	Init: bundlerInit,
+	RunScript: func(script string, args []string) []string {
+		return append([]string{"bundle", "exec", script}, args...)
+	},
 	Search: func(query string) []api.PkgInfo {
 		endpoint := "https://rubygems.org/api/v1/search.json"
 		queryParams := "?query=" + url.QueryEscape(query)
@@ -97,14 +107,11 @@ var RubyBackend = api.LanguageBackend{
 		}
 		defer resp.Body.Close()
 
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			util.DieProtocol("RubyGems: %s", err)
-		}
+		body := api.ReadResponse(resp)
 
 		var outputStructs []rubygemsInfo
 		if err := json.Unmarshal(body, &outputStructs); err != nil {
-			util.DieProtocol("RubyGems response: %s", err)
+			util.DieProtocol("%s: %s", api.Endpoint(resp), err)
 		}
 
 		results := []api.PkgInfo{}
@@ -128,7 +135,7 @@ var RubyBackend = api.LanguageBackend{
 				Dependencies:     deps,
 			})
 		}
-		return results
+		return api.CheckSearchResults(api.Endpoint(resp), results)
 	},
 	Info: func(name api.PkgName) api.PkgInfo {
 		endpoint := "https://rubygems.org/api/v1/gems/"
@@ -149,14 +156,11 @@ var RubyBackend = api.LanguageBackend{
 			util.DieNetwork("RubyGems: HTTP status %d", resp.StatusCode)
 		}
 
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			util.DieProtocol("RubyGems: %s", err)
-		}
+		body := api.ReadResponse(resp)
 
 		var s rubygemsInfo
 		if err := json.Unmarshal(body, &s); err != nil {
-			util.DieProtocol("RubyGems response: %s", err)
+			util.DieProtocol("%s: %s", api.Endpoint(resp), err)
 		}
 		deps := []string{}
 		for _, group := range s.Dependencies {
@@ -164,7 +168,7 @@ var RubyBackend = api.LanguageBackend{
 				deps = append(deps, dep.Name)
 			}
 		}
-		return api.PkgInfo{
+		return api.CheckInfo(api.Endpoint(resp), api.PkgInfo{
 			Name:             s.Name,
 			Description:      s.Info,
 			Version:          s.Version,
@@ -175,15 +179,12 @@ var RubyBackend = api.LanguageBackend{
 			Author:           s.Authors,
 			License:          strings.Join(s.Licenses, ", "),
 			Dependencies:     deps,
-		}
+		})
 	},
 	Add: func(ctx context.Context, pkgs map[api.PkgName]api.PkgSpec, projectName string) {
 		//nolint:ineffassign,wastedassign,staticcheck
 		span, ctx := tracer.StartSpanFromContext(ctx, "bundle (init) add")
 		defer span.Finish()
-		if !util.Exists("Gemfile") {
-			util.RunCmd([]string{"bundle", "init"})
-		}
 		args := []string{}
 		for name, spec := range pkgs {
 			if spec == "" {
@@ -232,7 +233,7 @@ var RubyBackend = api.LanguageBackend{
 		}
 		util.RunCmd([]string{"bundle", "install"})
 	},
-	ListSpecfile: func(mergeAllGroups bool) map[api.PkgName]api.PkgSpec {
+	ListSpecfile: func(mergeAllGroups bool) api.PkgDeps {
 		outputB := util.GetCmdOutput([]string{
 			"ruby", "-e", util.GetResource("/ruby/list-specfile.rb"),
 		})
@@ -240,7 +241,7 @@ var RubyBackend = api.LanguageBackend{
 		if err := json.Unmarshal(outputB, &results); err != nil {
 			util.DieProtocol("ruby: %s", err)
 		}
-		return results
+		return api.RuntimeDeps(results)
 	},
 	ListLockfile: func() map[api.PkgName]api.PkgVersion {
 		outputB := util.GetCmdOutput([]string{
@@ -255,18 +256,7 @@ var RubyBackend = api.LanguageBackend{
 	GuessRegexps: util.Regexps([]string{
 		`require\s*['"]([^'"]+)['"]`,
 	}),
-	Guess: func(ctx context.Context) (map[string][]api.PkgName, bool) {
-		//nolint:ineffassign,wastedassign,staticcheck
-		span, ctx := tracer.StartSpanFromContext(ctx, "guess-gems.rb")
-		defer span.Finish()
-		guessedGems := util.GetCmdOutput([]string{
-			"ruby", "-e", util.GetResource("/ruby/guess-gems.rb"),
-		})
-		results := map[string][]api.PkgName{}
-		if err := json.Unmarshal(guessedGems, &results); err != nil {
-			util.DieProtocol("ruby: %s", err)
-		}
-		return results, true
-	},
+	Guess:                              rubyGuess,
+	CommandPackages:                    rubyCommandPackages,
 	InstallReplitNixSystemDependencies: nix.DefaultInstallReplitNixSystemDependencies,
 }
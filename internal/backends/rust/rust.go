@@ -4,7 +4,6 @@ package rust
 import (
 	"context"
 	"encoding/json"
-	"io"
 	"net/url"
 	"os"
 	"os/exec"
@@ -97,14 +96,11 @@ func search(query string) []api.PkgInfo {
 	}
 	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		util.DieProtocol("crates.io: %s", err)
-	}
+	body := api.ReadResponse(resp)
 
 	var crateResults crateSearchResults
 	if err := json.Unmarshal(body, &crateResults); err != nil {
-		util.DieProtocol("crates.io: %s", err)
+		util.DieProtocol("%s: %s", api.Endpoint(resp), err)
 	}
 
 	var pkgs []api.PkgInfo
@@ -115,7 +111,7 @@ func search(query string) []api.PkgInfo {
 		pkgs = append(pkgs, crateInfo.toPkgInfo())
 	}
 
-	return pkgs
+	return api.CheckSearchResults(api.Endpoint(resp), pkgs)
 }
 
 func info(name api.PkgName) api.PkgInfo {
@@ -137,17 +133,14 @@ func info(name api.PkgName) api.PkgInfo {
 		util.DieNetwork("crates.io: HTTP status %d", resp.StatusCode)
 	}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		util.DieProtocol("crates.io: could not read response: %s", err)
-	}
+	body := api.ReadResponse(resp)
 
 	var crateInfo crateInfoResult
 	if err := json.Unmarshal(body, &crateInfo); err != nil {
-		util.DieProtocol("crates.io: %s", err)
+		util.DieProtocol("%s: %s", api.Endpoint(resp), err)
 	}
 
-	return crateInfo.toPkgInfo()
+	return api.CheckInfo(api.Endpoint(resp), crateInfo.toPkgInfo())
 }
 
 func listSpecfile(mergeAllGroups bool) map[api.PkgName]api.PkgSpec {
@@ -231,6 +224,7 @@ var RustBackend = api.LanguageBackend{
 	Specfile:         "Cargo.toml",
 	Lockfile:         "Cargo.lock",
 	IsAvailable:      cargoIsAvailable,
+	Tools:            []string{"cargo"},
 	FilenamePatterns: []string{"*.rs"},
 	GetPackageDir: func() string {
 		return "target"
@@ -270,11 +264,9 @@ var RustBackend = api.LanguageBackend{
 	Install: func(ctx context.Context) {
 		// Dependencies are installed at build time
 	},
-	ListSpecfile: listSpecfile,
-	ListLockfile: listLockfile,
-	Guess: func(ctx context.Context) (map[string][]api.PkgName, bool) {
-		util.NotImplemented()
-		return nil, false
+	ListSpecfile: func(mergeAllGroups bool) api.PkgDeps {
+		return api.RuntimeDeps(listSpecfile(mergeAllGroups))
 	},
+	ListLockfile:                       listLockfile,
 	InstallReplitNixSystemDependencies: nix.DefaultInstallReplitNixSystemDependencies,
 }
@@ -0,0 +1,313 @@
+// Package backendtest is a conformance suite for language backends.
+// It checks that the quirks of a backend are consistent, that its
+// lockfile parser still reads fixture projects the way it did when
+// their snapshots were taken, and, when the network may be used, that
+// adding and removing packages round-trips through the specfile and
+// lockfile.
+//
+// Fixture projects are laid out like test-suite/templates: a directory
+// per backend, named after it, with a directory per project inside,
+// such as nodejs-npm/one-dep. A new backend gets the whole suite by
+// adding its fixtures and running
+//
+//	go test ./internal/backendtest -run 'TestBackends/<name>' -update
+//
+// to write its lockfile snapshots, which are then reviewed and checked
+// in.
+package backendtest
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/util"
+)
+
+// update makes the suite write lockfile snapshots instead of comparing
+// with them.
+var update = flag.Bool("update", false, "update the lockfile snapshots of backendtest")
+
+// NetworkEnv is the environment variable that lets the suite use the
+// network, which the roundtrip needs to add packages.
+const NetworkEnv = "UPM_BACKENDTEST_NETWORK"
+
+// Suite is the conformance suite for one backend.
+type Suite struct {
+	Backend api.LanguageBackend
+
+	// Fixtures holds the fixture projects, a directory per backend
+	// with a directory per project inside.
+	Fixtures fs.FS
+
+	// Golden is the directory the lockfile snapshots are kept in,
+	// as <backend>/<project>.golden.
+	Golden string
+
+	// Packages are added to and removed from the no-deps fixture
+	// by the roundtrip. Without any, the roundtrip is skipped.
+	Packages []string
+}
+
+// Run runs the whole suite as subtests of t.
+func (s Suite) Run(t *testing.T) {
+	t.Run("quirks", s.TestQuirks)
+	t.Run("lockfile", s.TestLockfiles)
+	t.Run("roundtrip", s.TestRoundtrip)
+}
+
+// CheckQuirks returns the ways in which the quirks of b contradict
+// each other or the operations b implements, beyond the mandatory
+// fields that Setup checks.
+func CheckQuirks(b *api.LanguageBackend) []string {
+	problems := []string{}
+	if err := catchPanic(b.Setup); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if b.QuirksDoesAddRemoveAlsoLock() && b.QuirksDoesLockAlsoInstall() && b.QuirksDoesAddRemoveNotAlsoInstall() {
+		problems = append(problems, "add and remove lock, and lock installs, so they also install")
+	}
+	if b.Quirks&api.QuirkRemoveNeedsLockfile != 0 && b.QuirksIsNotReproducible() {
+		problems = append(problems, "remove needs a lockfile, but there is no lock")
+	}
+	return problems
+}
+
+// TestQuirks fails if the quirks of the backend are inconsistent.
+func (s Suite) TestQuirks(t *testing.T) {
+	b := s.Backend
+	for _, problem := range CheckQuirks(&b) {
+		t.Errorf("%s: %s", b.Name, problem)
+	}
+}
+
+// Projects returns the names of the fixture projects of backend in
+// fixtures, sorted.
+func Projects(fixtures fs.FS, backend string) []string {
+	entries, err := fs.ReadDir(fixtures, backend)
+	if err != nil {
+		return nil
+	}
+	projects := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			projects = append(projects, entry.Name())
+		}
+	}
+	sort.Strings(projects)
+	return projects
+}
+
+// Chdir copies the fixture project to a temporary directory and makes
+// it the working directory for the rest of the test, since backends
+// work on the project in the current directory.
+func Chdir(t *testing.T, fixtures fs.FS, backend, project string) string {
+	t.Helper()
+	dir := t.TempDir()
+	root := path.Join(backend, project)
+	err := fs.WalkDir(fixtures, root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(dir, filepath.FromSlash(strings.TrimPrefix(p, root)))
+		if d.IsDir() {
+			return os.MkdirAll(dst, 0o755)
+		}
+		src, err := fixtures.Open(p)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		f, err := os.Create(dst)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(f, src); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	})
+	if err != nil {
+		t.Fatalf("copying fixture %s: %v", root, err)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+	return dir
+}
+
+// snapshot renders the parsed lockfile one "name version" line per
+// package, sorted, so that snapshots diff well.
+func snapshot(locked map[api.PkgName]api.PkgVersion) string {
+	lines := []string{}
+	for name, version := range locked {
+		lines = append(lines, fmt.Sprintf("%s %s\n", name, version))
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "")
+}
+
+// TestLockfiles parses the lockfile of every fixture project that has
+// one and compares the result with its snapshot, or writes the
+// snapshot with -update. Backends whose parser fails because their
+// tool is not installed are skipped.
+func (s Suite) TestLockfiles(t *testing.T) {
+	b := s.Backend
+	if b.QuirksIsNotReproducible() {
+		t.Skipf("%s has no lockfile", b.Name)
+	}
+	// The fixtures are parsed in another directory.
+	goldenDir, err := filepath.Abs(s.Golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, project := range Projects(s.Fixtures, b.Name) {
+		project := project
+		if _, err := fs.Stat(s.Fixtures, path.Join(b.Name, project, b.Lockfile)); err != nil {
+			continue
+		}
+		t.Run(project, func(t *testing.T) {
+			Chdir(t, s.Fixtures, b.Name, project)
+			var locked map[api.PkgName]api.PkgVersion
+			if err := util.Catch(func() { locked = b.ListLockfile() }); err != nil {
+				if !b.IsAvailable() {
+					t.Skipf("%s is not available: %v", b.Name, err)
+				}
+				t.Fatalf("parsing %s: %v", b.Lockfile, err)
+			}
+
+			golden := filepath.Join(goldenDir, b.Name, project+".golden")
+			got := snapshot(locked)
+			if *update {
+				if err := os.MkdirAll(filepath.Dir(golden), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			expected, err := os.ReadFile(golden)
+			if os.IsNotExist(err) {
+				t.Fatalf("no snapshot %s; run the test with -update to write it", golden)
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(expected) {
+				t.Errorf("%s parses differently from %s:\n%s", b.Lockfile, golden, util.UnifiedDiff(golden, string(expected), got))
+			}
+		})
+	}
+}
+
+// TestRoundtrip adds the packages of the suite to the no-deps fixture
+// project, checks that they are listed in the specfile and lockfile,
+// removes them again and checks that they are gone. It needs the
+// package manager and the network, which it only uses if NetworkEnv is
+// set.
+func (s Suite) TestRoundtrip(t *testing.T) {
+	b := s.Backend
+	switch {
+	case len(s.Packages) == 0:
+		t.Skipf("no packages to add with %s", b.Name)
+	case os.Getenv(NetworkEnv) == "":
+		t.Skipf("set %s=1 to add packages with %s", NetworkEnv, b.Name)
+	case !b.IsAvailable():
+		t.Skipf("%s is not available", b.Name)
+	}
+	if _, err := fs.Stat(s.Fixtures, path.Join(b.Name, "no-deps")); err != nil {
+		t.Skipf("%s has no no-deps fixture", b.Name)
+	}
+	Chdir(t, s.Fixtures, b.Name, "no-deps")
+	ctx := context.Background()
+
+	specs := map[api.PkgName]api.PkgSpec{}
+	for name, coords := range b.NormalizePackageArgs(s.Packages) {
+		specs[name] = coords.Spec
+	}
+	names := map[api.PkgName]bool{}
+	for name := range specs {
+		names[name] = true
+	}
+
+	run := func(op string, fn func()) {
+		t.Helper()
+		if err := util.Catch(fn); err != nil {
+			t.Fatalf("%s: %v", op, err)
+		}
+	}
+	listed := func(name api.PkgName) (inSpecfile, inLockfile bool) {
+		for dep := range b.ListSpecfile(true) {
+			if b.NormalizePackageName(dep) == name {
+				inSpecfile = true
+			}
+		}
+		if b.QuirksIsReproducible() {
+			for dep := range b.ListLockfile() {
+				if b.NormalizePackageName(dep) == name {
+					inLockfile = true
+				}
+			}
+		}
+		return inSpecfile, inLockfile
+	}
+
+	run("add", func() {
+		b.Add(ctx, specs, "")
+		if b.QuirksIsReproducible() && b.QuirksDoesAddRemoveNotAlsoLock() {
+			b.Lock(ctx)
+		}
+	})
+	for name := range names {
+		inSpecfile, inLockfile := listed(name)
+		if !inSpecfile {
+			t.Errorf("%s is not in %s after add", name, b.Specfile)
+		}
+		if b.QuirksIsReproducible() && !inLockfile {
+			t.Errorf("%s is not in %s after add", name, b.Lockfile)
+		}
+	}
+
+	run("remove", func() {
+		b.Remove(ctx, names)
+		if b.QuirksIsReproducible() && b.QuirksDoesAddRemoveNotAlsoLock() {
+			b.Lock(ctx)
+		}
+	})
+	for name := range names {
+		inSpecfile, inLockfile := listed(name)
+		if inSpecfile {
+			t.Errorf("%s is still in %s after remove", name, b.Specfile)
+		}
+		if inLockfile {
+			t.Errorf("%s is still in %s after remove", name, b.Lockfile)
+		}
+	}
+}
+
+// catchPanic runs fn and returns what it panicked with as an error.
+func catchPanic(fn func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	fn()
+	return nil
+}
@@ -0,0 +1,80 @@
+package backendtest
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/backends"
+	"github.com/replit/upm/test-suite/templates"
+)
+
+// roundtripPackages are the packages the roundtrip adds with each
+// backend.
+var roundtripPackages = map[string][]string{
+	"bun":            {"left-pad"},
+	"nodejs-npm":     {"left-pad"},
+	"nodejs-pnpm":    {"left-pad"},
+	"nodejs-yarn":    {"left-pad"},
+	"python3-pip":    {"six"},
+	"python3-poetry": {"six"},
+	"python3-uv":     {"six"},
+}
+
+func TestBackends(t *testing.T) {
+	for _, b := range backends.GetBackends("") {
+		b := b
+		t.Run(b.Name, func(t *testing.T) {
+			Suite{
+				Backend:  b,
+				Fixtures: templates.FS,
+				Golden:   "testdata",
+				Packages: roundtripPackages[b.Name],
+			}.Run(t)
+		})
+	}
+}
+
+func TestCheckQuirks(t *testing.T) {
+	b := api.LanguageBackend{
+		Name:             "broken",
+		Specfile:         "deps.txt",
+		FilenamePatterns: []string{"*.x"},
+		Quirks:           api.QuirksNotReproducible | api.QuirkRemoveNeedsLockfile,
+		GetPackageDir:    func() string { return "" },
+		Add:              func(ctx context.Context, pkgs map[api.PkgName]api.PkgSpec, projectName string) {},
+		Remove:           func(ctx context.Context, pkgs map[api.PkgName]bool) {},
+		IsAvailable:      func() bool { return true },
+		Install:          func(ctx context.Context) {},
+		ListSpecfile:     func(mergeAllGroups bool) api.PkgDeps { return nil },
+	}
+	expected := []string{"remove needs a lockfile, but there is no lock"}
+	if problems := CheckQuirks(&b); !reflect.DeepEqual(problems, expected) {
+		t.Errorf("expected %v, got %v", expected, problems)
+	}
+
+	b.Lockfile = "deps.lock"
+	b.Lock = func(ctx context.Context) {}
+	b.ListLockfile = func() map[api.PkgName]api.PkgVersion { return nil }
+	b.Quirks = api.QuirksAddRemoveAlsoLocks | api.QuirksLockAlsoInstalls
+	expected = []string{"add and remove lock, and lock installs, so they also install"}
+	if problems := CheckQuirks(&b); !reflect.DeepEqual(problems, expected) {
+		t.Errorf("expected %v, got %v", expected, problems)
+	}
+
+	b.Lock = nil
+	if problems := CheckQuirks(&b); len(problems) != 2 {
+		t.Errorf("expected Setup to reject a missing Lock, got %v", problems)
+	}
+
+	b.Lock = func(ctx context.Context) {}
+	b.Quirks = api.QuirksAddRequiresInit
+	if problems := CheckQuirks(&b); len(problems) != 1 {
+		t.Errorf("expected Setup to reject a missing Init, got %v", problems)
+	}
+	b.Init = func(ctx context.Context, meta api.ProjectMetadata) {}
+	if problems := CheckQuirks(&b); len(problems) != 0 {
+		t.Errorf("expected no problems, got %v", problems)
+	}
+}
@@ -0,0 +1,203 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/backends"
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/table"
+	"github.com/replit/upm/internal/util"
+	"github.com/replit/upm/internal/workspace"
+)
+
+// benchPhases are the operations 'upm bench' times, in the order they
+// run.
+var benchPhases = []string{"list", "lock", "install"}
+
+// benchResult is the outcome of benchmarking one backend. The JSON
+// form is what --format json emits.
+type benchResult struct {
+	Backend string `json:"backend"`
+
+	// Seconds are the times of each run, by phase.
+	Seconds map[string][]float64 `json:"seconds"`
+
+	// Error is why the backend failed, which ends its runs.
+	Error string `json:"error,omitempty"`
+}
+
+// median returns the median of the times of a phase, or -1 if it never
+// ran.
+func (r benchResult) median(phase string) float64 {
+	times := append([]float64{}, r.Seconds[phase]...)
+	if len(times) == 0 {
+		return -1
+	}
+	sort.Float64s(times)
+	if len(times)%2 == 1 {
+		return times[len(times)/2]
+	}
+	return (times[len(times)/2-1] + times[len(times)/2]) / 2
+}
+
+// benchBackends returns the backends to compare: those matching
+// language, or else the detected backend and the others that read the
+// same specfile, such as npm, Yarn and pnpm for package.json.
+func benchBackends(ctx context.Context, language string) []api.LanguageBackend {
+	if language != "" {
+		matching := backends.GetBackends(language)
+		if len(matching) == 0 {
+			util.DieConsistency("no such language: %s", language)
+		}
+		return matching
+	}
+	detected := backends.GetBackend(ctx, "")
+	compared := []api.LanguageBackend{}
+	for _, b := range backends.GetBackends("") {
+		if b.Specfile == detected.Specfile {
+			compared = append(compared, b)
+		}
+	}
+	return compared
+}
+
+// copyProject copies the sources of the project in the current
+// directory to dir, leaving out installed packages, hidden directories
+// and the files in skipped, such as lockfiles.
+func copyProject(dir string, skipped map[string]bool) error {
+	return filepath.WalkDir(".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != "." && workspace.IsSkippedDir(d.Name()) {
+				return filepath.SkipDir
+			}
+			return os.MkdirAll(filepath.Join(dir, path), 0o755)
+		}
+		if !d.Type().IsRegular() || skipped[path] {
+			return nil
+		}
+		src, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		dst, err := os.Create(filepath.Join(dir, path))
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(dst, src); err != nil {
+			dst.Close()
+			return err
+		}
+		return dst.Close()
+	})
+}
+
+// benchRun times the phases of b once, in a fresh copy of the project
+// without any of the lockfiles in skipped, so that every backend
+// starts from the same state.
+func benchRun(ctx context.Context, b api.LanguageBackend, skipped map[string]bool, result *benchResult) {
+	dir := util.TempDir()
+	defer os.RemoveAll(dir)
+	if err := copyProject(dir, skipped); err != nil {
+		util.DieIO("%s", err)
+	}
+	inDir(dir, func() {
+		for _, phase := range benchPhases {
+			start := time.Now()
+			switch phase {
+			case "list":
+				b.ListSpecfile(true)
+			case "lock":
+				b.Lock(ctx)
+			case "install":
+				b.Install(ctx)
+			}
+			result.Seconds[phase] = append(result.Seconds[phase], time.Since(start).Seconds())
+		}
+	})
+}
+
+// runBench implements 'upm bench'.
+func runBench(language string, runs int, outputFormat outputFormat) {
+	ctx := context.Background()
+	bs := benchBackends(ctx, language)
+
+	// Every backend locks from scratch, so the lockfiles of all of
+	// them are left out of the copies of the project, and
+	// environments are kept in the copies so that they go away
+	// with them.
+	skipped := map[string]bool{}
+	for _, b := range bs {
+		skipped[b.Lockfile] = true
+	}
+	applyInProject()
+
+	results := []benchResult{}
+	for _, b := range bs {
+		result := benchResult{Backend: b.Name, Seconds: map[string][]float64{}}
+		if !b.IsAvailable() {
+			result.Error = "not available"
+			results = append(results, result)
+			continue
+		}
+		util.Log(fmt.Sprintf("==> %s", b.Name))
+		// The output of the package managers would drown the
+		// results; it is still shown if they fail.
+		quiet := config.Quiet
+		config.Quiet = true
+		for i := 0; i < runs && result.Error == ""; i++ {
+			if err := util.Catch(func() { benchRun(ctx, b, skipped, &result) }); err != nil {
+				result.Error = err.Error()
+			}
+		}
+		config.Quiet = quiet
+		results = append(results, result)
+	}
+
+	switch outputFormat {
+	case outputFormatTable:
+		headers := append([]string{"backend"}, benchPhases...)
+		t := table.New(append(headers, "total", "error")...)
+		for _, result := range results {
+			row := []string{result.Backend}
+			total := "-"
+			sum := 0.0
+			for _, phase := range benchPhases {
+				median := result.median(phase)
+				if median < 0 {
+					row = append(row, "-")
+					continue
+				}
+				sum += median
+				total = formatSeconds(sum)
+				row = append(row, formatSeconds(median))
+			}
+			row = append(row, total, result.Error)
+			t.AddRow(row...)
+		}
+		t.Print()
+		util.Log(fmt.Sprintf("median of %d runs", runs))
+
+	case outputFormatJSON:
+		outputB, err := json.Marshal(results)
+		if err != nil {
+			panic("couldn't marshal json")
+		}
+		fmt.Println(string(outputB))
+
+	default:
+		util.Panicf("unknown output format %d", outputFormat)
+	}
+}
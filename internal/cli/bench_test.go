@@ -0,0 +1,60 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestCopyProject(t *testing.T) {
+	src := t.TempDir()
+	for _, name := range []string{"package.json", "yarn.lock", "src/index.js", "node_modules/left-pad/index.js", ".git/HEAD"} {
+		path := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dst := t.TempDir()
+	inDir(src, func() {
+		if err := copyProject(dst, map[string]bool{"yarn.lock": true}); err != nil {
+			t.Fatal(err)
+		}
+	})
+	copied := []string{}
+	_ = filepath.Walk(dst, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			rel, _ := filepath.Rel(dst, path)
+			copied = append(copied, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	sort.Strings(copied)
+	if !reflect.DeepEqual(copied, []string{"package.json", "src/index.js"}) {
+		t.Errorf("unexpected files copied: %v", copied)
+	}
+	if contents, _ := os.ReadFile(filepath.Join(dst, "src", "index.js")); string(contents) != "src/index.js" {
+		t.Errorf("unexpected contents %q", contents)
+	}
+}
+
+func TestBenchMedian(t *testing.T) {
+	result := benchResult{Seconds: map[string][]float64{
+		"lock":    {3, 1, 2},
+		"install": {4, 1, 2, 10},
+	}}
+	if got := result.median("lock"); got != 2 {
+		t.Errorf("expected a median of 2, got %v", got)
+	}
+	if got := result.median("install"); got != 3 {
+		t.Errorf("expected a median of 3, got %v", got)
+	}
+	if got := result.median("list"); got != -1 {
+		t.Errorf("expected no median, got %v", got)
+	}
+}
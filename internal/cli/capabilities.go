@@ -0,0 +1,236 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/backends"
+	"github.com/replit/upm/internal/table"
+	"github.com/replit/upm/internal/util"
+)
+
+// toolVersion is an external program run by a backend, as reported
+// by 'upm show-capabilities'. Version is empty if the program was not
+// found on PATH.
+type toolVersion struct {
+	Name    string `json:"name"`
+	Path    string `json:"path,omitempty"`
+	Version string `json:"version,omitempty"`
+}
+
+// backendCapabilities is the JSON form of one backend in 'upm
+// show-capabilities'.
+type backendCapabilities struct {
+	Name        string        `json:"name"`
+	Available   bool          `json:"available"`
+	Supported   []string      `json:"supported"`
+	Unsupported []string      `json:"unsupported"`
+	Quirks      []string      `json:"quirks"`
+	Tools       []toolVersion `json:"tools"`
+}
+
+// capabilitiesRow is the table form of backendCapabilities.
+type capabilitiesRow struct {
+	Name        string   `pretty:"Backend"`
+	Available   string   `pretty:"Available"`
+	Unsupported []string `pretty:"Unsupported"`
+	Quirks      []string `pretty:"Quirks"`
+	Tools       []string `pretty:"Tools"`
+}
+
+// backendOperations returns whether the backend implements each of
+// the optional operations, in the order they are reported.
+func backendOperations(b api.LanguageBackend) []struct {
+	name      string
+	supported bool
+} {
+	return []struct {
+		name      string
+		supported bool
+	}{
+		{"search", b.Search != nil},
+		{"info", b.Info != nil},
+		{"init", b.Init != nil},
+		{"add", b.Add != nil},
+		{"add-from-source", b.SpecForSource != nil},
+		{"remove", b.Remove != nil},
+		{"lock", b.Lock != nil},
+		{"install", b.Install != nil},
+		{"fetch", b.Fetch != nil},
+		{"list-specfile", b.ListSpecfile != nil},
+		{"list-lockfile", b.ListLockfile != nil},
+		{"guess", b.Guess != nil},
+		{"guess-commands", b.CommandPackages != nil},
+		{"dev-dependencies", b.SupportsDev},
+		{"dependency-groups", b.SupportsGroups},
+		{"reasons", b.SupportsReasons},
+		{"check-orphans", b.ListLockfileGraph != nil},
+		{"dedupe", b.ListLockfileCopies != nil},
+		{"validate-spec", b.ValidateSpec != nil},
+		{"verify", b.VerifyInstalled != nil},
+		{"verify-reproducible", b.Relock != nil},
+		{"list-installed", b.ListInstalled != nil},
+		{"list-stale", b.ListReleases != nil},
+		{"deprecations", b.ListDeprecated != nil},
+		{"readme", b.FetchReadme != nil},
+		{"type-companions", b.TypeCompanions != nil},
+		{"size", b.InstalledSizes != nil},
+		{"run", b.RunScript != nil},
+		{"list-scripts", b.ListScripts != nil},
+		{"override", b.SetOverride != nil},
+		{"patch", b.InstalledFiles != nil},
+		{"vendor", b.ListLockfileArtifacts != nil},
+		{"clean-cache", b.CacheDirs != nil},
+	}
+}
+
+// supportsOperation returns whether the backend supports op, which is
+// one of the names listed by backendOperations.
+func supportsOperation(b api.LanguageBackend, op string) bool {
+	for _, candidate := range backendOperations(b) {
+		if candidate.name == op {
+			return candidate.supported
+		}
+	}
+	util.Panicf("unknown operation %s", op)
+	return false
+}
+
+// dieUnsupported terminates the process because b does not support
+// op, suggesting the backends for the same language that do.
+func dieUnsupported(b api.LanguageBackend, op string) {
+	language, _, _ := strings.Cut(b.Name, "-")
+	alternatives := []string{}
+	for _, other := range backends.GetBackends(language) {
+		if other.Name != b.Name && supportsOperation(other, op) {
+			alternatives = append(alternatives, other.Name)
+		}
+	}
+
+	msg := fmt.Sprintf("%s does not support %s", b.Name, op)
+	if len(alternatives) > 0 {
+		msg += fmt.Sprintf(" (supported by %s; choose one with --lang)", strings.Join(alternatives, ", "))
+	}
+	util.DieUnimplemented("%s; see 'upm show-capabilities'", msg)
+}
+
+// backendQuirks names the quirks of the backend.
+func backendQuirks(b api.LanguageBackend) []string {
+	quirks := []string{}
+	if b.QuirksIsNotReproducible() {
+		quirks = append(quirks, "not-reproducible")
+	}
+	if b.QuirksDoesAddRemoveAlsoLock() {
+		quirks = append(quirks, "add-remove-also-locks")
+	}
+	if b.QuirksDoesAddRemoveAlsoInstall() {
+		quirks = append(quirks, "add-remove-also-installs")
+	}
+	if b.QuirksDoesLockAlsoInstall() {
+		quirks = append(quirks, "lock-also-installs")
+	}
+	if b.Quirks&api.QuirkRemoveNeedsLockfile != 0 {
+		quirks = append(quirks, "remove-needs-lockfile")
+	}
+	if b.QuirksDoesAddRequireInit() {
+		quirks = append(quirks, "add-requires-init")
+	}
+	if b.QuirksIsSpecfileEditedDirectly() {
+		quirks = append(quirks, "specfile-edited-directly")
+	}
+	return quirks
+}
+
+// detectTool finds a program on PATH and asks it for its version,
+// taking the first line it prints for --version.
+func detectTool(name string) toolVersion {
+	tool := toolVersion{Name: name}
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return tool
+	}
+	tool.Path = path
+	output, err := exec.Command(path, "--version").CombinedOutput()
+	if err != nil {
+		tool.Version = "unknown"
+		return tool
+	}
+	tool.Version, _, _ = strings.Cut(strings.TrimSpace(string(output)), "\n")
+	return tool
+}
+
+// getCapabilities introspects a backend without running any of its
+// operations.
+func getCapabilities(b api.LanguageBackend) backendCapabilities {
+	caps := backendCapabilities{
+		Name:        b.Name,
+		Available:   b.IsAvailable(),
+		Supported:   []string{},
+		Unsupported: []string{},
+		Quirks:      backendQuirks(b),
+		Tools:       []toolVersion{},
+	}
+	for _, op := range backendOperations(b) {
+		if op.supported {
+			caps.Supported = append(caps.Supported, op.name)
+		} else {
+			caps.Unsupported = append(caps.Unsupported, op.name)
+		}
+	}
+	for _, tool := range b.Tools {
+		caps.Tools = append(caps.Tools, detectTool(tool))
+	}
+	return caps
+}
+
+// runShowCapabilities implements 'upm show-capabilities'.
+func runShowCapabilities(language string, outputFormat outputFormat) {
+	bs := backends.GetBackends(language)
+	if len(bs) == 0 {
+		util.DieConsistency("no such language: %s", language)
+	}
+
+	results := []backendCapabilities{}
+	for _, b := range bs {
+		results = append(results, getCapabilities(b))
+	}
+
+	switch outputFormat {
+	case outputFormatTable:
+		rows := []capabilitiesRow{}
+		for _, caps := range results {
+			row := capabilitiesRow{
+				Name:        caps.Name,
+				Available:   "no",
+				Unsupported: caps.Unsupported,
+				Quirks:      caps.Quirks,
+			}
+			if caps.Available {
+				row.Available = "yes"
+			}
+			for _, tool := range caps.Tools {
+				if tool.Version == "" {
+					row.Tools = append(row.Tools, tool.Name+" (not found)")
+				} else {
+					row.Tools = append(row.Tools, tool.Version)
+				}
+			}
+			rows = append(rows, row)
+		}
+		t := table.FromStructs(rows)
+		t.Print()
+
+	case outputFormatJSON:
+		outputB, err := json.Marshal(results)
+		if err != nil {
+			panic("couldn't marshal json")
+		}
+		fmt.Println(string(outputB))
+
+	default:
+		util.Panicf("unknown output format %d", outputFormat)
+	}
+}
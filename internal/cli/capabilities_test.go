@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/backends/python"
+	"github.com/replit/upm/internal/util"
+)
+
+func TestGetCapabilities(t *testing.T) {
+	b := api.LanguageBackend{
+		Name:             "test",
+		Specfile:         "spec",
+		FilenamePatterns: []string{"*"},
+		Quirks:           api.QuirksNotReproducible | api.QuirksAddRemoveAlsoLocks,
+		GetPackageDir:    func() string { return "" },
+		Search:           func(string) []api.PkgInfo { return nil },
+		Info:             func(api.PkgName) api.PkgInfo { return api.PkgInfo{} },
+		Add:              func(context.Context, map[api.PkgName]api.PkgSpec, string) {},
+		Remove:           func(context.Context, map[api.PkgName]bool) {},
+		Install:          func(context.Context) {},
+		IsAvailable:      func() bool { return false },
+		ListSpecfile:     func(bool) api.PkgDeps { return api.PkgDeps{} },
+		SupportsDev:      true,
+		Tools:            []string{"upm-test-no-such-tool"},
+	}
+
+	expected := backendCapabilities{
+		Name:      "test",
+		Available: false,
+		Supported: []string{
+			"search", "info", "add", "remove", "install",
+			"list-specfile", "dev-dependencies",
+		},
+		Unsupported: []string{
+			"init", "add-from-source", "lock", "fetch", "list-lockfile", "guess", "guess-commands", "dependency-groups",
+			"reasons", "check-orphans", "dedupe", "validate-spec", "verify", "verify-reproducible", "list-installed", "list-stale", "deprecations", "readme", "type-companions", "size",
+			"run", "list-scripts", "override", "patch", "vendor", "clean-cache",
+		},
+		Quirks: []string{"not-reproducible", "add-remove-also-locks"},
+		Tools:  []toolVersion{{Name: "upm-test-no-such-tool"}},
+	}
+	if actual := getCapabilities(b); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %+v, got %+v", expected, actual)
+	}
+}
+
+func TestDieUnsupported(t *testing.T) {
+	err := util.Catch(func() {
+		dieUnsupported(python.PythonPipBackend, "dependency-groups")
+	})
+	expected := "python3-pip does not support dependency-groups " +
+		"(supported by python3-uv, python3-poetry; choose one with --lang); " +
+		"see 'upm show-capabilities'"
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected %q, got %v", expected, err)
+	}
+}
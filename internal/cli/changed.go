@@ -0,0 +1,133 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/table"
+	"github.com/replit/upm/internal/util"
+	"github.com/replit/upm/internal/versions"
+)
+
+// Values for listChange.Change.
+const (
+	changeAdded   = "added"
+	changeRemoved = "removed"
+	changeChanged = "changed"
+
+	// Only for locked versions that can be ordered.
+	changeUpgraded   = "upgraded"
+	changeDowngraded = "downgraded"
+)
+
+// listChange represents one package that differs from the last
+// recorded 'upm list', or between two lockfiles for 'upm diff'. The
+// JSON form is the machine-readable report.
+type listChange struct {
+	Change string `json:"change" pretty:"Change"`
+	Name   string `json:"name" pretty:"Name"`
+	Old    string `json:"old,omitempty" pretty:"Old"`
+	New    string `json:"new,omitempty" pretty:"New"`
+}
+
+// describeDep formats a specfile entry for the Old and New columns of
+// 'upm list --changed'.
+func describeDep(dep api.PkgDep) string {
+	desc := string(dep.Spec)
+	if dep.Dev {
+		desc += " (dev)"
+	}
+	if dep.Group != "" {
+		desc += fmt.Sprintf(" (group %s)", dep.Group)
+	}
+	return desc
+}
+
+// diffDescriptions compares two maps from package names to
+// descriptions and returns the differences, sorted by name.
+func diffDescriptions(previous, current map[string]string) []listChange {
+	changes := []listChange{}
+	for name, desc := range current {
+		old, ok := previous[name]
+		switch {
+		case !ok:
+			changes = append(changes, listChange{Change: changeAdded, Name: name, New: desc})
+		case old != desc:
+			changes = append(changes, listChange{Change: changeChanged, Name: name, Old: old, New: desc})
+		}
+	}
+	for name, desc := range previous {
+		if _, ok := current[name]; !ok {
+			changes = append(changes, listChange{Change: changeRemoved, Name: name, Old: desc})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Name < changes[j].Name
+	})
+	return changes
+}
+
+// diffSpecfile returns the specfile entries that differ between
+// previous and current.
+func diffSpecfile(previous, current api.PkgDeps) []listChange {
+	describe := func(deps api.PkgDeps) map[string]string {
+		descs := map[string]string{}
+		for name, dep := range deps {
+			descs[string(name)] = describeDep(dep)
+		}
+		return descs
+	}
+	return diffDescriptions(describe(previous), describe(current))
+}
+
+// diffLockfile returns the locked versions that differ between
+// previous and current. Versions that can be ordered are reported as
+// upgraded or downgraded; others, such as git commits, as changed.
+func diffLockfile(previous, current map[api.PkgName]api.PkgVersion) []listChange {
+	describe := func(pkgs map[api.PkgName]api.PkgVersion) map[string]string {
+		descs := map[string]string{}
+		for name, version := range pkgs {
+			descs[string(name)] = string(version)
+		}
+		return descs
+	}
+	changes := diffDescriptions(describe(previous), describe(current))
+	for i, change := range changes {
+		if change.Change != changeChanged {
+			continue
+		}
+		if cmp, err := versions.Compare(change.Old, change.New); err == nil && cmp < 0 {
+			changes[i].Change = changeUpgraded
+		} else if err == nil && cmp > 0 {
+			changes[i].Change = changeDowngraded
+		}
+	}
+	return changes
+}
+
+// printChanges prints the output of 'upm list --changed' and 'upm
+// diff'. file is the specfile or lockfile that was compared, and since
+// describes what it was compared with, as in "since the last listing".
+func printChanges(changes []listChange, file string, since string, outputFormat outputFormat) {
+	switch outputFormat {
+	case outputFormatTable:
+		if len(changes) == 0 {
+			util.Log(fmt.Sprintf("no changes in %s %s", file, since))
+			return
+		}
+		t := table.FromStructs(changes)
+		t.Print()
+
+	case outputFormatJSON:
+		outputB, err := json.Marshal(changes)
+		if err != nil {
+			panic("couldn't marshal json")
+		}
+		fmt.Println(string(outputB))
+
+	default:
+		util.Panicf("unknown output format %d", outputFormat)
+	}
+}
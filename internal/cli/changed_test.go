@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+)
+
+func TestDiffSpecfile(t *testing.T) {
+	previous := api.PkgDeps{
+		"flask":    {Spec: ">= 3.0"},
+		"requests": {Spec: ">= 2.0"},
+		"pytest":   {Spec: ">= 8.0"},
+	}
+	current := api.PkgDeps{
+		"flask":  {Spec: ">= 3.0"},
+		"pytest": {Spec: ">= 8.0", Dev: true},
+		"rich":   {Spec: ">= 13.0", Group: "cli"},
+	}
+	expected := []listChange{
+		{Change: changeChanged, Name: "pytest", Old: ">= 8.0", New: ">= 8.0 (dev)"},
+		{Change: changeRemoved, Name: "requests", Old: ">= 2.0"},
+		{Change: changeAdded, Name: "rich", New: ">= 13.0 (group cli)"},
+	}
+	if changes := diffSpecfile(previous, current); !reflect.DeepEqual(changes, expected) {
+		t.Errorf("expected %+v, got %+v", expected, changes)
+	}
+
+	if changes := diffSpecfile(current, current); len(changes) != 0 {
+		t.Errorf("expected no changes, got %+v", changes)
+	}
+}
+
+func TestDiffLockfile(t *testing.T) {
+	previous := map[api.PkgName]api.PkgVersion{
+		"flask":    "3.0.0",
+		"requests": "2.31.0",
+		"urllib3":  "2.2.1",
+		"mylib":    "1a2b3c4",
+	}
+	current := map[api.PkgName]api.PkgVersion{
+		"flask":   "3.0.3",
+		"urllib3": "1.26.18",
+		"mylib":   "5d6e7f8",
+		"rich":    "13.7.1",
+	}
+	expected := []listChange{
+		{Change: changeUpgraded, Name: "flask", Old: "3.0.0", New: "3.0.3"},
+		{Change: changeChanged, Name: "mylib", Old: "1a2b3c4", New: "5d6e7f8"},
+		{Change: changeRemoved, Name: "requests", Old: "2.31.0"},
+		{Change: changeAdded, Name: "rich", New: "13.7.1"},
+		{Change: changeDowngraded, Name: "urllib3", Old: "2.2.1", New: "1.26.18"},
+	}
+	if changes := diffLockfile(previous, current); !reflect.DeepEqual(changes, expected) {
+		t.Errorf("expected %+v, got %+v", expected, changes)
+	}
+}
@@ -0,0 +1,330 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/backends"
+	"github.com/replit/upm/internal/util"
+	"github.com/replit/upm/internal/versions"
+)
+
+// githubAPI and githubRaw are where 'upm changelog' looks up releases
+// and files of GitHub repositories.
+var (
+	githubAPI = "https://api.github.com"
+	githubRaw = "https://raw.githubusercontent.com"
+)
+
+// changelogFiles are the names under which repositories commonly keep
+// their changelog, in the order they are tried.
+var changelogFiles = []string{
+	"CHANGELOG.md", "CHANGES.md", "HISTORY.md", "NEWS.md", "RELEASES.md",
+	"CHANGELOG.rst", "CHANGES.rst", "HISTORY.rst", "CHANGELOG",
+}
+
+// changelogEntry is the notes of one release in 'upm changelog'.
+type changelogEntry struct {
+	Version string `json:"version"`
+	Date    string `json:"date,omitempty"`
+	Notes   string `json:"notes"`
+}
+
+// matchGithubRepo matches the owner and name of a GitHub repository in
+// URLs such as git+https://github.com/user/repo.git and
+// git@github.com:user/repo.
+var matchGithubRepo = regexp.MustCompile(`github\.com[/:]([A-Za-z0-9_.-]+)/([A-Za-z0-9_.-]+?)(?:\.git)?(?:[/#?].*)?$`)
+
+// githubRepo returns the owner and name of the GitHub repository that
+// url points into, if it does.
+func githubRepo(url string) (string, string, bool) {
+	match := matchGithubRepo.FindStringSubmatch(url)
+	if match == nil {
+		return "", "", false
+	}
+	return match[1], match[2], true
+}
+
+// githubGet returns the body of a GET request to GitHub, with the
+// token in GITHUB_TOKEN if there is one, so that the lower rate limit
+// of anonymous requests does not apply. It returns false if there is
+// no such resource.
+func githubGet(url string) ([]byte, bool) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		util.DieNetwork("%s: %s", url, err)
+	}
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := api.HttpClient.Do(req)
+	if err != nil {
+		util.DieNetwork("%s: %s", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, false
+	}
+	if resp.StatusCode != http.StatusOK {
+		util.DieNetwork("%s: %s", api.Endpoint(resp), resp.Status)
+	}
+	return api.ReadResponse(resp), true
+}
+
+// tagVersion returns the version that a release tag names, as in
+// "1.2.3" for "v1.2.3", and the package it names in a monorepo, as in
+// "left-pad" for "left-pad@1.2.3".
+func tagVersion(tag string) (string, string) {
+	pkg := ""
+	if i := strings.LastIndex(tag, "@"); i > 0 {
+		pkg, tag = tag[:i], tag[i+1:]
+	}
+	return strings.TrimPrefix(strings.TrimPrefix(tag, "release-"), "v"), pkg
+}
+
+// githubReleases returns the notes of the releases of the package name
+// in a GitHub repository, at most the latest 100. Releases tagged for
+// other packages of a monorepo are left out.
+func githubReleases(owner, repo string, name string) []changelogEntry {
+	url := fmt.Sprintf("%s/repos/%s/%s/releases?per_page=100", githubAPI, owner, repo)
+	body, ok := githubGet(url)
+	if !ok {
+		return nil
+	}
+	var releases []struct {
+		TagName     string `json:"tag_name"`
+		Body        string `json:"body"`
+		Draft       bool   `json:"draft"`
+		PublishedAt string `json:"published_at"`
+	}
+	if err := json.Unmarshal(body, &releases); err != nil {
+		util.DieProtocol("%s: %s", url, err)
+	}
+	entries := []changelogEntry{}
+	for _, release := range releases {
+		version, pkg := tagVersion(release.TagName)
+		if release.Draft || strings.TrimSpace(release.Body) == "" || (pkg != "" && pkg != name) {
+			continue
+		}
+		date, _, _ := strings.Cut(release.PublishedAt, "T")
+		entries = append(entries, changelogEntry{
+			Version: version,
+			Date:    date,
+			Notes:   strings.TrimSpace(strings.ReplaceAll(release.Body, "\r\n", "\n")),
+		})
+	}
+	return entries
+}
+
+// matchHeadingVersion matches the version in the heading of a section
+// of a changelog, as in "## [1.2.3] - 2024-05-01" or "v1.2.3
+// (2024-05-01)", and its date if it has one.
+var (
+	matchHeadingVersion = regexp.MustCompile(`(?:^|[^\w.])v?(\d+(?:\.\d+)+(?:[-.+]?[A-Za-z0-9]+(?:\.\d+)?)?)\b`)
+	matchHeadingDate    = regexp.MustCompile(`\d{4}-\d{2}-\d{2}`)
+	matchUnderline      = regexp.MustCompile(`^(=+|-+|~+|\^+|\*+)$`)
+)
+
+// parseChangelog splits a Markdown or reStructuredText changelog into
+// the sections of the versions in their headings. A section runs to
+// the next heading that names a version, or, in Markdown, to the next
+// heading of the same or a higher level.
+func parseChangelog(contents string) []changelogEntry {
+	lines := strings.Split(strings.ReplaceAll(contents, "\r\n", "\n"), "\n")
+	entries := []changelogEntry{}
+	var current *changelogEntry
+	level := 0
+	var notes []string
+	finish := func() {
+		if current != nil {
+			current.Notes = strings.TrimSpace(strings.Join(notes, "\n"))
+			entries = append(entries, *current)
+		}
+		current = nil
+		notes = nil
+	}
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		heading := ""
+		headingLevel := 0
+		if strings.HasPrefix(line, "#") {
+			heading = strings.TrimLeft(line, "#")
+			headingLevel = len(line) - len(heading)
+		} else if i+1 < len(lines) && strings.TrimSpace(line) != "" && matchUnderline.MatchString(lines[i+1]) {
+			// A setext or reStructuredText heading, whose
+			// level cannot be told from the underline alone.
+			heading = line
+			i++
+			line += "\n" + lines[i]
+		}
+		if heading == "" {
+			if current != nil {
+				notes = append(notes, line)
+			}
+			continue
+		}
+
+		match := matchHeadingVersion.FindStringSubmatch(heading)
+		if match == nil {
+			if current != nil && headingLevel > 0 && headingLevel <= level {
+				finish()
+			} else if current != nil {
+				notes = append(notes, line)
+			}
+			continue
+		}
+		finish()
+		current = &changelogEntry{Version: match[1], Date: matchHeadingDate.FindString(heading)}
+		level = headingLevel
+	}
+	finish()
+	return entries
+}
+
+// githubChangelog returns the sections of the changelog in a GitHub
+// repository: the file that url points to, if it is one in the
+// repository, or otherwise the first of changelogFiles that exists.
+func githubChangelog(owner, repo, url string) ([]changelogEntry, string) {
+	candidates := []string{}
+	if _, path, ok := strings.Cut(url, fmt.Sprintf("github.com/%s/%s/blob/", owner, repo)); ok {
+		candidates = append(candidates, fmt.Sprintf("%s/%s/%s/%s", githubRaw, owner, repo, path))
+	}
+	for _, name := range changelogFiles {
+		candidates = append(candidates, fmt.Sprintf("%s/%s/%s/HEAD/%s", githubRaw, owner, repo, name))
+	}
+	for _, candidate := range candidates {
+		if body, ok := githubGet(candidate); ok {
+			return parseChangelog(string(body)), candidate
+		}
+	}
+	return nil, ""
+}
+
+// changelogRange returns the entries for the versions after from up
+// to and including to, newest first. Without from, only to is
+// included; without to, every version after from is. Entries whose
+// versions cannot be compared are left out.
+func changelogRange(entries []changelogEntry, from, to string) []changelogEntry {
+	selected := []changelogEntry{}
+	seen := map[string]bool{}
+	for _, entry := range entries {
+		if seen[entry.Version] {
+			continue
+		}
+		if from == "" {
+			if cmp, err := versions.Compare(entry.Version, to); err != nil || cmp != 0 {
+				continue
+			}
+		} else {
+			if cmp, err := versions.Compare(entry.Version, from); err != nil || cmp <= 0 {
+				continue
+			}
+			if to != "" {
+				if cmp, err := versions.Compare(entry.Version, to); err != nil || cmp > 0 {
+					continue
+				}
+			}
+		}
+		seen[entry.Version] = true
+		selected = append(selected, entry)
+	}
+	sort.SliceStable(selected, func(i, j int) bool {
+		cmp, _ := versions.Compare(selected[i].Version, selected[j].Version)
+		return cmp > 0
+	})
+	return selected
+}
+
+// runChangelog implements 'upm changelog', which prints the release
+// notes of a package for the versions after from up to to. By default
+// from is the locked version and to the latest, so that the notes are
+// those of upgrading the package. The notes come from the releases of
+// the package's GitHub repository, as the registry names it, or else
+// from a changelog file there.
+func runChangelog(language string, arg string, from string, to string, outputFormat outputFormat) {
+	b := backends.GetBackend(context.Background(), language)
+	if b.Info == nil {
+		dieUnsupported(b, "info")
+	}
+	info := b.Info(api.PkgName(arg))
+	if info.Name == "" {
+		util.DieConsistency("no such package: %s", arg)
+	}
+	if to == "" {
+		to = info.Version
+	}
+	if from == "" && b.QuirksIsReproducible() {
+		norm := b.NormalizePackageName(api.PkgName(arg))
+		for name, version := range lockedVersions(b) {
+			if b.NormalizePackageName(name) == norm {
+				from = string(version)
+			}
+		}
+	}
+
+	var owner, repo string
+	found := false
+	for _, url := range []string{info.SourceCodeURL, info.ChangelogURL, info.HomepageURL} {
+		if owner, repo, found = githubRepo(url); found {
+			break
+		}
+	}
+	if !found {
+		if info.ChangelogURL != "" {
+			util.DieConsistency("%s has no GitHub repository to read its changelog from; see %s", info.Name, info.ChangelogURL)
+		}
+		util.DieConsistency("%s has no GitHub repository to read its changelog from", info.Name)
+	}
+
+	source := fmt.Sprintf("https://github.com/%s/%s/releases", owner, repo)
+	entries := changelogRange(githubReleases(owner, repo, info.Name), from, to)
+	if len(entries) == 0 {
+		var all []changelogEntry
+		all, source = githubChangelog(owner, repo, info.ChangelogURL)
+		if source == "" {
+			util.DieConsistency("found no release notes or changelog for %s in github.com/%s/%s", info.Name, owner, repo)
+		}
+		entries = changelogRange(all, from, to)
+	}
+	if len(entries) == 0 {
+		if from == "" {
+			util.Log(fmt.Sprintf("%s has no notes for %s in %s", info.Name, to, source))
+		} else {
+			util.Log(fmt.Sprintf("%s has no notes after %s in %s", info.Name, from, source))
+		}
+		return
+	}
+	util.Log(fmt.Sprintf("from %s", source))
+
+	switch outputFormat {
+	case outputFormatTable:
+		for i, entry := range entries {
+			if i > 0 {
+				fmt.Println()
+			}
+			if entry.Date != "" {
+				fmt.Printf("## %s (%s)\n\n", entry.Version, entry.Date)
+			} else {
+				fmt.Printf("## %s\n\n", entry.Version)
+			}
+			fmt.Println(entry.Notes)
+		}
+
+	case outputFormatJSON:
+		outputB, err := json.Marshal(entries)
+		if err != nil {
+			panic("couldn't marshal json")
+		}
+		fmt.Println(string(outputB))
+
+	default:
+		util.Panicf("unknown output format %d", outputFormat)
+	}
+}
@@ -0,0 +1,109 @@
+package cli
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestGithubRepo(t *testing.T) {
+	for url, expected := range map[string][2]string{
+		"git+https://github.com/lodash/lodash.git":       {"lodash", "lodash"},
+		"https://github.com/pallets/flask/":              {"pallets", "flask"},
+		"git@github.com:user/repo.js":                    {"user", "repo.js"},
+		"https://github.com/babel/babel/tree/main/core":  {"babel", "babel"},
+		"https://github.com/user/repo#readme":            {"user", "repo"},
+		"https://github.com/user/repo/blob/main/NEWS.md": {"user", "repo"},
+	} {
+		owner, repo, ok := githubRepo(url)
+		if !ok || owner != expected[0] || repo != expected[1] {
+			t.Errorf("%s: expected %v, got %s/%s (%v)", url, expected, owner, repo, ok)
+		}
+	}
+	if _, _, ok := githubRepo("https://gitlab.com/user/repo"); ok {
+		t.Errorf("expected a GitLab URL not to be a GitHub repository")
+	}
+}
+
+func TestParseChangelog(t *testing.T) {
+	contents := `# Changelog
+
+## Unreleased
+
+- Not yet.
+
+## [2.0.0] - 2024-05-01
+
+### Breaking
+
+- Dropped Node 14.
+
+## v1.1.0
+
+- Added a thing.
+
+1.0.0 (2023-01-02)
+==================
+
+* First.
+`
+	expected := []changelogEntry{
+		{Version: "2.0.0", Date: "2024-05-01", Notes: "### Breaking\n\n- Dropped Node 14."},
+		{Version: "1.1.0", Notes: "- Added a thing."},
+		{Version: "1.0.0", Date: "2023-01-02", Notes: "* First."},
+	}
+	if entries := parseChangelog(contents); !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected %+v, got %+v", expected, entries)
+	}
+}
+
+func TestChangelogRange(t *testing.T) {
+	entries := []changelogEntry{{Version: "1.0.0"}, {Version: "2.0.0"}, {Version: "1.1.0"}, {Version: "nightly"}}
+	versions := func(entries []changelogEntry) []string {
+		names := []string{}
+		for _, entry := range entries {
+			names = append(names, entry.Version)
+		}
+		return names
+	}
+	if actual := versions(changelogRange(entries, "1.0.0", "2.0.0")); !reflect.DeepEqual(actual, []string{"2.0.0", "1.1.0"}) {
+		t.Errorf("expected the versions after 1.0.0, newest first, got %v", actual)
+	}
+	if actual := versions(changelogRange(entries, "1.0.0", "1.1.0")); !reflect.DeepEqual(actual, []string{"1.1.0"}) {
+		t.Errorf("expected the versions up to 1.1.0, got %v", actual)
+	}
+	if actual := versions(changelogRange(entries, "", "1.1.0")); !reflect.DeepEqual(actual, []string{"1.1.0"}) {
+		t.Errorf("expected only 1.1.0, got %v", actual)
+	}
+}
+
+func TestGithubReleases(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/babel/babel/releases" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`[
+			{"tag_name": "@babel/core@7.1.0", "body": "core\r\nfix", "published_at": "2024-05-01T12:00:00Z"},
+			{"tag_name": "@babel/cli@7.1.0", "body": "cli", "published_at": "2024-05-01T12:00:00Z"},
+			{"tag_name": "v7.0.0", "body": "all", "published_at": "2024-01-01T12:00:00Z"},
+			{"tag_name": "v7.0.1", "body": "", "published_at": "2024-01-02T12:00:00Z"},
+			{"tag_name": "v8.0.0", "body": "draft", "draft": true}
+		]`))
+	}))
+	defer server.Close()
+	defer func(api string) { githubAPI = api }(githubAPI)
+	githubAPI = server.URL
+
+	expected := []changelogEntry{
+		{Version: "7.1.0", Date: "2024-05-01", Notes: "core\nfix"},
+		{Version: "7.0.0", Date: "2024-01-01", Notes: "all"},
+	}
+	if entries := githubReleases("babel", "babel", "@babel/core"); !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected %+v, got %+v", expected, entries)
+	}
+	if entries := githubReleases("babel", "missing", "@babel/core"); entries != nil {
+		t.Errorf("expected no releases, got %+v", entries)
+	}
+}
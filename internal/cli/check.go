@@ -0,0 +1,209 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/backends"
+	"github.com/replit/upm/internal/policy"
+	"github.com/replit/upm/internal/table"
+	"github.com/replit/upm/internal/util"
+)
+
+// Values for checkIssue.Kind.
+const (
+	// A specfile package is not in the lockfile.
+	checkMissing = "missing"
+
+	// The locked version does not satisfy the specfile spec.
+	checkUnsatisfied = "unsatisfied"
+
+	// A locked package is not required by the specfile, directly
+	// or indirectly.
+	checkOrphan = "orphan"
+
+	// The locked version is deprecated, with --deprecations.
+	checkDeprecated = "deprecated"
+
+	// The locked version was yanked from the index, with
+	// --deprecations.
+	checkYanked = "yanked"
+)
+
+// checkIssue represents one discrepancy found by 'upm check', one
+// violation of the policy with --policy, whose Kind is that of the
+// policy.Violation, or one deprecated or yanked package with
+// --deprecations. The JSON form is the machine-readable report.
+type checkIssue struct {
+	Kind    string `json:"kind" pretty:"Kind"`
+	Name    string `json:"name" pretty:"Name"`
+	Spec    string `json:"spec,omitempty" pretty:"Spec"`
+	Version string `json:"version,omitempty" pretty:"Locked version"`
+	Detail  string `json:"detail,omitempty" pretty:"Detail"`
+	Policy  string `json:"policy,omitempty" pretty:"Policy"`
+}
+
+// checkConsistency compares the specfile against the lockfile. Both
+// must exist. Specs that the backend cannot evaluate are logged and
+// otherwise skipped.
+func checkConsistency(b api.LanguageBackend) []checkIssue {
+	specs := b.ListSpecfile(true)
+	locked := map[api.PkgName]api.PkgVersion{}
+	lockedNames := map[api.PkgName]api.PkgName{}
+	for name, version := range b.ListLockfile() {
+		norm := b.NormalizePackageName(name)
+		locked[norm] = version
+		lockedNames[norm] = name
+	}
+
+	issues := []checkIssue{}
+	for name, dep := range specs {
+		version, ok := locked[b.NormalizePackageName(name)]
+		if !ok {
+			issues = append(issues, checkIssue{
+				Kind: checkMissing,
+				Name: string(name),
+				Spec: string(dep.Spec),
+			})
+			continue
+		}
+		if _, ok := b.SourceOfSpec(dep.Spec); ok {
+			// Any version from git, a URL or a path
+			// satisfies its spec.
+			continue
+		}
+		matches, err := b.MatchesSpec(dep.Spec, version)
+		if err != nil {
+			util.Log(fmt.Sprintf("%s: cannot check %#v against %s: %s", name, dep.Spec, version, err))
+			continue
+		}
+		if !matches {
+			issues = append(issues, checkIssue{
+				Kind:    checkUnsatisfied,
+				Name:    string(name),
+				Spec:    string(dep.Spec),
+				Version: string(version),
+			})
+		}
+	}
+
+	if b.ListLockfileGraph != nil {
+		graph := map[api.PkgName][]api.PkgName{}
+		for name, deps := range b.ListLockfileGraph() {
+			norm := b.NormalizePackageName(name)
+			for _, dep := range deps {
+				graph[norm] = append(graph[norm], b.NormalizePackageName(dep))
+			}
+		}
+
+		reachable := map[api.PkgName]bool{}
+		queue := []api.PkgName{}
+		for name := range specs {
+			queue = append(queue, b.NormalizePackageName(name))
+		}
+		for len(queue) > 0 {
+			name := queue[0]
+			queue = queue[1:]
+			if reachable[name] {
+				continue
+			}
+			reachable[name] = true
+			queue = append(queue, graph[name]...)
+		}
+
+		for norm, version := range locked {
+			if !reachable[norm] {
+				issues = append(issues, checkIssue{
+					Kind:    checkOrphan,
+					Name:    string(lockedNames[norm]),
+					Version: string(version),
+				})
+			}
+		}
+	}
+
+	sort.Slice(issues, func(i, j int) bool {
+		if issues[i].Kind != issues[j].Kind {
+			return issues[i].Kind < issues[j].Kind
+		}
+		return issues[i].Name < issues[j].Name
+	})
+	return issues
+}
+
+// runCheck implements 'upm check'. With withPolicy, the project is
+// also checked against its policy file, and with withDeprecations, the
+// locked versions are looked up in the index to fail on those that are
+// deprecated or yanked.
+func runCheck(language string, outputFormat outputFormat, withPolicy bool, withDeprecations bool) {
+	b := backends.GetBackend(context.Background(), language)
+	if b.QuirksIsNotReproducible() {
+		util.DieUnimplemented("%s has no lockfile to check", b.Name)
+	}
+	if !util.Exists(b.Specfile) {
+		util.DieIO("%s: no such file", b.Specfile)
+	}
+	if !util.Exists(b.Lockfile) {
+		util.DieStaleLockfile("%s is missing; run 'upm lock' first", b.Lockfile)
+	}
+
+	s := silenceSubroutines()
+	issues := checkConsistency(b)
+	s.restore()
+	stale := len(issues)
+	policies := []*policy.Policy{}
+	if withPolicy {
+		policies = loadPolicies()
+		if len(policies) == 0 {
+			util.DieIO("%s: no such file, and the organization configuration has no policy", policy.File)
+		}
+		issues = append(issues, checkPolicy(b, policies)...)
+	}
+	violations := len(issues) - stale
+	deprecations := 0
+	if withDeprecations {
+		found := checkDeprecations(b)
+		deprecations = len(found)
+		issues = append(issues, found...)
+	}
+
+	switch outputFormat {
+	case outputFormatTable:
+		if len(issues) == 0 {
+			msg := fmt.Sprintf("%s is consistent with %s", b.Lockfile, b.Specfile)
+			if withPolicy {
+				msg += fmt.Sprintf(", and both follow %s", policyOrigins(policies))
+			}
+			if withDeprecations {
+				msg += ", and no locked version is deprecated or yanked"
+			}
+			util.Log(msg)
+			return
+		}
+		t := table.FromStructs(issues)
+		t.Print()
+
+	case outputFormatJSON:
+		outputB, err := json.Marshal(issues)
+		if err != nil {
+			panic("couldn't marshal json")
+		}
+		fmt.Println(string(outputB))
+
+	default:
+		util.Panicf("unknown output format %d", outputFormat)
+	}
+
+	if stale > 0 {
+		util.DieStaleLockfile("%s: %d discrepancies with %s", b.Lockfile, stale, b.Specfile)
+	}
+	if violations > 0 {
+		util.DieConsistency("%d violations of %s", violations, policyOrigins(policies))
+	}
+	if deprecations > 0 {
+		util.DieConsistency("%d locked packages are deprecated or yanked", deprecations)
+	}
+}
@@ -0,0 +1,131 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/policy"
+)
+
+func TestCheckConsistency(t *testing.T) {
+	b := api.LanguageBackend{
+		Name:             "test",
+		Specfile:         "spec",
+		Lockfile:         "lock",
+		FilenamePatterns: []string{"*"},
+		GetPackageDir:    func() string { return "" },
+		Search:           func(string) []api.PkgInfo { return nil },
+		Info:             func(api.PkgName) api.PkgInfo { return api.PkgInfo{} },
+		Add:              func(context.Context, map[api.PkgName]api.PkgSpec, string) {},
+		Remove:           func(context.Context, map[api.PkgName]bool) {},
+		Lock:             func(context.Context) {},
+		Install:          func(context.Context) {},
+		IsAvailable:      func() bool { return true },
+		ListSpecfile: func(bool) api.PkgDeps {
+			return api.PkgDeps{
+				"flask":    {Spec: ">= 3.0"},
+				"requests": {Spec: ">= 2.0, < 3.0"},
+				"rich":     {Spec: ">= 13.0"},
+			}
+		},
+		ListLockfile: func() map[api.PkgName]api.PkgVersion {
+			return map[api.PkgName]api.PkgVersion{
+				"flask":    "3.0.2",
+				"werkzeug": "3.0.1",
+				"requests": "3.1.0",
+				"urllib3":  "2.2.1",
+				"leftover": "1.0.0",
+			}
+		},
+		ListLockfileGraph: func() map[api.PkgName][]api.PkgName {
+			return map[api.PkgName][]api.PkgName{
+				"flask":    {"werkzeug"},
+				"requests": {"urllib3"},
+			}
+		},
+	}
+	b.Setup()
+
+	expected := []checkIssue{
+		{Kind: checkMissing, Name: "rich", Spec: ">= 13.0"},
+		{Kind: checkOrphan, Name: "leftover", Version: "1.0.0"},
+		{Kind: checkUnsatisfied, Name: "requests", Spec: ">= 2.0, < 3.0", Version: "3.1.0"},
+	}
+	if issues := checkConsistency(b); !reflect.DeepEqual(issues, expected) {
+		t.Errorf("expected %+v, got %+v", expected, issues)
+	}
+}
+
+func TestCheckPolicy(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	if err := os.MkdirAll(".upm", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(policy.File, []byte(`
+block = ["left-*"]
+banned_licenses = ["AGPL-*"]
+max_locked_packages = 3
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	licenses := map[api.PkgName]string{"flask": "BSD-3-Clause", "mongo-thing": "AGPL-3.0-only"}
+	b := api.LanguageBackend{
+		Name:             "test",
+		Specfile:         "spec",
+		Lockfile:         "lock",
+		FilenamePatterns: []string{"*"},
+		GetPackageDir:    func() string { return "" },
+		Search:           func(string) []api.PkgInfo { return nil },
+		Info: func(name api.PkgName) api.PkgInfo {
+			return api.PkgInfo{Name: string(name), License: licenses[name]}
+		},
+		Add:         func(context.Context, map[api.PkgName]api.PkgSpec, string) {},
+		Remove:      func(context.Context, map[api.PkgName]bool) {},
+		Lock:        func(context.Context) {},
+		Install:     func(context.Context) {},
+		IsAvailable: func() bool { return true },
+		ListSpecfile: func(bool) api.PkgDeps {
+			return api.PkgDeps{"flask": {}, "left-pad": {}, "mongo-thing": {}}
+		},
+		ListLockfile: func() map[api.PkgName]api.PkgVersion {
+			return map[api.PkgName]api.PkgVersion{
+				"flask":       "3.0.2",
+				"werkzeug":    "3.0.1",
+				"left-pad":    "1.3.0",
+				"mongo-thing": "1.0.0",
+			}
+		},
+	}
+	b.Setup()
+
+	expected := []checkIssue{
+		{Kind: policy.Blocked, Name: "left-pad", Detail: `matches "left-*"`, Policy: policy.File},
+		{Kind: policy.BannedLicense, Name: "mongo-thing", Detail: `AGPL-3.0-only matches "AGPL-*"`, Policy: policy.File},
+		{Kind: policy.TooManyLockedPackages, Detail: "4, more than 3", Policy: policy.File},
+	}
+	if issues := checkPolicy(b, loadPolicies()); !reflect.DeepEqual(issues, expected) {
+		t.Errorf("expected %+v, got %+v", expected, issues)
+	}
+
+	// The policy of the organization configuration comes first.
+	config.Loaded.Policy = &policy.Policy{Block: []string{"werkzeug"}, Origin: "https://example.com/upm.toml"}
+	defer func() { config.Loaded.Policy = nil }()
+	expected = append([]checkIssue{
+		{Kind: policy.Blocked, Name: "werkzeug", Detail: `matches "werkzeug"`, Policy: "https://example.com/upm.toml"},
+	}, expected...)
+	if issues := checkPolicy(b, loadPolicies()); !reflect.DeepEqual(issues, expected) {
+		t.Errorf("expected %+v, got %+v", expected, issues)
+	}
+}
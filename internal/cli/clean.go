@@ -0,0 +1,105 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/backends"
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/trace"
+	"github.com/replit/upm/internal/util"
+)
+
+// formatSize returns size in bytes in a human-readable form, as in
+// "12.3 MiB".
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// envDirToClean returns the environment directory of b for 'upm clean
+// --env', or "" if there is none to remove. An environment outside
+// the project, such as the user site of pip, is left alone, since it
+// may be shared.
+func envDirToClean(b api.LanguageBackend) string {
+	dir := environmentDir(b)
+	if dir == "" || !util.Exists(dir) {
+		return ""
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		util.DieIO("%s", err)
+	}
+	if rel, err := filepath.Rel(wd, dir); err != nil || !filepath.IsLocal(rel) || rel == "." {
+		util.Log(fmt.Sprintf("%s is outside the project, so it is left alone", dir))
+		return ""
+	}
+	return dir
+}
+
+// runClean implements 'upm clean', which removes the environment of
+// the project, such as node_modules or .venv, and with cache the
+// caches of the package manager. With --dry-run, it reports what
+// would be removed and how much space that would free.
+func runClean(language string, cache bool, env bool) {
+	span, ctx := trace.StartSpanFromExistingContext("runClean")
+	defer span.Finish()
+	b := backends.GetBackend(ctx, language)
+	if cache && b.CacheDirs == nil {
+		dieUnsupported(b, "clean-cache")
+	}
+	defer lockProject()()
+
+	dirs := []string{}
+	if env {
+		if dir := envDirToClean(b); dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	if cache {
+		s := silenceSubroutines()
+		cacheDirs := b.CacheDirs()
+		s.restore()
+		for _, dir := range cacheDirs {
+			if util.Exists(dir) {
+				dirs = append(dirs, dir)
+			}
+		}
+	}
+	if len(dirs) == 0 {
+		util.Log("nothing to clean")
+		return
+	}
+
+	var total int64
+	for _, dir := range dirs {
+		size, err := util.DirSize(dir)
+		if err != nil {
+			util.DieIO("%s", err)
+		}
+		total += size
+		if config.DryRun {
+			fmt.Printf("would remove %s (%s)\n", dir, formatSize(size))
+			continue
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			util.DieIO("%s", err)
+		}
+		util.Log(fmt.Sprintf("removed %s (%s)", dir, formatSize(size)))
+	}
+	if config.DryRun {
+		fmt.Printf("would free %s\n", formatSize(total))
+	} else {
+		util.Log(fmt.Sprintf("freed %s", formatSize(total)))
+	}
+}
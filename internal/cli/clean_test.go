@@ -0,0 +1,20 @@
+package cli
+
+import "testing"
+
+func TestFormatSize(t *testing.T) {
+	cases := map[int64]string{
+		0:                  "0 B",
+		1023:               "1023 B",
+		1024:               "1.0 KiB",
+		1536:               "1.5 KiB",
+		5 * 1024 * 1024:    "5.0 MiB",
+		3 << 30:            "3.0 GiB",
+		1024*1024*1024 - 1: "1024.0 MiB",
+	}
+	for size, expected := range cases {
+		if actual := formatSize(size); actual != expected {
+			t.Errorf("formatSize(%d) = %q, want %q", size, actual, expected)
+		}
+	}
+}
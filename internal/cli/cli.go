@@ -2,14 +2,18 @@
 package cli
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/replit/upm/internal/backends"
 	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/policy"
 	"github.com/replit/upm/internal/trace"
 	"github.com/replit/upm/internal/util"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
 // parseOutputFormat takes "table" or "json" and returns an
@@ -21,11 +25,36 @@ func parseOutputFormat(formatStr string) outputFormat {
 	case "json":
 		return outputFormatJSON
 	default:
-		util.DieConsistency(`Error: invalid format %#v (must be "table" or "json")`, formatStr)
+		util.DieUsage(`Error: invalid format %#v (must be "table" or "json")`, formatStr)
 		return 0
 	}
 }
 
+// addProxyFlag registers the --proxy option on cmd. The proxy is
+// applied before any subcommand runs, so that both registry requests
+// and subprocesses see it.
+func addProxyFlag(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVar(
+		&config.Proxy, "proxy", "", "HTTP(S) proxy to use for network access (overrides HTTP_PROXY/HTTPS_PROXY)",
+	)
+	cmd.PersistentPreRun = func(cmd *cobra.Command, args []string) {
+		util.SetProxy(config.Proxy)
+	}
+}
+
+// applyConfigDefaults fills in options that were not given on the
+// command line from the configuration files loaded by config.Load.
+// Flags always take precedence over configuration.
+func applyConfigDefaults(cmd *cobra.Command, language, formatStr *string, ignoredPackages *[]string) {
+	if !cmd.Flags().Changed("lang") && config.Loaded.Language != "" {
+		*language = config.Loaded.Language
+	}
+	if cmd.Flags().Lookup("format") != nil && !cmd.Flags().Changed("format") && config.Loaded.Format != "" {
+		*formatStr = config.Loaded.Format
+	}
+	*ignoredPackages = append(*ignoredPackages, config.Loaded.Guess.Ignore...)
+}
+
 // version is set at build time to a Git tag or the string
 // "development version" when not tagging a release.
 var version = "unknown version"
@@ -39,6 +68,9 @@ func getVersion() string {
 // DoCLI reads the command-line arguments and runs the appropriate
 // code, then exits the process (or returns to indicate normal exit).
 func DoCLI() {
+	defer util.HandleExit()
+	util.HandleSignals()
+
 	cleanupFn := trace.MaybeTrace(getVersion())
 	if cleanupFn != nil {
 		defer cleanupFn()
@@ -52,29 +84,142 @@ func DoCLI() {
 	var forceLock bool
 	var forceInstall bool
 	var forceGuess bool
+	var includeCommands bool
 	var all bool
+	var devOnly bool
+	var prodOnly bool
+	var changed bool
+	var since string
+	var installed bool
+	var staleStr string
+	var local bool
+	var remote bool
+	var searchLimit int
+	var searchSort string
+	var exact bool
+	var interactive bool
 	var ignoredPackages []string
 	var ignoredPaths []string
 	var upgrade bool
+	var showDiff bool
+	var repair bool
+	var checkWithPolicy bool
+	var checkWithDeprecations bool
+	var infoHealth bool
+	var infoReadme bool
+	var listScripts bool
+	var readStdin bool
+	var migrateFrom string
+	var migrateTo string
+	var exportFormat string
+	var exportHashes bool
+	var output string
 	var name string
+	var projectVersion string
+	var license string
+	var logFile string
+	var progressFormat string
+	var asDaemon bool
+	var socket string
+	var timeout time.Duration
+	var workspaces workspaceFlags
 
 	cobra.EnableCommandSorting = false
 
 	rootCmd := &cobra.Command{
 		Use:     "upm",
 		Version: getVersion(),
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if !asDaemon {
+				_ = cmd.Help()
+				return
+			}
+			runDaemon(socket)
+		},
 	}
+	rootCmd.Flags().BoolVar(
+		&asDaemon, "daemon", false, "serve list, guess, search and info requests as JSON-RPC on a Unix socket",
+	)
+	rootCmd.Flags().StringVar(
+		&socket, "socket", "", "the socket for --daemon (default .upm/daemon.sock)",
+	)
 	rootCmd.SetVersionTemplate(`{{.Version}}` + "\n")
 	// Not sorting the root command options because none of the
 	// documented ways to disable sorting work for it (the root
 	// command itself has the options sorted correctly, but they
 	// are alphabetized in the help strings for subcommands).
 	rootCmd.PersistentFlags().StringVarP(
-		&language, "lang", "l", "", "specify project language(s) manually",
+		&language, "lang", "l", "", `specify project language(s) manually ("all" for every language the project uses, with list, lock and install)`,
 	)
 	rootCmd.PersistentFlags().BoolVarP(
 		&config.Quiet, "quiet", "q", false, "don't show what commands are being run",
 	)
+	rootCmd.PersistentFlags().BoolVar(
+		&config.Verbose, "verbose", false, "show more detail about what is being done",
+	)
+	rootCmd.PersistentFlags().BoolVar(
+		&config.Debug, "debug", false, "also show the duration and exit code of each command run",
+	)
+	rootCmd.PersistentFlags().StringVar(
+		&logFile, "log-file", "", "append all messages, regardless of verbosity, to this file",
+	)
+	rootCmd.PersistentFlags().StringVar(
+		&progressFormat, "progress", "", `report the progress of add, remove, lock and install ("json" for NDJSON events on stdout instead of the package manager's output)`,
+	)
+	rootCmd.PersistentFlags().DurationVar(
+		&timeout, "timeout", 0, "kill commands that run longer than this, e.g. 10m (overrides the configuration files)",
+	)
+	rootCmd.PersistentFlags().BoolVar(
+		&config.DryRun, "dry-run", false, "print the commands and file changes that would be made instead of making them",
+	)
+	rootCmd.PersistentFlags().BoolVar(
+		&config.FailFast, "fail-fast", false, "with --lang all or several workspace members, stop at the first one that fails",
+	)
+	rootCmd.PersistentFlags().BoolVar(
+		&config.NoInput, "no-input", false, "never let a package manager prompt for input (the default when stdin is not a terminal)",
+	)
+	rootCmd.PersistentFlags().BoolVar(
+		&config.InstallTools, "install-tools", false, "install a missing package manager, e.g. with pipx or corepack, instead of failing",
+	)
+	rootCmd.PersistentFlags().BoolVar(
+		&config.InProject, "in-project", false, "keep the environment, e.g. a Python virtualenv, in the project directory as .venv",
+	)
+	addProxyFlag(rootCmd)
+	applyProxy := rootCmd.PersistentPreRun
+	rootCmd.PersistentPreRun = func(cmd *cobra.Command, args []string) {
+		applyProxy(cmd, args)
+		if logFile != "" {
+			if err := util.OpenLogFile(logFile); err != nil {
+				util.DieIO("%s", err)
+			}
+		}
+		switch progressFormat {
+		case "":
+		case "json":
+			config.ProgressJSON = true
+		default:
+			util.DieUsage(`invalid progress format %q (must be "json")`, progressFormat)
+		}
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			config.NoInput = true
+		}
+		applyConfigDefaults(cmd, &language, &formatStr, &ignoredPackages)
+		if cmd.Flags().Changed("timeout") {
+			config.Timeout = timeout
+			config.CommandTimeouts = nil
+		}
+		if config.Loaded.InstallTools {
+			config.InstallTools = true
+		}
+		if config.Loaded.InProject {
+			config.InProject = true
+		}
+		if config.InProject {
+			applyInProject()
+		}
+		startStats(cmd)
+	}
 	rootCmd.PersistentFlags().StringSliceVar(
 		&ignoredPackages, "ignored-packages", []string{},
 		"packages to ignore when searching, guessing, or adding (comma-separated)",
@@ -96,14 +241,33 @@ func DoCLI() {
 		Long:  "Ask which language your project is autodetected as",
 		Args:  cobra.NoArgs,
 		Run: func(cmd *cobra.Command, args []string) {
-			runWhichLanguage(language, all)
+			outputFormat := parseOutputFormat(formatStr)
+			runWhichLanguage(language, all, outputFormat)
 		},
 	}
 	cmdWhichLanguage.Flags().BoolVarP(
-		&all, "all", "a", false, "List all packages for all detected languages",
+		&all, "all", "a", false, "list every matching language, with the evidence for it",
+	)
+	cmdWhichLanguage.Flags().StringVarP(
+		&formatStr, "format", "f", "table", `output format ("table" or "json")`,
 	)
 	rootCmd.AddCommand(cmdWhichLanguage)
 
+	cmdWhichProvides := &cobra.Command{
+		Use:   "which-provides COMMAND",
+		Short: "Show which package provides a command",
+		Long:  "Show which package of your project's language provides a command-line tool, such as gunicorn or eslint",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			outputFormat := parseOutputFormat(formatStr)
+			runWhichProvides(language, args[0], outputFormat)
+		},
+	}
+	cmdWhichProvides.Flags().StringVarP(
+		&formatStr, "format", "f", "table", `output format ("table" or "json")`,
+	)
+	rootCmd.AddCommand(cmdWhichProvides)
+
 	cmdListLanguages := &cobra.Command{
 		Use:   "list-languages",
 		Short: "List supported languages",
@@ -117,14 +281,41 @@ func DoCLI() {
 	cmdSearch := &cobra.Command{
 		Use:   "search QUERY...",
 		Short: "Search for packages online",
-		Args:  cobra.MinimumNArgs(1),
+		Args: func(cmd *cobra.Command, args []string) error {
+			if searchLimit < 0 {
+				return fmt.Errorf("invalid limit %d (must be zero or positive)", searchLimit)
+			}
+			if _, err := parseSearchSort(searchSort); err != nil {
+				return err
+			}
+			if interactive && cmd.Flags().Changed("format") {
+				return errors.New("--interactive cannot be combined with --format")
+			}
+			if interactive && cmd.Flags().Changed("no-input") {
+				return errors.New("--interactive cannot be combined with --no-input")
+			}
+			return cobra.MinimumNArgs(1)(cmd, args)
+		},
 		Run: func(cmd *cobra.Command, args []string) {
 			queries := args
 			outputFormat := parseOutputFormat(formatStr)
-			runSearch(language, queries, outputFormat, ignoredPackages)
+			by, _ := parseSearchSort(searchSort)
+			runSearch(language, queries, outputFormat, ignoredPackages, searchLimit, by, exact, interactive)
 		},
 	}
 	cmdSearch.Flags().SortFlags = false
+	cmdSearch.Flags().IntVar(
+		&searchLimit, "limit", defaultSearchLimit, "show at most this many results (0 for all)",
+	)
+	cmdSearch.Flags().StringVar(
+		&searchSort, "sort", "relevance", `order of results ("relevance", "downloads", "updated" or "stars")`,
+	)
+	cmdSearch.Flags().BoolVar(
+		&exact, "exact", false, "only show a package whose name matches the query exactly",
+	)
+	cmdSearch.Flags().BoolVarP(
+		&interactive, "interactive", "i", false, "choose packages to add from the results",
+	)
 	cmdSearch.Flags().StringVarP(
 		&formatStr, "format", "f", "table", `output format ("table" or "json")`,
 	)
@@ -132,28 +323,138 @@ func DoCLI() {
 
 	cmdInfo := &cobra.Command{
 		Aliases: []string{"show"},
-		Use:     "info PACKAGE",
-		Short:   "Show package information from online registry",
-		Args:    cobra.ExactArgs(1),
+		Use:     "info PACKAGE...",
+		Short:   "Show package information from online registry or the project",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if all {
+				if len(args) > 0 {
+					return errors.New("--all does not take package names")
+				}
+				return nil
+			}
+			return cobra.MinimumNArgs(1)(cmd, args)
+		},
 		Run: func(cmd *cobra.Command, args []string) {
-			pkg := args[0]
 			outputFormat := parseOutputFormat(formatStr)
-			runInfo(language, pkg, outputFormat)
+			runInfo(language, args, all, local, remote, infoHealth, infoReadme, outputFormat)
 		},
 	}
 	cmdInfo.Flags().SortFlags = false
+	cmdInfo.Flags().BoolVarP(
+		&all, "all", "a", false, "show information about every package in the specfile",
+	)
+	cmdInfo.Flags().BoolVar(
+		&local, "local", false, "show what the project's specfile and lockfile say, without network access",
+	)
+	cmdInfo.Flags().BoolVar(
+		&remote, "remote", false, "with --local, query the registry for packages the project does not depend on",
+	)
+	cmdInfo.Flags().BoolVar(
+		&infoHealth, "health", false, "score how well the package is maintained",
+	)
+	cmdInfo.Flags().BoolVar(
+		&infoReadme, "readme", false, "show the package's readme from the registry",
+	)
 	cmdInfo.Flags().StringVarP(
 		&formatStr, "format", "f", "table", `output format ("table" or "json")`,
 	)
 	rootCmd.AddCommand(cmdInfo)
 
+	cmdInit := &cobra.Command{
+		Use:   "init",
+		Short: "Create a minimal specfile",
+		Long: "Create a minimal specfile for the project without asking anything, " +
+			"as 'upm add' does when there is none, e.g. package.json or pyproject.toml",
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			runInit(language, name, projectVersion, license)
+		},
+	}
+	cmdInit.Flags().SortFlags = false
+	cmdInit.Flags().StringVarP(
+		&name, "name", "n", "", "specify project name (defaults to the directory's name)",
+	)
+	cmdInit.Flags().StringVar(
+		&projectVersion, "project-version", "", "specify project version",
+	)
+	cmdInit.Flags().StringVar(
+		&license, "license", "", `specify project license, e.g. "MIT"`,
+	)
+	rootCmd.AddCommand(cmdInit)
+
+	cmdMigrate := &cobra.Command{
+		Use:   "migrate --from LANG --to LANG",
+		Short: "Move the project to another package manager",
+		Long: "Add the packages in the specfile of one backend to the specfile of another for the same language, " +
+			"e.g. from python3-pip to python3-poetry or from nodejs-npm to nodejs-yarn, and generate its lockfile",
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			runMigrate(migrateFrom, migrateTo, forceInstall)
+		},
+	}
+	cmdMigrate.Flags().SortFlags = false
+	cmdMigrate.Flags().StringVar(
+		&migrateFrom, "from", "", "the backend the project uses now",
+	)
+	cmdMigrate.Flags().StringVar(
+		&migrateTo, "to", "", "the backend to move the project to",
+	)
+	cmdMigrate.Flags().BoolVarP(
+		&forceInstall, "force-install", "F", false, "reinstall packages even if up to date",
+	)
+	cmdMigrate.Flags().BoolVar(
+		&config.Wait, "wait", false, "wait for other upm processes modifying the project instead of failing",
+	)
+	cmdMigrate.Flags().BoolVar(
+		&config.NoLock, "no-lock", false, "do not lock the project against other upm processes",
+	)
+	cmdMigrate.Flags().BoolVar(
+		&config.NoRollback, "no-rollback", false, "keep the specfile and lockfile as they are if the command fails",
+	)
+	rootCmd.AddCommand(cmdMigrate)
+
+	cmdExport := &cobra.Command{
+		Use:   "export",
+		Short: "Convert the lockfile into a format other tools can read",
+		Long: "Write the locked packages as a requirements.txt or constraints file for pip, " +
+			"or as an npm-shrinkwrap.json, for tools that cannot read the lockfile itself, " +
+			"or write the Dockerfile lines that install them in a container, " +
+			"or a Nix expression that builds them",
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			runExport(language, exportFormat, exportHashes, output)
+		},
+	}
+	cmdExport.Flags().SortFlags = false
+	cmdExport.Flags().StringVarP(
+		&exportFormat, "format", "f", "", `output format ("requirements.txt", "constraints", "npm-shrinkwrap", "dockerfile" or "nix"; defaults to the language's)`,
+	)
+	cmdExport.Flags().BoolVar(
+		&exportHashes, "hashes", false, "include the hashes from the lockfile in requirements.txt",
+	)
+	cmdExport.Flags().StringVarP(
+		&output, "output", "o", "", "write to this file instead of stdout",
+	)
+	rootCmd.AddCommand(cmdExport)
+
 	cmdAdd := &cobra.Command{
 		Use:   `add "PACKAGE[ SPEC]"...`,
 		Short: "Add packages to the specfile",
 		Run: func(cmd *cobra.Command, args []string) {
+			if config.Dev && config.Group != "" {
+				util.DieUsage("--dev and --group are mutually exclusive")
+			}
+			if err := config.ValidateSpecPolicy(config.SpecPolicy); err != nil {
+				util.DieUsage("--guess-spec: %s", err)
+			}
 			pkgSpecStrs := args
-			runAdd(language, pkgSpecStrs, upgrade, guess, forceGuess,
-				ignoredPackages, forceLock, forceInstall, name)
+			if readStdin {
+				pkgSpecStrs = append(pkgSpecStrs, readStdinPackages(true)...)
+			}
+			forEachWorkspace(selectWorkspaces(workspaces), func() {
+				runAdd(language, pkgSpecStrs, upgrade, guess, forceGuess,
+					ignoredPackages, forceLock, forceInstall, name)
+			})
 		},
 	}
 	cmdAdd.Flags().SortFlags = false
@@ -175,14 +476,56 @@ func DoCLI() {
 	cmdAdd.Flags().StringVarP(
 		&name, "name", "n", "", "specify project name",
 	)
+	cmdAdd.Flags().BoolVarP(
+		&config.Dev, "dev", "D", false, "add packages as development dependencies",
+	)
+	cmdAdd.Flags().StringVar(
+		&config.Group, "group", "", "add packages to the named dependency group",
+	)
+	cmdAdd.Flags().StringVar(
+		&config.SpecPolicy, "guess-spec", "", "write the spec of packages added without one: exact, caret, tilde or none (default add_spec_policy)",
+	)
+	cmdAdd.Flags().StringVar(
+		&config.Reason, "reason", "", "record why the packages are needed as a comment in the specfile",
+	)
+	cmdAdd.Flags().BoolVar(
+		&config.Wait, "wait", false, "wait for other upm processes modifying the project instead of failing",
+	)
+	cmdAdd.Flags().BoolVar(
+		&config.NoLock, "no-lock", false, "do not lock the project against other upm processes",
+	)
+	cmdAdd.Flags().BoolVar(
+		&config.NoRollback, "no-rollback", false, "keep the specfile and lockfile as they are if the command fails",
+	)
+	cmdAdd.Flags().BoolVar(
+		&config.NoCheck, "no-check", false, "do not check that the packages exist in the registry",
+	)
+	cmdAdd.Flags().BoolVar(
+		&config.Force, "force", false, "add packages whose names look like typos of popular packages without asking",
+	)
+	cmdAdd.Flags().BoolVar(
+		&config.Partial, "partial", false, "if a package cannot be added, add the others without it",
+	)
+	cmdAdd.Flags().BoolVar(
+		&readStdin, "stdin", false, "also read packages from stdin, one per line or as JSON",
+	)
+	addWorkspaceFlags(cmdAdd, &workspaces, false, nil)
 	rootCmd.AddCommand(cmdAdd)
 
 	cmdRemove := &cobra.Command{
 		Use:   "remove PACKAGE...",
 		Short: "Remove packages from the specfile",
-		Args:  cobra.MinimumNArgs(1),
+		Args: func(cmd *cobra.Command, args []string) error {
+			if readStdin {
+				return nil
+			}
+			return cobra.MinimumNArgs(1)(cmd, args)
+		},
 		Run: func(cmd *cobra.Command, args []string) {
 			pkgs := args
+			if readStdin {
+				pkgs = append(pkgs, readStdinPackages(false)...)
+			}
 			runRemove(language, pkgs, upgrade, forceLock, forceInstall)
 		},
 	}
@@ -196,8 +539,210 @@ func DoCLI() {
 	cmdRemove.Flags().BoolVarP(
 		&forceInstall, "force-install", "F", false, "reinstall packages even if up to date",
 	)
+	cmdRemove.Flags().BoolVar(
+		&config.Wait, "wait", false, "wait for other upm processes modifying the project instead of failing",
+	)
+	cmdRemove.Flags().BoolVar(
+		&config.NoLock, "no-lock", false, "do not lock the project against other upm processes",
+	)
+	cmdRemove.Flags().BoolVar(
+		&config.NoRollback, "no-rollback", false, "keep the specfile and lockfile as they are if the command fails",
+	)
+	cmdRemove.Flags().BoolVar(
+		&readStdin, "stdin", false, "also read packages from stdin, one per line or as JSON",
+	)
 	rootCmd.AddCommand(cmdRemove)
 
+	cmdPin := &cobra.Command{
+		Use:   "pin PACKAGE...",
+		Short: "Pin packages to their locked versions in the specfile",
+		Long: "Rewrite the specs of packages in the specfile to the exact versions in the lockfile " +
+			"(the installed versions, for backends without one), so that upgrades leave them alone",
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			runPin(language, args, false)
+		},
+	}
+	cmdPin.Flags().SortFlags = false
+	cmdPin.Flags().BoolVar(
+		&config.Wait, "wait", false, "wait for other upm processes modifying the project instead of failing",
+	)
+	cmdPin.Flags().BoolVar(
+		&config.NoLock, "no-lock", false, "do not lock the project against other upm processes",
+	)
+	rootCmd.AddCommand(cmdPin)
+
+	cmdUnpin := &cobra.Command{
+		Use:   "unpin PACKAGE...",
+		Short: "Allow compatible upgrades of packages in the specfile",
+		Long: "Rewrite the specs of packages in the specfile to the ranges of the versions compatible " +
+			"with their locked versions, such as ^1.2.3, undoing 'upm pin'",
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			runPin(language, args, true)
+		},
+	}
+	cmdUnpin.Flags().SortFlags = false
+	cmdUnpin.Flags().BoolVar(
+		&config.Wait, "wait", false, "wait for other upm processes modifying the project instead of failing",
+	)
+	cmdUnpin.Flags().BoolVar(
+		&config.NoLock, "no-lock", false, "do not lock the project against other upm processes",
+	)
+	rootCmd.AddCommand(cmdUnpin)
+
+	cmdOverride := &cobra.Command{
+		Use:   "override",
+		Short: "Force the versions of transitive dependencies",
+		Args:  cobra.NoArgs,
+	}
+	cmdOverrideAdd := &cobra.Command{
+		Use:   "add PACKAGE@VERSION...",
+		Short: "Force a package anywhere in the dependency graph to a version",
+		Long: "Record an override that forces every copy of a package in the dependency graph, however " +
+			"deep, to a version that satisfies the spec (npm and Bun overrides, Yarn resolutions, pnpm " +
+			"overrides, uv override-dependencies, or a constraint in Poetry's overrides group), and lock",
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			runOverrideAdd(language, args)
+		},
+	}
+	cmdOverrideAdd.Flags().SortFlags = false
+	cmdOverrideAdd.Flags().BoolVar(
+		&config.Wait, "wait", false, "wait for other upm processes modifying the project instead of failing",
+	)
+	cmdOverrideAdd.Flags().BoolVar(
+		&config.NoLock, "no-lock", false, "do not lock the project against other upm processes",
+	)
+	cmdOverride.AddCommand(cmdOverrideAdd)
+	rootCmd.AddCommand(cmdOverride)
+
+	cmdPatch := &cobra.Command{
+		Use:   "patch PACKAGE",
+		Short: "Copy an installed package to a temporary directory to patch it",
+		Long: "Copy the files of an installed package to a temporary directory, and print it. " +
+			"After editing them there, run 'upm patch-commit DIR' to record the changes",
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			runPatch(language, args[0])
+		},
+	}
+	rootCmd.AddCommand(cmdPatch)
+
+	cmdPatchCommit := &cobra.Command{
+		Use:   "patch-commit DIR",
+		Short: "Record the changes made to a package after 'upm patch'",
+		Long: "Record the changes made in the directory that 'upm patch' printed as a patch in " +
+			".upm/patches, and apply it to the installed package. The patch is applied again " +
+			"whenever packages are installed, by patch-package for npm and by upm otherwise",
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			runPatchCommit(args[0])
+		},
+	}
+	cmdPatchCommit.Flags().SortFlags = false
+	cmdPatchCommit.Flags().BoolVar(
+		&config.Wait, "wait", false, "wait for other upm processes modifying the project instead of failing",
+	)
+	cmdPatchCommit.Flags().BoolVar(
+		&config.NoLock, "no-lock", false, "do not lock the project against other upm processes",
+	)
+	rootCmd.AddCommand(cmdPatchCommit)
+
+	cmdMergeLockfile := &cobra.Command{
+		Use:   "merge-lockfile BASE OURS THEIRS [PATH]",
+		Short: "Merge lockfiles as a git merge driver",
+		Long: "Merge the lockfile at PATH (the lockfile of the current directory by default) " +
+			"from its versions BASE, OURS and THEIRS, writing the result to OURS, and lock it " +
+			"again with the specfile that the merge leaves, instead of leaving conflicts to be " +
+			"resolved by hand. To use it, add '<lockfile> merge=upm' to .gitattributes and run " +
+			"\"git config merge.upm.driver 'upm merge-lockfile %O %A %B %P'\"",
+		Args: cobra.RangeArgs(3, 4),
+		Run: func(cmd *cobra.Command, args []string) {
+			path := ""
+			if len(args) == 4 {
+				path = args[3]
+			}
+			runMergeLockfile(language, args[0], args[1], args[2], path)
+		},
+	}
+	rootCmd.AddCommand(cmdMergeLockfile)
+
+	var changelogFrom string
+	var changelogTo string
+	cmdChangelog := &cobra.Command{
+		Use:   "changelog PACKAGE",
+		Short: "Show the release notes of a package",
+		Long: "Show the release notes of the versions of a package after --from (by default the " +
+			"locked version) up to --to (by default the latest), from the GitHub releases of the " +
+			"repository that the registry names, or else from a changelog file in it. Set " +
+			"GITHUB_TOKEN to avoid GitHub's rate limit for anonymous requests",
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			outputFormat := parseOutputFormat(formatStr)
+			runChangelog(language, args[0], changelogFrom, changelogTo, outputFormat)
+		},
+	}
+	cmdChangelog.Flags().SortFlags = false
+	cmdChangelog.Flags().StringVar(
+		&changelogFrom, "from", "", "show the versions after this one (by default the locked version)",
+	)
+	cmdChangelog.Flags().StringVar(
+		&changelogTo, "to", "", "show the versions up to this one (by default the latest)",
+	)
+	cmdChangelog.Flags().StringVarP(
+		&formatStr, "format", "f", "table", `output format ("table" or "json")`,
+	)
+	rootCmd.AddCommand(cmdChangelog)
+
+	var openDocsFlag, openRepoFlag, openIssuesFlag bool
+	cmdOpen := &cobra.Command{
+		Use:   "open PACKAGE",
+		Short: "Open the home page of a package in the browser",
+		Long: "Open the home page, documentation, repository or issue tracker of a package, as " +
+			"the registry names them, in the browser that BROWSER names, or else the default one",
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			targets := []openTarget{}
+			for _, flag := range []struct {
+				set    bool
+				target openTarget
+			}{{openDocsFlag, openDocs}, {openRepoFlag, openRepo}, {openIssuesFlag, openIssues}} {
+				if flag.set {
+					targets = append(targets, flag.target)
+				}
+			}
+			if len(targets) > 1 {
+				util.DieUsage("--docs, --repo and --issues are mutually exclusive")
+			}
+			target := openHomepage
+			if len(targets) == 1 {
+				target = targets[0]
+			}
+			runOpen(language, args[0], target)
+		},
+	}
+	cmdOpen.Flags().SortFlags = false
+	cmdOpen.Flags().BoolVar(&openDocsFlag, "docs", false, "open the documentation (by default the home page)")
+	cmdOpen.Flags().BoolVar(&openRepoFlag, "repo", false, "open the source code repository")
+	cmdOpen.Flags().BoolVar(&openIssuesFlag, "issues", false, "open the issue tracker")
+	rootCmd.AddCommand(cmdOpen)
+
+	var vendorDir string
+	cmdVendor := &cobra.Command{
+		Use:   "vendor",
+		Short: "Download the locked packages for offline installs",
+		Long: "Download the file of every locked package (tarballs for Node.js, sdists and wheels " +
+			"for Python) to a directory named after the language under the vendor directory, and " +
+			"list them in index.json there, so that a committed vendor tree can be installed offline",
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			runVendor(language, vendorDir)
+		},
+	}
+	cmdVendor.Flags().StringVar(&vendorDir, "dir", "vendor", "directory to download the packages to")
+	rootCmd.AddCommand(cmdVendor)
+
 	updateAliases := []string{"update", "upgrade"}
 	cmdLock := &cobra.Command{
 		Aliases: updateAliases,
@@ -210,7 +755,9 @@ func DoCLI() {
 					upgrade = true
 				}
 			}
-			runLock(language, upgrade, forceLock, forceInstall)
+			forEachLanguage(language, func(language string) {
+				runLock(language, upgrade, forceLock, forceInstall, showDiff, repair)
+			})
 		},
 	}
 	cmdLock.Flags().SortFlags = false
@@ -223,48 +770,314 @@ func DoCLI() {
 	cmdLock.Flags().BoolVarP(
 		&forceInstall, "force-install", "F", false, "reinstall packages even if up to date",
 	)
+	cmdLock.Flags().BoolVar(
+		&showDiff, "diff", false, "show the packages that locking added, removed, upgraded or downgraded",
+	)
+	cmdLock.Flags().BoolVar(
+		&repair, "repair", false, "if the lockfile is merge-conflicted or does not parse, back it up as <lockfile>.broken and lock again",
+	)
+	cmdLock.Flags().BoolVar(
+		&config.Wait, "wait", false, "wait for other upm processes modifying the project instead of failing",
+	)
+	cmdLock.Flags().BoolVar(
+		&config.NoLock, "no-lock", false, "do not lock the project against other upm processes",
+	)
+	cmdLock.Flags().BoolVar(
+		&config.NoRollback, "no-rollback", false, "keep the specfile and lockfile as they are if the command fails",
+	)
 	rootCmd.AddCommand(cmdLock)
 
+	cmdDiff := &cobra.Command{
+		Use:   "diff [OLD]",
+		Short: "Compare the lockfile with an older version of it",
+		Long: "List the packages added, removed, upgraded or downgraded in the lockfile since OLD, " +
+			"which is either a lockfile or a git revision (HEAD by default)",
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			outputFormat := parseOutputFormat(formatStr)
+			old := "HEAD"
+			if len(args) > 0 {
+				old = args[0]
+			}
+			runDiff(language, old, outputFormat)
+		},
+	}
+	cmdDiff.Flags().SortFlags = false
+	cmdDiff.Flags().StringVarP(
+		&formatStr, "format", "f", "table", `output format ("table" or "json")`,
+	)
+	rootCmd.AddCommand(cmdDiff)
+
 	cmdInstall := &cobra.Command{
 		Use:   "install",
 		Short: "Install packages from the lockfile",
 		Args:  cobra.NoArgs,
 		Run: func(cmd *cobra.Command, args []string) {
-			runInstall(language, forceInstall)
+			forEachWorkspace(selectWorkspaces(workspaces), func() {
+				forEachLanguage(language, func(language string) {
+					runInstall(language, forceInstall)
+				})
+			})
 		},
 	}
 	cmdInstall.Flags().SortFlags = false
 	cmdInstall.Flags().BoolVarP(
 		&forceInstall, "force", "F", false, "reinstall packages even if up to date",
 	)
+	cmdInstall.Flags().BoolVar(
+		&config.Prod, "prod", false, "skip development dependencies",
+	)
+	cmdInstall.Flags().BoolVar(
+		&config.Frozen, "frozen", false, "fail if the lockfile is out of date instead of updating it",
+	)
+	cmdInstall.Flags().BoolVar(
+		&config.Wait, "wait", false, "wait for other upm processes modifying the project instead of failing",
+	)
+	cmdInstall.Flags().BoolVar(
+		&config.NoLock, "no-lock", false, "do not lock the project against other upm processes",
+	)
+	cmdInstall.Flags().BoolVar(
+		&config.NoRollback, "no-rollback", false, "keep the specfile and lockfile as they are if the command fails",
+	)
+	addWorkspaceFlags(cmdInstall, &workspaces, true, cobra.NoArgs)
 	rootCmd.AddCommand(cmdInstall)
 
+	cmdFetch := &cobra.Command{
+		Use:   "fetch",
+		Short: "Download the packages in the lockfile to the cache without installing them",
+		Long: "Download the packages in the lockfile to the package manager's cache (npm's cache, " +
+			"Yarn's cache, pnpm's store, or the Poetry or uv cache) without installing them in the " +
+			"project, so that a later 'upm install' needs no network, as in a separate Docker layer",
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			forEachWorkspace(selectWorkspaces(workspaces), func() {
+				forEachLanguage(language, func(language string) {
+					runFetch(language)
+				})
+			})
+		},
+	}
+	cmdFetch.Flags().SortFlags = false
+	cmdFetch.Flags().BoolVar(
+		&config.Prod, "prod", false, "skip development dependencies",
+	)
+	addWorkspaceFlags(cmdFetch, &workspaces, true, cobra.NoArgs)
+	rootCmd.AddCommand(cmdFetch)
+
+	var cleanCache, cleanEnv bool
+	cmdClean := &cobra.Command{
+		Use:   "clean",
+		Short: "Remove installed packages and package manager caches",
+		Long: "Remove the directory packages are installed in, such as node_modules or .venv, " +
+			"and with --cache, the package manager's caches. Without either flag, --env is " +
+			"assumed. With --dry-run, report what would be removed and how much space it takes",
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if !cleanCache && !cleanEnv {
+				cleanEnv = true
+			}
+			forEachLanguage(language, func(language string) {
+				runClean(language, cleanCache, cleanEnv)
+			})
+		},
+	}
+	cmdClean.Flags().SortFlags = false
+	cmdClean.Flags().BoolVar(&cleanEnv, "env", false, "remove the directory packages are installed in")
+	cmdClean.Flags().BoolVar(&cleanCache, "cache", false, "remove the package manager's caches")
+	cmdClean.Flags().BoolVar(
+		&config.Wait, "wait", false, "wait for other upm processes modifying the project instead of failing",
+	)
+	cmdClean.Flags().BoolVar(
+		&config.NoLock, "no-lock", false, "do not lock the project against other upm processes",
+	)
+	rootCmd.AddCommand(cmdClean)
+
 	cmdList := &cobra.Command{
 		Use:   "list",
-		Short: "List packages from the specfile (or lockfile)",
-		Long:  "List packages from the specfile",
+		Short: "List packages with their specs and locked versions",
+		Long:  "List the packages in the specfile, with their locked versions from the lockfile",
 		Args:  cobra.NoArgs,
 		Run: func(cmd *cobra.Command, args []string) {
 			outputFormat := parseOutputFormat(formatStr)
-			runList(language, all, outputFormat)
+			members := selectWorkspaces(workspaces)
+			var stale time.Duration
+			if staleStr != "" {
+				var err error
+				if stale, err = parseAge(staleStr); err != nil {
+					util.DieUsage("--stale: %s", err)
+				}
+			}
+			if (members != nil || language == backends.AllLanguages) && !changed && since == "" && !installed {
+				runListAggregated(language, members, all, devOnly, prodOnly, stale, outputFormat)
+				return
+			}
+			forEachWorkspace(members, func() {
+				forEachLanguage(language, func(language string) {
+					runList(language, all, devOnly, prodOnly, changed, since, installed, stale, outputFormat)
+				})
+			})
 		},
 	}
 	cmdInstall.Flags().SortFlags = false
 	cmdList.Flags().BoolVarP(
-		&all, "all", "a", false, "list packages from the lockfile instead",
+		&all, "all", "a", false, "also list transitive dependencies from the lockfile",
+	)
+	cmdList.Flags().BoolVar(
+		&devOnly, "dev-only", false, "list only development dependencies",
+	)
+	cmdList.Flags().BoolVar(
+		&prodOnly, "prod-only", false, "list only runtime dependencies",
+	)
+	cmdList.Flags().BoolVar(
+		&changed, "changed", false, "list only packages that changed since the last 'upm list'",
+	)
+	cmdList.Flags().StringVar(
+		&since, "since", "", "list only packages that changed since this git revision",
+	)
+	cmdList.Flags().BoolVar(
+		&installed, "installed", false, "compare the installed packages with the locked versions",
+	)
+	cmdList.Flags().StringVar(
+		&staleStr, "stale", "", `list only packages whose locked versions are older than this, as in "2y" or "6mo"`,
 	)
 	cmdList.Flags().StringVarP(
 		&formatStr, "format", "f", "table", `output format ("table" or "json")`,
 	)
+	addWorkspaceFlags(cmdList, &workspaces, true, cobra.NoArgs)
 	rootCmd.AddCommand(cmdList)
 
+	cmdCheck := &cobra.Command{
+		Use:   "check",
+		Short: "Check that the lockfile is consistent with the specfile",
+		Long: "Check that every specfile package is locked at a satisfying version, and that nothing else is locked, " +
+			"with --policy, that the packages follow the policy in " + policy.File + ", " +
+			"and with --deprecations, that no locked version is deprecated or yanked in the index",
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			outputFormat := parseOutputFormat(formatStr)
+			runCheck(language, outputFormat, checkWithPolicy, checkWithDeprecations)
+		},
+	}
+	cmdCheck.Flags().SortFlags = false
+	cmdCheck.Flags().StringVarP(
+		&formatStr, "format", "f", "table", `output format ("table" or "json")`,
+	)
+	cmdCheck.Flags().BoolVar(
+		&checkWithPolicy, "policy", false, "also check the packages against the policy in "+policy.File,
+	)
+	cmdCheck.Flags().BoolVar(
+		&checkWithDeprecations, "deprecations", false, "also fail if a locked version is deprecated or yanked",
+	)
+	rootCmd.AddCommand(cmdCheck)
+
+	var verifyReproducible bool
+	cmdVerify := &cobra.Command{
+		Use:   "verify",
+		Short: "Check the installed packages against the lockfile",
+		Long: "Check that the installed packages are the locked versions, and that their files " +
+			"match the hashes recorded when they were installed, to detect tampering. With " +
+			"--reproducible, check that locking again produces the same lockfile instead",
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			outputFormat := parseOutputFormat(formatStr)
+			runVerify(language, verifyReproducible, outputFormat)
+		},
+	}
+	cmdVerify.Flags().SortFlags = false
+	cmdVerify.Flags().BoolVar(
+		&verifyReproducible, "reproducible", false,
+		"instead, lock again in a temporary directory and check that the lockfile comes out the same",
+	)
+	cmdVerify.Flags().StringVarP(
+		&formatStr, "format", "f", "table", `output format ("table" or "json")`,
+	)
+	rootCmd.AddCommand(cmdVerify)
+
+	cmdSize := &cobra.Command{
+		Use:   "size",
+		Short: "Show the disk space taken by each installed package",
+		Long: "Show the disk space taken by each installed package, largest first, to find the " +
+			"packages that make the dependency tree large",
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			outputFormat := parseOutputFormat(formatStr)
+			runSize(language, outputFormat)
+		},
+	}
+	cmdSize.Flags().SortFlags = false
+	cmdSize.Flags().StringVarP(
+		&formatStr, "format", "f", "table", `output format ("table" or "json")`,
+	)
+	rootCmd.AddCommand(cmdSize)
+
+	var dedupeCheck bool
+	cmdDedupe := &cobra.Command{
+		Use:   "dedupe",
+		Short: "Reduce the packages locked at several versions",
+		Long: "Run the package manager's deduplication (npm dedupe, yarn dedupe), which locks " +
+			"packages at as few versions as their dependents allow, and report how many extra " +
+			"copies of packages it removed. With --check, only list the packages with several copies",
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			outputFormat := parseOutputFormat(formatStr)
+			runDedupe(language, dedupeCheck, outputFormat)
+		},
+	}
+	cmdDedupe.Flags().SortFlags = false
+	cmdDedupe.Flags().BoolVar(
+		&dedupeCheck, "check", false, "list the packages with several copies instead of deduplicating",
+	)
+	cmdDedupe.Flags().StringVarP(
+		&formatStr, "format", "f", "table", `output format of --check ("table" or "json")`,
+	)
+	cmdDedupe.Flags().BoolVar(
+		&config.Wait, "wait", false, "wait for other upm processes modifying the project instead of failing",
+	)
+	cmdDedupe.Flags().BoolVar(
+		&config.NoLock, "no-lock", false, "do not lock the project against other upm processes",
+	)
+	rootCmd.AddCommand(cmdDedupe)
+
+	cmdShowCapabilities := &cobra.Command{
+		Use:   "show-capabilities",
+		Short: "Show which operations each language backend supports",
+		Long:  "Show, for each language backend (or those matching --lang), which operations it implements, its quirks, and the versions of the tools it runs",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			outputFormat := parseOutputFormat(formatStr)
+			runShowCapabilities(language, outputFormat)
+		},
+	}
+	cmdShowCapabilities.Flags().SortFlags = false
+	cmdShowCapabilities.Flags().StringVarP(
+		&formatStr, "format", "f", "table", `output format ("table" or "json")`,
+	)
+	rootCmd.AddCommand(cmdShowCapabilities)
+
+	cmdDoctor := &cobra.Command{
+		Use:   "doctor",
+		Short: "Diagnose problems with the tools and files of the project",
+		Long: "Check that the tools the project's package manager needs are installed and recent enough, " +
+			"and that the specfile and lockfile are writable and parse, suggesting a fix for each problem",
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			outputFormat := parseOutputFormat(formatStr)
+			runDoctor(language, outputFormat)
+		},
+	}
+	cmdDoctor.Flags().SortFlags = false
+	cmdDoctor.Flags().StringVarP(
+		&formatStr, "format", "f", "table", `output format ("table" or "json")`,
+	)
+	rootCmd.AddCommand(cmdDoctor)
+
 	cmdGuess := &cobra.Command{
 		Use:   "guess",
 		Short: "Guess what packages are needed by your project",
 		Args:  cobra.NoArgs,
 		Run: func(cmd *cobra.Command, args []string) {
 			util.AddIngoredPaths(ignoredPaths)
-			runGuess(language, all, forceGuess, ignoredPackages)
+			runGuess(language, all, forceGuess, ignoredPackages, includeCommands)
 		},
 	}
 	cmdGuess.Flags().SortFlags = false
@@ -274,6 +1087,9 @@ func DoCLI() {
 	cmdGuess.Flags().BoolVarP(
 		&forceGuess, "force", "f", false, "bypass cache",
 	)
+	cmdGuess.Flags().BoolVar(
+		&includeCommands, "include-commands", false, "also guess the packages of commands run in shell scripts and Procfiles",
+	)
 	rootCmd.AddCommand(cmdGuess)
 
 	cmdShowSpecfile := &cobra.Command{
@@ -306,6 +1122,70 @@ func DoCLI() {
 	}
 	rootCmd.AddCommand(cmdShowPackageDir)
 
+	cmdEnv := &cobra.Command{
+		Use:   "env",
+		Short: "Print the path of the environment packages are installed in",
+		Long: "Print the absolute path of the environment packages are installed in, " +
+			"such as the Poetry virtualenv, node_modules or .cask, whether or not it exists yet",
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			outputFormat := parseOutputFormat(formatStr)
+			runEnv(language, outputFormat)
+		},
+	}
+	cmdEnv.Flags().SortFlags = false
+	cmdEnv.Flags().StringVarP(
+		&formatStr, "format", "f", "table", `output format ("table" or "json")`,
+	)
+	rootCmd.AddCommand(cmdEnv)
+
+	cmdExec := &cobra.Command{
+		Use:   "exec [--] COMMAND [ARG...]",
+		Short: "Run a command inside the environment packages are installed in",
+		Long: "Run a command in the project directory with the executables of the environment, " +
+			"such as node_modules/.bin or the virtualenv's bin, first on PATH, " +
+			"and exit with its exit code",
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			runExec(language, args)
+		},
+	}
+	// Flags after the command belong to it, not to UPM.
+	cmdExec.Flags().SetInterspersed(false)
+	rootCmd.AddCommand(cmdExec)
+
+	cmdRun := &cobra.Command{
+		Use:   "run [--] SCRIPT [ARG...]",
+		Short: "Run a script through the package manager",
+		Long: "Run a script defined in the specfile, or an executable installed by a package, " +
+			"through the package manager, as with 'yarn run', 'poetry run' or 'bundle exec', " +
+			"and exit with its exit code",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if listScripts {
+				return cobra.NoArgs(cmd, args)
+			}
+			return cobra.MinimumNArgs(1)(cmd, args)
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			if listScripts {
+				outputFormat := parseOutputFormat(formatStr)
+				runListScripts(language, outputFormat)
+				return
+			}
+			runRun(language, args)
+		},
+	}
+	cmdRun.Flags().SortFlags = false
+	cmdRun.Flags().BoolVar(
+		&listScripts, "list", false, "list the scripts defined in the specfile instead of running one",
+	)
+	cmdRun.Flags().StringVarP(
+		&formatStr, "format", "f", "table", `output format ("table" or "json"), with --list`,
+	)
+	// Flags after the script belong to it, not to UPM.
+	cmdRun.Flags().SetInterspersed(false)
+	rootCmd.AddCommand(cmdRun)
+
 	cmdInstallReplitNixSystemDependencies := &cobra.Command{
 		Use:   `install-replit-nix-system-dependencies "PACKAGE[ SPEC]" ...`,
 		Short: "Install system dependencies into replit.nix using the passed packages and the specfile.",
@@ -316,6 +1196,153 @@ func DoCLI() {
 	}
 	rootCmd.AddCommand(cmdInstallReplitNixSystemDependencies)
 
+	var checkOnly bool
+	cmdSelfUpdate := &cobra.Command{
+		Use:   "self-update",
+		Short: "Update upm to the latest release",
+		Long: "Download the latest release of upm for this platform from GitHub, verify its checksum " +
+			"(and signature, if this build has a release key), and replace the running executable with it",
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			runSelfUpdate(checkOnly)
+		},
+	}
+	cmdSelfUpdate.Flags().BoolVar(
+		&checkOnly, "check", false, "only report whether a newer release is available",
+	)
+	rootCmd.AddCommand(cmdSelfUpdate)
+
+	var resetStats bool
+	cmdStats := &cobra.Command{
+		Use:   "stats",
+		Short: "Show how often each command ran and how long it took",
+		Long: "Show the usage statistics recorded in ~/.local/share/upm/stats.json when stats = true " +
+			"is set in a configuration file. They never leave the machine.",
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			outputFormat := parseOutputFormat(formatStr)
+			runStats(outputFormat, resetStats)
+		},
+	}
+	cmdStats.Flags().SortFlags = false
+	cmdStats.Flags().StringVarP(
+		&formatStr, "format", "f", "table", `output format ("table" or "json")`,
+	)
+	cmdStats.Flags().BoolVar(
+		&resetStats, "reset", false, "delete the statistics",
+	)
+	rootCmd.AddCommand(cmdStats)
+
+	cmdConfig := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect and change the configuration",
+		Args:  cobra.NoArgs,
+	}
+	var showOrigin bool
+	cmdConfigShow := &cobra.Command{
+		Use:   "show",
+		Short: "Show the settings of the configuration files",
+		Long: "Show the settings that apply in the project, merged from the organization configuration file " +
+			"named by " + config.OrgConfigURLEnv + " or " + config.OrgConfigEnv + ", the user-level one and " +
+			"the project's " + config.ProjectConfigFile + ", each overriding the ones before",
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			outputFormat := parseOutputFormat(formatStr)
+			runConfigShow(outputFormat, showOrigin)
+		},
+	}
+	cmdConfigShow.Flags().SortFlags = false
+	cmdConfigShow.Flags().BoolVar(
+		&showOrigin, "origin", false, "also show which configuration files each setting comes from",
+	)
+	cmdConfigShow.Flags().StringVarP(
+		&formatStr, "format", "f", "table", `output format ("table" or "json")`,
+	)
+	cmdConfig.AddCommand(cmdConfigShow)
+
+	cmdConfigGet := &cobra.Command{
+		Use:   "get KEY",
+		Short: "Print the value of a setting",
+		Long: "Print the value of a setting that applies in the project, such as registries.npm, " +
+			"or its default if no configuration file sets it. Lists are printed one item per line.",
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			runConfigGet(args[0])
+		},
+	}
+	cmdConfig.AddCommand(cmdConfigGet)
+
+	var configUser bool
+	cmdConfigSet := &cobra.Command{
+		Use:   "set KEY VALUE",
+		Short: "Change a setting in a configuration file",
+		Long: "Set a setting in the project's " + config.ProjectConfigFile + ", or with --user, in the " +
+			"user-level configuration file, keeping the rest of the file as it is. Lists are comma-separated.",
+		Args: cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			runConfigSet(args[0], args[1], configUser)
+		},
+	}
+	cmdConfigSet.Flags().BoolVar(
+		&configUser, "user", false, "change the user-level configuration file",
+	)
+	cmdConfig.AddCommand(cmdConfigSet)
+
+	cmdConfigUnset := &cobra.Command{
+		Use:   "unset KEY",
+		Short: "Remove a setting from a configuration file",
+		Long:  "Remove a setting from the project's " + config.ProjectConfigFile + ", or with --user, from the user-level configuration file",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			runConfigUnset(args[0], configUser)
+		},
+	}
+	cmdConfigUnset.Flags().BoolVar(
+		&configUser, "user", false, "change the user-level configuration file",
+	)
+	cmdConfig.AddCommand(cmdConfigUnset)
+
+	cmdConfigList := &cobra.Command{
+		Use:   "list",
+		Short: "List the settings, with their values, defaults and descriptions",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			outputFormat := parseOutputFormat(formatStr)
+			runConfigList(outputFormat)
+		},
+	}
+	cmdConfigList.Flags().StringVarP(
+		&formatStr, "format", "f", "table", `output format ("table" or "json")`,
+	)
+	cmdConfig.AddCommand(cmdConfigList)
+	rootCmd.AddCommand(cmdConfig)
+
+	var benchRuns int
+	cmdBench := &cobra.Command{
+		Use:   "bench",
+		Short: "Time list, lock and install with each backend for the project",
+		Long: "Time listing the specfile, locking and installing, in a copy of the project, with each backend " +
+			"that reads the project's specfile (or that matches --lang), and compare the median times",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if benchRuns < 1 {
+				return fmt.Errorf("invalid number of runs %d (must be at least 1)", benchRuns)
+			}
+			return cobra.NoArgs(cmd, args)
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			outputFormat := parseOutputFormat(formatStr)
+			runBench(language, benchRuns, outputFormat)
+		},
+	}
+	cmdBench.Flags().SortFlags = false
+	cmdBench.Flags().IntVarP(
+		&benchRuns, "runs", "n", 3, "how many times to run each backend",
+	)
+	cmdBench.Flags().StringVarP(
+		&formatStr, "format", "f", "table", `output format ("table" or "json")`,
+	)
+	rootCmd.AddCommand(cmdBench)
+
 	specialArgs := map[string](func()){}
 	for _, helpFlag := range []string{"-help", "-?"} {
 		specialArgs[helpFlag] = func() {
@@ -342,10 +1369,18 @@ func DoCLI() {
 	}
 
 	util.ChdirToUPM()
+	util.SetRunLog(".upm/logs/last.log")
+	if err := config.Load(); err != nil {
+		util.DieInitializationError("%s", err)
+	}
+	backends.RegisterExternal()
+	defer recordStats()
 	err := rootCmd.Execute()
 	if err != nil {
 		// We don't need to log anything here,
-		// cobra.Command does its own error logging.
-		os.Exit(1)
+		// cobra.Command does its own error logging. The
+		// errors it returns are those of the command line.
+		os.Exit(int(util.ExitUsage))
 	}
+	notifyUpdate()
 }
@@ -0,0 +1,297 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/store"
+	"github.com/replit/upm/internal/util"
+	"github.com/spf13/cobra"
+)
+
+func TestProxyFlagOverridesEnvironment(t *testing.T) {
+	for _, name := range []string{"HTTP_PROXY", "http_proxy", "https_proxy"} {
+		t.Setenv(name, "")
+	}
+	// SetProxy uses os.Setenv; t.Setenv restores this afterwards.
+	t.Setenv("HTTPS_PROXY", "http://old.example.com:3128")
+	defer func() { config.Proxy = "" }()
+
+	ran := false
+	rootCmd := &cobra.Command{Use: "upm"}
+	addProxyFlag(rootCmd)
+	rootCmd.AddCommand(&cobra.Command{
+		Use: "noop",
+		Run: func(cmd *cobra.Command, args []string) {
+			ran = true
+		},
+	})
+	rootCmd.SetArgs([]string{"--proxy", "http://new.example.com:8080", "noop"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !ran {
+		t.Fatal("subcommand did not run")
+	}
+	if got := os.Getenv("HTTPS_PROXY"); got != "http://new.example.com:8080" {
+		t.Errorf("expected --proxy to override HTTPS_PROXY, got %q", got)
+	}
+}
+
+func TestFilterDeps(t *testing.T) {
+	deps := api.PkgDeps{
+		"express": {Spec: "^4.18.2"},
+		"jest":    {Spec: "^29.7.0", Dev: true},
+	}
+
+	if got := filterDeps(deps, false, false); len(got) != 2 {
+		t.Errorf("expected no filtering, got %v", got)
+	}
+	if got := filterDeps(deps, true, false); len(got) != 1 || !got["jest"].Dev {
+		t.Errorf("expected only jest with --dev-only, got %v", got)
+	}
+	if got := filterDeps(deps, false, true); len(got) != 1 || got["express"].Dev {
+		t.Errorf("expected only express with --prod-only, got %v", got)
+	}
+}
+
+func TestLockfileMissingPackages(t *testing.T) {
+	b := api.LanguageBackend{
+		NormalizePackageName: func(name api.PkgName) api.PkgName {
+			return api.PkgName(strings.ToLower(string(name)))
+		},
+		ListSpecfile: func(bool) api.PkgDeps {
+			return api.PkgDeps{"Flask": {Spec: "^3.0"}, "requests": {}, "rich": {}}
+		},
+		ListLockfile: func() map[api.PkgName]api.PkgVersion {
+			return map[api.PkgName]api.PkgVersion{"flask": "3.0.2", "werkzeug": "3.0.1"}
+		},
+		SourceOfSpec: api.DefaultSpecSource,
+	}
+
+	missing := lockfileMissingPackages(b)
+	if !reflect.DeepEqual(missing, []string{"requests", "rich"}) {
+		t.Errorf("unexpected missing packages %v", missing)
+	}
+}
+
+func TestJoinList(t *testing.T) {
+	b := api.LanguageBackend{
+		NormalizePackageName: func(name api.PkgName) api.PkgName {
+			return api.PkgName(strings.ToLower(string(name)))
+		},
+		SourceOfSpec: api.DefaultSpecSource,
+	}
+	specs := api.PkgDeps{
+		"Flask":  {Spec: ">= 3.0"},
+		"mylib":  {Spec: "@ git+https://github.com/user/mylib@main"},
+		"pytest": {Spec: ">= 8.0", Dev: true},
+	}
+	locked := map[api.PkgName]api.PkgVersion{
+		"flask":    "3.0.2",
+		"mylib":    "0.1.0",
+		"werkzeug": "3.0.1",
+	}
+
+	expected := []listEntry{
+		{Name: "Flask", Spec: ">= 3.0", Version: "3.0.2"},
+		{Name: "mylib", Spec: "@ git+https://github.com/user/mylib@main", Version: "0.1.0", Source: "git+https://github.com/user/mylib#main"},
+		{Name: "pytest", Spec: ">= 8.0", Dev: true},
+	}
+	if got := joinList(b, specs, locked, false); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %+v, got %+v", expected, got)
+	}
+
+	expected = append(expected, listEntry{Name: "werkzeug", Version: "3.0.1", Transitive: true})
+	if got := joinList(b, specs, locked, true); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %+v with --all, got %+v", expected, got)
+	}
+}
+
+func TestFindLocal(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("UPM_STORE", filepath.Join(dir, "store.json"))
+	b := api.LanguageBackend{
+		Name:     "test",
+		Specfile: filepath.Join(dir, "spec"),
+		Lockfile: filepath.Join(dir, "lock"),
+		NormalizePackageName: func(name api.PkgName) api.PkgName {
+			return api.PkgName(strings.ToLower(string(name)))
+		},
+		ListSpecfile: func(bool) api.PkgDeps {
+			return api.PkgDeps{"Flask": {Spec: ">= 3.0", Group: "web"}}
+		},
+		ListLockfile: func() map[api.PkgName]api.PkgVersion {
+			return map[api.PkgName]api.PkgVersion{"flask": "3.0.2", "werkzeug": "3.0.1"}
+		},
+		SourceOfSpec: api.DefaultSpecSource,
+	}
+	for _, file := range []string{b.Specfile, b.Lockfile} {
+		if err := os.WriteFile(file, []byte{}, 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store.Reset()
+	defer store.Reset()
+
+	entries := listLocal(context.Background(), b)
+	expected := listEntry{Name: "Flask", Spec: ">= 3.0", Version: "3.0.2", Group: "web"}
+	if entry, ok := findLocal(b, entries, "flask"); !ok || !reflect.DeepEqual(entry, expected) {
+		t.Errorf("expected %+v, got %+v", expected, entry)
+	}
+	expected = listEntry{Name: "werkzeug", Version: "3.0.1", Transitive: true}
+	if entry, ok := findLocal(b, entries, "werkzeug"); !ok || !reflect.DeepEqual(entry, expected) {
+		t.Errorf("expected %+v, got %+v", expected, entry)
+	}
+	if entry, ok := findLocal(b, entries, "django"); ok {
+		t.Errorf("expected django not to be found, got %+v", entry)
+	}
+}
+
+func TestFetchInfos(t *testing.T) {
+	b := api.LanguageBackend{
+		Info: func(name api.PkgName) api.PkgInfo {
+			if name == "missing" {
+				return api.PkgInfo{}
+			}
+			return api.PkgInfo{Name: string(name), Version: "1.0.0"}
+		},
+	}
+	pkgs := []api.PkgName{"a", "missing", "b", "c", "d", "e", "f", "g", "h", "i"}
+	infos := fetchInfos(b, pkgs)
+	for i, pkg := range pkgs {
+		expected := string(pkg)
+		if pkg == "missing" {
+			expected = ""
+		}
+		if infos[i].Name != expected {
+			t.Errorf("expected %q at index %d, got %+v", expected, i, infos[i])
+		}
+	}
+
+	b.Info = func(name api.PkgName) api.PkgInfo {
+		if name == "c" {
+			util.DieNetwork("registry unreachable")
+		}
+		return api.PkgInfo{Name: string(name)}
+	}
+	err := util.Catch(func() { fetchInfos(b, pkgs) })
+	if err == nil || err.Error() != "registry unreachable" {
+		t.Errorf("expected the lookup error to propagate, got %v", err)
+	}
+}
+
+func TestRankSearchResults(t *testing.T) {
+	b := api.LanguageBackend{}
+	results := []api.PkgInfo{
+		{Name: "flask-login", Downloads: 500, Updated: "2023-10-30", Stars: 3500},
+		{Name: "flask", Downloads: 9000, Updated: "2024-04-07", Stars: 68000},
+		{Name: "flask-cors", Downloads: 500, Updated: "2024-08-30", Stars: 900},
+		{Name: "flask-extra"},
+	}
+	names := func(results []api.PkgInfo) []string {
+		names := []string{}
+		for _, info := range results {
+			names = append(names, info.Name)
+		}
+		return names
+	}
+
+	for by, expected := range map[api.SearchSort][]string{
+		api.SortRelevance: {"flask-login", "flask", "flask-cors", "flask-extra"},
+		api.SortDownloads: {"flask", "flask-login", "flask-cors", "flask-extra"},
+		api.SortUpdated:   {"flask-cors", "flask", "flask-login", "flask-extra"},
+		api.SortStars:     {"flask", "flask-login", "flask-cors", "flask-extra"},
+	} {
+		ranked := rankSearchResults(b, "flask", append([]api.PkgInfo{}, results...), by)
+		if got := names(ranked); !reflect.DeepEqual(got, expected) {
+			t.Errorf("--sort %s: expected %v, got %v", by, expected, got)
+		}
+	}
+
+	if _, err := parseSearchSort("popularity"); err == nil {
+		t.Error("expected --sort popularity to be rejected")
+	}
+}
+
+func TestCheckPackagesExist(t *testing.T) {
+	b := api.LanguageBackend{
+		Info: func(name api.PkgName) api.PkgInfo {
+			switch name {
+			case "requests", "flask":
+				return api.PkgInfo{Name: string(name)}
+			case "offline":
+				util.DieNetwork("registry unreachable")
+			}
+			return api.PkgInfo{}
+		},
+		Search: func(query string) []api.PkgInfo {
+			return []api.PkgInfo{{Name: "requests"}, {Name: "requests-toolbelt"}}
+		},
+	}
+
+	if err := util.Catch(func() { checkPackagesExist(b, []api.PkgName{"flask[async]", "offline"}) }); err != nil {
+		t.Errorf("expected existing and unreachable packages to pass, got %v", err)
+	}
+	err := util.Catch(func() { checkPackagesExist(b, []api.PkgName{"flask", "reqeusts"}) })
+	expected := `no such package: reqeusts (did you mean "requests"?)`
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected %q, got %v", expected, err)
+	}
+}
+
+func TestCheckSpecfileEdit(t *testing.T) {
+	b := api.LanguageBackend{
+		Specfile:             "deps.txt",
+		NormalizePackageName: func(name api.PkgName) api.PkgName { return api.PkgName(strings.ToLower(string(name))) },
+		ListSpecfile: func(bool) api.PkgDeps {
+			return api.PkgDeps{"Flask": {Spec: "^3.0.0"}}
+		},
+	}
+
+	// Only the edits that upm cannot leave to the package manager
+	// are checked.
+	if err := util.Catch(func() { checkSpecfileEdit(b, []api.PkgName{"requests"}, false) }); err != nil {
+		t.Errorf("expected no check without the quirk, got %v", err)
+	}
+
+	b.Quirks = api.QuirksSpecfileEditedDirectly
+	if err := util.Catch(func() { checkSpecfileEdit(b, []api.PkgName{"flask"}, false) }); err != nil {
+		t.Errorf("expected flask to be added, got %v", err)
+	}
+	err := util.Catch(func() { checkSpecfileEdit(b, []api.PkgName{"requests", "flask"}, false) })
+	expected := "deps.txt does not list requests after adding"
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected %q, got %v", expected, err)
+	}
+	err = util.Catch(func() { checkSpecfileEdit(b, []api.PkgName{"flask"}, true) })
+	expected = "deps.txt still lists flask after removing"
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected %q, got %v", expected, err)
+	}
+}
+
+func TestParseSourceArg(t *testing.T) {
+	for arg, expected := range map[string]api.PkgName{
+		"git+https://github.com/user/repo#main":       "repo",
+		"mylib@git+https://github.com/user/repo#main": "mylib",
+		"mylib ../lib": "mylib",
+		"../lib":       "lib",
+	} {
+		if name, _, ok := parseSourceArg(arg); !ok || name != expected {
+			t.Errorf("parseSourceArg(%q) = %q, %v, expected %q", arg, name, ok, expected)
+		}
+	}
+	for _, arg := range []string{"flask", "flask==3.0", "express@^4.18", "@types/node@20"} {
+		if _, source, ok := parseSourceArg(arg); ok {
+			t.Errorf("parseSourceArg(%q) = %+v, expected a registry package", arg, source)
+		}
+	}
+}
@@ -7,15 +7,20 @@ import (
 	"os"
 	"reflect"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/replit/upm/internal/api"
 	"github.com/replit/upm/internal/backends"
 	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/picker"
 	"github.com/replit/upm/internal/store"
 	"github.com/replit/upm/internal/table"
 	"github.com/replit/upm/internal/trace"
 	"github.com/replit/upm/internal/util"
+	"github.com/replit/upm/internal/workspace"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 )
 
@@ -41,29 +46,73 @@ func (s *subroutineSilencer) restore() {
 	config.Quiet = s.origQuiet
 }
 
+// whichLanguageJSONEntry represents one entry in the JSON emitted by
+// 'upm which-language --all'.
+type whichLanguageJSONEntry struct {
+	backends.Detection
+	Selected bool `json:"selected,omitempty"`
+}
+
 // runWhichLanguage implements 'upm which-language'.
-func runWhichLanguage(language string, all bool) {
+func runWhichLanguage(language string, all bool, outputFormat outputFormat) {
+	var selected string
+	err := util.Catch(func() {
+		selected = backends.GetBackend(context.Background(), language).Name
+	})
 	if !all {
-		b := backends.GetBackend(context.Background(), language)
-		fmt.Println(b.Name)
+		if err != nil {
+			panic(err)
+		}
+		switch outputFormat {
+		case outputFormatTable:
+			fmt.Println(selected)
+
+		case outputFormatJSON:
+			outputB, err := json.Marshal(map[string]string{"backend": selected})
+			if err != nil {
+				panic("couldn't marshal json")
+			}
+			fmt.Println(string(outputB))
+
+		default:
+			util.Panicf("unknown output format %d", outputFormat)
+		}
 		return
 	}
-	for _, bi := range backends.GetBackendNames() {
-		if !bi.Available {
-			continue
+
+	detections := backends.DetectAll(language)
+	switch outputFormat {
+	case outputFormatTable:
+		if len(detections) == 0 {
+			util.Log("no language detected")
+			return
 		}
-		if language != "" && !strings.Contains(bi.Name, language) {
-			continue
+		t := table.New("backend", "selected", "evidence")
+		for _, d := range detections {
+			mark := ""
+			if d.Backend == selected {
+				mark = "yes"
+			}
+			t.AddRow(d.Backend, mark, strings.Join(d.Evidence, ", "))
 		}
+		t.Print()
 
-		b := backends.GetBackend(context.Background(), bi.Name)
-
-		// If we can't determine we are in use, don't report
-		if b.IsActive == nil || !b.IsActive() {
-			continue
+	case outputFormatJSON:
+		j := []whichLanguageJSONEntry{}
+		for _, d := range detections {
+			j = append(j, whichLanguageJSONEntry{
+				Detection: d,
+				Selected:  d.Backend == selected,
+			})
 		}
+		outputB, err := json.Marshal(j)
+		if err != nil {
+			panic("couldn't marshal json")
+		}
+		fmt.Println(string(outputB))
 
-		fmt.Println(b.Name)
+	default:
+		util.Panicf("unknown output format %d", outputFormat)
 	}
 }
 
@@ -88,10 +137,124 @@ func makeLoweredHM(normalizePackageName func(api.PkgName) api.PkgName, names []s
 	return set
 }
 
-// runSearch implements 'upm search'.
-func runSearch(language string, args []string, outputFormat outputFormat, ignoredPackages []string) {
+// addGuessExtras adds the packages listed as extra in the [guess]
+// section of the config to the result of a guess.
+func addGuessExtras(guessed map[string][]api.PkgName) {
+	for _, extra := range config.Loaded.Guess.Extra {
+		guessed[extra] = []api.PkgName{api.PkgName(extra)}
+	}
+}
+
+// defaultSearchLimit is the default value of 'upm search --limit'.
+const defaultSearchLimit = 20
+
+// parseSearchSort validates the value of 'upm search --sort'.
+func parseSearchSort(sortStr string) (api.SearchSort, error) {
+	switch by := api.SearchSort(sortStr); by {
+	case api.SortRelevance, api.SortDownloads, api.SortUpdated, api.SortStars:
+		return by, nil
+	default:
+		return "", fmt.Errorf(`invalid sort order %#v (must be "relevance", "downloads", "updated" or "stars")`, sortStr)
+	}
+}
+
+// rankSearchResults orders search results: first by b.SortPackages,
+// if any, and then by by. The ordering is stable, so results with
+// equal download counts or dates keep their relevance order.
+func rankSearchResults(b api.LanguageBackend, query string, results []api.PkgInfo, by api.SearchSort) []api.PkgInfo {
+	if b.SortPackages != nil {
+		results = b.SortPackages(query, results)
+	}
+	switch by {
+	case api.SortDownloads:
+		sort.SliceStable(results, func(i, j int) bool {
+			return results[i].Downloads > results[j].Downloads
+		})
+	case api.SortUpdated:
+		sort.SliceStable(results, func(i, j int) bool {
+			return results[i].Updated > results[j].Updated
+		})
+	case api.SortStars:
+		sort.SliceStable(results, func(i, j int) bool {
+			return results[i].Stars > results[j].Stars
+		})
+	}
+	return results
+}
+
+// pickAndAdd implements 'upm search --interactive': it lets the user
+// choose among the search results and then adds the chosen packages.
+func pickAndAdd(language string, results []api.PkgInfo, ignoredPackages []string) {
+	if len(results) == 0 {
+		util.Log("no search results")
+		return
+	}
+
+	nameWidth, versionWidth := 0, 0
+	for _, info := range results {
+		if len(info.Name) > nameWidth {
+			nameWidth = len(info.Name)
+		}
+		if len(info.Version) > versionWidth {
+			versionWidth = len(info.Version)
+		}
+	}
+	items := []string{}
+	for _, info := range results {
+		items = append(items, fmt.Sprintf("%-*s   %-*s   %s", nameWidth, info.Name, versionWidth, info.Version, info.Description))
+	}
+
+	chosen, err := picker.Pick("Add packages:", items)
+	if err != nil {
+		util.DieConsistency("--interactive: %s", err)
+	}
+	if len(chosen) == 0 {
+		return
+	}
+	pkgs := []string{}
+	for _, i := range chosen {
+		pkgs = append(pkgs, results[i].Name)
+	}
+	runAdd(language, pkgs, false, false, false, ignoredPackages, false, false, "")
+}
+
+// runSearch implements 'upm search'. With exact, only a package named
+// exactly like the query is shown. A limit of zero shows every result.
+// With interactive, the user picks results to add instead.
+func runSearch(language string, args []string, outputFormat outputFormat, ignoredPackages []string, limit int, by api.SearchSort, exact bool, interactive bool) {
 	query := strings.Join(args, " ")
 	b := backends.GetBackend(context.Background(), language)
+	results := searchPackages(b, query, ignoredPackages, limit, by, exact)
+
+	if interactive {
+		pickAndAdd(language, results, ignoredPackages)
+		return
+	}
+
+	switch outputFormat {
+	case outputFormatTable:
+		if len(results) == 0 {
+			util.Log("no search results")
+			return
+		}
+		t := table.FromStructs(results)
+		t.Print()
+
+	case outputFormatJSON:
+		outputB, err := json.Marshal(results)
+		if err != nil {
+			panic(err)
+		}
+		fmt.Println(string(outputB))
+	}
+}
+
+// searchPackages returns the results of 'upm search' for query,
+// ranked and limited.
+func searchPackages(b api.LanguageBackend, query string, ignoredPackages []string, limit int, by api.SearchSort, exact bool) []api.PkgInfo {
+	if b.Search == nil {
+		dieUnsupported(b, "search")
+	}
 
 	var results []api.PkgInfo
 	if strings.TrimSpace(query) == "" {
@@ -114,46 +277,325 @@ func runSearch(language string, args []string, outputFormat outputFormat, ignore
 		results = filtered
 	}
 
-	// Apply some heuristics to give results that more closely resemble the user's query
-	if b.SortPackages != nil {
-		results = b.SortPackages(query, results)
+	if exact {
+		needle := b.NormalizePackageName(api.PkgName(query))
+		filtered := []api.PkgInfo{}
+		for _, pkg := range results {
+			if b.NormalizePackageName(api.PkgName(pkg.Name)) == needle {
+				filtered = append(filtered, pkg)
+			}
+		}
+		// Indexes do not always return the exact match of a
+		// query, so look it up directly.
+		if len(filtered) == 0 && b.Info != nil {
+			if info := b.Info(api.PkgName(query)); info.Name != "" {
+				filtered = append(filtered, info)
+			}
+		}
+		results = filtered
+	}
+
+	if by != api.SortRelevance && b.AnnotateSearch != nil {
+		b.AnnotateSearch(results, by)
+	}
+	if by == api.SortStars {
+		annotateStars(results)
 	}
 
+	// Apply some heuristics to give results that more closely resemble the user's query
+	results = rankSearchResults(b, query, results, by)
+
 	// Output a reasonable number of results.
-	if len(results) > 20 {
-		results = results[:20]
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// infoLine represents one line in the table emitted by 'upm info'.
+type infoLine struct {
+	Field string
+	Value string
+}
+
+// printInfoLines prints the table emitted by 'upm info', aligning
+// the values.
+func printInfoLines(rows []infoLine) {
+	width := 0
+	for _, row := range rows {
+		if len(row.Field) > width {
+			width = len(row.Field)
+		}
+	}
+
+	for _, row := range rows {
+		padLength := width - len(row.Field)
+		padding := strings.Repeat(" ", padLength)
+		fmt.Println(row.Field + ":" + padding + "   " + row.Value)
+	}
+}
+
+// listLocal returns every package that the specfile or lockfile of b
+// mentions, including transitive dependencies.
+func listLocal(ctx context.Context, b api.LanguageBackend) []listEntry {
+	var specs api.PkgDeps = nil
+	var locked map[api.PkgName]api.PkgVersion = nil
+	if util.Exists(b.Specfile) {
+		specs, _ = store.ListSpecfileWithCache(ctx, b)
+	}
+	if util.Exists(b.Lockfile) {
+		locked, _ = store.ListLockfileWithCache(ctx, b)
 	}
+	store.Write(ctx)
+	return joinList(b, specs, locked, true)
+}
 
+// findLocal returns the entry for pkg in entries, as returned by
+// listLocal, and false if there is none.
+func findLocal(b api.LanguageBackend, entries []listEntry, pkg api.PkgName) (listEntry, bool) {
+	norm := b.NormalizePackageName(pkg)
+	for _, entry := range entries {
+		if b.NormalizePackageName(api.PkgName(entry.Name)) == norm {
+			return entry, true
+		}
+	}
+	return listEntry{}, false
+}
+
+// runInfoLocal implements 'upm info --local' for a package that the
+// project depends on.
+func runInfoLocal(entry listEntry, outputFormat outputFormat) {
 	switch outputFormat {
 	case outputFormatTable:
-		if len(results) == 0 {
-			util.Log("no search results")
-			return
+		rows := []infoLine{{Field: "Name", Value: entry.Name}}
+		for _, row := range []infoLine{
+			{Field: "Spec", Value: entry.Spec},
+			{Field: "Locked version", Value: entry.Version},
+			{Field: "Type", Value: depType(entry)},
+			{Field: "Group", Value: entry.Group},
+			{Field: "Relation", Value: depRelation(entry)},
+		} {
+			if row.Value != "" {
+				rows = append(rows, row)
+			}
 		}
-		t := table.FromStructs(results)
-		t.Print()
+		printInfoLines(rows)
 
 	case outputFormatJSON:
-		outputB, err := json.Marshal(results)
+		outputB, err := json.Marshal(entry)
 		if err != nil {
 			panic(err)
 		}
 		fmt.Println(string(outputB))
+
+	default:
+		util.Panicf("unknown output format %d", outputFormat)
 	}
 }
 
-// infoLine represents one line in the table emitted by 'upm info'.
-type infoLine struct {
-	Field string
-	Value string
+// infoConcurrency is the number of packages that 'upm info' looks up
+// in the registry at the same time.
+const infoConcurrency = 8
+
+// lookupInfos runs b.Info on every package in pkgs, infoConcurrency
+// at a time, and returns the results in the same order. Packages that
+// do not exist have an empty Name. If a lookup dies, its error is
+// returned in errs at the same index.
+func lookupInfos(b api.LanguageBackend, pkgs []api.PkgName) (infos []api.PkgInfo, errs []error) {
+	infos = make([]api.PkgInfo, len(pkgs))
+	errs = make([]error, len(pkgs))
+	sem := make(chan struct{}, infoConcurrency)
+	var wg sync.WaitGroup
+	for i, pkg := range pkgs {
+		wg.Add(1)
+		go func(i int, pkg api.PkgName) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			errs[i] = util.Catch(func() {
+				infos[i] = b.Info(pkg)
+			})
+		}(i, pkg)
+	}
+	wg.Wait()
+	return infos, errs
 }
 
-// runInfo implements 'upm info'.
-func runInfo(language string, pkg string, outputFormat outputFormat) {
-	b := backends.GetBackend(context.Background(), language)
+// fetchInfos is like lookupInfos, but if any lookup dies, it dies
+// with the error of the first one.
+func fetchInfos(b api.LanguageBackend, pkgs []api.PkgName) []api.PkgInfo {
+	infos, errs := lookupInfos(b, pkgs)
+	for _, err := range errs {
+		if err != nil {
+			panic(err)
+		}
+	}
+	return infos
+}
+
+// runInfoMany implements 'upm info' for several packages, or for
+// --all. The output combines the results into one table or JSON list.
+// With local, packages the project depends on are reported from the
+// specfile and lockfile, and the rest are only looked up in the
+// registry if remote is set.
+func runInfoMany(ctx context.Context, b api.LanguageBackend, pkgs []api.PkgName, local bool, remote bool, outputFormat outputFormat) {
+	entries := []listEntry{}
+	lookup := pkgs
+	if local {
+		known := listLocal(ctx, b)
+		lookup = []api.PkgName{}
+		for _, pkg := range pkgs {
+			if entry, ok := findLocal(b, known, pkg); ok {
+				entries = append(entries, entry)
+			} else {
+				lookup = append(lookup, pkg)
+			}
+		}
+		if len(lookup) > 0 && !remote {
+			names := []string{}
+			for _, pkg := range lookup {
+				names = append(names, string(pkg))
+			}
+			util.DieConsistency("not dependencies of this project: %s (use --remote to query the registry)", strings.Join(names, ", "))
+		}
+	}
+
+	infos := []api.PkgInfo{}
+	missing := []string{}
+	if len(lookup) > 0 {
+		if b.Info == nil {
+			dieUnsupported(b, "info")
+		}
+		for i, info := range fetchInfos(b, lookup) {
+			if info.Name == "" {
+				missing = append(missing, string(lookup[i]))
+			} else {
+				infos = append(infos, info)
+			}
+		}
+	}
+
+	switch outputFormat {
+	case outputFormatTable:
+		if len(pkgs) == 0 {
+			util.Log("no packages in specfile")
+		}
+		if len(entries) > 0 {
+			printListTable(entries)
+		}
+		if len(infos) > 0 {
+			if len(entries) > 0 {
+				fmt.Println()
+			}
+			t := table.FromStructs(infos)
+			t.Print()
+		}
+
+	case outputFormatJSON:
+		j := []interface{}{}
+		for _, entry := range entries {
+			j = append(j, entry)
+		}
+		for _, info := range infos {
+			j = append(j, info)
+		}
+		outputB, err := json.Marshal(j)
+		if err != nil {
+			panic(err)
+		}
+		fmt.Println(string(outputB))
+
+	default:
+		util.Panicf("unknown output format %d", outputFormat)
+	}
+
+	if len(missing) == 1 {
+		util.DieConsistency("no such package: %s%s", missing[0], didYouMean(missing[0], registryCandidates(b, missing[0])))
+	}
+	if len(missing) > 1 {
+		util.DieConsistency("no such packages: %s", strings.Join(missing, ", "))
+	}
+}
+
+// runInfo implements 'upm info'. With local, it reports what the
+// project itself says about a package, and only queries the registry
+// if the project does not depend on it and remote is set. With all,
+// it reports on every package in the specfile. With health and readme,
+// it also scores the package's maintenance and shows its readme.
+func runInfo(language string, pkgs []string, all bool, local bool, remote bool, health bool, readme bool, outputFormat outputFormat) {
+	ctx := context.Background()
+	b := backends.GetBackend(ctx, language)
+	names := []api.PkgName{}
+	for _, pkg := range pkgs {
+		names = append(names, api.PkgName(pkg))
+	}
+	if all {
+		if !util.Exists(b.Specfile) {
+			util.DieIO("%s: no such file", b.Specfile)
+		}
+		for name := range b.ListSpecfile(true) {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool {
+			return names[i] < names[j]
+		})
+	}
+	if health && (all || len(names) != 1) {
+		util.DieUsage("--health takes exactly one package")
+	}
+	if health && local {
+		util.DieUsage("--health looks the package up in the registry, so it cannot be combined with --local")
+	}
+	if readme && (all || len(names) != 1) {
+		util.DieUsage("--readme takes exactly one package")
+	}
+	if readme && local {
+		util.DieUsage("--readme looks the package up in the registry, so it cannot be combined with --local")
+	}
+	if readme && b.FetchReadme == nil {
+		dieUnsupported(b, "readme")
+	}
+	if all || len(names) != 1 {
+		runInfoMany(ctx, b, names, local, remote, outputFormat)
+		return
+	}
+
+	pkg := pkgs[0]
+	if local {
+		entry, ok := findLocal(b, listLocal(ctx, b), api.PkgName(pkg))
+		if ok {
+			runInfoLocal(entry, outputFormat)
+			return
+		}
+		if !remote {
+			candidates := []string{}
+			for _, entry := range listLocal(ctx, b) {
+				candidates = append(candidates, entry.Name)
+			}
+			util.DieConsistency("%s is not a dependency of this project%s (use --remote to query the registry)", pkg, didYouMean(pkg, candidates))
+		}
+	}
+
+	if b.Info == nil {
+		dieUnsupported(b, "info")
+	}
 	info := b.Info(api.PkgName(pkg))
 	if info.Name == "" {
-		util.DieConsistency("no such package: %s", pkg)
+		util.DieConsistency("no such package: %s%s", pkg, didYouMean(pkg, registryCandidates(b, pkg)))
+	}
+	annotateInfo(b, &info)
+	if info.Deprecated != "" {
+		util.LogError(fmt.Sprintf("%s %s is %s", info.Name, info.Version, info.Deprecated))
+	}
+	var report *healthReport
+	if health {
+		h := packageHealth(info)
+		report = &h
+	}
+	var longDescription *api.Readme
+	if readme {
+		r := b.FetchReadme(api.PkgName(pkg))
+		longDescription = &r
 	}
 
 	switch outputFormat {
@@ -167,6 +609,10 @@ func runInfo(language string, pkg string, outputFormat outputFormat) {
 			switch infoV.Field(i).Kind() {
 			case reflect.String:
 				value = infoV.Field(i).String()
+			case reflect.Int, reflect.Int64:
+				if infoV.Field(i).Int() != 0 {
+					value = strconv.FormatInt(infoV.Field(i).Int(), 10)
+				}
 			case reflect.Slice:
 				parts := []string{}
 				length := infoV.Field(i).Len()
@@ -179,6 +625,9 @@ func runInfo(language string, pkg string, outputFormat outputFormat) {
 			if value == "" {
 				continue
 			}
+			if infoT.Field(i).Name == "Updated" {
+				value = releasedAgo(value, time.Now())
+			}
 
 			rows = append(rows, infoLine{Field: field, Value: value})
 		}
@@ -190,21 +639,24 @@ func runInfo(language string, pkg string, outputFormat outputFormat) {
 			)
 		}
 
-		width := len(rows[0].Field)
-		for i := 1; i < len(rows); i++ {
-			if len(rows[i].Field) > width {
-				width = len(rows[i].Field)
-			}
+		printInfoLines(rows)
+		if report != nil {
+			printHealth(*report)
 		}
-
-		for _, row := range rows {
-			padLength := width - len(row.Field)
-			padding := strings.Repeat(" ", padLength)
-			fmt.Println(row.Field + ":" + padding + "   " + row.Value)
+		if longDescription != nil {
+			printReadme(info.Name, *longDescription)
 		}
 
 	case outputFormatJSON:
-		outputB, err := json.Marshal(info)
+		var output interface{} = info
+		if report != nil || longDescription != nil {
+			output = struct {
+				api.PkgInfo
+				Health *healthReport `json:"health,omitempty"`
+				Readme *api.Readme   `json:"readme,omitempty"`
+			}{info, report, longDescription}
+		}
+		outputB, err := json.Marshal(output)
 		if err != nil {
 			panic(err)
 		}
@@ -218,6 +670,10 @@ func deleteLockfile(ctx context.Context, b api.LanguageBackend) {
 	span, ctx := tracer.StartSpanFromContext(ctx, "deleteLockfile")
 	defer span.Finish()
 	if util.Exists(b.Lockfile) {
+		if config.DryRun {
+			fmt.Println("would delete " + b.Lockfile)
+			return
+		}
 		util.ProgressMsg("delete " + b.Lockfile)
 		os.Remove(b.Lockfile)
 	}
@@ -245,10 +701,12 @@ func maybeLock(ctx context.Context, b api.LanguageBackend, forceLock bool) bool
 	}
 
 	if shouldLock {
+		reportPhase("lock", nil)
 		b.Lock(ctx)
 		return true
 	}
 
+	util.Verbosef("skipping lock: %s is up to date", b.Lockfile)
 	return false
 }
 
@@ -266,7 +724,10 @@ func maybeInstall(ctx context.Context, b api.LanguageBackend, forceInstall bool)
 			needsPackageDir = !util.Exists(packageDir)
 		}
 		if forceInstall || store.HasSpecfileChanged(b) || needsPackageDir {
+			reportPhase("install", nil)
 			b.Install(ctx)
+		} else {
+			util.Verbosef("skipping install: packages are up to date")
 		}
 	} else {
 		if !util.Exists(b.Specfile) {
@@ -277,11 +738,31 @@ func maybeInstall(ctx context.Context, b api.LanguageBackend, forceInstall bool)
 			needsPackageDir = !util.Exists(packageDir)
 		}
 		if forceInstall || store.HasSpecfileChanged(b) || needsPackageDir {
+			reportPhase("install", nil)
 			b.Install(ctx)
+		} else {
+			util.Verbosef("skipping install: packages are up to date")
 		}
 	}
 }
 
+// runInit implements 'upm init'.
+func runInit(language string, name string, version string, license string) {
+	span, ctx := trace.StartSpanFromExistingContext("runInit")
+	defer span.Finish()
+	b := backends.GetBackend(ctx, language)
+	if b.Init == nil {
+		dieUnsupported(b, "init")
+	}
+	ensureTools(b)
+	defer lockProject()()
+
+	if util.Exists(b.Specfile) {
+		util.DieOverwrite("%s already exists", b.Specfile)
+	}
+	b.Init(ctx, api.ProjectMetadata{Name: name, Version: version, License: license})
+}
+
 // runAdd implements 'upm add'.
 func runAdd(
 	language string, args []string, upgrade bool,
@@ -289,12 +770,63 @@ func runAdd(
 	forceLock bool, forceInstall bool, name string) {
 	span, ctx := trace.StartSpanFromExistingContext("runAdd")
 	defer span.Finish()
+	defer beginProgress("add", "lock", "install").end()
 	b := backends.GetBackend(ctx, language)
+	ensureTools(b)
+	defer lockProject()()
+	t := beginTransaction(b)
+	defer t.end()
 
+	if config.Dev && !b.SupportsDev {
+		dieUnsupported(b, "dev-dependencies")
+	}
+	if config.Group != "" && !b.SupportsGroups {
+		dieUnsupported(b, "dependency-groups")
+	}
+	if config.Reason != "" && !b.SupportsReasons {
+		dieUnsupported(b, "reasons")
+	}
+
+	args, sourcePkgs := splitSourceArgs(b, args)
 	normPkgs := b.NormalizePackageArgs(args)
+	requested := map[api.PkgName]bool{}
+	for norm := range normPkgs {
+		requested[norm] = true
+	}
+	// Packages from git, URLs and paths are not in the registry,
+	// so they are neither checked there nor validated as versions.
+	for norm, coords := range sourcePkgs {
+		normPkgs[norm] = coords
+		delete(requested, norm)
+	}
+	if b.ValidatePackageName != nil {
+		for _, coords := range normPkgs {
+			if err := b.ValidatePackageName(api.PkgName(coords.Name)); err != nil {
+				util.DieConsistency("%s: %s", coords.Name, err)
+			}
+		}
+	}
+	if b.ValidateSpec != nil {
+		for norm, coords := range normPkgs {
+			if _, ok := sourcePkgs[norm]; ok || coords.Spec == "" {
+				continue
+			}
+			if err := b.ValidateSpec(coords.Spec); err != nil {
+				expected := ""
+				if b.SpecSyntax != "" {
+					expected = fmt.Sprintf(" (expected %s)", b.SpecSyntax)
+				}
+				util.DieConsistency("%s: invalid spec %q: %s%s", coords.Name, coords.Spec, err, expected)
+			}
+		}
+	}
 
 	if guess {
+		if b.Guess == nil {
+			dieUnsupported(b, "guess")
+		}
 		guessed := store.GuessWithCache(ctx, b, forceGuess)
+		addGuessExtras(guessed)
 
 		// Map from normalized package names to original
 		// names.
@@ -337,14 +869,59 @@ func runAdd(
 
 	if util.Exists(b.Specfile) {
 		s := silenceSubroutines()
-		for name, spec := range b.ListSpecfile(true) {
-			if spec == normPkgs[b.NormalizePackageName(name)].Spec {
-				delete(normPkgs, b.NormalizePackageName(name))
+		for name, dep := range b.ListSpecfile(true) {
+			norm := b.NormalizePackageName(name)
+			coords, ok := normPkgs[norm]
+			if !ok {
+				continue
+			}
+			if dep.Spec == coords.Spec {
+				delete(normPkgs, norm)
+			} else {
+				// Keep the spelling of the specfile, so
+				// that e.g. "upm add django" updates
+				// "Django" rather than adding it again.
+				coords.Name = string(name)
+				normPkgs[norm] = coords
 			}
+			// Packages already in the specfile exist.
+			delete(requested, norm)
 		}
 		s.restore()
 	}
 
+	// Offered before the checks, so that they apply to these too.
+	companions := typeCompanions(b, normPkgs, sourcePkgs)
+	if config.Dev && config.Group == "" {
+		for norm, coords := range companions {
+			normPkgs[norm] = coords
+		}
+		companions = nil
+	}
+
+	enforcePolicy(b, normPkgs, sourcePkgs)
+	enforcePolicy(b, companions, nil)
+
+	// Catch typos before the package manager fails with a less
+	// helpful message.
+	unknown := []api.PkgName{}
+	for norm, coords := range normPkgs {
+		if requested[norm] {
+			unknown = append(unknown, api.PkgName(coords.Name))
+		}
+	}
+	sort.Slice(unknown, func(i, j int) bool {
+		return unknown[i] < unknown[j]
+	})
+	checkPackagesExist(b, unknown)
+	checkTyposquats(b, unknown)
+	unspecified := unspecifiedPkgs(normPkgs, sourcePkgs)
+	unspecifiedCompanions := unspecifiedPkgs(companions, nil)
+	applyMinReleaseAge(b, normPkgs, sourcePkgs)
+	applyMinReleaseAge(b, companions, nil)
+	applySpecPolicy(b, normPkgs, unspecified)
+	applySpecPolicy(b, companions, unspecifiedCompanions)
+
 	if upgrade {
 		deleteLockfile(ctx, b)
 	}
@@ -355,7 +932,21 @@ func runAdd(
 			pkgs[api.PkgName(nameAndSpec.Name)] = nameAndSpec.Spec
 		}
 
-		b.Add(ctx, pkgs, name)
+		names := []api.PkgName{}
+		for pkg := range pkgs {
+			names = append(names, pkg)
+		}
+		reportPhase("add", names)
+		if leftOut := addPackages(ctx, b, t, pkgs, name, config.Partial); len(leftOut) > 0 {
+			names = dropPackages(b, names, normPkgs, leftOut)
+		}
+		checkSpecfileEdit(b, names, false)
+		addTypeCompanions(ctx, b, companions, name)
+		specs := policySpecs(normPkgs, unspecified)
+		for name, spec := range policySpecs(companions, unspecifiedCompanions) {
+			specs[name] = spec
+		}
+		alignSpecs(ctx, b, specs)
 	}
 
 	if len(normPkgs) == 0 || b.QuirksDoesAddRemoveNotAlsoLock() {
@@ -368,10 +959,59 @@ func runAdd(
 		maybeInstall(ctx, b, forceInstall)
 	}
 
+	applyPatches(b)
+
 	store.Read(ctx, b)
 	store.ClearGuesses(ctx, b)
 	store.UpdateFileHashes(ctx, b)
 	store.Write(ctx)
+
+	added := []api.PkgName{}
+	fromRegistry := []api.PkgName{}
+	for norm, nameAndSpec := range normPkgs {
+		added = append(added, api.PkgName(nameAndSpec.Name))
+		if _, ok := sourcePkgs[norm]; !ok {
+			fromRegistry = append(fromRegistry, api.PkgName(nameAndSpec.Name))
+		}
+	}
+	for _, coords := range companions {
+		added = append(added, api.PkgName(coords.Name))
+		fromRegistry = append(fromRegistry, api.PkgName(coords.Name))
+	}
+	warnDeprecated(b, fromRegistry)
+	runHooks(ctx, b, "add", added)
+}
+
+// checkSpecfileEdit makes sure, for the backends that edit the
+// specfile themselves, that the packages are in it after add, or with
+// removed, no longer in it after remove. No package manager checks
+// such an edit, and locking would otherwise silently go ahead without
+// it.
+func checkSpecfileEdit(b api.LanguageBackend, names []api.PkgName, removed bool) {
+	if !b.QuirksIsSpecfileEditedDirectly() || config.DryRun {
+		return
+	}
+	s := silenceSubroutines()
+	specfilePkgs := b.ListSpecfile(true)
+	s.restore()
+	inSpecfile := map[api.PkgName]bool{}
+	for name := range specfilePkgs {
+		inSpecfile[b.NormalizePackageName(name)] = true
+	}
+	wrong := []string{}
+	for _, name := range names {
+		if inSpecfile[b.NormalizePackageName(name)] == removed {
+			wrong = append(wrong, string(name))
+		}
+	}
+	if len(wrong) == 0 {
+		return
+	}
+	sort.Strings(wrong)
+	if removed {
+		util.DieConsistency("%s still lists %s after removing", b.Specfile, strings.Join(wrong, ", "))
+	}
+	util.DieConsistency("%s does not list %s after adding", b.Specfile, strings.Join(wrong, ", "))
 }
 
 // runRemove implements 'upm remove'.
@@ -379,7 +1019,12 @@ func runRemove(language string, args []string, upgrade bool,
 	forceLock bool, forceInstall bool) {
 	span, ctx := trace.StartSpanFromExistingContext("runRemove")
 	defer span.Finish()
+	defer beginProgress("remove", "lock", "install").end()
 	b := backends.GetBackend(ctx, language)
+	ensureTools(b)
+	defer lockProject()()
+	t := beginTransaction(b)
+	defer t.end()
 
 	if !util.Exists(b.Specfile) {
 		return
@@ -389,20 +1034,27 @@ func runRemove(language string, args []string, upgrade bool,
 	specfilePkgs := b.ListSpecfile(true)
 	s.restore()
 
-	// Map whose keys are normalized package names.
-	normSpecfilePkgs := map[api.PkgName]bool{}
+	// Map from normalized package names to the names as spelled
+	// in the specfile.
+	normSpecfilePkgs := map[api.PkgName]api.PkgName{}
 	for name := range specfilePkgs {
-		normSpecfilePkgs[b.NormalizePackageName(name)] = true
+		normSpecfilePkgs[b.NormalizePackageName(name)] = name
 	}
 
-	// Map from normalized package names to original package
-	// names.
-	normPkgs := map[api.PkgName]string{}
+	// Map from normalized package names to the names to pass to
+	// the backend, so that e.g. "upm remove Django" removes
+	// "django".
+	normPkgs := map[api.PkgName]api.PkgName{}
 	for _, arg := range args {
-		name := arg
 		norm := b.NormalizePackageName(api.PkgName(arg))
-		if normSpecfilePkgs[norm] {
+		if name, ok := normSpecfilePkgs[norm]; ok {
 			normPkgs[norm] = name
+		} else {
+			candidates := []string{}
+			for name := range specfilePkgs {
+				candidates = append(candidates, string(name))
+			}
+			util.Log(fmt.Sprintf("%s is not in %s%s", arg, b.Specfile, didYouMean(arg, candidates)))
 		}
 	}
 
@@ -412,10 +1064,16 @@ func runRemove(language string, args []string, upgrade bool,
 
 	if len(normPkgs) >= 1 {
 		pkgs := map[api.PkgName]bool{}
-		for name := range normPkgs {
+		for _, name := range normPkgs {
 			pkgs[name] = true
 		}
+		names := []api.PkgName{}
+		for pkg := range pkgs {
+			names = append(names, pkg)
+		}
+		reportPhase("remove", names)
 		b.Remove(ctx, pkgs)
+		checkSpecfileEdit(b, names, true)
 	}
 
 	if len(normPkgs) == 0 || b.QuirksDoesAddRemoveNotAlsoLock() {
@@ -428,17 +1086,41 @@ func runRemove(language string, args []string, upgrade bool,
 		maybeInstall(ctx, b, forceInstall)
 	}
 
+	applyPatches(b)
+
 	store.Read(ctx, b)
 	store.ClearGuesses(ctx, b)
 	store.UpdateFileHashes(ctx, b)
 	store.Write(ctx)
+
+	removed := []api.PkgName{}
+	for _, name := range normPkgs {
+		removed = append(removed, name)
+	}
+	runHooks(ctx, b, "remove", removed)
 }
 
 // runLock implements 'upm lock'.
-func runLock(language string, upgrade bool, forceLock bool, forceInstall bool) {
+func runLock(language string, upgrade bool, forceLock bool, forceInstall bool, showDiff bool, repair bool) {
 	span, ctx := trace.StartSpanFromExistingContext("runLock")
 	defer span.Finish()
+	defer beginProgress("lock", "install").end()
 	b := backends.GetBackend(ctx, language)
+	ensureTools(b)
+	defer lockProject()()
+	t := beginTransaction(b)
+	defer t.end()
+
+	// A broken lockfile cannot be compared with.
+	if repair && repairLockfile(ctx, b) {
+		forceLock = true
+		showDiff = false
+	}
+
+	var before map[api.PkgName]api.PkgVersion
+	if showDiff {
+		before = lockedVersions(b)
+	}
 
 	if upgrade {
 		deleteLockfile(ctx, b)
@@ -449,135 +1131,489 @@ func runLock(language string, upgrade bool, forceLock bool, forceInstall bool) {
 	if !(didLock && b.QuirksDoesLockAlsoInstall()) {
 		maybeInstall(ctx, b, forceInstall)
 	}
+	applyPatches(b)
 
 	store.Read(ctx, b)
 	store.UpdateFileHashes(ctx, b)
 	store.Write(ctx)
+
+	if showDiff {
+		printChanges(diffLockfile(before, lockedVersions(b)), b.Lockfile, "from locking", outputFormatTable)
+	}
+}
+
+// lockfileMissingPackages returns the sorted names of the packages in
+// the specfile that do not appear in the lockfile.
+func lockfileMissingPackages(b api.LanguageBackend) []string {
+	locked := map[api.PkgName]bool{}
+	for name := range b.ListLockfile() {
+		locked[b.NormalizePackageName(name)] = true
+	}
+	missing := []string{}
+	for name := range b.ListSpecfile(true) {
+		if !locked[b.NormalizePackageName(name)] {
+			missing = append(missing, string(name))
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// verifyFrozen terminates the process unless the lockfile exists and
+// covers every package in the specfile.
+func verifyFrozen(b api.LanguageBackend) {
+	if b.QuirksIsNotReproducible() {
+		util.DieUnimplemented("%s has no lockfile, so it cannot be installed with --frozen", b.Name)
+	}
+	if !util.Exists(b.Specfile) {
+		util.DieIO("%s: no such file", b.Specfile)
+	}
+	if !util.Exists(b.Lockfile) {
+		util.DieStaleLockfile("%s is missing; run 'upm lock' first", b.Lockfile)
+	}
+	s := silenceSubroutines()
+	missing := lockfileMissingPackages(b)
+	s.restore()
+	if len(missing) > 0 {
+		util.DieStaleLockfile(
+			"%s is out of date with %s, missing: %s",
+			b.Lockfile, b.Specfile, strings.Join(missing, ", "),
+		)
+	}
 }
 
 // runInstall implements 'upm install'.
 func runInstall(language string, force bool) {
 	span, ctx := trace.StartSpanFromExistingContext("runInstall")
 	defer span.Finish()
+	defer beginProgress("install").end()
 	b := backends.GetBackend(ctx, language)
+	ensureTools(b)
+	defer lockProject()()
+	t := beginTransaction(b)
+	defer t.end()
+
+	if config.Frozen {
+		verifyFrozen(b)
+	}
+
+	if config.Prod {
+		// A production install is never recorded in the store,
+		// so that a later regular install brings back the
+		// development dependencies.
+		maybeInstall(ctx, b, true)
+		applyPatches(b)
+		runInstallHooks(ctx, b)
+		return
+	}
 
 	maybeInstall(ctx, b, force)
+	applyPatches(b)
 
 	store.Read(ctx, b)
 	store.UpdateFileHashes(ctx, b)
 	store.Write(ctx)
+
+	runInstallHooks(ctx, b)
 }
 
-// listSpecfileJSONEntry represents one entry in the JSON list emitted
-// by 'upm list'.
-type listSpecfileJSONEntry struct {
-	Name string `json:"name"`
-	Spec string `json:"spec"`
+// runInstallHooks runs the hooks for 'upm install', which concerns
+// all of the packages in the specfile. The specfile is only read if
+// there are hooks to run.
+func runInstallHooks(ctx context.Context, b api.LanguageBackend) {
+	if config.DryRun || len(config.Loaded.Hooks) == 0 || !util.Exists(b.Specfile) {
+		runHooks(ctx, b, "install", nil)
+		return
+	}
+	s := silenceSubroutines()
+	deps := b.ListSpecfile(true)
+	s.restore()
+	names := []api.PkgName{}
+	for name := range deps {
+		names = append(names, name)
+	}
+	runHooks(ctx, b, "install", names)
 }
 
-// listLockfileJSONEntry represents one entry in the JSON list emitted
-// by 'upm list -a'.
-type listLockfileJSONEntry struct {
-	Name    string `json:"name"`
-	Version string `json:"version"`
+// listEntry represents one package in 'upm list'. The JSON form is
+// what --format json emits.
+type listEntry struct {
+	Workspace  string `json:"workspace,omitempty"`
+	Language   string `json:"language,omitempty"`
+	Name       string `json:"name"`
+	Spec       string `json:"spec,omitempty"`
+	Version    string `json:"version,omitempty"`
+	Source     string `json:"source,omitempty"`
+	Dev        bool   `json:"dev,omitempty"`
+	Group      string `json:"group,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+	Transitive bool   `json:"transitive,omitempty"`
+
+	// The integrity hashes of the locked package, only with
+	// --all.
+	Hashes []string `json:"hashes,omitempty"`
+
+	// When the locked version was released, as in "2024-05-01",
+	// only with --stale.
+	Released string `json:"released,omitempty"`
 }
 
-// runList implements 'upm list'.
-func runList(language string, all bool, outputFormat outputFormat) {
-	span, ctx := trace.StartSpanFromExistingContext("runList")
-	defer span.Finish()
-	b := backends.GetBackend(ctx, language)
-	if !all {
-		var results map[api.PkgName]api.PkgSpec = nil
-		fileExists := util.Exists(b.Specfile)
-		if fileExists {
-			results = b.ListSpecfile(true)
+// joinList combines the specfile and lockfile listings of b into one
+// entry per package, sorted by name. Lockfile packages that are not in
+// the specfile are transitive dependencies, and are only included if
+// all is set. Either map may be nil.
+func joinList(b api.LanguageBackend, specs api.PkgDeps, locked map[api.PkgName]api.PkgVersion, all bool) []listEntry {
+	versions := map[api.PkgName]api.PkgVersion{}
+	for name, version := range locked {
+		versions[b.NormalizePackageName(name)] = version
+	}
+
+	entries := []listEntry{}
+	direct := map[api.PkgName]bool{}
+	for name, dep := range specs {
+		norm := b.NormalizePackageName(name)
+		direct[norm] = true
+		entry := listEntry{
+			Name:    string(name),
+			Spec:    string(dep.Spec),
+			Version: string(versions[norm]),
+			Dev:     dep.Dev,
+			Group:   dep.Group,
+			Reason:  dep.Reason,
 		}
-		switch outputFormat {
-		case outputFormatTable:
-			switch {
-			case !fileExists:
-				util.Log("no specfile")
-				return
-			case len(results) == 0:
-				util.Log("no packages in specfile")
-				return
-			}
-			t := table.New("name", "spec")
-			for name, spec := range results {
-				t.AddRow(string(name), string(spec))
+		if source, ok := b.SourceOfSpec(dep.Spec); ok {
+			entry.Source = source.String()
+		}
+		entries = append(entries, entry)
+	}
+	if all {
+		for name, version := range locked {
+			if direct[b.NormalizePackageName(name)] {
+				continue
 			}
-			t.SortBy("name")
-			t.Print()
+			entries = append(entries, listEntry{
+				Name:       string(name),
+				Version:    string(version),
+				Transitive: true,
+			})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+	return entries
+}
 
-		case outputFormatJSON:
-			j := []listSpecfileJSONEntry{}
-			for name, spec := range results {
-				j = append(j, listSpecfileJSONEntry{
-					Name: string(name),
-					Spec: string(spec),
-				})
-			}
-			outputB, err := json.Marshal(j)
-			if err != nil {
-				panic("couldn't marshal json")
-			}
-			fmt.Println(string(outputB))
+// filterDeps returns the development dependencies in deps if devOnly
+// is set, the runtime dependencies if prodOnly is set, and all of them
+// otherwise.
+func filterDeps(deps api.PkgDeps, devOnly bool, prodOnly bool) api.PkgDeps {
+	if !devOnly && !prodOnly {
+		return deps
+	}
+	filtered := api.PkgDeps{}
+	for name, dep := range deps {
+		if dep.Dev == devOnly {
+			filtered[name] = dep
+		}
+	}
+	return filtered
+}
 
-		default:
-			util.Panicf("unknown output format %d", outputFormat)
+// depType returns the value of the "type" column of 'upm list'.
+func depType(entry listEntry) string {
+	switch {
+	case entry.Transitive:
+		return ""
+	case entry.Dev:
+		return "dev"
+	default:
+		return "runtime"
+	}
+}
+
+// depRelation returns the value of the "relation" column of 'upm
+// list'.
+func depRelation(entry listEntry) string {
+	if entry.Transitive {
+		return "transitive"
+	}
+	return "direct"
+}
+
+// printListTable prints entries as the table emitted by 'upm list'.
+// The reasons recorded with 'upm add --reason' are only shown with
+// --verbose.
+func printListTable(entries []listEntry) {
+	columns := []string{"name", "spec", "version", "type", "group", "relation"}
+	if config.Verbose {
+		columns = append(columns, "reason")
+	}
+	withWorkspace := len(entries) > 0 && entries[0].Workspace != ""
+	withLanguage := len(entries) > 0 && entries[0].Language != ""
+	withReleased := len(entries) > 0 && entries[0].Released != ""
+	if withReleased {
+		columns = append(columns, "released")
+	}
+	if withLanguage {
+		columns = append([]string{"language"}, columns...)
+	}
+	if withWorkspace {
+		columns = append([]string{"workspace"}, columns...)
+	}
+	t := table.New(columns...)
+	for _, entry := range entries {
+		// Where a package comes from says more than the
+		// version of a git commit or local directory.
+		version := entry.Version
+		if entry.Source != "" {
+			version = entry.Source
 		}
-	} else {
-		var results map[api.PkgName]api.PkgVersion = nil
-		fileExists := util.Exists(b.Lockfile)
-		if fileExists {
-			results = b.ListLockfile()
+		row := []string{entry.Name, entry.Spec, version, depType(entry), entry.Group, depRelation(entry)}
+		if config.Verbose {
+			row = append(row, entry.Reason)
 		}
-		switch outputFormat {
-		case outputFormatTable:
-			switch {
-			case !fileExists:
-				util.Log("no lockfile")
-				return
-			case len(results) == 0:
-				util.Log("no packages in lockfile")
-				return
-			}
-			t := table.New("name", "version")
-			for name, version := range results {
-				t.AddRow(string(name), string(version))
-			}
-			t.SortBy("name")
-			t.Print()
+		if withReleased {
+			row = append(row, releasedAgo(entry.Released, time.Now()))
+		}
+		if withLanguage {
+			row = append([]string{entry.Language}, row...)
+		}
+		if withWorkspace {
+			row = append([]string{entry.Workspace}, row...)
+		}
+		t.AddRow(row...)
+	}
+	t.Print()
+}
 
-		case outputFormatJSON:
-			j := []listLockfileJSONEntry{}
-			for name, version := range results {
-				j = append(j, listLockfileJSONEntry{
-					Name:    string(name),
-					Version: string(version),
-				})
+// runListChanged implements 'upm list --changed'.
+func runListChanged(ctx context.Context, b api.LanguageBackend, all bool, devOnly bool, prodOnly bool, outputFormat outputFormat) {
+	if !all {
+		if !util.Exists(b.Specfile) {
+			util.Log("no specfile")
+			return
+		}
+		results, previous := store.ListSpecfileWithCache(ctx, b)
+		store.Write(ctx)
+		if previous == nil {
+			util.Log(fmt.Sprintf("%s has not been listed before; showing every package as added", b.Specfile))
+		}
+		changes := diffSpecfile(filterDeps(previous, devOnly, prodOnly), filterDeps(results, devOnly, prodOnly))
+		printChanges(changes, b.Specfile, "since the last listing", outputFormat)
+		return
+	}
+
+	if !util.Exists(b.Lockfile) {
+		util.Log("no lockfile")
+		return
+	}
+	results, previous := store.ListLockfileWithCache(ctx, b)
+	store.Write(ctx)
+	if previous == nil {
+		util.Log(fmt.Sprintf("%s has not been listed before; showing every package as added", b.Lockfile))
+	}
+	printChanges(diffLockfile(previous, results), b.Lockfile, "since the last listing", outputFormat)
+}
+
+// runListSince implements 'upm list --since'.
+func runListSince(b api.LanguageBackend, all bool, devOnly bool, prodOnly bool, rev string, outputFormat outputFormat) {
+	if !isGitRevision(rev) {
+		util.DieConsistency("%s: not a git revision", rev)
+	}
+	if !all {
+		previous := readOldSpecfile(b, rev)
+		changes := diffSpecfile(filterDeps(previous, devOnly, prodOnly), filterDeps(specfileDeps(b), devOnly, prodOnly))
+		printChanges(changes, b.Specfile, "since "+rev, outputFormat)
+		return
+	}
+
+	previous, since := readOldLockfile(b, rev)
+	printChanges(diffLockfile(previous, lockedVersions(b)), b.Lockfile, since, outputFormat)
+}
+
+// listProject returns the entries of 'upm list' for b in the current
+// directory, and whether the specfile and lockfile exist.
+func listProject(ctx context.Context, b api.LanguageBackend, all bool, devOnly bool, prodOnly bool) ([]listEntry, bool, bool) {
+	var specs api.PkgDeps = nil
+	var locked map[api.PkgName]api.PkgVersion = nil
+	specExists := util.Exists(b.Specfile)
+	lockExists := util.Exists(b.Lockfile)
+	if specExists {
+		specs, _ = store.ListSpecfileWithCache(ctx, b)
+	}
+	if lockExists {
+		locked, _ = store.ListLockfileWithCache(ctx, b)
+	}
+	if specExists || lockExists {
+		store.Write(ctx)
+	}
+
+	// Transitive dependencies have no type, so they are left out
+	// when filtering by type.
+	entries := joinList(b, filterDeps(specs, devOnly, prodOnly), locked, all && !devOnly && !prodOnly)
+
+	if all && lockExists && b.ListLockfileHashes != nil {
+		hashes := map[api.PkgName][]string{}
+		for name, pkgHashes := range b.ListLockfileHashes() {
+			hashes[b.NormalizePackageName(name)] = pkgHashes
+		}
+		for i := range entries {
+			entries[i].Hashes = hashes[b.NormalizePackageName(api.PkgName(entries[i].Name))]
+		}
+	}
+	return entries, specExists, lockExists
+}
+
+// runListAggregated implements 'upm list' with --workspace,
+// --all-workspaces or --lang all, listing the packages of every
+// workspace member and language in one table, with workspace and
+// language columns. members is nil to list the current directory.
+func runListAggregated(language string, members []workspace.Member, all bool, devOnly bool, prodOnly bool, stale time.Duration, outputFormat outputFormat) {
+	span, ctx := trace.StartSpanFromExistingContext("runListAggregated")
+	defer span.Finish()
+	if devOnly && prodOnly {
+		util.DieUsage("--dev-only and --prod-only are mutually exclusive")
+	}
+
+	entries := []listEntry{}
+	collect := func(workspaceName string) {
+		for _, selected := range selectLanguages(language) {
+			b := backends.GetBackend(ctx, selected)
+			projectEntries, _, _ := listProject(ctx, b, all, devOnly, prodOnly)
+			if stale > 0 {
+				projectEntries = staleEntries(b, projectEntries, time.Now().Add(-stale))
 			}
-			outputB, err := json.Marshal(j)
-			if err != nil {
-				panic("couldn't marshal json")
+			for _, entry := range projectEntries {
+				entry.Workspace = workspaceName
+				if language == backends.AllLanguages {
+					entry.Language = b.Name
+				}
+				entries = append(entries, entry)
 			}
-			fmt.Println(string(outputB))
+		}
+	}
+	if members == nil {
+		collect("")
+	}
+	for _, member := range members {
+		inWorkspace(member, func() { collect(member.Name) })
+	}
 
-		default:
-			util.Panicf("unknown output format %d", outputFormat)
+	switch outputFormat {
+	case outputFormatTable:
+		if len(entries) == 0 {
+			util.Log("no packages found")
+			return
+		}
+		printListTable(entries)
+
+	case outputFormatJSON:
+		outputB, err := json.Marshal(entries)
+		if err != nil {
+			panic("couldn't marshal json")
 		}
+		fmt.Println(string(outputB))
+
+	default:
+		util.Panicf("unknown output format %d", outputFormat)
+	}
+}
+
+// runList implements 'upm list'. With stale, only the packages whose
+// locked versions were released longer ago than that are listed.
+func runList(language string, all bool, devOnly bool, prodOnly bool, changed bool, since string, installed bool, stale time.Duration, outputFormat outputFormat) {
+	span, ctx := trace.StartSpanFromExistingContext("runList")
+	defer span.Finish()
+	if devOnly && prodOnly {
+		util.DieUsage("--dev-only and --prod-only are mutually exclusive")
+	}
+	modes := 0
+	for _, set := range []bool{changed, since != "", installed, stale > 0} {
+		if set {
+			modes++
+		}
+	}
+	if modes > 1 {
+		util.DieUsage("--changed, --since, --installed and --stale are mutually exclusive")
+	}
+	b := backends.GetBackend(ctx, language)
+	if installed {
+		runListInstalled(b, all, devOnly, prodOnly, outputFormat)
+		return
+	}
+	if changed {
+		runListChanged(ctx, b, all, devOnly, prodOnly, outputFormat)
+		return
+	}
+	if since != "" {
+		runListSince(b, all, devOnly, prodOnly, since, outputFormat)
+		return
+	}
+
+	entries, specExists, lockExists := listProject(ctx, b, all, devOnly, prodOnly)
+	if stale > 0 {
+		entries = staleEntries(b, entries, time.Now().Add(-stale))
+	}
+
+	switch outputFormat {
+	case outputFormatTable:
+		switch {
+		case stale > 0 && len(entries) == 0 && (specExists || lockExists):
+			util.Log(fmt.Sprintf("no locked versions were released before %s", time.Now().Add(-stale).Format("2006-01-02")))
+			return
+		case !all && !specExists:
+			util.Log("no specfile")
+			return
+		case all && !specExists && !lockExists:
+			util.Log("no specfile or lockfile")
+			return
+		case len(entries) == 0 && !all:
+			util.Log("no packages in specfile")
+			return
+		case len(entries) == 0:
+			util.Log("no packages in specfile or lockfile")
+			return
+		}
+		printListTable(entries)
+
+	case outputFormatJSON:
+		outputB, err := json.Marshal(entries)
+		if err != nil {
+			panic("couldn't marshal json")
+		}
+		fmt.Println(string(outputB))
+
+	default:
+		util.Panicf("unknown output format %d", outputFormat)
 	}
 }
 
 // runGuess implements 'upm guess'.
 func runGuess(
 	language string, all bool,
-	forceGuess bool, ignoredPackages []string) {
+	forceGuess bool, ignoredPackages []string, includeCommands bool) {
 	span, ctx := trace.StartSpanFromExistingContext("runGuess")
 	defer span.Finish()
 	b := backends.GetBackend(ctx, language)
+	for _, line := range guessPackages(ctx, b, all, forceGuess, ignoredPackages, includeCommands) {
+		fmt.Println(line)
+	}
+}
+
+// guessPackages returns the sorted names of the packages that 'upm
+// guess' reports for b: those the project imports, and with
+// includeCommands those of the commands it runs, other than the
+// ignored ones and, unless all is set, those already in the specfile.
+func guessPackages(ctx context.Context, b api.LanguageBackend, all bool, forceGuess bool, ignoredPackages []string, includeCommands bool) []string {
+	if b.Guess == nil {
+		dieUnsupported(b, "guess")
+	}
 	guessed := store.GuessWithCache(ctx, b, forceGuess)
+	addGuessExtras(guessed)
+	if includeCommands {
+		addGuessedCommands(ctx, b, guessed)
+	}
 
 	// Map from normalized to original names.
 	normPkgs := map[string][]api.PkgName{}
@@ -615,17 +1651,22 @@ func runGuess(
 		}
 	}
 
+	if config.Loaded.Guess.ByDownloads {
+		rankGuesses(b, normPkgs)
+	}
+
+	seen := map[api.PkgName]bool{}
 	lines := []string{}
 	for _, pkgs := range normPkgs {
-		lines = append(lines, string(pkgs[0]))
+		if !seen[pkgs[0]] {
+			seen[pkgs[0]] = true
+			lines = append(lines, string(pkgs[0]))
+		}
 	}
 	sort.Strings(lines)
 
-	for _, line := range lines {
-		fmt.Println(line)
-	}
-
 	store.Write(ctx)
+	return lines
 }
 
 // runShowSpecfile implements 'upm show-specfile'.
@@ -0,0 +1,407 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/backends"
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/store"
+	"github.com/replit/upm/internal/util"
+	"github.com/replit/upm/pkg/upm/upmrpc"
+)
+
+// defaultDaemonSocket is where 'upm --daemon' listens unless --socket
+// says otherwise, relative to the project root.
+const defaultDaemonSocket = ".upm/daemon.sock"
+
+// daemonPollInterval is how often the daemon checks whether the
+// specfiles and lockfiles have changed.
+const daemonPollInterval = time.Second
+
+// The JSON-RPC 2.0 error codes used by the daemon. A UPM operation
+// that fails gives rpcUPMError, with the exit code that the upm binary
+// would have exited with in the error's data.
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcUPMError       = upmrpc.ErrorCode
+)
+
+// rpcRequest is a JSON-RPC 2.0 request. Requests are sent one per
+// line.
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// rpcError is the error of a JSON-RPC 2.0 response.
+type rpcError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func (e *rpcError) Error() string {
+	return e.Message
+}
+
+// rpcResponse is a JSON-RPC 2.0 response. Responses are sent one per
+// line, in the order of the requests.
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// daemonParams are the parameters of the daemon's methods. Each method
+// uses the ones that match the flags of its command.
+type daemonParams struct {
+	Language        string `json:"language"`
+	All             bool   `json:"all"`
+	Dev             bool   `json:"dev"`
+	Prod            bool   `json:"prod"`
+	Force           bool   `json:"force"`
+	IncludeCommands bool   `json:"includeCommands"`
+	Query           string `json:"query"`
+	Limit           int    `json:"limit"`
+	Sort            string `json:"sort"`
+	Exact           bool   `json:"exact"`
+	Package         string `json:"package"`
+}
+
+// fileState is what the daemon knows about a watched file.
+type fileState struct {
+	exists  bool
+	size    int64
+	modTime time.Time
+}
+
+// statFiles returns the state of each of paths.
+func statFiles(paths []string) map[string]fileState {
+	states := map[string]fileState{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			states[path] = fileState{}
+			continue
+		}
+		states[path] = fileState{exists: true, size: info.Size(), modTime: info.ModTime()}
+	}
+	return states
+}
+
+// listKey identifies a cached 'upm list' result.
+type listKey struct {
+	language       string
+	all, dev, prod bool
+}
+
+// daemon serves UPM operations on the project in the current
+// directory. The backends it has detected and the packages it has
+// listed are cached until one of the specfiles or lockfiles changes.
+type daemon struct {
+	// mu serializes the operations, which share UPM's global
+	// state.
+	mu sync.Mutex
+
+	backends map[string]api.LanguageBackend
+	lists    map[listKey][]listEntry
+
+	// watched are the specfiles and lockfiles of every backend,
+	// which decide both detection and listing.
+	watched []string
+	states  map[string]fileState
+
+	// done is closed by the shutdown method.
+	done     chan struct{}
+	shutdown sync.Once
+}
+
+// newDaemon returns a daemon for the project in the current directory.
+func newDaemon() *daemon {
+	seen := map[string]bool{}
+	watched := []string{}
+	for _, b := range backends.GetBackends("") {
+		for _, path := range []string{b.Specfile, b.Lockfile} {
+			if path != "" && !seen[path] {
+				seen[path] = true
+				watched = append(watched, path)
+			}
+		}
+	}
+	sort.Strings(watched)
+	d := &daemon{watched: watched, done: make(chan struct{})}
+	d.invalidate()
+	d.states = statFiles(watched)
+	return d
+}
+
+// invalidate forgets everything that was cached. The caller must hold
+// d.mu, or be the only user of d.
+func (d *daemon) invalidate() {
+	d.backends = map[string]api.LanguageBackend{}
+	d.lists = map[listKey][]listEntry{}
+	store.Reset()
+}
+
+// poll invalidates the caches if a watched file has been created,
+// modified or deleted since the last poll.
+func (d *daemon) poll() {
+	states := statFiles(d.watched)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for path, state := range states {
+		if d.states[path] != state {
+			util.Debugf("%s changed; invalidating the cache", path)
+			d.invalidate()
+			break
+		}
+	}
+	d.states = states
+}
+
+// backend returns the backend for a --lang value, detecting it only
+// the first time.
+func (d *daemon) backend(ctx context.Context, language string) api.LanguageBackend {
+	if b, ok := d.backends[language]; ok {
+		return b
+	}
+	b := backends.GetBackend(ctx, language)
+	d.backends[language] = b
+	return b
+}
+
+// decodeParams decodes the parameters of a request into params, which
+// keeps its zero value if there are none.
+func decodeParams(rawParams json.RawMessage, params interface{}) *rpcError {
+	if len(rawParams) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(rawParams, params); err != nil {
+		return &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+// call runs one method, turning a UPM failure into an rpcError. The
+// methods of the versioned protocol can send notifications about the
+// request with notify.
+func (d *daemon) call(id json.RawMessage, method string, rawParams json.RawMessage, notify func(method string, params interface{})) (interface{}, *rpcError) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	ctx := context.Background()
+	var result interface{}
+	var callErr *rpcError
+	err := util.Catch(func() {
+		if strings.HasPrefix(method, "v1.") {
+			result, callErr = d.callV1(ctx, id, method, rawParams, notify)
+		} else {
+			result, callErr = d.callUnversioned(ctx, method, rawParams)
+		}
+	})
+	var upmErr *util.Error
+	if errors.As(err, &upmErr) {
+		// The failed operation may have left the cache
+		// half-filled.
+		d.invalidate()
+		return nil, &rpcError{
+			Code:    rpcUPMError,
+			Message: upmErr.Msg,
+			Data:    upmrpc.ErrorData{ExitCode: int(upmErr.Code)},
+		}
+	}
+	return result, callErr
+}
+
+// callUnversioned runs one of the methods that came before the
+// versioned protocol of the upmrpc package, which are kept for the
+// clients that use them.
+func (d *daemon) callUnversioned(ctx context.Context, method string, rawParams json.RawMessage) (result interface{}, callErr *rpcError) {
+	var params daemonParams
+	if err := decodeParams(rawParams, &params); err != nil {
+		return nil, err
+	}
+	switch method {
+	case "which-language":
+		result = map[string]string{"language": d.backend(ctx, params.Language).Name}
+
+	case "list":
+		result = d.list(ctx, listKey{language: params.Language, all: params.All, dev: params.Dev, prod: params.Prod})
+
+	case "guess":
+		b := d.backend(ctx, params.Language)
+		result = guessPackages(ctx, b, params.All, params.Force, config.Loaded.Guess.Ignore, params.IncludeCommands)
+
+	case "search":
+		by, err := parseSearchSort(params.Sort)
+		if err != nil {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+		}
+		b := d.backend(ctx, params.Language)
+		result = searchPackages(b, params.Query, config.Loaded.Guess.Ignore, params.Limit, by, params.Exact)
+
+	case "info":
+		b := d.backend(ctx, params.Language)
+		if b.Info == nil {
+			dieUnsupported(b, "info")
+		}
+		info := b.Info(api.PkgName(params.Package))
+		if info.Name == "" {
+			util.DieConsistency("package not found: %s", params.Package)
+		}
+		result = info
+
+	case "shutdown":
+		d.shutdown.Do(func() { close(d.done) })
+
+	default:
+		callErr = &rpcError{Code: rpcMethodNotFound, Message: fmt.Sprintf("no such method: %s", method)}
+	}
+	return result, callErr
+}
+
+// list returns the entries of 'upm list', from the cache if the
+// project has not changed since they were listed.
+func (d *daemon) list(ctx context.Context, key listKey) []listEntry {
+	entries, ok := d.lists[key]
+	if !ok {
+		b := d.backend(ctx, key.language)
+		entries, _, _ = listProject(ctx, b, key.all, key.dev, key.prod)
+		d.lists[key] = entries
+	}
+	return entries
+}
+
+// rpcNotification is a JSON-RPC 2.0 notification from the daemon.
+type rpcNotification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+// handle answers one line of a connection, sending the notifications
+// about the request with send before returning the response.
+func (d *daemon) handle(line []byte, send func(msg interface{})) rpcResponse {
+	resp := rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null")}
+	var req rpcRequest
+	if err := json.Unmarshal(line, &req); err != nil {
+		resp.Error = &rpcError{Code: rpcParseError, Message: err.Error()}
+		return resp
+	}
+	if len(req.ID) > 0 {
+		resp.ID = req.ID
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		resp.Error = &rpcError{Code: rpcInvalidRequest, Message: `expected "jsonrpc": "2.0" and a method`}
+		return resp
+	}
+	notify := func(method string, params interface{}) {
+		send(rpcNotification{JSONRPC: "2.0", Method: method, Params: params})
+	}
+	resp.Result, resp.Error = d.call(resp.ID, req.Method, req.Params, notify)
+	if resp.Error == nil && resp.Result == nil {
+		resp.Result = json.RawMessage("null")
+	}
+	return resp
+}
+
+// serveConn answers the requests of one client until it disconnects.
+func (d *daemon) serveConn(conn net.Conn) {
+	defer conn.Close()
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	encoder := json.NewEncoder(conn)
+	// Notifications can come from the goroutines that copy the
+	// output of subprocesses.
+	var mu sync.Mutex
+	send := func(msg interface{}) error {
+		mu.Lock()
+		defer mu.Unlock()
+		return encoder.Encode(msg)
+	}
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		resp := d.handle(scanner.Bytes(), func(msg interface{}) { _ = send(msg) })
+		if err := send(resp); err != nil {
+			return
+		}
+	}
+}
+
+// listenDaemon listens on the Unix socket at path, replacing a socket
+// left behind by a daemon that is no longer running.
+func listenDaemon(path string) net.Listener {
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		util.DieLocked("another daemon is already listening on %s", path)
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		util.DieIO("%s: %s", path, err)
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		util.DieIO("%s: %s", path, err)
+	}
+	return listener
+}
+
+// runDaemon implements 'upm --daemon'.
+func runDaemon(socket string) {
+	if socket == "" {
+		socket = defaultDaemonSocket
+		if err := os.MkdirAll(".upm", 0o755); err != nil {
+			util.DieIO(".upm: %s", err)
+		}
+	}
+	listener := listenDaemon(socket)
+	removeSocket := func() { os.Remove(socket) }
+	defer removeSocket()
+	defer util.OnInterrupt(removeSocket)()
+
+	d := newDaemon()
+	go func() {
+		ticker := time.NewTicker(daemonPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				d.poll()
+			case <-d.done:
+				listener.Close()
+				return
+			}
+		}
+	}()
+
+	util.Log(fmt.Sprintf("listening on %s", socket))
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			select {
+			case <-d.done:
+				return
+			default:
+				util.DieIO("%s: %s", socket, err)
+			}
+		}
+		go d.serveConn(conn)
+	}
+}
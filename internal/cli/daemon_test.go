@@ -0,0 +1,185 @@
+//go:build unix
+
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/replit/upm/internal/backends"
+	"github.com/replit/upm/pkg/upm/upmrpc"
+)
+
+// discard drops the notifications of a request.
+func discard(msg interface{}) {}
+
+func TestDaemon(t *testing.T) {
+	backends.SetupAll()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	if err := os.WriteFile("package.json", []byte(`{"dependencies": {"express": "^4.18.2"}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	d := newDaemon()
+
+	list := func() []listEntry {
+		resp := d.handle([]byte(`{"jsonrpc": "2.0", "id": 1, "method": "list", "params": {"language": "nodejs-npm"}}`), discard)
+		if resp.Error != nil {
+			t.Fatalf("unexpected error %+v", resp.Error)
+		}
+		return resp.Result.([]listEntry)
+	}
+	if entries := list(); len(entries) != 1 || entries[0].Name != "express" {
+		t.Fatalf("unexpected entries %+v", entries)
+	}
+
+	// The listing is cached until the poll notices the change.
+	if err := os.WriteFile("package.json", []byte(`{"dependencies": {"express": "^4.18.2", "lodash": "^4.17.21"}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if entries := list(); len(entries) != 1 {
+		t.Fatalf("expected the cached entries, got %+v", entries)
+	}
+	d.poll()
+	if entries := list(); len(entries) != 2 || entries[1].Name != "lodash" {
+		t.Fatalf("expected the new entries, got %+v", entries)
+	}
+
+	resp := d.handle([]byte(`{"jsonrpc": "2.0", "id": 2, "method": "list", "params": {"language": "cobol"}}`), discard)
+	if resp.Error == nil || resp.Error.Code != rpcUPMError || resp.Error.Message != "no such language: cobol" {
+		t.Errorf("unexpected response %+v", resp)
+	}
+	resp = d.handle([]byte(`{"jsonrpc": "2.0", "id": 3, "method": "lock"}`), discard)
+	if resp.Error == nil || resp.Error.Code != rpcMethodNotFound {
+		t.Errorf("unexpected response %+v", resp)
+	}
+	resp = d.handle([]byte(`{"id": 4`), discard)
+	if resp.Error == nil || resp.Error.Code != rpcParseError {
+		t.Errorf("unexpected response %+v", resp)
+	}
+}
+
+func TestDaemonSocket(t *testing.T) {
+	backends.SetupAll()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	if err := os.WriteFile("package.json", []byte(`{}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	socket := filepath.Join(dir, "upm.sock")
+	stopped := make(chan struct{})
+	go func() {
+		runDaemon(socket)
+		close(stopped)
+	}()
+
+	var conn net.Conn
+	for i := 0; i < 50; i++ {
+		if conn, err = net.Dial("unix", socket); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(`{"jsonrpc": "2.0", "id": "a", "method": "which-language", "params": {"language": "nodejs-npm"}}` + "\n" +
+		`{"jsonrpc": "2.0", "id": "b", "method": "shutdown"}` + "\n")); err != nil {
+		t.Fatal(err)
+	}
+	reader := bufio.NewReader(conn)
+	var resp struct {
+		ID     string            `json:"id"`
+		Result map[string]string `json:"result"`
+	}
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(line, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.ID != "a" || resp.Result["language"] != "nodejs-npm" {
+		t.Errorf("unexpected response %s", line)
+	}
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the daemon did not shut down")
+	}
+	if _, err := os.Stat(socket); !os.IsNotExist(err) {
+		t.Errorf("expected the socket to be removed")
+	}
+}
+
+func TestDaemonV1(t *testing.T) {
+	backends.SetupAll()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	if err := os.WriteFile("package.json", []byte(`{"devDependencies": {"jest": "^29.0.0"}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	d := newDaemon()
+
+	resp := d.handle([]byte(`{"jsonrpc": "2.0", "id": 1, "method": "v1.Initialize"}`), discard)
+	initialize, ok := resp.Result.(upmrpc.InitializeResult)
+	if !ok || initialize.ProtocolVersion != upmrpc.ProtocolVersion || len(initialize.Methods) != len(v1Methods) {
+		t.Errorf("unexpected response %+v", resp)
+	}
+
+	resp = d.handle([]byte(`{"jsonrpc": "2.0", "id": 2, "method": "v1.ListPackages", "params": {"language": "nodejs-npm"}}`), discard)
+	expected := upmrpc.ListPackagesResult{
+		Language: "nodejs-npm",
+		Packages: []upmrpc.Package{{Name: "jest", Spec: "^29.0.0", Dev: true}},
+	}
+	if !reflect.DeepEqual(resp.Result, expected) {
+		t.Errorf("expected %+v, got %+v", expected, resp)
+	}
+
+	resp = d.handle([]byte(`{"jsonrpc": "2.0", "id": 3, "method": "v1.Add", "params": {"packages": {}}}`), discard)
+	if resp.Error == nil || resp.Error.Code != rpcInvalidParams {
+		t.Errorf("unexpected response %+v", resp)
+	}
+
+	resp = d.handle([]byte(`{"jsonrpc": "2.0", "id": 4, "method": "v1.Remove"}`), discard)
+	if resp.Error == nil || resp.Error.Code != rpcMethodNotFound {
+		t.Errorf("unexpected response %+v", resp)
+	}
+}
+
+func TestAddArgs(t *testing.T) {
+	expected := []string{"express ^4.18.2", "lodash"}
+	if got := addArgs(map[string]string{"lodash": "", "express": "^4.18.2"}); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
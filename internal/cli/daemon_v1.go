@@ -0,0 +1,129 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/util"
+	"github.com/replit/upm/pkg/upm/upmrpc"
+)
+
+// v1Methods are the methods of version 1 of the protocol, in the order
+// Initialize reports them.
+var v1Methods = []string{
+	upmrpc.MethodInitialize,
+	upmrpc.MethodListPackages,
+	upmrpc.MethodGuess,
+	upmrpc.MethodAdd,
+	upmrpc.MethodSearchStream,
+}
+
+// v1Packages converts the entries of 'upm list' into the packages of
+// the protocol.
+func v1Packages(entries []listEntry) []upmrpc.Package {
+	pkgs := []upmrpc.Package{}
+	for _, entry := range entries {
+		pkgs = append(pkgs, upmrpc.Package{
+			Name:       entry.Name,
+			Spec:       entry.Spec,
+			Version:    entry.Version,
+			Source:     entry.Source,
+			Dev:        entry.Dev,
+			Group:      entry.Group,
+			Reason:     entry.Reason,
+			Transitive: entry.Transitive,
+		})
+	}
+	return pkgs
+}
+
+// addArgs converts the packages of AddParams into the arguments of
+// 'upm add', sorted.
+func addArgs(pkgs map[string]string) []string {
+	args := []string{}
+	for name, spec := range pkgs {
+		if spec == "" {
+			args = append(args, name)
+		} else {
+			args = append(args, name+" "+spec)
+		}
+	}
+	sort.Strings(args)
+	return args
+}
+
+// callV1 runs one of the methods of the upmrpc package. UPM's progress
+// is sent as Progress notifications while it runs.
+func (d *daemon) callV1(ctx context.Context, id json.RawMessage, method string, rawParams json.RawMessage, notify func(method string, params interface{})) (interface{}, *rpcError) {
+	defer util.OnProgress(func(kind util.ProgressKind, msg string) {
+		notify(upmrpc.NotificationProgress, upmrpc.ProgressParams{RequestID: id, Kind: string(kind), Message: msg})
+	})()
+
+	switch method {
+	case upmrpc.MethodInitialize:
+		return upmrpc.InitializeResult{
+			ProtocolVersion: upmrpc.ProtocolVersion,
+			Version:         getVersion(),
+			Methods:         v1Methods,
+		}, nil
+
+	case upmrpc.MethodListPackages:
+		var params upmrpc.ListPackagesParams
+		if err := decodeParams(rawParams, &params); err != nil {
+			return nil, err
+		}
+		b := d.backend(ctx, params.Language)
+		entries := d.list(ctx, listKey{language: params.Language, all: params.All, dev: params.Dev, prod: params.Prod})
+		return upmrpc.ListPackagesResult{Language: b.Name, Packages: v1Packages(entries)}, nil
+
+	case upmrpc.MethodGuess:
+		var params upmrpc.GuessParams
+		if err := decodeParams(rawParams, &params); err != nil {
+			return nil, err
+		}
+		b := d.backend(ctx, params.Language)
+		pkgs := guessPackages(ctx, b, params.All, params.Force, config.Loaded.Guess.Ignore, params.IncludeCommands)
+		return upmrpc.GuessResult{Language: b.Name, Packages: pkgs}, nil
+
+	case upmrpc.MethodAdd:
+		var params upmrpc.AddParams
+		if err := decodeParams(rawParams, &params); err != nil {
+			return nil, err
+		}
+		if len(params.Packages) == 0 {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: "no packages to add"}
+		}
+		b := d.backend(ctx, params.Language)
+
+		dev, group, reason, force := config.Dev, config.Group, config.Reason, config.Force
+		config.Dev, config.Group, config.Reason, config.Force = params.Dev, params.Group, params.Reason, params.Force
+		defer func() {
+			config.Dev, config.Group, config.Reason, config.Force = dev, group, reason, force
+		}()
+		// The specfile and lockfile change, so everything cached
+		// about them goes, even if the add fails partway.
+		defer d.invalidate()
+		runAdd(b.Name, addArgs(params.Packages), false, false, false, config.Loaded.Guess.Ignore, false, false, "")
+		return upmrpc.AddResult{Language: b.Name}, nil
+
+	case upmrpc.MethodSearchStream:
+		var params upmrpc.SearchStreamParams
+		if err := decodeParams(rawParams, &params); err != nil {
+			return nil, err
+		}
+		by, err := parseSearchSort(params.Sort)
+		if err != nil {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+		}
+		b := d.backend(ctx, params.Language)
+		results := searchPackages(b, params.Query, config.Loaded.Guess.Ignore, params.Limit, by, params.Exact)
+		for _, result := range results {
+			notify(upmrpc.NotificationSearchResult, upmrpc.SearchResultParams{RequestID: id, Package: result})
+		}
+		return upmrpc.SearchStreamResult{Language: b.Name, Count: len(results)}, nil
+	}
+	return nil, &rpcError{Code: rpcMethodNotFound, Message: fmt.Sprintf("no such method: %s", method)}
+}
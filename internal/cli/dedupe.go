@@ -0,0 +1,140 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/backends"
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/store"
+	"github.com/replit/upm/internal/table"
+	"github.com/replit/upm/internal/trace"
+	"github.com/replit/upm/internal/util"
+	"github.com/replit/upm/internal/versions"
+)
+
+// duplicateEntry represents one package that is locked more than
+// once, in 'upm dedupe'. The JSON form is what --format json emits.
+type duplicateEntry struct {
+	Name string `json:"name"`
+
+	// The distinct versions, oldest first.
+	Versions []string `json:"versions"`
+
+	// The number of copies of the package, at any version.
+	Copies int `json:"copies"`
+}
+
+// findDuplicates returns the packages in copies, as returned by
+// ListLockfileCopies, that have more than one copy, those with the
+// most copies first.
+func findDuplicates(copies map[api.PkgName][]api.PkgVersion) []duplicateEntry {
+	entries := []duplicateEntry{}
+	for name, pkgVersions := range copies {
+		if len(pkgVersions) < 2 {
+			continue
+		}
+		seen := map[string]bool{}
+		distinct := []string{}
+		for _, version := range pkgVersions {
+			if !seen[string(version)] {
+				seen[string(version)] = true
+				distinct = append(distinct, string(version))
+			}
+		}
+		sort.Slice(distinct, func(i, j int) bool {
+			cmp, err := versions.Compare(distinct[i], distinct[j])
+			if err != nil {
+				return distinct[i] < distinct[j]
+			}
+			return cmp < 0
+		})
+		entries = append(entries, duplicateEntry{Name: string(name), Versions: distinct, Copies: len(pkgVersions)})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Copies != entries[j].Copies {
+			return entries[i].Copies > entries[j].Copies
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	return entries
+}
+
+// extraCopies returns the number of copies in entries beyond the first
+// of each package, which is what deduplication could save at best.
+func extraCopies(entries []duplicateEntry) int {
+	extra := 0
+	for _, entry := range entries {
+		extra += entry.Copies - 1
+	}
+	return extra
+}
+
+// runDedupe implements 'upm dedupe', which reports the packages that
+// the lockfile has several copies of, and unless check is set, runs
+// the package manager's deduplication and reports what it saved.
+func runDedupe(language string, check bool, outputFormat outputFormat) {
+	span, ctx := trace.StartSpanFromExistingContext("runDedupe")
+	defer span.Finish()
+	b := backends.GetBackend(ctx, language)
+	if b.ListLockfileCopies == nil || (!check && b.Dedupe == nil) {
+		dieUnsupported(b, "dedupe")
+	}
+	if !util.Exists(b.Lockfile) {
+		util.DieStaleLockfile("%s is missing; run 'upm lock' first", b.Lockfile)
+	}
+
+	s := silenceSubroutines()
+	before := findDuplicates(b.ListLockfileCopies())
+	s.restore()
+
+	if check {
+		switch outputFormat {
+		case outputFormatTable:
+			if len(before) == 0 {
+				util.Log(fmt.Sprintf("%s has one copy of every package", b.Lockfile))
+				return
+			}
+			t := table.New("name", "versions", "copies")
+			for _, entry := range before {
+				t.AddRow(entry.Name, strings.Join(entry.Versions, ", "), fmt.Sprint(entry.Copies))
+			}
+			t.Print()
+			util.Log(fmt.Sprintf("%d extra copies of %d packages", extraCopies(before), len(before)))
+
+		case outputFormatJSON:
+			outputB, err := json.Marshal(before)
+			if err != nil {
+				panic("couldn't marshal json")
+			}
+			fmt.Println(string(outputB))
+
+		default:
+			util.Panicf("unknown output format %d", outputFormat)
+		}
+		return
+	}
+
+	ensureTools(b)
+	defer lockProject()()
+	t := beginTransaction(b)
+	defer t.end()
+
+	b.Dedupe(ctx)
+	if config.DryRun {
+		return
+	}
+	applyPatches(b)
+
+	s = silenceSubroutines()
+	after := findDuplicates(b.ListLockfileCopies())
+	s.restore()
+	util.Log(fmt.Sprintf("%d extra copies before, %d after", extraCopies(before), extraCopies(after)))
+
+	store.Read(ctx, b)
+	store.UpdateFileHashes(ctx, b)
+	store.Write(ctx)
+}
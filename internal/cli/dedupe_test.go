@@ -0,0 +1,29 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+)
+
+func TestFindDuplicates(t *testing.T) {
+	copies := map[api.PkgName][]api.PkgVersion{
+		"left-pad": {"1.3.0"},
+		"ms":       {"2.1.3", "2.0.0", "2.1.3"},
+		"debug":    {"4.3.4", "2.6.9"},
+		"semver":   {"7.5.4", "6.3.1", "10.0.0", "7.5.4"},
+	}
+	expected := []duplicateEntry{
+		{Name: "semver", Versions: []string{"6.3.1", "7.5.4", "10.0.0"}, Copies: 4},
+		{Name: "ms", Versions: []string{"2.0.0", "2.1.3"}, Copies: 3},
+		{Name: "debug", Versions: []string{"2.6.9", "4.3.4"}, Copies: 2},
+	}
+	entries := findDuplicates(copies)
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected %+v, got %+v", expected, entries)
+	}
+	if extra := extraCopies(entries); extra != 6 {
+		t.Errorf("expected 6 extra copies, got %d", extra)
+	}
+}
@@ -0,0 +1,128 @@
+package cli
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/util"
+	"github.com/replit/upm/internal/versions"
+)
+
+// deprecationText describes a deprecation, as in "deprecated: use
+// String.prototype.padStart()" or "yanked".
+func deprecationText(d api.Deprecation) string {
+	text := "deprecated"
+	if d.Yanked {
+		text = "yanked"
+	}
+	if d.Reason != "" {
+		text += ": " + d.Reason
+	}
+	return text
+}
+
+// deprecationOf returns the deprecation of version among deprecated,
+// as ListDeprecated returns them, and whether there is one.
+func deprecationOf(deprecated map[api.PkgVersion]api.Deprecation, version api.PkgVersion) (api.Deprecation, bool) {
+	if d, ok := deprecated[version]; ok {
+		return d, true
+	}
+	// The lockfile may spell the version differently, as in "2.0"
+	// for "2.0.0".
+	for candidate, d := range deprecated {
+		if cmp, err := versions.Compare(string(candidate), string(version)); err == nil && cmp == 0 {
+			return d, true
+		}
+	}
+	return api.Deprecation{}, false
+}
+
+// lookupDeprecations returns the deprecations of the given versions of
+// packages, looking them up concurrently. Packages that cannot be
+// looked up are logged and left out.
+func lookupDeprecations(b api.LanguageBackend, pkgs map[api.PkgName]api.PkgVersion) map[api.PkgName]api.Deprecation {
+	found := map[api.PkgName]api.Deprecation{}
+	var mu sync.Mutex
+	sem := make(chan struct{}, infoConcurrency)
+	var wg sync.WaitGroup
+	for name, version := range pkgs {
+		wg.Add(1)
+		go func(name api.PkgName, version api.PkgVersion) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			err := util.Catch(func() {
+				if d, ok := deprecationOf(b.ListDeprecated(name), version); ok {
+					mu.Lock()
+					found[name] = d
+					mu.Unlock()
+				}
+			})
+			if err != nil {
+				util.LogError(fmt.Sprintf("cannot tell whether %s %s is deprecated: %s", name, version, err))
+			}
+		}(name, version)
+	}
+	wg.Wait()
+	return found
+}
+
+// warnDeprecated warns about the packages that 'upm add' added whose
+// locked versions are deprecated or yanked. It does nothing if b
+// cannot tell, or if the packages were not locked.
+func warnDeprecated(b api.LanguageBackend, names []api.PkgName) {
+	if b.ListDeprecated == nil || config.DryRun || len(names) == 0 {
+		return
+	}
+	locked := map[api.PkgName]api.PkgVersion{}
+	for name, version := range lockedVersions(b) {
+		locked[b.NormalizePackageName(name)] = version
+	}
+	pkgs := map[api.PkgName]api.PkgVersion{}
+	for _, name := range names {
+		if version, ok := locked[b.NormalizePackageName(name)]; ok {
+			pkgs[name] = version
+		}
+	}
+	deprecations := lookupDeprecations(b, pkgs)
+	sorted := []api.PkgName{}
+	for name := range deprecations {
+		sorted = append(sorted, name)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	for _, name := range sorted {
+		util.LogError(fmt.Sprintf("%s %s is %s", name, pkgs[name], deprecationText(deprecations[name])))
+	}
+}
+
+// checkDeprecations implements 'upm check --deprecations', reporting
+// every locked package whose version is deprecated or yanked.
+func checkDeprecations(b api.LanguageBackend) []checkIssue {
+	if b.ListDeprecated == nil {
+		dieUnsupported(b, "deprecations")
+	}
+	locked := lockedVersions(b)
+	issues := []checkIssue{}
+	for name, d := range lookupDeprecations(b, locked) {
+		kind := checkDeprecated
+		if d.Yanked {
+			kind = checkYanked
+		}
+		issues = append(issues, checkIssue{
+			Kind:    kind,
+			Name:    string(name),
+			Version: string(locked[name]),
+			Detail:  d.Reason,
+		})
+	}
+	sort.Slice(issues, func(i, j int) bool {
+		if issues[i].Kind != issues[j].Kind {
+			return issues[i].Kind < issues[j].Kind
+		}
+		return issues[i].Name < issues[j].Name
+	})
+	return issues
+}
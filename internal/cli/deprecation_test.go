@@ -0,0 +1,64 @@
+package cli
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+)
+
+func TestDeprecationText(t *testing.T) {
+	for expected, d := range map[string]api.Deprecation{
+		"deprecated":                 {},
+		"deprecated: use padStart()": {Reason: "use padStart()"},
+		"yanked":                     {Yanked: true},
+		"yanked: broken wheel":       {Yanked: true, Reason: "broken wheel"},
+	} {
+		if actual := deprecationText(d); actual != expected {
+			t.Errorf("%+v: expected %q, got %q", d, expected, actual)
+		}
+	}
+}
+
+func TestCheckDeprecations(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	if err := os.WriteFile("lock", nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	b := api.LanguageBackend{
+		Name:     "test",
+		Lockfile: "lock",
+		ListLockfile: func() map[api.PkgName]api.PkgVersion {
+			return map[api.PkgName]api.PkgVersion{
+				"left-pad": "1.3.0",
+				"urllib3":  "2.0",
+				"flask":    "3.0.2",
+				"gone":     "1.0.0",
+			}
+		},
+		ListDeprecated: func(name api.PkgName) map[api.PkgVersion]api.Deprecation {
+			return map[api.PkgName]map[api.PkgVersion]api.Deprecation{
+				"left-pad": {"1.3.0": {Reason: "use String.prototype.padStart()"}},
+				"urllib3":  {"2.0.0": {Yanked: true, Reason: "broken wheel"}, "1.0.0": {Yanked: true}},
+				"flask":    {"0.1": {Yanked: true}},
+			}[name]
+		},
+	}
+
+	expected := []checkIssue{
+		{Kind: checkDeprecated, Name: "left-pad", Version: "1.3.0", Detail: "use String.prototype.padStart()"},
+		{Kind: checkYanked, Name: "urllib3", Version: "2.0", Detail: "broken wheel"},
+	}
+	if issues := checkDeprecations(b); !reflect.DeepEqual(issues, expected) {
+		t.Errorf("expected %+v, got %+v", expected, issues)
+	}
+}
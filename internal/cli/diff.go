@@ -0,0 +1,136 @@
+package cli
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/backends"
+	"github.com/replit/upm/internal/util"
+)
+
+// isGitRevision reports whether rev names a commit of the git
+// repository that the current directory belongs to.
+func isGitRevision(rev string) bool {
+	cmd := exec.Command("git", "rev-parse", "--verify", "--quiet", rev+"^{commit}")
+	return cmd.Run() == nil
+}
+
+// gitShow returns the contents of path, relative to the current
+// directory, at the git revision rev, or nil if rev has no such file.
+// rev must be a valid revision; see isGitRevision.
+func gitShow(rev string, path string) []byte {
+	cmd := exec.Command("git", "show", rev+":./"+filepath.ToSlash(path))
+	cmd.Stderr = io.Discard
+	output, err := cmd.Output()
+	if err != nil {
+		return nil
+	}
+	return output
+}
+
+// lockedVersions returns the versions in the lockfile of b in the
+// current directory, or an empty map if there is no lockfile.
+func lockedVersions(b api.LanguageBackend) map[api.PkgName]api.PkgVersion {
+	if !util.Exists(b.Lockfile) {
+		return map[api.PkgName]api.PkgVersion{}
+	}
+	s := silenceSubroutines()
+	defer s.restore()
+	return b.ListLockfile()
+}
+
+// inSnapshot runs fn in a temporary directory holding a specfile and
+// lockfile of b with the given contents, each left out if nil. The
+// backends only read the files of the current directory, so this is
+// how they are made to read older versions of them.
+func inSnapshot(b api.LanguageBackend, specfile []byte, lockfile []byte, fn func()) {
+	tempdir := util.TempDir()
+	defer os.RemoveAll(tempdir)
+
+	write := func(name string, contents []byte) {
+		if contents == nil {
+			return
+		}
+		path := filepath.Join(tempdir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			util.DieIO("%s", err)
+		}
+		if err := os.WriteFile(path, contents, 0o644); err != nil {
+			util.DieIO("%s", err)
+		}
+	}
+	write(b.Specfile, specfile)
+	// The lockfile goes last, for backends whose lockfile is
+	// their specfile.
+	write(b.Lockfile, lockfile)
+
+	inDir(tempdir, fn)
+}
+
+// specfileDeps returns the packages in the specfile of b in the
+// current directory, or an empty map if there is no specfile.
+func specfileDeps(b api.LanguageBackend) api.PkgDeps {
+	if !util.Exists(b.Specfile) {
+		return api.PkgDeps{}
+	}
+	s := silenceSubroutines()
+	defer s.restore()
+	return b.ListSpecfile(true)
+}
+
+// readOldLockfile returns the versions in the lockfile of b as of old,
+// which is the path of a lockfile if such a file exists and a git
+// revision otherwise, along with a description of old for messages.
+// A lockfile on disk is read next to the current specfile; at a git
+// revision, next to the specfile of that revision.
+func readOldLockfile(b api.LanguageBackend, old string) (map[api.PkgName]api.PkgVersion, string) {
+	var specfile, lockfile []byte
+	since := "since " + old
+	if info, err := os.Stat(old); err == nil && !info.IsDir() {
+		if lockfile, err = os.ReadFile(old); err != nil {
+			util.DieIO("%s", err)
+		}
+		if util.Exists(b.Specfile) {
+			if specfile, err = os.ReadFile(b.Specfile); err != nil {
+				util.DieIO("%s", err)
+			}
+		}
+		since = "compared with " + old
+	} else if isGitRevision(old) {
+		specfile = gitShow(old, b.Specfile)
+		lockfile = gitShow(old, b.Lockfile)
+	} else {
+		util.DieConsistency("%s is neither a file nor a git revision", old)
+	}
+
+	var locked map[api.PkgName]api.PkgVersion
+	inSnapshot(b, specfile, lockfile, func() {
+		locked = lockedVersions(b)
+	})
+	return locked, since
+}
+
+// readOldSpecfile returns the packages in the specfile of b at the git
+// revision rev, which must be valid.
+func readOldSpecfile(b api.LanguageBackend, rev string) api.PkgDeps {
+	var deps api.PkgDeps
+	inSnapshot(b, gitShow(rev, b.Specfile), nil, func() {
+		deps = specfileDeps(b)
+	})
+	return deps
+}
+
+// runDiff implements 'upm diff'.
+func runDiff(language string, old string, outputFormat outputFormat) {
+	b := backends.GetBackend(context.Background(), language)
+	if b.QuirksIsNotReproducible() {
+		util.DieUnimplemented("%s has no lockfile to compare", b.Name)
+	}
+	previous, since := readOldLockfile(b, old)
+	changes := diffLockfile(previous, lockedVersions(b))
+	printChanges(changes, b.Lockfile, since, outputFormat)
+}
@@ -0,0 +1,260 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/backends"
+	"github.com/replit/upm/internal/table"
+	"github.com/replit/upm/internal/util"
+	"github.com/replit/upm/internal/versions"
+)
+
+// Values for doctorCheck.Status.
+const (
+	doctorOK   = "ok"
+	doctorWarn = "warning"
+	doctorFail = "error"
+)
+
+// doctorCheck is the result of one check made by 'upm doctor'. The
+// JSON form is the machine-readable report.
+type doctorCheck struct {
+	Backend string `json:"backend" pretty:"Backend"`
+	Check   string `json:"check" pretty:"Check"`
+	Status  string `json:"status" pretty:"Status"`
+	Detail  string `json:"detail,omitempty" pretty:"Detail"`
+	Fix     string `json:"fix,omitempty" pretty:"Fix"`
+}
+
+// minimumToolVersions are the oldest versions of the external tools
+// that UPM works with, mostly because older ones write lockfiles in a
+// format it does not read or lack flags it passes.
+var minimumToolVersions = map[string]string{
+	// Dependency groups.
+	"poetry":  "1.2.0",
+	"python3": "3.8",
+	// 'pip list --format json' and the new resolver.
+	"pip": "20.3",
+	// The stable uv.lock format.
+	"uv": "0.4.0",
+	// package-lock.json version 2.
+	"npm":  "7.0.0",
+	"node": "16.0.0",
+	"yarn": "1.22.0",
+	// pnpm-lock.yaml version 6.
+	"pnpm":  "8.0.0",
+	"bun":   "1.0.0",
+	"emacs": "26.1",
+	"cask":  "0.8.0",
+}
+
+// toolInstallHints tell how to install each external tool.
+var toolInstallHints = map[string]string{
+	"python3": "install Python 3 from https://www.python.org/downloads/ or your system's package manager",
+	"poetry":  "run 'pipx install poetry'",
+	"pip":     "run 'python3 -m ensurepip --upgrade'",
+	"uv":      "run 'pipx install uv'",
+	"node":    "install Node.js from https://nodejs.org/",
+	"npm":     "install Node.js from https://nodejs.org/, which includes npm",
+	"yarn":    "run 'corepack enable yarn' or 'npm install -g yarn'",
+	"pnpm":    "run 'corepack enable pnpm' or 'npm install -g pnpm'",
+	"bun":     "run 'npm install -g bun'",
+	"emacs":   "install Emacs from https://www.gnu.org/software/emacs/",
+	"cask":    "see https://github.com/cask/cask#installation",
+}
+
+// toolInstallHint returns how to install tool.
+func toolInstallHint(tool string) string {
+	if hint, ok := toolInstallHints[tool]; ok {
+		return hint
+	}
+	return fmt.Sprintf("install %s and make sure it is on PATH", tool)
+}
+
+// versionNumber finds the version number in the output of --version,
+// as in "1.8.3" in "Poetry (version 1.8.3)".
+var versionNumber = regexp.MustCompile(`\d+(?:\.\d+)+`)
+
+// checkTool checks that an external tool is on PATH and recent
+// enough.
+func checkTool(tool toolVersion) doctorCheck {
+	check := doctorCheck{Check: "tool " + tool.Name, Status: doctorOK, Detail: tool.Version}
+	if tool.Path == "" {
+		check.Status = doctorFail
+		check.Detail = "not found on PATH"
+		check.Fix = toolInstallHint(tool.Name)
+		return check
+	}
+	minimum, ok := minimumToolVersions[tool.Name]
+	if !ok {
+		return check
+	}
+	found := versionNumber.FindString(tool.Version)
+	cmp, err := versions.Compare(found, minimum)
+	if found == "" || err != nil {
+		check.Status = doctorWarn
+		check.Detail = fmt.Sprintf("cannot tell the version from %q; %s or later is needed", tool.Version, minimum)
+		return check
+	}
+	if cmp < 0 {
+		check.Status = doctorFail
+		check.Detail = fmt.Sprintf("version %s is older than %s", found, minimum)
+		check.Fix = fmt.Sprintf("upgrade %s to %s or later", tool.Name, minimum)
+	}
+	return check
+}
+
+// checkWritable checks that path, which exists, can be written to
+// without modifying it.
+func checkWritable(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// checkDirWritable checks that files can be created in dir.
+func checkDirWritable(dir string) error {
+	f, err := os.CreateTemp(dir, ".upm-doctor-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// checkFile checks that the specfile or lockfile at path can be
+// written to and parsed with parse, if parse is not nil. kind is
+// "specfile" or "lockfile"; missing and unparseable are the fixes to
+// suggest if it does not exist or does not parse.
+func checkFile(kind string, path string, parse func(), missing string, unparseable string) []doctorCheck {
+	if !util.Exists(path) {
+		return []doctorCheck{{
+			Check:  kind,
+			Status: doctorWarn,
+			Detail: fmt.Sprintf("%s does not exist", path),
+			Fix:    missing,
+		}}
+	}
+
+	checks := []doctorCheck{}
+	writable := doctorCheck{Check: kind + " writable", Status: doctorOK, Detail: path}
+	if err := checkWritable(path); err != nil {
+		writable.Status = doctorFail
+		writable.Detail = err.Error()
+		writable.Fix = fmt.Sprintf("check the permissions and owner of %s", path)
+	}
+	checks = append(checks, writable)
+
+	if parse == nil {
+		return checks
+	}
+	parsed := doctorCheck{Check: kind + " parses", Status: doctorOK, Detail: path}
+	s := silenceSubroutines()
+	if err := util.Catch(parse); err != nil {
+		parsed.Status = doctorFail
+		parsed.Detail = err.Error()
+		parsed.Fix = unparseable
+	}
+	s.restore()
+	return append(checks, parsed)
+}
+
+// diagnose runs the checks of 'upm doctor' for b in the current
+// directory.
+func diagnose(b api.LanguageBackend) []doctorCheck {
+	checks := []doctorCheck{}
+	for _, tool := range b.Tools {
+		checks = append(checks, checkTool(detectTool(tool)))
+	}
+
+	dir := doctorCheck{Check: "project directory writable", Status: doctorOK}
+	if wd, err := os.Getwd(); err == nil {
+		dir.Detail = wd
+	}
+	if err := checkDirWritable("."); err != nil {
+		dir.Status = doctorFail
+		dir.Detail = err.Error()
+		dir.Fix = "UPM writes the lockfile and its cache in .upm here; check the permissions of the directory"
+	}
+	checks = append(checks, dir)
+
+	checks = append(checks, checkFile(
+		"specfile", b.Specfile,
+		func() { b.ListSpecfile(true) },
+		"run 'upm add' to create it",
+		fmt.Sprintf("fix the syntax error in %s", b.Specfile),
+	)...)
+	if b.QuirksIsReproducible() {
+		var parse func()
+		if b.ListLockfile != nil {
+			parse = func() { b.ListLockfile() }
+		}
+		checks = append(checks, checkFile(
+			"lockfile", b.Lockfile,
+			parse,
+			"run 'upm lock' to create it",
+			"run 'upm lock --repair' to regenerate it",
+		)...)
+	}
+
+	for i := range checks {
+		checks[i].Backend = b.Name
+	}
+	return checks
+}
+
+// runDoctor implements 'upm doctor'.
+func runDoctor(language string, outputFormat outputFormat) {
+	checks := []doctorCheck{}
+	forEachLanguage(language, func(language string) {
+		var b api.LanguageBackend
+		err := util.Catch(func() {
+			b = backends.GetBackend(context.Background(), language)
+		})
+		if err != nil {
+			checks = append(checks, doctorCheck{
+				Backend: language,
+				Check:   "language detection",
+				Status:  doctorFail,
+				Detail:  err.Error(),
+				Fix:     "choose a language with --lang; see 'upm list-languages'",
+			})
+			return
+		}
+		checks = append(checks, diagnose(b)...)
+	})
+
+	failed := 0
+	for _, check := range checks {
+		if check.Status == doctorFail {
+			failed++
+		}
+	}
+
+	switch outputFormat {
+	case outputFormatTable:
+		t := table.FromStructs(checks)
+		t.Print()
+
+	case outputFormatJSON:
+		outputB, err := json.Marshal(checks)
+		if err != nil {
+			panic("couldn't marshal json")
+		}
+		fmt.Println(string(outputB))
+
+	default:
+		util.Panicf("unknown output format %d", outputFormat)
+	}
+
+	if failed > 0 {
+		util.DieInitializationError("%d of %d checks failed", failed, len(checks))
+	}
+}
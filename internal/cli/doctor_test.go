@@ -0,0 +1,52 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCheckTool(t *testing.T) {
+	for _, test := range []struct {
+		tool     toolVersion
+		expected doctorCheck
+	}{
+		{
+			tool:     toolVersion{Name: "poetry", Path: "/usr/bin/poetry", Version: "Poetry (version 1.8.3)"},
+			expected: doctorCheck{Check: "tool poetry", Status: doctorOK, Detail: "Poetry (version 1.8.3)"},
+		},
+		{
+			tool: toolVersion{Name: "pnpm", Path: "/usr/bin/pnpm", Version: "7.33.0"},
+			expected: doctorCheck{
+				Check:  "tool pnpm",
+				Status: doctorFail,
+				Detail: "version 7.33.0 is older than 8.0.0",
+				Fix:    "upgrade pnpm to 8.0.0 or later",
+			},
+		},
+		{
+			tool: toolVersion{Name: "yarn"},
+			expected: doctorCheck{
+				Check:  "tool yarn",
+				Status: doctorFail,
+				Detail: "not found on PATH",
+				Fix:    "run 'corepack enable yarn' or 'npm install -g yarn'",
+			},
+		},
+		{
+			tool: toolVersion{Name: "emacs", Path: "/usr/bin/emacs", Version: "unknown"},
+			expected: doctorCheck{
+				Check:  "tool emacs",
+				Status: doctorWarn,
+				Detail: `cannot tell the version from "unknown"; 26.1 or later is needed`,
+			},
+		},
+		{
+			tool:     toolVersion{Name: "mvn", Path: "/usr/bin/mvn", Version: "Apache Maven 3.9.6"},
+			expected: doctorCheck{Check: "tool mvn", Status: doctorOK, Detail: "Apache Maven 3.9.6"},
+		},
+	} {
+		if check := checkTool(test.tool); !reflect.DeepEqual(check, test.expected) {
+			t.Errorf("checkTool(%+v) = %+v, expected %+v", test.tool, check, test.expected)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/backends"
+	"github.com/replit/upm/internal/util"
+)
+
+// envEntry describes the environment of a backend for 'upm env'. The
+// JSON form is what --format json emits.
+type envEntry struct {
+	Language string   `json:"language"`
+	Path     string   `json:"path"`
+	Exists   bool     `json:"exists"`
+	Bin      []string `json:"bin,omitempty"`
+}
+
+// applyInProject makes the package managers that support it keep their
+// environment in the project directory, as .venv. uv does so already
+// unless UV_PROJECT_ENVIRONMENT moves it elsewhere.
+func applyInProject() {
+	if err := os.Setenv("POETRY_VIRTUALENVS_IN_PROJECT", "true"); err != nil {
+		util.DieInitializationError("%s", err)
+	}
+	if err := os.Unsetenv("UV_PROJECT_ENVIRONMENT"); err != nil {
+		util.DieInitializationError("%s", err)
+	}
+}
+
+// environmentDir returns the absolute path of the directory packages
+// of b are installed in, or "" if b has none.
+func environmentDir(b api.LanguageBackend) string {
+	s := silenceSubroutines()
+	dir := strings.TrimSpace(b.GetPackageDir())
+	s.restore()
+	if dir == "" {
+		return ""
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		util.DieIO("%s", err)
+	}
+	return abs
+}
+
+// binDirs returns the directories of executables in the environment
+// dir that exist: node_modules/.bin, and bin or Scripts for a Python
+// virtualenv or vendor/bin for Composer.
+func binDirs(dir string) []string {
+	bins := []string{}
+	for _, name := range []string{".bin", "bin", "Scripts"} {
+		bin := filepath.Join(dir, name)
+		if info, err := os.Stat(bin); err == nil && info.IsDir() {
+			bins = append(bins, bin)
+		}
+	}
+	return bins
+}
+
+// activationEnv returns the environment variables that activate the
+// environment dir: PATH, based on path, with its executables first,
+// and VIRTUAL_ENV if it is a Python virtualenv.
+func activationEnv(dir, path string) map[string]string {
+	env := map[string]string{}
+	if bins := binDirs(dir); len(bins) > 0 {
+		if path != "" {
+			bins = append(bins, path)
+		}
+		env["PATH"] = strings.Join(bins, string(os.PathListSeparator))
+	}
+	if util.Exists(filepath.Join(dir, "pyvenv.cfg")) {
+		env["VIRTUAL_ENV"] = dir
+	}
+	return env
+}
+
+// runEnv implements 'upm env'.
+func runEnv(language string, outputFormat outputFormat) {
+	b := backends.GetBackend(context.Background(), language)
+	dir := environmentDir(b)
+	if dir == "" {
+		util.DieUnimplemented("%s does not install packages into an environment", b.Name)
+	}
+
+	switch outputFormat {
+	case outputFormatTable:
+		fmt.Println(dir)
+
+	case outputFormatJSON:
+		entry := envEntry{Language: b.Name, Path: dir, Exists: util.Exists(dir), Bin: binDirs(dir)}
+		outputB, err := json.Marshal(entry)
+		if err != nil {
+			panic("couldn't marshal json")
+		}
+		fmt.Println(string(outputB))
+
+	default:
+		util.Panicf("unknown output format %d", outputFormat)
+	}
+}
+
+// runExec implements 'upm exec'.
+func runExec(language string, args []string) {
+	b := backends.GetBackend(context.Background(), language)
+	dir := environmentDir(b)
+	if dir == "" {
+		util.DieUnimplemented("%s does not install packages into an environment", b.Name)
+	}
+	if !util.Exists(dir) {
+		util.DieInitializationError("%s does not exist; run 'upm install' first", dir)
+	}
+
+	// The environment is set on UPM itself, rather than only on
+	// the command, so that the command is looked up on the new
+	// PATH.
+	for name, value := range activationEnv(dir, os.Getenv("PATH")) {
+		if err := os.Setenv(name, value); err != nil {
+			util.DieInitializationError("%s", err)
+		}
+	}
+
+	if code := util.RunAttached(args); code != 0 {
+		util.Exit(code)
+	}
+}
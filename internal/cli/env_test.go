@@ -0,0 +1,38 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestActivationEnv(t *testing.T) {
+	venv := t.TempDir()
+	if err := os.Mkdir(filepath.Join(venv, "bin"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(venv, "pyvenv.cfg"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"PATH":        filepath.Join(venv, "bin") + string(os.PathListSeparator) + "/usr/bin",
+		"VIRTUAL_ENV": venv,
+	}
+	if got := activationEnv(venv, "/usr/bin"); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	nodeModules := t.TempDir()
+	if err := os.Mkdir(filepath.Join(nodeModules, ".bin"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	expected = map[string]string{"PATH": filepath.Join(nodeModules, ".bin")}
+	if got := activationEnv(nodeModules, ""); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	if got := activationEnv(t.TempDir(), "/usr/bin"); len(got) != 0 {
+		t.Errorf("expected an empty directory to change nothing, got %v", got)
+	}
+}
@@ -0,0 +1,384 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kballard/go-shellquote"
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/backends"
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/trace"
+	"github.com/replit/upm/internal/util"
+)
+
+// exportFormats maps the values of 'upm export --format' to the
+// language whose lockfiles can be exported in that format, or to ""
+// for formats that apply to every language.
+var exportFormats = map[string]string{
+	"requirements.txt": "python3",
+	"constraints":      "python3",
+	"npm-shrinkwrap":   "nodejs",
+	"dockerfile":       "",
+	"nix":              "",
+}
+
+// sortedLocked returns the names of the locked packages, sorted.
+func sortedLocked(locked map[api.PkgName]api.PkgVersion) []api.PkgName {
+	names := []api.PkgName{}
+	for name := range locked {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// exportRequirements writes the locked packages as a pip requirements
+// file that pins each of them, with its hashes if hashes is not nil,
+// or as a constraints file, which cannot have hashes.
+func exportRequirements(lockfile string, locked map[api.PkgName]api.PkgVersion, hashes map[api.PkgName][]string) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# Generated by 'upm export' from %s.\n", lockfile)
+	for _, name := range sortedLocked(locked) {
+		fmt.Fprintf(&sb, "%s==%s", name, locked[name])
+		for _, hash := range hashes[name] {
+			fmt.Fprintf(&sb, " \\\n    --hash=%s", hash)
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// shrinkwrapPackage is an entry of the packages of an
+// npm-shrinkwrap.json.
+type shrinkwrapPackage struct {
+	Name                 string            `json:"name,omitempty"`
+	Version              string            `json:"version,omitempty"`
+	Integrity            string            `json:"integrity,omitempty"`
+	Dependencies         map[string]string `json:"dependencies,omitempty"`
+	DevDependencies      map[string]string `json:"devDependencies,omitempty"`
+	OptionalDependencies map[string]string `json:"optionalDependencies,omitempty"`
+	PeerDependencies     map[string]string `json:"peerDependencies,omitempty"`
+}
+
+// shrinkwrap is an npm-shrinkwrap.json, which has the format of
+// package-lock.json version 3.
+type shrinkwrap struct {
+	Name            string                       `json:"name,omitempty"`
+	Version         string                       `json:"version,omitempty"`
+	LockfileVersion int                          `json:"lockfileVersion"`
+	Requires        bool                         `json:"requires"`
+	Packages        map[string]shrinkwrapPackage `json:"packages"`
+}
+
+// exportShrinkwrap writes the locked packages as an
+// npm-shrinkwrap.json, with the project's own dependencies, from
+// specs, as its root package. Each package is locked at one version
+// directly under node_modules, since the lockfile hooks do not say
+// where nested copies go; integrity hashes are kept when they are in
+// npm's format.
+func exportShrinkwrap(name, version string, specs api.PkgDeps, locked map[api.PkgName]api.PkgVersion, hashes map[api.PkgName][]string) ([]byte, error) {
+	root := shrinkwrapPackage{Name: name, Version: version}
+	for depName, dep := range specs {
+		var section *map[string]string
+		switch {
+		case dep.Dev:
+			section = &root.DevDependencies
+		case dep.Group == "optional":
+			section = &root.OptionalDependencies
+		case dep.Group == "peer":
+			section = &root.PeerDependencies
+		default:
+			section = &root.Dependencies
+		}
+		if *section == nil {
+			*section = map[string]string{}
+		}
+		spec := string(dep.Spec)
+		if spec == "" {
+			spec = "*"
+		}
+		(*section)[string(depName)] = spec
+	}
+
+	sw := shrinkwrap{
+		Name:            name,
+		Version:         version,
+		LockfileVersion: 3,
+		Requires:        true,
+		Packages:        map[string]shrinkwrapPackage{"": root},
+	}
+	for _, pkgName := range sortedLocked(locked) {
+		pkg := shrinkwrapPackage{Version: string(locked[pkgName])}
+		for _, hash := range hashes[pkgName] {
+			if strings.HasPrefix(hash, "sha") && strings.Contains(hash, "-") {
+				pkg.Integrity = hash
+				break
+			}
+		}
+		sw.Packages["node_modules/"+string(pkgName)] = pkg
+	}
+
+	outputB, err := json.MarshalIndent(sw, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(outputB, '\n'), nil
+}
+
+// runExport implements 'upm export'. Without a format, Python
+// projects are exported as requirements.txt, Node.js projects as
+// npm-shrinkwrap.json and others as a Dockerfile stanza.
+func runExport(language string, format string, withHashes bool, output string) {
+	span, ctx := trace.StartSpanFromExistingContext("runExport")
+	defer span.Finish()
+	b := backends.GetBackend(ctx, language)
+	backendLanguage, _, _ := strings.Cut(b.Name, "-")
+	if format == "" {
+		for name, formatLanguage := range exportFormats {
+			if formatLanguage == backendLanguage && name != "constraints" {
+				format = name
+			}
+		}
+		if format == "" {
+			format = "dockerfile"
+		}
+	}
+
+	exportLanguage, ok := exportFormats[format]
+	if !ok {
+		formats := []string{}
+		for name := range exportFormats {
+			formats = append(formats, name)
+		}
+		sort.Strings(formats)
+		util.DieUsage("invalid export format %q (must be one of %s)", format, strings.Join(formats, ", "))
+	}
+	if withHashes && format != "requirements.txt" {
+		util.DieUsage("--hashes only applies to --format requirements.txt")
+	}
+	if exportLanguage != "" && backendLanguage != exportLanguage {
+		util.DieConsistency("%s cannot be exported as %s", b.Name, format)
+	}
+	if format == "dockerfile" {
+		if !util.Exists(b.Specfile) {
+			util.DieInitializationError("%s not found", b.Specfile)
+		}
+	} else if b.ListLockfile == nil {
+		dieUnsupported(b, "list-lockfile")
+	}
+	if b.QuirksIsReproducible() && !util.Exists(b.Lockfile) {
+		util.DieInitializationError("%s not found; run 'upm lock' first", b.Lockfile)
+	}
+
+	var contents []byte
+	switch format {
+	case "requirements.txt", "constraints":
+		s := silenceSubroutines()
+		locked := b.ListLockfile()
+		var hashes map[api.PkgName][]string
+		if withHashes && b.ListLockfileHashes != nil {
+			hashes = b.ListLockfileHashes()
+		}
+		s.restore()
+		contents = []byte(exportRequirements(b.Lockfile, locked, hashes))
+
+	case "npm-shrinkwrap":
+		if b.Lockfile == "package-lock.json" {
+			// A shrinkwrap is a package-lock.json that is
+			// published with the package.
+			var err error
+			if contents, err = os.ReadFile(b.Lockfile); err != nil {
+				util.DieIO("%s: %s", b.Lockfile, err)
+			}
+			break
+		}
+		contents = exportShrinkwrapFor(b)
+
+	case "dockerfile":
+		contents = []byte(exportDockerfile(b))
+
+	case "nix":
+		contents = []byte(exportNixFor(b, backendLanguage))
+	}
+
+	if output == "" {
+		fmt.Print(string(contents))
+		return
+	}
+	util.TryWriteAtomic(output, contents)
+}
+
+// dockerfileStanza writes the lines of a Dockerfile that copy files
+// into the image and run cmds there, with a comment naming the tools
+// the image needs.
+func dockerfileStanza(b api.LanguageBackend, files []string, cmds [][]string) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# Generated by 'upm export --format dockerfile' for %s.\n", b.Name)
+	if len(b.Tools) > 0 {
+		fmt.Fprintf(&sb, "# The image needs %s.\n", strings.Join(b.Tools, ", "))
+	}
+	fmt.Fprintf(&sb, "COPY %s ./\n", strings.Join(files, " "))
+	for _, cmd := range cmds {
+		fmt.Fprintf(&sb, "RUN %s\n", shellquote.Join(cmd...))
+	}
+	return sb.String()
+}
+
+// exportDockerfile returns the Dockerfile stanza that installs the
+// project's packages: the specfile and lockfile are copied, and the
+// commands of a frozen production install, as 'upm install --frozen
+// --prod' would run them, are run.
+func exportDockerfile(b api.LanguageBackend) string {
+	files := []string{b.Specfile}
+	if b.QuirksIsReproducible() && b.Lockfile != b.Specfile {
+		files = append(files, b.Lockfile)
+	}
+
+	frozen, prod := config.Frozen, config.Prod
+	config.Frozen, config.Prod = true, b.SupportsDev
+	s := silenceSubroutines()
+	cmds := util.CaptureCmds(func() {
+		b.Install(context.Background())
+	})
+	s.restore()
+	config.Frozen, config.Prod = frozen, prod
+
+	return dockerfileStanza(b, files, cmds)
+}
+
+// nixAttrName matches the names that can be used in Nix without
+// quotes.
+var nixAttrName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_'-]*$`)
+
+// nixStoreName matches the characters that cannot appear in the name
+// of a Nix derivation.
+var nixStoreName = regexp.MustCompile(`[^a-zA-Z0-9+._?=-]+`)
+
+// exportNixPython writes a Nix expression for a Python environment
+// with the locked packages, taken from nixpkgs, whose attribute names
+// are the normalized package names. The locked versions are noted in
+// comments, since nixpkgs has one version of each package.
+func exportNixPython(lockfile string, locked map[api.PkgName]api.PkgVersion) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# Generated by 'upm export --format nix' from %s.\n", lockfile)
+	sb.WriteString("{ pkgs ? import <nixpkgs> { } }:\n\n")
+	sb.WriteString("pkgs.python3.withPackages (ps: [\n")
+	for _, name := range sortedLocked(locked) {
+		attr := strings.ToLower(strings.NewReplacer("_", "-", ".", "-").Replace(string(name)))
+		if !nixAttrName.MatchString(attr) {
+			attr = strconv.Quote(attr)
+		}
+		fmt.Fprintf(&sb, "  ps.%s # %s\n", attr, locked[name])
+	}
+	sb.WriteString("])\n")
+	return sb.String()
+}
+
+// exportNixNode writes a Nix derivation that builds a Node.js project
+// from its lockfile, with buildNpmPackage for npm and mkYarnPackage
+// for Yarn.
+func exportNixNode(backendName, lockfile, name, version string) (string, error) {
+	pname := strings.Trim(nixStoreName.ReplaceAllString(name, "-"), "-.")
+	if pname == "" {
+		pname = "project"
+	}
+	if version == "" {
+		version = "0.0.0"
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# Generated by 'upm export --format nix' from %s.\n", lockfile)
+	sb.WriteString("{ pkgs ? import <nixpkgs> { } }:\n\n")
+	switch backendName {
+	case "nodejs-npm":
+		sb.WriteString("pkgs.buildNpmPackage {\n")
+		fmt.Fprintf(&sb, "  pname = %s;\n", strconv.Quote(pname))
+		fmt.Fprintf(&sb, "  version = %s;\n", strconv.Quote(version))
+		sb.WriteString("  src = ./.;\n")
+		sb.WriteString("  # Replace with the hash that the first build reports.\n")
+		sb.WriteString("  npmDepsHash = pkgs.lib.fakeHash;\n")
+	case "nodejs-yarn":
+		sb.WriteString("pkgs.mkYarnPackage {\n")
+		fmt.Fprintf(&sb, "  pname = %s;\n", strconv.Quote(pname))
+		fmt.Fprintf(&sb, "  version = %s;\n", strconv.Quote(version))
+		sb.WriteString("  src = ./.;\n")
+		sb.WriteString("  packageJSON = ./package.json;\n")
+		fmt.Fprintf(&sb, "  yarnLock = ./%s;\n", lockfile)
+	default:
+		return "", fmt.Errorf("%s cannot be exported as nix", backendName)
+	}
+	sb.WriteString("}\n")
+	return sb.String(), nil
+}
+
+// exportNixFor builds the Nix expression of a project.
+func exportNixFor(b api.LanguageBackend, language string) string {
+	switch language {
+	case "python3":
+		s := silenceSubroutines()
+		locked := b.ListLockfile()
+		s.restore()
+		return exportNixPython(b.Lockfile, locked)
+
+	case "nodejs":
+		pkgJSON := readPackageJSON()
+		contents, err := exportNixNode(b.Name, b.Lockfile, pkgJSON.Name, pkgJSON.Version)
+		if err != nil {
+			util.DieUnimplemented("%s", err)
+		}
+		return contents
+	}
+	util.DieUnimplemented("%s cannot be exported as nix", b.Name)
+	return ""
+}
+
+// packageJSON is the metadata in a package.json.
+type packageJSON struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// readPackageJSON reads the metadata of a Node.js project, which is
+// empty if there is no package.json.
+func readPackageJSON() packageJSON {
+	var pkgJSON packageJSON
+	if contentsB, err := os.ReadFile("package.json"); err == nil {
+		if err := json.Unmarshal(contentsB, &pkgJSON); err != nil {
+			util.DieProtocol("package.json: %s", err)
+		}
+	}
+	return pkgJSON
+}
+
+// exportShrinkwrapFor builds the npm-shrinkwrap.json of a Node.js
+// project whose lockfile is not npm's.
+func exportShrinkwrapFor(b api.LanguageBackend) []byte {
+	pkgJSON := readPackageJSON()
+
+	s := silenceSubroutines()
+	var specs api.PkgDeps
+	if util.Exists(b.Specfile) {
+		specs = b.ListSpecfile(true)
+	}
+	locked := b.ListLockfile()
+	var hashes map[api.PkgName][]string
+	if b.ListLockfileHashes != nil {
+		hashes = b.ListLockfileHashes()
+	}
+	s.restore()
+
+	contents, err := exportShrinkwrap(pkgJSON.Name, pkgJSON.Version, specs, locked, hashes)
+	if err != nil {
+		util.DieProtocol("%s", err)
+	}
+	return contents
+}
@@ -0,0 +1,118 @@
+package cli
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+)
+
+func TestExportRequirements(t *testing.T) {
+	locked := map[api.PkgName]api.PkgVersion{"requests": "2.32.3", "flask": "3.0.3"}
+	hashes := map[api.PkgName][]string{"flask": {"sha256:aa", "sha256:bb"}}
+
+	expected := "# Generated by 'upm export' from poetry.lock.\n" +
+		"flask==3.0.3 \\\n    --hash=sha256:aa \\\n    --hash=sha256:bb\n" +
+		"requests==2.32.3\n"
+	if got := exportRequirements("poetry.lock", locked, hashes); got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+
+	expected = "# Generated by 'upm export' from poetry.lock.\nflask==3.0.3\nrequests==2.32.3\n"
+	if got := exportRequirements("poetry.lock", locked, nil); got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestExportShrinkwrap(t *testing.T) {
+	specs := api.PkgDeps{
+		"express":  {Spec: "^4.18.0"},
+		"jest":     {Spec: "^29.0.0", Dev: true},
+		"fsevents": {Group: "optional"},
+	}
+	locked := map[api.PkgName]api.PkgVersion{"express": "4.18.2", "jest": "29.7.0", "fsevents": "2.3.3"}
+	hashes := map[api.PkgName][]string{"express": {"sha512-abc"}, "jest": {"10c0/def"}}
+
+	contents, err := exportShrinkwrap("app", "1.0.0", specs, locked, hashes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got shrinkwrap
+	if err := json.Unmarshal(contents, &got); err != nil {
+		t.Fatal(err)
+	}
+	expected := shrinkwrap{
+		Name:            "app",
+		Version:         "1.0.0",
+		LockfileVersion: 3,
+		Requires:        true,
+		Packages: map[string]shrinkwrapPackage{
+			"": {
+				Name:                 "app",
+				Version:              "1.0.0",
+				Dependencies:         map[string]string{"express": "^4.18.0"},
+				DevDependencies:      map[string]string{"jest": "^29.0.0"},
+				OptionalDependencies: map[string]string{"fsevents": "*"},
+			},
+			"node_modules/express":  {Version: "4.18.2", Integrity: "sha512-abc"},
+			"node_modules/fsevents": {Version: "2.3.3"},
+			"node_modules/jest":     {Version: "29.7.0"},
+		},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %+v, got %+v", expected, got)
+	}
+}
+
+func TestDockerfileStanza(t *testing.T) {
+	b := api.LanguageBackend{Name: "nodejs-npm", Tools: []string{"npm", "node"}}
+	cmds := [][]string{{"npm", "ci", "--omit=dev"}, {"sh", "-c", "echo done"}}
+
+	expected := "# Generated by 'upm export --format dockerfile' for nodejs-npm.\n" +
+		"# The image needs npm, node.\n" +
+		"COPY package.json package-lock.json ./\n" +
+		"RUN npm ci --omit=dev\n" +
+		"RUN sh -c 'echo done'\n"
+	if got := dockerfileStanza(b, []string{"package.json", "package-lock.json"}, cmds); got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestExportNixPython(t *testing.T) {
+	locked := map[api.PkgName]api.PkgVersion{"Flask": "3.0.3", "typing_extensions": "4.12.2", "zope.interface": "7.0"}
+
+	expected := "# Generated by 'upm export --format nix' from uv.lock.\n" +
+		"{ pkgs ? import <nixpkgs> { } }:\n\n" +
+		"pkgs.python3.withPackages (ps: [\n" +
+		"  ps.flask # 3.0.3\n" +
+		"  ps.typing-extensions # 4.12.2\n" +
+		"  ps.zope-interface # 7.0\n" +
+		"])\n"
+	if got := exportNixPython("uv.lock", locked); got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestExportNixNode(t *testing.T) {
+	expected := "# Generated by 'upm export --format nix' from package-lock.json.\n" +
+		"{ pkgs ? import <nixpkgs> { } }:\n\n" +
+		"pkgs.buildNpmPackage {\n" +
+		"  pname = \"scope-app\";\n" +
+		"  version = \"1.2.0\";\n" +
+		"  src = ./.;\n" +
+		"  # Replace with the hash that the first build reports.\n" +
+		"  npmDepsHash = pkgs.lib.fakeHash;\n" +
+		"}\n"
+	got, err := exportNixNode("nodejs-npm", "package-lock.json", "@scope/app", "1.2.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+
+	if _, err := exportNixNode("nodejs-pnpm", "pnpm-lock.yaml", "app", ""); err == nil {
+		t.Errorf("expected an error for pnpm")
+	}
+}
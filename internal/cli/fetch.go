@@ -0,0 +1,28 @@
+package cli
+
+import (
+	"github.com/replit/upm/internal/backends"
+	"github.com/replit/upm/internal/trace"
+	"github.com/replit/upm/internal/util"
+)
+
+// runFetch implements 'upm fetch', which downloads the locked packages
+// to the package manager's cache without installing them, so that a
+// later 'upm install' needs no network.
+func runFetch(language string) {
+	span, ctx := trace.StartSpanFromExistingContext("runFetch")
+	defer span.Finish()
+	defer beginProgress("fetch").end()
+	b := backends.GetBackend(ctx, language)
+	if b.Fetch == nil {
+		dieUnsupported(b, "fetch")
+	}
+	if !util.Exists(b.Specfile) {
+		util.DieIO("%s: no such file", b.Specfile)
+	}
+	if !util.Exists(b.Lockfile) {
+		util.DieStaleLockfile("%s is missing; run 'upm lock' first", b.Lockfile)
+	}
+	ensureTools(b)
+	b.Fetch(ctx)
+}
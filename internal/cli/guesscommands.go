@@ -0,0 +1,81 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/imports"
+	"github.com/replit/upm/internal/util"
+)
+
+// procfilePatterns are the Procfiles that 'upm guess
+// --include-commands' looks for commands in, besides shell scripts.
+var procfilePatterns = []string{"Procfile", "Procfile.*"}
+
+// procfileCommands returns the command lines of a Procfile, which are
+// "name: command" lines.
+func procfileCommands(contents string) string {
+	commands := []string{}
+	for _, line := range strings.Split(contents, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, command, ok := strings.Cut(line, ":"); ok {
+			commands = append(commands, strings.TrimSpace(command))
+		}
+	}
+	return strings.Join(commands, "\n")
+}
+
+// findCommands returns the commands that the shell scripts and
+// Procfiles in dir run.
+func findCommands(ctx context.Context, dir string) (map[string]bool, error) {
+	commands, err := imports.Find(ctx, dir, imports.Shell, nil)
+	if err != nil {
+		return nil, err
+	}
+	procfiles, err := util.FindSourceFiles(dir, procfilePatterns, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range procfiles {
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		found, err := imports.FindSource(imports.Shell, path, []byte(procfileCommands(string(contents))))
+		if err != nil {
+			return nil, err
+		}
+		for command := range found {
+			commands[command] = true
+		}
+	}
+	return commands, nil
+}
+
+// addGuessedCommands adds the packages that b.CommandPackages maps the
+// commands that the project runs to, for 'upm guess
+// --include-commands'.
+func addGuessedCommands(ctx context.Context, b api.LanguageBackend, guessed map[string][]api.PkgName) {
+	if b.CommandPackages == nil {
+		dieUnsupported(b, "guess-commands")
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		util.DieIO("couldn't get working directory: %s", err)
+	}
+	commands, err := findCommands(ctx, cwd)
+	if err != nil {
+		util.DieConsistency("couldn't guess commands: %s", err)
+	}
+	for command := range commands {
+		if pkg, ok := b.CommandPackages[command]; ok {
+			guessed[fmt.Sprintf("command %s", command)] = []api.PkgName{pkg}
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestFindCommands(t *testing.T) {
+	testDir := t.TempDir()
+	for name, contents := range map[string]string{
+		"Procfile":     "web: gunicorn app:app\n# worker: notrun\nworker: celery -A app worker\n",
+		"Procfile.dev": "web: uv run flask --debug run\n",
+		"lint.sh":      "#!/bin/sh\nruff check . && black --check .\n",
+	} {
+		if err := os.WriteFile(path.Join(testDir, name), []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	commands, err := findCommands(context.Background(), testDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]bool{"gunicorn": true, "celery": true, "flask": true, "ruff": true, "black": true}
+	if !reflect.DeepEqual(commands, expected) {
+		t.Errorf("expected %v, got %v", expected, commands)
+	}
+}
@@ -0,0 +1,169 @@
+package cli
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/table"
+	"github.com/replit/upm/internal/util"
+)
+
+// healthSignal is one of the signals that 'upm info --health' bases
+// its score on, scored from 0 for worst to 1 for best.
+type healthSignal struct {
+	Name  string  `json:"name"`
+	Value string  `json:"value"`
+	Score float64 `json:"score"`
+}
+
+// healthReport is the result of 'upm info --health'. Score is from 0
+// to 100, or -1 if no signal is known.
+type healthReport struct {
+	Score   int            `json:"score"`
+	Rating  string         `json:"rating"`
+	Signals []healthSignal `json:"signals"`
+}
+
+// healthRating describes a score of healthReport.
+func healthRating(score int) string {
+	switch {
+	case score < 0:
+		return "unknown"
+	case score >= 75:
+		return "good"
+	case score >= 50:
+		return "fair"
+	default:
+		return "poor"
+	}
+}
+
+// scoreReleaseAge scores how long ago the latest release was: a
+// package that has not been released in years is likely unmaintained.
+func scoreReleaseAge(age time.Duration) float64 {
+	switch {
+	case age <= 6*ageMonth:
+		return 1
+	case age <= ageYear:
+		return 0.75
+	case age <= 2*ageYear:
+		return 0.4
+	default:
+		return 0.1
+	}
+}
+
+// scoreOpenIssues scores the number of open issues and pull requests
+// of the package's repository, a backlog its maintainers are not
+// keeping up with.
+func scoreOpenIssues(open int64) float64 {
+	switch {
+	case open <= 50:
+		return 1
+	case open <= 200:
+		return 0.75
+	case open <= 1000:
+		return 0.5
+	default:
+		return 0.25
+	}
+}
+
+// scoreMaintainers scores the number of maintainers, since a package
+// with one is only as maintained as that person has time for.
+func scoreMaintainers(n int) float64 {
+	switch {
+	case n >= 3:
+		return 1
+	case n == 2:
+		return 0.7
+	default:
+		return 0.4
+	}
+}
+
+// assessHealth scores the maintenance of a package from info and, if
+// it is known, its GitHub repository, as of now. The score is the
+// average of the scores of the signals that are known, and zero for a
+// deprecated package or an archived repository.
+func assessHealth(info api.PkgInfo, repository *githubRepository, now time.Time) healthReport {
+	signals := []healthSignal{}
+	if released, err := time.Parse("2006-01-02", info.Updated); err == nil {
+		signals = append(signals, healthSignal{
+			Name:  "Last release",
+			Value: releasedAgo(info.Updated, now),
+			Score: scoreReleaseAge(now.Sub(released)),
+		})
+	}
+	if repository != nil {
+		signal := healthSignal{
+			Name:  "Open issues",
+			Value: strconv.FormatInt(repository.OpenIssuesCount, 10),
+			Score: scoreOpenIssues(repository.OpenIssuesCount),
+		}
+		if repository.Archived {
+			signal.Value += " (repository archived)"
+			signal.Score = 0
+		}
+		signals = append(signals, signal)
+	}
+	if len(info.Maintainers) > 0 {
+		signals = append(signals, healthSignal{
+			Name:  "Maintainers",
+			Value: strconv.Itoa(len(info.Maintainers)),
+			Score: scoreMaintainers(len(info.Maintainers)),
+		})
+	}
+	if info.Deprecated != "" {
+		signals = append(signals, healthSignal{Name: "Deprecated", Value: info.Deprecated, Score: 0})
+	}
+
+	report := healthReport{Score: -1, Signals: signals}
+	if len(signals) > 0 {
+		total := 0.0
+		for _, signal := range signals {
+			total += signal.Score
+		}
+		report.Score = int(math.Round(100 * total / float64(len(signals))))
+		if info.Deprecated != "" || (repository != nil && repository.Archived) {
+			report.Score = 0
+		}
+	}
+	report.Rating = healthRating(report.Score)
+	return report
+}
+
+// packageHealth looks up the GitHub repository of a package, if it has
+// one, and assesses its health. A repository that cannot be looked up
+// is left out of the score.
+func packageHealth(info api.PkgInfo) healthReport {
+	var repository *githubRepository
+	if owner, repo, ok := infoGithubRepo(info); ok {
+		err := util.Catch(func() {
+			repository = lookupGithubRepository(owner, repo)
+		})
+		if err != nil {
+			util.LogError(fmt.Sprintf("cannot look up the repository of %s: %s", info.Name, err))
+		}
+	}
+	return assessHealth(info, repository, time.Now())
+}
+
+// printHealth prints the table form of a healthReport, after the
+// other information of 'upm info'.
+func printHealth(report healthReport) {
+	fmt.Println()
+	if report.Score < 0 {
+		fmt.Println("Health: unknown (no signals found)")
+		return
+	}
+	fmt.Printf("Health: %d/100 (%s)\n", report.Score, report.Rating)
+	t := table.New("signal", "value", "score")
+	for _, signal := range report.Signals {
+		t.AddRow(signal.Name, signal.Value, fmt.Sprintf("%.0f%%", 100*signal.Score))
+	}
+	t.Print()
+}
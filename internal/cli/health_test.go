@@ -0,0 +1,36 @@
+package cli
+
+import (
+	"testing"
+	"time"
+
+	"github.com/replit/upm/internal/api"
+)
+
+func TestAssessHealth(t *testing.T) {
+	now := time.Date(2024, 8, 15, 0, 0, 0, 0, time.UTC)
+	info := api.PkgInfo{Name: "flask", Updated: "2024-05-01", Maintainers: []string{"davidism"}}
+
+	report := assessHealth(info, &githubRepository{OpenIssuesCount: 120}, now)
+	// The average of 1 for the release, 0.75 for the issues and
+	// 0.4 for the one maintainer.
+	if report.Score != 72 || report.Rating != "fair" || len(report.Signals) != 3 {
+		t.Errorf("expected a fair score of 72 from 3 signals, got %+v", report)
+	}
+	if value := report.Signals[0].Value; value != "2024-05-01 (3 months ago)" {
+		t.Errorf("expected the age of the release, got %q", value)
+	}
+
+	if report := assessHealth(info, &githubRepository{Archived: true}, now); report.Score != 0 || report.Rating != "poor" {
+		t.Errorf("expected an archived repository to score 0, got %+v", report)
+	}
+	deprecated := info
+	deprecated.Deprecated = "deprecated: use quart"
+	if report := assessHealth(deprecated, nil, now); report.Score != 0 || len(report.Signals) != 3 {
+		t.Errorf("expected a deprecated package to score 0, got %+v", report)
+	}
+
+	if report := assessHealth(api.PkgInfo{Name: "unknown"}, nil, now); report.Score != -1 || report.Rating != "unknown" {
+		t.Errorf("expected no score without signals, got %+v", report)
+	}
+}
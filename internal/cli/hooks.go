@@ -0,0 +1,154 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/specedit"
+	"github.com/replit/upm/internal/util"
+)
+
+// hookEvent describes the command that hooks run after. The JSON form
+// is what the "notify" template sends.
+type hookEvent struct {
+	Event    string   `json:"event"`
+	Language string   `json:"language"`
+	Packages []string `json:"packages"`
+}
+
+// hookTemplate is a hook built into UPM, which the [[hooks]] of a
+// configuration file can name with template.
+type hookTemplate func(ctx context.Context, b api.LanguageBackend, event hookEvent, hook config.Hook) error
+
+// hookTemplates are the hooks built into UPM, by name.
+var hookTemplates = map[string]hookTemplate{
+	"replit":     replitHook,
+	"replit-nix": replitNixHook,
+	"notify":     notifyHook,
+}
+
+// replitHook points the packager of the Replit workspace at the
+// backend, in the [packager] table of .replit, if there is a .replit.
+func replitHook(ctx context.Context, b api.LanguageBackend, event hookEvent, hook config.Hook) error {
+	contents, err := os.ReadFile(".replit")
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	updated, err := specedit.SetTOML(contents, "packager", "language", b.Name)
+	if err != nil {
+		return fmt.Errorf(".replit: %w", err)
+	}
+	if string(updated) != string(contents) {
+		util.TryWriteAtomic(".replit", updated)
+	}
+	return nil
+}
+
+// replitNixHook adds the system dependencies of the added packages to
+// the Nix environment of the Replit workspace.
+func replitNixHook(ctx context.Context, b api.LanguageBackend, event hookEvent, hook config.Hook) error {
+	if event.Event == "remove" || b.InstallReplitNixSystemDependencies == nil {
+		return nil
+	}
+	if os.Getenv("REPL_HOME") == "" {
+		return fmt.Errorf("REPL_HOME is not set; is this a Replit workspace?")
+	}
+	pkgs := []api.PkgName{}
+	for _, pkg := range event.Packages {
+		pkgs = append(pkgs, api.PkgName(pkg))
+	}
+	b.InstallReplitNixSystemDependencies(ctx, pkgs)
+	return nil
+}
+
+// notifyHook sends the event as a line of JSON to the Unix socket of
+// the hook, such as one a language server listens on to reload the
+// project's packages.
+func notifyHook(ctx context.Context, b api.LanguageBackend, event hookEvent, hook config.Hook) error {
+	if hook.Socket == "" {
+		return fmt.Errorf("the notify template needs a socket")
+	}
+	conn, err := net.DialTimeout("unix", hook.Socket, 5*time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.SetWriteDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		return err
+	}
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = conn.Write(append(line, '\n'))
+	return err
+}
+
+// hookCommand returns the command that runs the shell command of a
+// hook, with the event in its environment.
+func hookCommand(run string, event hookEvent) []string {
+	return []string{
+		"env",
+		"UPM_EVENT=" + event.Event,
+		"UPM_LANGUAGE=" + event.Language,
+		"UPM_PACKAGES=" + strings.Join(event.Packages, " "),
+		"sh", "-c", run,
+	}
+}
+
+// runHook runs one hook, returning an error if it failed.
+func runHook(ctx context.Context, b api.LanguageBackend, event hookEvent, hook config.Hook) error {
+	if hook.Run != "" {
+		if code := util.GetExitCode(hookCommand(hook.Run, event), true, true); code != 0 {
+			return fmt.Errorf("exited with status %d", code)
+		}
+		return nil
+	}
+	template, ok := hookTemplates[hook.Template]
+	if !ok {
+		names := []string{}
+		for name := range hookTemplates {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("no such template (must be one of %s)", strings.Join(names, ", "))
+	}
+	return template(ctx, b, event, hook)
+}
+
+// runHooks runs the configured hooks for a command that has
+// succeeded. The command's changes are kept even if a hook fails, so
+// failures are only reported. Nothing is run with --dry-run.
+func runHooks(ctx context.Context, b api.LanguageBackend, name string, pkgs []api.PkgName) {
+	if config.DryRun || len(config.Loaded.Hooks) == 0 {
+		return
+	}
+	event := hookEvent{Event: name, Language: b.Name, Packages: []string{}}
+	for _, pkg := range pkgs {
+		event.Packages = append(event.Packages, string(pkg))
+	}
+	sort.Strings(event.Packages)
+
+	for _, hook := range config.Loaded.Hooks {
+		if !hook.RunsOn(name) {
+			continue
+		}
+		description := hook.Template
+		if hook.Run != "" {
+			description = hook.Run
+		}
+		if err := runHook(ctx, b, event, hook); err != nil {
+			util.Log(fmt.Sprintf("hook %s failed: %s", description, err))
+		}
+	}
+}
@@ -0,0 +1,97 @@
+//go:build unix
+
+package cli
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/config"
+)
+
+func TestHookCommand(t *testing.T) {
+	event := hookEvent{Event: "add", Language: "python3-uv", Packages: []string{"flask", "requests"}}
+	expected := []string{
+		"env", "UPM_EVENT=add", "UPM_LANGUAGE=python3-uv", "UPM_PACKAGES=flask requests",
+		"sh", "-c", "make editor-config",
+	}
+	if got := hookCommand("make editor-config", event); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestNotifyHook(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "lsp.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	received := make(chan hookEvent, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		var event hookEvent
+		line, _ := bufio.NewReader(conn).ReadBytes('\n')
+		_ = json.Unmarshal(line, &event)
+		received <- event
+	}()
+
+	event := hookEvent{Event: "remove", Language: "nodejs-npm", Packages: []string{"lodash"}}
+	hook := config.Hook{Template: "notify", Socket: socket}
+	if err := runHook(context.Background(), api.LanguageBackend{Name: "nodejs-npm"}, event, hook); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-received; !reflect.DeepEqual(got, event) {
+		t.Errorf("expected %+v, got %+v", event, got)
+	}
+}
+
+func TestReplitHook(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	b := api.LanguageBackend{Name: "python3-poetry"}
+	hook := config.Hook{Template: "replit"}
+	if err := runHook(context.Background(), b, hookEvent{Event: "add"}, hook); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(".replit"); !os.IsNotExist(err) {
+		t.Errorf("expected no .replit to be created")
+	}
+
+	if err := os.WriteFile(".replit", []byte("run = \"python main.py\"\n\n[packager]\nlanguage = \"python3\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runHook(context.Background(), b, hookEvent{Event: "add"}, hook); err != nil {
+		t.Fatal(err)
+	}
+	contents, err := os.ReadFile(".replit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "run = \"python main.py\"\n\n[packager]\nlanguage = \"python3-poetry\"\n"
+	if string(contents) != expected {
+		t.Errorf("expected %q, got %q", expected, contents)
+	}
+
+	if err := runHook(context.Background(), b, hookEvent{}, config.Hook{Template: "vscode"}); err == nil {
+		t.Errorf("expected an unknown template to fail")
+	}
+}
@@ -0,0 +1,174 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/table"
+	"github.com/replit/upm/internal/util"
+	"github.com/replit/upm/internal/versions"
+)
+
+// Values for installedEntry.Status.
+const (
+	// The installed version is the locked one, or satisfies the
+	// spec if there is no lockfile.
+	installedOK = "ok"
+
+	// The installed version is not the locked one, or does not
+	// satisfy the spec if there is no lockfile.
+	installedDrift = "drift"
+
+	// The package is in the specfile or lockfile but not
+	// installed.
+	installedMissing = "not-installed"
+
+	// The package is installed but not in the lockfile.
+	installedExtraneous = "extraneous"
+
+	// The package is installed, and there is nothing to compare
+	// it with: it is a transitive dependency in a project without
+	// a lockfile, or its spec cannot be evaluated.
+	installedUnchecked = "unchecked"
+)
+
+// installedEntry represents one row of 'upm list --installed'. The
+// JSON form is the machine-readable report.
+type installedEntry struct {
+	Name      string `json:"name" pretty:"Name"`
+	Spec      string `json:"spec,omitempty" pretty:"Spec"`
+	Locked    string `json:"locked,omitempty" pretty:"Locked"`
+	Installed string `json:"installed,omitempty" pretty:"Installed"`
+	Status    string `json:"status" pretty:"Status"`
+}
+
+// compareInstalled compares the installed packages with the specfile
+// and lockfile of b, one entry per package sorted by name. locked is
+// nil if there is no lockfile, in which case installed versions are
+// compared with the specs instead. Packages that are not in the
+// specfile are only included if all is set.
+func compareInstalled(b api.LanguageBackend, specs api.PkgDeps, locked, installed map[api.PkgName]api.PkgVersion, all bool) []installedEntry {
+	type pkg struct {
+		name      api.PkgName
+		spec      api.PkgSpec
+		locked    api.PkgVersion
+		isLocked  bool
+		installed api.PkgVersion
+		isInst    bool
+	}
+	pkgs := map[api.PkgName]*pkg{}
+	get := func(name api.PkgName) *pkg {
+		norm := b.NormalizePackageName(name)
+		if pkgs[norm] == nil {
+			pkgs[norm] = &pkg{name: name}
+		}
+		return pkgs[norm]
+	}
+	for name, dep := range specs {
+		p := get(name)
+		p.name = name
+		p.spec = dep.Spec
+	}
+	direct := map[api.PkgName]bool{}
+	for norm := range pkgs {
+		direct[norm] = true
+	}
+	for name, version := range locked {
+		p := get(name)
+		p.locked, p.isLocked = version, true
+	}
+	for name, version := range installed {
+		p := get(name)
+		p.installed, p.isInst = version, true
+	}
+
+	entries := []installedEntry{}
+	for norm, p := range pkgs {
+		if !all && !direct[norm] {
+			continue
+		}
+		entry := installedEntry{
+			Name:      string(p.name),
+			Spec:      string(p.spec),
+			Locked:    string(p.locked),
+			Installed: string(p.installed),
+		}
+		switch {
+		case !p.isInst:
+			entry.Status = installedMissing
+		case locked != nil && !p.isLocked:
+			entry.Status = installedExtraneous
+		case locked != nil && sameVersion(string(p.locked), string(p.installed)):
+			entry.Status = installedOK
+		case locked != nil:
+			entry.Status = installedDrift
+		case !direct[norm] || p.spec == "":
+			entry.Status = installedUnchecked
+		default:
+			matches, err := b.MatchesSpec(p.spec, p.installed)
+			if err != nil {
+				entry.Status = installedUnchecked
+			} else if matches {
+				entry.Status = installedOK
+			} else {
+				entry.Status = installedDrift
+			}
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+	return entries
+}
+
+// sameVersion reports whether two versions are the same, also if they
+// are written differently, as in "1.0" and "1.0.0".
+func sameVersion(a, b string) bool {
+	if a == b {
+		return true
+	}
+	cmp, err := versions.Compare(a, b)
+	return err == nil && cmp == 0
+}
+
+// runListInstalled implements 'upm list --installed'.
+func runListInstalled(b api.LanguageBackend, all bool, devOnly bool, prodOnly bool, outputFormat outputFormat) {
+	if b.ListInstalled == nil {
+		dieUnsupported(b, "list-installed")
+	}
+
+	var locked map[api.PkgName]api.PkgVersion
+	if util.Exists(b.Lockfile) && b.ListLockfile != nil {
+		locked = lockedVersions(b)
+	}
+	s := silenceSubroutines()
+	installed := b.ListInstalled(b.GetPackageDir())
+	s.restore()
+
+	// Packages that are not in the specfile have no type, so they
+	// are left out when filtering by type.
+	entries := compareInstalled(b, filterDeps(specfileDeps(b), devOnly, prodOnly), locked, installed, all && !devOnly && !prodOnly)
+
+	switch outputFormat {
+	case outputFormatTable:
+		if len(entries) == 0 {
+			util.Log("no packages in specfile")
+			return
+		}
+		t := table.FromStructs(entries)
+		t.Print()
+
+	case outputFormatJSON:
+		outputB, err := json.Marshal(entries)
+		if err != nil {
+			panic("couldn't marshal json")
+		}
+		fmt.Println(string(outputB))
+
+	default:
+		util.Panicf("unknown output format %d", outputFormat)
+	}
+}
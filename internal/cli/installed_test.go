@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+)
+
+func TestCompareInstalled(t *testing.T) {
+	b := api.LanguageBackend{
+		NormalizePackageName: func(name api.PkgName) api.PkgName {
+			return api.PkgName(strings.ToLower(string(name)))
+		},
+		MatchesSpec: api.DefaultMatchesSpec,
+	}
+	specs := api.PkgDeps{
+		"Flask":    {Spec: ">=3.0"},
+		"requests": {Spec: ">=2.0"},
+		"rich":     {Spec: ">=13.0"},
+	}
+	installed := map[api.PkgName]api.PkgVersion{
+		"flask":    "3.0",
+		"requests": "2.32.0",
+		"click":    "8.1.7",
+	}
+
+	locked := map[api.PkgName]api.PkgVersion{
+		"flask":    "3.0.0",
+		"requests": "2.31.0",
+		"rich":     "13.7.1",
+	}
+	expected := []installedEntry{
+		{Name: "Flask", Spec: ">=3.0", Locked: "3.0.0", Installed: "3.0", Status: installedOK},
+		{Name: "click", Installed: "8.1.7", Status: installedExtraneous},
+		{Name: "requests", Spec: ">=2.0", Locked: "2.31.0", Installed: "2.32.0", Status: installedDrift},
+		{Name: "rich", Spec: ">=13.0", Locked: "13.7.1", Status: installedMissing},
+	}
+	if entries := compareInstalled(b, specs, locked, installed, true); !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected %+v, got %+v", expected, entries)
+	}
+
+	// Without a lockfile, installed versions are compared with
+	// the specs.
+	specs["requests"] = api.PkgDep{Spec: "<2.32"}
+	expected = []installedEntry{
+		{Name: "Flask", Spec: ">=3.0", Installed: "3.0", Status: installedOK},
+		{Name: "requests", Spec: "<2.32", Installed: "2.32.0", Status: installedDrift},
+		{Name: "rich", Spec: ">=13.0", Status: installedMissing},
+	}
+	if entries := compareInstalled(b, specs, nil, installed, false); !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected %+v, got %+v", expected, entries)
+	}
+}
@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/replit/upm/internal/backends"
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/util"
+)
+
+// selectLanguages returns the values of --lang to run a command with:
+// the backend of every language that the project uses for --lang
+// all, or language itself otherwise.
+func selectLanguages(language string) []string {
+	if language != backends.AllLanguages {
+		return []string{language}
+	}
+	languages := []string{}
+	for _, b := range backends.DetectLanguages() {
+		languages = append(languages, b.Name)
+	}
+	if len(languages) == 0 {
+		util.DieInitializationError("could not find the specfile or lockfile of any language in your project")
+	}
+	return languages
+}
+
+// forEachLanguage runs fn with each of the values of --lang that
+// selectLanguages returns, announcing each one for --lang all. A
+// failure does not stop the others, as described for keepGoing.
+func forEachLanguage(language string, fn func(language string)) {
+	selected := selectLanguages(language)
+	keepGoing(len(selected), func(i int) {
+		if language == backends.AllLanguages {
+			util.Log("==> " + selected[i])
+		}
+		fn(selected[i])
+	})
+}
+
+// keepGoing calls fn with each index up to n. If fn dies, the error is
+// reported and the following calls still happen; keepGoing then dies
+// with the exit code of the first error, so that one broken language
+// or workspace member does not hide the state of the others. With
+// --fail-fast, or once UPM is interrupted, the first error ends the
+// command at once.
+func keepGoing(n int, fn func(i int)) {
+	var first *util.Error
+	failures := 0
+	for i := 0; i < n; i++ {
+		err := util.Catch(func() {
+			fn(i)
+		})
+		if err == nil {
+			continue
+		}
+		dieErr := err.(*util.Error)
+		if config.FailFast || n == 1 || util.Interrupted() {
+			panic(dieErr)
+		}
+		if dieErr.Msg != "" {
+			util.LogError(dieErr.Msg)
+		}
+		if first == nil {
+			first = dieErr
+		}
+		failures++
+	}
+	if first != nil {
+		panic(&util.Error{Code: first.Code, Msg: fmt.Sprintf("%d of %d failed", failures, n)})
+	}
+}
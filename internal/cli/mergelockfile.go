@@ -0,0 +1,231 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/backends"
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/trace"
+	"github.com/replit/upm/internal/util"
+)
+
+// mergeFiles merges the changes from base to theirs into ours, as 'git
+// merge-file' does. It returns the merged contents, with git's
+// conflict markers where both sides changed the same lines, and
+// whether there were no such conflicts.
+func mergeFiles(base, ours, theirs []byte) ([]byte, bool) {
+	if bytes.Equal(base, theirs) {
+		return ours, true
+	}
+	if bytes.Equal(base, ours) {
+		return theirs, true
+	}
+	tempdir := util.TempDir()
+	defer os.RemoveAll(tempdir)
+	paths := []string{}
+	for i, contents := range [][]byte{ours, base, theirs} {
+		path := filepath.Join(tempdir, fmt.Sprint(i))
+		if err := os.WriteFile(path, contents, 0o644); err != nil {
+			util.DieIO("%s", err)
+		}
+		paths = append(paths, path)
+	}
+	cmd := exec.Command("git", append([]string{"merge-file", "-p", "-L", "ours", "-L", "base", "-L", "theirs"}, paths...)...)
+	cmd.Stderr = io.Discard
+	output, err := cmd.Output()
+	// The exit status is the number of conflicts.
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 && exitErr.ExitCode() < 128 {
+		return output, false
+	} else if err != nil {
+		util.DieSubprocess("git merge-file: %s", err)
+	}
+	return output, true
+}
+
+// mergeLockedVersions merges the locked versions of ours and theirs,
+// which both started from base: each package takes the version of the
+// side that changed it, and is left out if that side removed it. It
+// also returns the sorted names of the packages that both sides
+// changed differently, which keep our version.
+func mergeLockedVersions(base, ours, theirs map[api.PkgName]api.PkgVersion) (map[api.PkgName]api.PkgVersion, []api.PkgName) {
+	merged := map[api.PkgName]api.PkgVersion{}
+	conflicts := []api.PkgName{}
+	names := map[api.PkgName]bool{}
+	for _, versions := range []map[api.PkgName]api.PkgVersion{base, ours, theirs} {
+		for name := range versions {
+			names[name] = true
+		}
+	}
+	for name := range names {
+		baseVersion, inBase := base[name]
+		ourVersion, inOurs := ours[name]
+		theirVersion, inTheirs := theirs[name]
+		weChanged := inOurs != inBase || ourVersion != baseVersion
+		theyChanged := inTheirs != inBase || theirVersion != baseVersion
+		switch {
+		case theyChanged && !weChanged:
+			if inTheirs {
+				merged[name] = theirVersion
+			}
+		case theyChanged && (inOurs != inTheirs || ourVersion != theirVersion):
+			conflicts = append(conflicts, name)
+			fallthrough
+		default:
+			if inOurs {
+				merged[name] = ourVersion
+			}
+		}
+	}
+	sort.Slice(conflicts, func(i, j int) bool { return conflicts[i] < conflicts[j] })
+	return merged, conflicts
+}
+
+// theirRevision returns the commit that git is merging into HEAD, which
+// it names in a GITHEAD_<commit> environment variable while running a
+// merge driver for 'git merge', or the empty string if there is not
+// exactly one.
+func theirRevision() string {
+	revs := []string{}
+	for _, env := range os.Environ() {
+		if name, _, ok := strings.Cut(env, "="); ok && strings.HasPrefix(name, "GITHEAD_") {
+			revs = append(revs, strings.TrimPrefix(name, "GITHEAD_"))
+		}
+	}
+	if len(revs) != 1 {
+		return ""
+	}
+	return revs[0]
+}
+
+// mergedSpecfile returns the specfile of b that the merge in progress
+// will leave: git merges it separately, and only writes it when every
+// file has been merged, so it is merged here again from the commits
+// being merged. It returns false if those are not known, or if both
+// sides changed the same lines of the specfile.
+func mergedSpecfile(b api.LanguageBackend) ([]byte, bool) {
+	rev := theirRevision()
+	if rev == "" {
+		return nil, false
+	}
+	output, err := exec.Command("git", "merge-base", "HEAD", rev).Output()
+	if err != nil {
+		return nil, false
+	}
+	base := strings.TrimSpace(string(output))
+	return mergeFiles(gitShow(base, b.Specfile), gitShow("HEAD", b.Specfile), gitShow(rev, b.Specfile))
+}
+
+// runMergeLockfile implements 'upm merge-lockfile', a git merge driver
+// for lockfiles. git passes the common ancestor, our and their versions
+// of the lockfile at path as temporary files, and expects the result in
+// ours. The lockfile is merged line by line, keeping our side of any
+// conflict, and then, with the specfile that the merge will leave,
+// locked again, so that it is consistent and has the packages that
+// either side added. If the specfile cannot be known, a lockfile that
+// merged cleanly is kept as it is; otherwise the merge fails, for the
+// lockfile to be locked again once git has written the specfile.
+func runMergeLockfile(language string, base, ours, theirs, path string) {
+	span, ctx := trace.StartSpanFromExistingContext("runMergeLockfile")
+	defer span.Finish()
+	contents := [][]byte{}
+	for _, file := range []string{base, ours, theirs} {
+		contentsB, err := os.ReadFile(file)
+		if err != nil {
+			util.DieIO("%s", err)
+		}
+		contents = append(contents, contentsB)
+	}
+	ours, err := filepath.Abs(ours)
+	if err != nil {
+		util.DieIO("%s", err)
+	}
+
+	inDir(filepath.Dir(path), func() {
+		b := backends.GetBackend(ctx, language)
+		if b.QuirksIsNotReproducible() {
+			util.DieUnimplemented("%s has no lockfile to merge", b.Name)
+		}
+		if path == "" {
+			path = b.Lockfile
+		} else if filepath.Base(path) != b.Lockfile {
+			util.DieUsage("%s is not the lockfile of %s, %s", path, b.Name, b.Lockfile)
+		}
+
+		var specfile []byte
+		if util.Exists(b.Specfile) {
+			if specfile, err = os.ReadFile(b.Specfile); err != nil {
+				util.DieIO("%s", err)
+			}
+		}
+		locked := []map[api.PkgName]api.PkgVersion{}
+		for _, lockfile := range contents {
+			var versions map[api.PkgName]api.PkgVersion
+			inSnapshot(b, specfile, lockfile, func() {
+				if err := util.Catch(func() { versions = lockedVersions(b) }); err != nil {
+					util.DieConsistency("cannot merge a %s that does not parse: %s", b.Lockfile, err)
+				}
+			})
+			locked = append(locked, versions)
+		}
+		expected, conflicts := mergeLockedVersions(locked[0], locked[1], locked[2])
+		for _, name := range conflicts {
+			util.Log(fmt.Sprintf("%s: both sides changed it, keeping %s rather than %s", name, locked[1][name], locked[2][name]))
+		}
+
+		merged, clean := mergeFiles(contents[0], contents[1], contents[2])
+		if !clean {
+			resolved, _ := resolveConflicts(string(merged))
+			merged = []byte(resolved)
+		}
+		mergedSpec, ok := mergedSpecfile(b)
+		if !ok || b.Relock == nil {
+			util.TryWriteAtomic(ours, merged)
+			if !clean {
+				util.DieConsistency("%s has conflicts that need %s locked again; run 'upm lock' once %s is merged", path, b.Name, b.Specfile)
+			}
+			return
+		}
+		ensureTools(b)
+
+		tempdir := util.TempDir()
+		defer os.RemoveAll(tempdir)
+		copyLockInputs(b, tempdir)
+		var relocked []byte
+		inDir(tempdir, func() {
+			if err := os.WriteFile(b.Specfile, mergedSpec, 0o644); err != nil {
+				util.DieIO("%s", err)
+			}
+			if err := os.WriteFile(b.Lockfile, merged, 0o644); err != nil {
+				util.DieIO("%s", err)
+			}
+			b.Relock(context.Background())
+			if config.DryRun {
+				return
+			}
+			if relocked, err = os.ReadFile(b.Lockfile); err != nil {
+				util.DieIO("%s", err)
+			}
+			// Locking again may resolve another version than
+			// either side had, as when they required
+			// incompatible ones.
+			for _, change := range diffLockfile(expected, lockedVersions(b)) {
+				util.Log(fmt.Sprintf("%s %s when locked again", change.Name, change.Change))
+			}
+		})
+		if config.DryRun {
+			return
+		}
+		util.TryWriteAtomic(ours, relocked)
+	})
+}
@@ -0,0 +1,51 @@
+package cli
+
+import (
+	"os/exec"
+	"reflect"
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+)
+
+func TestMergeLockedVersions(t *testing.T) {
+	base := map[api.PkgName]api.PkgVersion{"a": "1.0.0", "b": "1.0.0", "c": "1.0.0", "d": "1.0.0"}
+	ours := map[api.PkgName]api.PkgVersion{"a": "1.1.0", "b": "1.0.0", "c": "1.2.0", "d": "1.0.0", "e": "1.0.0"}
+	theirs := map[api.PkgName]api.PkgVersion{"a": "1.0.0", "b": "2.0.0", "c": "1.3.0", "f": "1.0.0"}
+
+	merged, conflicts := mergeLockedVersions(base, ours, theirs)
+	expected := map[api.PkgName]api.PkgVersion{
+		"a": "1.1.0", // only we changed it
+		"b": "2.0.0", // only they changed it
+		"c": "1.2.0", // both did, so ours wins
+		"e": "1.0.0", // we added it
+		"f": "1.0.0", // they added it
+	}
+	if !reflect.DeepEqual(merged, expected) {
+		t.Errorf("expected %v, got %v", expected, merged)
+	}
+	if expected := []api.PkgName{"c"}; !reflect.DeepEqual(conflicts, expected) {
+		t.Errorf("expected conflicts %v, got %v", expected, conflicts)
+	}
+}
+
+func TestMergeFiles(t *testing.T) {
+	if merged, clean := mergeFiles([]byte("a\n"), []byte("b\n"), []byte("a\n")); !clean || string(merged) != "b\n" {
+		t.Errorf("expected our change, got %q (%v)", merged, clean)
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	base := []byte("1\n2\n3\n4\n5\n")
+	merged, clean := mergeFiles(base, []byte("one\n2\n3\n4\n5\n"), []byte("1\n2\n3\n4\nfive\n"))
+	if expected := "one\n2\n3\n4\nfive\n"; !clean || string(merged) != expected {
+		t.Errorf("expected %q, got %q (%v)", expected, merged, clean)
+	}
+
+	merged, clean = mergeFiles(base, []byte("one\n2\n3\n4\n5\n"), []byte("uno\n2\n3\n4\n5\n"))
+	resolved, _ := resolveConflicts(string(merged))
+	if expected := "one\n2\n3\n4\n5\n"; clean || resolved != expected {
+		t.Errorf("expected a conflict resolving to %q, got %q (%v)", expected, merged, clean)
+	}
+}
@@ -0,0 +1,201 @@
+package cli
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/backends"
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/trace"
+	"github.com/replit/upm/internal/util"
+)
+
+// migrationGroup is where 'upm migrate' adds a package in the target
+// specfile: the runtime dependencies, the development dependencies or
+// a named group.
+type migrationGroup struct {
+	dev   bool
+	group string
+}
+
+// migrationBackend returns the one backend that a value of --from or
+// --to names, terminating the process if there is none or several.
+func migrationBackend(flag, language string) api.LanguageBackend {
+	if language == "" {
+		util.DieUsage("--%s is required", flag)
+	}
+	matching := backends.GetBackends(language)
+	switch len(matching) {
+	case 0:
+		util.DieConsistency("no such language: %s", language)
+	case 1:
+		return matching[0]
+	}
+	names := []string{}
+	for _, b := range matching {
+		names = append(names, b.Name)
+	}
+	util.DieConsistency("--%s %s is ambiguous: it matches %s", flag, language, strings.Join(names, ", "))
+	return api.LanguageBackend{}
+}
+
+// translateSpec converts a spec from the specfile of src into one
+// that dst accepts. Specs naming a git repository, URL or path are
+// rewritten in the syntax of dst; other specs are kept, if dst
+// considers them valid.
+func translateSpec(src, dst api.LanguageBackend, name api.PkgName, spec api.PkgSpec) (api.PkgSpec, error) {
+	if spec == "" {
+		return "", nil
+	}
+	if source, ok := src.SourceOfSpec(spec); ok {
+		if dst.SpecForSource == nil {
+			return "", fmt.Errorf("%s cannot install packages from %s", dst.Name, source)
+		}
+		return dst.SpecForSource(name, source)
+	}
+	if dst.ValidateSpec != nil {
+		if err := dst.ValidateSpec(spec); err != nil {
+			return "", fmt.Errorf("spec %q is not valid for %s: %s", spec, dst.Name, err)
+		}
+	}
+	return spec, nil
+}
+
+// planMigration sorts the dependencies listed from the specfile of src
+// into the groups they are added to for dst, with their specs
+// translated. Development dependencies and groups that dst does not
+// support end up with the runtime dependencies, and a warning is
+// logged for each. All the specs that cannot be translated are
+// reported together.
+func planMigration(src, dst api.LanguageBackend, deps api.PkgDeps) (map[migrationGroup]map[api.PkgName]api.PkgSpec, error) {
+	names := []string{}
+	for name := range deps {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+
+	plan := map[migrationGroup]map[api.PkgName]api.PkgSpec{}
+	problems := []string{}
+	for _, nameStr := range names {
+		name := api.PkgName(nameStr)
+		dep := deps[name]
+		spec, err := translateSpec(src, dst, name, dep.Spec)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %s", name, err))
+			continue
+		}
+
+		group := migrationGroup{dev: dep.Dev, group: dep.Group}
+		if group.dev {
+			group.group = ""
+		}
+		if group.group != "" && !dst.SupportsGroups {
+			util.Log(fmt.Sprintf("%s does not support dependency groups; adding %s as a runtime dependency", dst.Name, name))
+			group.group = ""
+		}
+		if group.dev && !dst.SupportsDev {
+			util.Log(fmt.Sprintf("%s does not support dev-dependencies; adding %s as a runtime dependency", dst.Name, name))
+			group.dev = false
+		}
+		if plan[group] == nil {
+			plan[group] = map[api.PkgName]api.PkgSpec{}
+		}
+		plan[group][name] = spec
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("cannot migrate from %s to %s:\n  %s", src.Name, dst.Name, strings.Join(problems, "\n  "))
+	}
+	return plan, nil
+}
+
+// sharesSpecfile returns whether dst can use the specfile of src as it
+// is, as the Node.js package managers all use package.json.
+func sharesSpecfile(src, dst api.LanguageBackend) bool {
+	if src.Specfile != dst.Specfile {
+		return false
+	}
+	if dst.IsSpecfileCompatible == nil {
+		return true
+	}
+	compatible, err := dst.IsSpecfileCompatible(dst.Specfile)
+	return err == nil && compatible
+}
+
+// runMigrate implements 'upm migrate'.
+func runMigrate(from, to string, forceInstall bool) {
+	span, ctx := trace.StartSpanFromExistingContext("runMigrate")
+	defer span.Finish()
+	src := migrationBackend("from", from)
+	dst := migrationBackend("to", to)
+	if src.Name == dst.Name {
+		util.DieConsistency("--from and --to are both %s", src.Name)
+	}
+	srcLanguage, _, _ := strings.Cut(src.Name, "-")
+	dstLanguage, _, _ := strings.Cut(dst.Name, "-")
+	if srcLanguage != dstLanguage {
+		util.DieConsistency("cannot migrate from %s to %s, which are for different languages", src.Name, dst.Name)
+	}
+	if !util.Exists(src.Specfile) {
+		util.DieInitializationError("%s not found; there is nothing to migrate from %s", src.Specfile, src.Name)
+	}
+
+	ensureTools(dst)
+	defer lockProject()()
+	t := beginTransaction(dst)
+	defer t.end()
+
+	s := silenceSubroutines()
+	deps := src.ListSpecfile(true)
+	s.restore()
+
+	if sharesSpecfile(src, dst) {
+		util.Log(fmt.Sprintf("%s already works with %s; generating its lockfile", src.Specfile, dst.Name))
+	} else {
+		plan, err := planMigration(src, dst, deps)
+		if err != nil {
+			util.DieConsistency("%s", err)
+		}
+
+		groups := []migrationGroup{}
+		for group := range plan {
+			groups = append(groups, group)
+		}
+		sort.Slice(groups, func(i, j int) bool {
+			if groups[i].dev != groups[j].dev {
+				return !groups[i].dev
+			}
+			return groups[i].group < groups[j].group
+		})
+
+		if len(plan) == 0 && !util.Exists(dst.Specfile) && dst.Init != nil {
+			dst.Init(ctx, api.ProjectMetadata{})
+		}
+
+		dev, group := config.Dev, config.Group
+		for _, g := range groups {
+			config.Dev, config.Group = g.dev, g.group
+			dst.Add(ctx, plan[g], "")
+		}
+		config.Dev, config.Group = dev, group
+	}
+
+	if dst.QuirksIsReproducible() {
+		didLock := maybeLock(ctx, dst, true)
+		if !(didLock && dst.QuirksDoesLockAlsoInstall()) {
+			maybeInstall(ctx, dst, forceInstall)
+		}
+	} else {
+		maybeInstall(ctx, dst, forceInstall)
+	}
+
+	// The lockfile of the old backend would keep UPM detecting it.
+	if src.Lockfile != "" && src.Lockfile != dst.Lockfile {
+		deleteLockfile(ctx, src)
+	}
+	util.Log(fmt.Sprintf("migrated %d packages from %s to %s", len(deps), src.Name, dst.Name))
+	if src.Specfile != dst.Specfile && util.Exists(src.Specfile) {
+		util.Log(fmt.Sprintf("%s was left in place; delete it once the project no longer needs it", src.Specfile))
+	}
+}
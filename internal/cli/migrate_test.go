@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+)
+
+func TestPlanMigration(t *testing.T) {
+	src := api.LanguageBackend{Name: "test-src", SourceOfSpec: api.DefaultSpecSource}
+	dst := api.LanguageBackend{
+		Name:           "test-dst",
+		SourceOfSpec:   api.DefaultSpecSource,
+		SupportsGroups: true,
+		ValidateSpec: func(spec api.PkgSpec) error {
+			if strings.Contains(string(spec), "!") {
+				return errors.New("no !")
+			}
+			return nil
+		},
+		SpecForSource: func(name api.PkgName, source api.PkgSource) (api.PkgSpec, error) {
+			return api.PkgSpec("src:" + source.Location), nil
+		},
+	}
+
+	deps := api.PkgDeps{
+		"flask":  {Spec: ">=2"},
+		"pytest": {Dev: true},
+		"sphinx": {Group: "docs"},
+		"mylib":  {Spec: "@ git+https://github.com/u/mylib"},
+	}
+	expected := map[migrationGroup]map[api.PkgName]api.PkgSpec{
+		{}: {
+			"flask":  ">=2",
+			"mylib":  "src:https://github.com/u/mylib",
+			"pytest": "",
+		},
+		{group: "docs"}: {"sphinx": ""},
+	}
+	plan, err := planMigration(src, dst, deps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(plan, expected) {
+		t.Errorf("expected %v, got %v", expected, plan)
+	}
+
+	deps["bad"] = api.PkgDep{Spec: "!=1"}
+	if _, err := planMigration(src, dst, deps); err == nil || !strings.Contains(err.Error(), `bad: spec "!=1" is not valid for test-dst`) {
+		t.Errorf("expected the invalid spec to be reported, got %v", err)
+	}
+}
@@ -0,0 +1,130 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/backends"
+	"github.com/replit/upm/internal/util"
+)
+
+// openTarget is which page of a package 'upm open' opens.
+type openTarget string
+
+const (
+	openHomepage openTarget = "home page"
+	openDocs     openTarget = "documentation"
+	openRepo     openTarget = "repository"
+	openIssues   openTarget = "issue tracker"
+)
+
+// matchScpURL matches a repository URL in the syntax of scp, as in
+// "git@github.com:lodash/lodash.git".
+var matchScpURL = regexp.MustCompile(`^[\w.-]+@([\w.-]+):(.+)$`)
+
+// browsableURL returns the page in a browser of a repository URL such
+// as package.json may have, as in "git+https://github.com/lodash/lodash.git".
+func browsableURL(url string) string {
+	url = strings.TrimPrefix(url, "git+")
+	if match := matchScpURL.FindStringSubmatch(url); match != nil {
+		url = "https://" + match[1] + "/" + match[2]
+	}
+	for _, prefix := range []string{"git://", "ssh://git@", "ssh://"} {
+		if strings.HasPrefix(url, prefix) {
+			url = "https://" + strings.TrimPrefix(url, prefix)
+			break
+		}
+	}
+	return strings.TrimSuffix(url, ".git")
+}
+
+// openURL returns the URL of the target page of a package from its
+// info, and whether it has one. The documentation falls back to the
+// home page, and the home page and issue tracker to those of the
+// package's GitHub repository, since many packages only have one of
+// them.
+func openURL(info api.PkgInfo, target openTarget) (string, bool) {
+	repository := ""
+	if info.SourceCodeURL != "" {
+		repository = browsableURL(info.SourceCodeURL)
+	} else if owner, repo, ok := githubRepo(info.HomepageURL); ok {
+		repository = fmt.Sprintf("https://github.com/%s/%s", owner, repo)
+	}
+
+	url := ""
+	switch target {
+	case openHomepage:
+		url = info.HomepageURL
+		if url == "" {
+			url = repository
+		}
+	case openDocs:
+		url = info.DocumentationURL
+		if url == "" {
+			url = info.HomepageURL
+		}
+	case openRepo:
+		url = repository
+	case openIssues:
+		url = info.BugTrackerURL
+		if owner, repo, ok := githubRepo(repository); url == "" && ok {
+			url = fmt.Sprintf("https://github.com/%s/%s/issues", owner, repo)
+		}
+	default:
+		util.Panicf("unknown open target %q", target)
+	}
+	return url, url != ""
+}
+
+// browserCmd returns the command that opens url in the default browser:
+// the first in $BROWSER, which may give where the URL goes with "%s",
+// or else that of the operating system.
+func browserCmd(url string) []string {
+	if browser := strings.Fields(strings.Split(os.Getenv("BROWSER"), ":")[0]); len(browser) > 0 {
+		for i, arg := range browser {
+			if strings.Contains(arg, "%s") {
+				// It is meant for a shell, which would unquote it.
+				browser[i] = strings.NewReplacer("'%s'", url, `"%s"`, url, "%s", url).Replace(arg)
+				return browser
+			}
+		}
+		return append(browser, url)
+	}
+	switch runtime.GOOS {
+	case "darwin":
+		return []string{"open", url}
+	case "windows":
+		return []string{"rundll32", "url.dll,FileProtocolHandler", url}
+	default:
+		return []string{"xdg-open", url}
+	}
+}
+
+// runOpen implements 'upm open', opening the target page of a package,
+// as the registry names it, in the default browser.
+func runOpen(language string, arg string, target openTarget) {
+	b := backends.GetBackend(context.Background(), language)
+	if b.Info == nil {
+		dieUnsupported(b, "info")
+	}
+	info := b.Info(api.PkgName(arg))
+	if info.Name == "" {
+		util.DieConsistency("no such package: %s%s", arg, didYouMean(arg, registryCandidates(b, arg)))
+	}
+	url, ok := openURL(info, target)
+	if !ok {
+		util.DieConsistency("the registry has no %s for %s", target, info.Name)
+	}
+	if target == openDocs && info.DocumentationURL == "" {
+		util.Log(fmt.Sprintf("%s has no documentation link; opening its home page", info.Name))
+	}
+	util.Log(fmt.Sprintf("opening %s", url))
+	if code := util.RunAttached(browserCmd(url)); code != 0 {
+		util.DieSubprocess("cannot open %s in a browser (set BROWSER to choose one)", url)
+	}
+}
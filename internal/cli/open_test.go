@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+)
+
+func TestBrowsableURL(t *testing.T) {
+	for url, expected := range map[string]string{
+		"git+https://github.com/lodash/lodash.git": "https://github.com/lodash/lodash",
+		"git://github.com/lodash/lodash.git":       "https://github.com/lodash/lodash",
+		"git+ssh://git@github.com/lodash/lodash":   "https://github.com/lodash/lodash",
+		"git@gitlab.com:group/project.git":         "https://gitlab.com/group/project",
+		"https://github.com/pallets/flask/":        "https://github.com/pallets/flask/",
+	} {
+		if actual := browsableURL(url); actual != expected {
+			t.Errorf("%s: expected %q, got %q", url, expected, actual)
+		}
+	}
+}
+
+func TestOpenURL(t *testing.T) {
+	npm := api.PkgInfo{
+		HomepageURL:   "https://lodash.com/",
+		SourceCodeURL: "git+https://github.com/lodash/lodash.git",
+	}
+	pypi := api.PkgInfo{HomepageURL: "https://github.com/psf/requests"}
+	for _, test := range []struct {
+		info     api.PkgInfo
+		target   openTarget
+		expected string
+	}{
+		{npm, openHomepage, "https://lodash.com/"},
+		{npm, openDocs, "https://lodash.com/"},
+		{npm, openRepo, "https://github.com/lodash/lodash"},
+		{npm, openIssues, "https://github.com/lodash/lodash/issues"},
+		{pypi, openRepo, "https://github.com/psf/requests"},
+		{pypi, openIssues, "https://github.com/psf/requests/issues"},
+		{api.PkgInfo{SourceCodeURL: "https://gitlab.com/group/project"}, openHomepage, "https://gitlab.com/group/project"},
+		{api.PkgInfo{SourceCodeURL: "https://gitlab.com/group/project"}, openIssues, ""},
+		{api.PkgInfo{BugTrackerURL: "https://bugs.example.com"}, openIssues, "https://bugs.example.com"},
+	} {
+		actual, ok := openURL(test.info, test.target)
+		if actual != test.expected || ok != (test.expected != "") {
+			t.Errorf("%+v, %s: expected %q, got %q", test.info, test.target, test.expected, actual)
+		}
+	}
+}
+
+func TestBrowserCmd(t *testing.T) {
+	t.Setenv("BROWSER", "firefox --new-tab:chromium")
+	if cmd := browserCmd("https://lodash.com/"); !reflect.DeepEqual(cmd, []string{"firefox", "--new-tab", "https://lodash.com/"}) {
+		t.Errorf("unexpected command %q", cmd)
+	}
+	t.Setenv("BROWSER", "w3m '%s'")
+	if cmd := browserCmd("https://lodash.com/"); !reflect.DeepEqual(cmd, []string{"w3m", "https://lodash.com/"}) {
+		t.Errorf("unexpected command %q", cmd)
+	}
+}
@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/backends"
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/store"
+	"github.com/replit/upm/internal/trace"
+	"github.com/replit/upm/internal/util"
+)
+
+// overrideSpecs returns the overrides named by args, which are
+// PACKAGE@SPEC in any of the spellings that 'upm add' accepts, by the
+// names they are given.
+func overrideSpecs(b api.LanguageBackend, args []string) map[api.PkgName]api.PkgSpec {
+	overrides := map[api.PkgName]api.PkgSpec{}
+	for _, coords := range b.NormalizePackageArgs(args) {
+		if coords.Spec == "" {
+			util.DieUsage("%s: expected PACKAGE@VERSION, as in %s@1.2.3", coords.Name, coords.Name)
+		}
+		if b.ValidatePackageName != nil {
+			if err := b.ValidatePackageName(api.PkgName(coords.Name)); err != nil {
+				util.DieConsistency("%s: %s", coords.Name, err)
+			}
+		}
+		if b.ValidateSpec != nil {
+			if err := b.ValidateSpec(coords.Spec); err != nil {
+				expected := ""
+				if b.SpecSyntax != "" {
+					expected = fmt.Sprintf(" (expected %s)", b.SpecSyntax)
+				}
+				util.DieConsistency("%s: invalid spec %q: %s%s", coords.Name, coords.Spec, err, expected)
+			}
+		}
+		overrides[api.PkgName(coords.Name)] = coords.Spec
+	}
+	return overrides
+}
+
+// runOverrideAdd implements 'upm override add', which forces packages
+// anywhere in the dependency graph to versions that satisfy the given
+// specs, then locks and reports the locked versions that changed.
+func runOverrideAdd(language string, args []string) {
+	span, ctx := trace.StartSpanFromExistingContext("runOverrideAdd")
+	defer span.Finish()
+	defer beginProgress("lock", "install").end()
+	b := backends.GetBackend(ctx, language)
+	if b.SetOverride == nil {
+		dieUnsupported(b, "override")
+	}
+	if !util.Exists(b.Specfile) {
+		util.DieIO("%s: no such file", b.Specfile)
+	}
+	overrides := overrideSpecs(b, args)
+	ensureTools(b)
+	defer lockProject()()
+	t := beginTransaction(b)
+	defer t.end()
+
+	before := lockedVersions(b)
+	names := []api.PkgName{}
+	for name := range overrides {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	for _, name := range names {
+		util.Log(fmt.Sprintf("override %s: %s", name, overrides[name]))
+		b.SetOverride(name, overrides[name])
+	}
+
+	didLock := maybeLock(ctx, b, true)
+	if !(didLock && b.QuirksDoesLockAlsoInstall()) {
+		maybeInstall(ctx, b, true)
+	}
+
+	store.Read(ctx, b)
+	store.UpdateFileHashes(ctx, b)
+	store.Write(ctx)
+
+	if !config.DryRun {
+		printChanges(diffLockfile(before, lockedVersions(b)), b.Lockfile, "from the overrides", outputFormatTable)
+	}
+}
@@ -0,0 +1,154 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/util"
+)
+
+// isPackageFailure returns whether err, from adding packages, may be
+// the fault of one of them, such as a version conflict, rather than of
+// the network or a missing tool.
+func isPackageFailure(err error) bool {
+	var dieErr *util.Error
+	if !errors.As(err, &dieErr) {
+		return false
+	}
+	return dieErr.Code == util.ExitConflict || dieErr.Code == util.ExitSubprocess
+}
+
+// firstFailing returns the index in names of the package that makes
+// adding them fail, which try is known to: the last of the shortest
+// prefix of names that try fails to add, found by bisection. That
+// package fails either on its own or with the ones before it. Adding
+// more packages is assumed never to fix a failure. If try fails
+// otherwise than by the fault of a package, the bisection stops with
+// that error.
+func firstFailing(names []api.PkgName, try func(prefix []api.PkgName) error) (int, error) {
+	// The shortest failing prefix is between lo and hi long.
+	lo, hi := 1, len(names)
+	for lo < hi {
+		mid := (lo + hi) / 2
+		err := try(names[:mid])
+		if err == nil {
+			lo = mid + 1
+		} else if isPackageFailure(err) {
+			hi = mid
+		} else {
+			return -1, err
+		}
+	}
+	return hi - 1, nil
+}
+
+// joinNames returns names, joined by commas.
+func joinNames(names []api.PkgName) string {
+	strs := []string{}
+	for _, name := range names {
+		strs = append(strs, string(name))
+	}
+	return strings.Join(strs, ", ")
+}
+
+// addPackages adds pkgs with b.Add, and returns the packages that were
+// left out. Package managers add packages all at once, or fail without
+// saying which one is at fault, so if adding several fails because of
+// a package, the specfile and lockfile are put back as t saved them and
+// the package is found by adding fewer. It is then reported, or with
+// partial, left out and the others added, which can take several
+// rounds. This needs t to be able to put the files back, so it does not
+// happen with --no-rollback or --dry-run.
+func addPackages(ctx context.Context, b api.LanguageBackend, t *transaction, pkgs map[api.PkgName]api.PkgSpec, projectName string, partial bool) []api.PkgName {
+	add := func(names []api.PkgName) error {
+		return util.Catch(func() {
+			if b.QuirksDoesAddRequireInit() && !util.Exists(b.Specfile) {
+				b.Init(ctx, api.ProjectMetadata{Name: projectName})
+			}
+			// Add may rename the packages in the map it is
+			// given, as the Python backends do.
+			subset := map[api.PkgName]api.PkgSpec{}
+			for _, name := range names {
+				subset[name] = pkgs[name]
+			}
+			b.Add(ctx, subset, projectName)
+		})
+	}
+
+	names := []api.PkgName{}
+	for name := range pkgs {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return names[i] < names[j]
+	})
+	err := add(names)
+	if err == nil {
+		return nil
+	}
+	if len(names) < 2 || config.DryRun || !isPackageFailure(err) || !t.reset() {
+		panic(err)
+	}
+
+	leftOut := []api.PkgName{}
+	for err != nil {
+		util.Log(fmt.Sprintf("adding %s failed; adding fewer at a time to find which package is at fault", joinNames(names)))
+		s := silenceSubroutines()
+		i, tryErr := firstFailing(names, func(prefix []api.PkgName) error {
+			t.reset()
+			return add(prefix)
+		})
+		s.restore()
+		t.reset()
+		if tryErr != nil {
+			panic(tryErr)
+		}
+
+		culprit := names[i]
+		reason := ""
+		if i > 0 {
+			reason = fmt.Sprintf(" together with %s", joinNames(names[:i]))
+		}
+		if !partial {
+			code := util.ExitConflict
+			var dieErr *util.Error
+			if errors.As(err, &dieErr) {
+				code = dieErr.Code
+			}
+			panic(&util.Error{Code: code, Msg: fmt.Sprintf("%s cannot be added%s; use --partial to add the other packages without it", culprit, reason)})
+		}
+		util.LogError(fmt.Sprintf("leaving out %s, which cannot be added%s", culprit, reason))
+		leftOut = append(leftOut, culprit)
+		names = append(names[:i:i], names[i+1:]...)
+		err = add(names)
+		if err != nil && (len(names) < 2 || !isPackageFailure(err)) {
+			panic(err)
+		}
+		if err != nil {
+			t.reset()
+		}
+	}
+	return leftOut
+}
+
+// dropPackages removes the packages of leftOut, which addPackages left
+// out, from normPkgs, and returns names without them.
+func dropPackages(b api.LanguageBackend, names []api.PkgName, normPkgs map[api.PkgName]api.PkgCoordinates, leftOut []api.PkgName) []api.PkgName {
+	dropped := map[api.PkgName]bool{}
+	for _, name := range leftOut {
+		dropped[b.NormalizePackageName(name)] = true
+		delete(normPkgs, b.NormalizePackageName(name))
+	}
+	kept := []api.PkgName{}
+	for _, name := range names {
+		if !dropped[b.NormalizePackageName(name)] {
+			kept = append(kept, name)
+		}
+	}
+	return kept
+}
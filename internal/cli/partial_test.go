@@ -0,0 +1,114 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/util"
+)
+
+func TestFirstFailing(t *testing.T) {
+	names := []api.PkgName{"a", "b", "c", "d", "e", "f"}
+	for _, test := range []struct {
+		fails    func(prefix []api.PkgName) bool
+		expected int
+	}{
+		// c fails on its own.
+		{func(prefix []api.PkgName) bool { return len(prefix) > 2 }, 2},
+		// f conflicts with a.
+		{func(prefix []api.PkgName) bool { return len(prefix) > 5 }, 5},
+		{func(prefix []api.PkgName) bool { return true }, 0},
+	} {
+		tries := 0
+		i, err := firstFailing(names, func(prefix []api.PkgName) error {
+			tries++
+			if test.fails(prefix) {
+				return &util.Error{Code: util.ExitConflict}
+			}
+			return nil
+		})
+		if err != nil || i != test.expected {
+			t.Errorf("expected %d, got %d, %v", test.expected, i, err)
+		}
+		if tries > 3 {
+			t.Errorf("expected at most 3 tries, got %d", tries)
+		}
+	}
+
+	_, err := firstFailing(names, func(prefix []api.PkgName) error {
+		return &util.Error{Code: util.ExitNetwork}
+	})
+	if err == nil {
+		t.Error("expected a network error to stop the bisection")
+	}
+}
+
+func TestAddPackages(t *testing.T) {
+	dir := t.TempDir()
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Chdir(cwd) }()
+	defer func(quiet bool) { config.Quiet = quiet }(config.Quiet)
+	config.Quiet = true
+
+	// The package manager adds packages to the specfile all at once,
+	// and fails for "broken", or for both "flask" and "old-werkzeug".
+	b := api.LanguageBackend{
+		Specfile: "spec",
+		Add: func(ctx context.Context, pkgs map[api.PkgName]api.PkgSpec, projectName string) {
+			if _, ok := pkgs["broken"]; ok {
+				util.DieSubprocess("exit status 1")
+			}
+			_, flask := pkgs["flask"]
+			if _, old := pkgs["old-werkzeug"]; old && flask {
+				util.DieConflict("conflict")
+			}
+			names := []string{}
+			for name := range pkgs {
+				names = append(names, string(name))
+			}
+			sort.Strings(names)
+			util.TryWriteAtomic("spec", []byte(strings.Join(names, "\n")))
+		},
+	}
+	pkgs := map[api.PkgName]api.PkgSpec{"broken": "", "flask": "", "old-werkzeug": "", "requests": ""}
+
+	err = util.Catch(func() {
+		txn := beginTransaction(b)
+		defer txn.end()
+		addPackages(context.Background(), b, txn, pkgs, "", false)
+	})
+	if err == nil || !strings.Contains(err.Error(), "broken cannot be added") {
+		t.Errorf("expected broken to be reported, got %v", err)
+	}
+	if util.Exists("spec") {
+		t.Error("expected spec to be rolled back")
+	}
+
+	var leftOut []api.PkgName
+	err = util.Catch(func() {
+		txn := beginTransaction(b)
+		defer txn.end()
+		leftOut = addPackages(context.Background(), b, txn, pkgs, "", true)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []api.PkgName{"broken", "old-werkzeug"}; !reflect.DeepEqual(leftOut, expected) {
+		t.Errorf("expected %v to be left out, got %v", expected, leftOut)
+	}
+	if contents, _ := os.ReadFile("spec"); string(contents) != "flask\nrequests" {
+		t.Errorf("expected the others to be added, got %q", contents)
+	}
+}
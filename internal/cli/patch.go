@@ -0,0 +1,296 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/backends"
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/patches"
+	"github.com/replit/upm/internal/store"
+	"github.com/replit/upm/internal/trace"
+	"github.com/replit/upm/internal/util"
+)
+
+// patchWorkFile is the file in which 'upm patch' records what
+// 'upm patch-commit' needs to know, next to the directory in which a
+// package is edited.
+const patchWorkFile = "upm-patch.json"
+
+// patchWork is the contents of patchWorkFile.
+type patchWork struct {
+	Language string         `json:"language"`
+	Project  string         `json:"project"`
+	Name     api.PkgName    `json:"name"`
+	Version  api.PkgVersion `json:"version"`
+
+	// The package's directory, slash-separated and relative to
+	// the project directory.
+	Dir string `json:"dir"`
+}
+
+// copyFile copies the regular file from to to, creating the
+// directories of to.
+func copyFile(from, to string) error {
+	in, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if err := os.MkdirAll(filepath.Dir(to), 0o755); err != nil {
+		return err
+	}
+	out, err := os.Create(to)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// installedPackage returns the installed package name of b, and its
+// directory relative to the project directory.
+func installedPackage(b api.LanguageBackend, name api.PkgName) (api.InstalledPackage, string) {
+	pkg, ok := b.InstalledFiles(b.GetPackageDir(), name)
+	if !ok {
+		util.DieConsistency("%s is not installed; run 'upm install' first", name)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		util.DieIO("%s", err)
+	}
+	dir, err := filepath.Abs(pkg.Dir)
+	if err != nil {
+		util.DieIO("%s", err)
+	}
+	rel, err := filepath.Rel(wd, dir)
+	if err != nil || !filepath.IsLocal(rel) {
+		util.DieUnimplemented("%s is installed outside the project, in %s, where upm cannot patch it", name, pkg.Dir)
+	}
+	return pkg, filepath.ToSlash(rel)
+}
+
+// runPatch implements 'upm patch', which copies the installed package
+// to a temporary directory to be edited. 'upm patch-commit' then
+// records the changes.
+func runPatch(language string, arg string) {
+	span, ctx := trace.StartSpanFromExistingContext("runPatch")
+	defer span.Finish()
+	b := backends.GetBackend(ctx, language)
+	if b.InstalledFiles == nil {
+		dieUnsupported(b, "patch")
+	}
+	name := b.NormalizePackageName(api.PkgName(arg))
+	pkg, dir := installedPackage(b, name)
+
+	work, err := os.MkdirTemp("", "upm-patch-")
+	if err != nil {
+		util.DieIO("%s", err)
+	}
+	// The original files keep their paths in the project, so that
+	// an existing patch can be reverted in them.
+	original := filepath.Join(work, "original")
+	edit := filepath.Join(work, "edit")
+	for _, file := range pkg.Files {
+		from := filepath.Join(pkg.Dir, filepath.FromSlash(file))
+		for _, to := range []string{
+			filepath.Join(original, filepath.FromSlash(dir), filepath.FromSlash(file)),
+			filepath.Join(edit, filepath.FromSlash(file)),
+		} {
+			if err := copyFile(from, to); err != nil {
+				util.DieIO("%s", err)
+			}
+		}
+	}
+
+	// The installed package has the existing patch applied, which
+	// the new one replaces.
+	existing := filepath.Join(patches.Dir, patches.FileName(name, pkg.Version))
+	if contentsB, err := os.ReadFile(existing); err == nil {
+		if err := patches.Revert(original, string(contentsB)); err != nil {
+			util.DieConsistency("%s is not applied to %s: %s; run 'upm install' first", existing, name, err)
+		}
+	} else if !os.IsNotExist(err) {
+		util.DieIO("%s", err)
+	}
+
+	project, err := os.Getwd()
+	if err != nil {
+		util.DieIO("%s", err)
+	}
+	outputB, err := json.MarshalIndent(patchWork{
+		Language: b.Name,
+		Project:  project,
+		Name:     name,
+		Version:  pkg.Version,
+		Dir:      dir,
+	}, "", "  ")
+	if err != nil {
+		panic("couldn't marshal json")
+	}
+	if err := os.WriteFile(filepath.Join(work, patchWorkFile), outputB, 0o644); err != nil {
+		util.DieIO("%s", err)
+	}
+
+	util.Log(fmt.Sprintf("edit %s %s in the directory below, then run 'upm patch-commit %s'", name, pkg.Version, edit))
+	fmt.Println(edit)
+}
+
+// readPatchWork reads what 'upm patch' recorded for the directory edit
+// that it printed.
+func readPatchWork(edit string) patchWork {
+	path := filepath.Join(edit, "..", patchWorkFile)
+	contentsB, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		util.DieUsage("%s is not a directory printed by 'upm patch'", edit)
+	} else if err != nil {
+		util.DieIO("%s", err)
+	}
+	var work patchWork
+	if err := json.Unmarshal(contentsB, &work); err != nil {
+		util.DieProtocol("%s: %s", path, err)
+	}
+	return work
+}
+
+// runPatchCommit implements 'upm patch-commit', which records the
+// changes made in the directory edit that 'upm patch' printed as a
+// patch in .upm/patches, and applies it to the installed package.
+func runPatchCommit(edit string) {
+	span, ctx := trace.StartSpanFromExistingContext("runPatchCommit")
+	defer span.Finish()
+	defer beginProgress("lock", "install").end()
+	edit, err := filepath.Abs(edit)
+	if err != nil {
+		util.DieIO("%s", err)
+	}
+	work := readPatchWork(edit)
+	if wd, err := os.Getwd(); err != nil {
+		util.DieIO("%s", err)
+	} else if wd != work.Project {
+		util.DieUsage("%s was patched in %s; run 'upm patch-commit' there", work.Name, work.Project)
+	}
+	b := backends.GetBackend(ctx, work.Language)
+	if b.SetupPatches != nil {
+		ensureTools(b)
+	}
+	defer lockProject()()
+	t := beginTransaction(b)
+	defer t.end()
+
+	original := filepath.Join(edit, "..", "original", filepath.FromSlash(work.Dir))
+	patch, err := patches.Diff(original, edit, work.Dir)
+	if err != nil {
+		util.DieIO("%s", err)
+	}
+	path := filepath.Join(patches.Dir, patches.FileName(work.Name, work.Version))
+	var existing string
+	if contentsB, err := os.ReadFile(path); err == nil {
+		existing = string(contentsB)
+	} else if !os.IsNotExist(err) {
+		util.DieIO("%s", err)
+	}
+	if patch == existing {
+		util.Log(fmt.Sprintf("%s is unchanged", path))
+		return
+	}
+
+	if config.DryRun {
+		if patch == "" {
+			fmt.Println("would delete " + path)
+		} else {
+			util.TryWriteAtomic(path, []byte(patch))
+		}
+		return
+	}
+	// The package manager is set up first, so that nothing is
+	// written if that fails.
+	if patch != "" && b.SetupPatches != nil {
+		b.SetupPatches(patches.Dir)
+		didLock := maybeLock(ctx, b, false)
+		if !(didLock && b.QuirksDoesLockAlsoInstall()) {
+			maybeInstall(ctx, b, false)
+		}
+	}
+	if existing != "" && patches.IsApplied(".", existing) {
+		if err := patches.Revert(".", existing); err != nil {
+			util.DieConsistency("%s: %s", path, err)
+		}
+	}
+	if patch == "" {
+		// Every change was undone.
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			util.DieIO("%s", err)
+		}
+		util.Log(fmt.Sprintf("deleted %s", path))
+	} else {
+		if err := os.MkdirAll(patches.Dir, 0o755); err != nil {
+			util.DieIO("%s", err)
+		}
+		util.TryWriteAtomic(path, []byte(patch))
+		if err := patches.Apply(".", patch); err != nil {
+			util.DieConsistency("%s: %s", path, err)
+		}
+		util.Log(fmt.Sprintf("wrote %s and applied it to %s", path, work.Name))
+	}
+
+	store.Read(ctx, b)
+	store.UpdateFileHashes(ctx, b)
+	store.Write(ctx)
+
+	if err := os.RemoveAll(filepath.Join(edit, "..")); err != nil {
+		util.DieIO("%s", err)
+	}
+}
+
+// applyPatches applies the patches in .upm/patches to the installed
+// packages of b that they were made for, unless the package manager
+// applies them itself. A patch of another version than the installed
+// one is reported, since it has to be made again.
+func applyPatches(b api.LanguageBackend) {
+	if b.InstalledFiles == nil || b.SetupPatches != nil || config.DryRun {
+		return
+	}
+	entries, err := os.ReadDir(patches.Dir)
+	if os.IsNotExist(err) {
+		return
+	} else if err != nil {
+		util.DieIO("%s", err)
+	}
+	for _, entry := range entries {
+		name, version, ok := patches.ParseFileName(entry.Name())
+		if !ok {
+			continue
+		}
+		// The patches of other languages' packages are left
+		// alone.
+		pkg, ok := b.InstalledFiles(b.GetPackageDir(), name)
+		if !ok {
+			continue
+		}
+		path := filepath.Join(patches.Dir, entry.Name())
+		if pkg.Version != version {
+			util.LogError(fmt.Sprintf("%s was made for %s %s, but %s is installed; run 'upm patch %s' to make it again",
+				path, name, version, pkg.Version, name))
+			continue
+		}
+		contentsB, err := os.ReadFile(path)
+		if err != nil {
+			util.DieIO("%s", err)
+		}
+		if patches.IsApplied(".", string(contentsB)) {
+			continue
+		}
+		if err := patches.Apply(".", string(contentsB)); err != nil {
+			util.DieConsistency("%s: %s", path, err)
+		}
+		util.ProgressMsg("apply " + path)
+	}
+}
@@ -0,0 +1,134 @@
+package cli
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/backends"
+	"github.com/replit/upm/internal/store"
+	"github.com/replit/upm/internal/trace"
+	"github.com/replit/upm/internal/util"
+)
+
+// pinnedVersions returns the versions of the packages of b that 'upm
+// pin' pins them to, by normalized name: the locked versions, or the
+// installed ones for backends without a lockfile.
+func pinnedVersions(b api.LanguageBackend) map[api.PkgName]api.PkgVersion {
+	var listed map[api.PkgName]api.PkgVersion
+	if b.QuirksIsNotReproducible() {
+		if b.ListInstalled == nil {
+			util.DieUnimplemented("%s has no lockfile, and cannot list the installed packages", b.Name)
+		}
+		listed = b.ListInstalled(b.GetPackageDir())
+	} else {
+		if !util.Exists(b.Lockfile) {
+			util.DieStaleLockfile("%s is missing; run 'upm lock' first", b.Lockfile)
+		}
+		listed = b.ListLockfile()
+	}
+	pinned := map[api.PkgName]api.PkgVersion{}
+	for name, version := range listed {
+		pinned[b.NormalizePackageName(name)] = version
+	}
+	return pinned
+}
+
+// pinSpecs returns the new specs of the packages named by args, as
+// they are spelled in specfilePkgs, for the versions in pinned as
+// policy allows them. Packages that
+// come from somewhere else than the registry, and those whose spec
+// would not change, are left out.
+func pinSpecs(b api.LanguageBackend, specfilePkgs api.PkgDeps, pinned map[api.PkgName]api.PkgVersion, args []string, policy api.SpecPolicy) map[api.PkgName]api.PkgSpec {
+	normSpecfilePkgs := map[api.PkgName]api.PkgName{}
+	candidates := []string{}
+	for name := range specfilePkgs {
+		normSpecfilePkgs[b.NormalizePackageName(name)] = name
+		candidates = append(candidates, string(name))
+	}
+	sort.Strings(candidates)
+
+	specs := map[api.PkgName]api.PkgSpec{}
+	for _, arg := range args {
+		norm := b.NormalizePackageName(api.PkgName(arg))
+		name, ok := normSpecfilePkgs[norm]
+		if !ok {
+			util.DieConsistency("%s is not in %s%s", arg, b.Specfile, didYouMean(arg, candidates))
+		}
+		current := specfilePkgs[name].Spec
+		if source, ok := b.SourceOfSpec(current); ok {
+			util.Log(fmt.Sprintf("%s comes from %s, not the registry, so it is left alone", name, source))
+			continue
+		}
+		version, ok := pinned[norm]
+		if !ok && b.QuirksIsNotReproducible() {
+			util.DieStaleLockfile("%s is not installed; run 'upm install' first", name)
+		} else if !ok {
+			util.DieStaleLockfile("%s has no version of %s; run 'upm lock' first", b.Lockfile, name)
+		}
+		spec, err := b.PinSpec(version, policy)
+		if err != nil {
+			util.DieProtocol("%s: cannot pin to %s: %s", name, version, err)
+		}
+		if spec == current {
+			util.Log(fmt.Sprintf("%s is already %s", name, spec))
+			continue
+		}
+		specs[name] = spec
+	}
+	return specs
+}
+
+// runPin implements 'upm pin', which rewrites the specs of packages to
+// their locked versions, and, with compatible, 'upm unpin', which
+// rewrites them to the ranges of the versions compatible with those.
+func runPin(language string, args []string, compatible bool) {
+	span, ctx := trace.StartSpanFromExistingContext("runPin")
+	defer span.Finish()
+	defer beginProgress("lock").end()
+	b := backends.GetBackend(ctx, language)
+	if b.PinSpec == nil || b.SetSpecs == nil {
+		util.DieUnimplemented("%s cannot pin packages", b.Name)
+	}
+	if !util.Exists(b.Specfile) {
+		util.DieIO("%s: no such file", b.Specfile)
+	}
+	ensureTools(b)
+	defer lockProject()()
+	t := beginTransaction(b)
+	defer t.end()
+
+	s := silenceSubroutines()
+	specfilePkgs := b.ListSpecfile(true)
+	pinned := pinnedVersions(b)
+	s.restore()
+
+	policy := api.SpecExact
+	if compatible {
+		policy = api.SpecCaret
+	}
+	specs := pinSpecs(b, specfilePkgs, pinned, args, policy)
+	if len(specs) == 0 {
+		return
+	}
+	names := []api.PkgName{}
+	for name := range specs {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	for _, name := range names {
+		util.Log(fmt.Sprintf("%s: %s -> %s", name, specfilePkgs[name].Spec, specs[name]))
+	}
+	b.SetSpecs(specs)
+
+	// The lockfile records the specs too, and the locked versions
+	// still satisfy the new ones, so this changes no versions.
+	if !b.QuirksIsNotReproducible() {
+		reportPhase("lock", names)
+		b.Lock(ctx)
+	}
+
+	store.Read(ctx, b)
+	store.UpdateFileHashes(ctx, b)
+	store.Write(ctx)
+}
@@ -0,0 +1,47 @@
+package cli
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+)
+
+func TestPinSpecs(t *testing.T) {
+	b := api.LanguageBackend{
+		Name:                 "test",
+		Specfile:             "spec",
+		Lockfile:             "lock",
+		FilenamePatterns:     []string{"*"},
+		NormalizePackageName: func(name api.PkgName) api.PkgName { return api.PkgName(strings.ToLower(string(name))) },
+		SourceOfSpec: func(spec api.PkgSpec) (api.PkgSource, bool) {
+			location := strings.TrimPrefix(string(spec), "git+")
+			return api.PkgSource{Kind: api.SourceGit, Location: location}, location != string(spec)
+		},
+		PinSpec: func(version api.PkgVersion, policy api.SpecPolicy) (api.PkgSpec, error) {
+			if policy == api.SpecCaret {
+				return api.PkgSpec("^" + version), nil
+			}
+			return api.PkgSpec(version), nil
+		},
+	}
+	specfilePkgs := api.PkgDeps{
+		"Flask":    {Spec: "^3.0.0"},
+		"left-pad": {Spec: "1.3.0"},
+		"mine":     {Spec: "git+https://example.com/mine.git"},
+	}
+	pinned := map[api.PkgName]api.PkgVersion{"flask": "3.0.2", "left-pad": "1.3.0", "mine": "0.1.0"}
+
+	specs := pinSpecs(b, specfilePkgs, pinned, []string{"flask", "left-pad", "mine"}, api.SpecExact)
+	expected := map[api.PkgName]api.PkgSpec{"Flask": "3.0.2"}
+	if !reflect.DeepEqual(specs, expected) {
+		t.Errorf("expected %v, got %v", expected, specs)
+	}
+
+	specs = pinSpecs(b, specfilePkgs, pinned, []string{"flask", "left-pad"}, api.SpecCaret)
+	expected = map[api.PkgName]api.PkgSpec{"Flask": "^3.0.2", "left-pad": "^1.3.0"}
+	if !reflect.DeepEqual(specs, expected) {
+		t.Errorf("expected %v, got %v", expected, specs)
+	}
+}
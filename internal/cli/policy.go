@@ -0,0 +1,161 @@
+package cli
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/policy"
+	"github.com/replit/upm/internal/util"
+)
+
+// loadPolicies returns the policies the project must follow: that of
+// the organization configuration file, and then its own policy file,
+// either of which may be missing.
+func loadPolicies() []*policy.Policy {
+	policies := []*policy.Policy{}
+	if config.Loaded.Policy != nil {
+		policies = append(policies, config.Loaded.Policy)
+	}
+	p, err := policy.Load(policy.File)
+	if err != nil {
+		util.DieIO("%s", err)
+	}
+	if p != nil {
+		policies = append(policies, p)
+	}
+	return policies
+}
+
+// policyOrigins returns where policies come from, for messages.
+func policyOrigins(policies []*policy.Policy) string {
+	origins := []string{}
+	for _, p := range policies {
+		origins = append(origins, p.Origin)
+	}
+	return strings.Join(origins, " and ")
+}
+
+// checkNames returns the violations of the Allow and Block rules of p
+// by the named packages, which match a pattern if either their name or
+// its normalized form does, without Python extras.
+func checkNames(b api.LanguageBackend, p *policy.Policy, names []api.PkgName) []policy.Violation {
+	violations := []policy.Violation{}
+	for _, name := range names {
+		base := api.PkgName(strings.SplitN(string(name), "[", 2)[0])
+		violations = append(violations, p.CheckName(string(name), string(base), string(b.NormalizePackageName(base)))...)
+	}
+	return violations
+}
+
+// checkLicenses returns the violations of the BannedLicenses rule of p
+// by the named packages, with the licenses the index of b gives for
+// them. Packages whose license cannot be looked up are skipped.
+func checkLicenses(b api.LanguageBackend, p *policy.Policy, names []api.PkgName) []policy.Violation {
+	if len(p.BannedLicenses) == 0 || b.Info == nil || len(names) == 0 {
+		return nil
+	}
+	// Python extras, as in flask[async], are not part of the
+	// name in the index.
+	lookup := []api.PkgName{}
+	for _, name := range names {
+		lookup = append(lookup, api.PkgName(strings.SplitN(string(name), "[", 2)[0]))
+	}
+	s := silenceSubroutines()
+	infos, errs := lookupInfos(b, lookup)
+	s.restore()
+
+	violations := []policy.Violation{}
+	for i, name := range names {
+		if errs[i] != nil {
+			util.Verbosef("could not check the license of %s: %s", name, errs[i])
+			continue
+		}
+		violations = append(violations, p.CheckLicense(string(name), infos[i].License)...)
+	}
+	return violations
+}
+
+// enforcePolicy dies if adding pkgs, of which those in sourcePkgs do
+// not come from the registry, would break a policy of the project.
+// The limit on locked packages is left to 'upm check --policy', since
+// the lockfile is not known until after the packages are added.
+func enforcePolicy(b api.LanguageBackend, pkgs map[api.PkgName]api.PkgCoordinates, sourcePkgs map[api.PkgName]api.PkgCoordinates) {
+	policies := loadPolicies()
+	if len(policies) == 0 || len(pkgs) == 0 {
+		return
+	}
+	names, registry := []api.PkgName{}, []api.PkgName{}
+	for norm, coords := range pkgs {
+		names = append(names, api.PkgName(coords.Name))
+		if _, ok := sourcePkgs[norm]; !ok {
+			registry = append(registry, api.PkgName(coords.Name))
+		}
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	sort.Slice(registry, func(i, j int) bool { return registry[i] < registry[j] })
+
+	deps := map[api.PkgName]bool{}
+	if util.Exists(b.Specfile) {
+		s := silenceSubroutines()
+		for name := range b.ListSpecfile(true) {
+			deps[b.NormalizePackageName(name)] = true
+		}
+		s.restore()
+	}
+	for norm := range pkgs {
+		deps[norm] = true
+	}
+
+	for _, p := range policies {
+		violations := checkNames(b, p, names)
+		if len(violations) == 0 {
+			violations = checkLicenses(b, p, registry)
+		}
+		violations = append(violations, p.CheckCounts(len(deps), -1)...)
+		if len(violations) > 0 {
+			lines := []string{}
+			for _, violation := range violations {
+				lines = append(lines, "  "+violation.String())
+			}
+			util.DieConsistency("adding these packages would break the policy in %s:\n%s", p.Origin, strings.Join(lines, "\n"))
+		}
+	}
+}
+
+// checkPolicy returns the violations of policies by the packages in
+// the specfile and lockfile, for 'upm check --policy'.
+func checkPolicy(b api.LanguageBackend, policies []*policy.Policy) []checkIssue {
+	specs := b.ListSpecfile(true)
+	locked := b.ListLockfile()
+
+	all := map[api.PkgName]api.PkgName{}
+	for name := range specs {
+		all[b.NormalizePackageName(name)] = name
+	}
+	for name := range locked {
+		all[b.NormalizePackageName(name)] = name
+	}
+	names := []api.PkgName{}
+	for _, name := range all {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+
+	issues := []checkIssue{}
+	for _, p := range policies {
+		violations := checkNames(b, p, names)
+		violations = append(violations, checkLicenses(b, p, names)...)
+		violations = append(violations, p.CheckCounts(len(specs), len(locked))...)
+		for _, violation := range violations {
+			issues = append(issues, checkIssue{
+				Kind:   violation.Kind,
+				Name:   violation.Name,
+				Detail: violation.Detail,
+				Policy: p.Origin,
+			})
+		}
+	}
+	return issues
+}
@@ -0,0 +1,146 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/util"
+)
+
+// githubRepository is what the GitHub API says about a repository.
+type githubRepository struct {
+	StargazersCount int64 `json:"stargazers_count"`
+
+	// The number of open issues and pull requests, which GitHub
+	// counts together.
+	OpenIssuesCount int64 `json:"open_issues_count"`
+
+	Archived bool `json:"archived"`
+}
+
+// githubRepositories caches lookupGithubRepository, since 'upm info'
+// looks up the same repository for several of its fields.
+var (
+	githubRepositories   = map[string]*githubRepository{}
+	githubRepositoriesMu sync.Mutex
+)
+
+// lookupGithubRepository returns what the GitHub API says about a
+// repository, or nil if there is no such repository.
+func lookupGithubRepository(owner, repo string) *githubRepository {
+	url := fmt.Sprintf("%s/repos/%s/%s", githubAPI, owner, repo)
+	githubRepositoriesMu.Lock()
+	cached, ok := githubRepositories[url]
+	githubRepositoriesMu.Unlock()
+	if ok {
+		return cached
+	}
+	var repository *githubRepository
+	if body, ok := githubGet(url); ok {
+		repository = &githubRepository{}
+		if err := json.Unmarshal(body, repository); err != nil {
+			util.DieProtocol("%s: %s", url, err)
+		}
+	}
+	githubRepositoriesMu.Lock()
+	githubRepositories[url] = repository
+	githubRepositoriesMu.Unlock()
+	return repository
+}
+
+// infoGithubRepo returns the owner and name of the GitHub repository of
+// a package, from its source code or home page URL, if either is one.
+func infoGithubRepo(info api.PkgInfo) (string, string, bool) {
+	for _, url := range []string{info.SourceCodeURL, info.HomepageURL} {
+		if owner, repo, ok := githubRepo(url); ok {
+			return owner, repo, true
+		}
+	}
+	return "", "", false
+}
+
+// annotateStars fills in the Stars of infos whose source code or home
+// page is in a GitHub repository, looking them up concurrently.
+// Repositories that cannot be looked up, as when GitHub's rate limit
+// for anonymous requests is reached, are left at zero.
+func annotateStars(infos []api.PkgInfo) {
+	sem := make(chan struct{}, infoConcurrency)
+	var wg sync.WaitGroup
+	for i := range infos {
+		owner, repo, found := infoGithubRepo(infos[i])
+		if !found || infos[i].Stars != 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(info *api.PkgInfo) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			err := util.Catch(func() {
+				if repository := lookupGithubRepository(owner, repo); repository != nil {
+					info.Stars = repository.StargazersCount
+				}
+			})
+			if err != nil {
+				util.Verbosef("no GitHub stars for %s: %s", info.Name, err)
+			}
+		}(&infos[i])
+	}
+	wg.Wait()
+}
+
+// annotateInfo fills in the download count, GitHub stars and
+// deprecation that 'upm info' shows, which Info does not look up.
+func annotateInfo(b api.LanguageBackend, info *api.PkgInfo) {
+	infos := []api.PkgInfo{*info}
+	if b.AnnotateSearch != nil {
+		b.AnnotateSearch(infos, api.SortDownloads)
+	}
+	annotateStars(infos)
+	*info = infos[0]
+	if b.ListDeprecated != nil && info.Version != "" {
+		deprecations := lookupDeprecations(b, map[api.PkgName]api.PkgVersion{api.PkgName(info.Name): api.PkgVersion(info.Version)})
+		if d, ok := deprecations[api.PkgName(info.Name)]; ok {
+			info.Deprecated = deprecationText(d)
+		}
+	}
+}
+
+// rankGuesses orders the packages that provide each guessed module
+// from the most downloaded to the least, for the by_downloads setting
+// of [guess]. Download counts come from b.PopularPackages where it
+// has them, and otherwise from the index; packages with the same count
+// keep their order.
+func rankGuesses(b api.LanguageBackend, guessed map[string][]api.PkgName) {
+	downloads := map[api.PkgName]int64{}
+	if b.PopularPackages != nil {
+		for name, count := range b.PopularPackages() {
+			downloads[b.NormalizePackageName(name)] = count
+		}
+	}
+	lookup := []api.PkgInfo{}
+	for _, names := range guessed {
+		if len(names) < 2 {
+			continue
+		}
+		for _, name := range names {
+			if _, ok := downloads[b.NormalizePackageName(name)]; !ok {
+				lookup = append(lookup, api.PkgInfo{Name: string(name)})
+			}
+		}
+	}
+	if len(lookup) > 0 && b.AnnotateSearch != nil {
+		b.AnnotateSearch(lookup, api.SortDownloads)
+	}
+	for _, info := range lookup {
+		downloads[b.NormalizePackageName(api.PkgName(info.Name))] = info.Downloads
+	}
+	for _, names := range guessed {
+		sort.SliceStable(names, func(i, j int) bool {
+			return downloads[b.NormalizePackageName(names[i])] > downloads[b.NormalizePackageName(names[j])]
+		})
+	}
+}
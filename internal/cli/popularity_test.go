@@ -0,0 +1,77 @@
+package cli
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+)
+
+func TestAnnotateStars(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/pallets/flask":
+			w.Write([]byte(`{"full_name": "pallets/flask", "stargazers_count": 68000}`))
+		case "/repos/limited/repo":
+			http.Error(w, "rate limit exceeded", http.StatusForbidden)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	defer func(api string) { githubAPI = api }(githubAPI)
+	githubAPI = server.URL
+
+	infos := []api.PkgInfo{
+		{Name: "flask", SourceCodeURL: "https://github.com/pallets/flask"},
+		{Name: "home", HomepageURL: "https://github.com/pallets/flask#readme"},
+		{Name: "limited", SourceCodeURL: "https://github.com/limited/repo"},
+		{Name: "missing", SourceCodeURL: "https://github.com/missing/repo"},
+		{Name: "gitlab", SourceCodeURL: "https://gitlab.com/user/repo"},
+	}
+	annotateStars(infos)
+	stars := []int64{}
+	for _, info := range infos {
+		stars = append(stars, info.Stars)
+	}
+	if expected := []int64{68000, 68000, 0, 0, 0}; !reflect.DeepEqual(stars, expected) {
+		t.Errorf("expected stars %v, got %v", expected, stars)
+	}
+}
+
+func TestRankGuesses(t *testing.T) {
+	looked := []string{}
+	b := api.LanguageBackend{
+		NormalizePackageName: func(name api.PkgName) api.PkgName { return name },
+		PopularPackages: func() map[api.PkgName]int64 {
+			return map[api.PkgName]int64{"pyjwt": 5000, "jwt": 100}
+		},
+		AnnotateSearch: func(results []api.PkgInfo, by api.SearchSort) {
+			for i := range results {
+				looked = append(looked, results[i].Name)
+				if results[i].Name == "edgar" {
+					results[i].Downloads = 300
+				}
+			}
+		},
+	}
+	guessed := map[string][]api.PkgName{
+		"jwt":      {"jwt", "pyjwt"},
+		"edgar":    {"edgartools", "edgar"},
+		"requests": {"requests"},
+	}
+	rankGuesses(b, guessed)
+	expected := map[string][]api.PkgName{
+		"jwt":      {"pyjwt", "jwt"},
+		"edgar":    {"edgar", "edgartools"},
+		"requests": {"requests"},
+	}
+	if !reflect.DeepEqual(guessed, expected) {
+		t.Errorf("expected %v, got %v", expected, guessed)
+	}
+	if expected := []string{"edgartools", "edgar"}; !reflect.DeepEqual(looked, expected) {
+		t.Errorf("expected only the packages missing from the popular ones to be looked up, got %v", looked)
+	}
+}
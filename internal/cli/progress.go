@@ -0,0 +1,124 @@
+package cli
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/util"
+)
+
+// progressEvent is a line of the NDJSON that --progress json writes.
+// Event is "phase" when UPM starts adding, removing, locking or
+// installing packages, "step", "output" or "message" for the
+// util.ProgressKind of the same name, and "done" or "error" at the
+// end.
+type progressEvent struct {
+	Event    string   `json:"event"`
+	Phase    string   `json:"phase,omitempty"`
+	Packages []string `json:"packages,omitempty"`
+
+	// Percent estimates how much of the command is done. It is
+	// set on the phase, done and error events.
+	Percent *int `json:"percent,omitempty"`
+
+	Message  string `json:"message,omitempty"`
+	ExitCode int    `json:"exitCode,omitempty"`
+}
+
+// progressReporter writes the progress of a command as NDJSON.
+type progressReporter struct {
+	mu      sync.Mutex
+	out     io.Writer
+	plan    []string
+	percent int
+	stop    func()
+}
+
+// activeProgress is the reporter of the running command, or nil if
+// progress is not reported as JSON.
+var activeProgress *progressReporter
+
+// beginProgress starts reporting progress as NDJSON on stdout, with
+// --progress json, for a command that goes through the phases of
+// plan. The caller must defer a call to end.
+func beginProgress(plan ...string) *progressReporter {
+	if !config.ProgressJSON {
+		return nil
+	}
+	p := newProgressReporter(os.Stdout, plan)
+	activeProgress = p
+	return p
+}
+
+// newProgressReporter returns a reporter that writes to out.
+func newProgressReporter(out io.Writer, plan []string) *progressReporter {
+	p := &progressReporter{out: out, plan: plan}
+	p.stop = util.OnProgress(func(kind util.ProgressKind, msg string) {
+		p.emit(progressEvent{Event: string(kind), Message: msg})
+	})
+	return p
+}
+
+// emit writes one event.
+func (p *progressReporter) emit(event progressEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	line, err := json.Marshal(event)
+	if err != nil {
+		panic(err)
+	}
+	_, _ = p.out.Write(append(line, '\n'))
+}
+
+// phase reports that a phase starts. The percentage is that of the
+// phases of the plan before it; a phase outside the plan keeps the
+// percentage as it is.
+func (p *progressReporter) phase(name string, pkgs []api.PkgName) {
+	if p == nil {
+		return
+	}
+	for i, planned := range p.plan {
+		if planned == name {
+			p.percent = 100 * i / len(p.plan)
+			break
+		}
+	}
+	names := []string{}
+	for _, pkg := range pkgs {
+		names = append(names, string(pkg))
+	}
+	sort.Strings(names)
+	percent := p.percent
+	p.emit(progressEvent{Event: "phase", Phase: name, Packages: names, Percent: &percent})
+}
+
+// end finishes reporting. It must be deferred: if the command is dying
+// with an error, an error event is written before the error continues
+// on its way; otherwise a done event is.
+func (p *progressReporter) end() {
+	if p == nil {
+		return
+	}
+	p.stop()
+	activeProgress = nil
+	if r := recover(); r != nil {
+		event := progressEvent{Event: "error", Percent: &p.percent}
+		if err, ok := r.(*util.Error); ok {
+			event.Message, event.ExitCode = err.Msg, int(err.Code)
+		}
+		p.emit(event)
+		panic(r)
+	}
+	percent := 100
+	p.emit(progressEvent{Event: "done", Percent: &percent})
+}
+
+// reportPhase reports that a phase of the running command starts.
+func reportPhase(name string, pkgs []api.PkgName) {
+	activeProgress.phase(name, pkgs)
+}
@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/util"
+)
+
+func TestProgressReporter(t *testing.T) {
+	defer func(quiet bool) { config.Quiet = quiet }(config.Quiet)
+	config.Quiet = true
+
+	var out bytes.Buffer
+	func() {
+		p := newProgressReporter(&out, []string{"add", "lock", "install"})
+		defer p.end()
+		p.phase("add", []api.PkgName{"requests", "flask"})
+		util.ProgressMsg("poetry add flask requests")
+		p.phase("install", nil)
+	}()
+
+	events := []progressEvent{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var event progressEvent
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, event)
+	}
+	percent := func(n int) *int { return &n }
+	expected := []progressEvent{
+		{Event: "phase", Phase: "add", Packages: []string{"flask", "requests"}, Percent: percent(0)},
+		{Event: "step", Message: "poetry add flask requests"},
+		{Event: "phase", Phase: "install", Percent: percent(66)},
+		{Event: "done", Percent: percent(100)},
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("expected %+v, got %+v", expected, events)
+	}
+}
+
+func TestProgressReporterError(t *testing.T) {
+	var out bytes.Buffer
+	err := util.Catch(func() {
+		p := newProgressReporter(&out, []string{"install"})
+		defer p.end()
+		util.DieSubprocess("exit status 1")
+	})
+	if err == nil {
+		t.Fatal("expected the error to continue on its way")
+	}
+	var event progressEvent
+	if err := json.Unmarshal(out.Bytes(), &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Event != "error" || event.Message != "exit status 1" || event.ExitCode != int(util.ExitSubprocess) {
+		t.Errorf("unexpected event %+v", event)
+	}
+}
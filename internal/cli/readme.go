@@ -0,0 +1,38 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/markdown"
+	"golang.org/x/term"
+)
+
+// useColor returns whether to style output with ANSI escape sequences:
+// only on a terminal, and not if the NO_COLOR convention asks not to.
+func useColor() bool {
+	return os.Getenv("NO_COLOR") == "" && term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+// renderReadme returns readme as text for a terminal. Only Markdown is
+// rendered; reStructuredText and plain text read well enough as they
+// are.
+func renderReadme(readme api.Readme, color bool) string {
+	if readme.Format == api.ReadmeMarkdown {
+		return markdown.Render(readme.Text, color)
+	}
+	return strings.Trim(strings.ReplaceAll(readme.Text, "\r\n", "\n"), "\n")
+}
+
+// printReadme prints the readme of a package, after the other
+// information of 'upm info'.
+func printReadme(name string, readme api.Readme) {
+	fmt.Println()
+	if strings.TrimSpace(readme.Text) == "" {
+		fmt.Printf("%s has no readme in the registry\n", name)
+		return
+	}
+	fmt.Println(renderReadme(readme, useColor()))
+}
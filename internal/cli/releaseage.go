@@ -0,0 +1,137 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/util"
+	"github.com/replit/upm/internal/versions"
+)
+
+// sortReleases sorts releases from the newest version to the oldest,
+// falling back to when they were published for versions that do not
+// compare.
+func sortReleases(releases []api.Release) {
+	sort.SliceStable(releases, func(i, j int) bool {
+		cmp, err := versions.Compare(string(releases[i].Version), string(releases[j].Version))
+		if err != nil {
+			return releases[i].Published.After(releases[j].Published)
+		}
+		return cmp > 0
+	})
+}
+
+// errUnknownSpec is returned by releaseAgePin for specs that are not
+// versions, such as npm dist-tags, which it cannot match releases
+// against.
+var errUnknownSpec = errors.New("the spec cannot be matched against versions")
+
+// releaseAgePin returns the newest of releases that matches spec, which
+// is the one the package manager would pick, and, if it was published
+// after cutoff, the newest matching one that was not, to pick instead.
+// Prereleases only count if no other release matches. It returns an
+// error if no release matches spec, or if none that does is old
+// enough, and errUnknownSpec if spec is not understood.
+func releaseAgePin(b api.LanguageBackend, releases []api.Release, spec api.PkgSpec, cutoff time.Time) (newest, pin api.Release, err error) {
+	matching, stable := []api.Release{}, []api.Release{}
+	understood := false
+	for _, release := range releases {
+		ok, err := b.MatchesSpec(spec, release.Version)
+		understood = understood || err == nil
+		if !ok {
+			continue
+		}
+		matching = append(matching, release)
+		if !versions.IsPrerelease(string(release.Version)) {
+			stable = append(stable, release)
+		}
+	}
+	if len(stable) > 0 {
+		matching = stable
+	}
+	if !understood && len(releases) > 0 {
+		return newest, pin, errUnknownSpec
+	}
+	if len(matching) == 0 {
+		return newest, pin, fmt.Errorf("no release matches %q", spec)
+	}
+	sortReleases(matching)
+	newest = matching[0]
+	if !newest.Published.After(cutoff) {
+		return newest, pin, nil
+	}
+	for _, release := range matching {
+		if !release.Published.After(cutoff) {
+			return newest, release, nil
+		}
+	}
+	return newest, pin, fmt.Errorf("no matching release was published before %s", cutoff.Format(time.RFC3339))
+}
+
+// applyMinReleaseAge pins the packages that 'upm add' is about to add
+// from the registry to the newest version matching their spec that is
+// older than min_release_age, if the version the package manager would
+// pick is newer, and dies if there is no such version. It does nothing
+// without min_release_age, and only warns if b cannot look up when
+// versions were published.
+func applyMinReleaseAge(b api.LanguageBackend, pkgs map[api.PkgName]api.PkgCoordinates, sourcePkgs map[api.PkgName]api.PkgCoordinates) {
+	if config.MinReleaseAge <= 0 {
+		return
+	}
+	norms := []api.PkgName{}
+	for norm := range pkgs {
+		if _, ok := sourcePkgs[norm]; !ok {
+			norms = append(norms, norm)
+		}
+	}
+	if len(norms) == 0 {
+		return
+	}
+	if b.ListReleases == nil {
+		util.LogError(fmt.Sprintf("%s cannot look up when versions were published, so min_release_age is not enforced", b.Name))
+		return
+	}
+	sort.Slice(norms, func(i, j int) bool {
+		return norms[i] < norms[j]
+	})
+
+	cutoff := config.ReleaseCutoff()
+	for _, norm := range norms {
+		coords := pkgs[norm]
+		// Python extras, as in flask[async], are not part of
+		// the name in the index.
+		name := api.PkgName(strings.SplitN(coords.Name, "[", 2)[0])
+		releases := b.ListReleases(name)
+		if releases == nil {
+			// The package does not exist, which the package
+			// manager reports better.
+			continue
+		}
+		newest, pin, err := releaseAgePin(b, releases, coords.Spec, cutoff)
+		if errors.Is(err, errUnknownSpec) {
+			util.LogError(fmt.Sprintf("%s: min_release_age is not enforced for the spec %q", coords.Name, coords.Spec))
+			continue
+		} else if err != nil {
+			util.DieConsistency("%s: cannot pick a version older than min_release_age (%s): %s", coords.Name, config.Loaded.MinReleaseAge, err)
+		}
+		if pin.Version == "" {
+			continue
+		}
+		util.Log(fmt.Sprintf("pinning %s to %s, since %s was published %s ago, less than min_release_age (%s)",
+			coords.Name, pin.Version, newest.Version, time.Since(newest.Published).Round(time.Minute), config.Loaded.MinReleaseAge))
+		// Keep Python extras that are part of the spec, as in
+		// "[async]>=2".
+		arg := coords.Name
+		if spec := string(coords.Spec); strings.HasPrefix(spec, "[") && strings.Contains(spec, "]") {
+			arg += spec[:strings.Index(spec, "]")+1]
+		}
+		for _, pinned := range b.NormalizePackageArgs([]string{arg + " " + string(pin.Version)}) {
+			pkgs[norm] = pinned
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package cli
+
+import (
+	"testing"
+	"time"
+
+	"github.com/replit/upm/internal/api"
+)
+
+func TestReleaseAgePin(t *testing.T) {
+	b := api.LanguageBackend{MatchesSpec: api.DefaultMatchesSpec}
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	cutoff := now.Add(-72 * time.Hour)
+	release := func(version string, age time.Duration) api.Release {
+		return api.Release{Version: api.PkgVersion(version), Published: now.Add(-age)}
+	}
+	releases := []api.Release{
+		release("1.0.0", 400*24*time.Hour),
+		release("1.1.0", 30*24*time.Hour),
+		release("2.0.0", 10*24*time.Hour),
+		// A backport, published after 2.0.0.
+		release("1.1.1", 5*24*time.Hour),
+		release("2.1.0-rc.1", 2*24*time.Hour),
+		release("2.0.1", time.Hour),
+	}
+
+	for _, test := range []struct {
+		spec           api.PkgSpec
+		newest, pinned api.PkgVersion
+		fails          bool
+	}{
+		{spec: "", newest: "2.0.1", pinned: "2.0.0"},
+		{spec: "< 2.0", newest: "1.1.1"},
+		{spec: "= 2.0.1", newest: "2.0.1", fails: true},
+		{spec: "> 3.0", fails: true},
+	} {
+		newest, pin, err := releaseAgePin(b, releases, test.spec, cutoff)
+		if (err != nil) != test.fails {
+			t.Errorf("releaseAgePin(%q): unexpected error %v", test.spec, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if newest.Version != test.newest || pin.Version != test.pinned {
+			t.Errorf("releaseAgePin(%q) = %s, %q; expected %s, %q", test.spec, newest.Version, pin.Version, test.newest, test.pinned)
+		}
+	}
+
+	if _, _, err := releaseAgePin(b, releases, "latest", cutoff); err != errUnknownSpec {
+		t.Errorf("expected a dist-tag not to be understood, got %v", err)
+	}
+}
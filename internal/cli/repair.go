@@ -0,0 +1,113 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/util"
+)
+
+// brokenSuffix is appended to the name of a broken lockfile to back it
+// up before 'upm lock --repair' replaces it.
+const brokenSuffix = ".broken"
+
+// hasConflictMarkers returns true if contents has a line that git
+// writes at the start of a merge conflict.
+func hasConflictMarkers(contents string) bool {
+	for _, line := range strings.Split(contents, "\n") {
+		if strings.HasPrefix(line, "<<<<<<< ") || line == "<<<<<<<" {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveConflicts resolves the merge conflicts in contents by keeping
+// our side of each, so that the packages locked before the merge keep
+// their versions when it is locked again. The base section that git
+// writes with merge.conflictStyle=diff3 is dropped, like theirs. It
+// returns false if a conflict is not closed.
+func resolveConflicts(contents string) (string, bool) {
+	const (
+		outside = iota
+		ours
+		other
+	)
+	state := outside
+	lines := []string{}
+	for _, line := range strings.Split(contents, "\n") {
+		switch {
+		case strings.HasPrefix(line, "<<<<<<<") && state == outside:
+			state = ours
+		case strings.HasPrefix(line, "|||||||") && state == ours:
+			state = other
+		case line == "=======" && state != outside:
+			state = other
+		case strings.HasPrefix(line, ">>>>>>>") && state == other:
+			state = outside
+		case state != other:
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n"), state == outside
+}
+
+// lockfileProblem returns why the lockfile of b is broken, or the
+// empty string if it parses.
+func lockfileProblem(b api.LanguageBackend, contents string) string {
+	if hasConflictMarkers(contents) {
+		return "it has merge conflict markers"
+	}
+	s := silenceSubroutines()
+	defer s.restore()
+	if err := util.Catch(func() { b.ListLockfile() }); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+// repairLockfile implements 'upm lock --repair' before locking: if the
+// lockfile of b is merge-conflicted or does not parse, it is backed up
+// next to itself, and then either resolved to our side of its
+// conflicts, or deleted if that does not parse either. It returns true
+// if the lockfile was broken, so that it is locked again in any case.
+func repairLockfile(ctx context.Context, b api.LanguageBackend) bool {
+	if b.QuirksIsNotReproducible() {
+		util.DieUnimplemented("%s has no lockfile to repair", b.Name)
+	}
+	contentsB, err := os.ReadFile(b.Lockfile)
+	if os.IsNotExist(err) {
+		return false
+	} else if err != nil {
+		util.DieIO("%s: %s", b.Lockfile, err)
+	}
+	contents := string(contentsB)
+	problem := lockfileProblem(b, contents)
+	if problem == "" {
+		util.Verbosef("%s is not broken", b.Lockfile)
+		return false
+	}
+	util.Log(fmt.Sprintf("%s is broken: %s", b.Lockfile, problem))
+
+	backup := b.Lockfile + brokenSuffix
+	if config.DryRun {
+		fmt.Println("would back up " + b.Lockfile + " to " + backup)
+	} else {
+		util.TryWriteAtomic(backup, contentsB)
+		util.Log(fmt.Sprintf("backed up %s to %s", b.Lockfile, backup))
+	}
+
+	if resolved, ok := resolveConflicts(contents); ok && hasConflictMarkers(contents) {
+		util.TryWriteAtomic(b.Lockfile, []byte(resolved))
+		if config.DryRun || lockfileProblem(b, resolved) == "" {
+			util.Log(fmt.Sprintf("resolved the conflicts in %s to our side", b.Lockfile))
+			return true
+		}
+	}
+	deleteLockfile(ctx, b)
+	return true
+}
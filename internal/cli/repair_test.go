@@ -0,0 +1,102 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/util"
+)
+
+func TestResolveConflicts(t *testing.T) {
+	contents := `{
+<<<<<<< HEAD
+  "left-pad": "1.3.0",
+=======
+  "left-pad": "1.2.0",
+>>>>>>> feature
+  "lodash": "4.17.21",
+<<<<<<< ours
+  "react": "18.2.0"
+||||||| base
+  "react": "18.0.0"
+=======
+  "react": "18.1.0"
+>>>>>>> theirs
+}`
+	resolved, ok := resolveConflicts(contents)
+	expected := `{
+  "left-pad": "1.3.0",
+  "lodash": "4.17.21",
+  "react": "18.2.0"
+}`
+	if !ok || resolved != expected {
+		t.Errorf("expected %q, got %q (%v)", expected, resolved, ok)
+	}
+	if !hasConflictMarkers(contents) || hasConflictMarkers(resolved) {
+		t.Errorf("expected markers only before resolving")
+	}
+
+	if _, ok := resolveConflicts("<<<<<<< HEAD\na\n=======\nb\n"); ok {
+		t.Errorf("expected an unclosed conflict not to resolve")
+	}
+}
+
+func TestRepairLockfile(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	b := api.LanguageBackend{
+		Name:     "test",
+		Lockfile: "lock.json",
+		ListLockfile: func() map[api.PkgName]api.PkgVersion {
+			contentsB, err := os.ReadFile("lock.json")
+			if err != nil {
+				util.DieIO("%s", err)
+			}
+			locked := map[api.PkgName]api.PkgVersion{}
+			if err := json.Unmarshal(contentsB, &locked); err != nil {
+				util.DieProtocol("lock.json: %s", err)
+			}
+			return locked
+		},
+	}
+	write := func(contents string) {
+		if err := os.WriteFile("lock.json", []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(`{"a": "1.0.0"}`)
+	if repairLockfile(context.Background(), b) {
+		t.Errorf("expected a lockfile that parses not to be repaired")
+	}
+
+	conflicted := "{\n<<<<<<< HEAD\n\"a\": \"1.1.0\"\n=======\n\"a\": \"1.2.0\"\n>>>>>>> other\n}"
+	write(conflicted)
+	if !repairLockfile(context.Background(), b) {
+		t.Errorf("expected a conflicted lockfile to be repaired")
+	}
+	if contentsB, _ := os.ReadFile("lock.json"); string(contentsB) != "{\n\"a\": \"1.1.0\"\n}" {
+		t.Errorf("expected our side of the conflict, got %q", contentsB)
+	}
+	if contentsB, _ := os.ReadFile("lock.json.broken"); string(contentsB) != conflicted {
+		t.Errorf("expected a backup of the conflicted lockfile, got %q", contentsB)
+	}
+
+	write(`{"a": `)
+	if !repairLockfile(context.Background(), b) {
+		t.Errorf("expected a lockfile that does not parse to be repaired")
+	}
+	if util.Exists("lock.json") {
+		t.Errorf("expected a lockfile that does not parse to be deleted")
+	}
+}
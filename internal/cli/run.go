@@ -0,0 +1,75 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/replit/upm/internal/backends"
+	"github.com/replit/upm/internal/table"
+	"github.com/replit/upm/internal/util"
+)
+
+// scriptEntry is one script listed by 'upm run --list'. The JSON form
+// is what --format json emits.
+type scriptEntry struct {
+	Name    string `json:"name" pretty:"Name"`
+	Command string `json:"command" pretty:"Command"`
+}
+
+// runListScripts implements 'upm run --list'.
+func runListScripts(language string, outputFormat outputFormat) {
+	b := backends.GetBackend(context.Background(), language)
+	if b.ListScripts == nil {
+		dieUnsupported(b, "list-scripts")
+	}
+	if !util.Exists(b.Specfile) {
+		util.DieIO("%s: no such file", b.Specfile)
+	}
+
+	s := silenceSubroutines()
+	scripts := b.ListScripts()
+	s.restore()
+
+	entries := []scriptEntry{}
+	for name, command := range scripts {
+		entries = append(entries, scriptEntry{Name: name, Command: command})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+
+	switch outputFormat {
+	case outputFormatTable:
+		if len(entries) == 0 {
+			util.Log(fmt.Sprintf("%s defines no scripts", b.Specfile))
+			return
+		}
+		t := table.FromStructs(entries)
+		t.Print()
+
+	case outputFormatJSON:
+		outputB, err := json.Marshal(entries)
+		if err != nil {
+			panic("couldn't marshal json")
+		}
+		fmt.Println(string(outputB))
+
+	default:
+		util.Panicf("unknown output format %d", outputFormat)
+	}
+}
+
+// runRun implements 'upm run'.
+func runRun(language string, args []string) {
+	b := backends.GetBackend(context.Background(), language)
+	if b.RunScript == nil {
+		dieUnsupported(b, "run")
+	}
+	ensureTools(b)
+
+	if code := util.RunAttached(b.RunScript(args[0], args[1:])); code != 0 {
+		util.Exit(code)
+	}
+}
@@ -0,0 +1,343 @@
+package cli
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/util"
+	"github.com/replit/upm/internal/versions"
+	"golang.org/x/term"
+)
+
+// latestReleaseURL is where the latest release of UPM is looked up.
+var latestReleaseURL = "https://api.github.com/repos/replit/upm/releases/latest"
+
+// releaseKey is the base64 of the Ed25519 public key that signs the
+// checksums of releases. It is set at build time, like version; if it
+// is empty, releases are only checked against their checksums.
+var releaseKey = ""
+
+// githubRelease is the part of a release in the GitHub API that
+// self-update needs.
+type githubRelease struct {
+	TagName string         `json:"tag_name"`
+	Assets  []releaseAsset `json:"assets"`
+}
+
+// releaseAsset is a file attached to a release.
+type releaseAsset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+}
+
+// releaseVersion returns the version of the release, without the "v"
+// of its tag.
+func (r githubRelease) releaseVersion() string {
+	return strings.TrimPrefix(r.TagName, "v")
+}
+
+// asset returns the URL of the named asset, or "" if there is none.
+func (r githubRelease) asset(name string) string {
+	for _, asset := range r.Assets {
+		if asset.Name == name {
+			return asset.URL
+		}
+	}
+	return ""
+}
+
+// archiveName returns the name of the release archive of the binary
+// for a platform, as GoReleaser names it.
+func archiveName(version, goos, goarch string) string {
+	return fmt.Sprintf("upm_%s_%s_%s.tar.gz", version, goos, goarch)
+}
+
+// fetch returns the body of a GET request for url.
+func fetch(client *http.Client, url string) ([]byte, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "upm (+https://github.com/replit/upm)")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// latestRelease looks up the latest release of UPM.
+func latestRelease(client *http.Client) (githubRelease, error) {
+	var release githubRelease
+	body, err := fetch(client, latestReleaseURL)
+	if err != nil {
+		return release, err
+	}
+	if err := json.Unmarshal(body, &release); err != nil {
+		return release, fmt.Errorf("%s: %w", latestReleaseURL, err)
+	}
+	if release.TagName == "" {
+		return release, fmt.Errorf("%s: no tag_name", latestReleaseURL)
+	}
+	return release, nil
+}
+
+// isNewer returns true if latest is a newer version than current. A
+// development build, whose version cannot be compared, is never
+// older.
+func isNewer(latest, current string) bool {
+	cmp, err := versions.Compare(latest, strings.TrimPrefix(current, "v"))
+	return err == nil && cmp > 0
+}
+
+// checksumFor finds the SHA-256 of the named file in the checksums.txt
+// of a release, which has a "<hex digest>  <name>" line per file.
+func checksumFor(checksums []byte, name string) ([]byte, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(checksums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[1] == name {
+			return hex.DecodeString(fields[0])
+		}
+	}
+	return nil, fmt.Errorf("no checksum for %s", name)
+}
+
+// verifyChecksums checks the signature of checksums.txt with the
+// release key, if UPM was built with one.
+func verifyChecksums(checksums, signature []byte) error {
+	if releaseKey == "" {
+		return nil
+	}
+	key, err := base64.StdEncoding.DecodeString(releaseKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid release key")
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil || !ed25519.Verify(ed25519.PublicKey(key), checksums, sig) {
+		return fmt.Errorf("the signature of checksums.txt is not valid")
+	}
+	return nil
+}
+
+// extractBinary returns the upm executable from a release archive.
+func extractBinary(archive []byte) ([]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return nil, err
+	}
+	r := tar.NewReader(gz)
+	for {
+		header, err := r.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("no upm executable in the archive")
+		} else if err != nil {
+			return nil, err
+		}
+		switch filepath.Base(header.Name) {
+		case "upm", "upm.exe":
+			return io.ReadAll(r)
+		}
+	}
+}
+
+// replaceExecutable replaces the file at path with binary, atomically:
+// the new executable is written next to it and renamed over it. A
+// running executable cannot be replaced on Windows, so there it is
+// moved aside first.
+func replaceExecutable(path string, binary []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upm-update-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(binary); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o755); err != nil {
+		return err
+	}
+	if runtime.GOOS == "windows" {
+		old := path + ".old"
+		_ = os.Remove(old)
+		if err := os.Rename(path, old); err != nil {
+			return err
+		}
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// downloadRelease downloads the binary of release for this platform
+// and checks it against the checksums of the release.
+func downloadRelease(client *http.Client, release githubRelease) []byte {
+	name := archiveName(release.releaseVersion(), runtime.GOOS, runtime.GOARCH)
+	archiveURL := release.asset(name)
+	checksumsURL := release.asset("checksums.txt")
+	if archiveURL == "" || checksumsURL == "" {
+		util.DieUnimplemented("release %s has no %s and checksums.txt", release.TagName, name)
+	}
+
+	checksums, err := fetch(client, checksumsURL)
+	if err != nil {
+		util.DieNetwork("%s", err)
+	}
+	if releaseKey != "" {
+		sigURL := release.asset("checksums.txt.sig")
+		if sigURL == "" {
+			util.DieConsistency("release %s has no checksums.txt.sig", release.TagName)
+		}
+		sig, err := fetch(client, sigURL)
+		if err != nil {
+			util.DieNetwork("%s", err)
+		}
+		if err := verifyChecksums(checksums, sig); err != nil {
+			util.DieConsistency("%s", err)
+		}
+	}
+	expected, err := checksumFor(checksums, name)
+	if err != nil {
+		util.DieConsistency("%s", err)
+	}
+
+	util.ProgressMsg("download " + archiveURL)
+	archive, err := fetch(client, archiveURL)
+	if err != nil {
+		util.DieNetwork("%s", err)
+	}
+	if sum := sha256.Sum256(archive); !bytes.Equal(sum[:], expected) {
+		util.DieConsistency("%s: checksum mismatch (expected %x, got %x)", name, expected, sum)
+	}
+	binary, err := extractBinary(archive)
+	if err != nil {
+		util.DieConsistency("%s: %s", name, err)
+	}
+	return binary
+}
+
+// runSelfUpdate implements 'upm self-update'. With check, it only
+// reports whether there is a newer release.
+func runSelfUpdate(check bool) {
+	if _, err := versions.Compare(version, version); err != nil {
+		util.DieUnimplemented("this upm is a development build (%s), which self-update cannot compare with releases", version)
+	}
+	client := &http.Client{Transport: util.HTTPTransport}
+	release, err := latestRelease(client)
+	if err != nil {
+		util.DieNetwork("%s", err)
+	}
+	latest := release.releaseVersion()
+	if !isNewer(latest, version) {
+		util.Log(fmt.Sprintf("upm %s is the latest version", version))
+		return
+	}
+	if check {
+		fmt.Printf("upm %s is available (this is %s)\n", latest, version)
+		return
+	}
+
+	path, err := os.Executable()
+	if err == nil {
+		path, err = filepath.EvalSymlinks(path)
+	}
+	if err != nil {
+		util.DieIO("cannot find the upm executable: %s", err)
+	}
+	if config.DryRun {
+		fmt.Printf("would replace %s with upm %s\n", path, latest)
+		return
+	}
+	binary := downloadRelease(client, release)
+	if err := replaceExecutable(path, binary); err != nil {
+		util.DieIO("%s: %s", path, err)
+	}
+	util.Log(fmt.Sprintf("updated %s from %s to %s", path, version, latest))
+}
+
+// updateCheck is the state of the passive update check, kept between
+// runs so that GitHub is asked at most once a day.
+type updateCheck struct {
+	CheckedAt time.Time `json:"checkedAt"`
+	Latest    string    `json:"latest"`
+}
+
+// updateCheckInterval is how long the result of an update check is
+// reused.
+const updateCheckInterval = 24 * time.Hour
+
+// updateCheckFile returns where the state of the update check is kept,
+// or "" if there is no cache directory.
+func updateCheckFile() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "upm", "update-check.json")
+}
+
+// newerRelease returns the version of the latest release if it is
+// newer than this one, or "". It looks it up at most once per
+// updateCheckInterval, with a short timeout, and ignores any error,
+// since it is not what the user asked for.
+func newerRelease(stateFile string, now time.Time) string {
+	var state updateCheck
+	if contents, err := os.ReadFile(stateFile); err == nil {
+		_ = json.Unmarshal(contents, &state)
+	}
+	if now.Sub(state.CheckedAt) >= updateCheckInterval {
+		client := &http.Client{Transport: util.HTTPTransport, Timeout: 2 * time.Second}
+		state.CheckedAt = now
+		if release, err := latestRelease(client); err == nil {
+			state.Latest = release.releaseVersion()
+		}
+		if contents, err := json.Marshal(state); err == nil {
+			if err := os.MkdirAll(filepath.Dir(stateFile), 0o755); err == nil {
+				_ = os.WriteFile(stateFile, contents, 0o644)
+			}
+		}
+	}
+	if state.Latest != "" && isNewer(state.Latest, version) {
+		return state.Latest
+	}
+	return ""
+}
+
+// notifyUpdate tells the user about a newer release of UPM once the
+// command has succeeded, if update_check is set in the user-level
+// configuration file. It stays quiet when the output is not for a
+// person to read.
+func notifyUpdate() {
+	if !config.Loaded.UpdateCheck || config.Quiet || config.ProgressJSON || !term.IsTerminal(int(os.Stderr.Fd())) {
+		return
+	}
+	stateFile := updateCheckFile()
+	if stateFile == "" {
+		return
+	}
+	if latest := newerRelease(stateFile, time.Now()); latest != "" {
+		fmt.Fprintf(os.Stderr, "upm %s is available (this is %s); run 'upm self-update' to update\n", latest, version)
+	}
+}
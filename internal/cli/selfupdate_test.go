@@ -0,0 +1,143 @@
+package cli
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// releaseServer serves a release of UPM, 1.2.0, with an archive of
+// binary for this platform, and returns the number of requests for the
+// latest release so far.
+func releaseServer(t *testing.T, binary []byte, sign ed25519.PrivateKey) func() int {
+	var archive bytes.Buffer
+	gz := gzip.NewWriter(&archive)
+	tw := tar.NewWriter(gz)
+	for name, contents := range map[string][]byte{"README.md": []byte("docs"), "upm": binary} {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o755, Size: int64(len(contents))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(contents); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	name := archiveName("1.2.0", runtime.GOOS, runtime.GOARCH)
+	checksums := fmt.Sprintf("%x  %s\n%x  other.tar.gz\n", sha256.Sum256(archive.Bytes()), name, sha256.Sum256(nil))
+
+	lookups := 0
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	mux.HandleFunc("/latest", func(w http.ResponseWriter, r *http.Request) {
+		lookups++
+		release := githubRelease{TagName: "v1.2.0", Assets: []releaseAsset{
+			{Name: name, URL: server.URL + "/archive"},
+			{Name: "checksums.txt", URL: server.URL + "/checksums"},
+			{Name: "checksums.txt.sig", URL: server.URL + "/sig"},
+		}}
+		_ = json.NewEncoder(w).Encode(release)
+	})
+	mux.HandleFunc("/archive", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(archive.Bytes())
+	})
+	mux.HandleFunc("/checksums", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(checksums))
+	})
+	mux.HandleFunc("/sig", func(w http.ResponseWriter, r *http.Request) {
+		if sign != nil {
+			_, _ = w.Write([]byte(base64.StdEncoding.EncodeToString(ed25519.Sign(sign, []byte(checksums)))))
+		}
+	})
+
+	oldURL := latestReleaseURL
+	latestReleaseURL = server.URL + "/latest"
+	t.Cleanup(func() { latestReleaseURL = oldURL })
+	return func() int { return lookups }
+}
+
+func TestSelfUpdate(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	releaseServer(t, []byte("new upm"), private)
+	defer func(key string) { releaseKey = key }(releaseKey)
+	releaseKey = base64.StdEncoding.EncodeToString(public)
+
+	release, err := latestRelease(http.DefaultClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if release.releaseVersion() != "1.2.0" || !isNewer("1.2.0", "1.1.3") || isNewer("1.2.0", "v1.2.0") {
+		t.Fatalf("unexpected release %+v", release)
+	}
+	binary := downloadRelease(http.DefaultClient, release)
+	if string(binary) != "new upm" {
+		t.Fatalf("unexpected binary %q", binary)
+	}
+
+	path := filepath.Join(t.TempDir(), "upm")
+	if err := os.WriteFile(path, []byte("old upm"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := replaceExecutable(path, binary); err != nil {
+		t.Fatal(err)
+	}
+	if contents, _ := os.ReadFile(path); string(contents) != "new upm" {
+		t.Errorf("expected the executable to be replaced, got %q", contents)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("expected no leftover files, got %v", entries)
+	}
+
+	other, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	releaseKey = base64.StdEncoding.EncodeToString(other)
+	if err := verifyChecksums([]byte("checksums"), []byte("c2lnbmF0dXJl")); err == nil {
+		t.Error("expected a bad signature to be rejected")
+	}
+}
+
+func TestNewerRelease(t *testing.T) {
+	lookups := releaseServer(t, []byte("new upm"), nil)
+	defer func(v string) { version = v }(version)
+	version = "1.1.3"
+
+	stateFile := filepath.Join(t.TempDir(), "update-check.json")
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	if latest := newerRelease(stateFile, now); latest != "1.2.0" {
+		t.Errorf("expected 1.2.0, got %q", latest)
+	}
+	if latest := newerRelease(stateFile, now.Add(time.Hour)); latest != "1.2.0" || lookups() != 1 {
+		t.Errorf("expected the cached release, got %q after %d lookups", latest, lookups())
+	}
+	newerRelease(stateFile, now.Add(25*time.Hour))
+	if lookups() != 2 {
+		t.Errorf("expected a new lookup after a day, got %d", lookups())
+	}
+
+	version = "1.2.0"
+	if latest := newerRelease(stateFile, now.Add(26*time.Hour)); latest != "" {
+		t.Errorf("expected no newer release, got %q", latest)
+	}
+}
@@ -0,0 +1,243 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/table"
+	"github.com/replit/upm/internal/util"
+)
+
+// settingRow is a row of the table that 'upm config show' prints.
+type settingRow struct {
+	Key    string `pretty:"Key"`
+	Value  string `pretty:"Value"`
+	Origin string `pretty:"Origin"`
+}
+
+// settingJSON is an element of the JSON that 'upm config show' prints.
+type settingJSON struct {
+	Key     string      `json:"key"`
+	Value   interface{} `json:"value"`
+	Origins []string    `json:"origins,omitempty"`
+}
+
+// runConfigShow implements 'upm config show'. With withOrigin, it also
+// shows which configuration files each setting comes from.
+func runConfigShow(outputFormat outputFormat, withOrigin bool) {
+	settings, err := config.Settings()
+	if err != nil {
+		util.Panicf("couldn't flatten the configuration: %s", err)
+	}
+
+	switch outputFormat {
+	case outputFormatTable:
+		if len(settings) == 0 {
+			util.Log("nothing is configured")
+			return
+		}
+		rows := []settingRow{}
+		for _, setting := range settings {
+			value, err := json.Marshal(setting.Value)
+			if err != nil {
+				panic("couldn't marshal json")
+			}
+			row := settingRow{Key: setting.Key, Value: string(value)}
+			if withOrigin {
+				row.Origin = strings.Join(setting.Origins, ", ")
+			}
+			rows = append(rows, row)
+		}
+		t := table.FromStructs(rows)
+		t.Print()
+
+	case outputFormatJSON:
+		results := []settingJSON{}
+		for _, setting := range settings {
+			result := settingJSON{Key: setting.Key, Value: setting.Value}
+			if withOrigin {
+				result.Origins = setting.Origins
+			}
+			results = append(results, result)
+		}
+		outputB, err := json.Marshal(results)
+		if err != nil {
+			panic("couldn't marshal json")
+		}
+		fmt.Println(string(outputB))
+
+	default:
+		util.Panicf("unknown output format %d", outputFormat)
+	}
+}
+
+// formatSettingValue writes the value of a setting for 'upm config get':
+// strings as they are, lists one item per line, and the rest as JSON.
+func formatSettingValue(value interface{}) string {
+	switch value := value.(type) {
+	case string:
+		return value
+	case []interface{}:
+		lines := []string{}
+		for _, item := range value {
+			lines = append(lines, formatSettingValue(item))
+		}
+		return strings.Join(lines, "\n")
+	}
+	valueB, err := json.Marshal(value)
+	if err != nil {
+		panic("couldn't marshal json")
+	}
+	return string(valueB)
+}
+
+// runConfigGet implements 'upm config get', which prints the value of
+// the setting with the dotted key that applies in the project, or its
+// default if no configuration file sets it.
+func runConfigGet(key string) {
+	value, ok, err := config.Value(key)
+	if err != nil {
+		util.Panicf("couldn't flatten the configuration: %s", err)
+	}
+	def, known := config.LookupDefinition(key)
+	switch {
+	case ok:
+		fmt.Println(formatSettingValue(value))
+	case known:
+		if def.Default != "" {
+			fmt.Println(def.Default)
+		}
+	default:
+		util.DieUsage("unknown setting %#v; 'upm config list' lists them", key)
+	}
+}
+
+// configFileFor returns the configuration file that 'upm config set'
+// and 'upm config unset' change: the user-level one with user, and the
+// project's otherwise.
+func configFileFor(user bool) string {
+	if !user {
+		return config.ProjectConfigFile
+	}
+	path := config.UserConfigFile()
+	if path == "" {
+		util.DieIO("cannot find the user-level configuration file without a home directory")
+	}
+	return path
+}
+
+// runConfigSet implements 'upm config set', which sets the setting with
+// the dotted key to value in the project's configuration file, or with
+// user, in the user-level one.
+func runConfigSet(key, value string, user bool) {
+	def, ok := config.LookupDefinition(key)
+	if !ok {
+		util.DieUsage("unknown setting %#v; 'upm config list' lists them", key)
+	}
+	if def.UserOnly && !user {
+		util.DieUsage("%s is only honored in the user-level configuration file; use --user", key)
+	}
+	parsed, err := config.ParseValue(def, value)
+	if err != nil {
+		util.DieUsage("%s", err)
+	}
+	path := configFileFor(user)
+	if err := config.SetValue(path, key, parsed); err != nil {
+		util.DieIO("%s", err)
+	}
+	util.Log(fmt.Sprintf("set %s in %s", key, path))
+}
+
+// runConfigUnset implements 'upm config unset', which removes the
+// setting with the dotted key from the project's configuration file,
+// or with user, from the user-level one.
+func runConfigUnset(key string, user bool) {
+	if _, ok := config.LookupDefinition(key); !ok {
+		util.DieUsage("unknown setting %#v; 'upm config list' lists them", key)
+	}
+	path := configFileFor(user)
+	if err := config.UnsetValue(path, key); err != nil {
+		util.DieIO("%s", err)
+	}
+	util.Log(fmt.Sprintf("unset %s in %s", key, path))
+}
+
+// definitionRow is a row of the table that 'upm config list' prints.
+type definitionRow struct {
+	Key         string `pretty:"Key"`
+	Value       string `pretty:"Value"`
+	Default     string `pretty:"Default"`
+	Description string `pretty:"Description"`
+}
+
+// definitionJSON is an element of the JSON that 'upm config list'
+// prints.
+type definitionJSON struct {
+	Key         string      `json:"key"`
+	Value       interface{} `json:"value,omitempty"`
+	Default     string      `json:"default,omitempty"`
+	Description string      `json:"description"`
+}
+
+// runConfigList implements 'upm config list', which lists the settings
+// that 'upm config set' knows about, with their values in the project,
+// defaults and descriptions.
+func runConfigList(outputFormat outputFormat) {
+	settings, err := config.Settings()
+	if err != nil {
+		util.Panicf("couldn't flatten the configuration: %s", err)
+	}
+	results := []definitionJSON{}
+	for _, def := range config.Definitions {
+		matched := false
+		for _, setting := range settings {
+			if other, ok := config.LookupDefinition(setting.Key); !ok || other.Key != def.Key {
+				continue
+			}
+			matched = true
+			results = append(results, definitionJSON{
+				Key:         setting.Key,
+				Value:       setting.Value,
+				Default:     def.Default,
+				Description: def.Description,
+			})
+		}
+		if !matched {
+			results = append(results, definitionJSON{
+				Key:         def.Key,
+				Default:     def.Default,
+				Description: def.Description,
+			})
+		}
+	}
+
+	switch outputFormat {
+	case outputFormatTable:
+		rows := []definitionRow{}
+		for _, result := range results {
+			row := definitionRow{Key: result.Key, Default: result.Default, Description: result.Description}
+			if result.Value != nil {
+				valueB, err := json.Marshal(result.Value)
+				if err != nil {
+					panic("couldn't marshal json")
+				}
+				row.Value = string(valueB)
+			}
+			rows = append(rows, row)
+		}
+		t := table.FromStructs(rows)
+		t.Print()
+
+	case outputFormatJSON:
+		outputB, err := json.Marshal(results)
+		if err != nil {
+			panic("couldn't marshal json")
+		}
+		fmt.Println(string(outputB))
+
+	default:
+		util.Panicf("unknown output format %d", outputFormat)
+	}
+}
@@ -0,0 +1,82 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/backends"
+	"github.com/replit/upm/internal/table"
+	"github.com/replit/upm/internal/util"
+)
+
+// sizeEntry represents one package in 'upm size'. The JSON form is
+// what --format json emits.
+type sizeEntry struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+
+	// The size in bytes.
+	Size int64 `json:"size"`
+}
+
+// sizeEntries returns the packages in sizes with their versions in
+// installed, largest first, and those of the same size by name.
+func sizeEntries(sizes map[api.PkgName]int64, installed map[api.PkgName]api.PkgVersion) []sizeEntry {
+	entries := []sizeEntry{}
+	for name, size := range sizes {
+		entries = append(entries, sizeEntry{Name: string(name), Version: string(installed[name]), Size: size})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Size != entries[j].Size {
+			return entries[i].Size > entries[j].Size
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	return entries
+}
+
+// runSize implements 'upm size', which reports the disk space taken
+// by each installed package.
+func runSize(language string, outputFormat outputFormat) {
+	b := backends.GetBackend(context.Background(), language)
+	if b.InstalledSizes == nil {
+		dieUnsupported(b, "size")
+	}
+	s := silenceSubroutines()
+	pkgdir := b.GetPackageDir()
+	var installed map[api.PkgName]api.PkgVersion
+	if b.ListInstalled != nil {
+		installed = b.ListInstalled(pkgdir)
+	}
+	entries := sizeEntries(b.InstalledSizes(pkgdir), installed)
+	s.restore()
+
+	switch outputFormat {
+	case outputFormatTable:
+		if len(entries) == 0 {
+			util.Log("no packages installed; run 'upm install' first")
+			return
+		}
+		var total int64
+		t := table.New("name", "version", "size")
+		for _, entry := range entries {
+			t.AddRow(entry.Name, entry.Version, formatSize(entry.Size))
+			total += entry.Size
+		}
+		t.Print()
+		util.Log(fmt.Sprintf("%d packages, %s in total", len(entries), formatSize(total)))
+
+	case outputFormatJSON:
+		outputB, err := json.Marshal(entries)
+		if err != nil {
+			panic("couldn't marshal json")
+		}
+		fmt.Println(string(outputB))
+
+	default:
+		util.Panicf("unknown output format %d", outputFormat)
+	}
+}
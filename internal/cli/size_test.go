@@ -0,0 +1,22 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+)
+
+func TestSizeEntries(t *testing.T) {
+	sizes := map[api.PkgName]int64{"b": 10, "a": 10, "c": 300, "d": 0}
+	installed := map[api.PkgName]api.PkgVersion{"a": "1.0.0", "b": "2.0.0", "c": "3.0.0"}
+	expected := []sizeEntry{
+		{Name: "c", Version: "3.0.0", Size: 300},
+		{Name: "a", Version: "1.0.0", Size: 10},
+		{Name: "b", Version: "2.0.0", Size: 10},
+		{Name: "d", Size: 0},
+	}
+	if entries := sizeEntries(sizes, installed); !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected %+v, got %+v", expected, entries)
+	}
+}
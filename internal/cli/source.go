@@ -0,0 +1,56 @@
+package cli
+
+import (
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/util"
+)
+
+// parseSourceArg recognizes an argument to 'upm add' that installs a
+// package from a git repository, URL or local path: either the source
+// alone, as in "git+https://github.com/user/repo#main", or a name and
+// a source, as in "repo@git+https://github.com/user/repo". It returns
+// false for ordinary packages from the registry.
+func parseSourceArg(arg string) (api.PkgName, api.PkgSource, bool) {
+	if source, ok := api.ParseSource(arg); ok {
+		return source.Name(), source, true
+	}
+	name, spec, err := api.ParsePackageArg(arg)
+	if err != nil || spec == "" {
+		return "", api.PkgSource{}, false
+	}
+	if source, ok := api.ParseSource(string(spec)); ok {
+		return name, source, true
+	}
+	return "", api.PkgSource{}, false
+}
+
+// splitSourceArgs separates the arguments to 'upm add' that name a git
+// repository, URL or local path from those that name packages in the
+// registry. The former are translated into specs for b, keyed by
+// normalized name.
+func splitSourceArgs(b api.LanguageBackend, args []string) ([]string, map[api.PkgName]api.PkgCoordinates) {
+	registry := []string{}
+	sources := map[api.PkgName]api.PkgCoordinates{}
+	for _, arg := range args {
+		name, source, ok := parseSourceArg(arg)
+		if !ok {
+			registry = append(registry, arg)
+			continue
+		}
+		if b.SpecForSource == nil {
+			dieUnsupported(b, "add-from-source")
+		}
+		if name == "" {
+			util.DieConsistency("%s: cannot tell the package name, use NAME@%s", arg, source)
+		}
+		spec, err := b.SpecForSource(name, source)
+		if err != nil {
+			util.DieConsistency("%s: %s", arg, err)
+		}
+		sources[b.NormalizePackageName(name)] = api.PkgCoordinates{
+			Name: string(name),
+			Spec: spec,
+		}
+	}
+	return registry, sources
+}
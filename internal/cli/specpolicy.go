@@ -0,0 +1,169 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/util"
+)
+
+// addSpecPolicy returns how 'upm add' writes the spec of a package
+// added without one: as --guess-spec says, or else add_spec_policy. If
+// empty, the package manager writes its own default.
+func addSpecPolicy() api.SpecPolicy {
+	if config.SpecPolicy != "" {
+		return api.SpecPolicy(config.SpecPolicy)
+	}
+	return api.SpecPolicy(config.Loaded.AddSpecPolicy)
+}
+
+// unspecifiedPkgs returns the normalized names of the packages among
+// pkgs that come from the registry and have no spec, which are those
+// whose specs applySpecPolicy writes. It must be called before
+// applyMinReleaseAge gives them one.
+func unspecifiedPkgs(pkgs map[api.PkgName]api.PkgCoordinates, sourcePkgs map[api.PkgName]api.PkgCoordinates) map[api.PkgName]bool {
+	unspecified := map[api.PkgName]bool{}
+	for norm, coords := range pkgs {
+		if _, ok := sourcePkgs[norm]; !ok && coords.Spec == "" {
+			unspecified[norm] = true
+		}
+	}
+	return unspecified
+}
+
+// specPolicyVersion returns the version of the package name that 'upm
+// add' adds: the newest one that is older than min_release_age, if b
+// can list releases, or the latest one. It returns false if the
+// package or its versions cannot be found.
+func specPolicyVersion(b api.LanguageBackend, name api.PkgName) (api.PkgVersion, bool) {
+	if b.ListReleases == nil {
+		info := b.Info(name)
+		return api.PkgVersion(info.Version), info.Version != ""
+	}
+	releases := b.ListReleases(name)
+	if releases == nil {
+		return "", false
+	}
+	newest, pin, err := releaseAgePin(b, releases, "", config.ReleaseCutoff())
+	if err != nil {
+		return "", false
+	}
+	if pin.Version != "" {
+		return pin.Version, true
+	}
+	return newest.Version, true
+}
+
+// applySpecPolicy gives the packages of pkgs named in unspecified the
+// spec that addSpecPolicy asks for, for the version that 'upm add'
+// adds, as in "^1.2.3" for the caret policy with npm. It does nothing
+// without a policy, and only warns if b cannot write specs. Packages
+// whose versions cannot be found keep no spec, for the package manager
+// to report.
+func applySpecPolicy(b api.LanguageBackend, pkgs map[api.PkgName]api.PkgCoordinates, unspecified map[api.PkgName]bool) {
+	policy := addSpecPolicy()
+	norms := []api.PkgName{}
+	for norm := range unspecified {
+		if _, ok := pkgs[norm]; ok {
+			norms = append(norms, norm)
+		}
+	}
+	if policy == "" || len(norms) == 0 {
+		return
+	}
+	if b.PinSpec == nil {
+		util.LogError(fmt.Sprintf("%s cannot write specs, so the %s spec policy is not applied", b.Name, policy))
+		return
+	}
+	sort.Slice(norms, func(i, j int) bool {
+		return norms[i] < norms[j]
+	})
+
+	for _, norm := range norms {
+		coords := pkgs[norm]
+		// Python extras, as in flask[async], are not part of
+		// the name in the index.
+		name := api.PkgName(strings.SplitN(coords.Name, "[", 2)[0])
+		version, ok := specPolicyVersion(b, name)
+		if !ok {
+			continue
+		}
+		spec, err := b.PinSpec(version, policy)
+		if err != nil {
+			util.LogError(fmt.Sprintf("%s: the %s spec policy is not applied to %s: %s", coords.Name, policy, version, err))
+			continue
+		}
+		coords.Spec = spec
+		pkgs[norm] = coords
+	}
+}
+
+// policySpecs returns the specs that applySpecPolicy gave the packages
+// of pkgs named in unspecified, by their names as added.
+func policySpecs(pkgs map[api.PkgName]api.PkgCoordinates, unspecified map[api.PkgName]bool) map[api.PkgName]api.PkgSpec {
+	specs := map[api.PkgName]api.PkgSpec{}
+	if addSpecPolicy() == "" {
+		return specs
+	}
+	for norm := range unspecified {
+		if coords, ok := pkgs[norm]; ok {
+			specs[api.PkgName(coords.Name)] = coords.Spec
+		}
+	}
+	return specs
+}
+
+// specsToAlign returns the specs among specs that specfilePkgs lists
+// differently, by the names of specfilePkgs. Spaces do not count, as in
+// ">=1.2, <2" and ">=1.2,<2".
+func specsToAlign(b api.LanguageBackend, specfilePkgs api.PkgDeps, specs map[api.PkgName]api.PkgSpec) map[api.PkgName]api.PkgSpec {
+	normSpecs := map[api.PkgName]api.PkgSpec{}
+	for name, spec := range specs {
+		normSpecs[b.NormalizePackageName(api.PkgName(strings.SplitN(string(name), "[", 2)[0]))] = spec
+	}
+	stripSpaces := func(spec api.PkgSpec) string {
+		return strings.Join(strings.Fields(string(spec)), "")
+	}
+	misaligned := map[api.PkgName]api.PkgSpec{}
+	for name, dep := range specfilePkgs {
+		spec, ok := normSpecs[b.NormalizePackageName(name)]
+		if ok && stripSpaces(dep.Spec) != stripSpaces(spec) {
+			misaligned[name] = spec
+		}
+	}
+	return misaligned
+}
+
+// alignSpecs rewrites the specs that the package manager wrote for the
+// packages of specs otherwise than the spec policy asked, as uv does
+// when asked for no constraint, and locks again if adding already
+// locked.
+func alignSpecs(ctx context.Context, b api.LanguageBackend, specs map[api.PkgName]api.PkgSpec) {
+	if len(specs) == 0 || b.SetSpecs == nil || config.DryRun || !util.Exists(b.Specfile) {
+		return
+	}
+	s := silenceSubroutines()
+	specfilePkgs := b.ListSpecfile(true)
+	s.restore()
+	misaligned := specsToAlign(b, specfilePkgs, specs)
+	if len(misaligned) == 0 {
+		return
+	}
+	names := []api.PkgName{}
+	for name := range misaligned {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	for _, name := range names {
+		util.Log(fmt.Sprintf("%s: %q -> %q, for the %s spec policy", name, specfilePkgs[name].Spec, misaligned[name], addSpecPolicy()))
+	}
+	b.SetSpecs(misaligned)
+	if !b.QuirksIsNotReproducible() && !b.QuirksDoesAddRemoveNotAlsoLock() {
+		reportPhase("lock", names)
+		b.Lock(ctx)
+	}
+}
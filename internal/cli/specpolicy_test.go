@@ -0,0 +1,81 @@
+package cli
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/config"
+)
+
+func TestApplySpecPolicy(t *testing.T) {
+	defer func() { config.SpecPolicy, config.MinReleaseAge = "", 0 }()
+	now := time.Now()
+	b := api.LanguageBackend{
+		Name:        "test",
+		MatchesSpec: api.DefaultMatchesSpec,
+		ListReleases: func(name api.PkgName) []api.Release {
+			if name != "left-pad" {
+				return nil
+			}
+			return []api.Release{
+				{Version: "1.2.0", Published: now.Add(-30 * 24 * time.Hour)},
+				{Version: "1.3.0", Published: now.Add(-time.Hour)},
+			}
+		},
+		PinSpec: func(version api.PkgVersion, policy api.SpecPolicy) (api.PkgSpec, error) {
+			return api.PkgSpec(string(policy) + " " + string(version)), nil
+		},
+	}
+	newPkgs := func() map[api.PkgName]api.PkgCoordinates {
+		return map[api.PkgName]api.PkgCoordinates{
+			"left-pad": {Name: "left-pad"},
+			"missing":  {Name: "missing"},
+			"pinned":   {Name: "pinned", Spec: "1.0.0"},
+		}
+	}
+
+	pkgs := newPkgs()
+	unspecified := unspecifiedPkgs(pkgs, nil)
+	if !reflect.DeepEqual(unspecified, map[api.PkgName]bool{"left-pad": true, "missing": true}) {
+		t.Errorf("unexpected unspecified packages %v", unspecified)
+	}
+	applySpecPolicy(b, pkgs, unspecified)
+	if !reflect.DeepEqual(pkgs, newPkgs()) {
+		t.Errorf("expected no policy to leave the specs alone, got %v", pkgs)
+	}
+
+	config.SpecPolicy = "caret"
+	applySpecPolicy(b, pkgs, unspecified)
+	if spec := pkgs["left-pad"].Spec; spec != "caret 1.3.0" {
+		t.Errorf("expected the latest version, got %q", spec)
+	}
+	if pkgs["missing"].Spec != "" || pkgs["pinned"].Spec != "1.0.0" {
+		t.Errorf("expected the other specs to be left alone, got %v", pkgs)
+	}
+
+	config.MinReleaseAge = 72 * time.Hour
+	pkgs = newPkgs()
+	applySpecPolicy(b, pkgs, unspecified)
+	if spec := pkgs["left-pad"].Spec; spec != "caret 1.2.0" {
+		t.Errorf("expected the newest version older than min_release_age, got %q", spec)
+	}
+}
+
+func TestSpecsToAlign(t *testing.T) {
+	b := api.LanguageBackend{
+		NormalizePackageName: func(name api.PkgName) api.PkgName { return api.PkgName(strings.ToLower(string(name))) },
+	}
+	specfilePkgs := api.PkgDeps{
+		"Flask":    {Spec: ">=3.0.2"},
+		"requests": {Spec: ">=2.31, <3"},
+		"numpy":    {Spec: ">=1"},
+	}
+	specs := map[api.PkgName]api.PkgSpec{"flask[async]": "", "requests": ">=2.31,<3"}
+	expected := map[api.PkgName]api.PkgSpec{"Flask": ""}
+	if misaligned := specsToAlign(b, specfilePkgs, specs); !reflect.DeepEqual(misaligned, expected) {
+		t.Errorf("expected %v, got %v", expected, misaligned)
+	}
+}
@@ -0,0 +1,142 @@
+package cli
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/util"
+	"github.com/replit/upm/internal/versions"
+)
+
+// Lengths of the calendar units of parseAge and formatAge, which need
+// not be exact for ages of releases.
+const (
+	ageDay   = 24 * time.Hour
+	ageWeek  = 7 * ageDay
+	ageMonth = 30 * ageDay
+	ageYear  = 365 * ageDay
+)
+
+// matchAge matches an age in calendar units, as in "2y" or "18mo".
+var matchAge = regexp.MustCompile(`^(\d+)(y|mo|w|d)$`)
+
+// parseAge parses an age such as that of 'upm list --stale': a number
+// of years, months, weeks or days, as in "2y", "6mo", "3w" or "90d",
+// or otherwise a duration such as "72h".
+func parseAge(s string) (time.Duration, error) {
+	if match := matchAge.FindStringSubmatch(s); match != nil {
+		n, err := strconv.Atoi(match[1])
+		if err == nil && n > 0 {
+			unit := map[string]time.Duration{"y": ageYear, "mo": ageMonth, "w": ageWeek, "d": ageDay}[match[2]]
+			return time.Duration(n) * unit, nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid age %q (must be such as \"2y\", \"6mo\", \"3w\" or \"90d\")", s)
+	}
+	return d, nil
+}
+
+// formatAge describes an age in the largest calendar unit it spans, as
+// in "3 months ago".
+func formatAge(d time.Duration) string {
+	plural := func(n int64, unit string) string {
+		if n == 1 {
+			return fmt.Sprintf("1 %s ago", unit)
+		}
+		return fmt.Sprintf("%d %ss ago", n, unit)
+	}
+	switch {
+	case d >= ageYear:
+		return plural(int64(d/ageYear), "year")
+	case d >= ageMonth:
+		return plural(int64(d/ageMonth), "month")
+	case d >= ageWeek:
+		return plural(int64(d/ageWeek), "week")
+	case d >= ageDay:
+		return plural(int64(d/ageDay), "day")
+	default:
+		return "today"
+	}
+}
+
+// releasedAgo returns a release date such as that of PkgInfo.Updated
+// with how long before now it was, as in "2024-05-01 (3 months ago)",
+// or the date as it is if it does not parse.
+func releasedAgo(date string, now time.Time) string {
+	released, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return date
+	}
+	return fmt.Sprintf("%s (%s)", date, formatAge(now.Sub(released)))
+}
+
+// releaseOf returns when version was published among releases, and
+// whether it is one of them.
+func releaseOf(releases []api.Release, version string) (time.Time, bool) {
+	for _, release := range releases {
+		if string(release.Version) == version {
+			return release.Published, true
+		}
+	}
+	// The lockfile may spell the version differently, as in "2.0"
+	// for "2.0.0".
+	for _, release := range releases {
+		if cmp, err := versions.Compare(string(release.Version), version); err == nil && cmp == 0 {
+			return release.Published, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// staleEntries returns the entries of 'upm list' whose locked versions
+// were released before cutoff, with Released set to when. Entries that
+// are not locked to a version from the registry are left out, as are
+// those whose release cannot be found, which are logged.
+func staleEntries(b api.LanguageBackend, entries []listEntry, cutoff time.Time) []listEntry {
+	if b.ListReleases == nil {
+		dieUnsupported(b, "list-stale")
+	}
+	released := make([]time.Time, len(entries))
+	errs := make([]error, len(entries))
+	sem := make(chan struct{}, infoConcurrency)
+	var wg sync.WaitGroup
+	for i, entry := range entries {
+		if entry.Version == "" || entry.Source != "" {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, entry listEntry) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			errs[i] = util.Catch(func() {
+				published, ok := releaseOf(b.ListReleases(api.PkgName(entry.Name)), entry.Version)
+				if !ok {
+					util.DieConsistency("%s %s is not in the registry", entry.Name, entry.Version)
+				}
+				released[i] = published
+			})
+		}(i, entry)
+	}
+	wg.Wait()
+
+	stale := []listEntry{}
+	for i, entry := range entries {
+		if errs[i] != nil {
+			util.LogError(fmt.Sprintf("cannot tell when %s was released: %s", entry.Name, errs[i]))
+			continue
+		}
+		if released[i].IsZero() || !released[i].Before(cutoff) {
+			continue
+		}
+		entry.Released = released[i].UTC().Format("2006-01-02")
+		stale = append(stale, entry)
+	}
+	return stale
+}
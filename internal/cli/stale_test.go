@@ -0,0 +1,77 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/replit/upm/internal/api"
+)
+
+func TestParseAge(t *testing.T) {
+	for s, expected := range map[string]time.Duration{
+		"2y":    2 * 365 * 24 * time.Hour,
+		"6mo":   6 * 30 * 24 * time.Hour,
+		"3w":    3 * 7 * 24 * time.Hour,
+		"90d":   90 * 24 * time.Hour,
+		"72h":   72 * time.Hour,
+		"1h30m": 90 * time.Minute,
+	} {
+		if d, err := parseAge(s); err != nil || d != expected {
+			t.Errorf("%s: expected %s, got %s (%v)", s, expected, d, err)
+		}
+	}
+	for _, s := range []string{"", "2", "0y", "-1h", "2 years", "1m2y"} {
+		if _, err := parseAge(s); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+}
+
+func TestReleasedAgo(t *testing.T) {
+	now := time.Date(2024, 8, 15, 12, 0, 0, 0, time.UTC)
+	for date, expected := range map[string]string{
+		"2024-08-15": "2024-08-15 (today)",
+		"2024-08-14": "2024-08-14 (1 day ago)",
+		"2024-08-01": "2024-08-01 (2 weeks ago)",
+		"2024-05-01": "2024-05-01 (3 months ago)",
+		"2022-01-01": "2022-01-01 (2 years ago)",
+		"last week":  "last week",
+	} {
+		if actual := releasedAgo(date, now); actual != expected {
+			t.Errorf("%s: expected %q, got %q", date, expected, actual)
+		}
+	}
+}
+
+func TestStaleEntries(t *testing.T) {
+	published := func(date string) time.Time {
+		t, _ := time.Parse("2006-01-02", date)
+		return t
+	}
+	b := api.LanguageBackend{
+		Name: "test",
+		ListReleases: func(name api.PkgName) []api.Release {
+			return map[api.PkgName][]api.Release{
+				"old":   {{Version: "1.0.0", Published: published("2020-01-01")}, {Version: "2.0.0", Published: published("2024-01-01")}},
+				"new":   {{Version: "3.0.0", Published: published("2024-06-01")}},
+				"short": {{Version: "2.0.0", Published: published("2019-05-01")}},
+			}[name]
+		},
+	}
+	entries := []listEntry{
+		{Name: "new", Version: "3.0.0"},
+		{Name: "old", Version: "1.0.0"},
+		{Name: "short", Version: "2.0"},
+		{Name: "local", Version: "1.0.0", Source: "../local"},
+		{Name: "unlocked", Spec: "^1.0.0"},
+		{Name: "missing", Version: "1.0.0"},
+	}
+	expected := []listEntry{
+		{Name: "old", Version: "1.0.0", Released: "2020-01-01"},
+		{Name: "short", Version: "2.0", Released: "2019-05-01"},
+	}
+	if actual := staleEntries(b, entries, published("2022-01-01")); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %+v, got %+v", expected, actual)
+	}
+}
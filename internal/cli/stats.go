@@ -0,0 +1,223 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/table"
+	"github.com/replit/upm/internal/util"
+	"github.com/spf13/cobra"
+)
+
+// commandStats are the statistics of one upm command, such as "add".
+type commandStats struct {
+	Runs     int `json:"runs"`
+	Failures int `json:"failures"`
+
+	// Seconds is the time all of the runs took together, and
+	// MaxSeconds that of the longest one.
+	Seconds    float64 `json:"seconds"`
+	MaxSeconds float64 `json:"maxSeconds"`
+
+	LastRun time.Time `json:"lastRun"`
+}
+
+// usageStats is the contents of the statistics file.
+type usageStats struct {
+	// Since is when the first run was recorded.
+	Since    time.Time                `json:"since"`
+	Commands map[string]*commandStats `json:"commands"`
+}
+
+// statsFile returns the location of the statistics file, honoring
+// XDG_DATA_HOME, or "" if there is no home directory.
+func statsFile() string {
+	dir := os.Getenv("XDG_DATA_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dir, "upm", "stats.json")
+}
+
+// readStats reads the statistics file at path. A missing file has no
+// statistics.
+func readStats(path string) (usageStats, error) {
+	stats := usageStats{Commands: map[string]*commandStats{}}
+	contents, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return stats, nil
+	} else if err != nil {
+		return stats, err
+	}
+	if err := json.Unmarshal(contents, &stats); err != nil {
+		return stats, fmt.Errorf("%s: %w", path, err)
+	}
+	if stats.Commands == nil {
+		stats.Commands = map[string]*commandStats{}
+	}
+	return stats, nil
+}
+
+// writeStats replaces the statistics file at path.
+func writeStats(path string, stats usageStats) error {
+	contents, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".stats-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(contents, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// record adds a run of command that took d and ended at now.
+func (s *usageStats) record(command string, d time.Duration, failed bool, now time.Time) {
+	if s.Since.IsZero() {
+		s.Since = now
+	}
+	c, ok := s.Commands[command]
+	if !ok {
+		c = &commandStats{}
+		s.Commands[command] = c
+	}
+	c.Runs++
+	if failed {
+		c.Failures++
+	}
+	c.Seconds += d.Seconds()
+	if d.Seconds() > c.MaxSeconds {
+		c.MaxSeconds = d.Seconds()
+	}
+	c.LastRun = now
+}
+
+var (
+	// statsCommand is the command that is running, as in "add" or
+	// "export", or "" if its run is not recorded.
+	statsCommand string
+
+	// statsStart is when the command started.
+	statsStart time.Time
+)
+
+// startStats notes that cmd starts running, if statistics are enabled
+// with stats in a configuration file. 'upm stats' itself and the
+// daemon, which runs until it is stopped, are not recorded.
+func startStats(cmd *cobra.Command) {
+	if !config.Loaded.Stats || !cmd.HasParent() || cmd.Name() == "stats" {
+		return
+	}
+	statsCommand = strings.TrimPrefix(cmd.CommandPath(), cmd.Root().Name()+" ")
+	statsStart = time.Now()
+}
+
+// recordStats adds the run of the command to the statistics file. It
+// must be deferred, so that it sees whether the command is dying with
+// an error. Failing to record is only reported with --debug, since it
+// is not what the user asked for.
+func recordStats() {
+	r := recover()
+	if statsCommand != "" && !config.DryRun {
+		path := statsFile()
+		stats, err := readStats(path)
+		if err == nil && path != "" {
+			now := time.Now()
+			stats.record(statsCommand, now.Sub(statsStart), r != nil, now)
+			err = writeStats(path, stats)
+		}
+		if err != nil {
+			util.Debugf("not recording statistics: %s", err)
+		}
+	}
+	if r != nil {
+		panic(r)
+	}
+}
+
+// formatSeconds formats a duration in seconds for 'upm stats'.
+func formatSeconds(seconds float64) string {
+	return (time.Duration(seconds * float64(time.Second))).Round(time.Millisecond).String()
+}
+
+// runStats implements 'upm stats'. With reset, the statistics are
+// deleted instead.
+func runStats(outputFormat outputFormat, reset bool) {
+	path := statsFile()
+	if path == "" {
+		util.DieIO("cannot find the home directory")
+	}
+	if reset {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			util.DieIO("%s", err)
+		}
+		return
+	}
+	stats, err := readStats(path)
+	if err != nil {
+		util.DieIO("%s", err)
+	}
+
+	switch outputFormat {
+	case outputFormatTable:
+		if len(stats.Commands) == 0 {
+			if !config.Loaded.Stats {
+				util.Log("no statistics; set stats = true in a configuration file to record them")
+			} else {
+				util.Log("no statistics yet")
+			}
+			return
+		}
+		names := []string{}
+		for name := range stats.Commands {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool {
+			a, b := stats.Commands[names[i]], stats.Commands[names[j]]
+			if a.Runs != b.Runs {
+				return a.Runs > b.Runs
+			}
+			return names[i] < names[j]
+		})
+		t := table.New("command", "runs", "failures", "total", "average", "max")
+		for _, name := range names {
+			c := stats.Commands[name]
+			t.AddRow(name, strconv.Itoa(c.Runs), strconv.Itoa(c.Failures),
+				formatSeconds(c.Seconds), formatSeconds(c.Seconds/float64(c.Runs)), formatSeconds(c.MaxSeconds))
+		}
+		t.Print()
+		util.Log(fmt.Sprintf("since %s, in %s", stats.Since.Format("2006-01-02"), path))
+
+	case outputFormatJSON:
+		outputB, err := json.Marshal(stats)
+		if err != nil {
+			panic("couldn't marshal json")
+		}
+		fmt.Println(string(outputB))
+
+	default:
+		util.Panicf("unknown output format %d", outputFormat)
+	}
+}
@@ -0,0 +1,41 @@
+package cli
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "upm", "stats.json")
+	stats, err := readStats(path)
+	if err != nil || len(stats.Commands) != 0 {
+		t.Fatalf("expected no statistics, got %+v, %v", stats, err)
+	}
+
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	stats.record("add", 3*time.Second, false, start)
+	stats.record("add", 5*time.Second, true, start.Add(time.Hour))
+	stats.record("list", time.Second, false, start.Add(2*time.Hour))
+	if err := writeStats(path, stats); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err = readStats(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	add := stats.Commands["add"]
+	if add == nil || add.Runs != 2 || add.Failures != 1 || add.Seconds != 8 || add.MaxSeconds != 5 {
+		t.Errorf("unexpected statistics for add: %+v", add)
+	}
+	if !add.LastRun.Equal(start.Add(time.Hour)) || !stats.Since.Equal(start) {
+		t.Errorf("unexpected times: since %s, last add %s", stats.Since, add.LastRun)
+	}
+	if list := stats.Commands["list"]; list == nil || list.Runs != 1 {
+		t.Errorf("unexpected statistics for list: %+v", list)
+	}
+	if got := formatSeconds(add.Seconds / float64(add.Runs)); got != "4s" {
+		t.Errorf("expected an average of 4s, got %s", got)
+	}
+}
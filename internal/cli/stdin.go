@@ -0,0 +1,115 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/replit/upm/internal/util"
+)
+
+// stdinPackage is a package given to --stdin as a JSON object, as in
+// the output of 'upm list --format json'.
+type stdinPackage struct {
+	Name string `json:"name"`
+	Spec string `json:"spec"`
+}
+
+// parseStdinValue appends the packages in a JSON value given to
+// --stdin to args: a string in the same form as a command-line
+// argument, an object with a name and optionally a spec, or an array
+// of either. Specs are dropped unless withSpecs is set.
+func parseStdinValue(raw json.RawMessage, withSpecs bool, args []string) ([]string, error) {
+	switch bytes.TrimSpace(raw)[0] {
+	case '"':
+		var arg string
+		if err := json.Unmarshal(raw, &arg); err != nil {
+			return nil, err
+		}
+		return append(args, arg), nil
+
+	case '{':
+		var pkg stdinPackage
+		if err := json.Unmarshal(raw, &pkg); err != nil {
+			return nil, err
+		}
+		if pkg.Name == "" {
+			return nil, fmt.Errorf("package without a name: %s", raw)
+		}
+		if withSpecs && pkg.Spec != "" {
+			return append(args, pkg.Name+" "+pkg.Spec), nil
+		}
+		return append(args, pkg.Name), nil
+
+	case '[':
+		var items []json.RawMessage
+		if err := json.Unmarshal(raw, &items); err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			var err error
+			if args, err = parseStdinValue(item, withSpecs, args); err != nil {
+				return nil, err
+			}
+		}
+		return args, nil
+	}
+	return nil, fmt.Errorf("expected a string, object or array, got %s", raw)
+}
+
+// parseStdinPackages reads the packages for 'upm add --stdin' or 'upm
+// remove --stdin' from r. The input is either one package per line,
+// written as on the command line, with blank lines and # comments
+// ignored, or a sequence of JSON values as accepted by
+// parseStdinValue. Specs are dropped unless withSpecs is set.
+func parseStdinPackages(r io.Reader, withSpecs bool) ([]string, error) {
+	input, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	trimmed := bytes.TrimSpace(input)
+	args := []string{}
+
+	if len(trimmed) > 0 && strings.IndexByte(`[{"`, trimmed[0]) >= 0 {
+		decoder := json.NewDecoder(bytes.NewReader(trimmed))
+		for decoder.More() {
+			var raw json.RawMessage
+			if err := decoder.Decode(&raw); err != nil {
+				return nil, err
+			}
+			if args, err = parseStdinValue(raw, withSpecs, args); err != nil {
+				return nil, err
+			}
+		}
+		return args, nil
+	}
+
+	for scanner := bufio.NewScanner(bytes.NewReader(input)); scanner.Scan(); {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !withSpecs {
+			line = strings.Fields(line)[0]
+		}
+		args = append(args, line)
+	}
+	return args, nil
+}
+
+// readStdinPackages returns the packages given on stdin with --stdin,
+// terminating the process if there are none.
+func readStdinPackages(withSpecs bool) []string {
+	args, err := parseStdinPackages(os.Stdin, withSpecs)
+	if err != nil {
+		util.DieConsistency("reading packages from stdin: %s", err)
+	}
+	if len(args) == 0 {
+		util.DieConsistency("no packages on stdin")
+	}
+	return args
+}
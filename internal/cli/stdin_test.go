@@ -0,0 +1,38 @@
+package cli
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseStdinPackages(t *testing.T) {
+	for _, test := range []struct {
+		input     string
+		withSpecs bool
+		expected  []string
+	}{
+		{"flask >=3\n\n# tests\npytest\n", true, []string{"flask >=3", "pytest"}},
+		{"flask >=3\npytest\n", false, []string{"flask", "pytest"}},
+		{`[{"name":"express","spec":"^4.18","version":"4.18.2"},{"name":"lodash"}]`, true, []string{"express ^4.18", "lodash"}},
+		{`[{"name":"express","spec":"^4.18"}]`, false, []string{"express"}},
+		{"{\"name\": \"a\"}\n{\"name\": \"b\", \"spec\": \"1\"}\n", true, []string{"a", "b 1"}},
+		{`["left-pad@1.3.0", "react"]`, true, []string{"left-pad@1.3.0", "react"}},
+		{"  \n", true, []string{}},
+	} {
+		got, err := parseStdinPackages(strings.NewReader(test.input), test.withSpecs)
+		if err != nil {
+			t.Errorf("parseStdinPackages(%q): %s", test.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("parseStdinPackages(%q) = %q, expected %q", test.input, got, test.expected)
+		}
+	}
+
+	for _, invalid := range []string{`[{"spec": "1"}]`, `[1]`, `{"name": "a"`} {
+		if _, err := parseStdinPackages(strings.NewReader(invalid), true); err == nil {
+			t.Errorf("expected %q to be rejected", invalid)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/util"
+)
+
+// didYouMean returns a hint such as ` (did you mean "flask"?)` naming
+// the candidates that name is likely a typo of, or "" if there are
+// none.
+func didYouMean(name string, candidates []string) string {
+	suggestions := util.Suggest(name, candidates)
+	if len(suggestions) == 0 {
+		return ""
+	}
+	quoted := []string{}
+	for _, suggestion := range suggestions {
+		quoted = append(quoted, fmt.Sprintf("%#v", suggestion))
+	}
+	return fmt.Sprintf(" (did you mean %s?)", strings.Join(quoted, " or "))
+}
+
+// registryCandidates returns the names of the packages that the index
+// of b finds for name, to suggest in place of a package that does not
+// exist. Failed searches are ignored.
+func registryCandidates(b api.LanguageBackend, name string) []string {
+	if b.Search == nil {
+		return nil
+	}
+	var results []api.PkgInfo
+	s := silenceSubroutines()
+	defer s.restore()
+	if err := util.Catch(func() { results = b.Search(name) }); err != nil {
+		util.Verbosef("no suggestions for %s: %s", name, err)
+		return nil
+	}
+	names := []string{}
+	for _, info := range results {
+		names = append(names, info.Name)
+	}
+	return names
+}
+
+// checkPackagesExist dies if the index of b has no package with one of
+// the given names, suggesting similarly named packages. Packages that
+// cannot be looked up, e.g. because the index is unreachable, are
+// given the benefit of the doubt, and so is every package if b cannot
+// look up packages at all or --no-check was given.
+func checkPackagesExist(b api.LanguageBackend, pkgs []api.PkgName) {
+	if b.Info == nil || len(pkgs) == 0 || config.NoCheck {
+		return
+	}
+	// Python extras, as in flask[async], are not part of the
+	// name in the index.
+	lookup := []api.PkgName{}
+	for _, pkg := range pkgs {
+		lookup = append(lookup, api.PkgName(strings.SplitN(string(pkg), "[", 2)[0]))
+	}
+	s := silenceSubroutines()
+	infos, errs := lookupInfos(b, lookup)
+	s.restore()
+
+	for i, pkg := range pkgs {
+		if errs[i] != nil {
+			util.Verbosef("could not check that %s exists: %s", pkg, errs[i])
+			continue
+		}
+		if infos[i].Name == "" {
+			util.DieConsistency("no such package: %s%s", pkg, didYouMean(string(pkg), registryCandidates(b, string(pkg))))
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package cli
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/util"
+)
+
+// toolInstallers lists the documented ways of installing the package
+// managers that --install-tools can install, in order of preference.
+// Language runtimes such as python3 and node are never installed.
+var toolInstallers = map[string][][]string{
+	"poetry": {{"pipx", "install", "poetry"}},
+	"uv":     {{"pipx", "install", "uv"}},
+	"yarn":   {{"corepack", "enable", "yarn"}, {"npm", "install", "-g", "yarn"}},
+	"pnpm":   {{"corepack", "enable", "pnpm"}, {"npm", "install", "-g", "pnpm"}},
+	"bun":    {{"npm", "install", "-g", "bun"}},
+}
+
+// findInstaller returns the first command in toolInstallers for tool
+// whose program is on PATH, or nil if there is none.
+func findInstaller(tool string) []string {
+	for _, installer := range toolInstallers[tool] {
+		if _, err := exec.LookPath(installer[0]); err == nil {
+			return installer
+		}
+	}
+	return nil
+}
+
+// installerPrograms returns the programs that could install tool, as
+// in "corepack or npm".
+func installerPrograms(tool string) string {
+	programs := []string{}
+	for _, installer := range toolInstallers[tool] {
+		programs = append(programs, installer[0])
+	}
+	return strings.Join(programs, " or ")
+}
+
+// ensureTools makes sure that the package managers b needs are on
+// PATH. With --install-tools, a missing one is installed; otherwise
+// how to install it is shown, and the command fails later if it turns
+// out to need the tool.
+func ensureTools(b api.LanguageBackend) {
+	for _, tool := range b.Tools {
+		if _, ok := toolInstallers[tool]; !ok {
+			continue
+		}
+		if _, err := exec.LookPath(tool); err == nil {
+			continue
+		}
+		if !config.InstallTools {
+			util.Log(fmt.Sprintf(
+				"%s is not installed; %s, or rerun with --install-tools to install it",
+				tool, toolInstallHint(tool),
+			))
+			continue
+		}
+		installer := findInstaller(tool)
+		if installer == nil {
+			util.DieMissingTool("%s: not found, and %s is needed to install it", tool, installerPrograms(tool))
+		}
+		util.RunCmd(installer)
+		if config.DryRun {
+			continue
+		}
+		if _, err := exec.LookPath(tool); err != nil {
+			util.DieMissingTool("%s: installed with %s, but it is still not on PATH", tool, installer[0])
+		}
+	}
+}
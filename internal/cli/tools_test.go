@@ -0,0 +1,26 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFindInstaller(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "npm"), []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir)
+
+	if got, expected := findInstaller("yarn"), []string{"npm", "install", "-g", "yarn"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected yarn to fall back to %v, got %v", expected, got)
+	}
+	if got := findInstaller("poetry"); got != nil {
+		t.Errorf("expected no installer for poetry without pipx, got %v", got)
+	}
+	if got := findInstaller("node"); got != nil {
+		t.Errorf("expected node never to be installed, got %v", got)
+	}
+}
@@ -0,0 +1,140 @@
+package cli
+
+import (
+	"bytes"
+	"os"
+	"sync"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/util"
+)
+
+// savedFile is the contents of a file before a transaction started.
+type savedFile struct {
+	exists   bool
+	contents []byte
+	mode     os.FileMode
+}
+
+// transaction snapshots a backend's specfile and lockfile before a
+// command modifies them, so that they can be put back if the command
+// fails partway through.
+type transaction struct {
+	mu     sync.Mutex
+	files  map[string]savedFile
+	done   bool
+	remove func()
+}
+
+// beginTransaction snapshots the specfile and lockfile of b. The
+// caller must defer a call to end. Nothing is snapshotted with
+// --dry-run, since nothing is modified, or with --no-rollback.
+func beginTransaction(b api.LanguageBackend) *transaction {
+	t := &transaction{files: map[string]savedFile{}}
+	if config.DryRun || config.NoRollback {
+		t.done = true
+		return t
+	}
+
+	for _, filename := range []string{b.Specfile, b.Lockfile} {
+		if filename == "" {
+			continue
+		}
+		info, err := os.Stat(filename)
+		if os.IsNotExist(err) {
+			t.files[filename] = savedFile{}
+			continue
+		} else if err != nil {
+			util.DieIO("%s: %s", filename, err)
+		}
+		contents, err := os.ReadFile(filename)
+		if err != nil {
+			util.DieIO("%s: %s", filename, err)
+		}
+		t.files[filename] = savedFile{exists: true, contents: contents, mode: info.Mode()}
+	}
+
+	// An interrupt usually unwinds through end, once the package
+	// manager has exited, but not if UPM has to exit at once.
+	t.remove = util.OnInterrupt(t.rollback)
+
+	return t
+}
+
+// rollback restores the snapshotted files, unless the transaction
+// has already ended.
+func (t *transaction) rollback() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.done {
+		return
+	}
+	t.done = true
+	t.restore()
+}
+
+// reset restores the snapshotted files but keeps the transaction
+// going, so that a command can try something else after a failed
+// attempt. It returns false if nothing was snapshotted, as with
+// --no-rollback, or if the transaction has already ended.
+func (t *transaction) reset() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.done {
+		return false
+	}
+	t.restore()
+	return true
+}
+
+// restore writes the snapshotted files back. It must be called with
+// t.mu held.
+func (t *transaction) restore() {
+	for filename, saved := range t.files {
+		current, err := os.ReadFile(filename)
+		if os.IsNotExist(err) && !saved.exists {
+			continue
+		} else if err == nil && saved.exists && bytes.Equal(current, saved.contents) {
+			continue
+		}
+
+		if saved.exists {
+			err = os.WriteFile(filename, saved.contents, saved.mode)
+		} else {
+			err = os.Remove(filename)
+		}
+		if err != nil {
+			util.Log("could not restore", filename+":", err)
+		} else {
+			util.Log("rolled back changes to", filename)
+		}
+	}
+}
+
+// end finishes the transaction. It must be deferred: if the command
+// is dying with an error, including being interrupted, the snapshot
+// is restored before the error continues on its way; otherwise the
+// changes are kept.
+func (t *transaction) end() {
+	if t.remove != nil {
+		t.remove()
+	}
+	if r := recover(); r != nil {
+		t.rollback()
+		panic(r)
+	}
+	t.mu.Lock()
+	t.done = true
+	t.mu.Unlock()
+}
+
+// lockProject keeps other UPM processes from modifying the project
+// until the returned function is called, honoring --wait and
+// --no-lock. Nothing is locked with --dry-run.
+func lockProject() func() {
+	if config.NoLock || config.DryRun {
+		return func() {}
+	}
+	return util.LockProject(config.Wait)
+}
@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"os"
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/util"
+)
+
+func TestTransaction(t *testing.T) {
+	dir := t.TempDir()
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Chdir(cwd) }()
+	defer func(quiet bool) { config.Quiet = quiet }(config.Quiet)
+	config.Quiet = true
+
+	b := api.LanguageBackend{Specfile: "spec", Lockfile: "lock"}
+	if err := os.WriteFile("spec", []byte("flask\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	modify := func(fail bool) error {
+		return util.Catch(func() {
+			txn := beginTransaction(b)
+			defer txn.end()
+			util.TryWriteAtomic("spec", []byte("flask\nrequests\n"))
+			util.TryWriteAtomic("lock", []byte("flask==3.0.2\n"))
+			if fail {
+				util.DieSubprocess("exit status 1")
+			}
+		})
+	}
+
+	if err := modify(true); err == nil {
+		t.Fatal("expected the error to propagate")
+	}
+	if contents, _ := os.ReadFile("spec"); string(contents) != "flask\n" {
+		t.Errorf("expected spec to be restored, got %q", contents)
+	}
+	if util.Exists("lock") {
+		t.Error("expected lock to be removed")
+	}
+
+	if err := modify(false); err != nil {
+		t.Fatal(err)
+	}
+	if contents, _ := os.ReadFile("spec"); string(contents) != "flask\nrequests\n" {
+		t.Errorf("expected spec to be kept, got %q", contents)
+	}
+	if !util.Exists("lock") {
+		t.Error("expected lock to be kept")
+	}
+}
@@ -0,0 +1,106 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/util"
+)
+
+// findTypeCompanions returns the packages that declare the types of
+// the registry packages among pkgs, as b.TypeCompanions finds them,
+// keyed by their normalized names, in the order of the packages they
+// are for. Those the project already depends on are left out.
+func findTypeCompanions(b api.LanguageBackend, pkgs map[api.PkgName]api.PkgCoordinates, sourcePkgs map[api.PkgName]api.PkgCoordinates) (map[api.PkgName]api.PkgCoordinates, []string) {
+	known := map[api.PkgName]bool{}
+	names := []api.PkgName{}
+	for norm, coords := range pkgs {
+		known[norm] = true
+		if _, ok := sourcePkgs[norm]; !ok {
+			names = append(names, api.PkgName(coords.Name))
+		}
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+
+	var found map[api.PkgName]api.PkgName
+	s := silenceSubroutines()
+	err := util.Catch(func() {
+		found = b.TypeCompanions(names)
+	})
+	s.restore()
+	if err != nil {
+		util.LogError(fmt.Sprintf("cannot look up type declarations: %s", err))
+		return nil, nil
+	}
+	if len(found) > 0 && util.Exists(b.Specfile) {
+		s := silenceSubroutines()
+		for name := range b.ListSpecfile(true) {
+			known[b.NormalizePackageName(name)] = true
+		}
+		s.restore()
+	}
+
+	companions := map[api.PkgName]api.PkgCoordinates{}
+	suggested := []string{}
+	for _, name := range names {
+		types, ok := found[name]
+		norm := b.NormalizePackageName(types)
+		if !ok || known[norm] {
+			continue
+		}
+		companions[norm] = api.PkgCoordinates{Name: string(types)}
+		suggested = append(suggested, string(types))
+	}
+	return companions, suggested
+}
+
+// typeCompanions returns the packages of findTypeCompanions that the
+// user agrees to add as dev dependencies. Without a terminal to ask
+// on, they are only suggested.
+func typeCompanions(b api.LanguageBackend, pkgs map[api.PkgName]api.PkgCoordinates, sourcePkgs map[api.PkgName]api.PkgCoordinates) map[api.PkgName]api.PkgCoordinates {
+	if b.TypeCompanions == nil || !b.SupportsDev || config.NoCheck || len(pkgs) == 0 {
+		return nil
+	}
+	companions, suggested := findTypeCompanions(b, pkgs, sourcePkgs)
+	if len(suggested) == 0 {
+		return nil
+	}
+	list := strings.Join(suggested, " ")
+	if config.NoInput {
+		util.Log(fmt.Sprintf("add the type declarations of these packages with 'upm add --dev %s'", list))
+		return nil
+	}
+	if !confirm(fmt.Sprintf("Also add the type declarations %s as dev dependencies?", strings.Join(suggested, ", "))) {
+		return nil
+	}
+	return companions
+}
+
+// addTypeCompanions adds the packages that typeCompanions returned as
+// dev dependencies, after the packages they are for.
+func addTypeCompanions(ctx context.Context, b api.LanguageBackend, companions map[api.PkgName]api.PkgCoordinates, projectName string) {
+	if len(companions) == 0 {
+		return
+	}
+	dev, group := config.Dev, config.Group
+	config.Dev, config.Group = true, ""
+	defer func() {
+		config.Dev, config.Group = dev, group
+	}()
+	pkgs := map[api.PkgName]api.PkgSpec{}
+	names := []api.PkgName{}
+	for _, coords := range companions {
+		pkgs[api.PkgName(coords.Name)] = coords.Spec
+		names = append(names, api.PkgName(coords.Name))
+	}
+	reportPhase("add", names)
+	b.Add(ctx, pkgs, projectName)
+	checkSpecfileEdit(b, names, false)
+}
@@ -0,0 +1,50 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+)
+
+func TestFindTypeCompanions(t *testing.T) {
+	var looked []api.PkgName
+	b := api.LanguageBackend{
+		Name:     "test",
+		Specfile: "upm-test-no-such-specfile.json",
+		NormalizePackageName: func(name api.PkgName) api.PkgName {
+			return name
+		},
+		TypeCompanions: func(pkgs []api.PkgName) map[api.PkgName]api.PkgName {
+			looked = pkgs
+			return map[api.PkgName]api.PkgName{
+				"lodash":  "@types/lodash",
+				"express": "@types/express",
+				"react":   "@types/react",
+			}
+		},
+	}
+	pkgs := map[api.PkgName]api.PkgCoordinates{
+		"lodash":        {Name: "lodash"},
+		"express":       {Name: "express"},
+		"react":         {Name: "react"},
+		"@types/react":  {Name: "@types/react"},
+		"local-package": {Name: "local-package", Spec: "file:../local-package"},
+	}
+	sourcePkgs := map[api.PkgName]api.PkgCoordinates{"local-package": pkgs["local-package"]}
+
+	companions, suggested := findTypeCompanions(b, pkgs, sourcePkgs)
+	if expected := []api.PkgName{"@types/react", "express", "lodash", "react"}; !reflect.DeepEqual(looked, expected) {
+		t.Errorf("expected to look up %v, looked up %v", expected, looked)
+	}
+	expected := map[api.PkgName]api.PkgCoordinates{
+		"@types/express": {Name: "@types/express"},
+		"@types/lodash":  {Name: "@types/lodash"},
+	}
+	if !reflect.DeepEqual(companions, expected) {
+		t.Errorf("expected %v, got %v", expected, companions)
+	}
+	if expected := []string{"@types/express", "@types/lodash"}; !reflect.DeepEqual(suggested, expected) {
+		t.Errorf("expected to suggest %v, got %v", expected, suggested)
+	}
+}
@@ -0,0 +1,114 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/util"
+)
+
+// minTyposquatLength is the length of the shortest names that are
+// checked, since shorter names are near misses of too many others.
+const minTyposquatLength = 4
+
+// isNearMiss returns true if a and b differ by a single insertion,
+// deletion or substitution, or by swapping two adjacent characters,
+// which are the typos that typosquatters register.
+func isNearMiss(a, b string) bool {
+	if a == b {
+		return false
+	}
+	if util.Levenshtein(a, b) == 1 {
+		return true
+	}
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) != len(rb) {
+		return false
+	}
+	diffs := []int{}
+	for i := range ra {
+		if ra[i] != rb[i] {
+			diffs = append(diffs, i)
+		}
+	}
+	return len(diffs) == 2 && diffs[1] == diffs[0]+1 &&
+		ra[diffs[0]] == rb[diffs[1]] && ra[diffs[1]] == rb[diffs[0]]
+}
+
+// typosquatTargets returns the packages in popular that name, which
+// must be normalized, is a near miss of, most downloaded first. A
+// package that is popular itself, such as boto next to boto3, is not a
+// typo, while one that is not popular has far fewer downloads than
+// any that is.
+func typosquatTargets(name api.PkgName, popular map[api.PkgName]int64) []api.PkgName {
+	if _, ok := popular[name]; ok || len([]rune(string(name))) < minTyposquatLength {
+		return nil
+	}
+	targets := []api.PkgName{}
+	for candidate := range popular {
+		if isNearMiss(string(name), string(candidate)) {
+			targets = append(targets, candidate)
+		}
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		if popular[targets[i]] != popular[targets[j]] {
+			return popular[targets[i]] > popular[targets[j]]
+		}
+		return targets[i] < targets[j]
+	})
+	return targets
+}
+
+// confirm asks the user a yes-or-no question on the terminal, and
+// returns true if they answer yes. Without a terminal, the answer is
+// no.
+func confirm(question string) bool {
+	if config.NoInput {
+		return false
+	}
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
+
+// checkTyposquats warns about the packages whose names are near misses
+// of much more popular packages in the index of b, as in "reqeusts"
+// for "requests", and asks whether to add them anyway. Without a
+// terminal to ask on, it dies unless --force was given.
+func checkTyposquats(b api.LanguageBackend, pkgs []api.PkgName) {
+	if b.PopularPackages == nil || len(pkgs) == 0 || config.Force {
+		return
+	}
+	popular := b.PopularPackages()
+	for _, pkg := range pkgs {
+		name := b.NormalizePackageName(api.PkgName(strings.SplitN(string(pkg), "[", 2)[0]))
+		targets := typosquatTargets(name, popular)
+		if len(targets) == 0 {
+			continue
+		}
+		quoted := []string{}
+		for _, target := range targets {
+			quoted = append(quoted, fmt.Sprintf("%#v", string(target)))
+		}
+		warning := fmt.Sprintf("%s looks like a typo of the much more popular %s", pkg, strings.Join(quoted, " or "))
+		if config.NoInput {
+			util.DieConsistency("%s; use --force to add it anyway", warning)
+		}
+		util.LogError(warning)
+		if !confirm(fmt.Sprintf("Add %s anyway?", pkg)) {
+			util.DieConsistency("not adding %s", pkg)
+		}
+	}
+}
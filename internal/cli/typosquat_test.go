@@ -0,0 +1,54 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+)
+
+func TestIsNearMiss(t *testing.T) {
+	for _, tc := range []struct {
+		a, b     string
+		expected bool
+	}{
+		{"reqeusts", "requests", true},
+		{"request", "requests", true},
+		{"requestz", "requests", true},
+		{"requests", "requests", false},
+		{"rqeuests", "requests", true},
+		{"reuqsets", "requests", false},
+		{"flask", "django", false},
+	} {
+		if got := isNearMiss(tc.a, tc.b); got != tc.expected {
+			t.Errorf("isNearMiss(%q, %q) = %v, expected %v", tc.a, tc.b, got, tc.expected)
+		}
+	}
+}
+
+func TestTyposquatTargets(t *testing.T) {
+	popular := map[api.PkgName]int64{
+		"requests": 400000000,
+		"request":  5000000,
+		"boto3":    1000000000,
+		"boto":     8000000,
+		"six":      300000000,
+	}
+	for _, tc := range []struct {
+		name     api.PkgName
+		expected []api.PkgName
+	}{
+		{"reqeusts", []api.PkgName{"requests"}},
+		{"requestz", []api.PkgName{"requests", "request"}},
+		{"requests", nil},
+		// Popular in its own right.
+		{"boto", nil},
+		{"flask", []api.PkgName{}},
+		// Too short to check.
+		{"sux", nil},
+	} {
+		if got := typosquatTargets(tc.name, popular); !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("typosquatTargets(%q) = %v, expected %v", tc.name, got, tc.expected)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package cli
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/backends"
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/trace"
+	"github.com/replit/upm/internal/util"
+)
+
+// vendorIndexFile is the file in each language's vendor directory that
+// lists what 'upm vendor' downloaded.
+const vendorIndexFile = "index.json"
+
+// vendorIndex is the contents of vendorIndexFile.
+type vendorIndex struct {
+	Language string             `json:"language"`
+	Lockfile string             `json:"lockfile"`
+	Packages []vendorIndexEntry `json:"packages"`
+}
+
+// vendorIndexEntry is one downloaded file in a vendorIndex.
+type vendorIndexEntry struct {
+	Name    api.PkgName    `json:"name"`
+	Version api.PkgVersion `json:"version"`
+	File    string         `json:"file"`
+	URL     string         `json:"url"`
+	Hashes  []string       `json:"hashes,omitempty"`
+}
+
+// parseArtifactHash splits a hash recorded in a lockfile, either a
+// Subresource Integrity one such as "sha512-<base64>" or one such as
+// "sha256:<hex>", into a new hash function and the expected digest.
+func parseArtifactHash(h string) (func() hash.Hash, []byte, error) {
+	var alg string
+	var digest []byte
+	var err error
+	if before, after, ok := strings.Cut(h, ":"); ok {
+		alg = before
+		digest, err = hex.DecodeString(after)
+	} else if before, after, ok := strings.Cut(h, "-"); ok {
+		alg = before
+		digest, err = base64.StdEncoding.DecodeString(after)
+	} else {
+		return nil, nil, fmt.Errorf("unrecognized hash %q", h)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("malformed hash %q: %s", h, err)
+	}
+	switch alg {
+	case "sha1":
+		return sha1.New, digest, nil
+	case "sha256":
+		return sha256.New, digest, nil
+	case "sha512":
+		return sha512.New, digest, nil
+	}
+	return nil, nil, fmt.Errorf("unsupported hash algorithm %q", alg)
+}
+
+// verifyArtifact checks the file at path against the hashes of
+// artifact. Hashes with algorithms upm does not know are skipped.
+func verifyArtifact(path string, artifact api.Artifact) error {
+	for _, h := range artifact.Hashes {
+		newHash, expected, err := parseArtifactHash(h)
+		if err != nil {
+			util.Log(fmt.Sprintf("%s: %s", artifact.Filename, err))
+			continue
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		hasher := newHash()
+		_, err = io.Copy(hasher, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		if actual := hasher.Sum(nil); string(actual) != string(expected) {
+			return fmt.Errorf("%s does not match %s", artifact.Filename, h)
+		}
+	}
+	return nil
+}
+
+// downloadArtifact downloads artifact to path, through a temporary
+// file in the same directory so that an interrupted download leaves
+// nothing behind, and checks it against its hashes.
+func downloadArtifact(path string, artifact api.Artifact) {
+	res, err := api.HttpClient.Get(artifact.URL)
+	if err != nil {
+		util.DieNetwork("%s: %s", artifact.URL, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		util.DieNetwork("%s: received status code: %d", artifact.URL, res.StatusCode)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upm-vendor-*")
+	if err != nil {
+		util.DieIO("%s", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, res.Body); err != nil {
+		tmp.Close()
+		util.DieNetwork("%s: %s", artifact.URL, err)
+	}
+	if err := tmp.Close(); err != nil {
+		util.DieIO("%s", err)
+	}
+	if err := verifyArtifact(tmp.Name(), artifact); err != nil {
+		util.DieConsistency("%s: %s", artifact.URL, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		util.DieIO("%s", err)
+	}
+}
+
+// vendorSubdir returns the directory under dir for the files of b,
+// named after its language, as in "vendor/nodejs".
+func vendorSubdir(b api.LanguageBackend, dir string) string {
+	language, _, _ := strings.Cut(b.Name, "-")
+	return filepath.Join(dir, language)
+}
+
+// runVendor implements 'upm vendor', which downloads the files of the
+// locked packages to a directory from which they can be installed
+// offline, and lists them in an index there. Files that are already
+// there are not downloaded again, and files that are no longer locked
+// are removed.
+func runVendor(language string, dir string) {
+	span, ctx := trace.StartSpanFromExistingContext("runVendor")
+	defer span.Finish()
+	b := backends.GetBackend(ctx, language)
+	if b.ListLockfileArtifacts == nil {
+		dieUnsupported(b, "vendor")
+	}
+	if !util.Exists(b.Lockfile) {
+		util.DieStaleLockfile("%s is missing; run 'upm lock' first", b.Lockfile)
+	}
+
+	artifacts := b.ListLockfileArtifacts()
+	sort.Slice(artifacts, func(i, j int) bool { return artifacts[i].Filename < artifacts[j].Filename })
+	subdir := vendorSubdir(b, dir)
+
+	if config.DryRun {
+		for _, artifact := range artifacts {
+			path := filepath.Join(subdir, artifact.Filename)
+			if !util.Exists(path) {
+				fmt.Printf("would download %s to %s\n", artifact.URL, path)
+			}
+		}
+		return
+	}
+	if err := os.MkdirAll(subdir, 0o755); err != nil {
+		util.DieIO("%s", err)
+	}
+
+	index := vendorIndex{Language: b.Name, Lockfile: b.Lockfile, Packages: []vendorIndexEntry{}}
+	keep := map[string]bool{vendorIndexFile: true}
+	downloaded := 0
+	for _, artifact := range artifacts {
+		path := filepath.Join(subdir, artifact.Filename)
+		keep[artifact.Filename] = true
+		if !util.Exists(path) || verifyArtifact(path, artifact) != nil {
+			util.ProgressMsg("download " + artifact.Filename)
+			downloadArtifact(path, artifact)
+			downloaded++
+		}
+		index.Packages = append(index.Packages, vendorIndexEntry{
+			Name:    artifact.Name,
+			Version: artifact.Version,
+			File:    artifact.Filename,
+			URL:     artifact.URL,
+			Hashes:  artifact.Hashes,
+		})
+	}
+
+	entries, err := os.ReadDir(subdir)
+	if err != nil {
+		util.DieIO("%s", err)
+	}
+	removed := 0
+	for _, entry := range entries {
+		if entry.IsDir() || keep[entry.Name()] {
+			continue
+		}
+		if err := os.Remove(filepath.Join(subdir, entry.Name())); err != nil {
+			util.DieIO("%s", err)
+		}
+		removed++
+	}
+
+	outputB, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		panic("couldn't marshal json")
+	}
+	util.TryWriteAtomic(filepath.Join(subdir, vendorIndexFile), append(outputB, '\n'))
+	util.Log(fmt.Sprintf("%s: %d files, %d downloaded, %d removed", subdir, len(artifacts), downloaded, removed))
+}
@@ -0,0 +1,35 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+)
+
+func TestVerifyArtifact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pkg.tgz")
+	if err := os.WriteFile(path, []byte("hello\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		hashes []string
+		ok     bool
+	}{
+		{nil, true},
+		{[]string{"sha256:5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03"}, true},
+		{[]string{"sha512-58IrmUxZ2c8rSOVJseJGZmNgRZMNPafBrLKZ0cO3+TH5Sq5B7dosKyB6NuEPi8uNRSI+VIePWzFufOO2vAGWKQ=="}, true},
+		{[]string{"sha1-80nGPmG1HKdZMvUvy8gNMnIyOWw="}, false},
+		{[]string{"sha256:0000"}, false},
+		// Unknown algorithms are skipped.
+		{[]string{"md5-sZRqySSS0jR8YjW00mERhA=="}, true},
+	}
+	for _, c := range cases {
+		err := verifyArtifact(path, api.Artifact{Filename: "pkg.tgz", Hashes: c.hashes})
+		if (err == nil) != c.ok {
+			t.Errorf("verifyArtifact(%v) = %v, want ok %v", c.hashes, err, c.ok)
+		}
+	}
+}
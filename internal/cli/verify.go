@@ -0,0 +1,146 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/backends"
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/table"
+	"github.com/replit/upm/internal/util"
+)
+
+// runVerify implements 'upm verify', and with reproducible, 'upm
+// verify --reproducible'.
+func runVerify(language string, reproducible bool, outputFormat outputFormat) {
+	b := backends.GetBackend(context.Background(), language)
+	if reproducible {
+		runVerifyReproducible(b, outputFormat)
+		return
+	}
+	if b.VerifyInstalled == nil {
+		dieUnsupported(b, "verify")
+	}
+	if !util.Exists(b.Lockfile) {
+		util.DieStaleLockfile("%s is missing; run 'upm lock' first", b.Lockfile)
+	}
+	pkgdir := b.GetPackageDir()
+	if pkgdir == "" || !util.Exists(pkgdir) {
+		util.DieInitializationError("no packages are installed; run 'upm install' first")
+	}
+
+	s := silenceSubroutines()
+	issues := b.VerifyInstalled(pkgdir)
+	s.restore()
+
+	switch outputFormat {
+	case outputFormatTable:
+		if len(issues) == 0 {
+			util.Log(fmt.Sprintf("the packages in %s match %s", pkgdir, b.Lockfile))
+			return
+		}
+		t := table.FromStructs(issues)
+		t.Print()
+
+	case outputFormatJSON:
+		outputB, err := json.Marshal(issues)
+		if err != nil {
+			panic("couldn't marshal json")
+		}
+		fmt.Println(string(outputB))
+
+	default:
+		util.Panicf("unknown output format %d", outputFormat)
+	}
+
+	if len(issues) > 0 {
+		util.DieConsistency("%s: %d discrepancies with %s", pkgdir, len(issues), b.Lockfile)
+	}
+}
+
+// copyLockInputs copies the specfile and lockfile of b, and those of
+// its LockInputs that exist, to dir.
+func copyLockInputs(b api.LanguageBackend, dir string) {
+	for _, input := range append([]string{b.Specfile, b.Lockfile}, b.LockInputs...) {
+		err := filepath.WalkDir(input, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			return copyFile(path, filepath.Join(dir, path))
+		})
+		if err != nil && !os.IsNotExist(err) {
+			util.DieIO("%s", err)
+		}
+	}
+}
+
+// runVerifyReproducible implements 'upm verify --reproducible', which
+// locks again in a temporary directory and checks that the lockfile
+// comes out the same. The existing lockfile is kept there as the
+// starting point, so that new releases do not count as differences;
+// what is found is a lockfile edited by hand, merged badly, out of
+// date with the specfile, or written by another version of the
+// package manager.
+func runVerifyReproducible(b api.LanguageBackend, outputFormat outputFormat) {
+	if b.QuirksIsNotReproducible() {
+		util.DieUnimplemented("%s has no lockfile, so its installs cannot be reproduced", b.Name)
+	}
+	if b.Relock == nil {
+		dieUnsupported(b, "verify-reproducible")
+	}
+	if !util.Exists(b.Specfile) {
+		util.DieIO("%s: no such file", b.Specfile)
+	}
+	if !util.Exists(b.Lockfile) {
+		util.DieStaleLockfile("%s is missing; run 'upm lock' first", b.Lockfile)
+	}
+	ensureTools(b)
+
+	original, err := os.ReadFile(b.Lockfile)
+	if err != nil {
+		util.DieIO("%s", err)
+	}
+	locked := lockedVersions(b)
+
+	tempdir := util.TempDir()
+	defer os.RemoveAll(tempdir)
+	copyLockInputs(b, tempdir)
+	var relocked []byte
+	var relockedVersions map[api.PkgName]api.PkgVersion
+	inDir(tempdir, func() {
+		b.Relock(context.Background())
+		if config.DryRun {
+			return
+		}
+		if relocked, err = os.ReadFile(b.Lockfile); err != nil {
+			util.DieIO("%s", err)
+		}
+		relockedVersions = lockedVersions(b)
+	})
+	if config.DryRun {
+		return
+	}
+
+	if bytes.Equal(original, relocked) {
+		util.Log(fmt.Sprintf("%s is reproducible from %s", b.Lockfile, b.Specfile))
+		return
+	}
+	changes := diffLockfile(locked, relockedVersions)
+	if len(changes) == 0 && outputFormat == outputFormatTable {
+		// The same versions are locked, but something else
+		// differs, such as hashes or the format.
+		fmt.Print(util.UnifiedDiff(b.Lockfile, string(original), string(relocked)))
+	} else {
+		printChanges(changes, b.Lockfile, "when locked again", outputFormat)
+	}
+	util.DieConsistency("%s is not reproducible: locking again changes it", b.Lockfile)
+}
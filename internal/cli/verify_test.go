@@ -0,0 +1,62 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+)
+
+func TestCopyLockInputs(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	for _, path := range []string{"spec", "lock", "config/a", "config/b/c", "unrelated"} {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(path), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b := api.LanguageBackend{Specfile: "spec", Lockfile: "lock", LockInputs: []string{"config", "missing"}}
+	dir := t.TempDir()
+	copyLockInputs(b, dir)
+
+	copied := []string{}
+	err = filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		contentsB, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if string(contentsB) != filepath.ToSlash(rel) {
+			t.Errorf("%s: expected %q, got %q", rel, rel, contentsB)
+		}
+		copied = append(copied, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(copied)
+	expected := []string{"config/a", "config/b/c", "lock", "spec"}
+	if !reflect.DeepEqual(copied, expected) {
+		t.Errorf("expected %q, got %q", expected, copied)
+	}
+}
@@ -0,0 +1,96 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/backends"
+	"github.com/replit/upm/internal/util"
+)
+
+// whichProvidesJSON is the JSON output of 'upm which-provides'.
+type whichProvidesJSON struct {
+	Command    string `json:"command"`
+	Backend    string `json:"backend"`
+	Package    string `json:"package"`
+	Dependency bool   `json:"dependency"`
+}
+
+// providersElsewhere returns the packages that provide command for
+// the backends among bs whose CommandPackages are not those of b, as in
+// "eslint for nodejs-npm", sorted. Backends of the same language share
+// their CommandPackages, and only the first of them is named.
+func providersElsewhere(b api.LanguageBackend, bs []api.LanguageBackend, command string) []string {
+	seen := map[uintptr]bool{reflect.ValueOf(b.CommandPackages).Pointer(): true}
+	providers := []string{}
+	for _, other := range bs {
+		id := reflect.ValueOf(other.CommandPackages).Pointer()
+		pkg, ok := other.CommandPackages[command]
+		if !ok || seen[id] {
+			continue
+		}
+		seen[id] = true
+		providers = append(providers, fmt.Sprintf("%s for %s", pkg, other.Name))
+	}
+	sort.Strings(providers)
+	return providers
+}
+
+// runWhichProvides implements 'upm which-provides', printing the
+// package that provides a command, as b.CommandPackages knows it.
+// If no package of the project's language does, the packages of other
+// languages that do are named instead.
+func runWhichProvides(language string, command string, outputFormat outputFormat) {
+	b := backends.GetBackend(context.Background(), language)
+	name := path.Base(command)
+	pkg, ok := b.CommandPackages[name]
+	if !ok {
+		msg := fmt.Sprintf("no %s package is known to provide %s", b.Name, name)
+		if elsewhere := providersElsewhere(b, backends.GetBackends(""), name); len(elsewhere) > 0 {
+			msg += fmt.Sprintf("; it is provided by %s", strings.Join(elsewhere, " and "))
+		}
+		util.DieConsistency("%s", msg)
+	}
+
+	dependency := false
+	if util.Exists(b.Specfile) {
+		s := silenceSubroutines()
+		for dep := range b.ListSpecfile(true) {
+			if b.NormalizePackageName(dep) == b.NormalizePackageName(pkg) {
+				dependency = true
+			}
+		}
+		s.restore()
+	}
+
+	switch outputFormat {
+	case outputFormatTable:
+		fmt.Println(pkg)
+		if dependency {
+			util.Log(fmt.Sprintf("the project already depends on %s", pkg))
+		} else {
+			util.Log(fmt.Sprintf("add it with 'upm add %s'", pkg))
+		}
+
+	case outputFormatJSON:
+		outputB, err := json.Marshal(whichProvidesJSON{
+			Command:    name,
+			Backend:    b.Name,
+			Package:    string(pkg),
+			Dependency: dependency,
+		})
+		if err != nil {
+			panic("couldn't marshal json")
+		}
+		fmt.Println(string(outputB))
+
+	default:
+		util.Panicf("unknown output format %d", outputFormat)
+	}
+}
@@ -0,0 +1,32 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+)
+
+func TestProvidersElsewhere(t *testing.T) {
+	python := map[string]api.PkgName{"black": "black", "pytest": "pytest"}
+	nodejs := map[string]api.PkgName{"eslint": "eslint", "prettier": "prettier"}
+	bs := []api.LanguageBackend{
+		{Name: "python-python3-pip", CommandPackages: python},
+		{Name: "python-python3-poetry", CommandPackages: python},
+		{Name: "nodejs-npm", CommandPackages: nodejs},
+		{Name: "bun", CommandPackages: nodejs},
+		{Name: "ruby-bundler", CommandPackages: map[string]api.PkgName{"prettier": "prettier-rb"}},
+		{Name: "elisp-cask"},
+	}
+
+	for command, expected := range map[string][]string{
+		"eslint":   {"eslint for nodejs-npm"},
+		"prettier": {"prettier for nodejs-npm", "prettier-rb for ruby-bundler"},
+		"black":    {},
+		"make":     {},
+	} {
+		if actual := providersElsewhere(bs[0], bs, command); !reflect.DeepEqual(actual, expected) {
+			t.Errorf("%s: expected %v, got %v", command, expected, actual)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/replit/upm/internal/backends"
+	"github.com/replit/upm/internal/util"
+	"github.com/replit/upm/internal/workspace"
+	"github.com/spf13/cobra"
+)
+
+// workspaceFlags holds the values of --workspace, --all-workspaces
+// and --recursive.
+type workspaceFlags struct {
+	name      string
+	all       bool
+	recursive bool
+}
+
+// addWorkspaceFlags registers --workspace and --all-workspaces on cmd,
+// and --recursive as well if recursive is set, and checks that they
+// are not combined before the positional arguments are checked by
+// args.
+func addWorkspaceFlags(cmd *cobra.Command, flags *workspaceFlags, recursive bool, args cobra.PositionalArgs) {
+	cmd.Flags().StringVar(
+		&flags.name, "workspace", "", "run in the workspace member with this name or path",
+	)
+	cmd.Flags().BoolVar(
+		&flags.all, "all-workspaces", false, "run in every workspace member",
+	)
+	if recursive {
+		cmd.Flags().BoolVarP(
+			&flags.recursive, "recursive", "r", false, "run in every project found in this directory and its subdirectories",
+		)
+	}
+	cmd.Args = func(cmd *cobra.Command, positional []string) error {
+		given := 0
+		for _, set := range []bool{flags.name != "", flags.all, flags.recursive} {
+			if set {
+				given++
+			}
+		}
+		if given > 1 {
+			return errors.New("--workspace, --all-workspaces and --recursive are mutually exclusive")
+		}
+		if args == nil {
+			return nil
+		}
+		return args(cmd, positional)
+	}
+}
+
+// selectWorkspaces returns the workspace members of the project in the
+// current directory that the flags select, each directory once, or nil
+// if none of the flags was given. With --recursive, every directory
+// with the specfile of some backend is a member.
+func selectWorkspaces(flags workspaceFlags) []workspace.Member {
+	if flags.recursive {
+		specfiles := []string{}
+		for _, b := range backends.GetBackends("") {
+			specfiles = append(specfiles, b.Specfile)
+		}
+		members, err := workspace.Discover(".", specfiles)
+		if err != nil {
+			util.DieIO("%s", err)
+		}
+		if len(members) == 0 {
+			util.DieInitializationError("no projects found in this directory or its subdirectories")
+		}
+		return members
+	}
+	if flags.name == "" && !flags.all {
+		return nil
+	}
+	found, err := workspace.Find(".")
+	if err != nil {
+		util.DieConsistency("%s", err)
+	}
+	if len(found) == 0 {
+		util.DieConsistency("no workspaces found (looked for workspaces in package.json and pnpm-workspace.yaml, " +
+			"path dependencies in pyproject.toml, and [workspace] in Cargo.toml)")
+	}
+
+	if !flags.all {
+		selected := workspace.Select(found, flags.name)
+		if len(selected) == 0 {
+			names := []string{}
+			for _, member := range found {
+				names = append(names, member.Name)
+			}
+			util.DieConsistency("no workspace member named %s%s", flags.name, didYouMean(flags.name, names))
+		}
+		found = selected
+	}
+
+	seen := map[string]bool{}
+	members := []workspace.Member{}
+	for _, member := range found {
+		if !seen[member.Path] {
+			seen[member.Path] = true
+			members = append(members, member)
+		}
+	}
+	return members
+}
+
+// inDir runs fn with dir as the working directory, and changes back
+// afterwards, also if fn dies.
+func inDir(dir string, fn func()) {
+	wd, err := os.Getwd()
+	if err != nil {
+		util.DieIO("%s", err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		util.DieIO("%s", err)
+	}
+	defer func() {
+		if err := os.Chdir(wd); err != nil {
+			util.DieIO("%s", err)
+		}
+	}()
+	fn()
+}
+
+// inWorkspace runs fn with the directory of member as the working
+// directory, as inDir does.
+func inWorkspace(member workspace.Member, fn func()) {
+	if info, err := os.Stat(member.Path); err != nil || !info.IsDir() {
+		util.DieIO("workspace %s: %s is not a directory", member.Name, member.Path)
+	}
+	inDir(member.Path, fn)
+}
+
+// forEachWorkspace runs fn in each of members, announcing each one if
+// there are several, or in the current directory if members is nil. A
+// failure does not stop the others, as described for keepGoing.
+func forEachWorkspace(members []workspace.Member, fn func()) {
+	if members == nil {
+		fn()
+		return
+	}
+	keepGoing(len(members), func(i int) {
+		member := members[i]
+		if len(members) > 1 && member.Name == member.Path {
+			util.Log("==> " + member.Path)
+		} else if len(members) > 1 {
+			util.Log(fmt.Sprintf("==> %s (%s)", member.Name, member.Path))
+		}
+		inWorkspace(member, fn)
+	})
+}
@@ -0,0 +1,119 @@
+package cli
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/util"
+	"github.com/replit/upm/internal/workspace"
+)
+
+func TestSelectWorkspaces(t *testing.T) {
+	dir := t.TempDir()
+	for name, contents := range map[string]string{
+		"package.json":              `{"workspaces": ["packages/*"]}`,
+		"pnpm-workspace.yaml":       "packages:\n  - packages/*\n",
+		"packages/web/package.json": `{"name": "@acme/web"}`,
+		"packages/api/package.json": `{"name": "api"}`,
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Chdir(cwd) }()
+
+	if members := selectWorkspaces(workspaceFlags{}); members != nil {
+		t.Errorf("expected no members without flags, got %+v", members)
+	}
+
+	// Both kinds of workspace list the same directories, which
+	// are only selected once.
+	expected := []workspace.Member{
+		{Name: "api", Path: "packages/api", Kind: workspace.KindPackageJSON},
+		{Name: "@acme/web", Path: "packages/web", Kind: workspace.KindPackageJSON},
+	}
+	if members := selectWorkspaces(workspaceFlags{all: true}); !reflect.DeepEqual(members, expected) {
+		t.Errorf("expected %+v, got %+v", expected, members)
+	}
+	if members := selectWorkspaces(workspaceFlags{name: "@acme/web"}); !reflect.DeepEqual(members, expected[1:]) {
+		t.Errorf("expected %+v, got %+v", expected[1:], members)
+	}
+
+	err = util.Catch(func() { selectWorkspaces(workspaceFlags{name: "apx"}) })
+	if expected := `no workspace member named apx (did you mean "api"?)`; err == nil || err.Error() != expected {
+		t.Errorf("expected %q, got %v", expected, err)
+	}
+
+	members := selectWorkspaces(workspaceFlags{recursive: true})
+	paths := []string{}
+	for _, member := range members {
+		paths = append(paths, member.Path)
+	}
+	if !reflect.DeepEqual(paths, []string{".", "packages/api", "packages/web"}) {
+		t.Errorf("expected every directory with a package.json with --recursive, got %+v", members)
+	}
+
+	var visited []string
+	forEachWorkspace(expected, func() {
+		wd, _ := os.Getwd()
+		visited = append(visited, filepath.Base(wd))
+	})
+	if !reflect.DeepEqual(visited, []string{"api", "web"}) {
+		t.Errorf("expected to visit api and web, visited %v", visited)
+	}
+	if wd, _ := os.Getwd(); filepath.Base(wd) != filepath.Base(dir) {
+		t.Errorf("expected to return to %s, in %s", dir, wd)
+	}
+}
+
+func TestKeepGoing(t *testing.T) {
+	defer func(quiet, failFast bool) {
+		config.Quiet, config.FailFast = quiet, failFast
+	}(config.Quiet, config.FailFast)
+	config.Quiet = true
+
+	ran := []int{}
+	fail := func(i int) {
+		ran = append(ran, i)
+		switch i {
+		case 0:
+			util.DieNetwork("registry down")
+		case 1:
+			util.DieConflict("versions conflict")
+		}
+	}
+
+	err := util.Catch(func() { keepGoing(3, fail) })
+	var dieErr *util.Error
+	if !errors.As(err, &dieErr) || dieErr.Code != util.ExitNetwork || dieErr.Msg != "2 of 3 failed" {
+		t.Errorf("expected the first failure's code, got %#v", err)
+	}
+	if !reflect.DeepEqual(ran, []int{0, 1, 2}) {
+		t.Errorf("expected every call to run, got %v", ran)
+	}
+
+	config.FailFast = true
+	ran = nil
+	err = util.Catch(func() { keepGoing(3, fail) })
+	if !errors.As(err, &dieErr) || dieErr.Msg != "registry down" {
+		t.Errorf("expected the first failure, got %#v", err)
+	}
+	if !reflect.DeepEqual(ran, []int{0}) {
+		t.Errorf("expected --fail-fast to stop at the first failure, got %v", ran)
+	}
+}
@@ -1,7 +1,105 @@
 // Package config contains global variables that are set according to
-// the command line. They can be accessed from anywhere within a
-// language backend.
+// the command line and the configuration files. They can be accessed
+// from anywhere within a language backend.
 package config
 
 // Quiet is true if --quiet was passed on the command line.
 var Quiet bool
+
+// Verbose is true if --verbose was passed on the command line. It
+// enables extra progress messages and overrides Quiet.
+var Verbose bool
+
+// Debug is true if --debug was passed on the command line. It implies
+// Verbose, and additionally reports the duration and exit code of
+// every subprocess.
+var Debug bool
+
+// Proxy is the value of --proxy, or the empty string if it was not
+// passed. If it is nonempty, it overrides HTTP_PROXY and HTTPS_PROXY.
+var Proxy string
+
+// Dev is true if --dev was passed to 'upm add', meaning that the
+// packages should be added as development dependencies.
+var Dev bool
+
+// Group is the value of --group for 'upm add', naming the dependency
+// group the packages should be added to.
+var Group string
+
+// Reason is the value of --reason for 'upm add', explaining why the
+// packages are needed. It is recorded as a comment in the specfile.
+var Reason string
+
+// Prod is true if --prod was passed to 'upm install', meaning that
+// development dependencies should not be installed.
+var Prod bool
+
+// Frozen is true if --frozen was passed to 'upm install', meaning
+// that the lockfile must be used as-is and never regenerated.
+var Frozen bool
+
+// DryRun is true if --dry-run was passed on the command line. Backends
+// should print the commands and file changes they would make instead
+// of making them.
+var DryRun bool
+
+// NoRollback is true if --no-rollback was passed to a command that
+// modifies the project, meaning that the specfile and lockfile should
+// be left as they are if the command fails.
+var NoRollback bool
+
+// Wait is true if --wait was passed to a command that modifies the
+// project, meaning that it should wait for another UPM process
+// modifying the same project to finish instead of failing.
+var Wait bool
+
+// NoLock is true if --no-lock was passed to a command that modifies
+// the project, meaning that it should not lock the project at all.
+var NoLock bool
+
+// NoCheck is true if --no-check was passed to 'upm add', meaning that
+// it should not check that the packages exist in the registry before
+// adding them.
+var NoCheck bool
+
+// Force is true if --force was passed to 'upm add', meaning that it
+// should add packages whose names are near misses of much more popular
+// packages without asking.
+var Force bool
+
+// SpecPolicy is the value of --guess-spec, which overrides the
+// add_spec_policy setting: how 'upm add' writes the spec of a package
+// added without one, as one of SpecPolicies.
+var SpecPolicy string
+
+// Partial is true if --partial was passed to 'upm add', meaning that
+// if one of several packages cannot be added, the others are added
+// without it.
+var Partial bool
+
+// InstallTools is true if --install-tools was passed or install_tools
+// is set in the user-level configuration file, meaning that a missing
+// package manager should be installed instead of failing.
+var InstallTools bool
+
+// InProject is true if --in-project was passed or in_project is set in
+// a configuration file, meaning that environments such as a Python
+// virtualenv should be kept in the project directory.
+var InProject bool
+
+// ProgressJSON is true if --progress json was passed on the command
+// line, meaning that progress is reported as NDJSON events on stdout
+// and the output of package managers is not shown on stderr.
+var ProgressJSON bool
+
+// NoInput is true if --no-input was passed on the command line or
+// stdin is not a terminal, meaning that no package manager may wait
+// for an answer to a prompt.
+var NoInput bool
+
+// FailFast is true if --fail-fast was passed on the command line,
+// meaning that a command run for several languages or workspace
+// members stops at the first one that fails, instead of going on with
+// the others.
+var FailFast bool
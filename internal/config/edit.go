@@ -0,0 +1,172 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/replit/upm/internal/specedit"
+)
+
+// Kinds of values of Definition.Kind.
+const (
+	KindString   = "string"
+	KindBool     = "bool"
+	KindInt      = "int"
+	KindDuration = "duration"
+	KindList     = "list"
+)
+
+// Definition describes a setting that 'upm config set' can write.
+type Definition struct {
+	// Key is the dotted key of the setting. A last part of "*"
+	// stands for any name, as in "timeouts.*".
+	Key string
+
+	// Kind is the type of the value, one of the Kind* constants.
+	Kind string
+
+	// Default is what applies when no configuration file sets the
+	// setting, or "" if that is nothing.
+	Default string
+
+	Description string
+
+	// UserOnly is true for the settings that are only honored in the
+	// user-level configuration file.
+	UserOnly bool
+}
+
+// Definitions are the settings of File that 'upm config' knows about,
+// which are all of them but hooks and backends, and the policy of the
+// organization configuration file.
+var Definitions = []Definition{
+	{Key: "language", Kind: KindString, Description: "default for --lang"},
+	{Key: "format", Kind: KindString, Default: "table", Description: `default for --format ("table" or "json")`},
+	{Key: "timeout", Kind: KindDuration, Description: "kill package manager commands after this long"},
+	{Key: "timeouts.*", Kind: KindDuration, Description: "timeout for one program, overriding timeout"},
+	{Key: "retries", Kind: KindInt, Default: strconv.Itoa(DefaultRetries), Description: "retries after a transient registry error"},
+	{Key: "min_release_age", Kind: KindDuration, Description: "never add versions published more recently than this"},
+	{Key: "add_spec_policy", Kind: KindString, Description: `spec of packages added without one ("exact", "caret", "tilde" or "none")`},
+	{Key: "in_project", Kind: KindBool, Default: "false", Description: "default for --in-project"},
+	{Key: "install_tools", Kind: KindBool, Default: "false", Description: "default for --install-tools", UserOnly: true},
+	{Key: "update_check", Kind: KindBool, Default: "false", Description: "say when a newer upm is released", UserOnly: true},
+	{Key: "stats", Kind: KindBool, Default: "false", Description: "record usage statistics for upm stats"},
+	{Key: "registries.npm", Kind: KindString, Default: "https://registry.npmjs.org", Description: "npm registry"},
+	{Key: "registries.pypi", Kind: KindString, Default: "https://pypi.org", Description: "Python package index"},
+	{Key: "registries.pypistats", Kind: KindString, Default: "https://pypistats.org", Description: "download counts for upm search --sort downloads"},
+	{Key: "registries.npmstats", Kind: KindString, Default: "https://api.npmjs.org", Description: "npm download counts for upm info"},
+	{Key: "registries.melpa", Kind: KindString, Default: "https://melpa.org", Description: "elisp search without scripts"},
+	{Key: "guess.ignore", Kind: KindList, Description: "packages never suggested by upm guess"},
+	{Key: "guess.ignore_modules", Kind: KindList, Description: "imported modules that upm guess skips"},
+	{Key: "guess.ignore_paths", Kind: KindList, Description: "paths, as in .gitignore, that upm guess does not scan"},
+	{Key: "guess.extra", Kind: KindList, Description: "packages always suggested by upm guess"},
+	{Key: "guess.by_downloads", Kind: KindBool, Default: "false", Description: "suggest the most downloaded package that provides a module"},
+	{Key: "sandbox.disable_scripts", Kind: KindBool, Default: "false", Description: "query registries over HTTP instead of running scripts"},
+	{Key: "sandbox.isolate_network", Kind: KindBool, Default: "false", Description: "no network for scripts that do not need it (Linux)"},
+}
+
+// LookupDefinition returns the definition of the setting with the
+// dotted key, and whether there is one.
+func LookupDefinition(key string) (Definition, bool) {
+	for _, def := range Definitions {
+		if def.Key == key {
+			return def, true
+		}
+		if prefix := strings.TrimSuffix(def.Key, "*"); prefix != def.Key &&
+			strings.HasPrefix(key, prefix) && key != prefix && !strings.Contains(key[len(prefix):], ".") {
+			return def, true
+		}
+	}
+	return Definition{}, false
+}
+
+// ParseValue parses value, as given on the command line, as a value of
+// the setting def. Lists are comma-separated.
+func ParseValue(def Definition, value string) (interface{}, error) {
+	switch def.Kind {
+	case KindBool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %#v (must be true or false)", def.Key, value)
+		}
+		return b, nil
+	case KindInt:
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid %s %#v (must be a number that is not negative)", def.Key, value)
+		}
+		return n, nil
+	case KindDuration:
+		if d, err := time.ParseDuration(value); err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid %s %#v (must be a duration such as \"10m\")", def.Key, value)
+		}
+		return value, nil
+	case KindList:
+		items := []string{}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		return items, nil
+	}
+	return value, nil
+}
+
+// splitKey splits a dotted key into the table that holds it, or "" for
+// the root table, and its key in that table.
+func splitKey(key string) (string, string) {
+	if idx := strings.Index(key, "."); idx >= 0 {
+		return key[:idx], key[idx+1:]
+	}
+	return "", key
+}
+
+// editFile applies edit to the configuration file at path, which need
+// not exist, and writes the result if it is still a valid
+// configuration file.
+func editFile(path string, edit func(doc []byte) ([]byte, error)) error {
+	doc, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	updated, err := edit(doc)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	var f File
+	if _, err := toml.Decode(string(updated), &f); err != nil {
+		return fmt.Errorf("%s: the change would make it invalid: %w", path, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, updated, 0o644)
+}
+
+// SetValue sets the setting with the dotted key to value, from
+// ParseValue, in the configuration file at path, keeping the rest of
+// the file as it is.
+func SetValue(path, key string, value interface{}) error {
+	table, name := splitKey(key)
+	return editFile(path, func(doc []byte) ([]byte, error) {
+		return specedit.SetTOML(doc, table, name, value)
+	})
+}
+
+// UnsetValue removes the setting with the dotted key from the
+// configuration file at path, if it is there.
+func UnsetValue(path, key string) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+	table, name := splitKey(key)
+	return editFile(path, func(doc []byte) ([]byte, error) {
+		return specedit.DeleteTOML(doc, table, name)
+	})
+}
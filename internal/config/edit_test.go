@@ -0,0 +1,98 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLookupDefinition(t *testing.T) {
+	for key, expected := range map[string]string{
+		"language":         "language",
+		"registries.npm":   "registries.npm",
+		"timeouts.npm":     "timeouts.*",
+		"timeouts.":        "",
+		"timeouts.npm.x":   "",
+		"registries.cargo": "",
+		"hooks":            "",
+	} {
+		def, ok := LookupDefinition(key)
+		if ok != (expected != "") || def.Key != expected {
+			t.Errorf("LookupDefinition(%q) = %q, %v, expected %q", key, def.Key, ok, expected)
+		}
+	}
+}
+
+func TestParseValue(t *testing.T) {
+	for _, tc := range []struct {
+		key, value string
+		expected   interface{}
+	}{
+		{"language", "nodejs-npm", "nodejs-npm"},
+		{"stats", "true", true},
+		{"retries", "3", 3},
+		{"timeout", "10m", "10m"},
+		{"guess.ignore", "a, b,,c", []string{"a", "b", "c"}},
+	} {
+		def, _ := LookupDefinition(tc.key)
+		got, err := ParseValue(def, tc.value)
+		if err != nil {
+			t.Errorf("ParseValue(%s, %q): %s", tc.key, tc.value, err)
+		} else if !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("ParseValue(%s, %q) = %#v, expected %#v", tc.key, tc.value, got, tc.expected)
+		}
+	}
+	for key, value := range map[string]string{
+		"stats":   "yes please",
+		"retries": "-1",
+		"timeout": "soon",
+	} {
+		def, _ := LookupDefinition(key)
+		if _, err := ParseValue(def, value); err == nil {
+			t.Errorf("expected ParseValue(%s, %q) to fail", key, value)
+		}
+	}
+}
+
+func TestSetValue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "upm", "config.toml")
+	if err := SetValue(path, "language", "python3-poetry"); err != nil {
+		t.Fatal(err)
+	}
+	writeConfig(t, path, "# defaults\nlanguage = \"python3-poetry\"  # for now\n")
+	if err := SetValue(path, "language", "nodejs-npm"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetValue(path, "registries.npm", "https://npm.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetValue(path, "retries", 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := UnsetValue(path, "retries"); err != nil {
+		t.Fatal(err)
+	}
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `# defaults
+language = "nodejs-npm"  # for now
+
+[registries]
+npm = "https://npm.example.com"
+`
+	if string(contents) != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, contents)
+	}
+
+	// An inline table cannot have keys added under a header.
+	writeConfig(t, path, `registries = { pypi = "https://pypi.example.com" }`+"\n")
+	if err := SetValue(path, "registries.npm", "https://npm.example.com"); err == nil {
+		t.Error("expected a change that makes the file invalid to be refused")
+	}
+	if err := UnsetValue(filepath.Join(t.TempDir(), "missing.toml"), "language"); err != nil {
+		t.Errorf("expected unsetting in a missing file to do nothing, got %s", err)
+	}
+}
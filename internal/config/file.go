@@ -0,0 +1,486 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/replit/upm/internal/policy"
+)
+
+// ProjectConfigFile is the location of the project-level configuration
+// file, relative to the project root.
+const ProjectConfigFile = ".upm/config.toml"
+
+// File is the schema of the UPM configuration files. Every field is
+// optional; the zero value means "use the built-in default".
+type File struct {
+	// Language is the default for --lang.
+	Language string `toml:"language"`
+
+	// Format is the default for --format ("table" or "json").
+	Format string `toml:"format"`
+
+	// Timeout bounds every subprocess UPM runs, e.g. "10m".
+	Timeout string `toml:"timeout"`
+
+	// Timeouts maps program names, e.g. "npm", to a timeout for
+	// that program that overrides Timeout.
+	Timeouts map[string]string `toml:"timeouts"`
+
+	// Retries is how many times a subprocess that fails with a
+	// transient registry error is retried. It defaults to
+	// DefaultRetries; 0 disables retrying.
+	Retries *int `toml:"retries"`
+
+	// MinReleaseAge is how long ago a version must have been
+	// published for 'upm add' to pick it, e.g. "72h", so that a
+	// malicious release has time to be found and pulled first.
+	MinReleaseAge string `toml:"min_release_age"`
+
+	// AddSpecPolicy is the default for 'upm add --guess-spec', one of
+	// SpecPolicies.
+	AddSpecPolicy string `toml:"add_spec_policy"`
+
+	// Registries maps a registry name ("npm" or "pypi") to the base
+	// URL that should be used instead of the public one.
+	Registries map[string]string `toml:"registries"`
+
+	// Guess configures 'upm guess' and 'upm add --guess'.
+	Guess GuessConfig `toml:"guess"`
+
+	// Sandbox configures the scripts that backends run to query
+	// registries and the environment.
+	Sandbox SandboxConfig `toml:"sandbox"`
+
+	// Backends maps the names of external language backends to
+	// their executables, for backends that are not installed as
+	// upm-backend-* on PATH.
+	Backends map[string]string `toml:"backends"`
+
+	// InProject is the default for --in-project.
+	InProject bool `toml:"in_project"`
+
+	// InstallTools is the default for --install-tools. It is only
+	// honored in the user-level configuration file, so that cloning
+	// a project cannot make UPM install programs.
+	InstallTools bool `toml:"install_tools"`
+
+	// UpdateCheck makes UPM tell the user when a newer release is
+	// out. Like InstallTools, it is only honored in the user-level
+	// configuration file.
+	UpdateCheck bool `toml:"update_check"`
+
+	// Stats makes UPM record how often each command runs and how
+	// long it takes, for 'upm stats'. Nothing leaves the machine.
+	Stats bool `toml:"stats"`
+
+	// Hooks are run after 'upm add', 'upm remove' and 'upm install'
+	// succeed, in order, the user-level ones first.
+	Hooks []Hook `toml:"hooks"`
+
+	// Policy is a dependency policy that every project must follow,
+	// in addition to its own policy file. It is only honored in the
+	// organization configuration file.
+	Policy *policy.Policy `toml:"policy"`
+}
+
+// HookEvents are the commands after which hooks can run.
+var HookEvents = []string{"add", "remove", "install"}
+
+// Hook is an entry of the [[hooks]] array of a configuration file.
+// Exactly one of Run and Template is set.
+type Hook struct {
+	// On lists the commands after which the hook runs, from
+	// HookEvents. An empty list means all of them.
+	On []string `toml:"on"`
+
+	// Run is a shell command. It gets the command that ran, the
+	// backend and the packages concerned in the UPM_EVENT,
+	// UPM_LANGUAGE and UPM_PACKAGES environment variables.
+	Run string `toml:"run"`
+
+	// Template names one of the hooks built into UPM.
+	Template string `toml:"template"`
+
+	// Socket is the Unix socket that the "notify" template writes
+	// to.
+	Socket string `toml:"socket"`
+}
+
+// RunsOn returns whether the hook runs after the named command.
+func (h Hook) RunsOn(event string) bool {
+	if len(h.On) == 0 {
+		return true
+	}
+	for _, on := range h.On {
+		if on == event {
+			return true
+		}
+	}
+	return false
+}
+
+// validate checks that the hook is well-formed.
+func (h Hook) validate() error {
+	if (h.Run == "") == (h.Template == "") {
+		return fmt.Errorf("a hook needs exactly one of run and template")
+	}
+	for _, on := range h.On {
+		valid := false
+		for _, event := range HookEvents {
+			valid = valid || on == event
+		}
+		if !valid {
+			return fmt.Errorf("invalid hook event %#v (must be one of %s)", on, strings.Join(HookEvents, ", "))
+		}
+	}
+	return nil
+}
+
+// GuessConfig is the [guess] table of a configuration file.
+type GuessConfig struct {
+	// Ignore lists packages that are never suggested by guess.
+	Ignore []string `toml:"ignore"`
+
+	// IgnoreModules lists imported modules that guess should skip,
+	// such as generated code or vendored libraries. A module also
+	// covers its submodules ("foo" covers "foo.bar" and "foo/bar").
+	IgnoreModules []string `toml:"ignore_modules"`
+
+	// IgnorePaths lists paths, in the syntax of .gitignore and
+	// relative to the project, that the source scanners of guess
+	// skip on top of those that .gitignore files ignore.
+	IgnorePaths []string `toml:"ignore_paths"`
+
+	// Extra lists packages that guess always suggests, even if no
+	// import of them was found.
+	Extra []string `toml:"extra"`
+
+	// ByDownloads makes guess suggest the most downloaded of the
+	// packages that provide a module, rather than the first one
+	// the backend lists.
+	ByDownloads bool `toml:"by_downloads"`
+}
+
+// SandboxConfig is the [sandbox] table of a configuration file. Both
+// settings only make UPM more restrictive, so a project can set them
+// too.
+type SandboxConfig struct {
+	// DisableScripts makes backends query registries with their
+	// HTTP clients instead of running scripts, such as the ELPA
+	// search in Emacs, and skip the queries they have no client
+	// for.
+	DisableScripts bool `toml:"disable_scripts"`
+
+	// IsolateNetwork runs the scripts that do not need the network
+	// in a network namespace of their own, on Linux. It needs
+	// unprivileged user namespaces.
+	IsolateNetwork bool `toml:"isolate_network"`
+}
+
+// Loaded is the merged result of the organization, user-level and
+// project-level configuration files. It is populated by Load.
+var Loaded File
+
+// Origins maps the dotted keys of the settings in Loaded, such as
+// "registries.npm", to the configuration files they come from, as
+// "org (SOURCE)", "user (PATH)" or "project (PATH)". Settings that the
+// files add to, such as hooks, can come from several. It is populated
+// by Load.
+var Origins map[string][]string
+
+// appendedSettings are the settings that each configuration file adds
+// to, rather than overrides.
+var appendedSettings = map[string]bool{
+	"hooks":                true,
+	"guess.ignore":         true,
+	"guess.ignore_modules": true,
+	"guess.ignore_paths":   true,
+	"guess.extra":          true,
+}
+
+// Timeout is the parsed form of Loaded.Timeout, or zero if there is
+// no timeout. --timeout sets it too.
+var Timeout time.Duration
+
+// CommandTimeouts is the parsed form of Loaded.Timeouts. --timeout
+// clears it, since it overrides all of the configured timeouts.
+var CommandTimeouts map[string]time.Duration
+
+// MinReleaseAge is the parsed form of Loaded.MinReleaseAge, or zero if
+// there is no minimum.
+var MinReleaseAge time.Duration
+
+// ReleaseCutoff returns the time after which versions are too new to
+// pick, given MinReleaseAge.
+func ReleaseCutoff() time.Time {
+	return time.Now().Add(-MinReleaseAge)
+}
+
+// SpecPolicies are the values of add_spec_policy and 'upm add
+// --guess-spec': how 'upm add' writes the spec of a package added
+// without one, given the version it picks, as in "1.2.3", "^1.2.3",
+// "~1.2.3" or no constraint for npm.
+var SpecPolicies = []string{"exact", "caret", "tilde", "none"}
+
+// ValidateSpecPolicy returns an error unless policy is one of
+// SpecPolicies or empty, which leaves the spec to the package manager.
+func ValidateSpecPolicy(policy string) error {
+	if policy == "" {
+		return nil
+	}
+	for _, valid := range SpecPolicies {
+		if policy == valid {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid spec policy %#v (must be one of %s)", policy, strings.Join(SpecPolicies, ", "))
+}
+
+// DefaultRetries is the number of retries when the configuration
+// files do not set one.
+const DefaultRetries = 2
+
+// Retries is the effective form of Loaded.Retries.
+var Retries = DefaultRetries
+
+// UserConfigFile returns the location of the user-level configuration
+// file, honoring XDG_CONFIG_HOME, or "" if there is no home directory.
+func UserConfigFile() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "upm", "config.toml")
+}
+
+// readFile decodes the configuration file at path. A missing file is
+// not an error.
+func readFile(path string) (File, error) {
+	var f File
+	if path == "" {
+		return f, nil
+	}
+	if _, err := toml.DecodeFile(path, &f); err != nil {
+		if os.IsNotExist(err) {
+			return f, nil
+		}
+		return f, fmt.Errorf("%s: %w", path, err)
+	}
+	return f, nil
+}
+
+// merge overlays the non-empty fields of other onto f.
+func (f *File) merge(other File) {
+	if other.Language != "" {
+		f.Language = other.Language
+	}
+	if other.Format != "" {
+		f.Format = other.Format
+	}
+	if other.Timeout != "" {
+		f.Timeout = other.Timeout
+	}
+	for program, timeout := range other.Timeouts {
+		if f.Timeouts == nil {
+			f.Timeouts = map[string]string{}
+		}
+		f.Timeouts[program] = timeout
+	}
+	if other.Retries != nil {
+		f.Retries = other.Retries
+	}
+	if other.AddSpecPolicy != "" {
+		f.AddSpecPolicy = other.AddSpecPolicy
+	}
+	if other.InProject {
+		f.InProject = true
+	}
+	if other.InstallTools {
+		f.InstallTools = true
+	}
+	if other.UpdateCheck {
+		f.UpdateCheck = true
+	}
+	if other.Stats {
+		f.Stats = true
+	}
+	if other.Sandbox.DisableScripts {
+		f.Sandbox.DisableScripts = true
+	}
+	if other.Sandbox.IsolateNetwork {
+		f.Sandbox.IsolateNetwork = true
+	}
+	for name, url := range other.Registries {
+		if f.Registries == nil {
+			f.Registries = map[string]string{}
+		}
+		f.Registries[name] = url
+	}
+	for name, path := range other.Backends {
+		if f.Backends == nil {
+			f.Backends = map[string]string{}
+		}
+		f.Backends[name] = path
+	}
+	f.Hooks = append(f.Hooks, other.Hooks...)
+	f.Guess.Ignore = append(f.Guess.Ignore, other.Guess.Ignore...)
+	f.Guess.IgnoreModules = append(f.Guess.IgnoreModules, other.Guess.IgnoreModules...)
+	f.Guess.IgnorePaths = append(f.Guess.IgnorePaths, other.Guess.IgnorePaths...)
+	f.Guess.Extra = append(f.Guess.Extra, other.Guess.Extra...)
+	if other.Guess.ByDownloads {
+		f.Guess.ByDownloads = true
+	}
+	if other.Policy != nil {
+		f.Policy = other.Policy
+	}
+}
+
+// Load reads the organization configuration file, if OrgConfigSource
+// names one, then the user-level configuration file, and then the
+// project configuration file in the current directory, each taking
+// precedence over the ones before. It must be called after changing
+// into the project directory.
+func Load() error {
+	Loaded = File{}
+	Origins = map[string][]string{}
+	Timeout = 0
+	CommandTimeouts = nil
+	Retries = DefaultRetries
+	MinReleaseAge = 0
+	for _, level := range []string{"org", "user", "project"} {
+		var f File
+		var err error
+		var path string
+		switch level {
+		case "org":
+			path = OrgConfigSource()
+			if path != "" {
+				f, err = readOrgFile(path)
+			}
+		case "user":
+			path = UserConfigFile()
+			f, err = readFile(path)
+		case "project":
+			path = ProjectConfigFile
+			f, err = readFile(path)
+		}
+		if err != nil {
+			return err
+		}
+		origin := fmt.Sprintf("%s (%s)", level, path)
+		if level == "project" {
+			f.InstallTools = false
+			f.UpdateCheck = false
+		}
+		if level != "org" {
+			f.Policy = nil
+		} else if f.Policy != nil {
+			if err := f.Policy.Validate(); err != nil {
+				return fmt.Errorf("%s: [policy]: %w", path, err)
+			}
+			f.Policy.Origin = path
+		}
+		settings, err := flatten(f)
+		if err != nil {
+			return err
+		}
+		for key := range settings {
+			if appendedSettings[key] {
+				Origins[key] = append(Origins[key], origin)
+			} else if key != "min_release_age" {
+				Origins[key] = []string{origin}
+			}
+		}
+		// Unlike the other settings, the longer of the minimum
+		// release ages wins, so that a project cannot lower
+		// the one of the user.
+		if f.MinReleaseAge != "" {
+			d, err := time.ParseDuration(f.MinReleaseAge)
+			if err != nil || d < 0 {
+				return fmt.Errorf("%s: invalid min_release_age %#v (must be a duration such as \"72h\")", path, f.MinReleaseAge)
+			}
+			if d > MinReleaseAge {
+				MinReleaseAge = d
+				Loaded.MinReleaseAge = f.MinReleaseAge
+				Origins["min_release_age"] = []string{origin}
+			}
+		}
+		Loaded.merge(f)
+	}
+	if Loaded.Timeout != "" {
+		d, err := time.ParseDuration(Loaded.Timeout)
+		if err != nil {
+			return fmt.Errorf("invalid timeout %#v: %w", Loaded.Timeout, err)
+		}
+		Timeout = d
+	}
+	for program, timeout := range Loaded.Timeouts {
+		d, err := time.ParseDuration(timeout)
+		if err != nil {
+			return fmt.Errorf("invalid timeout %#v for %s: %w", timeout, program, err)
+		}
+		if CommandTimeouts == nil {
+			CommandTimeouts = map[string]time.Duration{}
+		}
+		CommandTimeouts[program] = d
+	}
+	if Loaded.Retries != nil {
+		if *Loaded.Retries < 0 {
+			return fmt.Errorf("invalid retries %d: must not be negative", *Loaded.Retries)
+		}
+		Retries = *Loaded.Retries
+	}
+	if err := ValidateSpecPolicy(Loaded.AddSpecPolicy); err != nil {
+		return fmt.Errorf("add_spec_policy: %w", err)
+	}
+	for _, hook := range Loaded.Hooks {
+		if err := hook.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TimeoutFor returns the timeout for running the named program, or
+// zero if there is none.
+func TimeoutFor(program string) time.Duration {
+	if d, ok := CommandTimeouts[program]; ok {
+		return d
+	}
+	return Timeout
+}
+
+// Registry returns the configured base URL for the named registry, or
+// def if none was configured.
+func Registry(name, def string) string {
+	if url, ok := Loaded.Registries[name]; ok && url != "" {
+		return url
+	}
+	return def
+}
+
+// IgnoresModule returns true if the imported module mod, or a module
+// containing it, is listed in the ignore_modules setting.
+func IgnoresModule(mod string) bool {
+	for _, ignored := range Loaded.Guess.IgnoreModules {
+		if mod == ignored {
+			return true
+		}
+		if strings.HasPrefix(mod, ignored) {
+			switch mod[len(ignored)] {
+			case '.', '/':
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,220 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, path, contents string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	userDir := t.TempDir()
+	projectDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", userDir)
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(projectDir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	defer func() {
+		Loaded = File{}
+		Timeout = 0
+		CommandTimeouts = nil
+		Retries = DefaultRetries
+		MinReleaseAge = 0
+	}()
+
+	writeConfig(t, filepath.Join(userDir, "upm", "config.toml"), `
+language = "python3-pip"
+format = "json"
+retries = 5
+min_release_age = "72h"
+
+[registries]
+npm = "https://npm.example.com"
+pypi = "https://pypi.example.com"
+
+[timeouts]
+npm = "30m"
+
+[guess]
+ignore = ["internal-lib"]
+`)
+	writeConfig(t, filepath.Join(projectDir, ProjectConfigFile), `
+language = "nodejs-npm"
+timeout = "90s"
+min_release_age = "1h"
+
+[registries]
+npm = "https://npm.corp.example.com"
+
+[guess]
+ignore = ["generated"]
+`)
+
+	if err := Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	if Loaded.Language != "nodejs-npm" {
+		t.Errorf("expected the project language to win, got %q", Loaded.Language)
+	}
+	if Loaded.Format != "json" {
+		t.Errorf("expected the user format to be kept, got %q", Loaded.Format)
+	}
+	if Timeout != 90*time.Second {
+		t.Errorf("expected a 90s timeout, got %s", Timeout)
+	}
+	if got := TimeoutFor("npm"); got != 30*time.Minute {
+		t.Errorf("expected the npm timeout to override, got %s", got)
+	}
+	if got := TimeoutFor("yarn"); got != 90*time.Second {
+		t.Errorf("expected yarn to use the default timeout, got %s", got)
+	}
+	if Retries != 5 {
+		t.Errorf("expected 5 retries, got %d", Retries)
+	}
+	if got := Registry("npm", "default"); got != "https://npm.corp.example.com" {
+		t.Errorf("unexpected npm registry %q", got)
+	}
+	if got := Registry("pypi", "default"); got != "https://pypi.example.com" {
+		t.Errorf("unexpected pypi registry %q", got)
+	}
+	if got := Registry("crates", "default"); got != "default" {
+		t.Errorf("unexpected crates registry %q", got)
+	}
+	if MinReleaseAge != 72*time.Hour || Loaded.MinReleaseAge != "72h" {
+		t.Errorf("expected the longer minimum release age to win, got %s", MinReleaseAge)
+	}
+	if len(Loaded.Guess.Ignore) != 2 {
+		t.Errorf("expected both ignore lists to be merged, got %v", Loaded.Guess.Ignore)
+	}
+
+	writeConfig(t, filepath.Join(projectDir, ProjectConfigFile), `timeout = "soon"`)
+	if err := Load(); err == nil {
+		t.Error("expected an invalid timeout to be rejected")
+	}
+	writeConfig(t, filepath.Join(projectDir, ProjectConfigFile), `min_release_age = "3 days"`)
+	if err := Load(); err == nil {
+		t.Error("expected an invalid minimum release age to be rejected")
+	}
+	writeConfig(t, filepath.Join(projectDir, ProjectConfigFile), `add_spec_policy = "loose"`)
+	if err := Load(); err == nil {
+		t.Error("expected an invalid spec policy to be rejected")
+	}
+}
+
+func TestLoadInstallTools(t *testing.T) {
+	userDir := t.TempDir()
+	projectDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", userDir)
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(projectDir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	defer func() { Loaded = File{} }()
+
+	writeConfig(t, filepath.Join(projectDir, ProjectConfigFile), "install_tools = true\nupdate_check = true")
+	if err := Load(); err != nil {
+		t.Fatal(err)
+	}
+	if Loaded.InstallTools || Loaded.UpdateCheck {
+		t.Error("expected install_tools and update_check to be ignored in the project configuration file")
+	}
+
+	writeConfig(t, filepath.Join(userDir, "upm", "config.toml"), "install_tools = true\nupdate_check = true")
+	if err := Load(); err != nil {
+		t.Fatal(err)
+	}
+	if !Loaded.InstallTools || !Loaded.UpdateCheck {
+		t.Error("expected install_tools and update_check to be honored in the user configuration file")
+	}
+}
+
+func TestIgnoresModule(t *testing.T) {
+	defer func() { Loaded = File{} }()
+	Loaded.Guess.IgnoreModules = []string{"generated", "@corp/internal"}
+
+	for mod, expected := range map[string]bool{
+		"generated":              true,
+		"generated.models":       true,
+		"generated/models":       true,
+		"generated_models":       false,
+		"@corp/internal":         true,
+		"@corp/internal/helpers": true,
+		"@corp/internals":        false,
+		"requests":               false,
+	} {
+		if got := IgnoresModule(mod); got != expected {
+			t.Errorf("IgnoresModule(%q) = %v, expected %v", mod, got, expected)
+		}
+	}
+}
+
+func TestLoadHooks(t *testing.T) {
+	userDir := t.TempDir()
+	projectDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", userDir)
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(projectDir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	defer func() { Loaded = File{} }()
+
+	writeConfig(t, filepath.Join(userDir, "upm", "config.toml"), `
+[[hooks]]
+template = "notify"
+socket = "/tmp/lsp.sock"
+`)
+	writeConfig(t, filepath.Join(projectDir, ProjectConfigFile), `
+[[hooks]]
+on = ["add", "remove"]
+run = "make editor-config"
+`)
+	if err := Load(); err != nil {
+		t.Fatal(err)
+	}
+	if len(Loaded.Hooks) != 2 || Loaded.Hooks[0].Template != "notify" || Loaded.Hooks[1].Run != "make editor-config" {
+		t.Fatalf("expected the user hook before the project hook, got %+v", Loaded.Hooks)
+	}
+	if !Loaded.Hooks[0].RunsOn("install") {
+		t.Error("expected a hook without on to run after every command")
+	}
+	if Loaded.Hooks[1].RunsOn("install") || !Loaded.Hooks[1].RunsOn("remove") {
+		t.Error("expected on to select the commands")
+	}
+
+	for _, contents := range []string{
+		"[[hooks]]\non = [\"add\"]\n",
+		"[[hooks]]\nrun = \"true\"\ntemplate = \"replit\"\n",
+		"[[hooks]]\non = [\"lock\"]\nrun = \"true\"\n",
+	} {
+		writeConfig(t, filepath.Join(projectDir, ProjectConfigFile), contents)
+		if err := Load(); err == nil {
+			t.Errorf("expected %q to be rejected", contents)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// OrgConfigURLEnv and OrgConfigEnv are the environment variables that
+// point at the organization configuration file, whose settings are
+// defaults under those of the user and the project: the first as an
+// http(s) URL or a path, the second as a path.
+const (
+	OrgConfigURLEnv = "UPM_ORG_CONFIG_URL"
+	OrgConfigEnv    = "UPM_ORG_CONFIG"
+)
+
+// orgFetchTimeout bounds the download of the organization
+// configuration file.
+const orgFetchTimeout = 10 * time.Second
+
+// maxOrgConfigSize bounds the size of the organization configuration
+// file, which may come from the network.
+const maxOrgConfigSize = 1 << 20
+
+// OrgConfigSource returns where the organization configuration file
+// is, as a path or an http(s) URL, or "" if there is none.
+func OrgConfigSource() string {
+	if source := os.Getenv(OrgConfigURLEnv); source != "" {
+		return source
+	}
+	return os.Getenv(OrgConfigEnv)
+}
+
+// isURL returns true if source is to be downloaded rather than read.
+func isURL(source string) bool {
+	return strings.HasPrefix(source, "https://") || strings.HasPrefix(source, "http://")
+}
+
+// orgCacheFile returns where the last downloaded organization
+// configuration file is kept, honoring XDG_CACHE_HOME, or "" if there
+// is no home directory.
+func orgCacheFile() string {
+	dir := os.Getenv("XDG_CACHE_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".cache")
+	}
+	return filepath.Join(dir, "upm", "org-config.toml")
+}
+
+// fetchOrgConfig downloads the organization configuration file at url
+// and keeps a copy of it in the cache. If it cannot be downloaded, the
+// copy from the last time is used, so that UPM keeps working offline.
+func fetchOrgConfig(url string) ([]byte, error) {
+	cache := orgCacheFile()
+	contents, err := func() ([]byte, error) {
+		client := &http.Client{Timeout: orgFetchTimeout}
+		resp, err := client.Get(url)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != 200 {
+			return nil, fmt.Errorf("received status code %d", resp.StatusCode)
+		}
+		contents, err := io.ReadAll(io.LimitReader(resp.Body, maxOrgConfigSize+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(contents) > maxOrgConfigSize {
+			return nil, fmt.Errorf("larger than %d bytes", maxOrgConfigSize)
+		}
+		return contents, nil
+	}()
+	if err != nil {
+		if cache != "" {
+			if cached, cacheErr := os.ReadFile(cache); cacheErr == nil {
+				return cached, nil
+			}
+		}
+		return nil, fmt.Errorf("%s: %w (set %s to \"\" to do without it)", url, err, OrgConfigURLEnv)
+	}
+	if cache != "" {
+		// The cache is only a fallback, so failing to write it
+		// is not an error.
+		if os.MkdirAll(filepath.Dir(cache), 0o755) == nil {
+			_ = os.WriteFile(cache, contents, 0o644)
+		}
+	}
+	return contents, nil
+}
+
+// readOrgFile decodes the organization configuration file at source.
+// Unlike the files of the user and the project, it must exist, since
+// it was asked for.
+func readOrgFile(source string) (File, error) {
+	var f File
+	var contents []byte
+	var err error
+	if isURL(source) {
+		contents, err = fetchOrgConfig(source)
+	} else {
+		contents, err = os.ReadFile(source)
+	}
+	if err != nil {
+		return f, err
+	}
+	if _, err := toml.Decode(string(contents), &f); err != nil {
+		return f, fmt.Errorf("%s: %w", source, err)
+	}
+	return f, nil
+}
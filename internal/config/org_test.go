@@ -0,0 +1,151 @@
+package config
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadOrg(t *testing.T) {
+	orgDir := t.TempDir()
+	userDir := t.TempDir()
+	projectDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", userDir)
+	t.Setenv(OrgConfigURLEnv, "")
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(projectDir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	defer func() {
+		Loaded = File{}
+		Origins = nil
+		MinReleaseAge = 0
+	}()
+
+	orgFile := filepath.Join(orgDir, "org.toml")
+	t.Setenv(OrgConfigEnv, orgFile)
+	writeConfig(t, orgFile, `
+language = "python3-poetry"
+min_release_age = "24h"
+
+[registries]
+npm = "https://npm.mirror.example.com"
+pypi = "https://pypi.mirror.example.com"
+
+[guess]
+ignore = ["corp-internal"]
+
+[policy]
+block = ["left-pad"]
+`)
+	userFile := filepath.Join(userDir, "upm", "config.toml")
+	writeConfig(t, userFile, `
+language = "nodejs-npm"
+
+[guess]
+ignore = ["generated"]
+`)
+	writeConfig(t, filepath.Join(projectDir, ProjectConfigFile), `
+[registries]
+npm = "https://npm.corp.example.com"
+
+[policy]
+allow = ["*"]
+`)
+	if err := Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	if Loaded.Language != "nodejs-npm" {
+		t.Errorf("expected the user language to override the org one, got %q", Loaded.Language)
+	}
+	if got := Registry("pypi", "default"); got != "https://pypi.mirror.example.com" {
+		t.Errorf("expected the org pypi mirror, got %q", got)
+	}
+	if MinReleaseAge == 0 {
+		t.Error("expected the org minimum release age to apply")
+	}
+	if Loaded.Policy == nil || !reflect.DeepEqual(Loaded.Policy.Block, []string{"left-pad"}) || Loaded.Policy.Origin != orgFile {
+		t.Errorf("expected only the org policy, got %+v", Loaded.Policy)
+	}
+
+	org, user, project := "org ("+orgFile+")", "user ("+userFile+")", "project ("+ProjectConfigFile+")"
+	for key, expected := range map[string][]string{
+		"language":        {user},
+		"min_release_age": {org},
+		"registries.npm":  {project},
+		"registries.pypi": {org},
+		"guess.ignore":    {org, user},
+		"policy.block":    {org},
+	} {
+		if got := Origins[key]; !reflect.DeepEqual(got, expected) {
+			t.Errorf("expected %s to come from %v, got %v", key, expected, got)
+		}
+	}
+
+	settings, err := Settings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := []string{}
+	for _, setting := range settings {
+		keys = append(keys, setting.Key)
+	}
+	expected := []string{"guess.ignore", "language", "min_release_age", "policy.block", "registries.npm", "registries.pypi"}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected the settings %v, got %v", expected, keys)
+	}
+
+	t.Setenv(OrgConfigEnv, filepath.Join(orgDir, "missing.toml"))
+	if err := Load(); err == nil {
+		t.Error("expected a missing org configuration file to be an error")
+	}
+	t.Setenv(OrgConfigEnv, orgFile)
+	writeConfig(t, orgFile, "[policy]\nmax_dependencies = -1")
+	if err := Load(); err == nil {
+		t.Error("expected an invalid org policy to be rejected")
+	}
+}
+
+func TestLoadOrgURL(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	defer func() {
+		Loaded = File{}
+		Origins = nil
+	}()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("[registries]\npypi = \"https://pypi.mirror.example.com\"\n"))
+	}))
+	t.Setenv(OrgConfigURLEnv, server.URL)
+	if err := Load(); err != nil {
+		t.Fatal(err)
+	}
+	if got := Registry("pypi", "default"); got != "https://pypi.mirror.example.com" {
+		t.Errorf("expected the org pypi mirror, got %q", got)
+	}
+
+	// Without the server, the cached copy is used.
+	server.Close()
+	Loaded = File{}
+	if err := Load(); err != nil {
+		t.Fatal(err)
+	}
+	if got := Registry("pypi", "default"); got != "https://pypi.mirror.example.com" {
+		t.Errorf("expected the cached org pypi mirror, got %q", got)
+	}
+
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	if err := Load(); err == nil {
+		t.Error("expected an unreachable org configuration without a cache to be an error")
+	}
+}
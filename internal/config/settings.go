@@ -0,0 +1,114 @@
+package config
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Setting is one setting of Loaded, for 'upm config show'.
+type Setting struct {
+	// Key is the dotted key of the setting, e.g. "registries.npm".
+	Key string
+
+	// Value is the value of the setting, as decoded from TOML.
+	Value interface{}
+
+	// Origins are the configuration files it comes from, as in
+	// the Origins variable.
+	Origins []string
+}
+
+// isEmpty returns true if v is a value that flatten leaves out, since
+// it is the same as not setting it.
+func isEmpty(v interface{}) bool {
+	switch v := v.(type) {
+	case string:
+		return v == ""
+	case bool:
+		return !v
+	case []interface{}:
+		return len(v) == 0
+	case []map[string]interface{}:
+		return len(v) == 0
+	case map[string]interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
+// prune removes the empty values from the tables in v, such as the
+// unset fields of hooks.
+func prune(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if isEmpty(value) {
+				delete(v, key)
+			} else {
+				v[key] = prune(value)
+			}
+		}
+	case []map[string]interface{}:
+		for i := range v {
+			prune(v[i])
+		}
+	}
+	return v
+}
+
+// flatten returns the settings of f that are not empty, by dotted key.
+// Tables are flattened, while arrays, even of tables, are single
+// settings.
+func flatten(f File) (map[string]interface{}, error) {
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(f); err != nil {
+		return nil, err
+	}
+	var tree map[string]interface{}
+	if _, err := toml.Decode(buf.String(), &tree); err != nil {
+		return nil, err
+	}
+	settings := map[string]interface{}{}
+	var walk func(prefix string, table map[string]interface{})
+	walk = func(prefix string, table map[string]interface{}) {
+		for key, value := range table {
+			if sub, ok := value.(map[string]interface{}); ok {
+				walk(prefix+key+".", sub)
+			} else if !isEmpty(value) {
+				settings[prefix+key] = prune(value)
+			}
+		}
+	}
+	walk("", tree)
+	return settings, nil
+}
+
+// Settings returns the settings of Loaded that are not empty, with
+// where they come from, sorted by key.
+func Settings() ([]Setting, error) {
+	flat, err := flatten(Loaded)
+	if err != nil {
+		return nil, err
+	}
+	settings := []Setting{}
+	for key, value := range flat {
+		settings = append(settings, Setting{Key: key, Value: value, Origins: Origins[key]})
+	}
+	sort.Slice(settings, func(i, j int) bool {
+		return settings[i].Key < settings[j].Key
+	})
+	return settings, nil
+}
+
+// Value returns the value of the setting with the dotted key in
+// Loaded, and whether it is set.
+func Value(key string) (interface{}, bool, error) {
+	flat, err := flatten(Loaded)
+	if err != nil {
+		return nil, false, err
+	}
+	value, ok := flat[key]
+	return value, ok, nil
+}
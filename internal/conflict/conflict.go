@@ -0,0 +1,348 @@
+// Package conflict explains why a package manager could not find
+// versions that satisfy every requirement of a project. It reads the
+// error output of Poetry and Yarn, which describe a conflict as a
+// chain of "A depends on B" sentences or as warnings, and turns it
+// into an Explanation: the package that cannot be resolved, what
+// requires which of its versions, and what to try instead.
+package conflict
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Constraint is a requirement on the versions of a package.
+type Constraint struct {
+	// By is the package that has the requirement, with its version
+	// if the package manager gave one, or "" for the project
+	// itself.
+	By string
+
+	// Spec is the range of versions that is required.
+	Spec string
+}
+
+// Explanation describes a conflict between the versions of one
+// package that are required.
+type Explanation struct {
+	// Package is the package whose versions conflict.
+	Package string
+
+	// Requested is the version spec the command asked for, if
+	// Package is one of the packages it was adding.
+	Requested string
+
+	// NoVersions is true if no version of Package at all matches
+	// the spec, which is then Requested.
+	NoVersions bool
+
+	// Constraints are the requirements on Package that the
+	// requested spec, or each other, conflict with.
+	Constraints []Constraint
+
+	// Suggestions are upm commands that may get around the
+	// conflict.
+	Suggestions []string
+}
+
+// dependency is a requirement of one package on another, as the
+// package manager reported it.
+type dependency struct {
+	by      string
+	version string
+	pkg     string
+	spec    string
+}
+
+// report is what was read from the output of a package manager.
+type report struct {
+	deps []dependency
+
+	// noMatch are the specs of the packages that no version
+	// matches, by package.
+	noMatch map[string]string
+
+	// fold is true if package names are not case sensitive.
+	fold bool
+}
+
+var (
+	// poetryDependsOn matches a sentence of Poetry's explanation
+	// such as "requests (2.31.0) depends on urllib3 (>=1.21.1,<3)"
+	// or "myapp depends on both urllib3 (^3.0) and ...", and
+	// poetryBoth the second half of the latter.
+	poetryDependsOn = regexp.MustCompile(`([\w.\-\[\]]+)(?: \(([^)]*)\))? (?:which )?(?:depends on|requires) (both )?([\w.\-\[\]]+) \(([^)]*)\)`)
+	poetryBoth      = regexp.MustCompile(`^ and ([\w.\-\[\]]+) \(([^)]*)\)`)
+
+	// poetryNoMatch matches "flask (99.0) which doesn't match any
+	// versions" or "depends on flask (99.0), which doesn't ...".
+	poetryNoMatch = regexp.MustCompile(`([\w.\-\[\]]+) \(([^)]*)\),? which doesn't match any versions`)
+
+	// yarnNoMatch matches the error of Yarn 1 for a spec no
+	// version matches, and yarnNoCandidates that of later Yarns.
+	yarnNoMatch      = regexp.MustCompile(`Couldn't find any versions for "([^"]+)" that matches "([^"]+)"`)
+	yarnNoCandidates = regexp.MustCompile(`(@?[^\s@:]+)@(?:npm:)?([^\s:]+): No candidates found`)
+
+	// yarnPeer matches the warning of Yarn 1 about an unmet peer
+	// dependency, and yarnUnsatisfied that of later Yarns.
+	yarnPeer        = regexp.MustCompile(`" > (@?[^\s@"]+)@([^\s"]+)" has (?:incorrect|unmet) peer dependency "(@?[^\s@"]+)@([^"]+)"`)
+	yarnUnsatisfied = regexp.MustCompile(`(@?[^\s@]+) is listed by your project with version (\S+), which doesn't satisfy what (@?[^\s@]+) (?:\([^)]*\) )?requests \(([^)]*)\)`)
+)
+
+// readPoetry reads the error output of Poetry.
+func readPoetry(output string) report {
+	// Poetry wraps its sentences, indenting the continuation.
+	text := strings.Join(strings.Fields(output), " ")
+	r := report{noMatch: map[string]string{}, fold: true}
+	for start := 0; start < len(text); {
+		m := poetryDependsOn.FindStringSubmatchIndex(text[start:])
+		if m == nil {
+			break
+		}
+		group := func(i int) string {
+			if m[2*i] < 0 {
+				return ""
+			}
+			return text[start+m[2*i] : start+m[2*i+1]]
+		}
+		by, version := group(1), group(2)
+		r.deps = append(r.deps, dependency{by: by, version: version, pkg: group(4), spec: group(5)})
+		if group(3) != "" {
+			if both := poetryBoth.FindStringSubmatch(text[start+m[1]:]); both != nil {
+				r.deps = append(r.deps, dependency{by: by, version: version, pkg: both[1], spec: both[2]})
+			}
+		}
+		// The package depended on may depend on another in
+		// turn, as in "A depends on B (1) which depends on C".
+		start += m[8]
+	}
+	for _, m := range poetryNoMatch.FindAllStringSubmatch(text, -1) {
+		r.noMatch[strings.ToLower(m[1])] = m[2]
+	}
+	return r
+}
+
+// readYarn reads the output of any version of Yarn.
+func readYarn(output string) report {
+	r := report{noMatch: map[string]string{}}
+	for _, m := range yarnNoMatch.FindAllStringSubmatch(output, -1) {
+		r.noMatch[m[1]] = m[2]
+	}
+	for _, m := range yarnNoCandidates.FindAllStringSubmatch(output, -1) {
+		r.noMatch[m[1]] = m[2]
+	}
+	for _, m := range yarnPeer.FindAllStringSubmatch(output, -1) {
+		r.deps = append(r.deps, dependency{by: m[1], version: m[2], pkg: m[3], spec: m[4]})
+	}
+	for _, m := range yarnUnsatisfied.FindAllStringSubmatch(output, -1) {
+		r.deps = append(r.deps,
+			dependency{pkg: m[1], spec: m[2]},
+			dependency{by: m[3], pkg: m[1], spec: m[4]},
+		)
+	}
+	return r
+}
+
+// readers read the output of the package managers Explain knows, by
+// program name.
+var readers = map[string]func(output string) report{
+	"poetry": readPoetry,
+	"yarn":   readYarn,
+}
+
+// requestedPackages returns the packages that cmd, a command that adds
+// packages such as "poetry add flask==2.0", asks for, with their
+// specs.
+func requestedPackages(cmd []string) map[string]string {
+	requested := map[string]string{}
+	if len(cmd) < 2 || cmd[1] != "add" {
+		return requested
+	}
+	yarn := filepath.Base(cmd[0]) == "yarn"
+	for i := 2; i < len(cmd); i++ {
+		arg := cmd[i]
+		if arg == "--group" {
+			i++
+			continue
+		}
+		if strings.HasPrefix(arg, "-") {
+			continue
+		}
+		if yarn {
+			if at := strings.LastIndex(arg, "@"); at > 0 {
+				requested[arg[:at]] = arg[at+1:]
+			} else {
+				requested[arg] = ""
+			}
+			continue
+		}
+		if end := strings.IndexAny(arg, "=<>!~^@ "); end > 0 {
+			requested[arg[:end]] = strings.TrimSpace(arg[end:])
+		} else {
+			requested[arg] = ""
+		}
+	}
+	return requested
+}
+
+// Explain returns an explanation of the failure of cmd, a command of
+// one of the package managers this package knows, from its output, or
+// nil if the output does not describe a conflict it can make sense of.
+func Explain(cmd []string, output string) *Explanation {
+	read, ok := readers[filepath.Base(cmd[0])]
+	if !ok {
+		return nil
+	}
+	return explain(read(output), requestedPackages(cmd))
+}
+
+// explain finds the conflict in r, favouring the packages that were
+// requested.
+func explain(r report, requested map[string]string) *Explanation {
+	name := func(pkg string) string {
+		if r.fold {
+			return strings.ToLower(pkg)
+		}
+		return pkg
+	}
+	constraints := map[string][]Constraint{}
+	for _, dep := range r.deps {
+		by := dep.by
+		if dep.version != "" {
+			by += " " + dep.version
+		}
+		constraints[name(dep.pkg)] = append(constraints[name(dep.pkg)], Constraint{By: by, Spec: dep.spec})
+	}
+
+	// The project is the package that depends on others without
+	// a version of its own.
+	project := map[string]bool{}
+	for _, dep := range r.deps {
+		if dep.by != "" && dep.version == "" {
+			project[dep.by] = true
+		}
+	}
+	for pkg, cs := range constraints {
+		for i := range cs {
+			if project[cs[i].By] {
+				cs[i].By = ""
+			}
+		}
+		constraints[pkg] = cs
+	}
+
+	names := []string{}
+	for pkg := range requested {
+		names = append(names, pkg)
+	}
+	sort.Strings(names)
+
+	for _, pkg := range names {
+		if spec, ok := r.noMatch[name(pkg)]; ok {
+			return &Explanation{
+				Package:     pkg,
+				Requested:   spec,
+				NoVersions:  true,
+				Suggestions: []string{"upm add " + pkg},
+			}
+		}
+	}
+	for _, pkg := range names {
+		others := []Constraint{}
+		for _, c := range constraints[name(pkg)] {
+			if c.By != "" {
+				others = append(others, c)
+			}
+		}
+		if len(others) > 0 {
+			e := &Explanation{Package: pkg, Requested: requested[pkg], Constraints: others}
+			for _, c := range others {
+				e.suggest(fmt.Sprintf("upm add '%s %s'", pkg, c.Spec))
+			}
+			if e.Requested != "" {
+				e.suggest("upm add " + pkg)
+			}
+			return e
+		}
+	}
+
+	// Otherwise, the conflict is between requirements on another
+	// package, which are not all the project's.
+	pkgs := []string{}
+	for pkg := range constraints {
+		pkgs = append(pkgs, pkg)
+	}
+	sort.Strings(pkgs)
+	for _, pkg := range pkgs {
+		cs := constraints[pkg]
+		specs := map[string]bool{}
+		for _, c := range cs {
+			specs[c.Spec] = true
+		}
+		if len(specs) < 2 {
+			continue
+		}
+		e := &Explanation{Package: pkg, Constraints: cs}
+		for _, c := range cs {
+			if c.By != "" {
+				e.suggest(fmt.Sprintf("upm add '%s %s'", pkg, c.Spec))
+			}
+		}
+		for _, pkg := range names {
+			if requested[pkg] != "" {
+				e.suggest("upm add " + pkg)
+			}
+		}
+		return e
+	}
+
+	unmatched := []string{}
+	for pkg := range r.noMatch {
+		unmatched = append(unmatched, pkg)
+	}
+	sort.Strings(unmatched)
+	for _, pkg := range unmatched {
+		return &Explanation{Package: pkg, Requested: r.noMatch[pkg], NoVersions: true}
+	}
+	return nil
+}
+
+// suggest adds a suggestion, unless it was made already.
+func (e *Explanation) suggest(suggestion string) {
+	for _, made := range e.Suggestions {
+		if made == suggestion {
+			return
+		}
+	}
+	e.Suggestions = append(e.Suggestions, suggestion)
+}
+
+// String describes the conflict for the user, over several lines.
+func (e *Explanation) String() string {
+	var b strings.Builder
+	if e.NoVersions {
+		fmt.Fprintf(&b, "version conflict: no version of %s matches %s", e.Package, e.Requested)
+	} else {
+		fmt.Fprintf(&b, "version conflict over %s:", e.Package)
+		if e.Requested != "" {
+			fmt.Fprintf(&b, "\n  requested: %s %s", e.Package, e.Requested)
+		}
+		for _, c := range e.Constraints {
+			by := c.By
+			if by == "" {
+				by = "the project"
+			}
+			fmt.Fprintf(&b, "\n  %s requires %s %s", by, e.Package, c.Spec)
+		}
+	}
+	if len(e.Suggestions) > 0 {
+		b.WriteString("\nto resolve it, try:")
+		for _, suggestion := range e.Suggestions {
+			fmt.Fprintf(&b, "\n  %s", suggestion)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,104 @@
+package conflict
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExplainPoetry(t *testing.T) {
+	output := `Updating dependencies
+Resolving dependencies...
+
+Because no versions of requests match >2.31.0,<3.0.0
+ and requests (2.31.0) depends on urllib3 (>=1.21.1,<3), requests (>=2.31.0,<3.0.0) requires urllib3 (>=1.21.1,<3).
+So, because myapp depends on both urllib3 (^3.0) and requests (^2.31.0), version solving failed.
+`
+	e := Explain([]string{"poetry", "add", "--group", "dev", "urllib3^3.0"}, output)
+	expected := &Explanation{
+		Package:   "urllib3",
+		Requested: "^3.0",
+		Constraints: []Constraint{
+			{By: "requests 2.31.0", Spec: ">=1.21.1,<3"},
+			{By: "requests >=2.31.0,<3.0.0", Spec: ">=1.21.1,<3"},
+		},
+		Suggestions: []string{"upm add 'urllib3 >=1.21.1,<3'", "upm add urllib3"},
+	}
+	if !reflect.DeepEqual(e, expected) {
+		t.Errorf("expected %+v, got %+v", expected, e)
+	}
+
+	expectedText := `version conflict over urllib3:
+  requested: urllib3 ^3.0
+  requests 2.31.0 requires urllib3 >=1.21.1,<3
+  requests >=2.31.0,<3.0.0 requires urllib3 >=1.21.1,<3
+to resolve it, try:
+  upm add 'urllib3 >=1.21.1,<3'
+  upm add urllib3`
+	if e.String() != expectedText {
+		t.Errorf("unexpected explanation:\n%s", e)
+	}
+}
+
+func TestExplainPoetryTransitive(t *testing.T) {
+	output := `Because myapp depends on flask (^2.0) which depends on werkzeug (>=2.0), werkzeug is required.
+So, because myapp depends on werkzeug (<2.0), version solving failed.`
+	e := Explain([]string{"poetry", "add", "flask^2.0"}, output)
+	expected := &Explanation{
+		Package: "werkzeug",
+		Constraints: []Constraint{
+			{By: "flask ^2.0", Spec: ">=2.0"},
+			{By: "", Spec: "<2.0"},
+		},
+		Suggestions: []string{"upm add 'werkzeug >=2.0'", "upm add flask"},
+	}
+	if !reflect.DeepEqual(e, expected) {
+		t.Errorf("expected %+v, got %+v", expected, e)
+	}
+}
+
+func TestExplainNoVersions(t *testing.T) {
+	e := Explain([]string{"poetry", "add", "Flask==99.0"},
+		"Because myapp depends on flask (99.0) which doesn't match any versions, version solving failed.")
+	if e == nil || !e.NoVersions || e.Package != "Flask" || e.Requested != "99.0" {
+		t.Fatalf("unexpected explanation %+v", e)
+	}
+	if e.String() != "version conflict: no version of Flask matches 99.0\nto resolve it, try:\n  upm add Flask" {
+		t.Errorf("unexpected explanation:\n%s", e)
+	}
+
+	e = Explain([]string{"yarn", "add", "@types/node@^99"},
+		`error Couldn't find any versions for "@types/node" that matches "^99"`)
+	if e == nil || !e.NoVersions || e.Package != "@types/node" || e.Requested != "^99" {
+		t.Errorf("unexpected explanation %+v", e)
+	}
+
+	e = Explain([]string{"yarn", "add", "react@^99"},
+		"➤ YN0001: │ Error: react@npm:^99: No candidates found")
+	if e == nil || !e.NoVersions || e.Package != "react" || e.Requested != "^99" {
+		t.Errorf("unexpected explanation %+v", e)
+	}
+}
+
+func TestExplainYarnPeer(t *testing.T) {
+	output := `warning " > react-dom@18.2.0" has incorrect peer dependency "react@^18.2.0".
+error Something went wrong.`
+	e := Explain([]string{"yarn", "add", "react@17.0.2", "react-dom"}, output)
+	expected := &Explanation{
+		Package:     "react",
+		Requested:   "17.0.2",
+		Constraints: []Constraint{{By: "react-dom 18.2.0", Spec: "^18.2.0"}},
+		Suggestions: []string{"upm add 'react ^18.2.0'", "upm add react"},
+	}
+	if !reflect.DeepEqual(e, expected) {
+		t.Errorf("expected %+v, got %+v", expected, e)
+	}
+}
+
+func TestExplainUnknown(t *testing.T) {
+	if e := Explain([]string{"npm", "install", "react"}, "npm ERR! code ERESOLVE"); e != nil {
+		t.Errorf("expected no explanation for npm, got %+v", e)
+	}
+	if e := Explain([]string{"poetry", "add", "flask"}, "Connection refused"); e != nil {
+		t.Errorf("expected no explanation, got %+v", e)
+	}
+}
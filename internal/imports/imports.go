@@ -0,0 +1,72 @@
+// Package imports finds the modules that source code imports, by
+// parsing it with tree-sitter and querying its syntax tree, so that
+// imports split over several lines, and code in comments or strings,
+// are handled as the language itself handles them. Each language is a
+// Language, and making a new language guessable is a matter of
+// writing its query.
+package imports
+
+import (
+	"context"
+
+	"github.com/replit/upm/internal/util"
+	sitter "github.com/smacker/go-tree-sitter"
+)
+
+// Language is how to find the imports of one language.
+type Language struct {
+	// Name is the name of the language, as in "python".
+	Name string
+
+	// Grammar returns the tree-sitter grammar of the language.
+	Grammar func() *sitter.Language
+
+	// Patterns are globs that the basenames of its source files
+	// match, as in "*.py".
+	Patterns []string
+
+	// Query is a tree-sitter query that captures what each import
+	// imports as @import. A comment on the same line, captured as
+	// @pragma, can replace the import with the package in a "upm
+	// package(...)" pragma. Captures starting with "_" are only
+	// for predicates, such as #eq?.
+	Query string
+
+	// Module returns the module that an @import capture names,
+	// and whether it names one that a package could provide, as
+	// opposed to, say, a relative import. If nil, every capture
+	// is a module as it is.
+	Module func(found string) (string, bool)
+}
+
+// modules returns the modules that the captures in found name.
+func (lang Language) modules(found []string) map[string]bool {
+	modules := map[string]bool{}
+	for _, capture := range found {
+		module, ok := capture, true
+		if lang.Module != nil {
+			module, ok = lang.Module(capture)
+		}
+		if ok {
+			modules[module] = true
+		}
+	}
+	return modules
+}
+
+// Find returns the modules that the source files of lang in root
+// import, as util.FindSourceFiles finds them with ignorePathSegments.
+// Every file is parsed, even if some fail to, but the error then says
+// so.
+func Find(ctx context.Context, root string, lang Language, ignorePathSegments map[string]bool) (map[string]bool, error) {
+	found, err := util.GuessWithTreeSitter(ctx, root, lang.Grammar(), lang.Query, lang.Patterns, ignorePathSegments)
+	return lang.modules(found), err
+}
+
+// FindSource is like Find, but for source code that is not in a file
+// of its own, such as the cells of a notebook; name is where it is
+// from, for errors.
+func FindSource(lang Language, name string, contents []byte) (map[string]bool, error) {
+	found, err := util.GuessSourceWithTreeSitter(lang.Grammar(), lang.Query, name, contents)
+	return lang.modules(found), err
+}
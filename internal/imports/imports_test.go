@@ -0,0 +1,90 @@
+package imports
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFindSource(t *testing.T) {
+	for _, test := range []struct {
+		lang     Language
+		source   string
+		expected []string
+	}{
+		{Python, `
+from flask import (
+    Flask,
+    request,
+)
+import numpy as np, pandas
+import foo  # upm package(bar)
+"""
+import notcode
+"""
+# import notcode
+text = "import notcode"
+yaml = __import__("yaml")
+`, []string{"flask", "numpy", "pandas", "bar", "yaml"}},
+		{JavaScript, `
+import {
+  useState,
+  useEffect,
+} from "react";
+// import notcode from "notcode";
+const text = "require('notcode')";
+const express = require(
+  'express'
+);
+`, []string{"react", "express"}},
+		{TypeScript, `import type { Request } from "express";
+const lodash: typeof import("lodash") = require("lodash");
+`, []string{"express", "lodash"}},
+		{Ruby, `
+require 'sinatra/base'
+require("json")
+require_relative 'helpers'
+require './local'
+# require 'notcode'
+puts "require 'notcode'"
+Kernel.require 'notcode'
+require "plugins/#{name}"
+`, []string{"sinatra/base", "json"}},
+		{Go, "package main\n\nimport \"fmt\"\n\nimport (\n\tx \"github.com/a/b\"\n\t_ `github.com/c/d`\n\t\"C\"\n)\n\n// import \"notcode\"\nvar s = `import \"notcode\"`\n",
+			[]string{"fmt", "github.com/a/b", "github.com/c/d"}},
+		{Rust, `
+use serde::{Serialize, Deserialize};
+use tokio;
+use ::rand::Rng as R;
+extern crate regex;
+use crate::config::Config;
+use super::util;
+// use notcode;
+`, []string{"serde", "tokio", "rand", "regex"}},
+		{Shell, `#!/bin/sh
+PORT=8000 poetry run gunicorn app:app --workers 4
+npx --yes eslint . && black src | tee lint.log
+# ruff check
+echo "pytest"
+if true; then
+  python -u -m pytest \
+    -q
+fi
+version=$(bundle exec rails --version)
+"$BIN" run
+exec ./node_modules/.bin/tsc
+`, []string{"gunicorn", "eslint", "black", "tee", "echo", "true", "pytest", "rails", "tsc"}},
+	} {
+		found, err := FindSource(test.lang, "test", []byte(test.source))
+		if err != nil {
+			t.Errorf("%s: %s", test.lang.Name, err)
+			continue
+		}
+		expected := map[string]bool{}
+		for _, module := range test.expected {
+			expected[module] = true
+		}
+		if !reflect.DeepEqual(found, expected) {
+			t.Errorf("%s: expected %v, got %v", test.lang.Name, expected, found)
+		}
+	}
+}
@@ -0,0 +1,301 @@
+package imports
+
+import (
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/smacker/go-tree-sitter/bash"
+	"github.com/smacker/go-tree-sitter/golang"
+	"github.com/smacker/go-tree-sitter/javascript"
+	"github.com/smacker/go-tree-sitter/python"
+	"github.com/smacker/go-tree-sitter/ruby"
+	"github.com/smacker/go-tree-sitter/rust"
+	"github.com/smacker/go-tree-sitter/typescript/tsx"
+	"github.com/smacker/go-tree-sitter/typescript/typescript"
+)
+
+// Python finds the modules that Python code imports: with import
+// statements at the top level or under an if, with their pragmas, and
+// dynamically with importlib.import_module or __import__.
+var Python = Language{
+	Name:     "python",
+	Grammar:  python.GetLanguage,
+	Patterns: []string{"*.py"},
+	Query: `
+(module
+  [(import_statement
+     name: [(dotted_name) @import
+            (aliased_import
+              name: (dotted_name) @import)])
+   (import_from_statement
+     module_name: (dotted_name) @import)
+   (if_statement
+     [(block
+        [(import_statement
+           name:
+            [(dotted_name) @import
+             (aliased_import
+               name: (dotted_name) @import)])
+         (import_from_statement
+           module_name: (dotted_name) @import)])
+      (_ (block
+           [(import_statement
+              name:
+               [(dotted_name) @import
+                (aliased_import
+                  name: (dotted_name) @import)])
+            (import_from_statement
+              module_name: (dotted_name) @import)]))])]
+
+  .
+
+  (comment)? @pragma)
+
+(call
+  function: [(identifier) @_function
+             (attribute attribute: (identifier) @_function)]
+  arguments: (argument_list . (string) @import)
+  (#eq? @_function "import_module"))
+
+(call
+  function: (identifier) @_function
+  arguments: (argument_list . (string) @import)
+  (#eq? @_function "__import__"))
+`,
+	Module: pythonModule,
+}
+
+// matchPythonModule matches an absolute Python module path, as in
+// "a.b".
+var matchPythonModule = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)*$`)
+
+// pythonModule implements Module for Python. Modules imported
+// dynamically are found as the string literal that names them, which
+// must be a plain absolute module path: f-strings and relative imports
+// are left out.
+func pythonModule(found string) (string, bool) {
+	quote := strings.IndexAny(found, `'"`)
+	if quote < 0 {
+		return found, true
+	}
+	switch strings.ToLower(found[:quote]) {
+	case "", "r", "u":
+	default:
+		return "", false
+	}
+	name := strings.Trim(found[quote:], found[quote:quote+1])
+	return name, matchPythonModule.MatchString(name)
+}
+
+// javascriptQuery finds the modules of import statements, require
+// calls and dynamic imports, which JavaScript and TypeScript share.
+const javascriptQuery = `
+(import_statement
+  source: (string) @import)
+
+((call_expression
+   function: [(identifier) @_function
+              (import)]
+   arguments: (arguments . [(string) @import (template_string) @import] .))
+ (#eq? @_function "require"))
+`
+
+// javascriptModule implements Module for JavaScript and TypeScript,
+// whose imports are found as string literals.
+func javascriptModule(found string) (string, bool) {
+	return strings.Trim(found, "\"'`"), true
+}
+
+// JavaScript finds the modules that JavaScript code imports.
+var JavaScript = Language{
+	Name:     "javascript",
+	Grammar:  javascript.GetLanguage,
+	Patterns: []string{"*.js", "*.jsx", "*.mjs", "*.cjs"},
+	Query:    javascriptQuery,
+	Module:   javascriptModule,
+}
+
+// TypeScript finds the modules that TypeScript code imports.
+var TypeScript = Language{
+	Name:     "typescript",
+	Grammar:  typescript.GetLanguage,
+	Patterns: []string{"*.ts"},
+	Query:    javascriptQuery,
+	Module:   javascriptModule,
+}
+
+// TSX finds the modules that TypeScript code with JSX imports.
+var TSX = Language{
+	Name:     "tsx",
+	Grammar:  tsx.GetLanguage,
+	Patterns: []string{"*.tsx"},
+	Query:    javascriptQuery,
+	Module:   javascriptModule,
+}
+
+// Ruby finds the paths that Ruby code requires, as in "sinatra/base".
+// Relative and absolute paths are left out, as are the files of
+// require_relative.
+var Ruby = Language{
+	Name:     "ruby",
+	Grammar:  ruby.GetLanguage,
+	Patterns: []string{"*.rb"},
+	Query: `
+((call
+   !receiver
+   method: (identifier) @_method
+   arguments: (argument_list . (string . (string_content) @import .)))
+ (#eq? @_method "require"))
+`,
+	Module: func(found string) (string, bool) {
+		return found, !strings.HasPrefix(found, ".") && !strings.HasPrefix(found, "/")
+	},
+}
+
+// Go finds the import paths of Go code, as in "github.com/a/b".
+var Go = Language{
+	Name:     "go",
+	Grammar:  golang.GetLanguage,
+	Patterns: []string{"*.go"},
+	Query: `
+(import_spec
+  path: [(interpreted_string_literal) (raw_string_literal)] @import)
+`,
+	Module: func(found string) (string, bool) {
+		path := strings.Trim(found, "\"`")
+		return path, path != "" && path != "C"
+	},
+}
+
+// Rust finds the crates that Rust code uses, from its use declarations
+// and extern crate declarations. The paths of the crate itself, such
+// as crate::a, are left out.
+var Rust = Language{
+	Name:     "rust",
+	Grammar:  rust.GetLanguage,
+	Patterns: []string{"*.rs"},
+	Query: `
+(use_declaration
+  argument: (_) @import)
+
+(extern_crate_declaration
+  name: (identifier) @import)
+`,
+	Module: rustCrate,
+}
+
+// rustLocalPaths are the roots of Rust paths that name the crate being
+// built rather than a dependency.
+var rustLocalPaths = map[string]bool{
+	"crate": true,
+	"self":  true,
+	"super": true,
+}
+
+// rustCrate implements Module for Rust, returning the crate at the root
+// of a use path, as in "serde" for "serde::{Serialize, Deserialize}".
+func rustCrate(found string) (string, bool) {
+	found = strings.TrimPrefix(strings.TrimSpace(found), "::")
+	end := strings.IndexFunc(found, func(r rune) bool {
+		return !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	})
+	if end >= 0 {
+		found = found[:end]
+	}
+	return found, found != "" && !rustLocalPaths[found]
+}
+
+// Shell finds the commands that shell scripts run, as in "gunicorn"
+// for "PORT=8000 poetry run gunicorn app:app". Rather than modules,
+// these are names that a backend's CommandPackages can look up.
+var Shell = Language{
+	Name:     "shell",
+	Grammar:  bash.GetLanguage,
+	Patterns: []string{"*.sh", "*.bash"},
+	Query: `
+(command) @import
+`,
+	Module: shellCommand,
+}
+
+// shellWrappers are the commands that run another command given in
+// their arguments, after the subcommand here if it is not empty, as in
+// "npx eslint", "bundle exec rails" or "python -m pytest".
+var shellWrappers = map[string]string{
+	"bundle":  "exec",
+	"bunx":    "",
+	"env":     "",
+	"exec":    "",
+	"hatch":   "run",
+	"nohup":   "",
+	"npm":     "exec",
+	"npx":     "",
+	"pdm":     "run",
+	"pipenv":  "run",
+	"pnpm":    "exec",
+	"poetry":  "run",
+	"python":  "-m",
+	"python3": "-m",
+	"rye":     "run",
+	"sudo":    "",
+	"time":    "",
+	"uv":      "run",
+	"uvx":     "",
+}
+
+// matchCommandName matches the name of a command that a package could
+// provide.
+var matchCommandName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._+-]*$`)
+
+// shellCommand implements Module for Shell, returning the command that
+// a command line runs, through the wrappers in shellWrappers. Commands
+// named by variables or quotes are left out.
+func shellCommand(found string) (string, bool) {
+	words := strings.Fields(found)
+	i := skipShellPrefix(words, 0)
+	for i < len(words) {
+		name := path.Base(words[i])
+		sub, ok := shellWrappers[name]
+		if !ok {
+			break
+		}
+		next := -1
+		for j := i + 1; j < len(words); j++ {
+			if sub == "" || words[j] == sub {
+				if sub != "" {
+					j++
+				}
+				next = skipShellPrefix(words, j)
+				break
+			}
+			if !strings.HasPrefix(words[j], "-") {
+				break
+			}
+		}
+		if next < 0 {
+			break
+		}
+		i = next
+	}
+	if i >= len(words) {
+		return "", false
+	}
+	name := path.Base(words[i])
+	return name, matchCommandName.MatchString(name)
+}
+
+// skipShellPrefix returns the index of the first word of words from i
+// on that is not a variable assignment, an option or a line
+// continuation.
+func skipShellPrefix(words []string, i int) int {
+	for i < len(words) {
+		word := words[i]
+		isAssignment := strings.Contains(word, "=") && !strings.HasPrefix(word, "-")
+		if !isAssignment && !strings.HasPrefix(word, "-") && word != "\\" {
+			break
+		}
+		i++
+	}
+	return i
+}
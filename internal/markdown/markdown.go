@@ -0,0 +1,187 @@
+// Package markdown renders the Markdown of package readmes for a
+// terminal. It understands the parts of Markdown that readmes commonly
+// use, and leaves the rest, such as tables, as they are written, which
+// is how Markdown is meant to read as plain text anyway.
+package markdown
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// ANSI escape sequences of the styles Render uses with color.
+const (
+	styleBold      = "\x1b[1m"
+	styleDim       = "\x1b[2m"
+	styleItalic    = "\x1b[3m"
+	styleUnderline = "\x1b[4m"
+	styleCode      = "\x1b[36m"
+	styleReset     = "\x1b[0m"
+)
+
+var (
+	matchComment  = regexp.MustCompile(`(?s)<!--.*?-->`)
+	matchFence    = regexp.MustCompile("^\\s*(```+|~~~+)")
+	matchHeading  = regexp.MustCompile(`^\s{0,3}(#{1,6})\s+(.*?)(\s+#+)?\s*$`)
+	matchRule     = regexp.MustCompile(`^\s{0,3}([-*_])(\s*([-*_]))(\s*([-*_]))+\s*$`)
+	matchBullet   = regexp.MustCompile(`^(\s*)[-*+]\s+`)
+	matchQuote    = regexp.MustCompile(`^\s{0,3}>\s?`)
+	matchCodeSpan = regexp.MustCompile("`+[^`]*`+")
+
+	// A link whose text is an image, as badges are written, which
+	// is not worth showing in a terminal.
+	matchBadge    = regexp.MustCompile(`\[!\[[^\]]*\]\([^)]*\)\]\([^)]*\)`)
+	matchImage    = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	matchLink     = regexp.MustCompile(`\[([^\]]+)\]\(\s*<?([^)\s>]+)>?(\s+"[^"]*")?\s*\)`)
+	matchAutolink = regexp.MustCompile(`<((https?|mailto):[^>\s]+)>`)
+	matchTag      = regexp.MustCompile(`</?[a-zA-Z][^>]*>`)
+	matchStrong   = regexp.MustCompile(`\*\*([^*]+)\*\*|__([^_]+)__`)
+	matchEmphasis = regexp.MustCompile(`(^|[^*\w])\*([^*\s][^*]*)\*`)
+)
+
+// renderer holds the state of Render from one line to the next.
+type renderer struct {
+	color bool
+	out   []string
+
+	// The fence that opened the code block the current line is in,
+	// or empty outside of one.
+	fence string
+}
+
+// Render renders Markdown as text for a terminal: headings stand out,
+// links are followed by their URLs, images and badges are left out,
+// code blocks are indented, and HTML is stripped. With color, it uses
+// ANSI escape sequences for bold, italic and code; without, the text
+// has no markup at all.
+func Render(src string, color bool) string {
+	r := &renderer{color: color}
+	src = strings.ReplaceAll(src, "\r\n", "\n")
+	src = matchComment.ReplaceAllString(src, "")
+	for _, line := range strings.Split(src, "\n") {
+		r.line(strings.TrimRight(line, " \t"))
+	}
+
+	// Stripping badges and HTML leaves runs of blank lines.
+	lines := []string{}
+	for _, line := range r.out {
+		if line == "" && (len(lines) == 0 || lines[len(lines)-1] == "") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// style wraps text in an ANSI style, with color.
+func (r *renderer) style(style string, text string) string {
+	if !r.color || text == "" {
+		return text
+	}
+	return style + text + styleReset
+}
+
+// line renders one line of the source.
+func (r *renderer) line(line string) {
+	if r.fence != "" {
+		if match := matchFence.FindStringSubmatch(line); match != nil && strings.HasPrefix(match[1], r.fence) {
+			r.fence = ""
+			r.out = append(r.out, "")
+			return
+		}
+		r.out = append(r.out, "    "+r.style(styleDim, line))
+		return
+	}
+	if match := matchFence.FindStringSubmatch(line); match != nil {
+		r.fence = match[1]
+		r.out = append(r.out, "")
+		return
+	}
+
+	if match := matchHeading.FindStringSubmatch(line); match != nil {
+		text := r.inline(match[2])
+		switch {
+		case len(match[1]) > 2:
+			r.out = append(r.out, r.style(styleBold, text))
+		case r.color:
+			r.out = append(r.out, r.style(styleBold+styleUnderline, text))
+		default:
+			underline := "="
+			if len(match[1]) == 2 {
+				underline = "-"
+			}
+			r.out = append(r.out, text, strings.Repeat(underline, len([]rune(text))))
+		}
+		return
+	}
+
+	// "---" under a line of text underlines it as a heading rather
+	// than being a rule.
+	if matchRule.MatchString(line) && (len(r.out) == 0 || r.out[len(r.out)-1] == "") {
+		r.out = append(r.out, strings.Repeat("─", 40))
+		return
+	}
+
+	prefix := ""
+	if match := matchQuote.FindString(line); match != "" {
+		prefix = "│ "
+		line = line[len(match):]
+	}
+	if match := matchBullet.FindStringSubmatch(line); match != nil && !matchRule.MatchString(line) {
+		prefix += match[1] + "• "
+		line = line[len(match[0]):]
+	}
+
+	text := r.inline(line)
+	if strings.TrimSpace(text) == "" && strings.TrimSpace(line) != "" {
+		// The line only had markup, such as a badge or an HTML
+		// tag, so leave it out rather than leave a blank line.
+		return
+	}
+	r.out = append(r.out, prefix+text)
+}
+
+// inline renders the markup within a line, except in code spans.
+func (r *renderer) inline(line string) string {
+	var b strings.Builder
+	last := 0
+	for _, span := range matchCodeSpan.FindAllStringIndex(line, -1) {
+		b.WriteString(r.text(line[last:span[0]]))
+		code := strings.Trim(line[span[0]:span[1]], "`")
+		if strings.HasPrefix(code, " ") && strings.HasSuffix(code, " ") && strings.TrimSpace(code) != "" {
+			code = code[1 : len(code)-1]
+		}
+		b.WriteString(r.style(styleCode, code))
+		last = span[1]
+	}
+	b.WriteString(r.text(line[last:]))
+	return b.String()
+}
+
+// text renders the markup of text outside of code spans.
+func (r *renderer) text(text string) string {
+	text = matchBadge.ReplaceAllString(text, "")
+	text = matchImage.ReplaceAllString(text, "$1")
+	text = matchLink.ReplaceAllStringFunc(text, func(link string) string {
+		match := matchLink.FindStringSubmatch(link)
+		if match[1] == match[2] || strings.HasPrefix(match[2], "#") {
+			return match[1]
+		}
+		return match[1] + " (" + match[2] + ")"
+	})
+	text = matchAutolink.ReplaceAllString(text, "$1")
+	text = matchTag.ReplaceAllString(text, "")
+	text = matchStrong.ReplaceAllStringFunc(text, func(strong string) string {
+		match := matchStrong.FindStringSubmatch(strong)
+		return r.style(styleBold, match[1]+match[2])
+	})
+	text = matchEmphasis.ReplaceAllStringFunc(text, func(emphasis string) string {
+		match := matchEmphasis.FindStringSubmatch(emphasis)
+		return match[1] + r.style(styleItalic, match[2])
+	})
+	return html.UnescapeString(text)
+}
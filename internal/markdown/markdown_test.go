@@ -0,0 +1,63 @@
+package markdown
+
+import "testing"
+
+func TestRender(t *testing.T) {
+	src := `<!-- badges -->
+# left-pad
+
+[![Build Status](https://ci.example.com/badge.svg)](https://ci.example.com)
+<p align="center"><img src="logo.png"></p>
+
+String **left pad**, *fast* &amp; small. See [the docs](https://example.com/docs "Docs"),
+<https://example.com> or [usage](#usage).
+
+## Usage
+
+* Call ` + "`leftPad(str, len)`" + `
+* Or [pad](pad) it
+
+> Deprecated: use padStart.
+
+---
+
+` + "```js" + `
+leftPad('foo', 5) // "  foo"
+` + "```" + `
+`
+	expected := `left-pad
+========
+
+String left pad, fast & small. See the docs (https://example.com/docs),
+https://example.com or usage.
+
+Usage
+-----
+
+• Call leftPad(str, len)
+• Or pad it
+
+│ Deprecated: use padStart.
+
+────────────────────────────────────────
+
+    leftPad('foo', 5) // "  foo"`
+	if actual := Render(src, false); actual != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, actual)
+	}
+}
+
+func TestRenderColor(t *testing.T) {
+	for src, expected := range map[string]string{
+		"# Title":             "\x1b[1m\x1b[4mTitle\x1b[0m",
+		"### Section":         "\x1b[1mSection\x1b[0m",
+		"a **b** c":           "a \x1b[1mb\x1b[0m c",
+		"a *b* c":             "a \x1b[3mb\x1b[0m c",
+		"`**not bold**`":      "\x1b[36m**not bold**\x1b[0m",
+		"snake_case_name * 2": "snake_case_name * 2",
+	} {
+		if actual := Render(src, true); actual != expected {
+			t.Errorf("%q: expected %q, got %q", src, expected, actual)
+		}
+	}
+}
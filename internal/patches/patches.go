@@ -0,0 +1,438 @@
+// Package patches writes and applies the patches of installed packages
+// that 'upm patch' records in .upm/patches. They are in the format of
+// git diff, with paths relative to the project directory, so that
+// patch-package, git apply and patch(1) can apply them too.
+package patches
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/util"
+)
+
+// Dir is the directory, relative to the project directory, that holds
+// the patches.
+const Dir = ".upm/patches"
+
+// FileName returns the name of the patch of the given version of the
+// package name, the way patch-package names it: "left-pad+1.3.0.patch",
+// or "@types+node+20.1.0.patch" for a scoped package.
+func FileName(name api.PkgName, version api.PkgVersion) string {
+	return strings.ReplaceAll(string(name), "/", "+") + "+" + string(version) + ".patch"
+}
+
+// ParseFileName returns the package name and version of the patch
+// named file, as returned by FileName. Versions may contain "+", but
+// names do not, apart from the one after a scope.
+func ParseFileName(file string) (api.PkgName, api.PkgVersion, bool) {
+	base, ok := strings.CutSuffix(file, ".patch")
+	if !ok {
+		return "", "", false
+	}
+	start := 0
+	if strings.HasPrefix(base, "@") {
+		start = strings.Index(base, "+") + 1
+		if start == 0 {
+			return "", "", false
+		}
+	}
+	i := strings.Index(base[start:], "+")
+	if i <= 0 || start+i == len(base)-1 {
+		return "", "", false
+	}
+	name := strings.Replace(base[:start+i], "+", "/", 1)
+	return api.PkgName(name), api.PkgVersion(base[start+i+1:]), true
+}
+
+// listFiles returns the slash-separated paths of the regular files
+// under root, which need not exist.
+func listFiles(root string) ([]string, error) {
+	files := []string{}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if os.IsNotExist(err) && path == root {
+			return filepath.SkipDir
+		} else if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	return files, err
+}
+
+// readIfExists returns the contents of path, and whether it exists.
+func readIfExists(path string) (string, bool, error) {
+	contentsB, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, err
+	}
+	return string(contentsB), true, nil
+}
+
+// Diff returns the patch that turns the files under oldRoot into those
+// under newRoot, with their paths relative to the roots after prefix,
+// a slash-separated directory such as node_modules/left-pad. It is
+// empty if the files are the same. Binary files cannot be patched.
+func Diff(oldRoot, newRoot, prefix string) (string, error) {
+	oldFiles, err := listFiles(oldRoot)
+	if err != nil {
+		return "", err
+	}
+	newFiles, err := listFiles(newRoot)
+	if err != nil {
+		return "", err
+	}
+	seen := map[string]bool{}
+	paths := []string{}
+	for _, path := range append(oldFiles, newFiles...) {
+		if !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	var sb strings.Builder
+	for _, path := range paths {
+		old, oldExists, err := readIfExists(filepath.Join(oldRoot, filepath.FromSlash(path)))
+		if err != nil {
+			return "", err
+		}
+		new, newExists, err := readIfExists(filepath.Join(newRoot, filepath.FromSlash(path)))
+		if err != nil {
+			return "", err
+		}
+		if old == new && oldExists == newExists {
+			continue
+		}
+		if strings.Contains(old, "\x00") || strings.Contains(new, "\x00") {
+			return "", fmt.Errorf("%s is a binary file, which cannot be patched", path)
+		}
+
+		full := strings.TrimSuffix(prefix, "/") + "/" + path
+		fmt.Fprintf(&sb, "diff --git a/%s b/%s\n", full, full)
+		oldName, newName := "a/"+full, "b/"+full
+		switch {
+		case !oldExists:
+			sb.WriteString("new file mode 100644\n")
+			oldName = "/dev/null"
+		case !newExists:
+			sb.WriteString("deleted file mode 100644\n")
+			newName = "/dev/null"
+		}
+		fmt.Fprintf(&sb, "--- %s\n+++ %s\n", oldName, newName)
+		sb.WriteString(util.DiffHunks(old, new))
+	}
+	return sb.String(), nil
+}
+
+// hunkLine is a line of a hunk: ' ' for context, '-' for a removed
+// line and '+' for an added one, with its newline unless it is the
+// last line of a file that does not end in one.
+type hunkLine struct {
+	kind byte
+	text string
+}
+
+// hunk is a hunk of a filePatch, which starts at the given lines of
+// the old and new files.
+type hunk struct {
+	oldStart, newStart int
+	lines              []hunkLine
+}
+
+// filePatch is the part of a patch that changes one file. A path is
+// empty if the file is created or deleted.
+type filePatch struct {
+	oldPath, newPath string
+	hunks            []hunk
+}
+
+// parsePatchPath returns the path of a "---" or "+++" line, without
+// its "a/" or "b/" prefix, or "" for /dev/null.
+func parsePatchPath(field, prefix string) (string, error) {
+	field, _, _ = strings.Cut(field, "\t")
+	if field == "/dev/null" {
+		return "", nil
+	}
+	path := strings.TrimPrefix(field, prefix)
+	if !filepath.IsLocal(filepath.FromSlash(path)) {
+		return "", fmt.Errorf("%s is outside the project", path)
+	}
+	return path, nil
+}
+
+// parseRange parses the start and length of a hunk header's range,
+// such as "12,3", or "12" for a single line.
+func parseRange(s string) (int, int, error) {
+	startStr, countStr, found := strings.Cut(s, ",")
+	start, err := strconv.Atoi(startStr)
+	if err != nil {
+		return 0, 0, err
+	}
+	count := 1
+	if found {
+		if count, err = strconv.Atoi(countStr); err != nil {
+			return 0, 0, err
+		}
+	}
+	return start, count, nil
+}
+
+// parse parses a patch in the format of git diff. Headers other than
+// the paths, such as file modes, are ignored.
+func parse(patch string) ([]filePatch, error) {
+	lines := strings.SplitAfter(patch, "\n")
+	files := []filePatch{}
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSuffix(lines[i], "\n")
+		switch {
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			oldPath, err := parsePatchPath(line[len("--- "):], "a/")
+			if err != nil {
+				return nil, err
+			}
+			newPath, err := parsePatchPath(strings.TrimSuffix(lines[i+1][len("+++ "):], "\n"), "b/")
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, filePatch{oldPath: oldPath, newPath: newPath})
+			i++
+
+		case strings.HasPrefix(line, "@@ "):
+			if len(files) == 0 {
+				return nil, fmt.Errorf("hunk before the first file")
+			}
+			fields := strings.Fields(line)
+			if len(fields) < 4 || !strings.HasPrefix(fields[1], "-") || !strings.HasPrefix(fields[2], "+") {
+				return nil, fmt.Errorf("bad hunk header %q", line)
+			}
+			oldStart, oldCount, err := parseRange(fields[1][1:])
+			if err != nil {
+				return nil, fmt.Errorf("bad hunk header %q", line)
+			}
+			newStart, newCount, err := parseRange(fields[2][1:])
+			if err != nil {
+				return nil, fmt.Errorf("bad hunk header %q", line)
+			}
+			h := hunk{oldStart: oldStart, newStart: newStart}
+			// The counts say where the hunk ends, since its
+			// lines may themselves start with "---".
+			for oldCount > 0 || newCount > 0 {
+				i++
+				if i >= len(lines) || lines[i] == "" {
+					return nil, fmt.Errorf("truncated hunk %q", line)
+				}
+				kind, text := lines[i][0], lines[i][1:]
+				switch kind {
+				case ' ':
+					oldCount--
+					newCount--
+				case '-':
+					oldCount--
+				case '+':
+					newCount--
+				case '\\':
+					// "\ No newline at end of file"
+					// follows the last line of a file.
+					if len(h.lines) > 0 {
+						last := &h.lines[len(h.lines)-1]
+						last.text = strings.TrimSuffix(last.text, "\n")
+					}
+					continue
+				default:
+					return nil, fmt.Errorf("bad line %q in hunk %q", strings.TrimSuffix(lines[i], "\n"), line)
+				}
+				h.lines = append(h.lines, hunkLine{kind, text})
+			}
+			if i+1 < len(lines) && strings.HasPrefix(lines[i+1], "\\") && len(h.lines) > 0 {
+				last := &h.lines[len(h.lines)-1]
+				last.text = strings.TrimSuffix(last.text, "\n")
+				i++
+			}
+			files[len(files)-1].hunks = append(files[len(files)-1].hunks, h)
+		}
+	}
+	return files, nil
+}
+
+// splitLines splits s into lines, each with its newline, except for a
+// last line without one.
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// findLines returns the index in lines at which want appears, trying
+// near first and then further and further from it, or -1.
+func findLines(lines, want []string, near int) int {
+	matches := func(at int) bool {
+		if at < 0 || at+len(want) > len(lines) {
+			return false
+		}
+		for i, line := range want {
+			if lines[at+i] != line {
+				return false
+			}
+		}
+		return true
+	}
+	for distance := 0; distance <= len(lines); distance++ {
+		if matches(near - distance) {
+			return near - distance
+		}
+		if matches(near + distance) {
+			return near + distance
+		}
+	}
+	return -1
+}
+
+// apply returns the contents of the files under root that patch
+// changes, or with reverse, the contents before it, by path. A nil
+// content means the file is deleted.
+func apply(root, patch string, reverse bool) (map[string]*string, error) {
+	files, err := parse(patch)
+	if err != nil {
+		return nil, err
+	}
+	results := map[string]*string{}
+	for _, file := range files {
+		from, to := file.oldPath, file.newPath
+		if reverse {
+			from, to = to, from
+		}
+		path := from
+		if path == "" {
+			path = to
+		}
+		content, exists, err := readIfExists(filepath.Join(root, filepath.FromSlash(path)))
+		if err != nil {
+			return nil, err
+		}
+		if result, ok := results[path]; ok {
+			exists = result != nil
+			if exists {
+				content = *result
+			}
+		}
+		if from == "" && exists {
+			return nil, fmt.Errorf("%s already exists", path)
+		} else if from != "" && !exists {
+			return nil, fmt.Errorf("%s does not exist", path)
+		}
+
+		lines := splitLines(content)
+		offset := 0
+		for _, h := range file.hunks {
+			oldLines, newLines := []string{}, []string{}
+			for _, line := range h.lines {
+				kind := line.kind
+				if reverse && kind == '+' {
+					kind = '-'
+				} else if reverse && kind == '-' {
+					kind = '+'
+				}
+				if kind != '+' {
+					oldLines = append(oldLines, line.text)
+				}
+				if kind != '-' {
+					newLines = append(newLines, line.text)
+				}
+			}
+			start := h.oldStart
+			if reverse {
+				start = h.newStart
+			}
+			// An empty range is numbered by the line before
+			// it.
+			if len(oldLines) > 0 {
+				start--
+			}
+			at := findLines(lines, oldLines, start+offset)
+			if at < 0 {
+				return nil, fmt.Errorf("%s: the change at line %d does not apply", path, start+1)
+			}
+			lines = append(append(append([]string{}, lines[:at]...), newLines...), lines[at+len(oldLines):]...)
+			offset = at - start + len(newLines) - len(oldLines)
+		}
+
+		if from != "" && from != to {
+			results[from] = nil
+		}
+		if to != "" {
+			joined := strings.Join(lines, "")
+			results[to] = &joined
+		}
+	}
+	return results, nil
+}
+
+// write changes the files under root as apply returned.
+func write(root string, results map[string]*string) error {
+	for path, content := range results {
+		full := filepath.Join(root, filepath.FromSlash(path))
+		if content == nil {
+			if err := os.Remove(full); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+		mode := fs.FileMode(0o644)
+		if info, err := os.Stat(full); err == nil {
+			mode = info.Mode()
+		}
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(full, []byte(*content), mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Apply applies patch to the files under root. Nothing is changed
+// unless all of it applies.
+func Apply(root, patch string) error {
+	results, err := apply(root, patch, false)
+	if err != nil {
+		return err
+	}
+	return write(root, results)
+}
+
+// Revert undoes patch in the files under root. Nothing is changed
+// unless all of it can be undone.
+func Revert(root, patch string) error {
+	results, err := apply(root, patch, true)
+	if err != nil {
+		return err
+	}
+	return write(root, results)
+}
+
+// IsApplied returns whether patch has been applied to the files under
+// root, that is, whether it can be undone.
+func IsApplied(root, patch string) bool {
+	_, err := apply(root, patch, true)
+	return err == nil
+}
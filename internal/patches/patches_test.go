@@ -0,0 +1,151 @@
+package patches
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+)
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	for path, content := range files {
+		full := filepath.Join(root, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(contents)
+}
+
+func TestFileName(t *testing.T) {
+	for _, tc := range []struct {
+		name    api.PkgName
+		version api.PkgVersion
+		file    string
+	}{
+		{"left-pad", "1.3.0", "left-pad+1.3.0.patch"},
+		{"@types/node", "20.1.0", "@types+node+20.1.0.patch"},
+		{"torch", "2.1.0+cpu", "torch+2.1.0+cpu.patch"},
+	} {
+		if file := FileName(tc.name, tc.version); file != tc.file {
+			t.Errorf("FileName(%s, %s) = %s, expected %s", tc.name, tc.version, file, tc.file)
+		}
+		if name, version, ok := ParseFileName(tc.file); !ok || name != tc.name || version != tc.version {
+			t.Errorf("ParseFileName(%s) = %s, %s, %v", tc.file, name, version, ok)
+		}
+	}
+	for _, file := range []string{"left-pad.patch", "left-pad+.patch", "@types+node.patch", "notes.txt"} {
+		if _, _, ok := ParseFileName(file); ok {
+			t.Errorf("expected ParseFileName(%s) to fail", file)
+		}
+	}
+}
+
+func TestDiffAndApply(t *testing.T) {
+	dir := t.TempDir()
+	original, edited, project := filepath.Join(dir, "a"), filepath.Join(dir, "b"), filepath.Join(dir, "project")
+	pristine := map[string]string{
+		"index.js":     "module.exports = leftPad;\n\nfunction leftPad(str, len, ch) {\n  return str;\n}\n",
+		"README.md":    "# left-pad\n",
+		"package.json": "{\"version\": \"1.3.0\"}",
+	}
+	writeFiles(t, original, pristine)
+	writeFiles(t, edited, map[string]string{
+		"index.js":     "module.exports = leftPad;\n\nfunction leftPad(str, len, ch) {\n  return String(str);\n}\n",
+		"package.json": "{\"version\": \"1.3.0-patched\"}",
+		"lib/extra.js": "// ---\n-- not a header\n",
+	})
+	for path, content := range pristine {
+		writeFiles(t, project, map[string]string{"node_modules/left-pad/" + path: content})
+	}
+
+	patch, err := Diff(original, edited, "node_modules/left-pad")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `diff --git a/node_modules/left-pad/README.md b/node_modules/left-pad/README.md
+deleted file mode 100644
+--- a/node_modules/left-pad/README.md
++++ /dev/null
+@@ -1,1 +0,0 @@
+-# left-pad
+diff --git a/node_modules/left-pad/index.js b/node_modules/left-pad/index.js
+--- a/node_modules/left-pad/index.js
++++ b/node_modules/left-pad/index.js
+@@ -1,5 +1,5 @@
+ module.exports = leftPad;
+ 
+ function leftPad(str, len, ch) {
+-  return str;
++  return String(str);
+ }
+diff --git a/node_modules/left-pad/lib/extra.js b/node_modules/left-pad/lib/extra.js
+new file mode 100644
+--- /dev/null
++++ b/node_modules/left-pad/lib/extra.js
+@@ -0,0 +1,2 @@
++// ---
++-- not a header
+diff --git a/node_modules/left-pad/package.json b/node_modules/left-pad/package.json
+--- a/node_modules/left-pad/package.json
++++ b/node_modules/left-pad/package.json
+@@ -1,1 +1,1 @@
+-{"version": "1.3.0"}
+\ No newline at end of file
++{"version": "1.3.0-patched"}
+\ No newline at end of file
+`
+	if patch != expected {
+		t.Fatalf("expected\n%s\ngot\n%s", expected, patch)
+	}
+
+	if IsApplied(project, patch) {
+		t.Error("expected the patch not to be applied yet")
+	}
+	if err := Apply(project, patch); err != nil {
+		t.Fatal(err)
+	}
+	if !IsApplied(project, patch) {
+		t.Error("expected the patch to be applied")
+	}
+	if err := Apply(project, patch); err == nil {
+		t.Error("expected applying the patch twice to fail")
+	}
+	pkg := filepath.Join(project, "node_modules", "left-pad")
+	for path, content := range map[string]string{
+		"index.js":     "module.exports = leftPad;\n\nfunction leftPad(str, len, ch) {\n  return String(str);\n}\n",
+		"package.json": "{\"version\": \"1.3.0-patched\"}",
+		"lib/extra.js": "// ---\n-- not a header\n",
+	} {
+		if actual := readFile(t, filepath.Join(pkg, filepath.FromSlash(path))); actual != content {
+			t.Errorf("%s: expected %q, got %q", path, content, actual)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(pkg, "README.md")); !os.IsNotExist(err) {
+		t.Error("expected README.md to be deleted")
+	}
+
+	if err := Revert(project, patch); err != nil {
+		t.Fatal(err)
+	}
+	for path, content := range pristine {
+		if actual := readFile(t, filepath.Join(pkg, path)); actual != content {
+			t.Errorf("%s: expected %q, got %q", path, content, actual)
+		}
+	}
+
+	if _, err := apply(project, "--- a/../etc/passwd\n+++ b/../etc/passwd\n", false); err == nil {
+		t.Error("expected a patch of a file outside the root to be refused")
+	}
+}
@@ -0,0 +1,226 @@
+// Package picker implements a minimal interactive menu on the
+// terminal. It is used to implement 'upm search --interactive'.
+package picker
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// ErrNoTerminal is returned by Pick if standard input or standard
+// error is not a terminal.
+var ErrNoTerminal = errors.New("an interactive terminal is required")
+
+// key is a keypress that the picker understands.
+type key int
+
+// Constants of type key.
+const (
+	keyOther key = iota
+	keyUp
+	keyDown
+	keyToggle
+	keyEnter
+	keyCancel
+)
+
+// readKey reads one keypress from r. Arrow keys arrive as the escape
+// sequences ESC [ A and ESC [ B (or ESC O A and ESC O B); an ESC that
+// is not followed by anything else is the escape key itself.
+func readKey(r *bufio.Reader) (key, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return keyOther, err
+	}
+	switch b {
+	case '\r', '\n':
+		return keyEnter, nil
+	case ' ':
+		return keyToggle, nil
+	case 'k':
+		return keyUp, nil
+	case 'j':
+		return keyDown, nil
+	case 'q', 3, 4: // Ctrl-C and Ctrl-D, since raw mode disables signals
+		return keyCancel, nil
+	case 0x1b:
+		if r.Buffered() == 0 {
+			return keyCancel, nil
+		}
+		if next, err := r.ReadByte(); err != nil || (next != '[' && next != 'O') {
+			return keyOther, err
+		}
+		code, err := r.ReadByte()
+		if err != nil {
+			return keyOther, err
+		}
+		switch code {
+		case 'A':
+			return keyUp, nil
+		case 'B':
+			return keyDown, nil
+		}
+	}
+	return keyOther, nil
+}
+
+// picker is the state of the menu.
+type picker struct {
+	prompt   string
+	items    []string
+	cursor   int
+	selected []bool
+
+	// The number of items shown at once, and the width to which
+	// lines are truncated.
+	height int
+	width  int
+
+	// The number of lines written by the last render.
+	drawn int
+}
+
+// handle updates the menu for a keypress. It returns true once the
+// user has confirmed or cancelled their choice.
+func (p *picker) handle(k key) (done bool, cancelled bool) {
+	switch k {
+	case keyUp:
+		if p.cursor > 0 {
+			p.cursor--
+		}
+	case keyDown:
+		if p.cursor < len(p.items)-1 {
+			p.cursor++
+		}
+	case keyToggle:
+		p.selected[p.cursor] = !p.selected[p.cursor]
+	case keyEnter:
+		return true, false
+	case keyCancel:
+		return true, true
+	}
+	return false, false
+}
+
+// chosen returns the indices of the selected items, or of the item
+// under the cursor if none is selected.
+func (p *picker) chosen() []int {
+	indices := []int{}
+	for i, selected := range p.selected {
+		if selected {
+			indices = append(indices, i)
+		}
+	}
+	if len(indices) == 0 {
+		indices = append(indices, p.cursor)
+	}
+	return indices
+}
+
+// clear erases the lines written by the last render.
+func (p *picker) clear(w io.Writer) {
+	if p.drawn > 0 {
+		fmt.Fprintf(w, "\x1b[%dA", p.drawn)
+	}
+	fmt.Fprint(w, "\r\x1b[J")
+	p.drawn = 0
+}
+
+// render draws the menu, replacing the previous drawing. Only a
+// window of p.height items around the cursor is shown. Lines end in
+// "\r\n" because the terminal is in raw mode.
+func (p *picker) render(w io.Writer) {
+	p.clear(w)
+	lines := []string{p.prompt + " (arrows to move, space to select, enter to confirm, q to cancel)"}
+
+	start := 0
+	if p.cursor >= p.height {
+		start = p.cursor - p.height + 1
+	}
+	end := start + p.height
+	if end > len(p.items) {
+		end = len(p.items)
+	}
+	for i := start; i < end; i++ {
+		pointer := " "
+		if i == p.cursor {
+			pointer = ">"
+		}
+		check := " "
+		if p.selected[i] {
+			check = "x"
+		}
+		lines = append(lines, fmt.Sprintf("%s [%s] %s", pointer, check, p.items[i]))
+	}
+
+	for _, line := range lines {
+		if runes := []rune(line); p.width > 0 && len(runes) > p.width {
+			line = string(runes[:p.width])
+		}
+		fmt.Fprint(w, line+"\r\n")
+	}
+	p.drawn = len(lines)
+}
+
+// run shows the menu on w and reads keypresses from r until the user
+// confirms or cancels. It returns nil if the user cancels.
+func run(r io.Reader, w io.Writer, p *picker) ([]int, error) {
+	reader := bufio.NewReader(r)
+	for {
+		p.render(w)
+		k, err := readKey(reader)
+		if err != nil {
+			p.clear(w)
+			return nil, err
+		}
+		if done, cancelled := p.handle(k); done {
+			p.clear(w)
+			if cancelled {
+				return nil, nil
+			}
+			return p.chosen(), nil
+		}
+	}
+}
+
+// Pick shows items in a menu on the terminal, in which the user moves
+// with the arrow keys (or j and k), selects any number of items with
+// the space bar, and confirms with enter. It returns the indices of
+// the selected items, or of the highlighted item if none was
+// selected. If the user cancels with q, escape or Ctrl-C, it returns
+// nil.
+func Pick(prompt string, items []string) ([]int, error) {
+	if len(items) == 0 {
+		return nil, nil
+	}
+	in, out := int(os.Stdin.Fd()), int(os.Stderr.Fd())
+	if !term.IsTerminal(in) || !term.IsTerminal(out) {
+		return nil, ErrNoTerminal
+	}
+
+	p := &picker{
+		prompt:   strings.TrimSpace(prompt),
+		items:    items,
+		selected: make([]bool, len(items)),
+		height:   len(items),
+	}
+	if width, height, err := term.GetSize(out); err == nil {
+		p.width = width
+		if height > 2 && height-2 < p.height {
+			p.height = height - 2
+		}
+	}
+
+	state, err := term.MakeRaw(in)
+	if err != nil {
+		return nil, err
+	}
+	defer term.Restore(in, state)
+	return run(os.Stdin, os.Stderr, p)
+}
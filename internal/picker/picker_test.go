@@ -0,0 +1,51 @@
+package picker
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	items := []string{"flask", "flask-cors", "flask-login", "flask-wtf"}
+	for input, expected := range map[string][]int{
+		"\r":                   {0},
+		"\x1b[B\x1b[B\r":       {2},
+		"j \x1b[B\x1b[B \r":    {1, 3},
+		"jjjjjj\x1b[A\r":       {2},
+		"j q":                  nil,
+		"j\x1b":                nil,
+		"\x1b[B\x1b[B\x1b[A\n": {1},
+	} {
+		p := &picker{
+			prompt:   "Add packages:",
+			items:    items,
+			selected: make([]bool, len(items)),
+			height:   2,
+		}
+		var out bytes.Buffer
+		chosen, err := run(strings.NewReader(input), &out, p)
+		if err != nil {
+			t.Errorf("%q: %s", input, err)
+		}
+		if !reflect.DeepEqual(chosen, expected) {
+			t.Errorf("%q: expected %v, got %v", input, expected, chosen)
+		}
+	}
+}
+
+func TestRenderScrolls(t *testing.T) {
+	p := &picker{
+		prompt:   "Add packages:",
+		items:    []string{"a", "b", "c", "d"},
+		selected: []bool{false, false, true, false},
+		cursor:   2,
+		height:   2,
+	}
+	var out bytes.Buffer
+	p.render(&out)
+	if got := out.String(); !strings.Contains(got, "  [ ] b\r\n> [x] c\r\n") || strings.Contains(got, "] a") {
+		t.Errorf("unexpected rendering %q", got)
+	}
+}
@@ -0,0 +1,212 @@
+// Package policy implements the dependency policy of a project, which
+// .upm/policy.toml declares: which packages may be used, which
+// licenses are banned, and how many dependencies the project may have.
+// 'upm add' enforces it on the packages it adds, and 'upm check
+// --policy' checks the whole project against it, e.g. in CI.
+package policy
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// File is the location of the policy file, relative to the project
+// root.
+const File = ".upm/policy.toml"
+
+// Policy is the schema of the policy file. Every field is optional;
+// the zero value allows everything.
+type Policy struct {
+	// Allow lists patterns of the names of the packages that may
+	// be used, such as "@myorg/*". If it is empty, every package
+	// that is not blocked may be.
+	Allow []string `toml:"allow"`
+
+	// Block lists patterns of the names of the packages that may
+	// not be used, even if they are allowed.
+	Block []string `toml:"block"`
+
+	// BannedLicenses lists patterns of the licenses that packages
+	// may not have, such as "AGPL-*".
+	BannedLicenses []string `toml:"banned_licenses"`
+
+	// MaxDependencies is the most packages the specfile may list.
+	// Zero means no limit.
+	MaxDependencies int `toml:"max_dependencies,omitzero"`
+
+	// MaxLockedPackages is the most packages the lockfile may
+	// list, including indirect dependencies. Zero means no limit.
+	MaxLockedPackages int `toml:"max_locked_packages,omitzero"`
+
+	// Origin is where the policy comes from, such as File, for
+	// messages.
+	Origin string `toml:"-"`
+}
+
+// Values for Violation.Kind.
+const (
+	// The package matches a pattern of Block.
+	Blocked = "blocked"
+
+	// Allow is not empty, and the package matches none of it.
+	NotAllowed = "not-allowed"
+
+	// The license of the package matches a pattern of
+	// BannedLicenses.
+	BannedLicense = "banned-license"
+
+	// The specfile lists more than MaxDependencies packages.
+	TooManyDependencies = "too-many-dependencies"
+
+	// The lockfile lists more than MaxLockedPackages packages.
+	TooManyLockedPackages = "too-many-locked-packages"
+)
+
+// Violation is a way in which a project breaks its policy.
+type Violation struct {
+	Kind string
+
+	// Name is the package concerned, or "" for the limits on the
+	// number of packages.
+	Name string
+
+	// Detail says which rule is broken, e.g. `matches "left-*"`.
+	Detail string
+}
+
+func (v Violation) String() string {
+	if v.Name == "" {
+		return fmt.Sprintf("%s (%s)", v.Kind, v.Detail)
+	}
+	return fmt.Sprintf("%s: %s (%s)", v.Name, v.Kind, v.Detail)
+}
+
+// Load reads the policy file at path. A missing file is no policy, for
+// which Load returns nil.
+func Load(path string) (*Policy, error) {
+	var p Policy
+	if _, err := toml.DecodeFile(path, &p); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	p.Origin = path
+	return &p, nil
+}
+
+// Validate checks that the settings of p make sense.
+func (p *Policy) Validate() error {
+	if p.MaxDependencies < 0 || p.MaxLockedPackages < 0 {
+		return fmt.Errorf("the maximum numbers of packages cannot be negative")
+	}
+	return nil
+}
+
+// patternRegexp compiles a pattern, in which "*" matches any run of
+// characters, including none, and "?" any one character. Patterns
+// ignore case.
+func patternRegexp(pattern string) *regexp.Regexp {
+	quoted := regexp.QuoteMeta(strings.TrimSpace(pattern))
+	quoted = strings.ReplaceAll(quoted, `\*`, ".*")
+	quoted = strings.ReplaceAll(quoted, `\?`, ".")
+	return regexp.MustCompile("(?i)^" + quoted + "$")
+}
+
+// matching returns the first of patterns that one of names matches,
+// and whether there is one.
+func matching(patterns []string, names ...string) (string, bool) {
+	for _, pattern := range patterns {
+		re := patternRegexp(pattern)
+		for _, name := range names {
+			if re.MatchString(name) {
+				return pattern, true
+			}
+		}
+	}
+	return "", false
+}
+
+// CheckName returns how the package named name breaks the Allow and
+// Block rules of p. The package may also be given by other names, such
+// as its normalized name, which the patterns are matched against too.
+func (p *Policy) CheckName(name string, aliases ...string) []Violation {
+	names := append([]string{name}, aliases...)
+	if pattern, ok := matching(p.Block, names...); ok {
+		return []Violation{{Kind: Blocked, Name: name, Detail: fmt.Sprintf("matches %#v", pattern)}}
+	}
+	if len(p.Allow) > 0 {
+		if _, ok := matching(p.Allow, names...); !ok {
+			return []Violation{{Kind: NotAllowed, Name: name, Detail: "matches no allowed pattern"}}
+		}
+	}
+	return nil
+}
+
+// orPattern and andPattern split SPDX license expressions.
+var (
+	orPattern  = regexp.MustCompile(`(?i)\s+or\s+`)
+	andPattern = regexp.MustCompile(`(?i)\s+and\s+`)
+)
+
+// licenseBanned returns the pattern of banned that bans license, and
+// whether there is one. A license may be an SPDX expression: "A OR B"
+// is only banned if both A and B are, since the project can pick the
+// other, while "A AND B" is banned if either is.
+func licenseBanned(banned []string, license string) (string, bool) {
+	license = strings.NewReplacer("(", "", ")", "").Replace(license)
+	found := ""
+	for _, choice := range orPattern.Split(license, -1) {
+		pattern, ok := "", false
+		for _, term := range andPattern.Split(choice, -1) {
+			if pattern, ok = matching(banned, strings.TrimSpace(term)); ok {
+				break
+			}
+		}
+		if !ok {
+			return "", false
+		}
+		found = pattern
+	}
+	return found, found != ""
+}
+
+// CheckLicense returns how the package named name, whose license is
+// license, breaks the BannedLicenses rule of p. An unknown license,
+// "", breaks no rule.
+func (p *Policy) CheckLicense(name, license string) []Violation {
+	if strings.TrimSpace(license) == "" {
+		return nil
+	}
+	if pattern, ok := licenseBanned(p.BannedLicenses, license); ok {
+		return []Violation{{Kind: BannedLicense, Name: name, Detail: fmt.Sprintf("%s matches %#v", license, pattern)}}
+	}
+	return nil
+}
+
+// CheckCounts returns how a project whose specfile lists dependencies
+// packages and whose lockfile lists locked packages breaks the limits
+// of p. A negative count is unknown and not checked.
+func (p *Policy) CheckCounts(dependencies, locked int) []Violation {
+	violations := []Violation{}
+	if p.MaxDependencies > 0 && dependencies > p.MaxDependencies {
+		violations = append(violations, Violation{
+			Kind:   TooManyDependencies,
+			Detail: fmt.Sprintf("%d, more than %d", dependencies, p.MaxDependencies),
+		})
+	}
+	if p.MaxLockedPackages > 0 && locked > p.MaxLockedPackages {
+		violations = append(violations, Violation{
+			Kind:   TooManyLockedPackages,
+			Detail: fmt.Sprintf("%d, more than %d", locked, p.MaxLockedPackages),
+		})
+	}
+	return violations
+}
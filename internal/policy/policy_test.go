@@ -0,0 +1,112 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "policy.toml")
+	if p, err := Load(path); p != nil || err != nil {
+		t.Errorf("expected no policy without a file, got %v, %v", p, err)
+	}
+
+	if err := os.WriteFile(path, []byte(`
+allow = ["@myorg/*", "flask*"]
+block = ["flask-evil"]
+banned_licenses = ["AGPL-*"]
+max_dependencies = 10
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &Policy{
+		Allow:           []string{"@myorg/*", "flask*"},
+		Block:           []string{"flask-evil"},
+		BannedLicenses:  []string{"AGPL-*"},
+		MaxDependencies: 10,
+		Origin:          path,
+	}
+	if !reflect.DeepEqual(p, expected) {
+		t.Errorf("Load = %+v, expected %+v", p, expected)
+	}
+
+	if err := os.WriteFile(path, []byte(`max_dependencies = -1`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Error("expected a negative maximum to be rejected")
+	}
+}
+
+func TestCheckName(t *testing.T) {
+	p := &Policy{
+		Allow: []string{"@myorg/*", "flask*", "requests"},
+		Block: []string{"flask-evil", "*-typo?"},
+	}
+	for _, test := range []struct {
+		name    string
+		aliases []string
+		kind    string
+	}{
+		{name: "@myorg/utils"},
+		{name: "Flask"},
+		{name: "Flask_Login", aliases: []string{"flask-login"}},
+		{name: "flask-evil", kind: Blocked},
+		{name: "flask-typo1", kind: Blocked},
+		{name: "lodash", kind: NotAllowed},
+		{name: "@other/utils", kind: NotAllowed},
+	} {
+		violations := p.CheckName(test.name, test.aliases...)
+		kind := ""
+		if len(violations) > 0 {
+			kind = violations[0].Kind
+		}
+		if kind != test.kind {
+			t.Errorf("CheckName(%q) = %v, expected %q", test.name, violations, test.kind)
+		}
+	}
+
+	if violations := (&Policy{}).CheckName("anything"); len(violations) != 0 {
+		t.Errorf("expected an empty policy to allow everything, got %v", violations)
+	}
+}
+
+func TestCheckLicense(t *testing.T) {
+	p := &Policy{BannedLicenses: []string{"AGPL-*", "GPL-3.0*"}}
+	for license, banned := range map[string]bool{
+		"MIT":                        false,
+		"":                           false,
+		"AGPL-3.0-only":              true,
+		"agpl-3.0":                   true,
+		"MIT OR GPL-3.0-or-later":    false,
+		"AGPL-3.0 OR GPL-3.0":        true,
+		"(MIT AND GPL-3.0-or-later)": true,
+		"Apache-2.0 AND MIT":         false,
+	} {
+		if got := len(p.CheckLicense("pkg", license)) > 0; got != banned {
+			t.Errorf("CheckLicense(%q) banned = %v, expected %v", license, got, banned)
+		}
+	}
+}
+
+func TestCheckCounts(t *testing.T) {
+	p := &Policy{MaxDependencies: 2, MaxLockedPackages: 10}
+	if violations := p.CheckCounts(2, 10); len(violations) != 0 {
+		t.Errorf("expected the limits to be inclusive, got %v", violations)
+	}
+	violations := p.CheckCounts(3, -1)
+	if len(violations) != 1 || violations[0].Kind != TooManyDependencies {
+		t.Errorf("expected too many dependencies, got %v", violations)
+	}
+	violations = p.CheckCounts(1, 11)
+	if len(violations) != 1 || violations[0].Kind != TooManyLockedPackages {
+		t.Errorf("expected too many locked packages, got %v", violations)
+	}
+}
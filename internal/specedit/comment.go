@@ -0,0 +1,50 @@
+package specedit
+
+import "strings"
+
+// commentStart returns the index of the comment that starts with
+// marker in line, or -1. A comment starts at the beginning of the line
+// or after whitespace, outside a double-quoted string, as pip
+// requires for requirements files; this keeps the # of a URL fragment
+// out of the comment.
+func commentStart(line, marker string) int {
+	inString := false
+	for i := 0; i < len(line); i++ {
+		switch {
+		case inString && line[i] == '\\':
+			i++
+		case line[i] == '"':
+			inString = !inString
+		case !inString && strings.HasPrefix(line[i:], marker) && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return i
+		}
+	}
+	return -1
+}
+
+// SplitComment splits line into the code before its comment, which
+// starts with marker, and the text of the comment. Both are trimmed,
+// and repeated markers, as in ";; text", are dropped from the comment.
+func SplitComment(line, marker string) (string, string) {
+	idx := commentStart(line, marker)
+	if idx < 0 {
+		return strings.TrimSpace(line), ""
+	}
+	comment := line[idx:]
+	for strings.HasPrefix(comment, marker) {
+		comment = comment[len(marker):]
+	}
+	return strings.TrimSpace(line[:idx]), strings.TrimSpace(comment)
+}
+
+// SetComment returns line with its comment, which starts with marker,
+// replaced by comment, two spaces after the code. Newlines in comment
+// are replaced by spaces, so that it stays on the line.
+func SetComment(line, marker, comment string) string {
+	code := line
+	if idx := commentStart(line, marker); idx >= 0 {
+		code = line[:idx]
+	}
+	comment = strings.Join(strings.Fields(comment), " ")
+	return strings.TrimRight(code, " \t") + "  " + marker + " " + comment
+}
@@ -0,0 +1,25 @@
+package specedit
+
+import "testing"
+
+func TestComments(t *testing.T) {
+	for _, test := range []struct {
+		line, marker   string
+		code, comment  string
+		withNewComment string
+	}{
+		{`flask>=2`, "#", `flask>=2`, "", `flask>=2  # web`},
+		{`flask>=2  # old`, "#", `flask>=2`, "old", `flask>=2  # web`},
+		{`-e git+https://x/y#egg=y`, "#", `-e git+https://x/y#egg=y`, "", `-e git+https://x/y#egg=y  # web`},
+		{`name = "a # b" # c`, "#", `name = "a # b"`, "c", `name = "a # b"  # web`},
+		{`(depends-on "f") ;; why`, ";", `(depends-on "f")`, "why", `(depends-on "f")  ; web`},
+	} {
+		code, comment := SplitComment(test.line, test.marker)
+		if code != test.code || comment != test.comment {
+			t.Errorf("SplitComment(%q) = %q, %q, expected %q, %q", test.line, code, comment, test.code, test.comment)
+		}
+		if got := SetComment(test.line, test.marker, "web"); got != test.withNewComment {
+			t.Errorf("SetComment(%q) = %q, expected %q", test.line, got, test.withNewComment)
+		}
+	}
+}
@@ -0,0 +1,394 @@
+// Package specedit edits specfiles in place, changing only the parts
+// that have to change, so that the comments, key order, indentation
+// and other formatting of the rest of the file survive and UPM's edits
+// show up as minimal diffs.
+package specedit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// jsonNode is a JSON value in a document, with its position.
+type jsonNode struct {
+	// start and end delimit the value, including the brackets of
+	// an object or array.
+	start, end int
+
+	// kind is '{' for an object, '[' for an array and 0 for
+	// anything else.
+	kind byte
+
+	// members are the members of an object, in order.
+	members []jsonMember
+
+	// elems are the elements of an array, in order.
+	elems []*jsonNode
+}
+
+// jsonMember is a member of a JSON object.
+type jsonMember struct {
+	key      string
+	keyStart int
+	value    *jsonNode
+}
+
+// jsonParser finds the positions of the values in a JSON document,
+// which has already been checked to be valid.
+type jsonParser struct {
+	doc []byte
+	pos int
+}
+
+func (p *jsonParser) skipSpace() {
+	for p.pos < len(p.doc) && strings.IndexByte(" \t\r\n", p.doc[p.pos]) >= 0 {
+		p.pos++
+	}
+}
+
+// skipString moves past the string starting at the current position.
+func (p *jsonParser) skipString() {
+	p.pos++
+	for p.doc[p.pos] != '"' {
+		if p.doc[p.pos] == '\\' {
+			p.pos++
+		}
+		p.pos++
+	}
+	p.pos++
+}
+
+func (p *jsonParser) parseValue() *jsonNode {
+	p.skipSpace()
+	node := &jsonNode{start: p.pos}
+	switch p.doc[p.pos] {
+	case '{':
+		node.kind = '{'
+		p.pos++
+		for {
+			p.skipSpace()
+			if p.doc[p.pos] == '}' {
+				break
+			}
+			if p.doc[p.pos] == ',' {
+				p.pos++
+				p.skipSpace()
+			}
+			keyStart := p.pos
+			p.skipString()
+			var key string
+			_ = json.Unmarshal(p.doc[keyStart:p.pos], &key)
+			p.skipSpace()
+			p.pos++ // the colon
+			node.members = append(node.members, jsonMember{key: key, keyStart: keyStart, value: p.parseValue()})
+		}
+		p.pos++
+	case '[':
+		node.kind = '['
+		p.pos++
+		for {
+			p.skipSpace()
+			if p.doc[p.pos] == ']' {
+				break
+			}
+			if p.doc[p.pos] == ',' {
+				p.pos++
+			}
+			node.elems = append(node.elems, p.parseValue())
+		}
+		p.pos++
+	case '"':
+		p.skipString()
+	default:
+		for p.pos < len(p.doc) && strings.IndexByte(" \t\r\n,]}", p.doc[p.pos]) < 0 {
+			p.pos++
+		}
+	}
+	node.end = p.pos
+	return node
+}
+
+// parseJSON parses doc, which must be a valid JSON document.
+func parseJSON(doc []byte) (*jsonNode, error) {
+	if !json.Valid(doc) {
+		var v interface{}
+		err := json.Unmarshal(doc, &v)
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	p := &jsonParser{doc: doc}
+	return p.parseValue(), nil
+}
+
+// lookup returns the value at path under node, or nil.
+func (node *jsonNode) lookup(path []string) *jsonNode {
+	for _, key := range path {
+		if node.kind != '{' {
+			return nil
+		}
+		var found *jsonNode
+		for _, member := range node.members {
+			if member.key == key {
+				found = member.value
+			}
+		}
+		if found == nil {
+			return nil
+		}
+		node = found
+	}
+	return node
+}
+
+// lineIndent returns the whitespace at the start of the line that
+// contains pos.
+func lineIndent(doc []byte, pos int) string {
+	lineStart := bytes.LastIndexByte(doc[:pos], '\n') + 1
+	end := lineStart
+	for end < len(doc) && (doc[end] == ' ' || doc[end] == '\t') {
+		end++
+	}
+	return string(doc[lineStart:end])
+}
+
+// indentUnit guesses the indentation the document uses per level,
+// defaulting to two spaces.
+func indentUnit(doc []byte) string {
+	for _, line := range strings.Split(string(doc), "\n") {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed != "" && len(trimmed) < len(line) {
+			return line[:len(line)-len(trimmed)]
+		}
+	}
+	return "  "
+}
+
+// marshalJSON encodes value for insertion on a line indented by
+// indent.
+func marshalJSON(value interface{}, indent, unit string) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent(indent, unit)
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// splice replaces doc[start:end] with text.
+func splice(doc []byte, start, end int, text string) []byte {
+	out := make([]byte, 0, len(doc)-(end-start)+len(text))
+	out = append(out, doc[:start]...)
+	out = append(out, text...)
+	return append(out, doc[end:]...)
+}
+
+// insertItem adds item, the text of a member or element, at the end
+// of the object or array container. It follows the layout of the
+// existing items, or puts the item on its own line in an empty
+// container.
+func insertItem(doc []byte, container *jsonNode, itemStarts []int, itemEnds []int, item func(indent string) (string, error)) ([]byte, error) {
+	if len(itemStarts) == 0 {
+		outer := lineIndent(doc, container.start)
+		inner := outer + indentUnit(doc)
+		text, err := item(inner)
+		if err != nil {
+			return nil, err
+		}
+		closing := doc[container.end-1]
+		return splice(doc, container.start+1, container.end, "\n"+inner+text+"\n"+outer+string(closing)), nil
+	}
+
+	// The whitespace between the separator before the last item
+	// and the item itself, as in "\n    " or " ".
+	last := len(itemStarts) - 1
+	sepEnd := itemStarts[last]
+	sepStart := sepEnd
+	for sepStart > 0 && strings.IndexByte(" \t\r\n", doc[sepStart-1]) >= 0 {
+		sepStart--
+	}
+	leading := string(doc[sepStart:sepEnd])
+	if last == 0 && !strings.Contains(leading, "\n") {
+		// The only item follows the bracket, as in {"a": 1},
+		// so there is no separator to follow.
+		leading = " "
+	}
+	var indent string
+	if idx := strings.LastIndexByte(leading, '\n'); idx >= 0 {
+		indent = leading[idx+1:]
+	} else {
+		indent = lineIndent(doc, itemStarts[last])
+	}
+	text, err := item(indent)
+	if err != nil {
+		return nil, err
+	}
+	return splice(doc, itemEnds[last], itemEnds[last], ","+leading+text), nil
+}
+
+// removeItem removes the item with index i, delimited by starts[i]
+// and ends[i], from the object or array container, with the
+// separator that goes with it.
+func removeItem(doc []byte, container *jsonNode, starts []int, ends []int, i int) []byte {
+	switch {
+	case len(starts) == 1:
+		return splice(doc, container.start+1, container.end-1, "")
+	case i < len(starts)-1:
+		return splice(doc, starts[i], starts[i+1], "")
+	default:
+		return splice(doc, ends[i-1], ends[i], "")
+	}
+}
+
+// memberSpans returns where each member of an object starts (at its
+// key) and ends (after its value).
+func memberSpans(node *jsonNode) ([]int, []int) {
+	starts, ends := []int{}, []int{}
+	for _, member := range node.members {
+		starts = append(starts, member.keyStart)
+		ends = append(ends, member.value.end)
+	}
+	return starts, ends
+}
+
+// elemSpans returns where each element of an array starts and ends.
+func elemSpans(node *jsonNode) ([]int, []int) {
+	starts, ends := []int{}, []int{}
+	for _, elem := range node.elems {
+		starts = append(starts, elem.start)
+		ends = append(ends, elem.end)
+	}
+	return starts, ends
+}
+
+// SetJSON sets the member at path, a list of object keys, to value.
+// An existing value is replaced; otherwise the member is added at the
+// end of its object, creating the objects along the path as needed.
+func SetJSON(doc []byte, path []string, value interface{}) ([]byte, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("empty path")
+	}
+	root, err := parseJSON(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	// Find the deepest existing object on the path.
+	parent := root
+	depth := 0
+	for ; depth < len(path)-1; depth++ {
+		next := parent.lookup(path[depth : depth+1])
+		if next == nil || next.kind != '{' {
+			break
+		}
+		parent = next
+	}
+	if parent.kind != '{' {
+		return nil, fmt.Errorf("%s is not an object", strings.Join(path[:depth], "."))
+	}
+	if depth == len(path)-1 {
+		if existing := parent.lookup(path[depth:]); existing != nil {
+			text, err := marshalJSON(value, lineIndent(doc, existing.start), indentUnit(doc))
+			if err != nil {
+				return nil, err
+			}
+			return splice(doc, existing.start, existing.end, string(text)), nil
+		}
+	}
+	if existing := parent.lookup(path[depth : depth+1]); existing != nil {
+		return nil, fmt.Errorf("%s is not an object", strings.Join(path[:depth+1], "."))
+	}
+
+	// Wrap the value in the objects that are missing.
+	for i := len(path) - 1; i > depth; i-- {
+		value = map[string]interface{}{path[i]: value}
+	}
+	starts, ends := memberSpans(parent)
+	return insertItem(doc, parent, starts, ends, func(indent string) (string, error) {
+		key, err := marshalJSON(path[depth], "", "")
+		if err != nil {
+			return "", err
+		}
+		text, err := marshalJSON(value, indent, indentUnit(doc))
+		if err != nil {
+			return "", err
+		}
+		return string(key) + ": " + string(text), nil
+	})
+}
+
+// DeleteJSON removes the member at path, a list of object keys. It
+// does nothing if there is no such member.
+func DeleteJSON(doc []byte, path []string) ([]byte, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("empty path")
+	}
+	root, err := parseJSON(doc)
+	if err != nil {
+		return nil, err
+	}
+	parent := root.lookup(path[:len(path)-1])
+	if parent == nil || parent.kind != '{' {
+		return doc, nil
+	}
+	for i, member := range parent.members {
+		if member.key == path[len(path)-1] {
+			starts, ends := memberSpans(parent)
+			return removeItem(doc, parent, starts, ends, i), nil
+		}
+	}
+	return doc, nil
+}
+
+// AppendJSON adds value at the end of the array at path, a list of
+// object keys, creating the array if it does not exist.
+func AppendJSON(doc []byte, path []string, value interface{}) ([]byte, error) {
+	root, err := parseJSON(doc)
+	if err != nil {
+		return nil, err
+	}
+	array := root.lookup(path)
+	if array == nil {
+		return SetJSON(doc, path, []interface{}{value})
+	}
+	if array.kind != '[' {
+		return nil, fmt.Errorf("%s is not an array", strings.Join(path, "."))
+	}
+	starts, ends := elemSpans(array)
+	return insertItem(doc, array, starts, ends, func(indent string) (string, error) {
+		text, err := marshalJSON(value, indent, indentUnit(doc))
+		return string(text), err
+	})
+}
+
+// FilterJSON removes the elements of the array at path, a list of
+// object keys, for which keep, given the element's JSON, returns
+// false. It does nothing if there is no such array.
+func FilterJSON(doc []byte, path []string, keep func(elem []byte) bool) ([]byte, error) {
+	root, err := parseJSON(doc)
+	if err != nil {
+		return nil, err
+	}
+	array := root.lookup(path)
+	if array == nil || array.kind != '[' {
+		return doc, nil
+	}
+	// Remove from the end, so that the earlier elements keep
+	// their indices.
+	for i := len(array.elems) - 1; i >= 0; i-- {
+		elem := array.elems[i]
+		if keep(doc[elem.start:elem.end]) {
+			continue
+		}
+		starts, ends := elemSpans(array)
+		doc = removeItem(doc, array, starts, ends, i)
+		root, err = parseJSON(doc)
+		if err != nil {
+			return nil, err
+		}
+		array = root.lookup(path)
+	}
+	return doc, nil
+}
@@ -0,0 +1,108 @@
+package specedit
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSetJSON(t *testing.T) {
+	for _, test := range []struct {
+		doc      string
+		path     []string
+		value    interface{}
+		expected string
+	}{
+		{
+			doc:      "{\n    \"name\": \"app\", // not JSON, but kept as is\n    \"version\": \"1.0.0\"\n}\n",
+			path:     []string{"version"},
+			value:    "2.0.0",
+			expected: "",
+		},
+		{
+			doc:      "{\n    \"name\": \"app\",\n    \"version\": \"1.0.0\"\n}\n",
+			path:     []string{"version"},
+			value:    "2.0.0",
+			expected: "{\n    \"name\": \"app\",\n    \"version\": \"2.0.0\"\n}\n",
+		},
+		{
+			doc:      "{\n\t\"name\": \"app\"\n}\n",
+			path:     []string{"scripts", "test"},
+			value:    "jest",
+			expected: "{\n\t\"name\": \"app\",\n\t\"scripts\": {\n\t\t\"test\": \"jest\"\n\t}\n}\n",
+		},
+		{
+			doc:      `{"name": "app", "dependencies": {}}`,
+			path:     []string{"dependencies", "left-pad"},
+			value:    "^1.3.0",
+			expected: "{\"name\": \"app\", \"dependencies\": {\n  \"left-pad\": \"^1.3.0\"\n}}",
+		},
+		{
+			doc:      `{"name": "app", "dependencies": {"a": "1"}}`,
+			path:     []string{"dependencies", "b"},
+			value:    "2",
+			expected: `{"name": "app", "dependencies": {"a": "1", "b": "2"}}`,
+		},
+	} {
+		got, err := SetJSON([]byte(test.doc), test.path, test.value)
+		if test.expected == "" {
+			if err == nil {
+				t.Errorf("expected %q to be rejected", test.doc)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("SetJSON(%q, %v): %s", test.doc, test.path, err)
+			continue
+		}
+		if string(got) != test.expected {
+			t.Errorf("SetJSON(%q, %v) = %q, expected %q", test.doc, test.path, got, test.expected)
+		}
+	}
+}
+
+func TestDeleteJSON(t *testing.T) {
+	doc := "{\n  \"a\": 1,\n  \"b\": {\"c\": 2},\n  \"d\": 3\n}\n"
+	for _, test := range []struct {
+		path     []string
+		expected string
+	}{
+		{[]string{"a"}, "{\n  \"b\": {\"c\": 2},\n  \"d\": 3\n}\n"},
+		{[]string{"b"}, "{\n  \"a\": 1,\n  \"d\": 3\n}\n"},
+		{[]string{"d"}, "{\n  \"a\": 1,\n  \"b\": {\"c\": 2}\n}\n"},
+		{[]string{"b", "c"}, "{\n  \"a\": 1,\n  \"b\": {},\n  \"d\": 3\n}\n"},
+		{[]string{"missing"}, doc},
+	} {
+		got, err := DeleteJSON([]byte(doc), test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != test.expected {
+			t.Errorf("DeleteJSON(%v) = %q, expected %q", test.path, got, test.expected)
+		}
+	}
+}
+
+func TestAppendAndFilterJSON(t *testing.T) {
+	doc := []byte("{\n  \"packages\": [\n    {\"name\": \"dplyr\"},\n    {\"name\": \"ggplot2\"}\n  ]\n}\n")
+	doc, err := AppendJSON(doc, []string{"packages"}, map[string]string{"name": "tidyr"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "{\n  \"packages\": [\n    {\"name\": \"dplyr\"},\n    {\"name\": \"ggplot2\"},\n    {\n      \"name\": \"tidyr\"\n    }\n  ]\n}\n"
+	if string(doc) != expected {
+		t.Errorf("expected %q, got %q", expected, doc)
+	}
+
+	doc, err = FilterJSON(doc, []string{"packages"}, func(elem []byte) bool {
+		var pkg struct{ Name string }
+		_ = json.Unmarshal(elem, &pkg)
+		return pkg.Name != "ggplot2" && pkg.Name != "tidyr"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = "{\n  \"packages\": [\n    {\"name\": \"dplyr\"}\n  ]\n}\n"
+	if string(doc) != expected {
+		t.Errorf("expected %q, got %q", expected, doc)
+	}
+}
@@ -0,0 +1,514 @@
+package specedit
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// tomlEntry is a key-value pair in a TOML document, with its position.
+type tomlEntry struct {
+	table []string
+	key   []string
+
+	// lineStart is the start of the line of the key, valueStart
+	// and valueEnd delimit the value, and lineEnd is after the
+	// newline that ends the line of the end of the value.
+	lineStart, valueStart, valueEnd, lineEnd int
+}
+
+// tomlTable is a table header in a TOML document.
+type tomlTable struct {
+	name []string
+
+	// array is true for an [[array]] of tables.
+	array bool
+
+	// end is after the line of the last entry of the table, or
+	// of the header if it has none.
+	end int
+}
+
+// tomlDoc is the layout of a TOML document.
+type tomlDoc struct {
+	entries []tomlEntry
+	tables  []tomlTable
+
+	// rootEnd is after the line of the last entry before the first
+	// table header.
+	rootEnd int
+}
+
+// endOfLine returns the position after the newline that ends the line
+// containing pos, or the end of doc.
+func endOfLine(doc []byte, pos int) int {
+	if idx := bytes.IndexByte(doc[pos:], '\n'); idx >= 0 {
+		return pos + idx + 1
+	}
+	return len(doc)
+}
+
+// skipTOMLString returns the position after the string that starts at
+// pos.
+func skipTOMLString(doc []byte, pos int) (int, error) {
+	quote := doc[pos]
+	if bytes.HasPrefix(doc[pos:], []byte{quote, quote, quote}) {
+		delim := []byte{quote, quote, quote}
+		for i := pos + 3; i < len(doc); i++ {
+			if quote == '"' && doc[i] == '\\' {
+				i++
+				continue
+			}
+			if bytes.HasPrefix(doc[i:], delim) {
+				// Up to two quotes may come right before
+				// the closing delimiter.
+				end := i + 3
+				for end < len(doc) && end < i+5 && doc[end] == quote {
+					end++
+				}
+				return end, nil
+			}
+		}
+		return 0, fmt.Errorf("unterminated multi-line string")
+	}
+	for i := pos + 1; i < len(doc) && doc[i] != '\n'; i++ {
+		if quote == '"' && doc[i] == '\\' {
+			i++
+			continue
+		}
+		if doc[i] == quote {
+			return i + 1, nil
+		}
+	}
+	return 0, fmt.Errorf("unterminated string")
+}
+
+// skipTOMLValue returns the position after the value that starts at
+// pos.
+func skipTOMLValue(doc []byte, pos int) (int, error) {
+	switch doc[pos] {
+	case '"', '\'':
+		return skipTOMLString(doc, pos)
+	case '[', '{':
+		depth := 0
+		for i := pos; i < len(doc); i++ {
+			switch doc[i] {
+			case '"', '\'':
+				end, err := skipTOMLString(doc, i)
+				if err != nil {
+					return 0, err
+				}
+				i = end - 1
+			case '#':
+				i = endOfLine(doc, i) - 1
+			case '[', '{':
+				depth++
+			case ']', '}':
+				depth--
+				if depth == 0 {
+					return i + 1, nil
+				}
+			}
+		}
+		return 0, fmt.Errorf("unterminated array or inline table")
+	default:
+		end := pos
+		for end < len(doc) && doc[end] != '\n' && doc[end] != '#' {
+			end++
+		}
+		for end > pos && (doc[end-1] == ' ' || doc[end-1] == '\t' || doc[end-1] == '\r') {
+			end--
+		}
+		return end, nil
+	}
+}
+
+// splitTOMLKey splits a dotted key, as in `tool."my.tool".name`, into
+// its parts.
+func splitTOMLKey(key string) ([]string, error) {
+	parts := []string{}
+	rest := strings.TrimSpace(key)
+	for {
+		var part string
+		if rest != "" && (rest[0] == '"' || rest[0] == '\'') {
+			end, err := skipTOMLString([]byte(rest), 0)
+			if err != nil {
+				return nil, err
+			}
+			part = rest[1 : end-1]
+			if rest[0] == '"' {
+				if unquoted, err := strconv.Unquote(rest[:end]); err == nil {
+					part = unquoted
+				}
+			}
+			rest = strings.TrimSpace(rest[end:])
+		} else {
+			end := strings.IndexByte(rest, '.')
+			if end < 0 {
+				end = len(rest)
+			}
+			part = strings.TrimSpace(rest[:end])
+			rest = rest[end:]
+		}
+		if part == "" && (len(rest) == 0 || rest[0] == '.') {
+			return nil, fmt.Errorf("invalid key %q", key)
+		}
+		parts = append(parts, part)
+		if rest == "" {
+			return parts, nil
+		}
+		if rest[0] != '.' {
+			return nil, fmt.Errorf("invalid key %q", key)
+		}
+		rest = strings.TrimSpace(rest[1:])
+	}
+}
+
+// parseTOML finds the entries and tables of doc. It understands
+// enough of TOML to find where each value ends, but does not check
+// the values themselves.
+func parseTOML(doc []byte) (*tomlDoc, error) {
+	layout := &tomlDoc{}
+	var table []string
+	current := -1
+	for pos := 0; pos < len(doc); {
+		lineEnd := endOfLine(doc, pos)
+		line := strings.TrimSpace(string(doc[pos:lineEnd]))
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+			pos = lineEnd
+
+		case strings.HasPrefix(line, "["):
+			array := strings.HasPrefix(line, "[[")
+			closing := "]"
+			if array {
+				closing = "]]"
+			}
+			header := strings.TrimPrefix(line, "[")
+			if array {
+				header = strings.TrimPrefix(header, "[")
+			}
+			end := strings.Index(header, closing)
+			if end < 0 {
+				return nil, fmt.Errorf("invalid table header %q", line)
+			}
+			name, err := splitTOMLKey(header[:end])
+			if err != nil {
+				return nil, err
+			}
+			table = name
+			layout.tables = append(layout.tables, tomlTable{name: name, array: array, end: lineEnd})
+			current = len(layout.tables) - 1
+			pos = lineEnd
+
+		default:
+			lineStart := pos
+			eq := -1
+			for i := pos; i < lineEnd; i++ {
+				if doc[i] == '"' || doc[i] == '\'' {
+					end, err := skipTOMLString(doc, i)
+					if err != nil {
+						return nil, err
+					}
+					i = end - 1
+					continue
+				}
+				if doc[i] == '=' {
+					eq = i
+					break
+				}
+			}
+			if eq < 0 {
+				return nil, fmt.Errorf("expected a key and value: %q", line)
+			}
+			key, err := splitTOMLKey(string(doc[pos:eq]))
+			if err != nil {
+				return nil, err
+			}
+			valueStart := eq + 1
+			for valueStart < len(doc) && (doc[valueStart] == ' ' || doc[valueStart] == '\t') {
+				valueStart++
+			}
+			if valueStart >= len(doc) || doc[valueStart] == '\n' {
+				return nil, fmt.Errorf("missing value for %q", line)
+			}
+			valueEnd, err := skipTOMLValue(doc, valueStart)
+			if err != nil {
+				return nil, err
+			}
+			entryEnd := endOfLine(doc, valueEnd)
+			layout.entries = append(layout.entries, tomlEntry{
+				table: table, key: key,
+				lineStart: lineStart, valueStart: valueStart, valueEnd: valueEnd, lineEnd: entryEnd,
+			})
+			if current >= 0 {
+				layout.tables[current].end = entryEnd
+			} else {
+				layout.rootEnd = entryEnd
+			}
+			pos = entryEnd
+		}
+	}
+	return layout, nil
+}
+
+// sameKey returns whether two split keys are the same.
+func sameKey(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// isBareKey returns whether key can be written without quotes.
+func isBareKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, c := range key {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// formatTOMLKey writes a key, quoting it if necessary.
+func formatTOMLKey(key string) string {
+	if isBareKey(key) {
+		return key
+	}
+	return quoteTOMLString(key)
+}
+
+// quoteTOMLString writes s as a TOML basic string.
+func quoteTOMLString(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, c := range s {
+		switch {
+		case c == '"' || c == '\\':
+			sb.WriteByte('\\')
+			sb.WriteRune(c)
+		case c == '\n':
+			sb.WriteString(`\n`)
+		case c == '\t':
+			sb.WriteString(`\t`)
+		case c < 0x20 || c == 0x7f:
+			fmt.Fprintf(&sb, `\u%04X`, c)
+		default:
+			sb.WriteRune(c)
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+// formatTOMLValue writes value, which may be a string, bool, integer,
+// float, slice of those, or map from strings to those, as TOML.
+// Maps become inline tables with sorted keys.
+func formatTOMLValue(value interface{}) (string, error) {
+	switch value := value.(type) {
+	case string:
+		return quoteTOMLString(value), nil
+	case bool:
+		return strconv.FormatBool(value), nil
+	case int:
+		return strconv.Itoa(value), nil
+	case int64:
+		return strconv.FormatInt(value, 10), nil
+	case float64:
+		return strconv.FormatFloat(value, 'g', -1, 64), nil
+	case []string:
+		items := []interface{}{}
+		for _, item := range value {
+			items = append(items, item)
+		}
+		return formatTOMLValue(items)
+	case []interface{}:
+		items := []string{}
+		for _, item := range value {
+			formatted, err := formatTOMLValue(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, formatted)
+		}
+		return "[" + strings.Join(items, ", ") + "]", nil
+	case map[string]interface{}:
+		keys := []string{}
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		items := []string{}
+		for _, key := range keys {
+			formatted, err := formatTOMLValue(value[key])
+			if err != nil {
+				return "", err
+			}
+			items = append(items, formatTOMLKey(key)+" = "+formatted)
+		}
+		if len(items) == 0 {
+			return "{}", nil
+		}
+		return "{ " + strings.Join(items, ", ") + " }", nil
+	}
+	return "", fmt.Errorf("cannot write %T as TOML", value)
+}
+
+// SetTOML sets key in table, a dotted table name such as
+// "tool.poetry.dependencies" or "" for the root table, to value. An
+// existing value is replaced, keeping any comment after it; otherwise
+// the key is added after the last entry of the table, and the table is
+// added at the end of the document if it does not exist.
+func SetTOML(doc []byte, table string, key string, value interface{}) ([]byte, error) {
+	layout, err := parseTOML(doc)
+	if err != nil {
+		return nil, err
+	}
+	var tableName []string
+	if table != "" {
+		if tableName, err = splitTOMLKey(table); err != nil {
+			return nil, err
+		}
+	}
+	formatted, err := formatTOMLValue(value)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range layout.entries {
+		if sameKey(entry.table, tableName) && sameKey(entry.key, []string{key}) {
+			return splice(doc, entry.valueStart, entry.valueEnd, formatted), nil
+		}
+	}
+
+	line := formatTOMLKey(key) + " = " + formatted + "\n"
+	if table == "" {
+		at := layout.rootEnd
+		if at > 0 && doc[at-1] != '\n' {
+			line = "\n" + line
+		}
+		return splice(doc, at, at, line), nil
+	}
+	for _, t := range layout.tables {
+		if !t.array && sameKey(t.name, tableName) {
+			if t.end > 0 && doc[t.end-1] != '\n' {
+				line = "\n" + line
+			}
+			return splice(doc, t.end, t.end, line), nil
+		}
+	}
+
+	header := "["
+	for i, part := range tableName {
+		if i > 0 {
+			header += "."
+		}
+		header += formatTOMLKey(part)
+	}
+	header += "]\n"
+	prefix := ""
+	if len(bytes.TrimSpace(doc)) > 0 {
+		prefix = "\n"
+		if !bytes.HasSuffix(doc, []byte("\n")) {
+			prefix = "\n\n"
+		}
+	}
+	return append(append([]byte{}, doc...), prefix+header+line...), nil
+}
+
+// DeleteTOML removes key from table, a dotted table name or "" for
+// the root table, including the lines of its value. It does nothing
+// if there is no such key.
+func DeleteTOML(doc []byte, table string, key string) ([]byte, error) {
+	layout, err := parseTOML(doc)
+	if err != nil {
+		return nil, err
+	}
+	var tableName []string
+	if table != "" {
+		if tableName, err = splitTOMLKey(table); err != nil {
+			return nil, err
+		}
+	}
+	for _, entry := range layout.entries {
+		if sameKey(entry.table, tableName) && sameKey(entry.key, []string{key}) {
+			return splice(doc, entry.lineStart, entry.lineEnd, ""), nil
+		}
+	}
+	return doc, nil
+}
+
+// MapTOMLStrings replaces each string in the array at key in table, a
+// dotted table name or "" for the root table, with what replace
+// returns for it, as in the dependencies of a pyproject.toml. Strings
+// that replace returns unchanged keep their quoting. It does nothing
+// if there is no such key.
+func MapTOMLStrings(doc []byte, table string, key string, replace func(string) string) ([]byte, error) {
+	layout, err := parseTOML(doc)
+	if err != nil {
+		return nil, err
+	}
+	var tableName []string
+	if table != "" {
+		if tableName, err = splitTOMLKey(table); err != nil {
+			return nil, err
+		}
+	}
+	for _, entry := range layout.entries {
+		if !sameKey(entry.table, tableName) || !sameKey(entry.key, []string{key}) {
+			continue
+		}
+		if doc[entry.valueStart] != '[' {
+			return nil, fmt.Errorf("%s is not an array", key)
+		}
+		type span struct {
+			start, end int
+			text       string
+		}
+		spans := []span{}
+		for i := entry.valueStart; i < entry.valueEnd; i++ {
+			switch doc[i] {
+			case '#':
+				i = endOfLine(doc, i) - 1
+			case '"', '\'':
+				end, err := skipTOMLString(doc, i)
+				if err != nil {
+					return nil, err
+				}
+				literal := string(doc[i:end])
+				value := literal[1 : len(literal)-1]
+				if strings.HasPrefix(literal, `"""`) || strings.HasPrefix(literal, "'''") {
+					// Multi-line strings are left alone.
+					i = end - 1
+					continue
+				}
+				if literal[0] == '"' {
+					if unquoted, err := strconv.Unquote(literal); err == nil {
+						value = unquoted
+					}
+				}
+				if replaced := replace(value); replaced != value {
+					spans = append(spans, span{i, end, quoteTOMLString(replaced)})
+				}
+				i = end - 1
+			}
+		}
+		// Replace from the end, so that the earlier spans keep
+		// their positions.
+		for i := len(spans) - 1; i >= 0; i-- {
+			doc = splice(doc, spans[i].start, spans[i].end, spans[i].text)
+		}
+		return doc, nil
+	}
+	return doc, nil
+}
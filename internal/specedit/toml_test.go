@@ -0,0 +1,163 @@
+package specedit
+
+import "testing"
+
+const pyproject = `# The project's metadata.
+[project]
+name = "app"  # the distribution name
+version = "0.1.0"
+dependencies = [
+    "requests>=2",  # HTTP
+    "flask",
+]
+
+[tool.poetry.dependencies]
+python = "^3.10"
+"zope.interface" = "*"
+`
+
+func TestSetTOML(t *testing.T) {
+	for _, test := range []struct {
+		table    string
+		key      string
+		value    interface{}
+		expected string
+	}{
+		{
+			table: "project", key: "name", value: "web",
+			expected: `# The project's metadata.
+[project]
+name = "web"  # the distribution name
+version = "0.1.0"
+dependencies = [
+    "requests>=2",  # HTTP
+    "flask",
+]
+
+[tool.poetry.dependencies]
+python = "^3.10"
+"zope.interface" = "*"
+`,
+		},
+		{
+			table: "project", key: "dependencies", value: []string{"flask"},
+			expected: `# The project's metadata.
+[project]
+name = "app"  # the distribution name
+version = "0.1.0"
+dependencies = ["flask"]
+
+[tool.poetry.dependencies]
+python = "^3.10"
+"zope.interface" = "*"
+`,
+		},
+		{
+			table: "project", key: "license", value: "MIT",
+			expected: `# The project's metadata.
+[project]
+name = "app"  # the distribution name
+version = "0.1.0"
+dependencies = [
+    "requests>=2",  # HTTP
+    "flask",
+]
+license = "MIT"
+
+[tool.poetry.dependencies]
+python = "^3.10"
+"zope.interface" = "*"
+`,
+		},
+		{
+			table: "tool.poetry.dependencies", key: "zope.interface", value: "^6",
+			expected: `# The project's metadata.
+[project]
+name = "app"  # the distribution name
+version = "0.1.0"
+dependencies = [
+    "requests>=2",  # HTTP
+    "flask",
+]
+
+[tool.poetry.dependencies]
+python = "^3.10"
+"zope.interface" = "^6"
+`,
+		},
+		{
+			table: "tool.uv", key: "sources", value: map[string]interface{}{"app": map[string]interface{}{"workspace": true}},
+			expected: pyproject + `
+[tool.uv]
+sources = { app = { workspace = true } }
+`,
+		},
+	} {
+		got, err := SetTOML([]byte(pyproject), test.table, test.key, test.value)
+		if err != nil {
+			t.Errorf("SetTOML(%q, %q): %s", test.table, test.key, err)
+			continue
+		}
+		if string(got) != test.expected {
+			t.Errorf("SetTOML(%q, %q) = %q, expected %q", test.table, test.key, got, test.expected)
+		}
+	}
+}
+
+func TestDeleteTOML(t *testing.T) {
+	got, err := DeleteTOML([]byte(pyproject), "project", "dependencies")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `# The project's metadata.
+[project]
+name = "app"  # the distribution name
+version = "0.1.0"
+
+[tool.poetry.dependencies]
+python = "^3.10"
+"zope.interface" = "*"
+`
+	if string(got) != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+
+	if _, err := DeleteTOML([]byte("[project\nname = 1\n"), "project", "name"); err == nil {
+		t.Error("expected an invalid table header to be rejected")
+	}
+}
+
+func TestMapTOMLStrings(t *testing.T) {
+	got, err := MapTOMLStrings([]byte(pyproject), "project", "dependencies", func(s string) string {
+		if s == "flask" {
+			return "flask==3.0.3"
+		}
+		return s
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `# The project's metadata.
+[project]
+name = "app"  # the distribution name
+version = "0.1.0"
+dependencies = [
+    "requests>=2",  # HTTP
+    "flask==3.0.3",
+]
+
+[tool.poetry.dependencies]
+python = "^3.10"
+"zope.interface" = "*"
+`
+	if string(got) != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+
+	if got, err := MapTOMLStrings([]byte(pyproject), "project", "optional", func(s string) string { return "x" }); err != nil || string(got) != pyproject {
+		t.Errorf("expected a missing array to be left alone, got %q, %v", got, err)
+	}
+	if _, err := MapTOMLStrings([]byte(pyproject), "project", "name", func(s string) string { return s }); err == nil {
+		t.Error("expected a string to be rejected")
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"strings"
 
 	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/config"
 	"github.com/replit/upm/internal/util"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 )
@@ -21,7 +22,7 @@ var st *store
 
 // currentVersion is the current store schema version. See the Version
 // field in the store struct.
-const currentVersion = 2
+const currentVersion = 3
 
 // getStoreLocation returns the file path of the JSON store.
 func getStoreLocation() string {
@@ -62,6 +63,13 @@ func read() {
 	}
 }
 
+// Reset forgets the store that was read into memory, so that the
+// next access rereads it from disk. It must be called when changing
+// to a different project directory.
+func Reset() {
+	st = nil
+}
+
 // readMaybe reads the store if it hasn't been read yet.
 func readMaybe() {
 	if st == nil {
@@ -94,11 +102,15 @@ func getLanguageCache(language, languageAlias string) *storeLanguage {
 }
 
 // Write writes the current contents of the store from memory back to
-// disk. If there is an error, it terminates the process.
+// disk. If there is an error, it terminates the process. With
+// --dry-run, Write does nothing.
 func Write(ctx context.Context) {
 	//nolint:ineffassign,wastedassign,staticcheck
 	span, ctx := tracer.StartSpanFromContext(ctx, "store.Write")
 	defer span.Finish()
+	if config.DryRun {
+		return
+	}
 	filename := getStoreLocation()
 
 	filename, err := filepath.Abs(filename)
@@ -237,3 +249,80 @@ func UpdateFileHashes(ctx context.Context, b api.LanguageBackend) {
 	cache.SpecfileHash = hashFile(b.Specfile)
 	cache.LockfileHash = hashFile(b.Lockfile)
 }
+
+// ListSpecfileWithCache returns b.ListSpecfile(true), re-using the
+// result recorded by the last call if the specfile has not changed
+// since. It also returns that recorded result, or nil if there is
+// none, so that callers can report what changed. The specfile must
+// exist. Call Write afterwards to persist the new result.
+func ListSpecfileWithCache(ctx context.Context, b api.LanguageBackend) (deps, previous api.PkgDeps) {
+	//nolint:ineffassign,wastedassign,staticcheck
+	span, ctx := tracer.StartSpanFromContext(ctx, "ListSpecfileWithCache")
+	defer span.Finish()
+	readMaybe()
+	initLanguage(b.Name, b.Alias)
+	cache := getLanguageCache(b.Name, b.Alias)
+
+	if cache.ListedSpecfileHash != "" {
+		previous = api.PkgDeps{}
+		for name, dep := range cache.ListedSpecfile {
+			previous[api.PkgName(name)] = api.PkgDep{
+				Spec:   api.PkgSpec(dep.Spec),
+				Dev:    dep.Dev,
+				Group:  dep.Group,
+				Reason: dep.Reason,
+			}
+		}
+	}
+
+	current := hashFile(b.Specfile)
+	if previous != nil && current == cache.ListedSpecfileHash {
+		util.Debugf("using cached listing of %s", b.Specfile)
+		return previous, previous
+	}
+
+	deps = b.ListSpecfile(true)
+	cache.ListedSpecfile = map[string]storedDep{}
+	for name, dep := range deps {
+		cache.ListedSpecfile[string(name)] = storedDep{
+			Spec:   string(dep.Spec),
+			Dev:    dep.Dev,
+			Group:  dep.Group,
+			Reason: dep.Reason,
+		}
+	}
+	cache.ListedSpecfileHash = current
+	return deps, previous
+}
+
+// ListLockfileWithCache is like ListSpecfileWithCache, but for
+// b.ListLockfile(). The lockfile must exist.
+func ListLockfileWithCache(ctx context.Context, b api.LanguageBackend) (pkgs, previous map[api.PkgName]api.PkgVersion) {
+	//nolint:ineffassign,wastedassign,staticcheck
+	span, ctx := tracer.StartSpanFromContext(ctx, "ListLockfileWithCache")
+	defer span.Finish()
+	readMaybe()
+	initLanguage(b.Name, b.Alias)
+	cache := getLanguageCache(b.Name, b.Alias)
+
+	if cache.ListedLockfileHash != "" {
+		previous = map[api.PkgName]api.PkgVersion{}
+		for name, version := range cache.ListedLockfile {
+			previous[api.PkgName(name)] = api.PkgVersion(version)
+		}
+	}
+
+	current := hashFile(b.Lockfile)
+	if previous != nil && current == cache.ListedLockfileHash {
+		util.Debugf("using cached listing of %s", b.Lockfile)
+		return previous, previous
+	}
+
+	pkgs = b.ListLockfile()
+	cache.ListedLockfile = map[string]string{}
+	for name, version := range pkgs {
+		cache.ListedLockfile[string(name)] = string(version)
+	}
+	cache.ListedLockfileHash = current
+	return pkgs, previous
+}
@@ -0,0 +1,57 @@
+package store
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/replit/upm/internal/api"
+)
+
+func TestListSpecfileWithCache(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("UPM_STORE", filepath.Join(dir, "store.json"))
+	specfile := filepath.Join(dir, "spec")
+	if err := os.WriteFile(specfile, []byte("flask\n"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := 0
+	deps := api.PkgDeps{"flask": {Spec: ">= 3.0"}}
+	b := api.LanguageBackend{
+		Name:     "test",
+		Specfile: specfile,
+		ListSpecfile: func(bool) api.PkgDeps {
+			calls++
+			return deps
+		},
+	}
+	ctx := context.Background()
+	Reset()
+	defer Reset()
+
+	if _, previous := ListSpecfileWithCache(ctx, b); previous != nil || calls != 1 {
+		t.Fatalf("first listing: previous %v, %d calls", previous, calls)
+	}
+	Write(ctx)
+
+	// A fresh read of the store must not reparse the unchanged
+	// specfile.
+	Reset()
+	if got, _ := ListSpecfileWithCache(ctx, b); calls != 1 || got["flask"].Spec != ">= 3.0" {
+		t.Fatalf("cached listing: got %v, %d calls", got, calls)
+	}
+
+	deps = api.PkgDeps{"rich": {Spec: ">= 13.0", Dev: true}}
+	if err := os.WriteFile(specfile, []byte("rich\n"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	got, previous := ListSpecfileWithCache(ctx, b)
+	if calls != 2 || !got["rich"].Dev {
+		t.Errorf("changed listing: got %v, %d calls", got, calls)
+	}
+	if _, ok := previous["flask"]; !ok {
+		t.Errorf("expected previous listing to contain flask, got %v", previous)
+	}
+}
@@ -23,6 +23,25 @@ type storeLanguage struct {
 	// The hash of the last sequence of matches for GuessRegexps
 	// against the project code.
 	GuessedImportsHash hash `json:"guessedImportsHash,omitempty"`
+
+	// The last return value of b.ListSpecfile(true), and the hash
+	// of the specfile it was read from. Used by 'upm list' to
+	// avoid reparsing an unchanged specfile, and by 'upm list
+	// --changed' as the state to compare against.
+	ListedSpecfile     map[string]storedDep `json:"listedSpecfile,omitempty"`
+	ListedSpecfileHash hash                 `json:"listedSpecfileHash,omitempty"`
+
+	// The same for b.ListLockfile().
+	ListedLockfile     map[string]string `json:"listedLockfile,omitempty"`
+	ListedLockfileHash hash              `json:"listedLockfileHash,omitempty"`
+}
+
+// storedDep is the serializable form of api.PkgDep.
+type storedDep struct {
+	Spec   string `json:"spec"`
+	Dev    bool   `json:"dev,omitempty"`
+	Group  string `json:"group,omitempty"`
+	Reason string `json:"reason,omitempty"`
 }
 
 // store represents the JSON written (by default) to .upm/store.json.
@@ -9,6 +9,7 @@ import (
 	"os/exec"
 	"reflect"
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/replit/upm/internal/util"
@@ -29,13 +30,24 @@ func New(headers ...string) Table {
 	return Table{headers: headers}
 }
 
+// isEmpty reports whether a struct field has no value to show.
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.String, reflect.Slice:
+		return v.Len() == 0
+	default:
+		return v.IsZero()
+	}
+}
+
 // FromStructs creates a new table from the given slice of structs.
 // The table headers are generated from the struct field reflection
 // metadata: each struct field must have a reflection metadata key
 // "pretty" whose value is the header to display. The only allowed
-// field types in the struct are string and []string. The strings are
-// used as table cells directly, while the slices are concatenated
-// with commas first.
+// field types in the struct are string, []string and integers. The
+// strings are used as table cells directly, the slices are
+// concatenated with commas first, and zero integers are left blank.
+// Columns that are empty in every row are omitted.
 func FromStructs(structs interface{}) Table {
 	sv := reflect.ValueOf(structs)
 	st := reflect.TypeOf(structs).Elem()
@@ -45,7 +57,7 @@ func FromStructs(structs interface{}) Table {
 	for i := 0; i < st.NumField(); i++ {
 		nonempty := false
 		for j := 0; j < sv.Len(); j++ {
-			if sv.Index(j).Field(i).Len() > 0 {
+			if !isEmpty(sv.Index(j).Field(i)) {
 				nonempty = true
 				break
 			}
@@ -67,6 +79,10 @@ func FromStructs(structs interface{}) Table {
 			switch rfield.Kind() {
 			case reflect.String:
 				value = rfield.String()
+			case reflect.Int, reflect.Int64:
+				if rfield.Int() != 0 {
+					value = strconv.FormatInt(rfield.Int(), 10)
+				}
 			case reflect.Slice:
 				parts := []string{}
 				for j := 0; j < rfield.Len(); j++ {
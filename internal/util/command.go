@@ -1,13 +1,227 @@
 package util
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/kballard/go-shellquote"
+	"github.com/replit/upm/internal/config"
+	"github.com/replit/upm/internal/conflict"
 )
 
+// transientErrors are substrings of the output of package managers
+// that indicate a network or registry failure that is worth retrying.
+var transientErrors = []string{
+	"ETIMEDOUT",
+	"ECONNRESET",
+	"EAI_AGAIN",
+	"socket hang up",
+	"Connection reset by peer",
+	"Temporary failure in name resolution",
+	"Read timed out",
+	"429 Too Many Requests",
+	"502 Bad Gateway",
+	"503 Service Unavailable",
+	"504 Gateway Time",
+}
+
+// isTransient returns true if output suggests that a command failed
+// because of a transient network or registry problem.
+func isTransient(output string) bool {
+	for _, pattern := range transientErrors {
+		if strings.Contains(output, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// networkErrors are substrings of the output of package managers that
+// indicate a network or registry failure that retrying is unlikely to
+// fix. Together with transientErrors, they make a failed command exit
+// with ExitNetwork.
+var networkErrors = []string{
+	"ENOTFOUND",
+	"ECONNREFUSED",
+	"Could not resolve host",
+	"Name or service not known",
+	"Connection refused",
+	"Network is unreachable",
+	"network is unreachable",
+	"SSL: CERTIFICATE_VERIFY_FAILED",
+	"unable to get local issuer certificate",
+	"failed to download",
+	"Failed to download",
+	"Unable to load the service index",
+}
+
+// conflictErrors are substrings of the output of package managers that
+// indicate that the requested versions cannot be satisfied together,
+// which make a failed command exit with ExitConflict.
+var conflictErrors = []string{
+	"ERESOLVE",
+	"ERR_PNPM_NO_MATCHING_VERSION",
+	"ERR_PNPM_PEER_DEP_ISSUES",
+	"Couldn't find any versions for",
+	"No candidates found",
+	"ResolutionImpossible",
+	"conflicting dependencies",
+	"Could not find a version that satisfies the requirement",
+	"SolverProblemError",
+	"version solving failed",
+	"No solution found when resolving",
+	"Your requirements could not be resolved",
+	"could not find compatible versions",
+	"failed to select a version",
+	"NU1107",
+}
+
+// failureCode classifies the failure of a command from the last part
+// of its output.
+func failureCode(output string) ExitCode {
+	if isTransient(output) {
+		return ExitNetwork
+	}
+	for _, pattern := range networkErrors {
+		if strings.Contains(output, pattern) {
+			return ExitNetwork
+		}
+	}
+	for _, pattern := range conflictErrors {
+		if strings.Contains(output, pattern) {
+			return ExitConflict
+		}
+	}
+	return ExitSubprocess
+}
+
+// cmdError is the error of a command that failed, with the last part
+// of its output, which dieCmd classifies.
+type cmdError struct {
+	err    error
+	output string
+}
+
+func (e *cmdError) Error() string {
+	return e.err.Error()
+}
+
+func (e *cmdError) Unwrap() error {
+	return e.err
+}
+
+// tailBuffer keeps the last part of what is written to it, for
+// matching against transientErrors.
+type tailBuffer struct {
+	buf []byte
+}
+
+const tailBufferSize = 64 * 1024
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > tailBufferSize {
+		t.buf = t.buf[len(t.buf)-tailBufferSize:]
+	}
+	return len(p), nil
+}
+
+// newCommand builds an exec.Cmd for cmd that is killed once the
+// configured timeout for the program elapses, that does not prompt for
+// input with --no-input (see nonInteractive), and that leaves out
+// versions too new for min_release_age if the program can (see
+// withReleaseCutoff). Its stdin is left unset, so it reads from the
+// null device and a prompt that slips through sees the end of its
+// input rather than waiting forever. The returned function must be
+// called when the command has finished.
+func newCommand(cmd []string) (*exec.Cmd, context.Context, context.CancelFunc) {
+	timeout := config.TimeoutFor(filepath.Base(cmd[0]))
+	args, env := nonInteractive(cmd)
+	env = withReleaseCutoff(filepath.Base(cmd[0]), env)
+	if timeout <= 0 {
+		command := exec.Command(args[0], args[1:]...)
+		command.Env = env
+		return command, context.Background(), func() {}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	command := exec.CommandContext(ctx, args[0], args[1:]...)
+	command.Env = env
+	return command, ctx, cancel
+}
+
+// runCommand runs cmd, retrying with exponential backoff, up to
+// config.Retries times, if it fails with what looks like a transient
+// registry error. Before each attempt, configure is called to connect
+// the command's output; anything it writes to output is checked for
+// transient errors.
+func runCommand(cmd []string, configure func(command *exec.Cmd, output io.Writer)) error {
+	for attempt := 0; ; attempt++ {
+		command, ctx, cancel := newCommand(cmd)
+		var output tailBuffer
+		configure(command, &output)
+		start := time.Now()
+		err := runTracked(command)
+		cancel()
+		logCmdResult(cmd, start, err)
+
+		if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("timed out after %s", config.TimeoutFor(filepath.Base(cmd[0])))
+		}
+		if err == nil {
+			return nil
+		}
+		if attempt >= config.Retries || !isTransient(string(output.buf)) {
+			return &cmdError{err: err, output: string(output.buf)}
+		}
+
+		delay := time.Second << attempt
+		Log(fmt.Sprintf("%s failed with a transient error; retrying in %s", filepath.Base(cmd[0]), delay))
+		time.Sleep(delay)
+		ProgressMsg(quoteCmd(cmd))
+	}
+}
+
+// dieCmd terminates the process after cmd failed with err,
+// distinguishing a tool that is not installed from one that failed,
+// and both from one that was interrupted. A failure is classified by
+// the output of the command, so that a network error or a version
+// conflict reported by the package manager exits with the same code
+// as one UPM detects itself.
+func dieCmd(cmd []string, err error) {
+	dieIfInterrupted()
+	if errors.Is(err, exec.ErrNotFound) {
+		DieMissingTool("%s: not found; is it installed?", cmd[0])
+	}
+	code := ExitSubprocess
+	var failure *cmdError
+	if errors.As(err, &failure) {
+		code = failureCode(failure.output)
+	}
+	if explanation := explainConflict(cmd, err); explanation != nil {
+		die(code, "%s", explanation)
+	}
+	die(code, "%s", err)
+}
+
+// explainConflict returns an explanation of the version conflict that
+// made cmd fail with err, or nil if it failed for another reason or the
+// output of the package manager could not be made sense of.
+func explainConflict(cmd []string, err error) *conflict.Explanation {
+	var failure *cmdError
+	if !errors.As(err, &failure) || failureCode(failure.output) != ExitConflict {
+		return nil
+	}
+	return conflict.Explain(cmd, failure.output)
+}
+
 // quoteCmd escapes shell characters in a command. Additionally, it
 // replaces long or multiline arguments with a placeholder.
 func quoteCmd(cmd []string) string {
@@ -21,27 +235,84 @@ func quoteCmd(cmd []string) string {
 	return shellquote.Join(cleanedCmd...)
 }
 
+// capturedCmds collects the commands passed to RunCmd while
+// CaptureCmds is running, and is nil otherwise.
+var capturedCmds *[][]string
+
+// CaptureCmds calls fn and returns the commands it passed to RunCmd,
+// which are recorded instead of being run. Commands whose output fn
+// reads, with GetCmdOutput and the like, still run.
+func CaptureCmds(fn func()) [][]string {
+	cmds := [][]string{}
+	capturedCmds = &cmds
+	defer func() {
+		capturedCmds = nil
+	}()
+	fn()
+	return cmds
+}
+
 // RunCmd prints and runs the given command, exiting the process on
-// error or command failure. Stdout and stderr go to the terminal.
+// error or command failure. Stdout and stderr go to the terminal, as
+// described for cmdOutput.
+// With --dry-run, the command is printed to stdout instead of being
+// run.
 func RunCmd(cmd []string) {
+	if capturedCmds != nil {
+		*capturedCmds = append(*capturedCmds, cmd)
+		return
+	}
+	if config.DryRun {
+		fmt.Println("would run: " + shellquote.Join(cmd...))
+		return
+	}
 	ProgressMsg(quoteCmd(cmd))
-	command := exec.Command(cmd[0], cmd[1:]...)
-	command.Stdout = os.Stderr
-	command.Stderr = os.Stderr
-	if err := command.Run(); err != nil {
-		DieSubprocess("%s", err)
+	shown := newCmdOutput(cmd)
+	err := runCommand(cmd, func(command *exec.Cmd, output io.Writer) {
+		command.Stdout = io.MultiWriter(shown, output)
+		command.Stderr = io.MultiWriter(shown, output)
+	})
+	// A conflict that can be explained is, instead of showing the
+	// package manager's account of it again.
+	shown.finish(err != nil && explainConflict(cmd, err) == nil)
+	if err != nil {
+		dieCmd(cmd, err)
 	}
 }
 
 // GetCmdOutputFallible prints and runs the given command, returning its
-// stdout as a string. Stderr goes to the terminal. GetCmdOutputFallible
+// stdout as a string. Stderr goes to the terminal, as described for
+// cmdOutput. GetCmdOutputFallible
 // does not exit the process on error or command failure, but instead
 // returns an error.
 func GetCmdOutputFallible(cmd []string) ([]byte, error) {
+	return GetCmdOutputWithInput(cmd, nil)
+}
+
+// GetCmdOutputWithInput is like GetCmdOutputFallible, but writes
+// input to the command's stdin.
+func GetCmdOutputWithInput(cmd []string, input []byte) ([]byte, error) {
+	return getCmdOutput(cmd, func(command *exec.Cmd) {
+		if input != nil {
+			command.Stdin = bytes.NewReader(input)
+		}
+	})
+}
+
+// getCmdOutput implements the GetCmdOutput functions. prepare is
+// called on the command before each attempt to run it.
+func getCmdOutput(cmd []string, prepare func(command *exec.Cmd)) ([]byte, error) {
 	ProgressMsg(quoteCmd(cmd))
-	command := exec.Command(cmd[0], cmd[1:]...)
-	command.Stderr = os.Stderr
-	return command.Output()
+	var stdout bytes.Buffer
+	shown := newCmdOutput(cmd)
+	err := runCommand(cmd, func(command *exec.Cmd, output io.Writer) {
+		stdout.Reset()
+		prepare(command)
+		command.Stdout = io.MultiWriter(&stdout, output)
+		command.Stderr = io.MultiWriter(shown, output)
+	})
+	shown.finish(err != nil)
+	return stdout.Bytes(), err
 }
 
 // GetCmdOutput prints and runs the given command, returning its
@@ -50,24 +321,72 @@ func GetCmdOutputFallible(cmd []string) ([]byte, error) {
 func GetCmdOutput(cmd []string) []byte {
 	output, err := GetCmdOutputFallible(cmd)
 	if err != nil {
-		DieSubprocess("%s", err)
+		dieCmd(cmd, err)
 	}
 	return output
 }
 
+// GetCmdOutputDir runs cmd, which prints a directory, such as the
+// cache of a package manager, and returns it, or "" if cmd fails or
+// prints nothing.
+func GetCmdOutputDir(cmd []string) string {
+	output, err := GetCmdOutputFallible(cmd)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
+
 // GetExitCode runs a commands, and optionally prints the output to
 // stdout and/or stderr, and it returns the exit code afterwards.
+// Since the exit code is the point, it is never retried.
 func GetExitCode(cmd []string, printStdout bool, printStderr bool) int {
 	ProgressMsg(quoteCmd(cmd))
-	command := exec.Command(cmd[0], cmd[1:]...)
+	command, _, cancel := newCommand(cmd)
+	defer cancel()
 	if printStdout {
 		command.Stdout = os.Stdout
 	}
 	if printStderr {
 		command.Stderr = os.Stderr
 	}
-	if err := command.Run(); err != nil {
-		return err.(*exec.ExitError).ExitCode()
+	start := time.Now()
+	err := runTracked(command)
+	logCmdResult(cmd, start, err)
+	if err != nil {
+		dieIfInterrupted()
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return exitErr.ExitCode()
+		}
+		dieCmd(cmd, err)
+	}
+	return 0
+}
+
+// RunAttached runs cmd with the terminal as its stdin, stdout and
+// stderr, and returns its exit code. Unlike the commands UPM runs
+// itself, it is not subject to the timeout and is never retried.
+// With --dry-run, the command is printed to stdout instead of being
+// run.
+func RunAttached(cmd []string) int {
+	if config.DryRun {
+		fmt.Println("would run: " + shellquote.Join(cmd...))
+		return 0
+	}
+	ProgressMsg(quoteCmd(cmd))
+	command := exec.Command(cmd[0], cmd[1:]...)
+	command.Stdin = os.Stdin
+	command.Stdout = os.Stdout
+	command.Stderr = os.Stderr
+	start := time.Now()
+	err := runTracked(command)
+	logCmdResult(cmd, start, err)
+	if err != nil {
+		dieIfInterrupted()
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return exitErr.ExitCode()
+		}
+		dieCmd(cmd, err)
 	}
 	return 0
 }
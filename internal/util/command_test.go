@@ -0,0 +1,193 @@
+//go:build unix
+
+package util
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/replit/upm/internal/config"
+)
+
+// flakyScript fails with a transient error the first time it is run
+// in a directory, and succeeds after that.
+const flakyScript = `#!/bin/sh
+if [ -e "$1/ran" ]; then
+  echo ok
+  exit 0
+fi
+touch "$1/ran"
+echo "npm ERR! code ECONNRESET" >&2
+exit 1
+`
+
+func TestRetryTransient(t *testing.T) {
+	defer func(quiet bool, retries int) {
+		config.Quiet, config.Retries = quiet, retries
+	}(config.Quiet, config.Retries)
+	config.Quiet = true
+
+	dir := t.TempDir()
+	script := filepath.Join(dir, "flaky")
+	if err := os.WriteFile(script, []byte(flakyScript), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	config.Retries = 0
+	if _, err := GetCmdOutputFallible([]string{script, dir}); err == nil {
+		t.Fatal("expected a failure without retries")
+	}
+
+	if err := os.Remove(filepath.Join(dir, "ran")); err != nil {
+		t.Fatal(err)
+	}
+	config.Retries = 1
+	output, err := GetCmdOutputFallible([]string{script, dir})
+	if err != nil {
+		t.Fatalf("expected the retry to succeed, got %v", err)
+	}
+	if strings.TrimSpace(string(output)) != "ok" {
+		t.Errorf("expected only the output of the retry, got %q", output)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	defer func(quiet bool, timeout time.Duration) {
+		config.Quiet, config.Timeout = quiet, timeout
+	}(config.Quiet, config.Timeout)
+	config.Quiet = true
+	config.Timeout = 50 * time.Millisecond
+
+	_, err := GetCmdOutputFallible([]string{"sleep", "10"})
+	if err == nil || err.Error() != "timed out after 50ms" {
+		t.Errorf("expected a timeout, got %v", err)
+	}
+}
+
+func TestCaptureCmds(t *testing.T) {
+	dir := t.TempDir()
+	marker := filepath.Join(dir, "ran")
+	cmds := CaptureCmds(func() {
+		RunCmd([]string{"touch", marker})
+	})
+	if len(cmds) != 1 || strings.Join(cmds[0], " ") != "touch "+marker {
+		t.Errorf("unexpected commands: %q", cmds)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Errorf("captured command was run")
+	}
+}
+
+func TestNoInput(t *testing.T) {
+	defer func(quiet, noInput bool) {
+		config.Quiet, config.NoInput = quiet, noInput
+	}(config.Quiet, config.NoInput)
+	config.Quiet = true
+	config.NoInput = true
+
+	output, err := GetCmdOutputFallible([]string{"sh", "-c", `echo "$GIT_TERMINAL_PROMPT"; cat`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(output) != "0\n" {
+		t.Errorf("expected git prompts to be disabled and no input, got %q", output)
+	}
+
+	cmd, env := nonInteractive([]string{"/usr/bin/mvn", "install"})
+	if strings.Join(cmd, " ") != "/usr/bin/mvn --batch-mode install" {
+		t.Errorf("unexpected command %q", cmd)
+	}
+	if env[len(env)-1] != "DEBIAN_FRONTEND=noninteractive" {
+		t.Errorf("unexpected environment %q", env)
+	}
+	_, env = nonInteractive([]string{"poetry", "add", "flask"})
+	if !strings.Contains(strings.Join(env, "\n"), "\nPOETRY_NO_INTERACTION=1") {
+		t.Errorf("expected POETRY_NO_INTERACTION, got %q", env)
+	}
+
+	config.NoInput = false
+	if _, env := nonInteractive([]string{"poetry"}); env != nil {
+		t.Errorf("expected the environment to be inherited, got %q", env)
+	}
+}
+
+func TestReleaseCutoff(t *testing.T) {
+	defer func(age time.Duration) { config.MinReleaseAge = age }(config.MinReleaseAge)
+
+	config.MinReleaseAge = 0
+	if env := withReleaseCutoff("npm", nil); env != nil {
+		t.Errorf("expected no cutoff without min_release_age, got %q", env)
+	}
+
+	config.MinReleaseAge = 72 * time.Hour
+	env := withReleaseCutoff("uv", []string{"PATH=/bin"})
+	if len(env) != 2 || !strings.HasPrefix(env[1], "UV_EXCLUDE_NEWER=") {
+		t.Fatalf("expected a cutoff for uv, got %q", env)
+	}
+	cutoff, err := time.Parse(time.RFC3339, strings.TrimPrefix(env[1], "UV_EXCLUDE_NEWER="))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if age := time.Since(cutoff); age < 72*time.Hour || age > 73*time.Hour {
+		t.Errorf("expected a cutoff 72 hours ago, got %s", cutoff)
+	}
+	if env := withReleaseCutoff("pip", nil); env != nil {
+		t.Errorf("expected no cutoff for pip, got %q", env)
+	}
+}
+
+func TestFailureCode(t *testing.T) {
+	defer func(quiet bool, retries int) {
+		config.Quiet, config.Retries = quiet, retries
+	}(config.Quiet, config.Retries)
+	config.Quiet = true
+	config.Retries = 0
+
+	testCases := []struct {
+		output string
+		code   ExitCode
+	}{
+		{"npm ERR! code ERESOLVE", ExitConflict},
+		{"SolverProblemError\nBecause app depends on a (^1) and b (^2), version solving failed.", ExitConflict},
+		{"npm ERR! code ENOTFOUND", ExitNetwork},
+		{"npm ERR! code ECONNRESET", ExitNetwork},
+		{"Error: something else went wrong", ExitSubprocess},
+	}
+	for _, tc := range testCases {
+		err := Catch(func() {
+			RunCmd([]string{"sh", "-c", "echo '" + tc.output + "' >&2; exit 1"})
+		})
+		var dieErr *Error
+		if !errors.As(err, &dieErr) || dieErr.Code != tc.code {
+			t.Errorf("%q: expected code %d, got %#v", tc.output, tc.code, err)
+		}
+	}
+}
+
+func TestExplainConflict(t *testing.T) {
+	defer func(quiet bool) {
+		config.Quiet = quiet
+	}(config.Quiet)
+	config.Quiet = true
+
+	dir := t.TempDir()
+	script := "#!/bin/sh\necho \"Because myapp depends on flask (99.0) which doesn't match any versions, version solving failed.\" >&2\nexit 1\n"
+	if err := os.WriteFile(filepath.Join(dir, "poetry"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	err := Catch(func() {
+		RunCmd([]string{filepath.Join(dir, "poetry"), "add", "flask==99.0"})
+	})
+	var dieErr *Error
+	if !errors.As(err, &dieErr) || dieErr.Code != ExitConflict {
+		t.Fatalf("expected a conflict, got %#v", err)
+	}
+	if !strings.HasPrefix(dieErr.Msg, "version conflict: no version of flask matches 99.0") {
+		t.Errorf("expected the conflict to be explained, got %q", dieErr.Msg)
+	}
+}
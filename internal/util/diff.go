@@ -0,0 +1,175 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around each
+// change by UnifiedDiff.
+const diffContext = 3
+
+// diffOp is one line of an edit script: ' ' for a kept line, '-' for
+// a deleted one and '+' for an inserted one.
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// splitLines splits s into lines, keeping a final line without a
+// trailing newline.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// editScript computes a shortest edit script from a to b using the
+// longest common subsequence. Specfiles are small, so the quadratic
+// table is fine.
+func editScript(a, b []string) []diffOp {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if strings.TrimSuffix(a[i], "\n") == strings.TrimSuffix(b[j], "\n") {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	ops := []diffOp{}
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case strings.TrimSuffix(a[i], "\n") == strings.TrimSuffix(b[j], "\n"):
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+	return ops
+}
+
+// UnifiedDiff returns a unified diff between the old and new contents
+// of the file name, or the empty string if they are the same.
+func UnifiedDiff(name string, old, new string) string {
+	hunks := DiffHunks(old, new)
+	if hunks == "" {
+		return ""
+	}
+	return fmt.Sprintf("--- %s\n+++ %s\n", name, name) + hunks
+}
+
+// DiffHunks returns the hunks of a unified diff between old and new,
+// without the header naming the files, or the empty string if they are
+// the same. A last line without a newline is marked the way patch(1)
+// expects.
+func DiffHunks(old, new string) string {
+	ops := editScript(splitLines(old), splitLines(new))
+
+	var sb strings.Builder
+	// Line numbers of the next op in the old and new files.
+	oldLine, newLine := 1, 1
+	for start := 0; start < len(ops); {
+		// Find the next change.
+		for start < len(ops) && ops[start].kind == ' ' {
+			start++
+			oldLine++
+			newLine++
+		}
+		if start == len(ops) {
+			break
+		}
+
+		// Extend the hunk until diffContext*2 unchanged lines
+		// separate it from the next change.
+		end := start
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			run := end
+			for run < len(ops) && ops[run].kind == ' ' {
+				run++
+			}
+			if run == len(ops) || run-end > 2*diffContext {
+				break
+			}
+			end = run
+		}
+
+		from := start - diffContext
+		if from < 0 {
+			from = 0
+		}
+		to := end + diffContext
+		if to > len(ops) {
+			to = len(ops)
+		}
+
+		hunkOld, hunkNew := oldLine-(start-from), newLine-(start-from)
+		oldCount, newCount := 0, 0
+		for _, op := range ops[from:to] {
+			if op.kind != '+' {
+				oldCount++
+			}
+			if op.kind != '-' {
+				newCount++
+			}
+		}
+
+		// An empty range is numbered by the line before it.
+		if oldCount == 0 {
+			hunkOld--
+		}
+		if newCount == 0 {
+			hunkNew--
+		}
+
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", hunkOld, oldCount, hunkNew, newCount)
+		for _, op := range ops[from:to] {
+			sb.WriteByte(op.kind)
+			sb.WriteString(strings.TrimSuffix(op.line, "\n"))
+			sb.WriteByte('\n')
+			if !strings.HasSuffix(op.line, "\n") {
+				sb.WriteString("\\ No newline at end of file\n")
+			}
+		}
+
+		for _, op := range ops[start:to] {
+			if op.kind != '+' {
+				oldLine++
+			}
+			if op.kind != '-' {
+				newLine++
+			}
+		}
+		start = to
+	}
+	return sb.String()
+}
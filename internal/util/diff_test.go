@@ -0,0 +1,56 @@
+package util
+
+import "testing"
+
+func TestUnifiedDiff(t *testing.T) {
+	tcs := []struct {
+		name     string
+		old, new string
+		expected string
+	}{
+		{
+			name:     "unchanged",
+			old:      "a\nb\n",
+			new:      "a\nb\n",
+			expected: "",
+		},
+		{
+			name: "new file",
+			old:  "",
+			new:  "a\nb\n",
+			expected: "--- f\n+++ f\n" +
+				"@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name: "changed line with context",
+			old:  "1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			new:  "1\n2\n3\n4\nfive\n6\n7\n8\n9\n",
+			expected: "--- f\n+++ f\n" +
+				"@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n",
+		},
+		{
+			name: "separate hunks",
+			old:  "a\n1\n2\n3\n4\n5\n6\n7\n8\nb\n",
+			new:  "A\n1\n2\n3\n4\n5\n6\n7\n8\nB\n",
+			expected: "--- f\n+++ f\n" +
+				"@@ -1,4 +1,4 @@\n-a\n+A\n 1\n 2\n 3\n" +
+				"@@ -7,4 +7,4 @@\n 6\n 7\n 8\n-b\n+B\n",
+		},
+		{
+			name: "no newline at end",
+			old:  "a\nb",
+			new:  "a\nc",
+			expected: "--- f\n+++ f\n" +
+				"@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n\\ No newline at end of file\n",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			actual := UnifiedDiff("f", tc.old, tc.new)
+			if actual != tc.expected {
+				t.Errorf("expected\n%q\ngot\n%q", tc.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ExitCode classifies a fatal error. It is the status the upm binary
+// exits with when the error reaches the top level.
+//
+// The codes from 2 to 6 are the ones automation is expected to react
+// to, and do not change: the command line was wrong, a package manager
+// is missing, the network or registry failed, the requested versions
+// conflict, or the lockfile is out of date. The codes from 10 up
+// classify everything else more finely.
+type ExitCode int
+
+const (
+	ExitUsage         ExitCode = 2
+	ExitMissingTool   ExitCode = 3
+	ExitNetwork       ExitCode = 4
+	ExitConflict      ExitCode = 5
+	ExitStaleLockfile ExitCode = 6
+
+	ExitIO                  ExitCode = 10
+	ExitOverwrite           ExitCode = 11
+	ExitProtocol            ExitCode = 13
+	ExitConsistency         ExitCode = 14
+	ExitInitializationError ExitCode = 15
+	ExitSubprocess          ExitCode = 16
+	ExitUnimplemented       ExitCode = 17
+	ExitLocked              ExitCode = 20
+)
+
+// Error is a fatal error raised by one of the Die functions. Rather
+// than exiting the process on the spot, the Die functions panic with
+// an *Error, which unwinds to whoever is handling errors: Catch for
+// library callers, or HandleExit for the upm binary.
+type Error struct {
+	Code ExitCode
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return e.Msg
+}
+
+// Catch runs fn and returns the *Error it died with, if any. Panics
+// that are not an *Error are propagated.
+func Catch(fn func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			var dieErr *Error
+			if rerr, ok := r.(error); ok && errors.As(rerr, &dieErr) {
+				err = dieErr
+				return
+			}
+			panic(r)
+		}
+	}()
+	fn()
+	return nil
+}
+
+// HandleExit must be deferred at the top of the process. If the
+// process is dying with an *Error, HandleExit prints it and exits with
+// its code.
+func HandleExit() {
+	if r := recover(); r != nil {
+		if err, ok := r.(*Error); ok {
+			if err.Msg != "" {
+				logMsg(levelError, err.Msg)
+			}
+			os.Exit(int(err.Code))
+		}
+		panic(r)
+	}
+}
+
+// die is like fmt.Printf, but unwinds with an *Error carrying the
+// message and code instead of returning.
+func die(code ExitCode, format string, a ...interface{}) {
+	panic(&Error{Code: code, Msg: fmt.Sprintf(format, a...)})
+}
+
+// Exit unwinds like the Die functions, but exits with code and no
+// message. It passes on the exit code of a command that has already
+// reported its own failure.
+func Exit(code int) {
+	panic(&Error{Code: ExitCode(code)})
+}
@@ -0,0 +1,43 @@
+package util
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCatch(t *testing.T) {
+	err := Catch(func() {
+		DieNetwork("%s: connection refused", "registry.npmjs.org")
+	})
+	var dieErr *Error
+	if !errors.As(err, &dieErr) {
+		t.Fatalf("expected *Error, got %#v", err)
+	}
+	if dieErr.Code != ExitNetwork {
+		t.Errorf("expected code %d, got %d", ExitNetwork, dieErr.Code)
+	}
+	if dieErr.Msg != "registry.npmjs.org: connection refused" {
+		t.Errorf("unexpected message %q", dieErr.Msg)
+	}
+
+	if err := Catch(func() {}); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+
+	defer func() {
+		if r := recover(); r != "boom" {
+			t.Errorf("expected other panics to propagate, got %v", r)
+		}
+	}()
+	_ = Catch(func() { panic("boom") })
+}
+
+func TestDieMissingTool(t *testing.T) {
+	err := Catch(func() {
+		RunCmd([]string{"upm-test-no-such-tool"})
+	})
+	var dieErr *Error
+	if !errors.As(err, &dieErr) || dieErr.Code != ExitMissingTool {
+		t.Errorf("expected missing tool error, got %#v", err)
+	}
+}
@@ -2,15 +2,18 @@ package util
 
 import (
 	"bytes"
+	"fmt"
 	"io"
-	"net/http"
+	"io/fs"
 	"os"
 	"path"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
 
 	"github.com/natefinch/atomic"
+	"github.com/replit/upm/internal/config"
 	"github.com/replit/upm/resources"
 )
 
@@ -54,6 +57,15 @@ func AddIngoredPaths(paths []string) {
 // retrying non-atomically if it can't. If both attempts fail,
 // TryWriteAtomic terminates the process.
 func TryWriteAtomic(filename string, contents []byte) {
+	if config.DryRun {
+		old, err := os.ReadFile(filename)
+		if err != nil && !os.IsNotExist(err) {
+			DieIO("%s: %s", filename, err)
+		}
+		fmt.Println("would write " + filename)
+		fmt.Print(UnifiedDiff(filename, string(old), string(contents)))
+		return
+	}
 	if err1 := atomic.WriteFile(filename, bytes.NewReader(contents)); err1 != nil {
 		if err2 := os.WriteFile(filename, contents, 0o666); err2 != nil {
 			DieIO("%s: %s; on non-atomic retry: %s", filename, err1, err2)
@@ -86,52 +98,51 @@ func PatternExists(pattern string) bool {
 
 // SearchRecursive does a recursive regexp search in the current
 // directory. Only files whose basenames match one of the globs in
-// patterns will be searched. The return value is a list of matches as
-// would be returned by regexp.FindAllStringSubmatch. Matches are
-// returned in a deterministic order. If an I/O error occurs,
-// SearchRecursive terminates the process.
+// patterns will be searched, and paths that .gitignore files or the
+// guess.ignore_paths setting ignore are skipped. The return value is
+// a list of matches as would be returned by
+// regexp.FindAllStringSubmatch. Matches are returned in a
+// deterministic order. If an I/O error occurs, SearchRecursive
+// terminates the process.
 func SearchRecursive(r *regexp.Regexp, patterns []string) [][]string {
-	matches := [][]string{}
-	err := filepath.Walk(".", func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			DieIO("%s: %s", path, err)
-		}
-		for _, name := range IgnoredPaths {
-			if filepath.Base(path) == name {
-				return filepath.SkipDir
-			}
-		}
-		didMatch := false
-		for _, pattern := range patterns {
-			matched, err := filepath.Match(pattern, filepath.Base(path))
-			if err != nil {
-				panic(err)
-			}
-			if matched {
-				didMatch = true
-				break
-			}
-		}
-		if !didMatch {
-			return nil
-		}
-		if info.Mode().IsRegular() {
-			contentsB, err := os.ReadFile(path)
+	skip := map[string]bool{}
+	for _, name := range IgnoredPaths {
+		skip[name] = true
+	}
+	paths, err := walkSourceFiles(".", patterns, skip, true, 0)
+	if err != nil {
+		DieIO("%s", err)
+	}
+
+	// The files are searched concurrently, and their matches put
+	// back in the order of the paths.
+	found := make([][][]string, len(paths))
+	errs := make([]error, len(paths))
+	sem := make(chan struct{}, walkConcurrency)
+	var wg sync.WaitGroup
+	for i := range paths {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			contents, err := os.ReadFile(paths[i])
 			if err != nil {
-				DieIO("%s: %s", path, err)
+				errs[i] = err
+				return
 			}
-			contents := string(contentsB)
+			found[i] = r.FindAllStringSubmatch(string(contents), -1)
+		}(i)
+	}
+	wg.Wait()
 
-			matches = append(matches,
-				r.FindAllStringSubmatch(contents, -1)...,
-			)
+	matches := [][]string{}
+	for i := range paths {
+		if errs[i] != nil {
+			DieIO("%s: %s", paths[i], errs[i])
 		}
-		return nil
-	})
-	if err != nil {
-		panic(err)
+		matches = append(matches, found[i]...)
 	}
-
 	return matches
 }
 
@@ -139,7 +150,7 @@ func SearchRecursive(r *regexp.Regexp, patterns []string) [][]string {
 // https://golangcode.com/download-a-file-from-a-url/.
 func DownloadFile(filepath string, url string) {
 	ProgressMsg("download " + url)
-	resp, err := http.Get(url)
+	resp, err := httpClient.Get(url)
 	if err != nil {
 		DieNetwork("%s: %s", url, err)
 	}
@@ -239,3 +250,23 @@ func ChdirToUPM() {
 		cur = next
 	}
 }
+
+// DirSize returns the total size of the regular files under dir,
+// without following symlinks.
+func DirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.Type().IsRegular() {
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
@@ -0,0 +1,79 @@
+package util
+
+import (
+	"sort"
+	"strings"
+)
+
+// maxSuggestions is the number of candidates returned by Suggest.
+const maxSuggestions = 3
+
+// Levenshtein returns the edit distance between a and b: the number
+// of single-character insertions, deletions and substitutions needed
+// to turn one into the other.
+func Levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j] + 1
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+			if prev[j-1]+cost < cur[j] {
+				cur[j] = prev[j-1] + cost
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+// Suggest returns the candidates that are close enough to name to be
+// likely typos of it, closest first, and at most maxSuggestions of
+// them. The comparison ignores case. A candidate equal to name is not
+// a suggestion.
+func Suggest(name string, candidates []string) []string {
+	needle := strings.ToLower(name)
+	// Allow one edit per three characters, so that short names
+	// do not match everything.
+	threshold := len([]rune(needle)) / 3
+	if threshold < 1 {
+		threshold = 1
+	}
+
+	type match struct {
+		candidate string
+		distance  int
+	}
+	matches := []match{}
+	seen := map[string]bool{}
+	for _, candidate := range candidates {
+		lower := strings.ToLower(candidate)
+		if lower == needle || seen[lower] {
+			continue
+		}
+		seen[lower] = true
+		if d := Levenshtein(needle, lower); d <= threshold {
+			matches = append(matches, match{candidate, d})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].distance < matches[j].distance
+	})
+
+	suggestions := []string{}
+	for i := 0; i < len(matches) && i < maxSuggestions; i++ {
+		suggestions = append(suggestions, matches[i].candidate)
+	}
+	return suggestions
+}
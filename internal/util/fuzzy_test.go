@@ -0,0 +1,40 @@
+package util
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLevenshtein(t *testing.T) {
+	for _, tc := range []struct {
+		a, b     string
+		expected int
+	}{
+		{"", "", 0},
+		{"flask", "flask", 0},
+		{"flask", "", 5},
+		{"reqeusts", "requests", 2},
+		{"kitten", "sitting", 3},
+		{"lodash", "lodahs", 2},
+		{"café", "cafe", 1},
+	} {
+		if got := Levenshtein(tc.a, tc.b); got != tc.expected {
+			t.Errorf("Levenshtein(%q, %q): expected %d, got %d", tc.a, tc.b, tc.expected, got)
+		}
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	candidates := []string{"requests", "requests-oauthlib", "Flask", "flask", "rich", "numpy"}
+	for name, expected := range map[string][]string{
+		"reqeusts": {"requests"},
+		"flsk":     {"Flask"},
+		"FLASK":    {},
+		"ric":      {"rich"},
+		"pandas":   {},
+	} {
+		if got := Suggest(name, candidates); !reflect.DeepEqual(got, expected) {
+			t.Errorf("Suggest(%q): expected %v, got %v", name, expected, got)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package util
+
+import (
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// ignoreRule is one pattern of a .gitignore file, or of the
+// guess.ignore_paths setting, which uses the same syntax.
+type ignoreRule struct {
+	// base is the slash-separated directory, relative to the root
+	// of the walk, that the pattern is relative to; "" for the
+	// root itself.
+	base string
+
+	// negate is set for patterns starting with "!", which include
+	// again what earlier patterns ignore.
+	negate bool
+
+	// dirOnly is set for patterns ending with "/", which only
+	// match directories.
+	dirOnly bool
+
+	// re matches the paths, relative to base, that the pattern
+	// matches.
+	re *regexp.Regexp
+}
+
+// ignoreRules are the rules that apply in a directory, from those of
+// the .gitignore files furthest above it to its own. As in git, the
+// last rule that matches a path decides whether it is ignored.
+type ignoreRules []ignoreRule
+
+// parseIgnoreRules parses the patterns of a .gitignore file in the
+// directory base. Blank lines and comments are skipped.
+func parseIgnoreRules(base string, text string) []ignoreRule {
+	rules := []ignoreRule{}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if !strings.HasSuffix(line, `\ `) {
+			line = strings.TrimRight(line, " \t")
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if rule, ok := parseIgnoreRule(base, line); ok {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// parseIgnoreRule parses one .gitignore pattern, returning false if
+// it matches nothing.
+func parseIgnoreRule(base string, pattern string) (ignoreRule, bool) {
+	rule := ignoreRule{base: base}
+	if strings.HasPrefix(pattern, "!") {
+		rule.negate = true
+		pattern = pattern[1:]
+	} else if strings.HasPrefix(pattern, `\!`) || strings.HasPrefix(pattern, `\#`) {
+		pattern = pattern[1:]
+	}
+	if strings.HasSuffix(pattern, "/") {
+		rule.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+	// A pattern with a slash other than at its end is relative to
+	// the directory of the .gitignore file; otherwise it matches
+	// at any depth below it.
+	anchored := strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+	if pattern == "" {
+		return rule, false
+	}
+
+	var expr strings.Builder
+	expr.WriteString("^")
+	if !anchored {
+		expr.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/") && (i == 0 || pattern[i-1] == '/'):
+			expr.WriteString("(?:.*/)?")
+			i += 2
+		case pattern[i:] == "**" && (i == 0 || pattern[i-1] == '/'):
+			expr.WriteString(".*")
+			i++
+		case c == '*':
+			expr.WriteString("[^/]*")
+		case c == '?':
+			expr.WriteString("[^/]")
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			expr.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		case c == '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				expr.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	expr.WriteString("$")
+
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return rule, false
+	}
+	rule.re = re
+	return rule, true
+}
+
+// with returns the rules followed by more, leaving rules as they are.
+func (rules ignoreRules) with(more []ignoreRule) ignoreRules {
+	if len(more) == 0 {
+		return rules
+	}
+	combined := make(ignoreRules, 0, len(rules)+len(more))
+	combined = append(combined, rules...)
+	return append(combined, more...)
+}
+
+// ignores returns whether the rules ignore rel, a slash-separated path
+// relative to the root of the walk.
+func (rules ignoreRules) ignores(rel string, isDir bool) bool {
+	ignored := false
+	for _, rule := range rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		sub := rel
+		if rule.base != "" {
+			if !strings.HasPrefix(rel, rule.base+"/") {
+				continue
+			}
+			sub = rel[len(rule.base)+1:]
+		}
+		if rule.re.MatchString(sub) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+// readIgnoreRules returns the rules of the .gitignore file in the
+// directory rel under root, if it has one.
+func readIgnoreRules(root string, rel string) []ignoreRule {
+	contents, err := os.ReadFile(path.Join(root, rel, ".gitignore"))
+	if err != nil {
+		return nil
+	}
+	if rel == "." {
+		rel = ""
+	}
+	return parseIgnoreRules(rel, string(contents))
+}
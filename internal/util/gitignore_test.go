@@ -0,0 +1,44 @@
+package util
+
+import "testing"
+
+func TestIgnoreRules(t *testing.T) {
+	rules := ignoreRules(parseIgnoreRules("", `
+# build output
+*.log
+/build
+out/
+docs/**/*.py
+!keep.log
+\#notes
+`)).with(parseIgnoreRules("sub", "generated/\n/local.py\n"))
+
+	for _, test := range []struct {
+		path     string
+		isDir    bool
+		expected bool
+	}{
+		{"debug.log", false, true},
+		{"a/b/debug.log", false, true},
+		{"keep.log", false, false},
+		{"build", true, true},
+		{"src/build", true, false},
+		{"out", true, true},
+		{"out", false, false},
+		{"src/out", true, true},
+		{"docs/conf.py", false, true},
+		{"docs/a/b/conf.py", false, true},
+		{"src/docs/conf.py", false, false},
+		{"#notes", false, true},
+		{"sub/generated", true, true},
+		{"sub/a/generated", true, true},
+		{"generated", true, false},
+		{"sub/local.py", false, true},
+		{"sub/a/local.py", false, false},
+		{"main.py", false, false},
+	} {
+		if actual := rules.ignores(test.path, test.isDir); actual != test.expected {
+			t.Errorf("%s (dir: %t): expected ignored %t, got %t", test.path, test.isDir, test.expected, actual)
+		}
+	}
+}
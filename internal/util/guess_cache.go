@@ -0,0 +1,130 @@
+package util
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/natefinch/atomic"
+	"github.com/replit/upm/internal/config"
+)
+
+// GuessCacheFile is where, relative to the project, the imports that
+// GuessWithTreeSitter found in each source file are cached, so that
+// guessing again only parses the files that changed since.
+const GuessCacheFile = ".upm/cache/guess.json"
+
+// guessCacheVersion is the schema version of GuessCacheFile. It is
+// incremented whenever what is cached changes, which invalidates the
+// caches written before.
+const guessCacheVersion = 1
+
+// guessCache is the JSON of GuessCacheFile.
+type guessCache struct {
+	Version int `json:"version"`
+
+	// Queries maps the key of a query and the file patterns it is
+	// run on, as guessCacheKey returns it, to the imports found in
+	// the files it was run on, by the SHA-256 of their contents.
+	Queries map[string]map[string][]string `json:"queries,omitempty"`
+}
+
+// guessCaches are the caches read or written so far, by the path of
+// their file, so that a daemon only reads each one once.
+var (
+	guessCaches   = map[string]*guessCache{}
+	guessCachesMu sync.Mutex
+)
+
+// guessCacheKey returns the key in a cache of queryImports run on the
+// files matching pathSegmentPatterns. The patterns tell apart the
+// languages that share a query, such as JavaScript and TypeScript.
+func guessCacheKey(queryImports string, pathSegmentPatterns []string) string {
+	sum := sha256.Sum256([]byte(queryImports + "\x00" + strings.Join(pathSegmentPatterns, "\x00")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// hashContents returns the key in a cache of a file's contents.
+func hashContents(contents []byte) string {
+	sum := sha256.Sum256(contents)
+	return hex.EncodeToString(sum[:])
+}
+
+// loadGuessCache returns the cache in filename, reading it if it has
+// not been yet. A cache that is missing, unreadable or of another
+// version is empty. It must be called with guessCachesMu held.
+func loadGuessCache(filename string) *guessCache {
+	if cache, ok := guessCaches[filename]; ok {
+		return cache
+	}
+	cache := &guessCache{}
+	if contents, err := os.ReadFile(filename); err == nil {
+		if err := json.Unmarshal(contents, cache); err != nil || cache.Version != guessCacheVersion {
+			cache = &guessCache{}
+		}
+	}
+	cache.Version = guessCacheVersion
+	if cache.Queries == nil {
+		cache.Queries = map[string]map[string][]string{}
+	}
+	guessCaches[filename] = cache
+	return cache
+}
+
+// cachedImports returns the imports cached in filename for the query
+// with key, by the hashes of the files they were found in. The result
+// must not be modified.
+func cachedImports(filename string, key string) map[string][]string {
+	guessCachesMu.Lock()
+	defer guessCachesMu.Unlock()
+	return loadGuessCache(filename).Queries[key]
+}
+
+// cacheImports replaces the imports cached in filename for the query
+// with key by scanned, which holds the files that the query was just
+// run on, so that the files that are gone are forgotten. The file is
+// only written if that changes it, and not at all with --dry-run.
+// Failing to write it is not an error, since it is only a cache.
+func cacheImports(filename string, key string, scanned map[string][]string) {
+	guessCachesMu.Lock()
+	defer guessCachesMu.Unlock()
+	cache := loadGuessCache(filename)
+	if sameHashes(cache.Queries[key], scanned) {
+		return
+	}
+	if len(scanned) == 0 {
+		delete(cache.Queries, key)
+	} else {
+		cache.Queries[key] = scanned
+	}
+	if config.DryRun {
+		return
+	}
+	contents, err := json.Marshal(cache)
+	if err != nil {
+		Panicf("cacheImports: %s", err)
+	}
+	if os.MkdirAll(filepath.Dir(filename), 0o755) == nil {
+		_ = atomic.WriteFile(filename, bytes.NewReader(append(contents, '\n')))
+	}
+}
+
+// sameHashes returns whether two sets of cached imports are of the same
+// files. Since the files are identified by their contents, their
+// imports are then the same too.
+func sameHashes(a, b map[string][]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for hash := range a {
+		if _, ok := b[hash]; !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,76 @@
+package util
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/smacker/go-tree-sitter/python"
+)
+
+func TestGuessCache(t *testing.T) {
+	testDir := t.TempDir()
+	patterns := []string{"*.py"}
+	contents := []byte("import requests")
+	if err := writeFile(testDir, "main.py", contents); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFile(testDir, "gone.py", []byte("import gone")); err != nil {
+		t.Fatal(err)
+	}
+
+	// A cached file is not parsed again, so the cache decides its
+	// imports.
+	key := guessCacheKey(importsQuery, patterns)
+	cache, err := json.Marshal(guessCache{
+		Version: guessCacheVersion,
+		Queries: map[string]map[string][]string{key: {hashContents(contents): {"from_cache"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFile(path.Join(testDir, ".upm", "cache"), "guess.json", cache); err != nil {
+		t.Fatal(err)
+	}
+
+	guess := func() []string {
+		found, err := GuessWithTreeSitter(context.Background(), testDir, python.GetLanguage(), importsQuery, patterns, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(found)
+		return found
+	}
+	if found, expected := guess(), []string{"from_cache", "gone"}; !reflect.DeepEqual(found, expected) {
+		t.Errorf("expected %v, got %v", expected, found)
+	}
+
+	// A changed file is parsed again, and the files that are gone
+	// are forgotten.
+	if err := writeFile(testDir, "main.py", []byte("import flask")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(path.Join(testDir, "gone.py")); err != nil {
+		t.Fatal(err)
+	}
+	if found, expected := guess(), []string{"flask"}; !reflect.DeepEqual(found, expected) {
+		t.Errorf("expected %v, got %v", expected, found)
+	}
+
+	written, err := os.ReadFile(path.Join(testDir, GuessCacheFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actual guessCache
+	if err := json.Unmarshal(written, &actual); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]map[string][]string{key: {hashContents([]byte("import flask")): {"flask"}}}
+	if !reflect.DeepEqual(actual.Queries, expected) {
+		t.Errorf("expected cache %v, got %v", expected, actual.Queries)
+	}
+}
@@ -0,0 +1,49 @@
+package util
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// ProjectLockFile is the file that is locked while a command modifies
+// the project, relative to the project root.
+const ProjectLockFile = ".upm/lock"
+
+// errLocked is returned by tryLockFile when another process holds the
+// lock.
+var errLocked = errors.New("locked")
+
+// LockProject takes an exclusive lock on the project in the current
+// directory, so that two UPM processes cannot modify it at the same
+// time. If another process holds the lock, LockProject terminates
+// the process, or with wait, blocks until the lock is released. The
+// returned function releases the lock.
+func LockProject(wait bool) func() {
+	if err := os.MkdirAll(filepath.Dir(ProjectLockFile), 0o777); err != nil {
+		DieIO("%s: %s", filepath.Dir(ProjectLockFile), err)
+	}
+	f, err := os.OpenFile(ProjectLockFile, os.O_RDWR|os.O_CREATE, 0o666)
+	if err != nil {
+		DieIO("%s: %s", ProjectLockFile, err)
+	}
+
+	err = tryLockFile(f)
+	if errors.Is(err, errLocked) {
+		if !wait {
+			f.Close()
+			DieLocked("another upm process is modifying this project; pass --wait to wait for it")
+		}
+		ProgressMsg("waiting for another upm process to finish")
+		err = lockFile(f)
+	}
+	if err != nil {
+		f.Close()
+		DieIO("%s: %s", ProjectLockFile, err)
+	}
+
+	return func() {
+		_ = unlockFile(f)
+		f.Close()
+	}
+}
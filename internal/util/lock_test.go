@@ -0,0 +1,33 @@
+package util
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestLockProject(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Chdir(cwd) }()
+
+	unlock := LockProject(false)
+
+	err = Catch(func() {
+		LockProject(false)
+	})
+	var dieErr *Error
+	if !errors.As(err, &dieErr) || dieErr.Code != ExitLocked {
+		t.Fatalf("expected the second lock to fail, got %#v", err)
+	}
+
+	unlock()
+	if err := Catch(func() { LockProject(false)() }); err != nil {
+		t.Errorf("expected the lock to be free again, got %v", err)
+	}
+}
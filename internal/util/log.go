@@ -0,0 +1,102 @@
+package util
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/replit/upm/internal/config"
+)
+
+// logLevel is the importance of a log message. Lower levels are more
+// important.
+type logLevel int
+
+const (
+	levelError logLevel = iota
+	levelInfo
+	levelVerbose
+	levelDebug
+)
+
+// logPrefixes are used to tag messages written to the log file.
+var logPrefixes = map[logLevel]string{
+	levelError:   "ERROR",
+	levelInfo:    "INFO",
+	levelVerbose: "VERBOSE",
+	levelDebug:   "DEBUG",
+}
+
+// logFile is where --log-file messages go, or nil if it was not
+// passed.
+var logFile io.Writer
+
+// OpenLogFile appends all messages, at every level and regardless of
+// --quiet, to the named file. It is meant for IDE integrations that
+// want a full record of what UPM did.
+func OpenLogFile(filename string) error {
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o666)
+	if err != nil {
+		return err
+	}
+	logFile = f
+	return nil
+}
+
+// stderrLevel returns the least important level that is shown on
+// stderr. --debug and --verbose take precedence over --quiet, so that
+// subroutines silenced by the CLI still show up when debugging.
+func stderrLevel() logLevel {
+	switch {
+	case config.Debug:
+		return levelDebug
+	case config.Verbose:
+		return levelVerbose
+	case config.Quiet:
+		return levelError
+	default:
+		return levelInfo
+	}
+}
+
+// logMsg writes msg to stderr if the level is shown, and to the log
+// file if there is one. With --progress json, only errors go to
+// stderr, since the rest are progress events.
+func logMsg(level logLevel, msg string) {
+	if level <= stderrLevel() && (level == levelError || !config.ProgressJSON) {
+		fmt.Fprintln(os.Stderr, msg)
+	}
+	if logFile != nil {
+		for _, line := range strings.Split(msg, "\n") {
+			fmt.Fprintf(logFile, "%s %-7s %s\n",
+				time.Now().Format(time.RFC3339), logPrefixes[level], line)
+		}
+	}
+}
+
+// Verbosef is like fmt.Printf, but writes to stderr, adds a newline,
+// and is only shown with --verbose or --debug.
+func Verbosef(format string, a ...interface{}) {
+	logMsg(levelVerbose, fmt.Sprintf(format, a...))
+}
+
+// Debugf is like fmt.Printf, but writes to stderr, adds a newline, and
+// is only shown with --debug.
+func Debugf(format string, a ...interface{}) {
+	logMsg(levelDebug, fmt.Sprintf(format, a...))
+}
+
+// logCmdResult reports how long a subprocess took and how it exited,
+// for --debug.
+func logCmdResult(cmd []string, start time.Time, err error) {
+	code := 0
+	if err != nil {
+		code = -1
+		if exitErr, ok := err.(interface{ ExitCode() int }); ok {
+			code = exitErr.ExitCode()
+		}
+	}
+	Debugf("%s: exit %d after %s", quoteCmd(cmd), code, time.Since(start).Round(time.Millisecond))
+}
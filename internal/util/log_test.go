@@ -0,0 +1,65 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/replit/upm/internal/config"
+)
+
+func TestStderrLevel(t *testing.T) {
+	defer func(quiet, verbose, debug bool) {
+		config.Quiet, config.Verbose, config.Debug = quiet, verbose, debug
+	}(config.Quiet, config.Verbose, config.Debug)
+
+	testCases := []struct {
+		quiet, verbose, debug bool
+		expected              logLevel
+	}{
+		{false, false, false, levelInfo},
+		{true, false, false, levelError},
+		{false, true, false, levelVerbose},
+		{true, true, false, levelVerbose},
+		{true, false, true, levelDebug},
+	}
+
+	for _, tc := range testCases {
+		config.Quiet, config.Verbose, config.Debug = tc.quiet, tc.verbose, tc.debug
+		if actual := stderrLevel(); actual != tc.expected {
+			t.Errorf("quiet=%v verbose=%v debug=%v: expected %d, got %d",
+				tc.quiet, tc.verbose, tc.debug, tc.expected, actual)
+		}
+	}
+}
+
+func TestLogFile(t *testing.T) {
+	defer func(quiet bool) { config.Quiet = quiet }(config.Quiet)
+	defer func() { logFile = nil }()
+	config.Quiet = true
+
+	filename := filepath.Join(t.TempDir(), "upm.log")
+	if err := OpenLogFile(filename); err != nil {
+		t.Fatal(err)
+	}
+	defer logFile.(*os.File).Close()
+
+	Debugf("ran %s", "npm install")
+	ProgressMsg("npm install")
+
+	contents, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(contents)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %q", lines)
+	}
+	if !strings.HasSuffix(lines[0], "DEBUG   ran npm install") {
+		t.Errorf("unexpected debug line %q", lines[0])
+	}
+	if !strings.HasSuffix(lines[1], "INFO    --> npm install") {
+		t.Errorf("unexpected info line %q", lines[1])
+	}
+}
@@ -0,0 +1,53 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/replit/upm/internal/config"
+)
+
+// noInputEnv is set for every command UPM runs with --no-input. Git,
+// which pip and Cargo run for git dependencies, would otherwise ask
+// for credentials, and Corepack for permission to download the
+// package manager a project asks for.
+var noInputEnv = []string{
+	"GIT_TERMINAL_PROMPT=0",
+	"COREPACK_ENABLE_DOWNLOAD_PROMPT=0",
+	"DEBIAN_FRONTEND=noninteractive",
+}
+
+// noInputProgramEnv is set, in addition to noInputEnv, for the named
+// programs with --no-input. CI=true is only set for programs that do
+// not change what they install because of it; pnpm and Yarn, for
+// example, refuse to update the lockfile in CI.
+var noInputProgramEnv = map[string][]string{
+	"pip":      {"PIP_NO_INPUT=1"},
+	"python3":  {"PIP_NO_INPUT=1"},
+	"poetry":   {"POETRY_NO_INTERACTION=1", "PIP_NO_INPUT=1"},
+	"composer": {"COMPOSER_NO_INTERACTION=1"},
+	"npm":      {"npm_config_yes=true", "CI=true"},
+}
+
+// noInputArgs are inserted after the name of the program, for the
+// named programs with --no-input, where no environment variable does
+// the job.
+var noInputArgs = map[string][]string{
+	"mvn": {"--batch-mode"},
+}
+
+// nonInteractive returns cmd, with the arguments that keep it from
+// prompting for input if --no-input is in effect, and the environment
+// to run it with, or nil for UPM's own.
+func nonInteractive(cmd []string) ([]string, []string) {
+	if !config.NoInput {
+		return cmd, nil
+	}
+	program := filepath.Base(cmd[0])
+	if args, ok := noInputArgs[program]; ok {
+		cmd = append(append([]string{cmd[0]}, args...), cmd[1:]...)
+	}
+	env := append(os.Environ(), noInputEnv...)
+	env = append(env, noInputProgramEnv[program]...)
+	return cmd, env
+}
@@ -2,72 +2,85 @@ package util
 
 import (
 	"fmt"
-	"os"
-
-	"github.com/replit/upm/internal/config"
+	"strings"
 )
 
 // Log is like fmt.Println, but writes to stderr and is inhibited by
 // --quiet.
 func Log(a ...interface{}) {
-	if !config.Quiet {
-		fmt.Fprintln(os.Stderr, a...)
-	}
+	msg := strings.TrimSuffix(fmt.Sprintln(a...), "\n")
+	notifyProgress(ProgressMessage, msg)
+	logMsg(levelInfo, msg)
+}
+
+// LogError is like Log, but is shown even with --quiet. It reports an
+// error that UPM carries on after.
+func LogError(a ...interface{}) {
+	msg := strings.TrimSuffix(fmt.Sprintln(a...), "\n")
+	notifyProgress(ProgressMessage, msg)
+	logMsg(levelError, msg)
 }
 
 // ProgressMsg prints the given message to stderr with a prefix. The
 // message is inhibited in --quiet mode, however.
 func ProgressMsg(msg string) {
-	Log("-->", msg)
+	notifyProgress(ProgressStep, msg)
+	logMsg(levelInfo, "--> "+msg)
 }
 
-// Die is like fmt.Printf, but writes to stderr, adds a newline, and
-// terminates the process.
-func die(code int, format string, a ...interface{}) {
-	fmt.Fprintf(os.Stderr, format+"\n", a...)
-	os.Exit(code)
+func DieUsage(format string, a ...interface{}) {
+	die(ExitUsage, format, a...)
 }
 
 func DieIO(format string, a ...interface{}) {
-	die(10, format, a...)
+	die(ExitIO, format, a...)
 }
 
 func DieOverwrite(format string, a ...interface{}) {
-	die(11, format, a...)
+	die(ExitOverwrite, format, a...)
 }
 
 func DieNetwork(format string, a ...interface{}) {
-	die(12, format, a...)
+	die(ExitNetwork, format, a...)
 }
 
 func DieProtocol(format string, a ...interface{}) {
-	die(13, format, a...)
+	die(ExitProtocol, format, a...)
 }
 
 func DieConsistency(format string, a ...interface{}) {
-	die(14, format, a...)
+	die(ExitConsistency, format, a...)
 }
 
 func DieInitializationError(format string, a ...interface{}) {
-	die(15, format, a...)
+	die(ExitInitializationError, format, a...)
 }
 
 func DieSubprocess(format string, a ...interface{}) {
-	die(16, format, a...)
+	die(ExitSubprocess, format, a...)
 }
 
 func DieUnimplemented(format string, a ...interface{}) {
-	die(17, format, a...)
+	die(ExitUnimplemented, format, a...)
+}
+
+func DieConflict(format string, a ...interface{}) {
+	die(ExitConflict, format, a...)
+}
+
+func DieStaleLockfile(format string, a ...interface{}) {
+	die(ExitStaleLockfile, format, a...)
+}
+
+func DieMissingTool(format string, a ...interface{}) {
+	die(ExitMissingTool, format, a...)
+}
+
+func DieLocked(format string, a ...interface{}) {
+	die(ExitLocked, format, a...)
 }
 
 // Panicf is a composition of fmt.Sprintf and panic.
 func Panicf(format string, a ...interface{}) {
 	panic(fmt.Sprintf(format, a...))
 }
-
-// NotImplemented terminates the process, indicating that the
-// operation is not implemented. This should be used in language
-// backends that do not implement all of UPM's API.
-func NotImplemented() {
-	DieUnimplemented("not yet implemented")
-}
@@ -0,0 +1,140 @@
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/replit/upm/internal/config"
+)
+
+// cmdOutput is where the output of a command UPM runs goes, a line at
+// a time. Each line is shown on stderr with the name of the program as
+// a prefix, written to the run log and reported as progress. With
+// --quiet, the lines are held back instead, and only shown if the
+// command fails; with --progress json, they are only reported as
+// progress. Stdout and stderr may write to it at once.
+type cmdOutput struct {
+	mu     sync.Mutex
+	prefix string
+	buf    []byte
+
+	// stderr is where the lines are shown.
+	stderr io.Writer
+
+	// hidden is true if the lines are not shown as they come, and
+	// held are the lines that are shown if the command fails.
+	hidden bool
+	held   []string
+}
+
+// newCmdOutput returns the output of cmd, which is about to be run.
+func newCmdOutput(cmd []string) *cmdOutput {
+	writeRunLog("$ " + quoteCmd(cmd))
+	return &cmdOutput{
+		prefix: "[" + filepath.Base(cmd[0]) + "] ",
+		stderr: os.Stderr,
+		hidden: config.ProgressJSON || stderrLevel() < levelInfo,
+	}
+}
+
+// prefixed returns line with the prefix, without trailing space if
+// the line is empty.
+func (o *cmdOutput) prefixed(line string) string {
+	return strings.TrimRight(o.prefix+line, " ")
+}
+
+// line handles one line of output, without its newline.
+func (o *cmdOutput) line(line string) {
+	if strings.TrimSpace(line) != "" {
+		notifyProgress(ProgressOutput, line)
+	}
+	writeRunLog(o.prefixed(line))
+	switch {
+	case config.ProgressJSON:
+	case o.hidden:
+		o.held = append(o.held, line)
+	default:
+		fmt.Fprintln(o.stderr, o.prefixed(line))
+	}
+}
+
+func (o *cmdOutput) Write(b []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.buf = append(o.buf, b...)
+	for {
+		idx := bytes.IndexByte(o.buf, '\n')
+		if idx < 0 {
+			break
+		}
+		o.line(strings.TrimSuffix(string(o.buf[:idx]), "\r"))
+		o.buf = o.buf[idx+1:]
+	}
+	return len(b), nil
+}
+
+// finish handles the last line of output, if it did not end with a
+// newline, and shows the lines that were held back if replay is set,
+// because the command failed.
+func (o *cmdOutput) finish(replay bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if len(o.buf) > 0 {
+		o.line(string(o.buf))
+		o.buf = nil
+	}
+	if replay {
+		for _, line := range o.held {
+			fmt.Fprintln(o.stderr, o.prefixed(line))
+		}
+	}
+	o.held = nil
+}
+
+var (
+	runLogMu sync.Mutex
+
+	// runLogPath is where the run log goes, or "" if there is
+	// none.
+	runLogPath string
+
+	// runLog is the open run log, or nil if no command has been
+	// run yet or the run log could not be created.
+	runLog *os.File
+)
+
+// SetRunLog makes the output of every command UPM runs go to the file
+// at path, so that the output of the last upm command can be read
+// even if it was not shown. The file is replaced when the first
+// command runs.
+func SetRunLog(path string) {
+	runLogMu.Lock()
+	defer runLogMu.Unlock()
+	runLogPath = path
+}
+
+// writeRunLog writes a line to the run log, if there is one.
+func writeRunLog(line string) {
+	runLogMu.Lock()
+	defer runLogMu.Unlock()
+	if runLogPath == "" {
+		return
+	}
+	if runLog == nil {
+		var err error
+		if err = os.MkdirAll(filepath.Dir(runLogPath), 0o755); err == nil {
+			runLog, err = os.Create(runLogPath)
+		}
+		if err != nil {
+			Debugf("not keeping the run log: %s", err)
+			runLogPath = ""
+			return
+		}
+	}
+	fmt.Fprintln(runLog, line)
+}
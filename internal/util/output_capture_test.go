@@ -0,0 +1,69 @@
+package util
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/replit/upm/internal/config"
+)
+
+func TestCmdOutput(t *testing.T) {
+	defer func(quiet bool) { config.Quiet = quiet }(config.Quiet)
+
+	var stderr bytes.Buffer
+	config.Quiet = false
+	o := newCmdOutput([]string{"/usr/bin/npm", "install"})
+	o.stderr = &stderr
+	_, _ = o.Write([]byte("added 1 package\nfound 0 vulnerabilities"))
+	o.finish(false)
+	expected := "[npm] added 1 package\n[npm] found 0 vulnerabilities\n"
+	if stderr.String() != expected {
+		t.Errorf("expected %q, got %q", expected, stderr.String())
+	}
+
+	stderr.Reset()
+	config.Quiet = true
+	o = newCmdOutput([]string{"pip", "install", "flask"})
+	o.stderr = &stderr
+	_, _ = o.Write([]byte("Collecting flask\n"))
+	o.finish(false)
+	if stderr.Len() != 0 {
+		t.Errorf("expected nothing to be shown with --quiet, got %q", stderr.String())
+	}
+
+	o = newCmdOutput([]string{"pip", "install", "flask"})
+	o.stderr = &stderr
+	_, _ = o.Write([]byte("ERROR: No matching distribution found for flask\n"))
+	o.finish(true)
+	expected = "[pip] ERROR: No matching distribution found for flask\n"
+	if stderr.String() != expected {
+		t.Errorf("expected the output to be replayed on failure, got %q", stderr.String())
+	}
+}
+
+func TestRunLog(t *testing.T) {
+	defer func(quiet bool) { config.Quiet = quiet }(config.Quiet)
+	config.Quiet = true
+	path := filepath.Join(t.TempDir(), "logs", "last.log")
+	SetRunLog(path)
+	defer func() {
+		SetRunLog("")
+		runLog.Close()
+		runLog = nil
+	}()
+
+	o := newCmdOutput([]string{"npm", "ci"})
+	_, _ = o.Write([]byte("up to date\n"))
+	o.finish(false)
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "$ npm ci\n[npm] up to date\n"
+	if string(contents) != expected {
+		t.Errorf("expected %q, got %q", expected, contents)
+	}
+}
@@ -0,0 +1,53 @@
+package util
+
+import (
+	"sync"
+)
+
+// ProgressKind classifies a progress event.
+type ProgressKind string
+
+const (
+	// ProgressStep is a step UPM takes, such as running a command
+	// or writing a file, as shown with a "-->" prefix.
+	ProgressStep ProgressKind = "step"
+
+	// ProgressOutput is a line of output from a command UPM is
+	// running.
+	ProgressOutput ProgressKind = "output"
+
+	// ProgressMessage is any other message UPM logs.
+	ProgressMessage ProgressKind = "message"
+)
+
+var (
+	progressMu sync.Mutex
+
+	// progressFunc receives the progress events, or is nil.
+	progressFunc func(kind ProgressKind, msg string)
+)
+
+// OnProgress makes fn receive the progress events of UPM, such as the
+// commands it runs and their output, as they happen, until the
+// returned function is called. The events are sent regardless of
+// --quiet. fn may be called from several goroutines at once.
+func OnProgress(fn func(kind ProgressKind, msg string)) func() {
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	progressFunc = fn
+	return func() {
+		progressMu.Lock()
+		defer progressMu.Unlock()
+		progressFunc = nil
+	}
+}
+
+// notifyProgress sends a progress event, if anyone is listening.
+func notifyProgress(kind ProgressKind, msg string) {
+	progressMu.Lock()
+	fn := progressFunc
+	progressMu.Unlock()
+	if fn != nil {
+		fn(kind, msg)
+	}
+}
@@ -0,0 +1,43 @@
+package util
+
+import (
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/replit/upm/internal/config"
+)
+
+func TestOnProgress(t *testing.T) {
+	defer func(quiet bool) { config.Quiet = quiet }(config.Quiet)
+	config.Quiet = true
+
+	type event struct {
+		kind ProgressKind
+		msg  string
+	}
+	events := []event{}
+	stop := OnProgress(func(kind ProgressKind, msg string) {
+		events = append(events, event{kind, msg})
+	})
+
+	ProgressMsg("write Cask")
+	Log("no search results")
+	o := &cmdOutput{stderr: io.Discard}
+	_, _ = o.Write([]byte("added 1 package\r\n\nfound 0 vuln"))
+	_, _ = o.Write([]byte("erabilities\ndone"))
+	o.finish(false)
+	stop()
+	Log("not sent")
+
+	expected := []event{
+		{ProgressStep, "write Cask"},
+		{ProgressMessage, "no search results"},
+		{ProgressOutput, "added 1 package"},
+		{ProgressOutput, "found 0 vulnerabilities"},
+		{ProgressOutput, "done"},
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("expected %v, got %v", expected, events)
+	}
+}
@@ -0,0 +1,85 @@
+package util
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// proxyEnvVars lists the environment variables which are set by
+// SetProxy. Both spellings are set, because different package
+// managers disagree on which one they read.
+var proxyEnvVars = []string{
+	"HTTP_PROXY",
+	"HTTPS_PROXY",
+	"http_proxy",
+	"https_proxy",
+}
+
+// proxySchemes lists the URL schemes accepted by ParseProxy.
+var proxySchemes = map[string]bool{
+	"http":   true,
+	"https":  true,
+	"socks5": true,
+}
+
+// HTTPTransport is a copy of http.DefaultTransport that uses
+// ProxyFromEnvironment to pick a proxy. It is shared by all of UPM's
+// HTTP clients so that connections are pooled.
+var HTTPTransport = newHTTPTransport()
+
+// httpClient is the client used by DownloadFile.
+var httpClient = &http.Client{Transport: HTTPTransport}
+
+// ParseProxy parses the value of --proxy. The proxy must be an
+// absolute URL with an http, https, or socks5 scheme and a host, e.g.
+// "http://proxy.example.com:3128".
+func ParseProxy(proxy string) (*url.URL, error) {
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, err
+	}
+	if !proxySchemes[u.Scheme] || u.Host == "" {
+		return nil, fmt.Errorf("expected a URL like http://host:port")
+	}
+	return u, nil
+}
+
+// SetProxy overrides the HTTP(S) proxy used by UPM. The proxy is
+// exported through the standard environment variables, so that it
+// applies both to UPM's own registry clients and to every subprocess
+// that UPM runs. NO_PROXY is left alone. If the proxy is rejected by
+// ParseProxy, SetProxy terminates the process.
+func SetProxy(proxy string) {
+	if proxy == "" {
+		return
+	}
+	if _, err := ParseProxy(proxy); err != nil {
+		DieInitializationError("invalid --proxy %#v: %s", proxy, err)
+	}
+	for _, name := range proxyEnvVars {
+		if err := os.Setenv(name, proxy); err != nil {
+			DieInitializationError("%s: %s", name, err)
+		}
+	}
+}
+
+// ProxyFromEnvironment returns the proxy to use for req according to
+// HTTP_PROXY, HTTPS_PROXY and NO_PROXY (or their lowercase variants).
+// Unlike http.ProxyFromEnvironment, it does not cache the environment
+// after the first call, so it also respects proxies set by SetProxy
+// after a request has already been made.
+func ProxyFromEnvironment(req *http.Request) (*url.URL, error) {
+	return httpproxy.FromEnvironment().ProxyFunc()(req.URL)
+}
+
+// newHTTPTransport returns a copy of http.DefaultTransport that uses
+// ProxyFromEnvironment to pick a proxy.
+func newHTTPTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = ProxyFromEnvironment
+	return transport
+}
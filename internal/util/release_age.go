@@ -0,0 +1,30 @@
+package util
+
+import (
+	"os"
+
+	"github.com/replit/upm/internal/config"
+)
+
+// releaseAgeEnv maps the programs that can leave out versions published
+// after a date to the environment variable that sets that date, so
+// that min_release_age also holds for the dependencies they resolve,
+// which UPM does not see.
+var releaseAgeEnv = map[string]string{
+	"npm": "npm_config_before",
+	"uv":  "UV_EXCLUDE_NEWER",
+}
+
+// withReleaseCutoff returns env, or UPM's own environment if it is nil,
+// with the cutoff of min_release_age for program, if it has one and
+// min_release_age is set.
+func withReleaseCutoff(program string, env []string) []string {
+	name, ok := releaseAgeEnv[program]
+	if !ok || config.MinReleaseAge <= 0 {
+		return env
+	}
+	if env == nil {
+		env = os.Environ()
+	}
+	return append(env, name+"="+config.ReleaseCutoff().UTC().Format("2006-01-02T15:04:05Z"))
+}
@@ -0,0 +1,81 @@
+package util
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/replit/upm/internal/config"
+)
+
+// sandboxEnv are the environment variables that sandboxed scripts get
+// from the environment of UPM: enough to find programs, pick a locale
+// and reach the network, but not the tokens and configuration of the
+// user.
+var sandboxEnv = []string{
+	"PATH", "LANG", "LC_ALL", "LC_CTYPE", "TZ", "TMPDIR", "SYSTEMROOT",
+	"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY", "ALL_PROXY",
+	"http_proxy", "https_proxy", "no_proxy", "all_proxy",
+	"SSL_CERT_FILE", "SSL_CERT_DIR", "NIX_SSL_CERT_FILE",
+}
+
+// ScriptsDisabled returns true if backends must not run scripts to
+// query registries or the environment, because disable_scripts is set
+// in the [sandbox] table of a configuration file.
+func ScriptsDisabled() bool {
+	return config.Loaded.Sandbox.DisableScripts
+}
+
+// scrubEnv returns the variables of env that are in sandboxEnv or
+// keep, with HOME set to home unless it is kept.
+func scrubEnv(env []string, home string, keep []string) []string {
+	allowed := map[string]bool{}
+	for _, name := range append(sandboxEnv, keep...) {
+		allowed[name] = true
+	}
+	scrubbed := []string{}
+	for _, kv := range env {
+		name, _, _ := strings.Cut(kv, "=")
+		if allowed[name] {
+			scrubbed = append(scrubbed, kv)
+		}
+	}
+	if !allowed["HOME"] {
+		scrubbed = append(scrubbed, "HOME="+home)
+	}
+	return scrubbed
+}
+
+// GetSandboxedCmdOutputFallible is like GetCmdOutputFallible, but runs
+// cmd isolated from the project and the user, for the scripts backends
+// run to query registries or the environment: in an empty temporary
+// directory, which is also its HOME, so that files in the project
+// cannot shadow what the script imports, and with only the environment
+// variables in sandboxEnv and keepEnv. A script that does not need the
+// network is also cut off from it if isolate_network is set (see
+// isolateNetwork).
+func GetSandboxedCmdOutputFallible(cmd []string, network bool, keepEnv ...string) ([]byte, error) {
+	dir := TempDir()
+	defer os.RemoveAll(dir)
+	return getCmdOutput(cmd, func(command *exec.Cmd) {
+		env := command.Env
+		if env == nil {
+			env = os.Environ()
+		}
+		command.Dir = dir
+		command.Env = scrubEnv(env, dir, keepEnv)
+		if !network && config.Loaded.Sandbox.IsolateNetwork {
+			isolateNetwork(command)
+		}
+	})
+}
+
+// GetSandboxedCmdOutput is like GetSandboxedCmdOutputFallible, but
+// exits the process on error or command failure, like GetCmdOutput.
+func GetSandboxedCmdOutput(cmd []string, network bool, keepEnv ...string) []byte {
+	output, err := GetSandboxedCmdOutputFallible(cmd, network, keepEnv...)
+	if err != nil {
+		dieCmd(cmd, err)
+	}
+	return output
+}
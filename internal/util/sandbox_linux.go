@@ -0,0 +1,18 @@
+package util
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// isolateNetwork makes command run in new user and network namespaces,
+// where it only has a loopback interface. It keeps its user and group
+// IDs, so that the files it writes belong to the user as usual.
+func isolateNetwork(command *exec.Cmd) {
+	command.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags:  syscall.CLONE_NEWUSER | syscall.CLONE_NEWNET,
+		UidMappings: []syscall.SysProcIDMap{{ContainerID: os.Getuid(), HostID: os.Getuid(), Size: 1}},
+		GidMappings: []syscall.SysProcIDMap{{ContainerID: os.Getgid(), HostID: os.Getgid(), Size: 1}},
+	}
+}
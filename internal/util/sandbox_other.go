@@ -0,0 +1,11 @@
+//go:build !linux
+
+package util
+
+import "os/exec"
+
+// isolateNetwork does nothing outside of Linux, which has no network
+// namespaces.
+func isolateNetwork(command *exec.Cmd) {
+	Debugf("isolate_network is only supported on Linux")
+}
@@ -0,0 +1,75 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/replit/upm/internal/config"
+)
+
+func TestScrubEnv(t *testing.T) {
+	env := []string{"PATH=/bin", "HOME=/home/me", "NPM_TOKEN=secret", "PYTHONUSERBASE=/base", "https_proxy=http://proxy"}
+	expected := []string{"PATH=/bin", "https_proxy=http://proxy", "HOME=/sandbox"}
+	if got := scrubEnv(env, "/sandbox", nil); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	expected = []string{"PATH=/bin", "HOME=/home/me", "PYTHONUSERBASE=/base", "https_proxy=http://proxy"}
+	if got := scrubEnv(env, "/sandbox", []string{"HOME", "PYTHONUSERBASE"}); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestSandboxedCmdOutput(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+	project := t.TempDir()
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	if err := os.Chdir(project); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(project, "site.py"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("UPM_TEST_SECRET", "secret")
+
+	output, err := GetSandboxedCmdOutputFallible([]string{
+		"sh", "-c", `pwd; echo "$HOME"; echo "${UPM_TEST_SECRET-unset}"; ls`,
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	if len(lines) != 3 || lines[0] != lines[1] || lines[2] != "unset" {
+		t.Errorf("expected an empty sandbox as the working directory and home, without the environment, got %q", output)
+	}
+	if lines[0] == project {
+		t.Errorf("expected the script not to run in the project")
+	}
+	if _, err := os.Stat(lines[0]); !os.IsNotExist(err) {
+		t.Errorf("expected the sandbox to be removed, got %v", err)
+	}
+}
+
+func TestIsolateNetwork(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("network namespaces are Linux-only")
+	}
+	defer func(sandbox config.SandboxConfig) { config.Loaded.Sandbox = sandbox }(config.Loaded.Sandbox)
+	config.Loaded.Sandbox.IsolateNetwork = true
+
+	output, err := GetSandboxedCmdOutputFallible([]string{"cat", "/proc/net/dev"}, false)
+	if err != nil {
+		t.Skipf("no unprivileged user namespaces: %v", err)
+	}
+	// Two header lines, then one per interface.
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(strings.TrimSpace(lines[2]), "lo:") {
+		t.Errorf("expected only a loopback interface, got %q", output)
+	}
+}
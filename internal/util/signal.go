@@ -0,0 +1,147 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+var (
+	// procsMu guards the variables below.
+	procsMu sync.Mutex
+
+	// procs are the subprocesses that are currently running.
+	procs = map[*exec.Cmd]bool{}
+
+	// interrupted is the first signal received by HandleSignals,
+	// or nil.
+	interrupted os.Signal
+
+	// interruptHooks are run, in no particular order, when UPM has
+	// to exit on a signal without unwinding.
+	interruptHooks = map[int]func(){}
+	nextHookID     int
+)
+
+// HandleSignals makes SIGINT and SIGTERM stop UPM cleanly. The first
+// signal is forwarded to the running subprocesses; once they exit, the
+// command that ran them fails with an *Error and unwinds as usual, so
+// deferred cleanup such as rolling back the specfile happens. If no
+// subprocess is running, or a second signal arrives, the subprocesses
+// are killed, the OnInterrupt hooks are run and UPM exits at once.
+//
+// HandleSignals is only for the upm binary; library callers handle
+// signals themselves.
+func HandleSignals() {
+	ch := make(chan os.Signal, 2)
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		for sig := range ch {
+			procsMu.Lock()
+			first := interrupted == nil
+			if first {
+				interrupted = sig
+			}
+			running := []*os.Process{}
+			for command := range procs {
+				running = append(running, command.Process)
+			}
+			hooks := []func(){}
+			for _, hook := range interruptHooks {
+				hooks = append(hooks, hook)
+			}
+			procsMu.Unlock()
+
+			if first && len(running) > 0 {
+				Debugf("forwarding %s to %d subprocesses", sig, len(running))
+				for _, proc := range running {
+					_ = proc.Signal(sig)
+				}
+				continue
+			}
+
+			for _, proc := range running {
+				_ = proc.Kill()
+			}
+			for _, hook := range hooks {
+				hook()
+			}
+			err := interruptError()
+			logMsg(levelError, err.Msg)
+			os.Exit(int(err.Code))
+		}
+	}()
+}
+
+// OnInterrupt registers fn to be run if UPM has to exit on a signal
+// without unwinding; see HandleSignals. The returned function
+// unregisters it.
+func OnInterrupt(fn func()) func() {
+	procsMu.Lock()
+	defer procsMu.Unlock()
+	id := nextHookID
+	nextHookID++
+	interruptHooks[id] = fn
+	return func() {
+		procsMu.Lock()
+		defer procsMu.Unlock()
+		delete(interruptHooks, id)
+	}
+}
+
+// interruptError returns the error that UPM fails with after a
+// signal, or nil if there was none. By convention, the exit code is
+// 128 plus the signal number.
+func interruptError() *Error {
+	procsMu.Lock()
+	defer procsMu.Unlock()
+	if interrupted == nil {
+		return nil
+	}
+	code := 130
+	if sig, ok := interrupted.(syscall.Signal); ok {
+		code = 128 + int(sig)
+	}
+	return &Error{Code: ExitCode(code), Msg: fmt.Sprintf("interrupted by %s", interrupted)}
+}
+
+// Interrupted returns true if UPM got a signal, after which it should
+// not start anything new.
+func Interrupted() bool {
+	return interruptError() != nil
+}
+
+// dieIfInterrupted unwinds with the interrupt error if UPM got a
+// signal.
+func dieIfInterrupted() {
+	if err := interruptError(); err != nil {
+		panic(err)
+	}
+}
+
+// runTracked is like command.Run, but records the subprocess so that
+// signals can be forwarded to it. It refuses to start anything once
+// UPM has been interrupted.
+func runTracked(command *exec.Cmd) error {
+	procsMu.Lock()
+	if interrupted != nil {
+		procsMu.Unlock()
+		dieIfInterrupted()
+	}
+	if err := command.Start(); err != nil {
+		procsMu.Unlock()
+		return err
+	}
+	procs[command] = true
+	procsMu.Unlock()
+
+	err := command.Wait()
+
+	procsMu.Lock()
+	delete(procs, command)
+	procsMu.Unlock()
+	return err
+}
@@ -0,0 +1,65 @@
+//go:build unix
+
+package util
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/replit/upm/internal/config"
+)
+
+func TestSignalForwarding(t *testing.T) {
+	defer func(quiet bool) { config.Quiet = quiet }(config.Quiet)
+	config.Quiet = true
+	defer func() {
+		signal.Reset(os.Interrupt, syscall.SIGTERM)
+		procsMu.Lock()
+		interrupted = nil
+		procsMu.Unlock()
+	}()
+	HandleSignals()
+
+	done := make(chan error)
+	go func() {
+		done <- Catch(func() {
+			RunCmd([]string{"sleep", "10"})
+		})
+	}()
+
+	// Wait for the subprocess to start before signalling.
+	for {
+		procsMu.Lock()
+		running := len(procs)
+		procsMu.Unlock()
+		if running > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-done:
+		var dieErr *Error
+		if !errors.As(err, &dieErr) || dieErr.Code != 128+ExitCode(syscall.SIGTERM) {
+			t.Errorf("expected an interrupt error, got %#v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("subprocess was not stopped")
+	}
+
+	// Nothing new is started after an interrupt.
+	err := Catch(func() {
+		RunCmd([]string{"true"})
+	})
+	if err == nil {
+		t.Error("expected commands to be refused after an interrupt")
+	}
+}
@@ -4,11 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"io/fs"
 	"os"
 	"path"
 	"regexp"
-	"strings"
 
 	sitter "github.com/smacker/go-tree-sitter"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
@@ -34,54 +32,14 @@ const (
 // not in ignoreGlobPatterns, it will parse the file using lang and queryImports.
 // When there's a capture tagged as `@import`, it reports the capture as an import.
 // If there's a capture tagged as `@pragma` that's on the same line as an import,
-// it will include the pragma in the results.
+// it will include the pragma in the results. The imports of each file
+// are cached in GuessCacheFile under root by the hash of its contents,
+// so that only the files that changed are parsed again.
 func GuessWithTreeSitter(ctx context.Context, root string, lang *sitter.Language, queryImports string, pathSegmentPatterns []string, ignorePathSegments map[string]bool) ([]string, error) {
 	//nolint:ineffassign,wastedassign,staticcheck
 	span, ctx := tracer.StartSpanFromContext(ctx, "GuessWithTreeSitter")
 	defer span.Finish()
-	dirFS := os.DirFS(root)
-
-	forceRecurse := os.Getenv("UPM_FORCE_RECURSE") == "1"
-	var visited int = 0
-	pathsToSearch := []string{}
-	err := fs.WalkDir(dirFS, ".", func(curpath string, d fs.DirEntry, err error) error {
-		// Reproduce the previous behavior of https://github.com/replit/upm/pull/202
-		// During integration tests it was determined that we do need to consider a whole
-		// host of ignore patterns, otherwise we run the risk of guessing transitive deps
-		// from the package store.
-		isDir := curpath != "." && d.IsDir()
-		isInDir := strings.Contains(curpath, "/")
-		if !forceRecurse && (isDir || isInDir) {
-			return fs.SkipDir
-		}
-		curpath = path.Join(root, curpath)
-		if err != nil {
-			return err
-		}
-
-		visited += 1
-
-		// Avoid locking up UPM on pathological project configurations
-		if visited > MaximumVisits {
-			return fs.SkipAll
-		}
-
-		if ignorePathSegments[d.Name()] {
-			return fs.SkipDir
-		}
-
-		for _, pattern := range pathSegmentPatterns {
-			var ok bool
-			if ok, err = path.Match(pattern, d.Name()); ok {
-				pathsToSearch = append(pathsToSearch, curpath)
-			}
-			if err != nil {
-				return err
-			}
-		}
-
-		return nil
-	})
+	pathsToSearch, err := FindSourceFiles(root, pathSegmentPatterns, ignorePathSegments)
 	if err != nil {
 		return nil, err
 	}
@@ -91,15 +49,20 @@ func GuessWithTreeSitter(ctx context.Context, root string, lang *sitter.Language
 		return nil, err
 	}
 
-	results := make(chan queryImportsResult)
+	cacheFile := path.Join(root, GuessCacheFile)
+	cacheKey := guessCacheKey(queryImports, pathSegmentPatterns)
+	cached := cachedImports(cacheFile, cacheKey)
+
+	results := make(chan fileImports)
 	for _, filePath := range pathsToSearch {
 		filePath2 := filePath
 		go func() {
-			results <- queryFile(lang, query, filePath2)
+			results <- queryFile(lang, query, filePath2, cached)
 		}()
 	}
 
 	imports := []string{}
+	scanned := map[string][]string{}
 	failed := false
 	for numParsedFiles := 0; numParsedFiles < len(pathsToSearch); numParsedFiles++ {
 		result := <-results
@@ -107,16 +70,13 @@ func GuessWithTreeSitter(ctx context.Context, root string, lang *sitter.Language
 		if result.err != nil {
 			fmt.Printf("error parsing file %s: %v\n", result.path, result.err)
 			failed = true
+		} else {
+			scanned[result.hash] = result.imports
 		}
 
-		for importPath, pragma := range result.imports {
-			if pragma.Package != "" {
-				imports = append(imports, pragma.Package)
-			} else {
-				imports = append(imports, importPath)
-			}
-		}
+		imports = append(imports, result.imports...)
 	}
+	cacheImports(cacheFile, cacheKey, scanned)
 
 	if failed {
 		err = errors.New("failed to parse some files")
@@ -125,13 +85,78 @@ func GuessWithTreeSitter(ctx context.Context, root string, lang *sitter.Language
 	return imports, err
 }
 
-func queryFile(lang *sitter.Language, query *sitter.Query, file string) queryImportsResult {
-	qc := sitter.NewQueryCursor()
+// GuessSourceWithTreeSitter is like GuessWithTreeSitter, but for
+// source code that is not in a file of its own, such as the cells of a
+// notebook; name is where it is from, for errors.
+func GuessSourceWithTreeSitter(lang *sitter.Language, queryImports string, name string, contents []byte) ([]string, error) {
+	query, err := sitter.NewQuery([]byte(queryImports), lang)
+	if err != nil {
+		return nil, err
+	}
+	result := queryContents(lang, query, name, contents)
+	return result.importList(), result.err
+}
+
+// FindSourceFiles returns the files in root whose names match one of
+// pathSegmentPatterns, skipping those in ignorePathSegments and those
+// that .gitignore files or the guess.ignore_paths setting ignore. Only
+// the top level of root is searched unless UPM_FORCE_RECURSE is set.
+func FindSourceFiles(root string, pathSegmentPatterns []string, ignorePathSegments map[string]bool) ([]string, error) {
+	// Reproduce the previous behavior of https://github.com/replit/upm/pull/202
+	// During integration tests it was determined that we do need to consider a whole
+	// host of ignore patterns, otherwise we run the risk of guessing transitive deps
+	// from the package store.
+	forceRecurse := os.Getenv("UPM_FORCE_RECURSE") == "1"
+	pathsToSearch, err := walkSourceFiles(root, pathSegmentPatterns, ignorePathSegments, forceRecurse, MaximumVisits)
+	if err != nil {
+		return nil, err
+	}
+	for i, rel := range pathsToSearch {
+		pathsToSearch[i] = path.Join(root, rel)
+	}
+	return pathsToSearch, nil
+}
+
+// importList returns the imports of a result, with the packages that
+// pragmas name in place of the imports they are on.
+func (result queryImportsResult) importList() []string {
+	imports := []string{}
+	for importPath, pragma := range result.imports {
+		if pragma.Package != "" {
+			imports = append(imports, pragma.Package)
+		} else {
+			imports = append(imports, importPath)
+		}
+	}
+	return imports
+}
+
+// fileImports are the imports of a source file, and the hash of its
+// contents that they are cached by.
+type fileImports struct {
+	path    string
+	hash    string
+	imports []string
+	err     error
+}
 
+// queryFile returns the imports of file, taking them from cached if
+// the file has not changed since they were found.
+func queryFile(lang *sitter.Language, query *sitter.Query, file string, cached map[string][]string) fileImports {
 	contents, err := os.ReadFile(file)
 	if err != nil {
-		return queryImportsResult{file, nil, err}
+		return fileImports{path: file, err: err}
+	}
+	hash := hashContents(contents)
+	if imports, ok := cached[hash]; ok {
+		return fileImports{file, hash, imports, nil}
 	}
+	result := queryContents(lang, query, file, contents)
+	return fileImports{file, hash, result.importList(), result.err}
+}
+
+func queryContents(lang *sitter.Language, query *sitter.Query, file string, contents []byte) queryImportsResult {
+	qc := sitter.NewQueryCursor()
 
 	node, err := sitter.ParseCtx(context.Background(), contents, lang)
 	if err != nil {
@@ -0,0 +1,158 @@
+package util
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/replit/upm/internal/config"
+)
+
+// defaultIgnoreRules are the directories that the source scanners skip
+// unless a .gitignore file or guess.ignore_paths includes them again,
+// as with "!dist/": they hold version control data, installed
+// packages or build output rather than the project's own code.
+var defaultIgnoreRules = parseIgnoreRules("", strings.Join([]string{
+	".git/",
+	".hg/",
+	".svn/",
+	"node_modules/",
+	".venv/",
+	"venv/",
+	"dist/",
+}, "\n"))
+
+// walkConcurrency is the number of directories that a walk reads at
+// once.
+var walkConcurrency = 4 * runtime.NumCPU()
+
+// walker finds the source files under a directory, reading its
+// subdirectories concurrently.
+type walker struct {
+	root      string
+	patterns  []string
+	skip      map[string]bool
+	recurse   bool
+	maxVisits int64
+
+	sem     chan struct{}
+	wg      sync.WaitGroup
+	visited int64
+
+	mu    sync.Mutex
+	files []string
+	err   error
+}
+
+// walkSourceFiles returns the slash-separated paths, relative to root,
+// of the files under root whose names match one of patterns, in
+// lexical order. Entries named in skip are skipped, and so are the
+// paths that defaultIgnoreRules, the .gitignore files of root and its
+// subdirectories, .git/info/exclude and the guess.ignore_paths setting
+// ignore, with the same precedence as in git and the setting last.
+// Unless recurse is set, only the top level of root is searched. If
+// maxVisits is positive, the walk stops after visiting that many
+// entries.
+func walkSourceFiles(root string, patterns []string, skip map[string]bool, recurse bool, maxVisits int) ([]string, error) {
+	rules := ignoreRules(defaultIgnoreRules)
+	if contents, err := os.ReadFile(path.Join(root, ".git", "info", "exclude")); err == nil {
+		rules = rules.with(parseIgnoreRules("", string(contents)))
+	}
+	rules = rules.with(readIgnoreRules(root, "."))
+	rules = rules.with(parseIgnoreRules("", strings.Join(config.Loaded.Guess.IgnorePaths, "\n")))
+
+	w := &walker{
+		root:      root,
+		patterns:  patterns,
+		skip:      skip,
+		recurse:   recurse,
+		maxVisits: int64(maxVisits),
+		sem:       make(chan struct{}, walkConcurrency),
+		files:     []string{},
+	}
+	w.wg.Add(1)
+	go w.walkDir(".", rules)
+	w.wg.Wait()
+	if w.err != nil {
+		return nil, w.err
+	}
+	sort.Strings(w.files)
+	return w.files, nil
+}
+
+// walkDir searches the directory rel under the root, in which rules
+// apply along with those of its own .gitignore file, and starts
+// searching its subdirectories.
+func (w *walker) walkDir(rel string, rules ignoreRules) {
+	defer w.wg.Done()
+
+	w.sem <- struct{}{}
+	entries, err := os.ReadDir(path.Join(w.root, rel))
+	if err == nil && rel != "." {
+		rules = rules.with(readIgnoreRules(w.root, rel))
+	}
+	<-w.sem
+	if err != nil {
+		w.fail(err)
+		return
+	}
+
+	for _, entry := range entries {
+		// Avoid locking up UPM on pathological project
+		// configurations.
+		if w.maxVisits > 0 && atomic.AddInt64(&w.visited, 1) > w.maxVisits {
+			return
+		}
+
+		name := entry.Name()
+		if w.skip[name] {
+			continue
+		}
+		entryRel := path.Join(rel, name)
+		isDir := entry.IsDir()
+		if entry.Type()&fs.ModeSymlink != 0 {
+			// Symlinked directories are not followed.
+			if info, err := os.Stat(path.Join(w.root, entryRel)); err == nil && info.IsDir() {
+				continue
+			}
+		}
+		if rules.ignores(entryRel, isDir) {
+			continue
+		}
+
+		if isDir {
+			if w.recurse {
+				w.wg.Add(1)
+				go w.walkDir(entryRel, rules)
+			}
+			continue
+		}
+		for _, pattern := range w.patterns {
+			ok, err := path.Match(pattern, name)
+			if err != nil {
+				w.fail(err)
+				return
+			}
+			if ok {
+				w.mu.Lock()
+				w.files = append(w.files, entryRel)
+				w.mu.Unlock()
+				break
+			}
+		}
+	}
+}
+
+// fail records the first error of the walk.
+func (w *walker) fail(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err == nil {
+		w.err = err
+	}
+}
@@ -0,0 +1,52 @@
+package util
+
+import (
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/replit/upm/internal/config"
+)
+
+func TestWalkSourceFiles(t *testing.T) {
+	testDir := t.TempDir()
+	for dir, files := range map[string]map[string]string{
+		"":                       {"main.py": "", "README.md": "", ".gitignore": "build/\n*_pb2.py\n"},
+		"src/app":                {"views.py": "", "models_pb2.py": "", "local.py": "", "keep_pb2.py": "", ".gitignore": "/local.py\n!keep_pb2.py\n"},
+		"build/lib":              {"built.py": ""},
+		"node_modules/pkg":       {"index.py": ""},
+		".venv/lib":              {"site.py": ""},
+		"dist":                   {"bundle.py": ""},
+		"gen":                    {"gen.py": ""},
+		"__pycache__":            {"cached.py": ""},
+		"src/app/node_modules/x": {"nested.py": ""},
+	} {
+		for name, contents := range files {
+			if err := writeFile(path.Join(testDir, dir), name, []byte(contents)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	loaded := config.Loaded
+	t.Cleanup(func() { config.Loaded = loaded })
+	config.Loaded.Guess.IgnorePaths = []string{"gen/"}
+
+	skip := map[string]bool{"__pycache__": true}
+	files, err := walkSourceFiles(testDir, []string{"*.py"}, skip, true, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"main.py", "src/app/keep_pb2.py", "src/app/views.py"}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("expected %v, got %v", expected, files)
+	}
+
+	files, err = walkSourceFiles(testDir, []string{"*.py"}, skip, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"main.py"}; !reflect.DeepEqual(files, expected) {
+		t.Errorf("expected %v at the top level, got %v", expected, files)
+	}
+}
@@ -0,0 +1,35 @@
+package versions
+
+import "fmt"
+
+// Compare orders two versions of the same package, returning -1, 0 or
+// 1. It reads them as semantic versions if it can, and as PEP 440
+// versions otherwise, so that it also orders the versions of
+// ecosystems that follow neither closely, such as "1.2" or "2.0.1.3".
+// It returns an error if neither reading understands both versions.
+func Compare(a, b string) (int, error) {
+	if va, err := ParseSemver(a); err == nil {
+		if vb, err := ParseSemver(b); err == nil {
+			return va.Compare(vb), nil
+		}
+	}
+	va, errA := ParsePEP440(a)
+	vb, errB := ParsePEP440(b)
+	if errA != nil || errB != nil {
+		return 0, fmt.Errorf("cannot compare versions %#v and %#v", a, b)
+	}
+	return va.Compare(vb), nil
+}
+
+// IsPrerelease returns true if version is a prerelease, as a semantic
+// version or a PEP 440 one. Versions that neither understands are not
+// prereleases.
+func IsPrerelease(version string) bool {
+	if v, err := ParseSemver(version); err == nil {
+		return len(v.Prerelease) > 0
+	}
+	if v, err := ParsePEP440(version); err == nil {
+		return v.IsPrerelease()
+	}
+	return false
+}
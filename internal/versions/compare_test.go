@@ -0,0 +1,46 @@
+package versions
+
+import "testing"
+
+func TestCompare(t *testing.T) {
+	for _, test := range []struct {
+		a, b     string
+		expected int
+	}{
+		{"1.2.3", "1.10.0", -1},
+		{"2.0.0", "2.0.0-rc.1", 1},
+		{"v1.0.0", "1.0.0", 0},
+		{"1.2", "1.10", -1},
+		{"2.0.1.3", "2.0.1", 1},
+		{"3.0.0", "3.0", 0},
+		{"1.0a1", "1.0", -1},
+	} {
+		cmp, err := Compare(test.a, test.b)
+		if err != nil {
+			t.Errorf("Compare(%q, %q): %s", test.a, test.b, err)
+		} else if cmp != test.expected {
+			t.Errorf("Compare(%q, %q) = %d, expected %d", test.a, test.b, cmp, test.expected)
+		}
+	}
+
+	if _, err := Compare("1.0.0", "abc1234"); err == nil {
+		t.Errorf("expected a git commit not to compare with a version")
+	}
+}
+
+func TestIsPrerelease(t *testing.T) {
+	for version, expected := range map[string]bool{
+		"1.2.3":        false,
+		"2.0.0-rc.1":   true,
+		"1.0a1":        true,
+		"1.0.dev3":     true,
+		"1.0.post1":    false,
+		"2.0.1.3":      false,
+		"abc1234":      false,
+		"4.0.0-beta.2": true,
+	} {
+		if got := IsPrerelease(version); got != expected {
+			t.Errorf("IsPrerelease(%q) = %v, expected %v", version, got, expected)
+		}
+	}
+}
@@ -0,0 +1,435 @@
+package versions
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// PEP440Version is a Python package version, as defined by
+// https://peps.python.org/pep-0440/.
+type PEP440Version struct {
+	Epoch   int
+	Release []int
+
+	// PreKind is "a", "b" or "rc", or empty if this is not a
+	// prerelease.
+	PreKind string
+	Pre     int
+
+	// Post is -1 if this is not a post-release.
+	Post int
+
+	// Dev is -1 if this is not a development release.
+	Dev int
+
+	Local string
+
+	// raw is the original string, used by the === operator.
+	raw string
+}
+
+// pep440Pattern is the version pattern from the PEP 440 appendix.
+var pep440Pattern = regexp.MustCompile(`(?i)^\s*v?` +
+	`(?:(?P<epoch>[0-9]+)!)?` +
+	`(?P<release>[0-9]+(?:\.[0-9]+)*)` +
+	`(?P<pre>[-_.]?(?P<pre_l>a|b|c|rc|alpha|beta|pre|preview)[-_.]?(?P<pre_n>[0-9]+)?)?` +
+	`(?P<post>(?:-(?P<post_n1>[0-9]+))|(?:[-_.]?(?P<post_l>post|rev|r)[-_.]?(?P<post_n2>[0-9]+)?))?` +
+	`(?P<dev>[-_.]?(?P<dev_l>dev)[-_.]?(?P<dev_n>[0-9]+)?)?` +
+	`(?:\+(?P<local>[a-z0-9]+(?:[-_.][a-z0-9]+)*))?\s*$`)
+
+// ParsePEP440 parses a Python package version, accepting the
+// alternative spellings that PEP 440 normalizes (e.g. "1.0-alpha1").
+func ParsePEP440(s string) (PEP440Version, error) {
+	m := pep440Pattern.FindStringSubmatch(s)
+	if m == nil {
+		return PEP440Version{}, fmt.Errorf("invalid version %#v", s)
+	}
+	group := func(name string) string {
+		return m[pep440Pattern.SubexpIndex(name)]
+	}
+	atoi := func(s string) int {
+		if s == "" {
+			return 0
+		}
+		n, _ := strconv.Atoi(s)
+		return n
+	}
+
+	v := PEP440Version{Epoch: atoi(group("epoch")), Post: -1, Dev: -1, raw: strings.TrimSpace(s)}
+	for _, part := range strings.Split(group("release"), ".") {
+		v.Release = append(v.Release, atoi(part))
+	}
+	if group("pre") != "" {
+		switch strings.ToLower(group("pre_l")) {
+		case "a", "alpha":
+			v.PreKind = "a"
+		case "b", "beta":
+			v.PreKind = "b"
+		default:
+			v.PreKind = "rc"
+		}
+		v.Pre = atoi(group("pre_n"))
+	}
+	if group("post") != "" {
+		v.Post = atoi(group("post_n1") + group("post_n2"))
+	}
+	if group("dev") != "" {
+		v.Dev = atoi(group("dev_n"))
+	}
+	v.Local = strings.ToLower(group("local"))
+	return v, nil
+}
+
+// IsPrerelease returns true for alpha, beta, release candidate and
+// development releases.
+func (v PEP440Version) IsPrerelease() bool {
+	return v.PreKind != "" || v.Dev >= 0
+}
+
+func (v PEP440Version) releaseAt(i int) int {
+	if i < len(v.Release) {
+		return v.Release[i]
+	}
+	return 0
+}
+
+// preKey orders the prerelease phase. A development release of a
+// final version sorts before its alphas, and a final version after
+// its release candidates.
+func (v PEP440Version) preKey() (int, int) {
+	switch v.PreKind {
+	case "a":
+		return 1, v.Pre
+	case "b":
+		return 2, v.Pre
+	case "rc":
+		return 3, v.Pre
+	}
+	if v.Post < 0 && v.Dev >= 0 {
+		return 0, 0
+	}
+	return 4, 0
+}
+
+func (v PEP440Version) devKey() int {
+	if v.Dev < 0 {
+		return math.MaxInt
+	}
+	return v.Dev
+}
+
+func compareInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// compareLocal orders local version labels: no label sorts first,
+// numeric segments sort after alphanumeric ones.
+func compareLocal(a, b string) int {
+	if a == b {
+		return 0
+	}
+	if a == "" {
+		return -1
+	}
+	if b == "" {
+		return 1
+	}
+	split := func(s string) []string {
+		return strings.FieldsFunc(s, func(r rune) bool { return r == '.' || r == '-' || r == '_' })
+	}
+	as, bs := split(a), split(b)
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aErr := strconv.Atoi(as[i])
+		bn, bErr := strconv.Atoi(bs[i])
+		var c int
+		switch {
+		case aErr == nil && bErr == nil:
+			c = compareInt(an, bn)
+		case aErr == nil:
+			c = 1
+		case bErr == nil:
+			c = -1
+		default:
+			c = strings.Compare(as[i], bs[i])
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return compareInt(len(as), len(bs))
+}
+
+// comparePublic compares v and other ignoring local labels.
+func (v PEP440Version) comparePublic(other PEP440Version) int {
+	if c := compareInt(v.Epoch, other.Epoch); c != 0 {
+		return c
+	}
+	n := len(v.Release)
+	if len(other.Release) > n {
+		n = len(other.Release)
+	}
+	for i := 0; i < n; i++ {
+		if c := compareInt(v.releaseAt(i), other.releaseAt(i)); c != 0 {
+			return c
+		}
+	}
+	vPhase, vPre := v.preKey()
+	oPhase, oPre := other.preKey()
+	if c := compareInt(vPhase, oPhase); c != 0 {
+		return c
+	}
+	if c := compareInt(vPre, oPre); c != 0 {
+		return c
+	}
+	if c := compareInt(v.Post, other.Post); c != 0 {
+		return c
+	}
+	return compareInt(v.devKey(), other.devKey())
+}
+
+// Compare returns -1, 0 or 1 if v sorts before, the same as, or
+// after other.
+func (v PEP440Version) Compare(other PEP440Version) int {
+	if c := v.comparePublic(other); c != 0 {
+		return c
+	}
+	return compareLocal(v.Local, other.Local)
+}
+
+// pep440Clause is one clause of a specifier, such as ">=1.2".
+type pep440Clause struct {
+	op       string
+	v        PEP440Version
+	wildcard bool
+}
+
+// prefixMatches implements ==V.* by comparing the release segments
+// given in the spec.
+func (c pep440Clause) prefixMatches(v PEP440Version) bool {
+	if v.Epoch != c.v.Epoch {
+		return false
+	}
+	for i := range c.v.Release {
+		if v.releaseAt(i) != c.v.Release[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (c pep440Clause) matches(v PEP440Version) bool {
+	switch c.op {
+	case "===":
+		return strings.EqualFold(v.raw, c.v.raw)
+	case "==", "!=":
+		var equal bool
+		switch {
+		case c.wildcard:
+			equal = c.prefixMatches(v)
+		case c.v.Local == "":
+			equal = v.comparePublic(c.v) == 0
+		default:
+			equal = v.Compare(c.v) == 0
+		}
+		return equal == (c.op == "==")
+	case "~=":
+		prefix := pep440Clause{v: c.v}
+		prefix.v.Release = c.v.Release[:len(c.v.Release)-1]
+		return v.comparePublic(c.v) >= 0 && prefix.prefixMatches(v)
+	case "<=":
+		return v.comparePublic(c.v) <= 0
+	case ">=":
+		return v.comparePublic(c.v) >= 0
+	case "<":
+		// <V does not match prereleases of V itself unless V is
+		// a prerelease.
+		if !c.v.IsPrerelease() && v.IsPrerelease() && sameRelease(v, c.v) {
+			return false
+		}
+		return v.comparePublic(c.v) < 0
+	case ">":
+		// >V does not match post-releases of V itself unless V
+		// is a post-release.
+		if c.v.Post < 0 && v.Post >= 0 && sameRelease(v, c.v) {
+			return false
+		}
+		return v.comparePublic(c.v) > 0
+	}
+	return false
+}
+
+func sameRelease(a, b PEP440Version) bool {
+	n := len(a.Release)
+	if len(b.Release) > n {
+		n = len(b.Release)
+	}
+	for i := 0; i < n; i++ {
+		if a.releaseAt(i) != b.releaseAt(i) {
+			return false
+		}
+	}
+	return a.Epoch == b.Epoch
+}
+
+// PEP440Specifier is a parsed specifier: a disjunction (Poetry's "||")
+// of comma-separated conjunctions.
+type PEP440Specifier [][]pep440Clause
+
+// poetryBound expands Poetry's caret and tilde operators into a
+// lower and an exclusive upper bound.
+func poetryBound(op string, v PEP440Version) []pep440Clause {
+	upper := PEP440Version{Epoch: v.Epoch, Post: -1, Dev: 0}
+	bumpAt := 0
+	if op == "^" {
+		for bumpAt < len(v.Release)-1 && v.Release[bumpAt] == 0 {
+			bumpAt++
+		}
+	} else if len(v.Release) > 1 {
+		bumpAt = 1
+	}
+	upper.Release = append([]int{}, v.Release[:bumpAt+1]...)
+	upper.Release[bumpAt]++
+	// The .dev0 makes the bound exclude prereleases of the next
+	// version, as Poetry does.
+	return []pep440Clause{{op: ">=", v: v}, {op: "<", v: upper}}
+}
+
+// CaretRange returns the specifier that allows the same versions as
+// Poetry's "^" operator applied to version, as in ">=1.2.3,<2" for
+// 1.2.3 or ">=0.2.3,<0.3" for 0.2.3, for package managers that do not
+// have the operator.
+func CaretRange(version string) (string, error) {
+	v, err := ParsePEP440(version)
+	if err != nil {
+		return "", err
+	}
+	bound := poetryBound("^", v)[1].v
+	parts := []string{}
+	for _, n := range bound.Release {
+		parts = append(parts, strconv.Itoa(n))
+	}
+	upper := strings.Join(parts, ".")
+	if bound.Epoch != 0 {
+		upper = strconv.Itoa(bound.Epoch) + "!" + upper
+	}
+	return fmt.Sprintf(">=%s,<%s", version, upper), nil
+}
+
+// pep440Operators are the specifier operators, longest first.
+var pep440Operators = []string{"===", "~=", "==", "!=", "<=", ">=", "<", ">", "^", "~", "="}
+
+func parsePEP440Clause(s string) ([]pep440Clause, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "*" {
+		return nil, nil
+	}
+	op := ""
+	for _, candidate := range pep440Operators {
+		if strings.HasPrefix(s, candidate) {
+			op = candidate
+			break
+		}
+	}
+	rest := strings.TrimSpace(strings.TrimPrefix(s, op))
+	if op == "===" {
+		return []pep440Clause{{op: op, v: PEP440Version{raw: rest}}}, nil
+	}
+	if op == "" || op == "=" {
+		// Poetry treats a bare version as an exact pin.
+		op = "=="
+	}
+
+	wildcard := false
+	if strings.HasSuffix(rest, ".*") {
+		if op != "==" && op != "!=" {
+			return nil, fmt.Errorf("invalid specifier %#v: wildcards need == or !=", s)
+		}
+		wildcard = true
+		rest = strings.TrimSuffix(rest, ".*")
+	}
+	v, err := ParsePEP440(rest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid specifier %#v: %w", s, err)
+	}
+	switch op {
+	case "^", "~":
+		return poetryBound(op, v), nil
+	case "~=":
+		if len(v.Release) < 2 {
+			return nil, fmt.Errorf("invalid specifier %#v: ~= needs at least two release segments", s)
+		}
+	}
+	return []pep440Clause{{op: op, v: v, wildcard: wildcard}}, nil
+}
+
+// operatorSplit finds the boundaries between space-separated clauses
+// such as ">=1.2 <1.5", which Poetry accepts in place of commas.
+var operatorSplit = regexp.MustCompile(`\s+(?:[<>=!~^])`)
+
+// ParsePEP440Specifier parses a PEP 440 specifier such as
+// ">=1.2, <2.0" or "~=1.4.2". Poetry's extensions are accepted too:
+// caret and tilde constraints ("^1.2", "~1.2"), bare versions, "*",
+// and alternatives separated by "||".
+func ParsePEP440Specifier(s string) (PEP440Specifier, error) {
+	spec := PEP440Specifier{}
+	for _, alternative := range strings.FieldsFunc(s, func(r rune) bool { return r == '|' }) {
+		set := []pep440Clause{}
+		for _, part := range strings.Split(alternative, ",") {
+			part = operatorSplit.ReplaceAllStringFunc(part, func(m string) string {
+				return "," + strings.TrimSpace(m)
+			})
+			for _, clauseStr := range strings.Split(part, ",") {
+				clauses, err := parsePEP440Clause(clauseStr)
+				if err != nil {
+					return nil, err
+				}
+				set = append(set, clauses...)
+			}
+		}
+		spec = append(spec, set)
+	}
+	if len(spec) == 0 {
+		spec = append(spec, []pep440Clause{})
+	}
+	return spec, nil
+}
+
+// Matches returns true if v satisfies the specifier. Prereleases are
+// accepted: a locked prerelease was chosen deliberately.
+func (s PEP440Specifier) Matches(v PEP440Version) bool {
+	for _, set := range s {
+		ok := true
+		for _, clause := range set {
+			if !clause.matches(v) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchesPEP440 reports whether version satisfies the specifier spec.
+func MatchesPEP440(spec, version string) (bool, error) {
+	s, err := ParsePEP440Specifier(spec)
+	if err != nil {
+		return false, err
+	}
+	v, err := ParsePEP440(version)
+	if err != nil {
+		return false, err
+	}
+	return s.Matches(v), nil
+}
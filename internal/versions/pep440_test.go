@@ -0,0 +1,109 @@
+package versions
+
+import "testing"
+
+func TestMatchesPEP440(t *testing.T) {
+	for _, tc := range []struct {
+		spec     string
+		version  string
+		expected bool
+	}{
+		{"", "1.0", true},
+		{"*", "1.0", true},
+		{"==1.0", "1.0.0", true},
+		{"==1.0", "1.0+local.1", true},
+		{"==1.0+local.1", "1.0", false},
+		{"!=1.0", "1.0.1", true},
+		{"==1.2.*", "1.2.5", true},
+		{"==1.2.*", "1.3", false},
+		{"!=1.2.*", "1.3", true},
+		{">=1.2, <2.0", "1.9.9", true},
+		{">=1.2,<2.0", "2.0", false},
+		{">=1.2 <1.5", "1.5", false},
+		{"~=1.4.2", "1.4.9", true},
+		{"~=1.4.2", "1.5.0", false},
+		{"~=2.2", "2.9", true},
+		{"~=2.2", "3.0", false},
+		{"<2.0", "2.0rc1", false},
+		{"<2.0rc2", "2.0rc1", true},
+		{">1.0", "1.0.post1", false},
+		{">1.0", "1.1", true},
+		{"===1.0.0", "1.0.0", true},
+		{"===1.0.0", "1.0", false},
+		{"^1.2.3", "1.9", true},
+		{"^1.2.3", "2.0", false},
+		{"^1.2.3", "2.0a1", false},
+		{"^0.2.3", "0.3.0", false},
+		{"^0.0.3", "0.0.3.post1", true},
+		{"~1.2.3", "1.2.9", true},
+		{"~1.2.3", "1.3", false},
+		{"~1", "1.9", true},
+		{"1.2.3", "1.2.3", true},
+		{"1.2.3", "1.2.4", false},
+		{"^1.0 || ^3.0", "3.2", true},
+		{"^1.0 || ^3.0", "2.2", false},
+		{">=1.0", "2.0b1", true},
+	} {
+		got, err := MatchesPEP440(tc.spec, tc.version)
+		if err != nil {
+			t.Errorf("%q against %q: unexpected error %s", tc.version, tc.spec, err)
+			continue
+		}
+		if got != tc.expected {
+			t.Errorf("%q against %q: expected %v, got %v", tc.version, tc.spec, tc.expected, got)
+		}
+	}
+}
+
+func TestPEP440Compare(t *testing.T) {
+	ordered := []string{
+		"1.0.dev456", "1.0a1", "1.0a2.dev456", "1.0a12", "1.0b1.dev456",
+		"1.0b2", "1.0b2.post345.dev456", "1.0b2.post345", "1.0rc1.dev456",
+		"1.0rc1", "1.0", "1.0+abc.5", "1.0+5", "1.0.post456.dev34", "1.0.post456",
+		"1.1.dev1", "1!0.1",
+	}
+	for i := 1; i < len(ordered); i++ {
+		a, err := ParsePEP440(ordered[i-1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ParsePEP440(ordered[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a.Compare(b) != -1 || b.Compare(a) != 1 {
+			t.Errorf("expected %s < %s", ordered[i-1], ordered[i])
+		}
+	}
+}
+
+func TestParsePEP440SpecifierErrors(t *testing.T) {
+	for _, spec := range []string{"~=1", ">=1.2.*", ">=banana", "==1.0,,<"} {
+		if _, err := ParsePEP440Specifier(spec); err == nil {
+			t.Errorf("expected %q to be rejected", spec)
+		}
+	}
+}
+
+func TestCaretRange(t *testing.T) {
+	for version, expected := range map[string]string{
+		"1.2.3":   ">=1.2.3,<2",
+		"0.2.3":   ">=0.2.3,<0.3",
+		"0.0.3":   ">=0.0.3,<0.0.4",
+		"2":       ">=2,<3",
+		"1!1.2.3": ">=1!1.2.3,<1!2",
+	} {
+		got, err := CaretRange(version)
+		if err != nil {
+			t.Errorf("CaretRange(%q): %s", version, err)
+		} else if got != expected {
+			t.Errorf("CaretRange(%q) = %q, expected %q", version, got, expected)
+		}
+		if ok, err := MatchesPEP440(got, version); err != nil || !ok {
+			t.Errorf("expected %q to match %q", got, version)
+		}
+	}
+	if _, err := CaretRange("banana"); err == nil {
+		t.Error("expected an invalid version to be rejected")
+	}
+}
@@ -0,0 +1,351 @@
+// Package versions implements the version constraint languages of the
+// package managers UPM drives: npm-style semver ranges and PEP 440
+// specifiers (with Poetry's extensions). It lets UPM decide whether a
+// locked version satisfies a spec without shelling out.
+package versions
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Semver is a semantic version, as defined by https://semver.org.
+type Semver struct {
+	Major, Minor, Patch uint64
+
+	// Prerelease holds the dot-separated identifiers after the
+	// hyphen, e.g. ["beta", "2"] for 1.0.0-beta.2.
+	Prerelease []string
+
+	// Build is the metadata after the plus sign. It is ignored
+	// when comparing versions.
+	Build string
+}
+
+// semverPattern matches a version in which each of the three
+// components may also be an x-range wildcard.
+var semverPattern = regexp.MustCompile(
+	`^[v=]*(\d+|[xX*])(?:\.(\d+|[xX*])(?:\.(\d+|[xX*])` +
+		`(?:-?([0-9A-Za-z-]+(?:\.[0-9A-Za-z-]+)*))?` +
+		`(?:\+([0-9A-Za-z-]+(?:\.[0-9A-Za-z-]+)*))?)?)?$`,
+)
+
+// partial is a version that may be missing trailing components, like
+// the operands of npm ranges. Missing and wildcard components are
+// both counted as unspecified.
+type partial struct {
+	v Semver
+
+	// specified is the number of leading components given.
+	specified int
+}
+
+func parsePartial(s string) (partial, error) {
+	m := semverPattern.FindStringSubmatch(s)
+	if m == nil {
+		return partial{}, fmt.Errorf("invalid version %#v", s)
+	}
+	p := partial{}
+	fields := []*uint64{&p.v.Major, &p.v.Minor, &p.v.Patch}
+	for i, field := range fields {
+		part := m[i+1]
+		if part == "" || part == "x" || part == "X" || part == "*" {
+			break
+		}
+		n, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return partial{}, fmt.Errorf("invalid version %#v: %w", s, err)
+		}
+		*field = n
+		p.specified++
+	}
+	if p.specified == 3 && m[4] != "" {
+		p.v.Prerelease = strings.Split(m[4], ".")
+	}
+	p.v.Build = m[5]
+	return p, nil
+}
+
+// ParseSemver parses a complete version such as "1.2.3-beta.1". A
+// leading "v" or "=" is allowed.
+func ParseSemver(s string) (Semver, error) {
+	p, err := parsePartial(strings.TrimSpace(s))
+	if err != nil {
+		return Semver{}, err
+	}
+	if p.specified < 3 {
+		return Semver{}, fmt.Errorf("invalid version %#v: expected MAJOR.MINOR.PATCH", s)
+	}
+	return p.v, nil
+}
+
+// String formats v without the build metadata.
+func (v Semver) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if len(v.Prerelease) > 0 {
+		s += "-" + strings.Join(v.Prerelease, ".")
+	}
+	return s
+}
+
+func compareUint(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// comparePrereleaseIdent compares identifiers as the semver spec
+// says: numerically if both are numeric, with numeric identifiers
+// sorting first, and lexically otherwise.
+func comparePrereleaseIdent(a, b string) int {
+	an, aErr := strconv.ParseUint(a, 10, 64)
+	bn, bErr := strconv.ParseUint(b, 10, 64)
+	switch {
+	case aErr == nil && bErr == nil:
+		return compareUint(an, bn)
+	case aErr == nil:
+		return -1
+	case bErr == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// Compare returns -1, 0 or 1 if v sorts before, the same as, or
+// after other.
+func (v Semver) Compare(other Semver) int {
+	if c := compareUint(v.Major, other.Major); c != 0 {
+		return c
+	}
+	if c := compareUint(v.Minor, other.Minor); c != 0 {
+		return c
+	}
+	if c := compareUint(v.Patch, other.Patch); c != 0 {
+		return c
+	}
+	// A version without a prerelease sorts after all of its
+	// prereleases.
+	switch {
+	case len(v.Prerelease) == 0 && len(other.Prerelease) == 0:
+		return 0
+	case len(v.Prerelease) == 0:
+		return 1
+	case len(other.Prerelease) == 0:
+		return -1
+	}
+	for i := 0; i < len(v.Prerelease) && i < len(other.Prerelease); i++ {
+		if c := comparePrereleaseIdent(v.Prerelease[i], other.Prerelease[i]); c != 0 {
+			return c
+		}
+	}
+	return compareUint(uint64(len(v.Prerelease)), uint64(len(other.Prerelease)))
+}
+
+// comparator is a single primitive condition such as ">=1.2.3".
+type comparator struct {
+	op string
+	v  Semver
+}
+
+func (c comparator) matches(v Semver) bool {
+	cmp := v.Compare(c.v)
+	switch c.op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	default:
+		return cmp == 0
+	}
+}
+
+// SemverRange is a parsed npm version range: a disjunction of
+// conjunctions of comparators.
+type SemverRange [][]comparator
+
+// bump returns the smallest version after all versions that start
+// with the components of p up to and including component, e.g.
+// 2.0.0-0 for 1.4 and component 0. The "-0" prerelease makes an
+// exclusive upper bound such as <2.0.0-0 also exclude the
+// prereleases of 2.0.0.
+func bump(p partial, component int) Semver {
+	v := Semver{Prerelease: []string{"0"}}
+	switch component {
+	case 0:
+		v.Major = p.v.Major + 1
+	case 1:
+		v.Major = p.v.Major
+		v.Minor = p.v.Minor + 1
+	default:
+		v.Major = p.v.Major
+		v.Minor = p.v.Minor
+		v.Patch = p.v.Patch + 1
+	}
+	return v
+}
+
+// desugar converts one primitive, tilde, caret or x-range into
+// comparators.
+func desugar(term string) ([]comparator, error) {
+	op := ""
+	for _, candidate := range []string{">=", "<=", ">", "<", "=", "~>", "~", "^"} {
+		if strings.HasPrefix(term, candidate) {
+			op = candidate
+			break
+		}
+	}
+	p, err := parsePartial(strings.TrimPrefix(term, op))
+	if err != nil {
+		return nil, err
+	}
+	lower := comparator{">=", p.v}
+	if p.specified == 0 {
+		switch op {
+		case "<", ">":
+			// Nothing is below or above everything.
+			return []comparator{{"<", Semver{Prerelease: []string{"0"}}}}, nil
+		}
+		return []comparator{{">=", Semver{}}}, nil
+	}
+
+	switch op {
+	case "~", "~>":
+		if p.specified == 1 {
+			return []comparator{lower, {"<", bump(p, 0)}}, nil
+		}
+		return []comparator{lower, {"<", bump(p, 1)}}, nil
+
+	case "^":
+		switch {
+		case p.v.Major != 0 || p.specified == 1:
+			return []comparator{lower, {"<", bump(p, 0)}}, nil
+		case p.v.Minor != 0 || p.specified == 2:
+			return []comparator{lower, {"<", bump(p, 1)}}, nil
+		}
+		return []comparator{lower, {"<", bump(p, 2)}}, nil
+
+	case "", "=":
+		if p.specified == 3 {
+			return []comparator{{"=", p.v}}, nil
+		}
+		return []comparator{lower, {"<", bump(p, p.specified-1)}}, nil
+
+	case ">":
+		if p.specified == 3 {
+			return []comparator{{">", p.v}}, nil
+		}
+		return []comparator{{">=", bump(p, p.specified-1)}}, nil
+
+	case "<=":
+		if p.specified == 3 {
+			return []comparator{{"<=", p.v}}, nil
+		}
+		return []comparator{{"<", bump(p, p.specified-1)}}, nil
+
+	case "<":
+		v := p.v
+		if p.specified < 3 {
+			v.Prerelease = []string{"0"}
+		}
+		return []comparator{{"<", v}}, nil
+	}
+	// ">="
+	return []comparator{lower}, nil
+}
+
+// operatorSpaces matches whitespace between an operator and its
+// version, which npm allows.
+var operatorSpaces = regexp.MustCompile(`(>=|<=|>|<|=|~>|~|\^)\s+`)
+
+// ParseSemverRange parses an npm version range such as "^1.2.0",
+// ">=1.0.0 <2.0.0 || 3.x" or "1.2.3 - 2.3.4".
+func ParseSemverRange(s string) (SemverRange, error) {
+	r := SemverRange{}
+	for _, alternative := range strings.Split(s, "||") {
+		alternative = strings.TrimSpace(alternative)
+		set := []comparator{}
+
+		if lo, hi, ok := strings.Cut(alternative, " - "); ok {
+			low, err := parsePartial(strings.TrimSpace(lo))
+			if err != nil {
+				return nil, err
+			}
+			high, err := parsePartial(strings.TrimSpace(hi))
+			if err != nil {
+				return nil, err
+			}
+			set = append(set, comparator{">=", low.v})
+			switch high.specified {
+			case 0:
+			case 3:
+				set = append(set, comparator{"<=", high.v})
+			default:
+				set = append(set, comparator{"<", bump(high, high.specified-1)})
+			}
+			r = append(r, set)
+			continue
+		}
+
+		alternative = operatorSpaces.ReplaceAllString(alternative, "$1")
+		for _, term := range strings.Fields(alternative) {
+			comparators, err := desugar(term)
+			if err != nil {
+				return nil, err
+			}
+			set = append(set, comparators...)
+		}
+		if len(set) == 0 {
+			set = append(set, comparator{">=", Semver{}})
+		}
+		r = append(r, set)
+	}
+	return r, nil
+}
+
+// Matches returns true if v satisfies the range. Like npm, a
+// prerelease only satisfies a range that mentions a prerelease of the
+// same MAJOR.MINOR.PATCH.
+func (r SemverRange) Matches(v Semver) bool {
+	for _, set := range r {
+		ok := true
+		prereleaseAllowed := len(v.Prerelease) == 0
+		for _, c := range set {
+			if !c.matches(v) {
+				ok = false
+				break
+			}
+			if len(c.v.Prerelease) > 0 &&
+				c.v.Major == v.Major && c.v.Minor == v.Minor && c.v.Patch == v.Patch {
+				prereleaseAllowed = true
+			}
+		}
+		if ok && prereleaseAllowed {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchesSemverRange reports whether version satisfies the npm range
+// spec.
+func MatchesSemverRange(spec, version string) (bool, error) {
+	r, err := ParseSemverRange(spec)
+	if err != nil {
+		return false, err
+	}
+	v, err := ParseSemver(version)
+	if err != nil {
+		return false, err
+	}
+	return r.Matches(v), nil
+}
@@ -0,0 +1,81 @@
+package versions
+
+import "testing"
+
+func TestMatchesSemverRange(t *testing.T) {
+	for _, tc := range []struct {
+		spec     string
+		version  string
+		expected bool
+	}{
+		{"", "1.2.3", true},
+		{"*", "0.0.1", true},
+		{"1.2.3", "1.2.3", true},
+		{"=1.2.3", "1.2.4", false},
+		{"^1.2.3", "1.9.0", true},
+		{"^1.2.3", "2.0.0", false},
+		{"^1.2.3", "1.2.2", false},
+		{"^0.2.3", "0.2.9", true},
+		{"^0.2.3", "0.3.0", false},
+		{"^0.0.3", "0.0.4", false},
+		{"^1.2", "1.99.0", true},
+		{"~1.2.3", "1.2.9", true},
+		{"~1.2.3", "1.3.0", false},
+		{"~1", "1.9.9", true},
+		{"1.x", "1.4.0", true},
+		{"1.x", "2.0.0", false},
+		{"1.2.*", "1.2.7", true},
+		{">=1.0.0 <2.0.0", "1.5.0", true},
+		{">= 1.0.0 < 2.0.0", "2.0.0", false},
+		{">1.2", "1.2.9", false},
+		{">1.2", "1.3.0", true},
+		{"<=1.2", "1.2.9", true},
+		{"<1.2", "1.1.9", true},
+		{"1.2.3 - 2.3.4", "2.3.4", true},
+		{"1.2.3 - 2.3", "2.3.9", true},
+		{"1.2.3 - 2.3", "2.4.0", false},
+		{"^1.0.0 || ^3.0.0", "3.1.0", true},
+		{"^1.0.0 || ^3.0.0", "2.1.0", false},
+		{"^1.2.3", "1.5.0-beta.1", false},
+		{"^1.2.3-beta.1", "1.2.3-beta.2", true},
+		{"^1.2.3-beta.1", "1.2.3", true},
+		{"v1.2.3", "1.2.3", true},
+	} {
+		got, err := MatchesSemverRange(tc.spec, tc.version)
+		if err != nil {
+			t.Errorf("%q against %q: unexpected error %s", tc.version, tc.spec, err)
+			continue
+		}
+		if got != tc.expected {
+			t.Errorf("%q against %q: expected %v, got %v", tc.version, tc.spec, tc.expected, got)
+		}
+	}
+}
+
+func TestSemverCompare(t *testing.T) {
+	ordered := []string{
+		"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta",
+		"1.0.0-beta.2", "1.0.0-beta.11", "1.0.0-rc.1", "1.0.0", "1.0.1", "1.10.0",
+	}
+	for i := 1; i < len(ordered); i++ {
+		a, err := ParseSemver(ordered[i-1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ParseSemver(ordered[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a.Compare(b) != -1 || b.Compare(a) != 1 {
+			t.Errorf("expected %s < %s", a, b)
+		}
+	}
+}
+
+func TestParseSemverRangeErrors(t *testing.T) {
+	for _, spec := range []string{"latest", "^x.y", "1.2.3.4", ">=foo"} {
+		if _, err := ParseSemverRange(spec); err == nil {
+			t.Errorf("expected %q to be rejected", spec)
+		}
+	}
+}
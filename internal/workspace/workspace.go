@@ -0,0 +1,379 @@
+// Package workspace finds the sub-projects of a monorepo, so that
+// 'upm --workspace', 'upm --all-workspaces' and 'upm --recursive' can
+// run commands in them from the root of the repository.
+package workspace
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// Kinds of workspace, for Member.Kind.
+const (
+	// The "workspaces" field of package.json, used by npm, Yarn
+	// and Bun.
+	KindPackageJSON = "package.json"
+	// pnpm-workspace.yaml.
+	KindPnpm = "pnpm"
+	// Path dependencies in the pyproject.toml of a Poetry
+	// project.
+	KindPoetry = "poetry"
+	// The [workspace] table of Cargo.toml.
+	KindCargo = "cargo"
+	// A directory with a specfile, found by Discover.
+	KindDirectory = "directory"
+)
+
+// Member is one sub-project of a workspace.
+type Member struct {
+	// The name of the package, or of its directory if it has
+	// none.
+	Name string `json:"name"`
+
+	// The directory of the member, relative to the root of the
+	// workspace, with forward slashes.
+	Path string `json:"path"`
+
+	// The kind of workspace that the member belongs to.
+	Kind string `json:"kind"`
+}
+
+// Find returns the members of the workspaces defined in the directory
+// root, sorted by path. A directory that is a member of several
+// workspaces, e.g. of both a Yarn and a Cargo workspace, is returned
+// once for each.
+func Find(root string) ([]Member, error) {
+	members := []Member{}
+	for _, find := range []func(string) ([]Member, error){
+		findPackageJSON, findPnpm, findPoetry, findCargo,
+	} {
+		found, err := find(root)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, found...)
+	}
+	sort.SliceStable(members, func(i, j int) bool {
+		return members[i].Path < members[j].Path
+	})
+	return members, nil
+}
+
+// skippedDirs are directories that Discover does not descend into,
+// because they hold installed packages or build output rather than
+// projects.
+var skippedDirs = map[string]bool{
+	"node_modules":  true,
+	"vendor":        true,
+	"target":        true,
+	"venv":          true,
+	"__pycache__":   true,
+	"site-packages": true,
+}
+
+// IsSkippedDir returns true for the name of a directory that is not
+// part of a project's sources: a hidden directory, or one in
+// skippedDirs.
+func IsSkippedDir(name string) bool {
+	return strings.HasPrefix(name, ".") || skippedDirs[name]
+}
+
+// Discover returns every directory under root, including root itself,
+// that contains one of the given specfiles, sorted by path. Hidden
+// directories and directories of installed packages are skipped. It
+// is for monorepos that have no workspace configuration; each member
+// is named by its path.
+func Discover(root string, specfiles []string) ([]Member, error) {
+	members := []Member{}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != root && IsSkippedDir(d.Name()) {
+			return filepath.SkipDir
+		}
+		for _, specfile := range specfiles {
+			if info, err := os.Stat(filepath.Join(path, specfile)); err == nil && !info.IsDir() {
+				rel := relative(root, path)
+				members = append(members, Member{Name: rel, Path: rel, Kind: KindDirectory})
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(members, func(i, j int) bool {
+		return members[i].Path < members[j].Path
+	})
+	return members, nil
+}
+
+// Select returns the members whose name or path is name.
+func Select(members []Member, name string) []Member {
+	selected := []Member{}
+	clean := filepath.ToSlash(filepath.Clean(name))
+	for _, member := range members {
+		if member.Name == name || member.Path == clean {
+			selected = append(selected, member)
+		}
+	}
+	return selected
+}
+
+// expandPatterns returns the directories under root that match one of
+// the glob patterns, minus those that match a pattern in exclude or a
+// pattern starting with "!", and that contain marker. Patterns ending
+// in "/**" match every directory below the prefix.
+func expandPatterns(root string, patterns []string, exclude []string, marker string) ([]string, error) {
+	excluded := map[string]bool{}
+	include := []string{}
+	for _, pattern := range patterns {
+		if rest, ok := strings.CutPrefix(pattern, "!"); ok {
+			exclude = append(exclude, rest)
+		} else {
+			include = append(include, pattern)
+		}
+	}
+
+	glob := func(pattern string) ([]string, error) {
+		pattern = strings.TrimSuffix(filepath.FromSlash(pattern), string(filepath.Separator))
+		base, recursive := strings.CutSuffix(pattern, string(filepath.Separator)+"**")
+		matches, err := filepath.Glob(filepath.Join(root, base))
+		if err != nil || !recursive {
+			return matches, err
+		}
+		dirs := []string{}
+		for _, match := range matches {
+			err := filepath.WalkDir(match, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if d.IsDir() && (d.Name() == "node_modules" || strings.HasPrefix(d.Name(), ".")) && path != match {
+					return filepath.SkipDir
+				}
+				if d.IsDir() {
+					dirs = append(dirs, path)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+		return dirs, nil
+	}
+
+	for _, pattern := range exclude {
+		matches, err := glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		for _, match := range matches {
+			excluded[match] = true
+		}
+	}
+
+	seen := map[string]bool{}
+	dirs := []string{}
+	for _, pattern := range include {
+		matches, err := glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		for _, match := range matches {
+			if excluded[match] || seen[match] {
+				continue
+			}
+			if info, err := os.Stat(filepath.Join(match, marker)); err != nil || info.IsDir() {
+				continue
+			}
+			seen[match] = true
+			dirs = append(dirs, match)
+		}
+	}
+	return dirs, nil
+}
+
+// relative returns dir relative to root, with forward slashes.
+func relative(root, dir string) string {
+	if rel, err := filepath.Rel(root, dir); err == nil {
+		dir = rel
+	}
+	return filepath.ToSlash(dir)
+}
+
+// packageJSONName returns the "name" field of the package.json in dir,
+// or "" if there is none.
+func packageJSONName(dir string) string {
+	var cfg struct {
+		Name string `json:"name"`
+	}
+	if contents, err := os.ReadFile(filepath.Join(dir, "package.json")); err == nil {
+		_ = json.Unmarshal(contents, &cfg)
+	}
+	return cfg.Name
+}
+
+// nodeMembers returns the members for the directories that patterns
+// match.
+func nodeMembers(root string, patterns []string, kind string) ([]Member, error) {
+	dirs, err := expandPatterns(root, patterns, nil, "package.json")
+	if err != nil {
+		return nil, fmt.Errorf("%s workspaces: %w", kind, err)
+	}
+	members := []Member{}
+	for _, dir := range dirs {
+		name := packageJSONName(dir)
+		if name == "" {
+			name = filepath.Base(dir)
+		}
+		members = append(members, Member{Name: name, Path: relative(root, dir), Kind: kind})
+	}
+	return members, nil
+}
+
+// findPackageJSON returns the members listed in the "workspaces" field
+// of package.json, which is either a list of patterns or, for Yarn 1,
+// an object with a "packages" list.
+func findPackageJSON(root string) ([]Member, error) {
+	contents, err := os.ReadFile(filepath.Join(root, "package.json"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var cfg struct {
+		Workspaces json.RawMessage `json:"workspaces"`
+	}
+	if err := json.Unmarshal(contents, &cfg); err != nil {
+		return nil, fmt.Errorf("package.json: %w", err)
+	}
+	if len(cfg.Workspaces) == 0 {
+		return nil, nil
+	}
+	var patterns []string
+	if err := json.Unmarshal(cfg.Workspaces, &patterns); err != nil {
+		var object struct {
+			Packages []string `json:"packages"`
+		}
+		if err := json.Unmarshal(cfg.Workspaces, &object); err != nil {
+			return nil, fmt.Errorf("package.json: workspaces must be a list of patterns")
+		}
+		patterns = object.Packages
+	}
+	return nodeMembers(root, patterns, KindPackageJSON)
+}
+
+// findPnpm returns the members listed in pnpm-workspace.yaml.
+func findPnpm(root string) ([]Member, error) {
+	contents, err := os.ReadFile(filepath.Join(root, "pnpm-workspace.yaml"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var cfg struct {
+		Packages []string `yaml:"packages"`
+	}
+	if err := yaml.Unmarshal(contents, &cfg); err != nil {
+		return nil, fmt.Errorf("pnpm-workspace.yaml: %w", err)
+	}
+	return nodeMembers(root, cfg.Packages, KindPnpm)
+}
+
+// findPoetry returns the path dependencies of the Poetry project in
+// root that are Python projects themselves.
+func findPoetry(root string) ([]Member, error) {
+	var cfg struct {
+		Tool struct {
+			Poetry struct {
+				Dependencies    map[string]interface{} `toml:"dependencies"`
+				DevDependencies map[string]interface{} `toml:"dev-dependencies"`
+				Group           map[string]struct {
+					Dependencies map[string]interface{} `toml:"dependencies"`
+				} `toml:"group"`
+			} `toml:"poetry"`
+		} `toml:"tool"`
+	}
+	if _, err := toml.DecodeFile(filepath.Join(root, "pyproject.toml"), &cfg); os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("pyproject.toml: %w", err)
+	}
+
+	deps := []map[string]interface{}{cfg.Tool.Poetry.Dependencies, cfg.Tool.Poetry.DevDependencies}
+	for _, group := range cfg.Tool.Poetry.Group {
+		deps = append(deps, group.Dependencies)
+	}
+	seen := map[string]bool{}
+	members := []Member{}
+	for _, group := range deps {
+		for name, spec := range group {
+			table, ok := spec.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			path, ok := table["path"].(string)
+			if !ok {
+				continue
+			}
+			dir := filepath.Join(root, filepath.FromSlash(path))
+			if info, err := os.Stat(filepath.Join(dir, "pyproject.toml")); err != nil || info.IsDir() || seen[dir] {
+				continue
+			}
+			seen[dir] = true
+			members = append(members, Member{Name: name, Path: relative(root, dir), Kind: KindPoetry})
+		}
+	}
+	return members, nil
+}
+
+// findCargo returns the members of the Cargo workspace in root.
+func findCargo(root string) ([]Member, error) {
+	var cfg struct {
+		Workspace *struct {
+			Members []string `toml:"members"`
+			Exclude []string `toml:"exclude"`
+		} `toml:"workspace"`
+	}
+	if _, err := toml.DecodeFile(filepath.Join(root, "Cargo.toml"), &cfg); os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("Cargo.toml: %w", err)
+	}
+	if cfg.Workspace == nil {
+		return nil, nil
+	}
+	dirs, err := expandPatterns(root, cfg.Workspace.Members, cfg.Workspace.Exclude, "Cargo.toml")
+	if err != nil {
+		return nil, fmt.Errorf("Cargo.toml: %w", err)
+	}
+	members := []Member{}
+	for _, dir := range dirs {
+		var pkg struct {
+			Package struct {
+				Name string `toml:"name"`
+			} `toml:"package"`
+		}
+		_, _ = toml.DecodeFile(filepath.Join(dir, "Cargo.toml"), &pkg)
+		name := pkg.Package.Name
+		if name == "" {
+			name = filepath.Base(dir)
+		}
+		members = append(members, Member{Name: name, Path: relative(root, dir), Kind: KindCargo})
+	}
+	return members, nil
+}
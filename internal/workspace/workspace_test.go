@@ -0,0 +1,169 @@
+package workspace
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeFiles creates the given files, relative to dir.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, contents := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFind(t *testing.T) {
+	for _, test := range []struct {
+		scenario string
+		files    map[string]string
+		expected []Member
+	}{
+		{
+			scenario: "package.json workspaces",
+			files: map[string]string{
+				"package.json":              `{"private": true, "workspaces": ["packages/*", "tools/cli"]}`,
+				"packages/web/package.json": `{"name": "@acme/web"}`,
+				"packages/api/package.json": `{}`,
+				"packages/docs/README.md":   ``,
+				"tools/cli/package.json":    `{"name": "acme-cli"}`,
+			},
+			expected: []Member{
+				{Name: "api", Path: "packages/api", Kind: KindPackageJSON},
+				{Name: "@acme/web", Path: "packages/web", Kind: KindPackageJSON},
+				{Name: "acme-cli", Path: "tools/cli", Kind: KindPackageJSON},
+			},
+		},
+		{
+			scenario: "Yarn 1 workspaces object",
+			files: map[string]string{
+				"package.json":            `{"workspaces": {"packages": ["apps/*"]}}`,
+				"apps/site/package.json":  `{"name": "site"}`,
+				"apps/admin/package.json": `{"name": "admin"}`,
+			},
+			expected: []Member{
+				{Name: "admin", Path: "apps/admin", Kind: KindPackageJSON},
+				{Name: "site", Path: "apps/site", Kind: KindPackageJSON},
+			},
+		},
+		{
+			scenario: "pnpm workspace with exclusions",
+			files: map[string]string{
+				"package.json":                   `{"name": "root"}`,
+				"pnpm-workspace.yaml":            "packages:\n  - 'packages/**'\n  - '!packages/internal/**'\n",
+				"packages/a/package.json":        `{"name": "a"}`,
+				"packages/group/b/package.json":  `{"name": "b"}`,
+				"packages/internal/package.json": `{"name": "internal"}`,
+			},
+			expected: []Member{
+				{Name: "a", Path: "packages/a", Kind: KindPnpm},
+				{Name: "b", Path: "packages/group/b", Kind: KindPnpm},
+			},
+		},
+		{
+			scenario: "Poetry path dependencies",
+			files: map[string]string{
+				"pyproject.toml": `[tool.poetry.dependencies]
+python = "^3.10"
+flask = "^3.0"
+core = { path = "libs/core", develop = true }
+missing = { path = "libs/missing" }
+
+[tool.poetry.group.dev.dependencies]
+testing = { path = "libs/testing" }
+`,
+				"libs/core/pyproject.toml":    ``,
+				"libs/testing/pyproject.toml": ``,
+			},
+			expected: []Member{
+				{Name: "core", Path: "libs/core", Kind: KindPoetry},
+				{Name: "testing", Path: "libs/testing", Kind: KindPoetry},
+			},
+		},
+		{
+			scenario: "Cargo workspace",
+			files: map[string]string{
+				"Cargo.toml": `[workspace]
+members = ["crates/*"]
+exclude = ["crates/old"]
+`,
+				"crates/parser/Cargo.toml": "[package]\nname = \"acme-parser\"\n",
+				"crates/old/Cargo.toml":    "[package]\nname = \"old\"\n",
+			},
+			expected: []Member{
+				{Name: "acme-parser", Path: "crates/parser", Kind: KindCargo},
+			},
+		},
+		{
+			scenario: "no workspace",
+			files: map[string]string{
+				"package.json":   `{"name": "app"}`,
+				"Cargo.toml":     "[package]\nname = \"app\"\n",
+				"pyproject.toml": "[tool.poetry.dependencies]\nflask = \"^3.0\"\n",
+			},
+			expected: []Member{},
+		},
+	} {
+		t.Run(test.scenario, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, test.files)
+			members, err := Find(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(members, test.expected) {
+				t.Errorf("expected %+v, got %+v", test.expected, members)
+			}
+		})
+	}
+}
+
+func TestSelect(t *testing.T) {
+	members := []Member{
+		{Name: "@acme/web", Path: "packages/web"},
+		{Name: "api", Path: "packages/api"},
+	}
+	for name, expected := range map[string][]Member{
+		"@acme/web":      {members[0]},
+		"packages/api":   {members[1]},
+		"./packages/api": {members[1]},
+		"web":            {},
+	} {
+		if selected := Select(members, name); !reflect.DeepEqual(selected, expected) {
+			t.Errorf("Select(%q) = %+v, expected %+v", name, selected, expected)
+		}
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"package.json":                                 `{}`,
+		"services/api/requirements.txt":                ``,
+		"services/api/vendor/x/package.json":           `{}`,
+		"services/web/package.json":                    `{}`,
+		"services/web/node_modules/react/package.json": `{}`,
+		"tools/.cache/package.json":                    `{}`,
+		"docs/README.md":                               ``,
+	})
+	members, err := Discover(dir, []string{"package.json", "requirements.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Member{
+		{Name: ".", Path: ".", Kind: KindDirectory},
+		{Name: "services/api", Path: "services/api", Kind: KindDirectory},
+		{Name: "services/web", Path: "services/web", Kind: KindDirectory},
+	}
+	if !reflect.DeepEqual(members, expected) {
+		t.Errorf("expected %+v, got %+v", expected, members)
+	}
+}
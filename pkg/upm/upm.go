@@ -0,0 +1,285 @@
+// Package upm lets other Go programs, such as language servers and
+// build systems, manage a project's packages the same way as the upm
+// binary, without spawning it.
+//
+// UPM's backends work on the current directory, so every operation
+// changes into the project directory while it runs and changes back
+// afterwards. Operations are serialized by a package-level lock; do
+// not change directory concurrently from elsewhere in the program.
+package upm
+
+import (
+	"context"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/replit/upm/internal/api"
+	"github.com/replit/upm/internal/backends"
+	"github.com/replit/upm/internal/store"
+	"github.com/replit/upm/internal/util"
+)
+
+// PkgInfo is the information about a package returned by Search and
+// Info.
+type PkgInfo = api.PkgInfo
+
+// Error is the type of errors returned by this package when a backend
+// fails. Its Code classifies the failure, and matches the exit status
+// of the upm binary.
+type Error = util.Error
+
+// ExitCode classifies an Error.
+type ExitCode = util.ExitCode
+
+// Dep is a package listed in a project's specfile.
+type Dep struct {
+	Name  string
+	Spec  string
+	Dev   bool
+	Group string
+}
+
+// Backend manages the packages of one project with one language
+// backend. It is returned by Open.
+type Backend interface {
+	// Name returns the name of the language backend, such as
+	// python3-poetry.
+	Name() string
+
+	// Add adds packages to the specfile, then updates the lockfile
+	// and installs them. The keys of pkgs are package names, and
+	// the values are version specs; an empty spec means any
+	// version. Like Remove, it waits for other UPM processes that
+	// are modifying the project.
+	Add(pkgs map[string]string) error
+
+	// Remove removes packages from the specfile, then updates the
+	// lockfile and uninstalls them.
+	Remove(names []string) error
+
+	// List returns the packages in the specfile, sorted by name.
+	List() ([]Dep, error)
+
+	// ListLocked returns the package versions in the lockfile.
+	ListLocked() (map[string]string, error)
+
+	// Search searches the backend's package index.
+	Search(query string) ([]PkgInfo, error)
+
+	// Info looks up a package in the backend's package index. A
+	// package that does not exist gives a zero PkgInfo.
+	Info(name string) (PkgInfo, error)
+}
+
+var (
+	// mu serializes operations, which change the working
+	// directory.
+	mu sync.Mutex
+
+	setupOnce sync.Once
+)
+
+// inDir runs fn in dir, turning a failure into an *Error.
+func inDir(dir string, fn func()) error {
+	setupOnce.Do(func() {
+		backends.SetupAll()
+		backends.RegisterExternal()
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	prev, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	if err := os.Chdir(dir); err != nil {
+		return err
+	}
+	defer os.Chdir(prev)
+
+	store.Reset()
+	return util.Catch(fn)
+}
+
+// Open selects the backend for the project in dir. If language is
+// empty, it is detected from the files in dir, as with the upm
+// binary; otherwise it may be anything accepted by --lang.
+func Open(dir, language string) (Backend, error) {
+	var b api.LanguageBackend
+	err := inDir(dir, func() {
+		b = backends.GetBackend(context.Background(), language)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &backend{b: b, dir: dir}, nil
+}
+
+// Add is shorthand for Open followed by Backend.Add.
+func Add(dir, language string, pkgs map[string]string) error {
+	b, err := Open(dir, language)
+	if err != nil {
+		return err
+	}
+	return b.Add(pkgs)
+}
+
+// Remove is shorthand for Open followed by Backend.Remove.
+func Remove(dir, language string, names []string) error {
+	b, err := Open(dir, language)
+	if err != nil {
+		return err
+	}
+	return b.Remove(names)
+}
+
+// List is shorthand for Open followed by Backend.List.
+func List(dir, language string) ([]Dep, error) {
+	b, err := Open(dir, language)
+	if err != nil {
+		return nil, err
+	}
+	return b.List()
+}
+
+// Search is shorthand for Open followed by Backend.Search.
+func Search(dir, language, query string) ([]PkgInfo, error) {
+	b, err := Open(dir, language)
+	if err != nil {
+		return nil, err
+	}
+	return b.Search(query)
+}
+
+// backend implements Backend.
+type backend struct {
+	b   api.LanguageBackend
+	dir string
+}
+
+func (b *backend) Name() string {
+	return b.b.Name
+}
+
+func (b *backend) Add(pkgs map[string]string) error {
+	return inDir(b.dir, func() {
+		defer util.LockProject(true)()
+		ctx := context.Background()
+		specs := map[api.PkgName]api.PkgSpec{}
+		for name, spec := range pkgs {
+			if spec != "" && b.b.ValidateSpec != nil {
+				if err := b.b.ValidateSpec(api.PkgSpec(spec)); err != nil {
+					util.DieConsistency("%s: %s", name, err)
+				}
+			}
+			specs[api.PkgName(name)] = api.PkgSpec(spec)
+		}
+		if len(specs) > 0 {
+			b.b.Add(ctx, specs, "")
+		}
+		b.sync(ctx)
+	})
+}
+
+func (b *backend) Remove(names []string) error {
+	return inDir(b.dir, func() {
+		defer util.LockProject(true)()
+		ctx := context.Background()
+		if !util.Exists(b.b.Specfile) {
+			return
+		}
+		listed := map[api.PkgName]bool{}
+		for name := range b.b.ListSpecfile(true) {
+			listed[b.b.NormalizePackageName(name)] = true
+		}
+		pkgs := map[api.PkgName]bool{}
+		for _, name := range names {
+			if norm := b.b.NormalizePackageName(api.PkgName(name)); listed[norm] {
+				pkgs[norm] = true
+			}
+		}
+		if len(pkgs) > 0 {
+			b.b.Remove(ctx, pkgs)
+		}
+		b.sync(ctx)
+	})
+}
+
+// sync brings the lockfile and installed packages up to date after
+// the specfile changed, and records the new state in the store.
+func (b *backend) sync(ctx context.Context) {
+	if b.b.QuirksDoesAddRemoveNotAlsoLock() {
+		didLock := false
+		if !b.b.QuirksIsNotReproducible() && util.Exists(b.b.Specfile) {
+			b.b.Lock(ctx)
+			didLock = true
+		}
+		if !(didLock && b.b.QuirksDoesLockAlsoInstall()) {
+			b.b.Install(ctx)
+		}
+	} else if b.b.QuirksDoesAddRemoveNotAlsoInstall() {
+		b.b.Install(ctx)
+	}
+
+	store.Read(ctx, b.b)
+	store.UpdateFileHashes(ctx, b.b)
+	store.Write(ctx)
+}
+
+func (b *backend) List() ([]Dep, error) {
+	var deps []Dep
+	err := inDir(b.dir, func() {
+		if !util.Exists(b.b.Specfile) {
+			return
+		}
+		for name, dep := range b.b.ListSpecfile(true) {
+			deps = append(deps, Dep{
+				Name:  string(name),
+				Spec:  string(dep.Spec),
+				Dev:   dep.Dev,
+				Group: dep.Group,
+			})
+		}
+	})
+	sort.Slice(deps, func(i, j int) bool {
+		return deps[i].Name < deps[j].Name
+	})
+	return deps, err
+}
+
+func (b *backend) ListLocked() (map[string]string, error) {
+	locked := map[string]string{}
+	err := inDir(b.dir, func() {
+		if !util.Exists(b.b.Lockfile) {
+			return
+		}
+		for name, version := range b.b.ListLockfile() {
+			locked[string(name)] = string(version)
+		}
+	})
+	return locked, err
+}
+
+func (b *backend) Search(query string) ([]PkgInfo, error) {
+	var results []PkgInfo
+	err := inDir(b.dir, func() {
+		if b.b.Search == nil {
+			util.DieUnimplemented("%s does not support search", b.b.Name)
+		}
+		results = b.b.Search(query)
+	})
+	return results, err
+}
+
+func (b *backend) Info(name string) (PkgInfo, error) {
+	var info PkgInfo
+	err := inDir(b.dir, func() {
+		if b.b.Info == nil {
+			util.DieUnimplemented("%s does not support info", b.b.Name)
+		}
+		info = b.b.Info(api.PkgName(name))
+	})
+	return info, err
+}
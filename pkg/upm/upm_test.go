@@ -0,0 +1,43 @@
+package upm
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestList(t *testing.T) {
+	dir := t.TempDir()
+	packageJSON := `{
+  "dependencies": {"express": "^4.18.2"},
+  "devDependencies": {"jest": "^29.0.0"}
+}`
+	if err := os.WriteFile(filepath.Join(dir, "package.json"), []byte(packageJSON), 0o666); err != nil {
+		t.Fatal(err)
+	}
+
+	deps, err := List(dir, "nodejs-npm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Dep{
+		{Name: "express", Spec: "^4.18.2"},
+		{Name: "jest", Spec: "^29.0.0", Dev: true},
+	}
+	if !reflect.DeepEqual(deps, expected) {
+		t.Errorf("expected %+v, got %+v", expected, deps)
+	}
+}
+
+func TestOpenUnknownLanguage(t *testing.T) {
+	_, err := Open(t.TempDir(), "cobol")
+	var upmErr *Error
+	if !errors.As(err, &upmErr) {
+		t.Fatalf("expected *Error, got %#v", err)
+	}
+	if upmErr.Msg != "no such language: cobol" {
+		t.Errorf("unexpected message %q", upmErr.Msg)
+	}
+}
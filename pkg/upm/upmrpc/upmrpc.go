@@ -0,0 +1,194 @@
+// Package upmrpc defines version 1 of the protocol that 'upm --daemon'
+// speaks, for editors that manage a project's packages through a
+// long-running UPM and show its progress as it happens.
+//
+// The protocol is JSON-RPC 2.0 over a Unix socket, with one message
+// per line. A client should start with the Initialize method and check
+// the ProtocolVersion of the result; methods may gain fields within a
+// version, but never lose or change them.
+//
+// While a request runs, the daemon sends notifications that carry the
+// request's ID: Progress for each step UPM takes, line of output from
+// the package manager and message it logs, and SearchResult for each
+// result of SearchStream. The response to the request comes after all
+// of its notifications. A request that fails has an error with code
+// ErrorCode and the exit code of the equivalent upm command in its
+// data, as ErrorData.
+package upmrpc
+
+import (
+	"encoding/json"
+
+	"github.com/replit/upm/internal/api"
+)
+
+// ProtocolVersion is the version of the protocol defined by this
+// package.
+const ProtocolVersion = 1
+
+// The methods of the protocol, with their parameters and results.
+const (
+	// MethodInitialize takes no parameters and returns an
+	// InitializeResult.
+	MethodInitialize = "v1.Initialize"
+
+	// MethodListPackages takes ListPackagesParams and returns a
+	// ListPackagesResult, like 'upm list'.
+	MethodListPackages = "v1.ListPackages"
+
+	// MethodGuess takes GuessParams and returns a GuessResult, like
+	// 'upm guess'.
+	MethodGuess = "v1.Guess"
+
+	// MethodAdd takes AddParams and returns an AddResult, like
+	// 'upm add', reporting Progress as it goes.
+	MethodAdd = "v1.Add"
+
+	// MethodSearchStream takes SearchStreamParams, sends a
+	// SearchResult notification for each result, best first, and
+	// returns a SearchStreamResult, like 'upm search'.
+	MethodSearchStream = "v1.SearchStream"
+)
+
+// The notifications of the protocol, which the daemon sends while a
+// request runs.
+const (
+	// NotificationProgress has ProgressParams.
+	NotificationProgress = "v1.Progress"
+
+	// NotificationSearchResult has SearchResultParams.
+	NotificationSearchResult = "v1.SearchResult"
+)
+
+// ErrorCode is the JSON-RPC error code of a failed UPM operation.
+const ErrorCode = -32000
+
+// ErrorData is the data of an error with ErrorCode.
+type ErrorData struct {
+	// ExitCode is the status the upm command would have exited
+	// with.
+	ExitCode int `json:"exitCode"`
+}
+
+// PkgInfo is the information about a package in a SearchResult.
+type PkgInfo = api.PkgInfo
+
+// InitializeResult describes the daemon.
+type InitializeResult struct {
+	ProtocolVersion int      `json:"protocolVersion"`
+	Version         string   `json:"version"`
+	Methods         []string `json:"methods"`
+}
+
+// Package is a package of the project.
+type Package struct {
+	Name    string `json:"name"`
+	Spec    string `json:"spec,omitempty"`
+	Version string `json:"version,omitempty"`
+	Source  string `json:"source,omitempty"`
+	Dev     bool   `json:"dev,omitempty"`
+	Group   string `json:"group,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+
+	// Transitive is set for packages that are only in the
+	// lockfile.
+	Transitive bool `json:"transitive,omitempty"`
+}
+
+// ListPackagesParams are the parameters of ListPackages. Language is
+// a --lang value; empty means the detected one.
+type ListPackagesParams struct {
+	Language string `json:"language,omitempty"`
+	All      bool   `json:"all,omitempty"`
+	Dev      bool   `json:"dev,omitempty"`
+	Prod     bool   `json:"prod,omitempty"`
+}
+
+// ListPackagesResult lists the packages of the project, sorted by
+// name. Language is the backend that was used.
+type ListPackagesResult struct {
+	Language string    `json:"language"`
+	Packages []Package `json:"packages"`
+}
+
+// GuessParams are the parameters of Guess.
+type GuessParams struct {
+	Language        string `json:"language,omitempty"`
+	All             bool   `json:"all,omitempty"`
+	Force           bool   `json:"force,omitempty"`
+	IncludeCommands bool   `json:"includeCommands,omitempty"`
+}
+
+// GuessResult lists the packages the project imports but does not
+// depend on, or all of them with All.
+type GuessResult struct {
+	Language string   `json:"language"`
+	Packages []string `json:"packages"`
+}
+
+// AddParams are the parameters of Add. Packages maps package names to
+// version specs; an empty spec means any version. Force adds packages
+// whose names are near misses of much more popular packages, which
+// are otherwise refused, since the daemon cannot ask.
+type AddParams struct {
+	Language string            `json:"language,omitempty"`
+	Packages map[string]string `json:"packages"`
+	Dev      bool              `json:"dev,omitempty"`
+	Group    string            `json:"group,omitempty"`
+	Reason   string            `json:"reason,omitempty"`
+	Force    bool              `json:"force,omitempty"`
+}
+
+// AddResult is the result of Add.
+type AddResult struct {
+	Language string `json:"language"`
+}
+
+// SearchStreamParams are the parameters of SearchStream. Sort is a
+// --sort value; Limit is zero for no limit.
+type SearchStreamParams struct {
+	Language string `json:"language,omitempty"`
+	Query    string `json:"query"`
+	Limit    int    `json:"limit,omitempty"`
+	Sort     string `json:"sort,omitempty"`
+	Exact    bool   `json:"exact,omitempty"`
+}
+
+// SearchStreamResult ends a SearchStream, once every SearchResult has
+// been sent.
+type SearchStreamResult struct {
+	Language string `json:"language"`
+	Count    int    `json:"count"`
+}
+
+// The kinds of Progress.
+const (
+	// ProgressStep is a step UPM takes, such as running a command
+	// or writing a file.
+	ProgressStep = "step"
+
+	// ProgressOutput is a line of output from a command UPM is
+	// running.
+	ProgressOutput = "output"
+
+	// ProgressMessage is any other message UPM logs.
+	ProgressMessage = "message"
+)
+
+// ProgressParams are the parameters of a Progress notification.
+type ProgressParams struct {
+	// RequestID is the ID of the request that is running.
+	RequestID json.RawMessage `json:"requestId"`
+
+	// Kind is one of ProgressStep, ProgressOutput and
+	// ProgressMessage.
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+}
+
+// SearchResultParams are the parameters of a SearchResult
+// notification.
+type SearchResultParams struct {
+	RequestID json.RawMessage `json:"requestId"`
+	Package   PkgInfo         `json:"package"`
+}
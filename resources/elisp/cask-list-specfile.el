@@ -1,18 +0,0 @@
-;; This is code that Cask can evaluate in order to print a list of all
-;; packages from the specfile (Cask) to stdout, in "name=spec" format.
-
-(let* ((bundle (cask-cli--bundle))
-       (deps (append (cask-runtime-dependencies bundle)
-                     (cask-development-dependencies bundle))))
-  (dolist (d deps)
-    (let ((fetcher (cask-dependency-fetcher d))
-          (url (cask-dependency-url d))
-          (files (cask-dependency-files d))
-          (ref (cask-dependency-ref d))
-          (branch (cask-dependency-branch d)))
-      (princ (format "%S=%s%s%s%s\n"
-                     (cask-dependency-name d)
-                     (if fetcher (format "%S %S" fetcher url) "")
-                     (if files (format ":files %S" files) "")
-                     (if ref (format ":ref %S" ref) "")
-                     (if branch (format ":branch %S" branch) ""))))))